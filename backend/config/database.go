@@ -26,10 +26,25 @@ func InitDatabase() (*gorm.DB, error) {
 		&models.File{},
 		&models.Analysis{},
 		&models.User{},
+		&models.RuleSet{},
+		&models.Symbol{},
+		&models.FileMetric{},
+		&models.CodeChunk{},
+		&models.Conversation{},
+		&models.Message{},
+		&models.PromptTemplate{},
+		&models.Vulnerability{},
+		&models.VulnerablePackage{},
+		&models.VulnerabilityImport{},
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	// block_size 列の追加前に計算した ssdeep からブロックサイズを埋める
+	if err := db.Exec(`UPDATE files SET block_size = CAST(split_part(ssdeep, ':', 1) AS bigint) WHERE block_size = 0 AND ssdeep ~ '^[0-9]+:'`).Error; err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"reverse-engineering-backend/models"
 	"reverse-engineering-backend/services"
@@ -32,8 +33,15 @@ func NewAnalysisController(db *gorm.DB, redis *redis.Client) *AnalysisController
 
 func (ac *AnalysisController) StartAnalysis(c *gin.Context) {
 	var request struct {
-		ProjectID uint     `json:"project_id" binding:"required"`
-		Types     []string `json:"types" binding:"required"` // code_analysis, dependency_map, documentation, pattern_detection
+		ProjectID          uint            `json:"project_id" binding:"required"`
+		Types              []string        `json:"types" binding:"required"` // code_analysis, dependency_map, documentation, pattern_detection, js_deobfuscate, pyc_decompile, protobuf_recovery, binary_diff, rule_scan, firmware_carve, call_graph, schema_recovery, api_discovery, traffic_analysis, metrics, secret_scan, sbom, vulnerability_scan, license_scan, clone_detection, investigation
+		RedactSecrets      *bool           `json:"redact_secrets"`           // AIに渡す内容から秘密情報を伏せ字にする（省略時は AI_REDACT_SECRETS に従う）
+		CompareProjects    []uint          `json:"compare_projects"`         // clone_detection で重複を探す他のプロジェクト
+		CloneMinTokens     int             `json:"clone_min_tokens"`         // clone_detection で報告する最小のトークン数
+		Question           string          `json:"question"`                 // investigation で調べる質問
+		InvestigationSteps int             `json:"investigation_steps"`      // investigation で AI が応答できる回数の上限
+		PromptTemplates    map[string]uint `json:"prompt_templates"`         // テンプレート名ごとに使う PromptTemplate の ID（省略時は有効な版）
+		Lang               string          `json:"lang"`                     // 結果の言語（ja, en。省略時はプロジェクト、ユーザーの設定の順に従う）
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -65,14 +73,73 @@ func (ac *AnalysisController) StartAnalysis(c *gin.Context) {
 		return
 	}
 
+	for _, analysisType := range request.Types {
+		if analysisType == "investigation" && strings.TrimSpace(request.Question) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "question is required for investigation",
+			})
+			return
+		}
+		if analysisType == "translation" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "translations are created with POST /analysis/:id/translate",
+			})
+			return
+		}
+		if analysisType == "binary_diff" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "binary diffs are created with POST /analysis/diff",
+			})
+			return
+		}
+	}
+
+	lang, err := services.NormalizeOutputLanguage(request.Lang)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	lang = services.ResolveOutputLanguage(ac.db, project.ID, lang)
+
+	for name, id := range request.PromptTemplates {
+		if _, err := services.ResolvePrompt(ac.db, name, lang, project.ID, project.Team, id); err != nil {
+			status := http.StatusInternalServerError
+			if isPromptRequestError(err) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+
+	metadata := ""
+	options := services.AnalysisOptions{
+		RedactSecrets:      request.RedactSecrets,
+		CompareProjects:    request.CompareProjects,
+		CloneMinTokens:     request.CloneMinTokens,
+		Question:           strings.TrimSpace(request.Question),
+		InvestigationSteps: request.InvestigationSteps,
+		PromptTemplates:    request.PromptTemplates,
+	}
+	if options.RedactSecrets != nil || len(options.CompareProjects) > 0 || options.CloneMinTokens > 0 || options.Question != "" || options.InvestigationSteps > 0 || len(options.PromptTemplates) > 0 {
+		data, _ := json.Marshal(options)
+		metadata = string(data)
+	}
+
 	var createdAnalyses []models.Analysis
 
 	// 解析タスクの作成
 	for _, analysisType := range request.Types {
 		analysis := models.Analysis{
-			ProjectID: request.ProjectID,
-			Type:      analysisType,
-			Status:    "pending",
+			ProjectID:      request.ProjectID,
+			Type:           analysisType,
+			Status:         "pending",
+			Metadata:       metadata,
+			OutputLanguage: lang,
 		}
 
 		if err := ac.db.Create(&analysis).Error; err != nil {
@@ -156,7 +223,126 @@ func (ac *AnalysisController) GetAnalysis(c *gin.Context) {
 		return
 	}
 
+	// 他の言語に翻訳した結果（translation の解析）
+	var translations []models.Analysis
+	if err := ac.db.Select("id, output_language, status, created_at, updated_at").
+		Where("source_id = ? AND type = ?", analysis.ID, "translation").Order("id").Find(&translations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch translations",
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
+		"analysis":     analysis,
+		"translations": translations,
+	})
+}
+
+// TranslateAnalysis 完了した解析の結果を別の言語に翻訳する解析をキューに積む
+// 翻訳は元の解析と並ぶ translation の解析（source_id が元の解析）として保存する。同じ言語の翻訳が失敗以外の状態であればそれを返す
+func (ac *AnalysisController) TranslateAnalysis(c *gin.Context) {
+	var request struct {
+		Lang string `json:"lang" binding:"required"` // 翻訳先の言語（ja, en）
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	lang, err := services.NormalizeOutputLanguage(request.Lang)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var source models.Analysis
+	if err := ac.db.First(&source, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Analysis not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch analysis",
+			})
+		}
+		return
+	}
+	if source.Status != "completed" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Only completed analyses can be translated",
+		})
+		return
+	}
+	if !services.CanTranslateAnalysis(source.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": source.Type + " results have no text to translate",
+		})
+		return
+	}
+	sourceLang := source.OutputLanguage
+	if sourceLang == "" {
+		sourceLang = "ja"
+	}
+	if sourceLang == lang {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Analysis is already in " + lang,
+		})
+		return
+	}
+
+	var existing models.Analysis
+	err = ac.db.Where("source_id = ? AND type = ? AND output_language = ? AND status <> ?", source.ID, "translation", lang, "failed").
+		Order("id DESC").First(&existing).Error
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "Translation already exists",
+			"analysis": existing,
+		})
+		return
+	}
+	if err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch translations",
+		})
+		return
+	}
+
+	sourceID := source.ID
+	analysis := models.Analysis{
+		ProjectID:      source.ProjectID,
+		FileID:         source.FileID,
+		Type:           "translation",
+		Status:         "pending",
+		Metadata:       source.Metadata,
+		OutputLanguage: lang,
+		SourceID:       &sourceID,
+	}
+	if err := ac.db.Create(&analysis).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create analysis task",
+		})
+		return
+	}
+
+	taskJSON, _ := json.Marshal(map[string]interface{}{
+		"analysis_id": analysis.ID,
+		"project_id":  analysis.ProjectID,
+		"type":        analysis.Type,
+	})
+	if err := ac.redis.LPush(context.Background(), ac.analysisQueue, taskJSON).Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to queue analysis task",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Translation started successfully",
 		"analysis": analysis,
 	})
 }
@@ -191,3 +377,397 @@ func (ac *AnalysisController) GetAnalysisStatus(c *gin.Context) {
 		"updated_at": analysis.UpdatedAt,
 	})
 }
+
+// DiffBinaries 2つのバイナリファイル、または2つのプロジェクト内の同名バイナリ同士の関数差分を解析キューに積む
+func (ac *AnalysisController) DiffBinaries(c *gin.Context) {
+	var request services.BinaryDiffRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	fileMode := request.OldFileID != 0 || request.NewFileID != 0
+	projectMode := request.OldProjectID != 0 || request.NewProjectID != 0
+	if fileMode == projectMode {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Specify either old_file_id/new_file_id or old_project_id/new_project_id",
+		})
+		return
+	}
+
+	// 結果は新しい側のプロジェクト（ファイル指定時はそのファイル）に紐づける
+	analysis := models.Analysis{
+		Type:   "binary_diff",
+		Status: "pending",
+	}
+	if fileMode {
+		if request.OldFileID == 0 || request.NewFileID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Both old_file_id and new_file_id are required",
+			})
+			return
+		}
+		var oldFile, newFile models.File
+		err := ac.db.First(&oldFile, request.OldFileID).Error
+		if err == nil {
+			err = ac.db.First(&newFile, request.NewFileID).Error
+		}
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": "File not found",
+				})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Failed to fetch file",
+				})
+			}
+			return
+		}
+		analysis.ProjectID = newFile.ProjectID
+		analysis.FileID = &newFile.ID
+	} else {
+		if request.OldProjectID == 0 || request.NewProjectID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Both old_project_id and new_project_id are required",
+			})
+			return
+		}
+		var oldProject, newProject models.Project
+		err := ac.db.First(&oldProject, request.OldProjectID).Error
+		if err == nil {
+			err = ac.db.First(&newProject, request.NewProjectID).Error
+		}
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": "Project not found",
+				})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Failed to fetch project",
+				})
+			}
+			return
+		}
+		analysis.ProjectID = request.NewProjectID
+	}
+
+	metadata, _ := json.Marshal(request)
+	analysis.Metadata = string(metadata)
+	analysis.OutputLanguage = services.ResolveOutputLanguage(ac.db, analysis.ProjectID, "")
+	if err := ac.db.Create(&analysis).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create analysis task",
+		})
+		return
+	}
+
+	taskJSON, _ := json.Marshal(map[string]interface{}{
+		"analysis_id": analysis.ID,
+		"project_id":  analysis.ProjectID,
+		"type":        analysis.Type,
+	})
+	if err := ac.redis.LPush(context.Background(), ac.analysisQueue, taskJSON).Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to queue analysis task",
+		})
+		return
+	}
+
+	ac.db.Model(&models.Project{}).Where("id = ?", analysis.ProjectID).Update("status", "analyzing")
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Binary diff started successfully",
+		"analysis": analysis,
+	})
+}
+
+// GetCallGraph call_graph 解析の結果を DOT・Mermaid・JSON で返す（?format=dot|mermaid|json）
+// ?callers=X&depth=N で X を呼び出している関数、?to=Y（&from=X）で起点から Y への経路に絞り込む
+func (ac *AnalysisController) GetCallGraph(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid analysis ID",
+		})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "dot" && format != "mermaid" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "format must be one of json, dot, mermaid",
+		})
+		return
+	}
+	callers, to := c.Query("callers"), c.Query("to")
+	if callers != "" && to != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Specify either callers or to",
+		})
+		return
+	}
+
+	var analysis models.Analysis
+	if err := ac.db.First(&analysis, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Analysis not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch analysis",
+			})
+		}
+		return
+	}
+	if analysis.Type != "call_graph" || analysis.Status != "completed" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Analysis is not a completed call_graph analysis",
+		})
+		return
+	}
+
+	var result struct {
+		Graph services.CallGraph `json:"graph"`
+	}
+	if err := json.Unmarshal([]byte(analysis.Result), &result); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to parse analysis result",
+		})
+		return
+	}
+	graph := &result.Graph
+	var paths [][]string
+
+	switch {
+	case callers != "":
+		depth, err := strconv.Atoi(c.DefaultQuery("depth", "1"))
+		if err != nil || depth < 1 || depth > 10 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "depth must be between 1 and 10",
+			})
+			return
+		}
+		targets := graph.FindNodes(callers)
+		if len(targets) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Function not found: " + callers,
+			})
+			return
+		}
+		graph = graph.Callers(targets, depth)
+
+	case to != "":
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil || limit < 1 || limit > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "limit must be between 1 and 100",
+			})
+			return
+		}
+		targets := graph.FindNodes(to)
+		if len(targets) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Function not found: " + to,
+			})
+			return
+		}
+		// 起点を指定しない場合は main などのエントリーポイントから探す
+		sources := graph.EntryPoints
+		if from := c.Query("from"); from != "" {
+			if sources = graph.FindNodes(from); len(sources) == 0 {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": "Function not found: " + from,
+				})
+				return
+			}
+		}
+		if len(sources) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "No entry points found; specify from",
+			})
+			return
+		}
+		paths = graph.Paths(sources, targets, limit, 30)
+		graph = graph.PathsGraph(paths)
+	}
+
+	switch format {
+	case "dot":
+		c.Data(http.StatusOK, "text/vnd.graphviz; charset=utf-8", []byte(graph.DOT()))
+	case "mermaid":
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(graph.Mermaid()))
+	default:
+		response := gin.H{
+			"analysis_id": analysis.ID,
+			"graph":       graph,
+		}
+		if to != "" {
+			if paths == nil {
+				paths = [][]string{}
+			}
+			response["paths"] = paths
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// GetDiagram 解析に対応する図を Mermaid・PlantUML・DOT・SVG・JSON で返す（?format=mermaid|plantuml|dot|svg|json）
+// ?type=dependencies は dependency_map 解析の結果から依存関係図を、?type=classes はプロジェクトのソースからクラス図を、
+// ?type=er は schema_recovery 解析の結果から ER 図を、?type=sequence は traffic_analysis 解析の結果からシーケンス図を作る
+// type を省略した場合は dependency_map 解析なら dependencies、schema_recovery 解析なら er、traffic_analysis 解析なら sequence、それ以外は classes
+func (ac *AnalysisController) GetDiagram(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid analysis ID",
+		})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	switch format {
+	case "json", "mermaid", "plantuml", "dot", "svg":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "format must be one of json, mermaid, plantuml, dot, svg",
+		})
+		return
+	}
+
+	var analysis models.Analysis
+	if err := ac.db.First(&analysis, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Analysis not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch analysis",
+			})
+		}
+		return
+	}
+
+	diagramType := c.Query("type")
+	if diagramType == "" {
+		switch analysis.Type {
+		case "dependency_map":
+			diagramType = "dependencies"
+		case "schema_recovery":
+			diagramType = "er"
+		case "traffic_analysis":
+			diagramType = "sequence"
+		default:
+			diagramType = "classes"
+		}
+	}
+
+	var diagram *services.Diagram
+	switch diagramType {
+	case "dependencies":
+		if analysis.Type != "dependency_map" || analysis.Status != "completed" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Analysis is not a completed dependency_map analysis",
+			})
+			return
+		}
+		var names []string
+		if err := ac.db.Model(&models.File{}).Where("project_id = ?", analysis.ProjectID).Pluck("name", &names).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch files",
+			})
+			return
+		}
+		if diagram, err = services.DependencyDiagram(analysis.Result, names); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+	case "classes":
+		var files []models.File
+		if err := ac.db.Where("project_id = ? AND content <> ''", analysis.ProjectID).Find(&files).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch files",
+			})
+			return
+		}
+		if diagram = services.ClassDiagram(files); len(diagram.Nodes) == 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": "No classes or structs found in project",
+			})
+			return
+		}
+
+	case "er":
+		if analysis.Type != "schema_recovery" || analysis.Status != "completed" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Analysis is not a completed schema_recovery analysis",
+			})
+			return
+		}
+		var result struct {
+			Schema services.SchemaModel `json:"schema"`
+		}
+		if err := json.Unmarshal([]byte(analysis.Result), &result); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to parse schema_recovery result",
+			})
+			return
+		}
+		diagram = result.Schema.Diagram()
+
+	case "sequence":
+		if analysis.Type != "traffic_analysis" || analysis.Status != "completed" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Analysis is not a completed traffic_analysis analysis",
+			})
+			return
+		}
+		var result struct {
+			Sequence *services.Diagram `json:"sequence"`
+		}
+		if err := json.Unmarshal([]byte(analysis.Result), &result); err != nil || result.Sequence == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to parse traffic_analysis result",
+			})
+			return
+		}
+		diagram = result.Sequence
+
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "type must be one of dependencies, classes, er, sequence",
+		})
+		return
+	}
+
+	switch format {
+	case "mermaid":
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(diagram.Mermaid()))
+	case "plantuml":
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(diagram.PlantUML()))
+	case "dot":
+		c.Data(http.StatusOK, "text/vnd.graphviz; charset=utf-8", []byte(diagram.DOT()))
+	case "svg":
+		svg, err := diagram.SVG()
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data(http.StatusOK, "image/svg+xml; charset=utf-8", []byte(svg))
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"analysis_id": analysis.ID,
+			"diagram":     diagram,
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"reverse-engineering-backend/models"
+	"reverse-engineering-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ChatController struct {
+	db         *gorm.DB
+	aiService  *services.AIService
+	embeddings *services.EmbeddingService
+}
+
+func NewChatController(db *gorm.DB) *ChatController {
+	return &ChatController{
+		db:         db,
+		aiService:  services.NewAIService(),
+		embeddings: services.NewEmbeddingService(),
+	}
+}
+
+// Chat プロジェクトのコードについての質問に答える
+// conversation_id を省くと新しい会話を始める。stream が true か Accept が text/event-stream なら
+// conversation・delta・done（失敗時は error）のイベントで回答を少しずつ返す
+func (cc *ChatController) Chat(c *gin.Context) {
+	var request struct {
+		Message        string `json:"message" binding:"required"`
+		ConversationID uint   `json:"conversation_id"`
+		Stream         bool   `json:"stream"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	question := strings.TrimSpace(request.Message)
+	if question == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "message is required",
+		})
+		return
+	}
+
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid project ID",
+		})
+		return
+	}
+	var project models.Project
+	if err := cc.db.First(&project, projectID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Project not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch project",
+			})
+		}
+		return
+	}
+
+	var conversation models.Conversation
+	if request.ConversationID != 0 {
+		err := cc.db.Where("id = ? AND project_id = ?", request.ConversationID, project.ID).First(&conversation).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": "Conversation not found",
+				})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Failed to fetch conversation",
+				})
+			}
+			return
+		}
+	} else {
+		conversation, err = services.StartConversation(cc.db, project.ID, question)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to create conversation",
+			})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	if !request.Stream && !strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		reply, err := services.AnswerChat(ctx, cc.db, cc.aiService, cc.embeddings, conversation, question, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":           "Failed to answer question: " + err.Error(),
+				"conversation_id": conversation.ID,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, reply)
+		return
+	}
+
+	// Server-Sent Events で返す
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("conversation", gin.H{"conversation_id": conversation.ID, "title": conversation.Title})
+	c.Writer.Flush()
+
+	reply, err := services.AnswerChat(ctx, cc.db, cc.aiService, cc.embeddings, conversation, question, func(delta string) {
+		c.SSEvent("delta", gin.H{"content": delta})
+		c.Writer.Flush()
+	})
+	if err != nil {
+		c.SSEvent("error", gin.H{"error": "Failed to answer question: " + err.Error()})
+		c.Writer.Flush()
+		return
+	}
+	c.SSEvent("done", reply)
+	c.Writer.Flush()
+}
+
+// GetConversations プロジェクトの会話を新しい順に返す
+func (cc *ChatController) GetConversations(c *gin.Context) {
+	var conversations []models.Conversation
+	if err := cc.db.Where("project_id = ?", c.Param("id")).Order("updated_at DESC").Find(&conversations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch conversations",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"conversations": conversations,
+	})
+}
+
+// GetConversation 会話の発言を参照付きで返す
+func (cc *ChatController) GetConversation(c *gin.Context) {
+	var conversation models.Conversation
+	if err := cc.db.First(&conversation, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Conversation not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch conversation",
+			})
+		}
+		return
+	}
+
+	var messages []models.Message
+	if err := cc.db.Where("conversation_id = ?", conversation.ID).Order("id").Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch messages",
+		})
+		return
+	}
+	views := make([]services.ChatMessageView, 0, len(messages))
+	for _, message := range messages {
+		views = append(views, services.ViewChatMessage(message))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"conversation": conversation,
+		"messages":     views,
+	})
+}
+
+// DeleteConversation 会話と発言を削除する
+func (cc *ChatController) DeleteConversation(c *gin.Context) {
+	var conversation models.Conversation
+	if err := cc.db.First(&conversation, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Conversation not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch conversation",
+			})
+		}
+		return
+	}
+
+	err := cc.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("conversation_id = ?", conversation.ID).Delete(&models.Message{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&conversation).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete conversation",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Conversation deleted successfully",
+	})
+}
@@ -5,10 +5,12 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
 	"reverse-engineering-backend/models"
+	"reverse-engineering-backend/services"
 	"reverse-engineering-backend/utils"
 
 	"github.com/gin-gonic/gin"
@@ -73,13 +75,8 @@ func (fc *FileController) UploadFiles(c *gin.Context) {
 		return
 	}
 
-	uploadPath := os.Getenv("UPLOAD_PATH")
-	if uploadPath == "" {
-		uploadPath = "./uploads"
-	}
-
 	// アップロードディレクトリの作成
-	projectUploadPath := filepath.Join(uploadPath, strconv.FormatUint(projectID, 10))
+	projectUploadPath := utils.ProjectUploadPath(uint(projectID))
 	if err := os.MkdirAll(projectUploadPath, 0755); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to create upload directory",
@@ -111,6 +108,9 @@ func (fc *FileController) UploadFiles(c *gin.Context) {
 			content = "" // バイナリファイルなどは内容を保存しない
 		}
 
+		// 既出ファイルの検索用にハッシュを記録する
+		hashes, _ := utils.HashFile(savePath)
+
 		// データベースへの保存
 		fileModel := models.File{
 			ProjectID: uint(projectID),
@@ -120,6 +120,11 @@ func (fc *FileController) UploadFiles(c *gin.Context) {
 			MimeType:  file.Header.Get("Content-Type"),
 			Content:   content,
 			Language:  utils.DetectLanguage(filename),
+			MD5:       hashes.MD5,
+			SHA1:      hashes.SHA1,
+			SHA256:    hashes.SHA256,
+			Ssdeep:    hashes.Ssdeep,
+			BlockSize: hashes.BlockSize,
 		}
 
 		if err := fc.db.Create(&fileModel).Error; err != nil {
@@ -129,8 +134,13 @@ func (fc *FileController) UploadFiles(c *gin.Context) {
 			return
 		}
 
+		// シンボルインデックスの更新（失敗してもアップロード自体は成功として扱う）
+		services.IndexFileSymbols(fc.db, &fileModel)
+
 		uploadedFiles = append(uploadedFiles, fileModel)
 	}
+	// 意味検索の索引はバックグラウンドで作る
+	services.ScheduleChunkIndexing()
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Files uploaded successfully",
@@ -216,6 +226,12 @@ func (fc *FileController) DeleteFile(c *gin.Context) {
 		// ファイルが既に存在しない場合は無視
 	}
 
+	// 解析で生成された派生ファイルも削除
+	fc.deleteDerivedFiles(file.ID)
+	services.RemoveFileSymbols(fc.db, file.ID)
+	services.RemoveFileMetrics(fc.db, file.ID)
+	services.RemoveFileChunks(fc.db, file.ID)
+
 	// データベースからファイルを削除
 	if err := fc.db.Delete(&file).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -229,6 +245,210 @@ func (fc *FileController) DeleteFile(c *gin.Context) {
 	})
 }
 
+// GetFileMetrics ファイルの指標と関数ごとの内訳を返す（metrics 解析で保存したもの）
+func (fc *FileController) GetFileMetrics(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid file ID",
+		})
+		return
+	}
+
+	var file models.File
+	if err := fc.db.Select("id, name").First(&file, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "File not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch file",
+			})
+		}
+		return
+	}
+
+	var record models.FileMetric
+	if err := fc.db.Where("file_id = ?", file.ID).First(&record).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "No metrics found for file; run a metrics analysis first",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch metrics",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"analysis_id": record.AnalysisID,
+		"metrics":     services.FileMetricsFromRecord(record, file.Name),
+	})
+}
+
+// SimilarFile 類似ファイル検索の結果
+type SimilarFile struct {
+	FileID      uint   `json:"file_id"`
+	ProjectID   uint   `json:"project_id"`
+	ProjectName string `json:"project_name"`
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	Ssdeep      string `json:"ssdeep"`
+	Score       int    `json:"score"`      // 0〜100（SHA-256 一致は 100）
+	MatchType   string `json:"match_type"` // sha256, ssdeep
+}
+
+// GetSimilarFiles 同一（SHA-256 一致）または類似（ssdeep）のファイルを全プロジェクトから探す
+// ユーザー認証が無いため、GET /projects と同じくプロジェクトの所有者を問わない全体の検索になる
+func (fc *FileController) GetSimilarFiles(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid file ID",
+		})
+		return
+	}
+
+	threshold, err := strconv.Atoi(c.DefaultQuery("threshold", "50"))
+	if err != nil || threshold < 1 || threshold > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "threshold must be between 1 and 100",
+		})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "limit must be between 1 and 200",
+		})
+		return
+	}
+
+	var file models.File
+	if err := fc.db.First(&file, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "File not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch file",
+			})
+		}
+		return
+	}
+
+	// ハッシュ導入前にアップロードされたファイルはここで計算して保存する
+	if file.SHA256 == "" {
+		hashes, err := utils.HashFile(file.Path)
+		if err != nil {
+			hashes = utils.ComputeFileHashes([]byte(file.Content))
+		}
+		file.MD5, file.SHA1, file.SHA256, file.Ssdeep, file.BlockSize = hashes.MD5, hashes.SHA1, hashes.SHA256, hashes.Ssdeep, hashes.BlockSize
+		fc.db.Model(&file).Updates(map[string]interface{}{
+			"md5":        hashes.MD5,
+			"sha1":       hashes.SHA1,
+			"sha256":     hashes.SHA256,
+			"ssdeep":     hashes.Ssdeep,
+			"block_size": hashes.BlockSize,
+		})
+	}
+
+	// 比較できるのはブロックサイズが同じか2倍違いのハッシュだけなので、その範囲を候補にする
+	query := fc.db.Select("id, project_id, name, size, sha256, ssdeep").Where("id <> ?", file.ID)
+	if file.BlockSize > 0 && file.Size > 0 {
+		query = query.Where("sha256 = ? OR block_size IN ?", file.SHA256, []int64{file.BlockSize, file.BlockSize * 2, file.BlockSize / 2})
+	} else {
+		query = query.Where("sha256 = ?", file.SHA256)
+	}
+	var candidates []models.File
+	if err := query.Find(&candidates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to search similar files",
+		})
+		return
+	}
+
+	projectIDs := make([]uint, 0, len(candidates))
+	for _, candidate := range candidates {
+		projectIDs = append(projectIDs, candidate.ProjectID)
+	}
+	var projects []models.Project
+	if err := fc.db.Select("id, name").Where("id IN ?", projectIDs).Find(&projects).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch projects",
+		})
+		return
+	}
+	projectNames := make(map[uint]string)
+	for _, project := range projects {
+		projectNames[project.ID] = project.Name
+	}
+
+	matches := []SimilarFile{}
+	for _, candidate := range candidates {
+		if _, ok := projectNames[candidate.ProjectID]; !ok {
+			continue // 削除されたプロジェクトのファイル
+		}
+		match := SimilarFile{
+			FileID:      candidate.ID,
+			ProjectID:   candidate.ProjectID,
+			ProjectName: projectNames[candidate.ProjectID],
+			Name:        candidate.Name,
+			Size:        candidate.Size,
+			SHA256:      candidate.SHA256,
+			Ssdeep:      candidate.Ssdeep,
+		}
+		if candidate.SHA256 == file.SHA256 {
+			match.Score, match.MatchType = 100, "sha256"
+		} else {
+			match.Score, match.MatchType = utils.SsdeepCompare(file.Ssdeep, candidate.Ssdeep), "ssdeep"
+			if match.Score < threshold {
+				continue
+			}
+		}
+		matches = append(matches, match)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].FileID < matches[j].FileID
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file_id": file.ID,
+		"md5":     file.MD5,
+		"sha1":    file.SHA1,
+		"sha256":  file.SHA256,
+		"ssdeep":  file.Ssdeep,
+		"similar": matches,
+	})
+}
+
+// deleteDerivedFiles 派生ファイルを再帰的に削除する
+func (fc *FileController) deleteDerivedFiles(parentID uint) {
+	var children []models.File
+	if err := fc.db.Where("parent_id = ?", parentID).Find(&children).Error; err != nil {
+		return
+	}
+	for _, child := range children {
+		fc.deleteDerivedFiles(child.ID)
+		services.RemoveFileSymbols(fc.db, child.ID)
+		services.RemoveFileMetrics(fc.db, child.ID)
+		services.RemoveFileChunks(fc.db, child.ID)
+		os.Remove(child.Path)
+		fc.db.Delete(&child)
+	}
+}
+
 func (fc *FileController) readFileContent(filePath string) (string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
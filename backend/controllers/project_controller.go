@@ -1,25 +1,34 @@
 package controllers
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 
 	"reverse-engineering-backend/models"
+	"reverse-engineering-backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ProjectController struct {
-	db    *gorm.DB
-	redis *redis.Client
+	db         *gorm.DB
+	redis      *redis.Client
+	embeddings *services.EmbeddingService
 }
 
 func NewProjectController(db *gorm.DB, redis *redis.Client) *ProjectController {
 	return &ProjectController{
-		db:    db,
-		redis: redis,
+		db:         db,
+		redis:      redis,
+		embeddings: services.NewEmbeddingService(),
 	}
 }
 
@@ -40,8 +49,10 @@ func (pc *ProjectController) GetProjects(c *gin.Context) {
 
 func (pc *ProjectController) CreateProject(c *gin.Context) {
 	var request struct {
-		Name        string `json:"name" binding:"required"`
-		Description string `json:"description"`
+		Name           string `json:"name" binding:"required"`
+		Description    string `json:"description"`
+		Team           string `json:"team"`
+		OutputLanguage string `json:"output_language"` // ja, en（省略時は所有者の設定に従う）
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -50,12 +61,21 @@ func (pc *ProjectController) CreateProject(c *gin.Context) {
 		})
 		return
 	}
+	outputLanguage, err := services.NormalizeOutputLanguage(request.OutputLanguage)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 
 	project := models.Project{
-		Name:        request.Name,
-		Description: request.Description,
-		UserID:      1, // TODO: 実際のユーザー認証実装後に修正
-		Status:      "pending",
+		Name:           request.Name,
+		Description:    request.Description,
+		Team:           strings.TrimSpace(request.Team),
+		OutputLanguage: outputLanguage,
+		UserID:         1, // TODO: 実際のユーザー認証実装後に修正
+		Status:         "pending",
 	}
 
 	if err := pc.db.Create(&project).Error; err != nil {
@@ -108,9 +128,11 @@ func (pc *ProjectController) UpdateProject(c *gin.Context) {
 	}
 
 	var request struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		Status      string `json:"status"`
+		Name           string  `json:"name"`
+		Description    string  `json:"description"`
+		Status         string  `json:"status"`
+		Team           *string `json:"team"`            // 空文字でチームから外す
+		OutputLanguage *string `json:"output_language"` // 空文字で所有者の設定に戻す
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -145,6 +167,19 @@ func (pc *ProjectController) UpdateProject(c *gin.Context) {
 	if request.Status != "" {
 		updates["status"] = request.Status
 	}
+	if request.Team != nil {
+		updates["team"] = strings.TrimSpace(*request.Team)
+	}
+	if request.OutputLanguage != nil {
+		outputLanguage, err := services.NormalizeOutputLanguage(*request.OutputLanguage)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		updates["output_language"] = outputLanguage
+	}
 
 	if err := pc.db.Model(&project).Updates(updates).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -178,3 +213,600 @@ func (pc *ProjectController) DeleteProject(c *gin.Context) {
 		"message": "Project deleted successfully",
 	})
 }
+
+// GetProtoCatalog 直近の protobuf_recovery 解析から gRPC のサービス・メソッド一覧をダウンロードする（?format=csv でCSV）
+func (pc *ProjectController) GetProtoCatalog(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid project ID",
+		})
+		return
+	}
+
+	var analysis models.Analysis
+	if err := pc.db.Where("project_id = ? AND type = ? AND status = ?", id, "protobuf_recovery", "completed").
+		Order("updated_at DESC").First(&analysis).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "No completed protobuf_recovery analysis found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch analysis",
+			})
+		}
+		return
+	}
+
+	var result struct {
+		Catalog []services.ProtoCatalogEntry `json:"catalog"`
+	}
+	if err := json.Unmarshal([]byte(analysis.Result), &result); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to parse analysis result",
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("project-%d-grpc-catalog", id)
+	if c.Query("format") == "csv" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{"path", "package", "service", "method", "input_type", "output_type", "client_streaming", "server_streaming", "file"})
+		for _, e := range result.Catalog {
+			w.Write([]string{e.Path, e.Package, e.Service, e.Method, e.InputType, e.OutputType,
+				strconv.FormatBool(e.ClientStreaming), strconv.FormatBool(e.ServerStreaming), e.File})
+		}
+		w.Flush()
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.json", filename))
+	c.JSON(http.StatusOK, gin.H{
+		"analysis_id": analysis.ID,
+		"catalog":     result.Catalog,
+	})
+}
+
+// GetOpenAPI 直近の api_discovery 解析から推定した OpenAPI 3.1 のドキュメントをダウンロードする
+// ?source=traffic のときは traffic_analysis 解析が観測した通信から起こした下書きを返す
+func (pc *ProjectController) GetOpenAPI(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid project ID",
+		})
+		return
+	}
+
+	analysisType, filename := "api_discovery", fmt.Sprintf("project-%d-openapi.json", id)
+	switch c.DefaultQuery("source", "code") {
+	case "code":
+	case "traffic":
+		analysisType, filename = "traffic_analysis", fmt.Sprintf("project-%d-traffic-openapi.json", id)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "source must be one of code, traffic",
+		})
+		return
+	}
+
+	var analysis models.Analysis
+	if err := pc.db.Where("project_id = ? AND type = ? AND status = ?", id, analysisType, "completed").
+		Order("updated_at DESC").First(&analysis).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "No completed " + analysisType + " analysis found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch analysis",
+			})
+		}
+		return
+	}
+
+	var result struct {
+		OpenAPI json.RawMessage `json:"openapi"`
+	}
+	if err := json.Unmarshal([]byte(analysis.Result), &result); err != nil || len(result.OpenAPI) == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to parse analysis result",
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Data(http.StatusOK, "application/json; charset=utf-8", result.OpenAPI)
+}
+
+// GetSBOM 直近の sbom 解析で作った SBOM をダウンロードする（?format=cyclonedx（既定）または spdx）
+func (pc *ProjectController) GetSBOM(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid project ID",
+		})
+		return
+	}
+
+	var key, contentType, filename string
+	switch c.DefaultQuery("format", "cyclonedx") {
+	case "cyclonedx":
+		key, contentType, filename = "cyclonedx", "application/vnd.cyclonedx+json", fmt.Sprintf("project-%d-sbom.cdx.json", id)
+	case "spdx":
+		key, contentType, filename = "spdx", "application/spdx+json", fmt.Sprintf("project-%d-sbom.spdx.json", id)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "format must be one of cyclonedx, spdx",
+		})
+		return
+	}
+
+	var analysis models.Analysis
+	if err := pc.db.Where("project_id = ? AND type = ? AND status = ?", id, "sbom", "completed").
+		Order("updated_at DESC").First(&analysis).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "No completed sbom analysis found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch analysis",
+			})
+		}
+		return
+	}
+
+	var result map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(analysis.Result), &result); err != nil || len(result[key]) == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to parse analysis result",
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Data(http.StatusOK, contentType+"; charset=utf-8", result[key])
+}
+
+// SymbolResult シンボル検索の結果（定義のあるファイル名付き）
+type SymbolResult struct {
+	models.Symbol
+	FileName string `json:"file_name"`
+}
+
+// XrefLocation シンボルの参照位置
+type XrefLocation struct {
+	FileID   uint   `json:"file_id"`
+	FileName string `json:"file_name"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Context  string `json:"context"`
+}
+
+// GetSymbols プロジェクトのシンボルを名前で検索する（?q= 部分一致、?kind= 種別、?file_id= ファイル）
+func (pc *ProjectController) GetSymbols(c *gin.Context) {
+	project, ok := pc.findProject(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "limit must be between 1 and 1000",
+		})
+		return
+	}
+
+	query := pc.db.Where("project_id = ?", project.ID)
+	q := strings.ToLower(strings.TrimSpace(c.Query("q")))
+	if q != "" {
+		query = query.Where("LOWER(name) LIKE ? ESCAPE '\\'", "%"+services.EscapeLike(q)+"%")
+	}
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if fileID := c.Query("file_id"); fileID != "" {
+		query = query.Where("file_id = ?", fileID)
+	}
+
+	// 完全一致、前方一致、その他の順に並べる
+	var symbols []models.Symbol
+	if err := query.
+		Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:  "LOWER(name) = ? DESC, LOWER(name) LIKE ? ESCAPE '\\' DESC, name, file_id, line",
+			Vars: []interface{}{q, services.EscapeLike(q) + "%"},
+		}}).
+		Limit(limit).
+		Find(&symbols).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to search symbols",
+		})
+		return
+	}
+
+	fileNames, err := pc.fileNames(symbols)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch files",
+		})
+		return
+	}
+	results := make([]SymbolResult, 0, len(symbols))
+	for _, symbol := range symbols {
+		results = append(results, SymbolResult{Symbol: symbol, FileName: fileNames[symbol.FileID]})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"project_id": project.ID,
+		"symbols":    results,
+	})
+}
+
+// SearchCode 自然文の問い合わせ（?q=）に意味の近いコード片を類似度の高い順に返す（?language= 言語、?limit= 件数）
+// 索引は ChunkIndexer がバックグラウンドで作り、まだ索引していないファイルの数を pending_files で返す
+func (pc *ProjectController) SearchCode(c *gin.Context) {
+	project, ok := pc.findProject(c)
+	if !ok {
+		return
+	}
+
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "q is required",
+		})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "limit must be between 1 and 100",
+		})
+		return
+	}
+
+	results, err := services.SearchCode(c.Request.Context(), pc.db, pc.embeddings, project.ID, q, c.Query("language"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to search code: " + err.Error(),
+		})
+		return
+	}
+	pending, err := services.PendingChunkFiles(pc.db, pc.embeddings, project.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to count pending files",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"project_id":    project.ID,
+		"query":         q,
+		"model":         pc.embeddings.Model(),
+		"pending_files": pending,
+		"results":       results,
+	})
+}
+
+// Grep ファイルの内容を行ごとに検索する（?q= 検索語、?regex=true 正規表現、?ignore_case=true 大文字小文字を区別しない、
+// ?path= / ?exclude= パスのグロブ（複数指定・カンマ区切り可）、?language= 言語、?context= 前後の行数、?limit= 一致する行の数の上限）
+func (pc *ProjectController) Grep(c *gin.Context) {
+	project, ok := pc.findProject(c)
+	if !ok {
+		return
+	}
+
+	q := c.Query("q")
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "q is required",
+		})
+		return
+	}
+	contextLines, err := strconv.Atoi(c.DefaultQuery("context", "2"))
+	if err != nil || contextLines < 0 || contextLines > 20 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "context must be between 0 and 20",
+		})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "200"))
+	if err != nil || limit < 1 || limit > 5000 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "limit must be between 1 and 5000",
+		})
+		return
+	}
+	regex, _ := strconv.ParseBool(c.DefaultQuery("regex", "false"))
+	ignoreCase, _ := strconv.ParseBool(c.DefaultQuery("ignore_case", "false"))
+
+	options := services.GrepOptions{
+		Query:      q,
+		Regex:      regex,
+		IgnoreCase: ignoreCase,
+		Paths:      splitQueryList(c.QueryArray("path")),
+		Excludes:   splitQueryList(c.QueryArray("exclude")),
+		Language:   c.Query("language"),
+		Context:    contextLines,
+		Limit:      limit,
+	}
+	// 検索語とグロブの誤りはデータベースに問い合わせる前に返す
+	if _, err := services.CompileGrepPattern(options); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	result, err := services.GrepProject(pc.db, project.ID, options)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "invalid glob") {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to search files",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"project_id": project.ID,
+		"query":      q,
+		"result":     result,
+	})
+}
+
+// GetXrefs シンボルの定義と参照箇所を返す（?symbol=Name または ?symbol=Type.Method）
+// 参照は名前の一致で探すため、同名の別の識別子も含まれる
+func (pc *ProjectController) GetXrefs(c *gin.Context) {
+	project, ok := pc.findProject(c)
+	if !ok {
+		return
+	}
+
+	symbol := strings.TrimSpace(c.Query("symbol"))
+	if symbol == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "symbol is required",
+		})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "500"))
+	if err != nil || limit < 1 || limit > 5000 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "limit must be between 1 and 5000",
+		})
+		return
+	}
+
+	// Type.Method、Type::Method は所属で絞り込む
+	container, name := "", symbol
+	if i := strings.LastIndex(symbol, "::"); i > 0 {
+		container, name = symbol[:i], symbol[i+2:]
+	} else if i := strings.LastIndex(symbol, "."); i > 0 {
+		container, name = symbol[:i], symbol[i+1:]
+	}
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid symbol",
+		})
+		return
+	}
+
+	query := pc.db.Where("project_id = ? AND name = ?", project.ID, name)
+	if container != "" {
+		query = query.Where("container = ?", container)
+	}
+	var definitions []models.Symbol
+	if err := query.Order("file_id, line").Find(&definitions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch definitions",
+		})
+		return
+	}
+	fileNames, err := pc.fileNames(definitions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch files",
+		})
+		return
+	}
+	defResults := make([]SymbolResult, 0, len(definitions))
+	type position struct {
+		fileID       uint
+		line, column int
+	}
+	defined := make(map[position]bool)
+	for _, def := range definitions {
+		defResults = append(defResults, SymbolResult{Symbol: def, FileName: fileNames[def.FileID]})
+		defined[position{def.FileID, def.Line, def.Column}] = true
+	}
+
+	// 名前を含むファイルだけを読み、識別子として現れる位置を探す
+	var files []models.File
+	if err := pc.db.Select("id, name, language, content").
+		Where("project_id = ? AND content LIKE ? ESCAPE '\\'", project.ID, "%"+services.EscapeLike(name)+"%").
+		Order("id").Find(&files).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to search files",
+		})
+		return
+	}
+	references := []XrefLocation{}
+	truncated := false
+	for _, file := range files {
+		for _, ref := range services.FindSymbolReferences(file.Language, file.Content, name) {
+			if defined[position{file.ID, ref.Line, ref.Column}] {
+				continue
+			}
+			if len(references) >= limit {
+				truncated = true
+				break
+			}
+			references = append(references, XrefLocation{
+				FileID:   file.ID,
+				FileName: file.Name,
+				Line:     ref.Line,
+				Column:   ref.Column,
+				Context:  ref.Context,
+			})
+		}
+		if truncated {
+			break
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"project_id":  project.ID,
+		"symbol":      symbol,
+		"definitions": defResults,
+		"references":  references,
+		"truncated":   truncated,
+	})
+}
+
+// GetMetrics metrics 解析で保存したファイルごとの最新の指標をプロジェクト全体に集計し、ホットスポットを並べる（analysis_ids は集計に使った解析）
+// ?sort=hotspot|cyclomatic|cognitive|nesting|fan_in|fan_out|loc で順位の基準、?limit= で件数、?language= で言語を絞る
+func (pc *ProjectController) GetMetrics(c *gin.Context) {
+	project, ok := pc.findProject(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "limit must be between 1 and 500",
+		})
+		return
+	}
+
+	// 削除済みのファイルの指標は集計に入れない
+	query := pc.db.Select("file_metrics.*").
+		Joins("JOIN files ON files.id = file_metrics.file_id AND files.deleted_at IS NULL").
+		Where("file_metrics.project_id = ?", project.ID)
+	if language := c.Query("language"); language != "" {
+		query = query.Where("file_metrics.language = ?", language)
+	}
+	var records []models.FileMetric
+	if err := query.Find(&records).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch metrics",
+		})
+		return
+	}
+	if len(records) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "No metrics found; run a metrics analysis first",
+		})
+		return
+	}
+
+	ids := make([]uint, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.FileID)
+	}
+	var files []models.File
+	if err := pc.db.Select("id, name").Where("id IN ?", ids).Find(&files).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch files",
+		})
+		return
+	}
+	names := make(map[uint]string, len(files))
+	for _, file := range files {
+		names[file.ID] = file.Name
+	}
+	metrics := make([]*services.FileMetrics, 0, len(records))
+	// ファイルごとに最後に計測した解析が違うことがあるので、集計に使った解析をすべて返す
+	analysisIDs := []uint{}
+	seen := make(map[uint]bool)
+	for _, record := range records {
+		metrics = append(metrics, services.FileMetricsFromRecord(record, names[record.FileID]))
+		if !seen[record.AnalysisID] {
+			seen[record.AnalysisID] = true
+			analysisIDs = append(analysisIDs, record.AnalysisID)
+		}
+	}
+	slices.Sort(analysisIDs)
+
+	aggregate, err := services.AggregateMetrics(metrics, c.DefaultQuery("sort", "hotspot"), limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"project_id":   project.ID,
+		"analysis_ids": analysisIDs,
+		"metrics":      aggregate,
+	})
+}
+
+// findProject パスの :id からプロジェクトを取得する。見つからない場合はレスポンスを書いて ok = false
+func (pc *ProjectController) findProject(c *gin.Context) (models.Project, bool) {
+	var project models.Project
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid project ID",
+		})
+		return project, false
+	}
+	if err := pc.db.First(&project, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Project not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch project",
+			})
+		}
+		return project, false
+	}
+	return project, true
+}
+
+// fileNames シンボルが属するファイルの名前を引く
+func (pc *ProjectController) fileNames(symbols []models.Symbol) (map[uint]string, error) {
+	names := make(map[uint]string)
+	if len(symbols) == 0 {
+		return names, nil
+	}
+	var ids []uint
+	for _, symbol := range symbols {
+		ids = append(ids, symbol.FileID)
+	}
+	var files []models.File
+	if err := pc.db.Select("id, name").Where("id IN ?", ids).Find(&files).Error; err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		names[file.ID] = file.Name
+	}
+	return names, nil
+}
+
+// splitQueryList 繰り返し指定とカンマ区切りの両方を受け付ける
+func splitQueryList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
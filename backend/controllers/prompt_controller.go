@@ -0,0 +1,439 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"reverse-engineering-backend/models"
+	"reverse-engineering-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PromptController struct {
+	db *gorm.DB
+}
+
+func NewPromptController(db *gorm.DB) *PromptController {
+	return &PromptController{
+		db: db,
+	}
+}
+
+// GetPrompts 既定のテンプレートと登録済みの上書きを返す（lang を指定するとその言語で使うものだけ）
+// project_id を指定すると、そのプロジェクトで実際に使われる版も返す
+func (pc *PromptController) GetPrompts(c *gin.Context) {
+	lang, err := services.NormalizeOutputLanguage(c.Query("lang"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	query := pc.db.Order("name, scope, language, version DESC")
+	if name := c.Query("name"); name != "" {
+		query = query.Where("name = ?", name)
+	}
+	if scope := c.Query("scope"); scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+	if team := c.Query("team"); team != "" {
+		query = query.Where("team = ?", team)
+	}
+	if lang != "" {
+		query = query.Where("language IN ?", []string{"", lang})
+	}
+
+	var project *models.Project
+	if value := c.Query("project_id"); value != "" {
+		projectID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid project ID",
+			})
+			return
+		}
+		project = &models.Project{}
+		if err := pc.db.First(project, projectID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": "Project not found",
+				})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Failed to fetch project",
+				})
+			}
+			return
+		}
+		query = query.Where("project_id = ?", project.ID)
+	}
+
+	var templates []models.PromptTemplate
+	if err := query.Find(&templates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch prompt templates",
+		})
+		return
+	}
+
+	names := make([]string, 0, len(services.PromptNames))
+	for name := range services.PromptNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	languages := []string{lang}
+	if lang == "" {
+		languages = make([]string, 0, len(services.OutputLanguages))
+		for language := range services.OutputLanguages {
+			languages = append(languages, language)
+		}
+		sort.Strings(languages)
+	}
+	effectiveLang := ""
+	if project != nil {
+		effectiveLang = services.ResolveOutputLanguage(pc.db, project.ID, lang)
+	}
+
+	builtins := make([]gin.H, 0, len(names)*len(languages))
+	effective := make([]*services.ResolvedPrompt, 0, len(names))
+	for _, name := range names {
+		for _, language := range languages {
+			builtin, err := services.BuiltinPrompt(name, language)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Failed to load builtin prompt: " + err.Error(),
+				})
+				return
+			}
+			builtins = append(builtins, gin.H{
+				"name":     name,
+				"language": builtin.Language,
+				"fields":   services.PromptNames[name],
+				"version":  builtin.Version,
+				"body":     builtin.Body,
+			})
+		}
+		if project != nil {
+			prompt, err := services.ResolvePrompt(pc.db, name, effectiveLang, project.ID, project.Team, 0)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Failed to resolve prompt: " + err.Error(),
+				})
+				return
+			}
+			effective = append(effective, prompt)
+		}
+	}
+
+	response := gin.H{
+		"builtin":   builtins,
+		"templates": templates,
+	}
+	if project != nil {
+		response["effective"] = effective
+		response["effective_language"] = effectiveLang
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CreatePrompt テンプレートの新しい版を登録する
+// 版の番号は同じ名前・同じ対象・同じ言語の中で連番になり、activate を false にしなければ以前の版に代わって使われる
+func (pc *PromptController) CreatePrompt(c *gin.Context) {
+	var request struct {
+		Name        string `json:"name" binding:"required"`
+		Scope       string `json:"scope"`
+		Team        string `json:"team"`
+		ProjectID   *uint  `json:"project_id"`
+		Language    string `json:"language"` // このテンプレートを使う出力言語（ja, en。省略時はどの言語でも使う）
+		Body        string `json:"body" binding:"required"`
+		Description string `json:"description"`
+		Activate    *bool  `json:"activate"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	language, err := services.NormalizeOutputLanguage(request.Language)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// 対象から scope を決める（明示されていればそれに合っているかを確かめる）
+	team := strings.TrimSpace(request.Team)
+	scope := request.Scope
+	if scope == "" {
+		switch {
+		case request.ProjectID != nil:
+			scope = "project"
+		case team != "":
+			scope = "team"
+		default:
+			scope = "global"
+		}
+	}
+	switch scope {
+	case "global":
+		if team != "" || request.ProjectID != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "global templates cannot have team or project_id",
+			})
+			return
+		}
+	case "team":
+		if team == "" || request.ProjectID != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "team templates require team and cannot have project_id",
+			})
+			return
+		}
+	case "project":
+		if request.ProjectID == nil || team != "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "project templates require project_id and cannot have team",
+			})
+			return
+		}
+		var project models.Project
+		if err := pc.db.First(&project, *request.ProjectID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": "Project not found",
+				})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Failed to fetch project",
+				})
+			}
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "scope must be one of: global, team, project",
+		})
+		return
+	}
+
+	if _, err := services.ParsePromptTemplate(request.Name, request.Body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	template := models.PromptTemplate{
+		Name:        request.Name,
+		Scope:       scope,
+		Team:        team,
+		ProjectID:   request.ProjectID,
+		Language:    language,
+		Body:        request.Body,
+		Description: request.Description,
+		Active:      request.Activate == nil || *request.Activate,
+	}
+	err = pc.db.Transaction(func(tx *gorm.DB) error {
+		var latest int
+		if err := pc.sameTarget(tx, template).Unscoped().Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		template.Version = latest + 1
+		if template.Active {
+			if err := pc.sameTarget(tx, template).Update("active", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&template).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create prompt template",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"template": template,
+		"version":  services.PromptVersion(template),
+	})
+}
+
+func (pc *PromptController) GetPrompt(c *gin.Context) {
+	template, ok := pc.findPrompt(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"template": template,
+	})
+}
+
+// ActivatePrompt 指定した版を有効にし、同じ名前・同じ対象・同じ言語の他の版を無効にする（以前の版に戻すときに使う）
+func (pc *PromptController) ActivatePrompt(c *gin.Context) {
+	template, ok := pc.findPrompt(c)
+	if !ok {
+		return
+	}
+
+	err := pc.db.Transaction(func(tx *gorm.DB) error {
+		if err := pc.sameTarget(tx, template).Update("active", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&template).Update("active", true).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to activate prompt template",
+		})
+		return
+	}
+	template.Active = true
+
+	c.JSON(http.StatusOK, gin.H{
+		"template": template,
+	})
+}
+
+// DeletePrompt テンプレートの版を削除する（解析に記録した版の番号は再利用しない）
+func (pc *PromptController) DeletePrompt(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid prompt template ID",
+		})
+		return
+	}
+
+	if err := pc.db.Delete(&models.PromptTemplate{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete prompt template",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Prompt template deleted successfully",
+	})
+}
+
+// PreviewPrompt ファイルに対して AI に渡すプロンプトを、AI を呼ばずに返す
+// template_id で特定の版を、body で保存前のテンプレートを試せる
+func (pc *PromptController) PreviewPrompt(c *gin.Context) {
+	var request struct {
+		Name          string `json:"name" binding:"required"`
+		FileID        uint   `json:"file_id" binding:"required"`
+		TemplateID    uint   `json:"template_id"`
+		Body          string `json:"body"`
+		Lang          string `json:"lang"` // 省略時はプロジェクト、ユーザーの設定の順に従う
+		RedactSecrets *bool  `json:"redact_secrets"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var file models.File
+	if err := pc.db.First(&file, request.FileID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "File not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch file",
+			})
+		}
+		return
+	}
+
+	lang, err := services.NormalizeOutputLanguage(request.Lang)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	prompt, text, err := services.PreviewPrompt(pc.db, request.Name, file, lang, request.TemplateID, request.Body, request.RedactSecrets)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if isPromptRequestError(err) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":        prompt.Name,
+		"source":      prompt.Source,
+		"version":     prompt.Version,
+		"language":    prompt.Language,
+		"template_id": prompt.TemplateID,
+		"prompt":      text,
+	})
+}
+
+// sameTarget テンプレートと同じ名前・同じ対象（全体、チーム、プロジェクト）・同じ言語の版を絞り込む
+func (pc *PromptController) sameTarget(tx *gorm.DB, template models.PromptTemplate) *gorm.DB {
+	query := tx.Model(&models.PromptTemplate{}).Where("name = ? AND scope = ? AND language = ?", template.Name, template.Scope, template.Language)
+	switch template.Scope {
+	case "team":
+		query = query.Where("team = ?", template.Team)
+	case "project":
+		query = query.Where("project_id = ?", *template.ProjectID)
+	}
+	return query
+}
+
+func (pc *PromptController) findPrompt(c *gin.Context) (models.PromptTemplate, bool) {
+	var template models.PromptTemplate
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid prompt template ID",
+		})
+		return template, false
+	}
+
+	if err := pc.db.First(&template, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Prompt template not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch prompt template",
+			})
+		}
+		return template, false
+	}
+	return template, true
+}
+
+// isPromptRequestError 指定したテンプレートの名前・本文・版が誤っているか（データベースの失敗などと区別する）
+func isPromptRequestError(err error) bool {
+	for _, target := range []error{services.ErrUnknownPrompt, services.ErrInvalidTemplate, services.ErrPromptTemplateNotFound, services.ErrPreviewNotSupported} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"reverse-engineering-backend/models"
+	"reverse-engineering-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RuleController struct {
+	db *gorm.DB
+}
+
+func NewRuleController(db *gorm.DB) *RuleController {
+	return &RuleController{
+		db: db,
+	}
+}
+
+func (rc *RuleController) GetRuleSets(c *gin.Context) {
+	var ruleSets []models.RuleSet
+	if err := rc.db.Order("id").Find(&ruleSets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch rule sets",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rule_sets": ruleSets,
+	})
+}
+
+// CreateRuleSet ルールを登録する（登録前にコンパイルして構文エラーを返す）
+func (rc *RuleController) CreateRuleSet(c *gin.Context) {
+	var request struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+		Source      string `json:"source" binding:"required"`
+		Enabled     *bool  `json:"enabled"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	rules, err := services.ParseYaraRules(request.Source)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid rules: " + err.Error(),
+		})
+		return
+	}
+
+	ruleSet := models.RuleSet{
+		Name:        request.Name,
+		Description: request.Description,
+		Source:      request.Source,
+		Enabled:     request.Enabled == nil || *request.Enabled,
+		UserID:      1, // TODO: 実際のユーザー認証実装後に修正
+	}
+	if err := rc.db.Create(&ruleSet).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create rule set",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"rule_set": ruleSet,
+		"rules":    ruleNames(rules),
+	})
+}
+
+func (rc *RuleController) GetRuleSet(c *gin.Context) {
+	ruleSet, ok := rc.findRuleSet(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rule_set": ruleSet,
+	})
+}
+
+func (rc *RuleController) UpdateRuleSet(c *gin.Context) {
+	ruleSet, ok := rc.findRuleSet(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Source      string `json:"source"`
+		Enabled     *bool  `json:"enabled"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// 更新フィールドの設定
+	updates := make(map[string]interface{})
+	if request.Name != "" {
+		updates["name"] = request.Name
+	}
+	if request.Description != "" {
+		updates["description"] = request.Description
+	}
+	if request.Source != "" {
+		if _, err := services.ParseYaraRules(request.Source); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid rules: " + err.Error(),
+			})
+			return
+		}
+		updates["source"] = request.Source
+	}
+	if request.Enabled != nil {
+		updates["enabled"] = *request.Enabled
+	}
+
+	if err := rc.db.Model(&ruleSet).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update rule set",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rule_set": ruleSet,
+	})
+}
+
+func (rc *RuleController) DeleteRuleSet(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid rule set ID",
+		})
+		return
+	}
+
+	if err := rc.db.Delete(&models.RuleSet{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete rule set",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Rule set deleted successfully",
+	})
+}
+
+func (rc *RuleController) findRuleSet(c *gin.Context) (models.RuleSet, bool) {
+	var ruleSet models.RuleSet
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid rule set ID",
+		})
+		return ruleSet, false
+	}
+
+	if err := rc.db.First(&ruleSet, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Rule set not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch rule set",
+			})
+		}
+		return ruleSet, false
+	}
+	return ruleSet, true
+}
+
+func ruleNames(rules []*services.YaraRule) []string {
+	names := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		names = append(names, rule.Name)
+	}
+	return names
+}
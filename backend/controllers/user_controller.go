@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"reverse-engineering-backend/models"
+	"reverse-engineering-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type UserController struct {
+	db *gorm.DB
+}
+
+func NewUserController(db *gorm.DB) *UserController {
+	return &UserController{
+		db: db,
+	}
+}
+
+func (uc *UserController) GetUser(c *gin.Context) {
+	user, ok := uc.findUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": user,
+	})
+}
+
+// UpdateUser ユーザーの設定を更新する（output_language はプロジェクトで指定が無いときの解析結果の言語）
+func (uc *UserController) UpdateUser(c *gin.Context) {
+	user, ok := uc.findUser(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Name           string  `json:"name"`
+		OutputLanguage *string `json:"output_language"` // 空文字で AI_OUTPUT_LANGUAGE に戻す
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// 更新フィールドの設定
+	updates := make(map[string]interface{})
+	if request.Name != "" {
+		updates["name"] = request.Name
+	}
+	if request.OutputLanguage != nil {
+		outputLanguage, err := services.NormalizeOutputLanguage(*request.OutputLanguage)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		updates["output_language"] = outputLanguage
+	}
+
+	if err := uc.db.Model(&user).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update user",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": user,
+	})
+}
+
+func (uc *UserController) findUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return user, false
+	}
+
+	if err := uc.db.First(&user, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch user",
+			})
+		}
+		return user, false
+	}
+	return user, true
+}
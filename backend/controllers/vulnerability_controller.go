@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"reverse-engineering-backend/models"
+	"reverse-engineering-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type VulnerabilityController struct {
+	db *gorm.DB
+}
+
+func NewVulnerabilityController(db *gorm.DB) *VulnerabilityController {
+	return &VulnerabilityController{
+		db: db,
+	}
+}
+
+// ImportOSV OSV のデータダンプ（zip）を取り込む（vulnerability_scan 解析で使用）
+func (vc *VulnerabilityController) ImportOSV(c *gin.Context) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "No file provided",
+		})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Failed to read uploaded file",
+		})
+		return
+	}
+	defer file.Close()
+
+	record, err := services.ImportOSVArchive(vc.db, file, header.Size, header.Filename)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "invalid zip archive") {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to import vulnerability database",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"import": record,
+	})
+}
+
+// GetVulnerabilityDatabase 取り込み済みの脆弱性の件数（エコシステムごと）と取り込み履歴を返す
+func (vc *VulnerabilityController) GetVulnerabilityDatabase(c *gin.Context) {
+	var total int64
+	if err := vc.db.Model(&models.Vulnerability{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch vulnerability database",
+		})
+		return
+	}
+
+	var rows []struct {
+		Ecosystem string
+		Count     int64
+	}
+	if err := vc.db.Model(&models.VulnerablePackage{}).
+		Select("ecosystem, COUNT(DISTINCT vulnerability_id) AS count").
+		Group("ecosystem").Order("ecosystem").Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch vulnerability database",
+		})
+		return
+	}
+	ecosystems := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		ecosystems[row.Ecosystem] = row.Count
+	}
+
+	var imports []models.VulnerabilityImport
+	if err := vc.db.Order("id DESC").Limit(20).Find(&imports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch vulnerability imports",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"vulnerabilities": total,
+		"ecosystems":      ecosystems,
+		"imports":         imports,
+	})
+}
+
+// GetVulnerability OSV の ID または CVE・GHSA などの別名で脆弱性を引く
+func (vc *VulnerabilityController) GetVulnerability(c *gin.Context) {
+	id := strings.TrimSpace(c.Param("id"))
+
+	var vulnerability models.Vulnerability
+	err := vc.db.Where("osv_id = ?", id).First(&vulnerability).Error
+	if err == gorm.ErrRecordNotFound {
+		// 別名はカンマ区切りなので、前後を区切りで囲んで完全一致で探す
+		err = vc.db.Where("',' || aliases || ',' LIKE ? ESCAPE '\\'", "%,"+services.EscapeLike(id)+",%").
+			Order("modified DESC").First(&vulnerability).Error
+	}
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Vulnerability not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch vulnerability",
+			})
+		}
+		return
+	}
+
+	var packages []models.VulnerablePackage
+	if err := vc.db.Where("vulnerability_id = ?", vulnerability.ID).Order("ecosystem, name").Find(&packages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch affected packages",
+		})
+		return
+	}
+	affected := make([]gin.H, 0, len(packages))
+	for _, p := range packages {
+		var ranges []services.OSVRange
+		var versions []string
+		_ = json.Unmarshal([]byte(p.Ranges), &ranges)
+		_ = json.Unmarshal([]byte(p.Versions), &versions)
+		affected = append(affected, gin.H{
+			"ecosystem": p.Ecosystem,
+			"name":      p.Name,
+			"ranges":    ranges,
+			"versions":  versions,
+		})
+	}
+	var references []services.OSVReference
+	_ = json.Unmarshal([]byte(vulnerability.References), &references)
+
+	c.JSON(http.StatusOK, gin.H{
+		"vulnerability": vulnerability,
+		"references":    references,
+		"affected":      affected,
+	})
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
 	"reverse-engineering-backend/config"
 	"reverse-engineering-backend/routes"
+	"reverse-engineering-backend/services"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -24,12 +26,26 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
+	// 意味検索のベクトルストア（pgvector が無ければプロセス内で検索する）
+	services.InitVectorStore(db)
+	// grep 用のトライグラム索引（pg_trgm が無ければ索引なしで検索する）
+	services.InitCodeSearchIndex(db)
+	// シンボルインデックス導入前のファイルを索引する（リクエストの処理は待たない）
+	go services.BackfillSymbolIndex(db)
+
 	// Redis接続
 	redis, err := config.InitRedis()
 	if err != nil {
 		log.Fatal("Failed to connect to Redis:", err)
 	}
 
+	// 解析ワーカーの起動
+	worker := services.NewAnalysisWorker(db, redis)
+	go worker.Run(context.Background())
+
+	// 意味検索の索引（埋め込みの計算）はリクエストの外で行う
+	go services.NewChunkIndexer(db).Run(context.Background())
+
 	// Ginエンジンの初期化
 	if os.Getenv("GO_ENV") == "production" {
 		gin.SetMode(gin.ReleaseMode)
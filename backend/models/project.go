@@ -7,14 +7,16 @@ import (
 )
 
 type Project struct {
-	ID          uint           `json:"id" gorm:"primaryKey"`
-	Name        string         `json:"name" gorm:"not null"`
-	Description string         `json:"description"`
-	UserID      uint           `json:"user_id" gorm:"not null"`
-	Status      string         `json:"status" gorm:"default:pending"` // pending, analyzing, completed, failed
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	Name           string         `json:"name" gorm:"not null"`
+	Description    string         `json:"description"`
+	UserID         uint           `json:"user_id" gorm:"not null"`
+	Status         string         `json:"status" gorm:"default:pending"` // pending, analyzing, completed, failed
+	Team           string         `json:"team" gorm:"index"`             // プロンプトのテンプレートを共有するチーム（空ならチームの設定は使わない）
+	OutputLanguage string         `json:"output_language"`               // 解析結果・ドキュメントの言語（ja, en。空なら所有者の設定に従う）
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// リレーション
 	User     User       `json:"user" gorm:"foreignKey:UserID"`
@@ -23,47 +25,211 @@ type Project struct {
 }
 
 type File struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	ProjectID uint           `json:"project_id" gorm:"not null"`
-	Name      string         `json:"name" gorm:"not null"`
-	Path      string         `json:"path" gorm:"not null"`
-	Size      int64          `json:"size"`
-	MimeType  string         `json:"mime_type"`
-	Content   string         `json:"content,omitempty" gorm:"type:text"`
-	Language  string         `json:"language"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	ProjectID      uint           `json:"project_id" gorm:"not null"`
+	Name           string         `json:"name" gorm:"not null"`
+	Path           string         `json:"path" gorm:"not null"`
+	Size           int64          `json:"size"`
+	MimeType       string         `json:"mime_type"`
+	Content        string         `json:"content,omitempty" gorm:"type:text"`
+	Language       string         `json:"language"`
+	ParentID       *uint          `json:"parent_id,omitempty" gorm:"index"` // 派生元ファイル（バンドル分割などで生成された場合）
+	Origin         string         `json:"origin,omitempty"`                 // 空: アップロード, js_deobfuscate: 難読化解除で生成, pyc_decompile: バイトコード逆コンパイルで生成, protobuf_recovery: 記述子から復元した .proto, firmware_carve: ファームウェアから取り出したファイル
+	Offset         *int64         `json:"offset,omitempty"`                 // 派生元ファイル内の位置（firmware_carve で取り出した場合）
+	MD5            string         `json:"md5,omitempty" gorm:"index"`
+	SHA1           string         `json:"sha1,omitempty" gorm:"index"`
+	SHA256         string         `json:"sha256,omitempty" gorm:"index"`
+	Ssdeep         string         `json:"ssdeep,omitempty"`                      // ファジーハッシュ（類似ファイル検索用）
+	BlockSize      int64          `json:"-" gorm:"not null;default:0;index"`     // ssdeep のブロックサイズ（比較できる候補を索引で絞り込む）
+	SymbolsIndexed bool           `json:"-" gorm:"not null;default:false;index"` // シンボルを抽出済みか（シンボルが1つも無いファイルを解析し直さないための印）
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// リレーション
 	Project Project `json:"project" gorm:"foreignKey:ProjectID"`
 }
 
 type Analysis struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	ProjectID uint           `json:"project_id" gorm:"not null"`
-	FileID    *uint          `json:"file_id,omitempty"`
-	Type      string         `json:"type" gorm:"not null"`          // code_analysis, dependency_map, documentation, pattern_detection
-	Status    string         `json:"status" gorm:"default:pending"` // pending, processing, completed, failed
-	Result    string         `json:"result,omitempty" gorm:"type:text"`
-	Metadata  string         `json:"metadata,omitempty" gorm:"type:json"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	ProjectID      uint           `json:"project_id" gorm:"not null"`
+	FileID         *uint          `json:"file_id,omitempty"`
+	Type           string         `json:"type" gorm:"not null"`          // code_analysis, dependency_map, documentation, pattern_detection, js_deobfuscate, pyc_decompile, protobuf_recovery, binary_diff, rule_scan, firmware_carve, call_graph, schema_recovery, api_discovery, traffic_analysis, metrics, secret_scan, sbom, vulnerability_scan, license_scan, clone_detection, investigation, translation
+	Status         string         `json:"status" gorm:"default:pending"` // pending, processing, completed, failed
+	Result         string         `json:"result,omitempty" gorm:"type:text"`
+	Metadata       string         `json:"metadata,omitempty" gorm:"type:json"`
+	Prompts        string         `json:"prompts,omitempty" gorm:"type:text"` // 使ったプロンプトのテンプレートの版（テンプレート名から版の識別子への JSON）
+	OutputLanguage string         `json:"output_language,omitempty"`          // 結果の言語（ja, en）
+	SourceID       *uint          `json:"source_id,omitempty" gorm:"index"`   // translation の場合の翻訳元の解析
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// リレーション
 	Project Project `json:"project" gorm:"foreignKey:ProjectID"`
 	File    *File   `json:"file,omitempty" gorm:"foreignKey:FileID"`
 }
 
-type User struct {
+// RuleSet YARA 互換構文で書かれたシグネチャルールの集まり（rule_scan 解析で使用）
+type RuleSet struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	Name        string         `json:"name" gorm:"not null"`
+	Description string         `json:"description"`
+	Source      string         `json:"source" gorm:"type:text;not null"`
+	Enabled     bool           `json:"enabled"`
+	UserID      uint           `json:"user_id" gorm:"not null"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Symbol ソースファイルから抽出した定義（関数・型・メソッド・定数など）のインデックス
+// ファイルのアップロード・削除に合わせて更新する
+type Symbol struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ProjectID uint      `json:"project_id" gorm:"not null;index"`
+	FileID    uint      `json:"file_id" gorm:"not null;index"`
+	Name      string    `json:"name" gorm:"not null;index"`
+	Kind      string    `json:"kind"`                // function, method, class, struct, interface, enum, type, constant, variable, property, module, macro など
+	Container string    `json:"container,omitempty"` // メソッドのレシーバー型・所属クラス
+	Language  string    `json:"language"`
+	Line      int       `json:"line"`
+	Column    int       `json:"column"`
+	Signature string    `json:"signature,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CodeChunk 意味検索のためにファイルを行単位で分けたコード片と埋め込みベクトル
+// Embedding は pgvector の入力形式（[0.1,0.2,...]）で持ち、pgvector が使える場合は embedding_vector 列にも入れる
+type CodeChunk struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	ProjectID  uint      `json:"project_id" gorm:"not null;index"`
+	FileID     uint      `json:"file_id" gorm:"not null;index"`
+	StartLine  int       `json:"start_line"`
+	EndLine    int       `json:"end_line"`
+	Content    string    `json:"content" gorm:"type:text"`
+	Model      string    `json:"model" gorm:"index"` // 埋め込みを計算したモデル（変わったら計算し直す）
+	Dimensions int       `json:"dimensions"`
+	Embedding  string    `json:"-" gorm:"type:text"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Conversation プロジェクトのコードについての質問と回答のやり取り
+type Conversation struct {
 	ID        uint           `json:"id" gorm:"primaryKey"`
-	Email     string         `json:"email" gorm:"uniqueIndex;not null"`
-	Name      string         `json:"name" gorm:"not null"`
+	ProjectID uint           `json:"project_id" gorm:"not null;index"`
+	Title     string         `json:"title"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
+	// リレーション
+	Messages []Message `json:"messages,omitempty" gorm:"foreignKey:ConversationID"`
+}
+
+// Message 会話の1つの発言
+// assistant の回答が根拠にしたファイルの行の範囲と解析結果は Citations に JSON で持つ
+type Message struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	ConversationID uint      `json:"conversation_id" gorm:"not null;index"`
+	Role           string    `json:"role" gorm:"not null"` // user, assistant
+	Content        string    `json:"content" gorm:"type:text"`
+	Citations      string    `json:"-" gorm:"type:json"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// PromptTemplate AI に渡すプロンプトの text/template による上書き
+// 本文を変えるたびに同じ対象（Scope・Team・ProjectID）の中で Version を増やして新しい版を作り、Active の版を使う
+// 解析に記録した版を後から確かめられるよう、削除しても行は残す
+type PromptTemplate struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	Name        string         `json:"name" gorm:"not null;index"` // code_analysis, documentation, pattern_detection, dependency_map, pyc_decompile, binary_diff, chat_answer, investigation
+	Scope       string         `json:"scope" gorm:"not null"`      // global, team, project
+	Team        string         `json:"team,omitempty" gorm:"index"`
+	ProjectID   *uint          `json:"project_id,omitempty" gorm:"index"`
+	Language    string         `json:"language,omitempty" gorm:"not null;default:''"` // 出力言語（ja, en。空ならどの言語でも使う）
+	Version     int            `json:"version"`
+	Body        string         `json:"body" gorm:"type:text;not null"`
+	Description string         `json:"description"`
+	Active      bool           `json:"active"`
+	CreatedAt   time.Time      `json:"created_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// FileMetric metrics 解析で計測したファイルごとのコード指標
+// 関数ごとの指標は Functions に JSON で持つ
+type FileMetric struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	ProjectID     uint      `json:"project_id" gorm:"not null;index"`
+	FileID        uint      `json:"file_id" gorm:"not null;uniqueIndex"`
+	AnalysisID    uint      `json:"analysis_id"`
+	Language      string    `json:"language"`
+	PhysicalLOC   int       `json:"physical_loc"`
+	LogicalLOC    int       `json:"logical_loc"`
+	CommentLOC    int       `json:"comment_loc"`
+	BlankLOC      int       `json:"blank_loc"`
+	FunctionCount int       `json:"function_count"`
+	Cyclomatic    int       `json:"cyclomatic"` // 関数の合計
+	MaxCyclomatic int       `json:"max_cyclomatic"`
+	Cognitive     int       `json:"cognitive"` // 関数の合計
+	MaxCognitive  int       `json:"max_cognitive"`
+	MaxNesting    int       `json:"max_nesting"`
+	FanIn         int       `json:"fan_in"`  // このファイルの関数を呼び出している他のファイルの数
+	FanOut        int       `json:"fan_out"` // このファイルの関数が呼び出している他のファイルの数
+	Hotspot       float64   `json:"hotspot" gorm:"index"`
+	Functions     string    `json:"-" gorm:"type:json"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Vulnerability OSV 形式のデータダンプから取り込んだ脆弱性情報
+type Vulnerability struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	OSVID      string     `json:"osv_id" gorm:"column:osv_id;not null;uniqueIndex"`
+	Aliases    string     `json:"aliases"` // CVE・GHSA などの別名（カンマ区切り）
+	Summary    string     `json:"summary"`
+	Details    string     `json:"details" gorm:"type:text"`
+	Severity   string     `json:"severity"` // critical, high, medium, low（分からなければ空）
+	Score      float64    `json:"score"`    // CVSS v3 の基本値
+	CVSS       string     `json:"cvss,omitempty"`
+	References string     `json:"references" gorm:"type:json"`
+	Published  *time.Time `json:"published,omitempty"`
+	Modified   time.Time  `json:"modified"`
+	ImportID   uint       `json:"import_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// VulnerablePackage 脆弱性が影響するパッケージ（OSV の affected の1件）
+// Ranges・Versions は OSV の ranges・versions をそのまま JSON で持つ
+type VulnerablePackage struct {
+	ID              uint   `json:"id" gorm:"primaryKey"`
+	VulnerabilityID uint   `json:"vulnerability_id" gorm:"not null;index"`
+	Ecosystem       string `json:"ecosystem" gorm:"not null;index:idx_vulnerable_package"`
+	Name            string `json:"name" gorm:"not null;index:idx_vulnerable_package"` // PyPI は正規化した名前、Maven は groupId:artifactId
+	Ranges          string `json:"ranges" gorm:"type:json"`
+	Versions        string `json:"versions" gorm:"type:json"`
+}
+
+// VulnerabilityImport OSV データダンプの取り込み履歴
+type VulnerabilityImport struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	FileName   string    `json:"file_name"`
+	Imported   int       `json:"imported"`
+	Withdrawn  int       `json:"withdrawn"`
+	Skipped    int       `json:"skipped"` // JSON として読めなかったエントリ
+	Ecosystems string    `json:"ecosystems" gorm:"type:json"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type User struct {
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	Email          string         `json:"email" gorm:"uniqueIndex;not null"`
+	Name           string         `json:"name" gorm:"not null"`
+	OutputLanguage string         `json:"output_language"` // 解析結果・ドキュメントの言語（ja, en。空なら AI_OUTPUT_LANGUAGE）
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+
 	// リレーション
 	Projects []Project `json:"projects" gorm:"foreignKey:UserID"`
 }
@@ -13,6 +13,11 @@ func SetupRoutes(r *gin.Engine, db *gorm.DB, redis *redis.Client) {
 	projectController := controllers.NewProjectController(db, redis)
 	fileController := controllers.NewFileController(db)
 	analysisController := controllers.NewAnalysisController(db, redis)
+	ruleController := controllers.NewRuleController(db)
+	vulnerabilityController := controllers.NewVulnerabilityController(db)
+	chatController := controllers.NewChatController(db)
+	promptController := controllers.NewPromptController(db)
+	userController := controllers.NewUserController(db)
 
 	// ヘルスチェック
 	r.GET("/health", func(c *gin.Context) {
@@ -25,6 +30,13 @@ func SetupRoutes(r *gin.Engine, db *gorm.DB, redis *redis.Client) {
 	// API v1 グループ
 	v1 := r.Group("/api/v1")
 	{
+		// ユーザー設定
+		users := v1.Group("/users")
+		{
+			users.GET("/:id", userController.GetUser)
+			users.PUT("/:id", userController.UpdateUser)
+		}
+
 		// プロジェクト管理
 		projects := v1.Group("/projects")
 		{
@@ -33,6 +45,16 @@ func SetupRoutes(r *gin.Engine, db *gorm.DB, redis *redis.Client) {
 			projects.GET("/:id", projectController.GetProject)
 			projects.PUT("/:id", projectController.UpdateProject)
 			projects.DELETE("/:id", projectController.DeleteProject)
+			projects.GET("/:id/protobuf/catalog", projectController.GetProtoCatalog)
+			projects.GET("/:id/openapi", projectController.GetOpenAPI)
+			projects.GET("/:id/sbom", projectController.GetSBOM)
+			projects.GET("/:id/symbols", projectController.GetSymbols)
+			projects.GET("/:id/xrefs", projectController.GetXrefs)
+			projects.GET("/:id/metrics", projectController.GetMetrics)
+			projects.GET("/:id/search", projectController.SearchCode)
+			projects.GET("/:id/grep", projectController.Grep)
+			projects.POST("/:id/chat", chatController.Chat)
+			projects.GET("/:id/conversations", chatController.GetConversations)
 		}
 
 		// ファイル管理
@@ -41,6 +63,8 @@ func SetupRoutes(r *gin.Engine, db *gorm.DB, redis *redis.Client) {
 			files.POST("/upload", fileController.UploadFiles)
 			files.GET("/project/:project_id", fileController.GetFilesByProject)
 			files.GET("/:id", fileController.GetFile)
+			files.GET("/:id/similar", fileController.GetSimilarFiles)
+			files.GET("/:id/metrics", fileController.GetFileMetrics)
 			files.DELETE("/:id", fileController.DeleteFile)
 		}
 
@@ -48,9 +72,49 @@ func SetupRoutes(r *gin.Engine, db *gorm.DB, redis *redis.Client) {
 		analysis := v1.Group("/analysis")
 		{
 			analysis.POST("/start", analysisController.StartAnalysis)
+			analysis.POST("/diff", analysisController.DiffBinaries)
 			analysis.GET("/project/:project_id", analysisController.GetAnalysisByProject)
 			analysis.GET("/:id", analysisController.GetAnalysis)
 			analysis.GET("/:id/status", analysisController.GetAnalysisStatus)
+			analysis.GET("/:id/callgraph", analysisController.GetCallGraph)
+			analysis.GET("/:id/diagram", analysisController.GetDiagram)
+			analysis.POST("/:id/translate", analysisController.TranslateAnalysis)
+		}
+
+		// コードについての会話
+		conversations := v1.Group("/conversations")
+		{
+			conversations.GET("/:id", chatController.GetConversation)
+			conversations.DELETE("/:id", chatController.DeleteConversation)
+		}
+
+		// シグネチャルール（rule_scan 解析で使用）
+		rules := v1.Group("/rules")
+		{
+			rules.GET("/", ruleController.GetRuleSets)
+			rules.POST("/", ruleController.CreateRuleSet)
+			rules.GET("/:id", ruleController.GetRuleSet)
+			rules.PUT("/:id", ruleController.UpdateRuleSet)
+			rules.DELETE("/:id", ruleController.DeleteRuleSet)
+		}
+
+		// AIに渡すプロンプトのテンプレート（プロジェクト・チームごとの上書き）
+		prompts := v1.Group("/prompts")
+		{
+			prompts.GET("/", promptController.GetPrompts)
+			prompts.POST("/", promptController.CreatePrompt)
+			prompts.POST("/preview", promptController.PreviewPrompt)
+			prompts.GET("/:id", promptController.GetPrompt)
+			prompts.POST("/:id/activate", promptController.ActivatePrompt)
+			prompts.DELETE("/:id", promptController.DeletePrompt)
+		}
+
+		// 脆弱性データベース（vulnerability_scan 解析で使用）
+		vulnerabilities := v1.Group("/vulnerabilities")
+		{
+			vulnerabilities.GET("/", vulnerabilityController.GetVulnerabilityDatabase)
+			vulnerabilities.POST("/import", vulnerabilityController.ImportOSV)
+			vulnerabilities.GET("/:id", vulnerabilityController.GetVulnerability)
 		}
 	}
 }
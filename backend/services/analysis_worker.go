@@ -0,0 +1,346 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"reverse-engineering-backend/models"
+	"reverse-engineering-backend/utils"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// AnalysisTask Redisキューに積まれる解析タスク
+type AnalysisTask struct {
+	AnalysisID uint   `json:"analysis_id"`
+	ProjectID  uint   `json:"project_id"`
+	Type       string `json:"type"`
+}
+
+// AnalysisOptions 解析の開始時に指定して Metadata に保存するオプション
+type AnalysisOptions struct {
+	RedactSecrets      *bool           `json:"redact_secrets,omitempty"`      // AIに渡す内容から秘密情報を伏せ字にする（省略時は AI_REDACT_SECRETS に従う）
+	CompareProjects    []uint          `json:"compare_projects,omitempty"`    // clone_detection で重複を探す他のプロジェクト
+	CloneMinTokens     int             `json:"clone_min_tokens,omitempty"`    // clone_detection で報告する最小のトークン数（省略時は 50）
+	Question           string          `json:"question,omitempty"`            // investigation で調べる質問
+	InvestigationSteps int             `json:"investigation_steps,omitempty"` // investigation で AI が応答できる回数の上限（省略時は 12、最大 30）
+	PromptTemplates    map[string]uint `json:"prompt_templates,omitempty"`    // テンプレート名ごとに使う PromptTemplate の ID（A/B 比較用。省略時は有効な版）
+}
+
+// AnalysisWorker Redisキューから解析タスクを取り出して実行する
+type AnalysisWorker struct {
+	db            *gorm.DB
+	redis         *redis.Client
+	aiService     *AIService
+	analysisQueue string
+	promptSets    sync.Map // 実行中の解析 ID ごとの *PromptSet（使ったテンプレートの版を記録する）
+}
+
+func NewAnalysisWorker(db *gorm.DB, redis *redis.Client) *AnalysisWorker {
+	return &AnalysisWorker{
+		db:            db,
+		redis:         redis,
+		aiService:     NewAIService(),
+		analysisQueue: "analysis:queue",
+	}
+}
+
+// Run キューを監視してタスクを順に処理する（ctxがキャンセルされるまで戻らない）
+func (w *AnalysisWorker) Run(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		res, err := w.redis.BRPop(ctx, 5*time.Second, w.analysisQueue).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Println("Failed to pop analysis task:", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		var task AnalysisTask
+		if err := json.Unmarshal([]byte(res[1]), &task); err != nil {
+			log.Println("Invalid analysis task:", err)
+			continue
+		}
+		w.process(ctx, task)
+	}
+}
+
+func (w *AnalysisWorker) process(ctx context.Context, task AnalysisTask) {
+	var analysis models.Analysis
+	if err := w.db.First(&analysis, task.AnalysisID).Error; err != nil {
+		log.Printf("Analysis %d not found: %v", task.AnalysisID, err)
+		return
+	}
+
+	w.db.Model(&analysis).Update("status", "processing")
+
+	// 出力言語を指定せずに作られた解析（diff など）はプロジェクトの設定に従う
+	language := analysis.OutputLanguage
+	if language == "" {
+		language = ResolveOutputLanguage(w.db, analysis.ProjectID, "")
+	}
+	prompts := NewPromptSet(w.db, analysis.ProjectID, language, w.optionsFor(&analysis).PromptTemplates)
+	w.promptSets.Store(analysis.ID, prompts)
+	result, err := w.executeRecovered(ctx, &analysis)
+	w.promptSets.Delete(analysis.ID)
+	updates := map[string]interface{}{
+		"status": "completed",
+		"result": result,
+	}
+	if versions := prompts.Versions(); versions != "" {
+		updates["prompts"] = versions
+	}
+	if err != nil {
+		log.Printf("Analysis %d (%s) failed: %v", analysis.ID, analysis.Type, err)
+		errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+		updates["status"] = "failed"
+		updates["result"] = string(errJSON)
+	}
+	if err := w.db.Model(&analysis).Updates(updates).Error; err != nil {
+		log.Printf("Failed to save analysis %d: %v", analysis.ID, err)
+	}
+
+	w.updateProjectStatus(analysis.ProjectID)
+}
+
+// executeRecovered execute を呼び出し、パーサーなどの panic をその解析の失敗として返す（ワーカーを止めない）
+func (w *AnalysisWorker) executeRecovered(ctx context.Context, analysis *models.Analysis) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Analysis %d (%s) panicked: %v\n%s", analysis.ID, analysis.Type, r, debug.Stack())
+			result = ""
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return w.execute(ctx, analysis)
+}
+
+// execute 解析種別ごとの処理を呼び出す
+func (w *AnalysisWorker) execute(ctx context.Context, analysis *models.Analysis) (string, error) {
+	var files []models.File
+	if err := w.db.Where("project_id = ?", analysis.ProjectID).Find(&files).Error; err != nil {
+		return "", fmt.Errorf("failed to fetch files: %w", err)
+	}
+
+	ai := w.aiFor(analysis)
+	switch analysis.Type {
+	case "code_analysis":
+		return w.runPerFile(files, ai.outputLanguage(), ai.AnalyzeCode)
+	case "documentation":
+		return w.runPerFile(files, ai.outputLanguage(), func(code, language, _ string) (string, error) {
+			return ai.GenerateDocumentation(code, language)
+		})
+	case "pattern_detection":
+		return w.runPerFile(files, ai.outputLanguage(), ai.DetectPatterns)
+	case "dependency_map":
+		result, err := ai.AnalyzeDependencies(DependencyFileInfos(files))
+		if err != nil {
+			return "", err
+		}
+		return mergeBytecodeDependencies(result, recoverPycStructures(files))
+	case "js_deobfuscate":
+		return w.runJSDeobfuscate(files)
+	case "pyc_decompile":
+		return w.runPycDecompile(ai, files)
+	case "protobuf_recovery":
+		return w.runProtobufRecovery(files)
+	case "binary_diff":
+		return w.runBinaryDiff(analysis)
+	case "rule_scan":
+		return w.runRuleScan(files)
+	case "firmware_carve":
+		return w.runFirmwareCarve(files)
+	case "call_graph":
+		return w.runCallGraph(files)
+	case "schema_recovery":
+		return w.runSchemaRecovery(files)
+	case "api_discovery":
+		return w.runAPIDiscovery(analysis, files)
+	case "traffic_analysis":
+		return w.runTrafficAnalysis(analysis, files)
+	case "metrics":
+		return w.runMetrics(analysis, files)
+	case "secret_scan":
+		return w.runSecretScan(files)
+	case "sbom":
+		return w.runSBOM(analysis, files)
+	case "vulnerability_scan":
+		return w.runVulnerabilityScan(files)
+	case "license_scan":
+		return w.runLicenseScan(files)
+	case "clone_detection":
+		return w.runCloneDetection(analysis, files)
+	case "investigation":
+		return w.runInvestigation(ctx, analysis)
+	case "translation":
+		return w.runTranslation(ctx, analysis)
+	}
+
+	return "", fmt.Errorf("unsupported analysis type: %s", analysis.Type)
+}
+
+// aiFor 解析のオプションに合わせて秘密情報の伏せ字化を切り替え、プロジェクトのプロンプトを使う AIService を返す
+func (w *AnalysisWorker) aiFor(analysis *models.Analysis) *AIService {
+	ai := w.aiService
+	if options := w.optionsFor(analysis); options.RedactSecrets != nil {
+		ai = ai.WithSecretRedaction(*options.RedactSecrets)
+	}
+	if prompts, ok := w.promptSets.Load(analysis.ID); ok {
+		ai = ai.WithPrompts(prompts.(*PromptSet))
+	}
+	return ai
+}
+
+// optionsFor 解析の Metadata に保存したオプションを読む（読めなければ既定値）
+func (w *AnalysisWorker) optionsFor(analysis *models.Analysis) AnalysisOptions {
+	var options AnalysisOptions
+	if analysis.Metadata != "" {
+		_ = json.Unmarshal([]byte(analysis.Metadata), &options)
+	}
+	return options
+}
+
+// runPerFile テキストファイルごとにAI解析を実行し、結果をまとめる
+// 計測できる言語のファイルには静的解析で求めたコード指標の要約を、出力言語（lang）で書いて合わせて渡す
+func (w *AnalysisWorker) runPerFile(files []models.File, lang string, analyze func(code, language, metrics string) (string, error)) (string, error) {
+	type fileResult struct {
+		FileID uint   `json:"file_id"`
+		Name   string `json:"name"`
+		Result string `json:"result,omitempty"`
+		Error  string `json:"error,omitempty"`
+	}
+
+	measured, _ := ComputeProjectMetrics(files)
+	metrics := make(map[uint]*FileMetrics, len(measured))
+	for _, m := range measured {
+		metrics[m.FileID] = m
+	}
+
+	var results []fileResult
+	for _, file := range files {
+		if file.Content == "" {
+			continue
+		}
+		res := fileResult{FileID: file.ID, Name: file.Name}
+		out, err := analyze(PrepareCodeForAI(file), file.Language, FormatMetricsForPrompt(metrics[file.ID], lang))
+		if err != nil {
+			res.Error = err.Error()
+		} else {
+			res.Result = out
+		}
+		results = append(results, res)
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"files": results})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// PrepareCodeForAI AIに渡す前にコードを前処理する（ミニファイ・難読化されたJavaScriptは復元してから渡す）
+func PrepareCodeForAI(file models.File) string {
+	if file.Language == "javascript" && IsMinifiedJS(file.Content) {
+		code, _ := DeobfuscateJS(file.Content)
+		return code
+	}
+	return file.Content
+}
+
+// updateProjectStatus 未完了の解析が無くなったらプロジェクトを完了にする
+func (w *AnalysisWorker) updateProjectStatus(projectID uint) {
+	var remaining int64
+	w.db.Model(&models.Analysis{}).
+		Where("project_id = ? AND status IN ?", projectID, []string{"pending", "processing"}).
+		Count(&remaining)
+	if remaining == 0 {
+		w.db.Model(&models.Project{}).Where("id = ?", projectID).Update("status", "completed")
+	}
+}
+
+// createDerivedFile 解析で生成したファイルを保存し、派生元を記録した models.File として登録する
+func (w *AnalysisWorker) createDerivedFile(parent *models.File, origin, name string, data []byte) (*models.File, error) {
+	dir := filepath.Join(utils.ProjectUploadPath(parent.ProjectID), origin, strconv.FormatUint(uint64(parent.ID), 10))
+	savePath := filepath.Join(dir, filepath.FromSlash(name))
+	if rel, err := filepath.Rel(dir, savePath); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("derived file path %q is outside the output directory", name)
+	}
+	if err := os.MkdirAll(filepath.Dir(savePath), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(savePath, data, 0644); err != nil {
+		return nil, err
+	}
+
+	content := ""
+	if utils.IsTextFile(data) {
+		content = string(data)
+	}
+
+	parentID := parent.ID
+	hashes := utils.ComputeFileHashes(data)
+	file := models.File{
+		ProjectID: parent.ProjectID,
+		Name:      name,
+		Path:      savePath,
+		Size:      int64(len(data)),
+		MimeType:  mime.TypeByExtension(path.Ext(name)),
+		Content:   content,
+		Language:  utils.DetectLanguage(name),
+		ParentID:  &parentID,
+		Origin:    origin,
+		MD5:       hashes.MD5,
+		SHA1:      hashes.SHA1,
+		SHA256:    hashes.SHA256,
+		Ssdeep:    hashes.Ssdeep,
+		BlockSize: hashes.BlockSize,
+	}
+	if err := w.db.Create(&file).Error; err != nil {
+		return nil, err
+	}
+	IndexFileSymbols(w.db, &file)
+	ScheduleChunkIndexing()
+	return &file, nil
+}
+
+// removeDerivedFiles 以前の解析で生成したファイルを削除する（再実行時の重複防止）
+// 派生ファイルからさらに生成されたファイルも、生成元の解析を問わず合わせて削除する（origin が空なら全て）
+func (w *AnalysisWorker) removeDerivedFiles(parentID uint, origin string) {
+	query := w.db.Where("parent_id = ?", parentID)
+	if origin != "" {
+		query = query.Where("origin = ?", origin)
+	}
+	var children []models.File
+	if err := query.Find(&children).Error; err != nil {
+		return
+	}
+	for _, child := range children {
+		w.removeDerivedFiles(child.ID, "")
+		RemoveFileSymbols(w.db, child.ID)
+		RemoveFileMetrics(w.db, child.ID)
+		RemoveFileChunks(w.db, child.ID)
+		os.Remove(child.Path)
+		w.db.Delete(&child)
+	}
+}
@@ -0,0 +1,501 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// APISchema OpenAPI 3.1（JSON Schema）のスキーマ
+type APISchema struct {
+	Ref                  string                `json:"$ref,omitempty"`
+	Type                 string                `json:"type,omitempty"`
+	Format               string                `json:"format,omitempty"`
+	Items                *APISchema            `json:"items,omitempty"`
+	Properties           map[string]*APISchema `json:"properties,omitempty"`
+	Required             []string              `json:"required,omitempty"`
+	AdditionalProperties *APISchema            `json:"additionalProperties,omitempty"`
+	Enum                 []string              `json:"enum,omitempty"`
+	OneOf                []*APISchema          `json:"oneOf,omitempty"`
+}
+
+// APIParameter 経路・クエリ・ヘッダーのパラメータ
+type APIParameter struct {
+	Name     string     `json:"name"`
+	In       string     `json:"in"` // path, query, header
+	Required bool       `json:"required"`
+	Schema   *APISchema `json:"schema,omitempty"`
+}
+
+// APIRequestBody リクエストボディ
+type APIRequestBody struct {
+	ContentType string     `json:"content_type"`
+	Schema      *APISchema `json:"schema,omitempty"`
+}
+
+// APIResponse ステータスごとのレスポンス（Status が default のときはコードを特定できなかった）
+type APIResponse struct {
+	Status      string     `json:"status"`
+	ContentType string     `json:"content_type,omitempty"`
+	Schema      *APISchema `json:"schema,omitempty"`
+}
+
+// APIEndpoint ソースから見つけた HTTP のルート
+type APIEndpoint struct {
+	Method      string          `json:"method"` // 小文字。any はメソッドを限定しないルート
+	Path        string          `json:"path"`   // OpenAPI の形式（/users/{id}）
+	RawPath     string          `json:"raw_path"`
+	Framework   string          `json:"framework"` // gin, echo, net/http, express, flask, fastapi, spring, rails
+	Handler     string          `json:"handler,omitempty"`
+	Tag         string          `json:"tag,omitempty"`
+	File        string          `json:"file"`
+	Line        int             `json:"line"`
+	Parameters  []APIParameter  `json:"parameters,omitempty"`
+	RequestBody *APIRequestBody `json:"request_body,omitempty"`
+	Responses   []APIResponse   `json:"responses,omitempty"`
+	Samples     int             `json:"samples,omitempty"` // 通信から推定した場合の観測したリクエスト数
+}
+
+// APIDiscovery api_discovery 解析の結果
+type APIDiscovery struct {
+	Endpoints []*APIEndpoint        `json:"endpoints"`
+	Schemas   map[string]*APISchema `json:"schemas"`
+}
+
+// apiCollector フレームワークごとの抽出結果をまとめる
+type apiCollector struct {
+	endpoints []*APIEndpoint
+	schemas   map[string]*APISchema
+}
+
+func newAPICollector() *apiCollector {
+	return &apiCollector{schemas: make(map[string]*APISchema)}
+}
+
+var apiPathParamRe = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+// add ルートを登録する。パスにあってパラメータにない経路パラメータは文字列として補う
+func (c *apiCollector) add(ep *APIEndpoint) {
+	if ep.Path == "" {
+		ep.Path = "/"
+	}
+	for _, m := range apiPathParamRe.FindAllStringSubmatch(ep.Path, -1) {
+		ep.param(m[1], "path", true, nil)
+	}
+	c.endpoints = append(c.endpoints, ep)
+}
+
+// define 名前付きのスキーマを components に登録し、参照を返す
+func (c *apiCollector) define(name string, schema *APISchema) *APISchema {
+	c.schemas[name] = schema
+	return apiRef(name)
+}
+
+func apiRef(name string) *APISchema {
+	return &APISchema{Ref: "#/components/schemas/" + name}
+}
+
+// apiObject プロパティ名の一覧から型のわからないオブジェクトのスキーマを作る
+func apiObject(names ...string) *APISchema {
+	schema := &APISchema{Type: "object", Properties: make(map[string]*APISchema)}
+	for _, name := range names {
+		schema.Properties[name] = &APISchema{}
+	}
+	return schema
+}
+
+// param パラメータを追加する（同じ名前があれば型のわかる方を残す）
+func (ep *APIEndpoint) param(name, in string, required bool, schema *APISchema) {
+	if name == "" {
+		return
+	}
+	if in == "path" {
+		required = true
+	}
+	for i := range ep.Parameters {
+		p := &ep.Parameters[i]
+		if p.Name == name && p.In == in {
+			if p.Schema == nil || p.Schema.Type == "string" && schema != nil {
+				p.Schema = schema
+			}
+			p.Required = p.Required || required
+			return
+		}
+	}
+	if schema == nil {
+		schema = &APISchema{Type: "string"}
+	}
+	ep.Parameters = append(ep.Parameters, APIParameter{Name: name, In: in, Required: required, Schema: schema})
+}
+
+// body リクエストボディを設定する（同じ形式のボディが既にあればプロパティをまとめる）
+func (ep *APIEndpoint) body(contentType string, schema *APISchema) {
+	if ep.RequestBody == nil {
+		ep.RequestBody = &APIRequestBody{ContentType: contentType, Schema: schema}
+		return
+	}
+	if ep.RequestBody.ContentType != contentType {
+		// ファイルのアップロードがあればフォームより multipart を優先する
+		if contentType == "multipart/form-data" {
+			ep.RequestBody.ContentType = contentType
+		}
+	}
+	ep.RequestBody.Schema = mergeAPISchemas(ep.RequestBody.Schema, schema)
+}
+
+// bodyProperty リクエストボディのオブジェクトにプロパティを足す
+func (ep *APIEndpoint) bodyProperty(contentType, name string, schema *APISchema) {
+	if schema == nil {
+		schema = &APISchema{}
+	}
+	ep.body(contentType, &APISchema{Type: "object", Properties: map[string]*APISchema{name: schema}})
+}
+
+// respond レスポンスを追加する（同じステータスはスキーマをまとめる）
+func (ep *APIEndpoint) respond(status, contentType string, schema *APISchema) {
+	if status == "" {
+		status = "default"
+	}
+	for i := range ep.Responses {
+		r := &ep.Responses[i]
+		if r.Status != status {
+			continue
+		}
+		if r.ContentType == "" {
+			r.ContentType = contentType
+		}
+		r.Schema = mergeAPISchemas(r.Schema, schema)
+		return
+	}
+	ep.Responses = append(ep.Responses, APIResponse{Status: status, ContentType: contentType, Schema: schema})
+}
+
+// mergeAPISchemas 同じ場所に現れた2つのスキーマをまとめる
+// どちらも参照でないオブジェクトならプロパティの和、形が違えば oneOf にする
+func mergeAPISchemas(a, b *APISchema) *APISchema {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case apiSchemaEqual(a, b):
+		return a
+	case a.Ref == "" && b.Ref == "" && a.Type == "object" && b.Type == "object":
+		merged := &APISchema{Type: "object", Properties: make(map[string]*APISchema)}
+		for name, prop := range a.Properties {
+			merged.Properties[name] = prop
+		}
+		for name, prop := range b.Properties {
+			merged.Properties[name] = mergeAPISchemas(merged.Properties[name], prop)
+		}
+		for _, name := range append(append([]string{}, a.Required...), b.Required...) {
+			if !containsString(merged.Required, name) {
+				merged.Required = append(merged.Required, name)
+			}
+		}
+		if len(merged.Properties) == 0 {
+			merged.Properties = nil
+		}
+		return merged
+	case isEmptyAPISchema(a):
+		return b
+	case isEmptyAPISchema(b):
+		return a
+	}
+	merged := &APISchema{}
+	for _, s := range []*APISchema{a, b} {
+		variants := s.OneOf
+		if len(variants) == 0 {
+			variants = []*APISchema{s}
+		}
+		for _, v := range variants {
+			dup := false
+			for _, existing := range merged.OneOf {
+				if apiSchemaEqual(existing, v) {
+					dup = true
+					break
+				}
+			}
+			if !dup {
+				merged.OneOf = append(merged.OneOf, v)
+			}
+		}
+	}
+	return merged
+}
+
+func apiSchemaEqual(a, b *APISchema) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
+
+func isEmptyAPISchema(s *APISchema) bool {
+	return s.Ref == "" && s.Type == "" && len(s.OneOf) == 0 && len(s.Properties) == 0
+}
+
+// joinAPIPath ルートのプレフィックスと相対パスをつなぐ（相対パスの末尾の / は残す）
+func joinAPIPath(prefix, rel string) string {
+	if rel == "" {
+		if prefix == "" {
+			return "/"
+		}
+		return prefix
+	}
+	joined := path.Join("/", prefix, rel)
+	if strings.HasSuffix(rel, "/") && joined != "/" {
+		joined += "/"
+	}
+	return joined
+}
+
+// colonPathParamRe :id・*path 形式の経路パラメータ（Gin・Echo・Express・Rails）
+var colonPathParamRe = regexp.MustCompile(`[:*]([A-Za-z_]\w*)(\([^)]*\))?\??`)
+
+// colonPathToOpenAPI :id 形式のパスを {id} 形式にする
+func colonPathToOpenAPI(p string) string {
+	return colonPathParamRe.ReplaceAllString(p, "{$1}")
+}
+
+var httpStatusAliases = map[string]int{
+	"nonauthoritativeinfo":  http.StatusNonAuthoritativeInfo,
+	"teapot":                http.StatusTeapot,
+	"found":                 http.StatusFound,
+	"moved":                 http.StatusMovedPermanently,
+	"requestentitytoolarge": http.StatusRequestEntityTooLarge,
+	"payloadtoolarge":       http.StatusRequestEntityTooLarge,
+	"unprocessablecontent":  http.StatusUnprocessableEntity,
+	"toomanyrequests":       http.StatusTooManyRequests,
+}
+
+// statusCodeNameRe コードを含む定数名（status.HTTP_201_CREATED など）
+var statusCodeNameRe = regexp.MustCompile(`(?:^|_)([1-5]\d\d)(?:_|$)`)
+
+// httpStatusCode ステータスの名前（http.StatusNotFound・HttpStatus.NOT_FOUND・:not_found・404 など）をコードにする
+func httpStatusCode(name string) (int, bool) {
+	name = strings.TrimSpace(name)
+	if code, err := strconv.Atoi(name); err == nil && code >= 100 && code < 600 {
+		return code, true
+	}
+	name = lastPathElement(strings.ReplaceAll(name, "::", "."))
+	if m := statusCodeNameRe.FindStringSubmatch(name); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		return code, true
+	}
+	key := normalizeStatusName(strings.TrimPrefix(name, "Status"))
+	if code, ok := httpStatusAliases[key]; ok {
+		return code, true
+	}
+	for code := 100; code < 600; code++ {
+		if text := http.StatusText(code); text != "" && normalizeStatusName(text) == key {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+func normalizeStatusName(s string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// statusString ステータスの名前を OpenAPI のレスポンスのキーにする（わからなければ default）
+func statusString(name string) string {
+	if code, ok := httpStatusCode(name); ok {
+		return strconv.Itoa(code)
+	}
+	return "default"
+}
+
+var operationIDRe = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// OpenAPI 抽出したルートから OpenAPI 3.1 のドキュメントを作る
+// 同じメソッド・パスが複数あるときは最初のものを使う
+func (d *APIDiscovery) OpenAPI(title string) map[string]interface{} {
+	paths := make(map[string]map[string]interface{})
+	usedIDs := make(map[string]int)
+	tags := make(map[string]bool)
+	for _, ep := range d.Endpoints {
+		method := ep.Method
+		if method == "any" {
+			method = "get"
+		}
+		item, ok := paths[ep.Path]
+		if !ok {
+			item = make(map[string]interface{})
+			paths[ep.Path] = item
+		}
+		if _, exists := item[method]; exists {
+			continue
+		}
+
+		id := ep.Handler
+		if id == "" {
+			id = ep.Method + ep.Path
+		}
+		id = strings.Trim(operationIDRe.ReplaceAllString(id, "_"), "_")
+		if n := usedIDs[id]; n > 0 {
+			usedIDs[id]++
+			id = fmt.Sprintf("%s_%d", id, n+1)
+		} else {
+			usedIDs[id] = 1
+		}
+
+		source := ep.File
+		if ep.Line > 0 {
+			source = fmt.Sprintf("%s:%d", ep.File, ep.Line)
+		}
+		op := map[string]interface{}{
+			"operationId": id,
+			"x-source":    source,
+			"x-framework": ep.Framework,
+		}
+		if ep.Samples > 0 {
+			op["x-samples"] = ep.Samples
+		}
+		if ep.Handler != "" {
+			op["summary"] = ep.Handler
+		}
+		if ep.Method == "any" {
+			op["x-any-method"] = true
+		}
+		if ep.Tag != "" {
+			op["tags"] = []string{ep.Tag}
+			tags[ep.Tag] = true
+		}
+		if len(ep.Parameters) > 0 {
+			var params []map[string]interface{}
+			for _, p := range ep.Parameters {
+				params = append(params, map[string]interface{}{"name": p.Name, "in": p.In, "required": p.Required, "schema": p.Schema})
+			}
+			op["parameters"] = params
+		}
+		if ep.RequestBody != nil {
+			schema := ep.RequestBody.Schema
+			if schema == nil {
+				schema = &APISchema{}
+			}
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{ep.RequestBody.ContentType: map[string]interface{}{"schema": schema}},
+			}
+		}
+		responses := make(map[string]interface{})
+		for _, r := range ep.Responses {
+			description := "Response"
+			if code, err := strconv.Atoi(r.Status); err == nil && http.StatusText(code) != "" {
+				description = http.StatusText(code)
+			}
+			resp := map[string]interface{}{"description": description}
+			if r.ContentType != "" {
+				schema := r.Schema
+				if schema == nil {
+					schema = &APISchema{}
+				}
+				resp["content"] = map[string]interface{}{r.ContentType: map[string]interface{}{"schema": schema}}
+			}
+			responses[r.Status] = resp
+		}
+		if len(responses) == 0 {
+			responses["default"] = map[string]interface{}{"description": "Response not inferred from source"}
+		}
+		op["responses"] = responses
+		item[method] = op
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":       title,
+			"version":     "recovered",
+			"description": "Recovered by static analysis of route registrations",
+		},
+		"paths": paths,
+	}
+	if len(d.Schemas) > 0 {
+		doc["components"] = map[string]interface{}{"schemas": d.Schemas}
+	}
+	if len(tags) > 0 {
+		var list []map[string]string
+		for _, tag := range sortedKeys(tags) {
+			list = append(list, map[string]string{"name": tag})
+		}
+		doc["tags"] = list
+	}
+	return doc
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DiscoverAPI プロジェクトのソースからルートの登録を探す
+func DiscoverAPI(files []models.File) *APIDiscovery {
+	c := newAPICollector()
+	discoverGoRoutes(c, files)
+	discoverExpressRoutes(c, files)
+	discoverPythonRoutes(c, files)
+	discoverSpringRoutes(c, files)
+	discoverRailsRoutes(c, files)
+
+	sort.SliceStable(c.endpoints, func(i, j int) bool {
+		a, b := c.endpoints[i], c.endpoints[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Method < b.Method
+	})
+	if c.endpoints == nil {
+		c.endpoints = []*APIEndpoint{}
+	}
+	return &APIDiscovery{Endpoints: c.endpoints, Schemas: c.schemas}
+}
+
+// runAPIDiscovery ルートの登録を静的に抽出し、OpenAPI 3.1 のドキュメントを作る
+func (w *AnalysisWorker) runAPIDiscovery(analysis *models.Analysis, files []models.File) (string, error) {
+	discovery := DiscoverAPI(files)
+	if len(discovery.Endpoints) == 0 {
+		return "", fmt.Errorf("no HTTP route registrations found in project")
+	}
+
+	title := fmt.Sprintf("Project %d", analysis.ProjectID)
+	var project models.Project
+	if err := w.db.First(&project, analysis.ProjectID).Error; err == nil && project.Name != "" {
+		title = project.Name
+	}
+
+	frameworks := make(map[string]int)
+	for _, ep := range discovery.Endpoints {
+		frameworks[ep.Framework]++
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"endpoints": discovery.Endpoints,
+		"openapi":   discovery.OpenAPI(title),
+		"summary": map[string]interface{}{
+			"endpoints":  len(discovery.Endpoints),
+			"schemas":    len(discovery.Schemas),
+			"frameworks": frameworks,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
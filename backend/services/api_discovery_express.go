@@ -0,0 +1,734 @@
+package services
+
+import (
+	"path"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// expressRouteMethods Express のルーター（app・express.Router）のルート登録メソッド
+var expressRouteMethods = map[string]bool{
+	"get": true, "post": true, "put": true, "delete": true, "patch": true, "head": true, "options": true, "all": true,
+}
+
+// expressDefaultRouters 宣言が見つからなくてもルーターとして扱う変数名（module.exports = (app) => {...} など）
+var expressDefaultRouters = map[string]bool{"app": true, "router": true, "server": true, "api": true}
+
+// expressRef 他のファイルの変数（name が空ならデフォルトエクスポート）
+type expressRef struct {
+	file string
+	name string
+}
+
+// expressMount app.use('/prefix', router) によるマウント
+type expressMount struct {
+	parent string
+	prefix string
+	child  string
+}
+
+// expressRoute プレフィックスを解決する前のルート
+type expressRoute struct {
+	router  string
+	method  string
+	path    string
+	handler [2]int
+	line    int
+	file    *expressFile
+}
+
+// expressFile Express のルート定義を読むファイル
+type expressFile struct {
+	file     *models.File
+	tokens   []JSToken
+	match    []int
+	routers  map[string]bool
+	imports  map[string]expressRef
+	exported string
+}
+
+// expressParser プロジェクト全体の Express のルーターとマウントの関係
+type expressParser struct {
+	files  map[string]*expressFile
+	order  []*expressFile
+	mounts []expressMount
+	routes []expressRoute
+}
+
+// discoverExpressRoutes Express のルート登録（app.get・router.route・app.use によるマウント）を探す
+func discoverExpressRoutes(c *apiCollector, files []models.File) {
+	p := &expressParser{files: make(map[string]*expressFile)}
+	for i := range files {
+		file := &files[i]
+		if (file.Language != "javascript" && file.Language != "typescript") || file.Content == "" {
+			continue
+		}
+		tokens := stripJSComments(TokenizeJS(file.Content))
+		f := &expressFile{file: file, tokens: tokens, match: matchJSBrackets(tokens), routers: make(map[string]bool), imports: make(map[string]expressRef)}
+		p.files[file.Name] = f
+		p.order = append(p.order, f)
+	}
+	for _, f := range p.order {
+		p.scanDeclarations(f)
+	}
+	for _, f := range p.order {
+		if len(f.routers) > 0 || strings.Contains(f.file.Content, "express") {
+			p.scanRoutes(f)
+		}
+	}
+
+	for _, route := range p.routes {
+		for _, prefix := range p.prefixes(route.router, map[string]bool{}) {
+			raw := joinAPIPath(prefix, route.path)
+			ep := &APIEndpoint{
+				Method:    route.method,
+				Path:      colonPathToOpenAPI(raw),
+				RawPath:   raw,
+				Framework: "express",
+				Tag:       strings.TrimSuffix(path.Base(route.file.file.Name), path.Ext(route.file.file.Name)),
+				File:      route.file.file.Name,
+				Line:      route.line,
+			}
+			if ep.Method == "all" {
+				ep.Method = "any"
+			}
+			p.inspectHandler(ep, route.file, route.handler[0], route.handler[1])
+			c.add(ep)
+		}
+	}
+}
+
+func expressKey(f *expressFile, name string) string {
+	return f.file.Name + "#" + name
+}
+
+// scanDeclarations ルーターの生成・require/import・エクスポートを集める
+func (p *expressParser) scanDeclarations(f *expressFile) {
+	t := f.tokens
+	for i := 0; i < len(t); i++ {
+		switch {
+		case isJSPunct(t[i], "=") && i > 0:
+			name := assignedJSName(t, i)
+			if name == "" {
+				continue
+			}
+			if isExpressRouterExpr(t, i+1) {
+				f.routers[name] = true
+			} else if mod, ok := requiredModule(t, i+1); ok {
+				f.imports[name] = expressRef{file: p.resolveModule(f, mod)}
+			}
+			if i >= 3 && isJSKeyword(t[i-3], "module") && isJSPunct(t[i-2], ".") && isJSKeyword(t[i-1], "exports") && i+1 < len(t) && t[i+1].Kind == JSTokenIdent {
+				f.exported = t[i+1].Text
+			}
+		case isJSKeyword(t[i], "export") && i+2 < len(t) && isJSKeyword(t[i+1], "default") && t[i+2].Kind == JSTokenIdent:
+			f.exported = t[i+2].Text
+		case isJSKeyword(t[i], "import"):
+			p.scanImport(f, i)
+		}
+	}
+}
+
+// assignedJSName 代入・宣言の左辺の変数名（const router: Router = ... の型注釈は飛ばす）
+func assignedJSName(t []JSToken, eq int) string {
+	k := eq - 1
+	if k >= 2 && isJSPunct(t[k-1], ":") && t[k].Kind == JSTokenIdent {
+		k -= 2
+	}
+	if k >= 0 && t[k].Kind == JSTokenIdent {
+		return t[k].Text
+	}
+	return ""
+}
+
+// isExpressRouterExpr express()・express.Router()・Router()・new Router() のいずれか
+func isExpressRouterExpr(t []JSToken, i int) bool {
+	if i < len(t) && isJSKeyword(t[i], "new") {
+		i++
+	}
+	if mod, ok := requiredModule(t, i); ok && mod == "express" {
+		// require('express').Router() / require('express')()
+		for i < len(t) && !isJSPunct(t[i], ")") {
+			i++
+		}
+		i++
+		if i < len(t) && isJSPunct(t[i], "(") {
+			return true
+		}
+		return i+2 < len(t) && isJSPunct(t[i], ".") && t[i+1].Text == "Router"
+	}
+	if i+1 >= len(t) || t[i].Kind != JSTokenIdent {
+		return false
+	}
+	switch {
+	case t[i].Text == "express" && isJSPunct(t[i+1], "("):
+		return true
+	case t[i].Text == "Router" && isJSPunct(t[i+1], "("):
+		return true
+	case i+3 < len(t) && isJSPunct(t[i+1], ".") && t[i+2].Text == "Router" && isJSPunct(t[i+3], "("):
+		return true
+	}
+	return false
+}
+
+// requiredModule require('x') ならそのモジュール名
+func requiredModule(t []JSToken, i int) (string, bool) {
+	if i+3 < len(t) && isJSKeyword(t[i], "require") && isJSPunct(t[i+1], "(") && t[i+2].Kind == JSTokenString && isJSPunct(t[i+3], ")") {
+		return UnquoteJSString(t[i+2].Text)
+	}
+	return "", false
+}
+
+// scanImport import x from '...'・import { a as b } from '...'
+func (p *expressParser) scanImport(f *expressFile, i int) {
+	t := f.tokens
+	end := i + 1
+	for end < len(t) && !isJSKeyword(t[end], "from") && !isJSPunct(t[end], ";") {
+		end++
+	}
+	if end+1 >= len(t) || !isJSKeyword(t[end], "from") || t[end+1].Kind != JSTokenString {
+		return
+	}
+	mod, _ := UnquoteJSString(t[end+1].Text)
+	if mod == "express" {
+		return
+	}
+	file := p.resolveModule(f, mod)
+	for k := i + 1; k < end; k++ {
+		switch {
+		case t[k].Kind == JSTokenIdent && k == i+1 && !isJSKeyword(t[k], "type"):
+			f.imports[t[k].Text] = expressRef{file: file}
+		case isJSPunct(t[k], "{"):
+			close := f.match[k]
+			for j := k + 1; j < close && close > 0; j++ {
+				if t[j].Kind != JSTokenIdent {
+					continue
+				}
+				if j+2 < close && isJSKeyword(t[j+1], "as") {
+					f.imports[t[j+2].Text] = expressRef{file: file, name: t[j].Text}
+					j += 2
+				} else {
+					f.imports[t[j].Text] = expressRef{file: file, name: t[j].Text}
+				}
+			}
+			if close > k {
+				k = close
+			}
+		}
+	}
+}
+
+// resolveModule 相対パスの require・import をプロジェクト内のファイル名にする
+func (p *expressParser) resolveModule(f *expressFile, mod string) string {
+	if !strings.HasPrefix(mod, ".") {
+		return ""
+	}
+	base := path.Join(path.Dir(f.file.Name), mod)
+	for _, candidate := range []string{base, base + ".js", base + ".ts", base + ".mjs", base + ".cjs", base + "/index.js", base + "/index.ts"} {
+		if _, ok := p.files[candidate]; ok {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// refKey 変数名を（import しているならエクスポート元の）ルーターのキーにする
+func (p *expressParser) refKey(f *expressFile, name string) string {
+	if f.routers[name] {
+		return expressKey(f, name)
+	}
+	ref, ok := f.imports[name]
+	if !ok || ref.file == "" {
+		return ""
+	}
+	target := p.files[ref.file]
+	if ref.name == "" {
+		if target.exported == "" {
+			return ""
+		}
+		return expressKey(target, target.exported)
+	}
+	return expressKey(target, ref.name)
+}
+
+// scanRoutes app.METHOD(path, ...)・router.route(path).METHOD(...)・app.use(prefix, router) を集める
+func (p *expressParser) scanRoutes(f *expressFile) {
+	t := f.tokens
+	isRouter := func(name string) bool {
+		return f.routers[name] || expressDefaultRouters[name]
+	}
+	for i := 0; i+3 < len(t); i++ {
+		if t[i].Kind != JSTokenIdent || !isJSPunct(t[i+1], ".") || t[i+2].Kind != JSTokenIdent || !isJSPunct(t[i+3], "(") || !isRouter(t[i].Text) {
+			continue
+		}
+		if i > 0 && isJSPunct(t[i-1], ".") {
+			continue
+		}
+		router := expressKey(f, t[i].Text)
+		method := t[i+2].Text
+		open := i + 3
+		close := f.match[open]
+		if close < 0 {
+			continue
+		}
+		args := splitJSArgs(t, f.match, open+1, close)
+		switch {
+		case expressRouteMethods[method]:
+			if len(args) < 2 || t[args[0][0]].Kind != JSTokenString {
+				continue
+			}
+			routePath, ok := UnquoteJSString(t[args[0][0]].Text)
+			if !ok {
+				continue
+			}
+			last := args[len(args)-1]
+			p.routes = append(p.routes, expressRoute{router: router, method: method, path: routePath, handler: last, line: t[i].Line, file: f})
+		case method == "route" && len(args) == 1 && t[args[0][0]].Kind == JSTokenString:
+			routePath, _ := UnquoteJSString(t[args[0][0]].Text)
+			// router.route('/x').get(h).post(h)
+			for k := close + 1; k+2 < len(t) && isJSPunct(t[k], ".") && expressRouteMethods[t[k+1].Text] && isJSPunct(t[k+2], "("); {
+				end := f.match[k+2]
+				if end < 0 {
+					break
+				}
+				chained := splitJSArgs(t, f.match, k+3, end)
+				if len(chained) > 0 {
+					p.routes = append(p.routes, expressRoute{router: router, method: t[k+1].Text, path: routePath, handler: chained[len(chained)-1], line: t[k+1].Line, file: f})
+				}
+				k = end + 1
+			}
+		case method == "use" && len(args) > 0:
+			prefix := ""
+			rest := args
+			if t[args[0][0]].Kind == JSTokenString {
+				prefix, _ = UnquoteJSString(t[args[0][0]].Text)
+				rest = args[1:]
+			}
+			for _, arg := range rest {
+				child := ""
+				if arg[1]-arg[0] == 1 && t[arg[0]].Kind == JSTokenIdent {
+					child = p.refKey(f, t[arg[0]].Text)
+				} else if mod, ok := requiredModule(t, arg[0]); ok {
+					if file := p.resolveModule(f, mod); file != "" && p.files[file].exported != "" {
+						child = expressKey(p.files[file], p.files[file].exported)
+					}
+				}
+				if child != "" {
+					p.mounts = append(p.mounts, expressMount{parent: router, prefix: prefix, child: child})
+				}
+			}
+		}
+	}
+}
+
+// splitJSArgs t[start:end] を括弧の外の , で区切った範囲にする
+func splitJSArgs(t []JSToken, match []int, start, end int) [][2]int {
+	var args [][2]int
+	begin := start
+	for k := start; k < end; k++ {
+		if (isJSPunct(t[k], "(") || isJSPunct(t[k], "[") || isJSPunct(t[k], "{")) && match[k] > k {
+			k = match[k]
+			continue
+		}
+		if isJSPunct(t[k], ",") {
+			if k > begin {
+				args = append(args, [2]int{begin, k})
+			}
+			begin = k + 1
+		}
+	}
+	if end > begin {
+		args = append(args, [2]int{begin, end})
+	}
+	return args
+}
+
+// prefixes ルーターがマウントされているパス（マウントされていなければ空）
+func (p *expressParser) prefixes(key string, seen map[string]bool) []string {
+	if seen[key] {
+		return nil
+	}
+	seen[key] = true
+	defer delete(seen, key)
+	var out []string
+	for _, m := range p.mounts {
+		if m.child != key {
+			continue
+		}
+		for _, parent := range p.prefixes(m.parent, seen) {
+			out = append(out, joinAPIPath(parent, m.prefix))
+		}
+	}
+	if len(out) == 0 {
+		out = []string{""}
+	}
+	return out
+}
+
+// handlerRange ハンドラーの引数（関数式・関数名・asyncHandler(fn) など）から、関数の引数名と本体の範囲を求める
+func (p *expressParser) handlerRange(f *expressFile, start, end int, depth int) (*expressFile, []string, int, int, string, bool) {
+	t := f.tokens
+	if start >= end || depth > 3 {
+		return nil, nil, 0, 0, "", false
+	}
+	if params, bodyStart, bodyEnd, ok := jsFunctionAt(t, f.match, start, end); ok {
+		return f, params, bodyStart, bodyEnd, "", true
+	}
+	// asyncHandler(fn)・catchAsync(async (req, res) => {...}) のようなラッパー
+	if t[start].Kind == JSTokenIdent && start+1 < end && isJSPunct(t[start+1], "(") && f.match[start+1] == end-1 {
+		args := splitJSArgs(t, f.match, start+2, end-1)
+		if len(args) > 0 {
+			last := args[len(args)-1]
+			return p.handlerRange(f, last[0], last[1], depth+1)
+		}
+	}
+	// 関数名・controller.method
+	var parts []string
+	for k := start; k < end; k++ {
+		if t[k].Kind == JSTokenIdent {
+			parts = append(parts, t[k].Text)
+		} else if !isJSPunct(t[k], ".") {
+			return nil, nil, 0, 0, "", false
+		}
+	}
+	if len(parts) == 0 {
+		return nil, nil, 0, 0, "", false
+	}
+	name := parts[len(parts)-1]
+	handler := strings.Join(parts, ".")
+	// 同じファイル、import 元のファイル、プロジェクト全体の順に定義を探す
+	candidates := []*expressFile{f}
+	if ref, ok := f.imports[parts[0]]; ok && ref.file != "" {
+		candidates = append(candidates, p.files[ref.file])
+	}
+	candidates = append(candidates, p.order...)
+	for _, cf := range candidates {
+		if params, bodyStart, bodyEnd, ok := findJSFunction(cf, name); ok {
+			return cf, params, bodyStart, bodyEnd, handler, true
+		}
+	}
+	return nil, nil, 0, 0, handler, false
+}
+
+// jsFunctionAt t[start:end] が関数式（function・アロー関数）なら引数名と本体の範囲
+// 本体が式のアロー関数は式の範囲を返す
+func jsFunctionAt(t []JSToken, match []int, start, end int) ([]string, int, int, bool) {
+	i := start
+	if isJSKeyword(t[i], "async") {
+		i++
+	}
+	if i >= end {
+		return nil, 0, 0, false
+	}
+	paramsStart := -1
+	switch {
+	case isJSKeyword(t[i], "function"):
+		paramsStart = i + 1
+		if paramsStart < end && t[paramsStart].Kind == JSTokenIdent {
+			paramsStart++
+		}
+	case isJSPunct(t[i], "("):
+		paramsStart = i
+	case t[i].Kind == JSTokenIdent && i+1 < end && isJSPunct(t[i+1], "=>"):
+		return jsFunctionBody(t, match, []string{t[i].Text}, i+2, end)
+	default:
+		return nil, 0, 0, false
+	}
+	if paramsStart >= end || !isJSPunct(t[paramsStart], "(") || match[paramsStart] < 0 {
+		return nil, 0, 0, false
+	}
+	paramsEnd := match[paramsStart]
+	var params []string
+	for _, arg := range splitJSArgs(t, match, paramsStart+1, paramsEnd) {
+		if t[arg[0]].Kind == JSTokenIdent {
+			params = append(params, t[arg[0]].Text)
+		} else {
+			params = append(params, "")
+		}
+	}
+	k := paramsEnd + 1
+	// TypeScript の戻り値の型注釈を飛ばす
+	if k < end && isJSPunct(t[k], ":") {
+		for k < end && !isJSPunct(t[k], "=>") && !isJSPunct(t[k], "{") {
+			k++
+		}
+	}
+	if !isJSKeyword(t[i], "function") {
+		if k >= end || !isJSPunct(t[k], "=>") {
+			return nil, 0, 0, false
+		}
+		k++
+	}
+	return jsFunctionBody(t, match, params, k, end)
+}
+
+func jsFunctionBody(t []JSToken, match []int, params []string, k, end int) ([]string, int, int, bool) {
+	if k >= end {
+		return nil, 0, 0, false
+	}
+	if isJSPunct(t[k], "{") && match[k] > k {
+		return params, k + 1, match[k], true
+	}
+	return params, k, end, true
+}
+
+// findJSFunction 名前の関数の定義（function name・name = (...) =>・name(...) {...}・exports.name =）を探す
+func findJSFunction(f *expressFile, name string) ([]string, int, int, bool) {
+	t := f.tokens
+	for i := 0; i < len(t); i++ {
+		if t[i].Kind != JSTokenIdent || t[i].Text != name {
+			continue
+		}
+		switch {
+		case i > 0 && isJSKeyword(t[i-1], "function"):
+			if params, start, end, ok := jsFunctionAt(t, f.match, i-1, len(t)); ok {
+				return params, start, end, true
+			}
+		case i+1 < len(t) && (isJSPunct(t[i+1], "=") || isJSPunct(t[i+1], ":")):
+			if i > 0 && isJSPunct(t[i-1], ".") && !(i > 1 && isJSKeyword(t[i-2], "exports", "module", "this")) {
+				continue
+			}
+			if params, start, end, ok := jsFunctionAt(t, f.match, i+2, len(t)); ok {
+				return params, start, end, true
+			}
+		case i+1 < len(t) && isJSPunct(t[i+1], "(") && f.match[i+1] > 0 && (i == 0 || !isJSPunct(t[i-1], ".")):
+			// クラス・オブジェクトのメソッド定義 name(req, res) { ... }
+			close := f.match[i+1]
+			if close+1 < len(t) && isJSPunct(t[close+1], "{") && f.match[close+1] > 0 {
+				var params []string
+				for _, arg := range splitJSArgs(t, f.match, i+2, close) {
+					params = append(params, t[arg[0]].Text)
+				}
+				return params, close + 2, f.match[close+1], true
+			}
+		}
+	}
+	return nil, 0, 0, false
+}
+
+// inspectHandler ハンドラーの本体で使っている req.body・req.query・res.status().json() などから形を推定する
+func (p *expressParser) inspectHandler(ep *APIEndpoint, f *expressFile, start, end int) {
+	hf, params, bodyStart, bodyEnd, name, ok := p.handlerRange(f, start, end, 0)
+	if name != "" {
+		ep.Handler = name
+	}
+	if !ok {
+		return
+	}
+	req, res := "req", "res"
+	if len(params) > 0 && params[0] != "" {
+		req = params[0]
+	}
+	if len(params) > 1 && params[1] != "" {
+		res = params[1]
+	}
+	t := hf.tokens
+	for i := bodyStart; i < bodyEnd; i++ {
+		if t[i].Kind != JSTokenIdent || (i > 0 && isJSPunct(t[i-1], ".")) {
+			continue
+		}
+		switch t[i].Text {
+		case req:
+			p.inspectRequest(ep, hf, i, bodyEnd)
+		case res:
+			p.inspectResponse(ep, hf, i, bodyEnd)
+		}
+	}
+}
+
+// inspectRequest req.body.x・const { a, b } = req.body・req.query.q・req.get('X') など
+func (p *expressParser) inspectRequest(ep *APIEndpoint, f *expressFile, i, end int) {
+	t := f.tokens
+	if i+2 >= end || !isJSPunct(t[i+1], ".") || t[i+2].Kind != JSTokenIdent {
+		return
+	}
+	field := t[i+2].Text
+	var member string
+	if i+4 < end && isJSPunct(t[i+3], ".") && t[i+4].Kind == JSTokenIdent {
+		member = t[i+4].Text
+	} else if i+4 < end && isJSPunct(t[i+3], "[") && t[i+4].Kind == JSTokenString {
+		member, _ = UnquoteJSString(t[i+4].Text)
+	}
+	destructured := destructuredJSNames(t, f.match, i)
+	names := destructured
+	if member != "" {
+		names = append(names, member)
+	}
+	switch field {
+	case "body":
+		if len(names) == 0 {
+			ep.body("application/json", &APISchema{Type: "object"})
+		}
+		for _, name := range names {
+			ep.bodyProperty("application/json", name, nil)
+		}
+	case "query":
+		for _, name := range names {
+			ep.param(name, "query", false, nil)
+		}
+	case "params":
+		for _, name := range names {
+			ep.param(name, "path", true, nil)
+		}
+	case "headers":
+		for _, name := range names {
+			ep.param(name, "header", false, nil)
+		}
+	case "file", "files":
+		ep.body("multipart/form-data", &APISchema{Type: "object"})
+	case "get", "header":
+		if i+4 < end && isJSPunct(t[i+3], "(") && t[i+4].Kind == JSTokenString {
+			name, _ := UnquoteJSString(t[i+4].Text)
+			ep.param(name, "header", false, nil)
+		}
+	}
+}
+
+// destructuredJSNames const { a, b: c, d = 1 } = t[i...] の a・b・d
+func destructuredJSNames(t []JSToken, match []int, i int) []string {
+	if i < 2 || !isJSPunct(t[i-1], "=") || !isJSPunct(t[i-2], "}") {
+		return nil
+	}
+	close := i - 2
+	open := -1
+	for k := close - 1; k >= 0; k-- {
+		if match[k] == close {
+			open = k
+			break
+		}
+	}
+	if open < 0 {
+		return nil
+	}
+	var names []string
+	for _, arg := range splitJSArgs(t, match, open+1, close) {
+		if t[arg[0]].Kind == JSTokenIdent {
+			names = append(names, t[arg[0]].Text)
+		} else if t[arg[0]].Kind == JSTokenString {
+			if s, ok := UnquoteJSString(t[arg[0]].Text); ok {
+				names = append(names, s)
+			}
+		}
+	}
+	return names
+}
+
+// inspectResponse res.status(201).json({...})・res.sendStatus(204)・res.send(...) などの連鎖を読む
+func (p *expressParser) inspectResponse(ep *APIEndpoint, f *expressFile, i, end int) {
+	t := f.tokens
+	status := ""
+	for k := i + 1; k+2 < end && isJSPunct(t[k], ".") && t[k+1].Kind == JSTokenIdent && isJSPunct(t[k+2], "("); {
+		method := t[k+1].Text
+		close := f.match[k+2]
+		if close < 0 {
+			return
+		}
+		args := splitJSArgs(t, f.match, k+3, close)
+		argStatus := func() string {
+			if len(args) == 0 {
+				return "default"
+			}
+			return jsStatus(t, args[0])
+		}
+		switch method {
+		case "status":
+			status = argStatus()
+		case "sendStatus":
+			ep.respond(argStatus(), "", nil)
+			return
+		case "json", "jsonp":
+			var schema *APISchema
+			if len(args) > 0 {
+				schema = jsValueSchema(t, f.match, args[0][0], args[0][1])
+			}
+			ep.respond(firstNonEmpty(status, "200"), "application/json", schema)
+			return
+		case "send":
+			contentType, schema := "text/html", &APISchema{Type: "string"}
+			if len(args) > 0 && (isJSPunct(t[args[0][0]], "{") || isJSPunct(t[args[0][0]], "[")) {
+				contentType, schema = "application/json", jsValueSchema(t, f.match, args[0][0], args[0][1])
+			}
+			if len(args) == 0 {
+				contentType, schema = "", nil
+			}
+			ep.respond(firstNonEmpty(status, "200"), contentType, schema)
+			return
+		case "end":
+			ep.respond(firstNonEmpty(status, "200"), "", nil)
+			return
+		case "render":
+			ep.respond(firstNonEmpty(status, "200"), "text/html", &APISchema{Type: "string"})
+			return
+		case "redirect":
+			code := "302"
+			if len(args) > 1 {
+				code = argStatus()
+			}
+			ep.respond(code, "", nil)
+			return
+		case "sendFile", "download", "attachment":
+			ep.respond(firstNonEmpty(status, "200"), "application/octet-stream", &APISchema{Type: "string", Format: "binary"})
+			return
+		}
+		k = close + 1
+	}
+}
+
+// jsStatus ステータスの引数（201・StatusCodes.CREATED・httpStatus.NOT_FOUND）
+func jsStatus(t []JSToken, arg [2]int) string {
+	last := t[arg[1]-1]
+	if last.Kind != JSTokenNumber && last.Kind != JSTokenIdent {
+		return "default"
+	}
+	return statusString(last.Text)
+}
+
+// jsValueSchema JavaScript の値の式のスキーマ（オブジェクト・配列のリテラルはキー・要素から組み立てる）
+func jsValueSchema(t []JSToken, match []int, start, end int) *APISchema {
+	if start >= end {
+		return &APISchema{}
+	}
+	first := t[start]
+	if end-start == 1 {
+		switch first.Kind {
+		case JSTokenString, JSTokenTemplate:
+			return &APISchema{Type: "string"}
+		case JSTokenNumber:
+			if strings.ContainsAny(first.Text, ".eE") && !strings.HasPrefix(first.Text, "0x") {
+				return &APISchema{Type: "number"}
+			}
+			return &APISchema{Type: "integer"}
+		case JSTokenIdent:
+			if first.Text == "true" || first.Text == "false" {
+				return &APISchema{Type: "boolean"}
+			}
+		}
+		return &APISchema{}
+	}
+	if isJSPunct(first, "{") && match[start] == end-1 {
+		schema := &APISchema{Type: "object", Properties: make(map[string]*APISchema)}
+		for _, entry := range splitJSArgs(t, match, start+1, end-1) {
+			key := t[entry[0]]
+			name := key.Text
+			if key.Kind == JSTokenString {
+				name, _ = UnquoteJSString(key.Text)
+			} else if key.Kind != JSTokenIdent {
+				continue
+			}
+			if entry[1]-entry[0] == 1 {
+				schema.Properties[name] = &APISchema{}
+			} else if isJSPunct(t[entry[0]+1], ":") {
+				schema.Properties[name] = jsValueSchema(t, match, entry[0]+2, entry[1])
+			}
+		}
+		return schema
+	}
+	if isJSPunct(first, "[") && match[start] == end-1 {
+		items := &APISchema{}
+		if elems := splitJSArgs(t, match, start+1, end-1); len(elems) > 0 {
+			items = jsValueSchema(t, match, elems[0][0], elems[0][1])
+		}
+		return &APISchema{Type: "array", Items: items}
+	}
+	return &APISchema{}
+}
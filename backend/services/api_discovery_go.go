@@ -0,0 +1,1178 @@
+package services
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// goRouterTypes ルーターとして扱う引数・フィールドの型
+var goRouterTypes = map[string]string{
+	"*gin.Engine":      "gin",
+	"*gin.RouterGroup": "gin",
+	"gin.IRouter":      "gin",
+	"gin.IRoutes":      "gin",
+	"*echo.Echo":       "echo",
+	"*echo.Group":      "echo",
+	"*http.ServeMux":   "net/http",
+}
+
+// goRouterConstructors ルーターを作る関数
+var goRouterConstructors = map[string]string{
+	"gin.Default":          "gin",
+	"gin.New":              "gin",
+	"echo.New":             "echo",
+	"http.NewServeMux":     "net/http",
+	"http.DefaultServeMux": "net/http",
+}
+
+// goRouteMethods Gin・Echo のルート登録メソッド
+var goRouteMethods = map[string]string{
+	"GET": "get", "POST": "post", "PUT": "put", "DELETE": "delete", "PATCH": "patch",
+	"HEAD": "head", "OPTIONS": "options", "CONNECT": "connect", "TRACE": "trace", "Any": "any",
+}
+
+// goExternalTypeSchemas 型検査で解決できない外部パッケージの型
+var goExternalTypeSchemas = map[string]APISchema{
+	"time.Time":            {Type: "string", Format: "date-time"},
+	"time.Duration":        {Type: "integer", Format: "int64"},
+	"gorm.DeletedAt":       {Type: "string", Format: "date-time"},
+	"sql.NullTime":         {Type: "string", Format: "date-time"},
+	"sql.NullString":       {Type: "string"},
+	"sql.NullInt64":        {Type: "integer", Format: "int64"},
+	"sql.NullInt32":        {Type: "integer", Format: "int32"},
+	"sql.NullBool":         {Type: "boolean"},
+	"sql.NullFloat64":      {Type: "number", Format: "double"},
+	"uuid.UUID":            {Type: "string", Format: "uuid"},
+	"decimal.Decimal":      {Type: "string", Format: "decimal"},
+	"json.RawMessage":      {},
+	"datatypes.JSON":       {},
+	"multipart.FileHeader": {Type: "string", Format: "binary"},
+	"pq.StringArray":       {Type: "array", Items: &APISchema{Type: "string"}},
+}
+
+// goRouter ルーターの値。関数の引数として受け取ったものは呼び出し元でプレフィックスが決まる
+type goRouter struct {
+	framework string
+	prefix    string
+	fn        *types.Func
+	param     int
+}
+
+// goRouteDecl プレフィックスを解決する前のルートの登録
+type goRouteDecl struct {
+	router  goRouter
+	methods []string
+	path    string
+	handler ast.Expr
+	sp      *goSourcePackage
+	file    *models.File
+	line    int
+}
+
+// goRouterArg ルーターを引数に渡している呼び出し
+type goRouterArg struct {
+	callee *types.Func
+	index  int
+	router goRouter
+}
+
+type goFuncDecl struct {
+	decl *ast.FuncDecl
+	sp   *goSourcePackage
+}
+
+// goHandler ルートのハンドラーの本体
+type goHandler struct {
+	name   string
+	tag    string
+	params []types.Object
+	body   *ast.BlockStmt
+	sp     *goSourcePackage
+}
+
+// goAPIParser Go のソースからルートを集める
+type goAPIParser struct {
+	p          *goProject
+	c          *apiCollector
+	decls      map[*types.Func]goFuncDecl
+	routers    map[types.Object]goRouter
+	routes     []goRouteDecl
+	calls      []goRouterArg
+	fieldTypes map[token.Pos]ast.Expr
+	components map[*types.TypeName]string
+	names      map[string]*types.TypeName
+}
+
+// discoverGoRoutes Gin・Echo・net/http のルート登録を go/types で解決しながら探す
+func discoverGoRoutes(c *apiCollector, files []models.File) {
+	p := loadGoProject(files)
+	if p == nil {
+		return
+	}
+	g := &goAPIParser{
+		p:          p,
+		c:          c,
+		decls:      make(map[*types.Func]goFuncDecl),
+		routers:    make(map[types.Object]goRouter),
+		fieldTypes: make(map[token.Pos]ast.Expr),
+		components: make(map[*types.TypeName]string),
+		names:      make(map[string]*types.TypeName),
+	}
+	for _, sp := range p.packages {
+		for _, f := range sp.files {
+			for _, decl := range f.Decls {
+				if fd, ok := decl.(*ast.FuncDecl); ok {
+					if fn, ok := sp.info.Defs[fd.Name].(*types.Func); ok {
+						g.decls[fn] = goFuncDecl{decl: fd, sp: sp}
+					}
+				}
+			}
+			ast.Inspect(f, func(n ast.Node) bool {
+				if st, ok := n.(*ast.StructType); ok {
+					g.collectFields(sp, st)
+				}
+				return true
+			})
+		}
+	}
+	for _, sp := range p.packages {
+		for i, f := range sp.files {
+			g.scan(sp, sp.sources[i], f)
+		}
+	}
+
+	for _, route := range g.routes {
+		for _, base := range g.resolve(route.router, map[goRouterArg]bool{}) {
+			g.addRoute(route, base)
+		}
+	}
+}
+
+// collectFields 構造体のフィールドの型の式を位置で引けるようにする（外部パッケージの型の判定に使う）
+func (g *goAPIParser) collectFields(sp *goSourcePackage, st *ast.StructType) {
+	for _, field := range st.Fields.List {
+		for _, name := range field.Names {
+			g.fieldTypes[name.Pos()] = field.Type
+		}
+		if len(field.Names) == 0 {
+			typ := field.Type
+			if star, ok := typ.(*ast.StarExpr); ok {
+				typ = star.X
+			}
+			if sel, ok := typ.(*ast.SelectorExpr); ok {
+				typ = sel.Sel
+			}
+			g.fieldTypes[typ.Pos()] = field.Type
+		}
+		if framework, ok := goRouterTypes[types.ExprString(field.Type)]; ok {
+			for _, name := range field.Names {
+				if obj := sp.info.Defs[name]; obj != nil {
+					g.routers[obj] = goRouter{framework: framework}
+				}
+			}
+		}
+	}
+}
+
+// scan ファイル内のルーターの代入・ルートの登録・ルーターを渡す呼び出しを集める
+func (g *goAPIParser) scan(sp *goSourcePackage, file *models.File, f *ast.File) {
+	var fn *types.Func
+	for _, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			ast.Inspect(decl, func(n ast.Node) bool {
+				g.visit(sp, file, n)
+				return true
+			})
+			continue
+		}
+		fn, _ = sp.info.Defs[fd.Name].(*types.Func)
+		index := 0
+		for _, field := range fd.Type.Params.List {
+			framework, isRouter := goRouterTypes[types.ExprString(field.Type)]
+			names := field.Names
+			if len(names) == 0 {
+				index++
+				continue
+			}
+			for _, name := range names {
+				if obj := sp.info.Defs[name]; obj != nil && isRouter && fn != nil {
+					g.routers[obj] = goRouter{framework: framework, fn: fn, param: index}
+				}
+				index++
+			}
+		}
+		if fd.Body != nil {
+			ast.Inspect(fd.Body, func(n ast.Node) bool {
+				g.visit(sp, file, n)
+				return true
+			})
+		}
+	}
+}
+
+func (g *goAPIParser) visit(sp *goSourcePackage, file *models.File, n ast.Node) {
+	switch n := n.(type) {
+	case *ast.AssignStmt:
+		if len(n.Lhs) != len(n.Rhs) {
+			return
+		}
+		for i, lhs := range n.Lhs {
+			if r, ok := g.routerOf(sp, n.Rhs[i]); ok {
+				if obj := g.objectOf(sp, lhs); obj != nil {
+					g.routers[obj] = r
+				}
+			}
+		}
+	case *ast.ValueSpec:
+		for i, name := range n.Names {
+			if i < len(n.Values) {
+				if r, ok := g.routerOf(sp, n.Values[i]); ok {
+					if obj := sp.info.Defs[name]; obj != nil {
+						g.routers[obj] = r
+					}
+				}
+			}
+		}
+	case *ast.CallExpr:
+		g.visitCall(sp, file, n)
+	}
+}
+
+// objectOf 代入先の変数・フィールド
+func (g *goAPIParser) objectOf(sp *goSourcePackage, expr ast.Expr) types.Object {
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.Ident:
+		if obj := sp.info.Defs[e]; obj != nil {
+			return obj
+		}
+		return sp.info.Uses[e]
+	case *ast.SelectorExpr:
+		if sel, ok := sp.info.Selections[e]; ok {
+			return sel.Obj()
+		}
+	}
+	return nil
+}
+
+// routerOf 式がルーター（またはそのグループ）なら返す
+func (g *goAPIParser) routerOf(sp *goSourcePackage, expr ast.Expr) (goRouter, bool) {
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.Ident, *ast.SelectorExpr:
+		if obj := g.objectOf(sp, e); obj != nil {
+			if r, ok := g.routers[obj]; ok {
+				return r, true
+			}
+		}
+		if framework, ok := goRouterConstructors[types.ExprString(e)]; ok {
+			return goRouter{framework: framework}, true
+		}
+	case *ast.StarExpr:
+		return g.routerOf(sp, e.X)
+	case *ast.UnaryExpr:
+		return g.routerOf(sp, e.X)
+	case *ast.CallExpr:
+		sel, ok := ast.Unparen(e.Fun).(*ast.SelectorExpr)
+		if !ok {
+			return goRouter{}, false
+		}
+		if framework, ok := goRouterConstructors[types.ExprString(sel)]; ok {
+			return goRouter{framework: framework}, true
+		}
+		if sel.Sel.Name == "Group" && len(e.Args) > 0 {
+			if parent, ok := g.routerOf(sp, sel.X); ok {
+				prefix, _ := goStringValue(sp, e.Args[0])
+				parent.prefix = joinAPIPath(parent.prefix, prefix)
+				return parent, true
+			}
+		}
+	}
+	return goRouter{}, false
+}
+
+// visitCall ルートの登録か、ルーターを引数に渡す呼び出しなら記録する
+func (g *goAPIParser) visitCall(sp *goSourcePackage, file *models.File, call *ast.CallExpr) {
+	line := g.p.fset.Position(call.Pos()).Line
+	if sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr); ok {
+		name := sel.Sel.Name
+		router, isRouter := g.routerOf(sp, sel.X)
+		if !isRouter && (name == "HandleFunc" || name == "Handle") {
+			if pkg, ok := sp.info.Uses[identOf(sel.X)].(*types.PkgName); ok && pkg.Imported().Path() == "net/http" {
+				router, isRouter = goRouter{framework: "net/http"}, true
+			}
+		}
+		if isRouter {
+			if route, ok := g.routeCall(sp, router, name, call); ok {
+				route.file, route.line = file, line
+				g.routes = append(g.routes, route)
+				return
+			}
+		}
+	}
+	callee := goCallee(sp.info, call.Fun)
+	if callee == nil {
+		return
+	}
+	if _, ok := g.decls[callee]; !ok {
+		return
+	}
+	for i, arg := range call.Args {
+		if r, ok := g.routerOf(sp, arg); ok {
+			g.calls = append(g.calls, goRouterArg{callee: callee, index: i, router: r})
+		}
+	}
+}
+
+// routeCall ルーターのメソッド呼び出しをルートの登録として読む
+func (g *goAPIParser) routeCall(sp *goSourcePackage, router goRouter, name string, call *ast.CallExpr) (goRouteDecl, bool) {
+	route := goRouteDecl{router: router, sp: sp}
+	args := call.Args
+	if router.framework == "net/http" {
+		if (name != "HandleFunc" && name != "Handle") || len(args) < 2 {
+			return route, false
+		}
+		pattern, ok := goStringValue(sp, args[0])
+		if !ok {
+			return route, false
+		}
+		if i := strings.IndexByte(pattern, ' '); i >= 0 {
+			route.methods = []string{strings.ToLower(pattern[:i])}
+			pattern = strings.TrimSpace(pattern[i+1:])
+		}
+		if i := strings.IndexByte(pattern, '/'); i > 0 {
+			pattern = pattern[i:] // ホスト名を外す
+		}
+		route.path, route.handler = pattern, args[1]
+		return route, true
+	}
+
+	switch {
+	case goRouteMethods[name] != "":
+		route.methods = []string{goRouteMethods[name]}
+	case (name == "Handle" || name == "Add") && len(args) > 0:
+		method, ok := goStringValue(sp, args[0])
+		if !ok {
+			method = strings.TrimPrefix(types.ExprString(args[0]), "http.Method")
+		}
+		route.methods = []string{strings.ToLower(method)}
+		args = args[1:]
+	case name == "Match" && len(args) > 0:
+		if lit, ok := ast.Unparen(args[0]).(*ast.CompositeLit); ok {
+			for _, elt := range lit.Elts {
+				method, ok := goStringValue(sp, elt)
+				if !ok {
+					method = strings.TrimPrefix(types.ExprString(elt), "http.Method")
+				}
+				route.methods = append(route.methods, strings.ToLower(method))
+			}
+		}
+		args = args[1:]
+	default:
+		return route, false
+	}
+	if len(args) < 2 {
+		return route, false
+	}
+	path, ok := goStringValue(sp, args[0])
+	if !ok {
+		return route, false
+	}
+	route.path = path
+	// Gin はミドルウェアの後の最後の引数、Echo はパスの次の引数がハンドラー
+	if router.framework == "echo" {
+		route.handler = args[1]
+	} else {
+		route.handler = args[len(args)-1]
+	}
+	return route, true
+}
+
+// resolve 引数として受け取ったルーターを、呼び出し元をたどって絶対的なプレフィックスにする
+func (g *goAPIParser) resolve(r goRouter, seen map[goRouterArg]bool) []goRouter {
+	if r.fn == nil {
+		return []goRouter{r}
+	}
+	key := goRouterArg{callee: r.fn, index: r.param}
+	if seen[key] {
+		return nil
+	}
+	seen[key] = true
+	defer delete(seen, key)
+
+	var out []goRouter
+	for _, call := range g.calls {
+		if call.callee != r.fn || call.index != r.param {
+			continue
+		}
+		for _, base := range g.resolve(call.router, seen) {
+			framework := base.framework
+			if framework == "" {
+				framework = r.framework
+			}
+			out = append(out, goRouter{framework: framework, prefix: joinAPIPath(base.prefix, r.prefix)})
+		}
+	}
+	if len(out) == 0 {
+		out = append(out, goRouter{framework: r.framework, prefix: r.prefix})
+	}
+	return out
+}
+
+// addRoute プレフィックスの決まったルートをハンドラーの中身と合わせて登録する
+func (g *goAPIParser) addRoute(route goRouteDecl, base goRouter) {
+	raw := joinAPIPath(base.prefix, route.path)
+	openPath := raw
+	if base.framework == "net/http" {
+		openPath = strings.ReplaceAll(strings.ReplaceAll(raw, "...}", "}"), "{$}", "")
+	} else {
+		openPath = colonPathToOpenAPI(raw)
+	}
+
+	handler, ok := g.handlerOf(route.sp, route.handler)
+	methods := route.methods
+	if len(methods) == 0 && ok && base.framework == "net/http" {
+		methods = g.checkedMethods(handler)
+	}
+	if len(methods) == 0 {
+		methods = []string{"any"}
+	}
+	for _, method := range methods {
+		ep := &APIEndpoint{
+			Method:    method,
+			Path:      openPath,
+			RawPath:   raw,
+			Framework: base.framework,
+			File:      route.file.Name,
+			Line:      route.line,
+		}
+		if ok {
+			ep.Handler, ep.Tag = handler.name, handler.tag
+			g.inspectHandler(ep, handler, base.framework)
+		}
+		g.c.add(ep)
+	}
+}
+
+// handlerOf ハンドラーの式から関数の本体を探す
+func (g *goAPIParser) handlerOf(sp *goSourcePackage, expr ast.Expr) (goHandler, bool) {
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.FuncLit:
+		return goHandler{params: funcParams(sp, e.Type), body: e.Body, sp: sp}, true
+	case *ast.CallExpr:
+		// http.HandlerFunc(f)・gin.WrapF(f) などの変換
+		if len(e.Args) == 1 {
+			switch lastPathElement(types.ExprString(e.Fun)) {
+			case "HandlerFunc", "WrapF", "WrapH", "WrapHandler", "WrapHandlerFunc":
+				return g.handlerOf(sp, e.Args[0])
+			}
+		}
+		// ハンドラーを返す関数は、返している関数リテラルを使う
+		callee := goCallee(sp.info, e.Fun)
+		decl, ok := g.decls[callee]
+		if !ok || decl.decl.Body == nil {
+			return goHandler{}, false
+		}
+		var lit *ast.FuncLit
+		ast.Inspect(decl.decl.Body, func(n ast.Node) bool {
+			if ret, ok := n.(*ast.ReturnStmt); ok && lit == nil && len(ret.Results) == 1 {
+				lit, _ = ast.Unparen(ret.Results[0]).(*ast.FuncLit)
+			}
+			return lit == nil
+		})
+		if lit == nil {
+			return goHandler{}, false
+		}
+		h := goHandler{params: funcParams(decl.sp, lit.Type), body: lit.Body, sp: decl.sp}
+		h.name, h.tag = goHandlerName(callee)
+		return h, true
+	}
+	callee := goCallee(sp.info, expr)
+	if callee == nil {
+		// ServeHTTP を持つ値（http.Handler）
+		if t := sp.info.TypeOf(expr); t != nil {
+			if obj, _, _ := types.LookupFieldOrMethod(t, true, nil, "ServeHTTP"); obj != nil {
+				callee, _ = obj.(*types.Func)
+			}
+		}
+	}
+	decl, ok := g.decls[callee]
+	if !ok || decl.decl.Body == nil {
+		return goHandler{}, false
+	}
+	h := goHandler{params: funcParams(decl.sp, decl.decl.Type), body: decl.decl.Body, sp: decl.sp}
+	h.name, h.tag = goHandlerName(callee)
+	return h, true
+}
+
+// goHandlerName ハンドラーの表示名（メソッドは 型.メソッド）とタグ（レシーバーの型名かパッケージ名）
+func goHandlerName(fn *types.Func) (string, string) {
+	sig, _ := fn.Type().(*types.Signature)
+	if sig != nil && sig.Recv() != nil {
+		t := sig.Recv().Type()
+		if ptr, ok := t.(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+		if named, ok := t.(*types.Named); ok {
+			return named.Obj().Name() + "." + fn.Name(), named.Obj().Name()
+		}
+	}
+	if fn.Pkg() != nil {
+		return fn.Pkg().Name() + "." + fn.Name(), fn.Pkg().Name()
+	}
+	return fn.Name(), ""
+}
+
+func funcParams(sp *goSourcePackage, ft *ast.FuncType) []types.Object {
+	var params []types.Object
+	for _, field := range ft.Params.List {
+		if len(field.Names) == 0 {
+			params = append(params, nil)
+		}
+		for _, name := range field.Names {
+			params = append(params, sp.info.Defs[name])
+		}
+	}
+	return params
+}
+
+func identOf(expr ast.Expr) *ast.Ident {
+	id, _ := ast.Unparen(expr).(*ast.Ident)
+	if id == nil {
+		return &ast.Ident{}
+	}
+	return id
+}
+
+// goStringValue 文字列リテラル・定数の値
+func goStringValue(sp *goSourcePackage, expr ast.Expr) (string, bool) {
+	if tv, ok := sp.info.Types[expr]; ok && tv.Value != nil && tv.Value.Kind() == constant.String {
+		return constant.StringVal(tv.Value), true
+	}
+	if lit, ok := ast.Unparen(expr).(*ast.BasicLit); ok && lit.Kind == token.STRING {
+		if s, err := strconv.Unquote(lit.Value); err == nil {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// goStatus ステータスの式（http.StatusOK・201・定数）を OpenAPI のキーにする
+func goStatus(sp *goSourcePackage, expr ast.Expr) string {
+	if tv, ok := sp.info.Types[expr]; ok && tv.Value != nil && tv.Value.Kind() == constant.Int {
+		return tv.Value.ExactString()
+	}
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.BasicLit:
+		return statusString(e.Value)
+	case *ast.SelectorExpr:
+		return statusString(e.Sel.Name)
+	}
+	return "default"
+}
+
+// isObject 式が obj の変数そのものか
+func isObject(sp *goSourcePackage, expr ast.Expr, obj types.Object) bool {
+	id, ok := ast.Unparen(expr).(*ast.Ident)
+	return ok && obj != nil && sp.info.Uses[id] == obj
+}
+
+// checkedMethods net/http のハンドラーが r.Method と比べているメソッド
+func (g *goAPIParser) checkedMethods(h goHandler) []string {
+	if len(h.params) < 2 || h.params[1] == nil {
+		return nil
+	}
+	isMethod := func(expr ast.Expr) bool {
+		sel, ok := ast.Unparen(expr).(*ast.SelectorExpr)
+		return ok && sel.Sel.Name == "Method" && isObject(h.sp, sel.X, h.params[1])
+	}
+	methodName := func(expr ast.Expr) string {
+		if s, ok := goStringValue(h.sp, expr); ok {
+			return strings.ToLower(s)
+		}
+		if sel, ok := ast.Unparen(expr).(*ast.SelectorExpr); ok && strings.HasPrefix(sel.Sel.Name, "Method") {
+			return strings.ToLower(strings.TrimPrefix(sel.Sel.Name, "Method"))
+		}
+		return ""
+	}
+	var methods []string
+	add := func(m string) {
+		if m != "" && !containsString(methods, m) {
+			methods = append(methods, m)
+		}
+	}
+	ast.Inspect(h.body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BinaryExpr:
+			if n.Op != token.EQL && n.Op != token.NEQ {
+				return true
+			}
+			if isMethod(n.X) {
+				add(methodName(n.Y))
+			} else if isMethod(n.Y) {
+				add(methodName(n.X))
+			}
+		case *ast.SwitchStmt:
+			if n.Tag == nil || !isMethod(n.Tag) {
+				return true
+			}
+			for _, stmt := range n.Body.List {
+				if cc, ok := stmt.(*ast.CaseClause); ok {
+					for _, expr := range cc.List {
+						add(methodName(expr))
+					}
+				}
+			}
+		}
+		return true
+	})
+	return methods
+}
+
+// inspectHandler ハンドラーの本体からパラメータ・リクエストボディ・レスポンスを推定する
+func (g *goAPIParser) inspectHandler(ep *APIEndpoint, h goHandler, framework string) {
+	if len(h.params) == 0 {
+		return
+	}
+	if framework == "net/http" {
+		g.inspectNetHTTP(ep, h)
+		return
+	}
+	ctx := h.params[0]
+	sp := h.sp
+	ast.Inspect(h.body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		// strconv.Atoi(c.Param("id")) のように数値に変換しているパラメータは整数にする
+		if pkg, ok := sp.info.Uses[identOf(sel.X)].(*types.PkgName); ok && pkg.Imported().Path() == "strconv" && len(call.Args) > 0 {
+			if inner, ok := ast.Unparen(call.Args[0]).(*ast.CallExpr); ok {
+				if isel, ok := ast.Unparen(inner.Fun).(*ast.SelectorExpr); ok && isObject(sp, isel.X, ctx) && len(inner.Args) > 0 {
+					name, _ := goStringValue(sp, inner.Args[0])
+					schema := &APISchema{Type: "integer"}
+					switch isel.Sel.Name {
+					case "Param":
+						ep.param(name, "path", true, schema)
+					case "Query", "QueryParam", "DefaultQuery":
+						ep.param(name, "query", false, schema)
+					}
+				}
+			}
+			return true
+		}
+		if !isObject(sp, sel.X, ctx) {
+			return true
+		}
+		args := call.Args
+		arg := func(i int) ast.Expr {
+			if i < len(args) {
+				return args[i]
+			}
+			return nil
+		}
+		str := func(i int) string {
+			if i < len(args) {
+				s, _ := goStringValue(sp, args[i])
+				return s
+			}
+			return ""
+		}
+		switch sel.Sel.Name {
+		case "Param":
+			ep.param(str(0), "path", true, nil)
+		case "Query", "DefaultQuery", "GetQuery", "QueryParam":
+			ep.param(str(0), "query", false, nil)
+		case "QueryArray", "GetQueryArray":
+			ep.param(str(0), "query", false, &APISchema{Type: "array", Items: &APISchema{Type: "string"}})
+		case "GetHeader":
+			ep.param(str(0), "header", false, nil)
+		case "PostForm", "DefaultPostForm", "GetPostForm", "FormValue":
+			ep.bodyProperty("application/x-www-form-urlencoded", str(0), &APISchema{Type: "string"})
+		case "PostFormArray", "GetPostFormArray":
+			ep.bodyProperty("application/x-www-form-urlencoded", str(0), &APISchema{Type: "array", Items: &APISchema{Type: "string"}})
+		case "FormFile":
+			ep.bodyProperty("multipart/form-data", str(0), &APISchema{Type: "string", Format: "binary"})
+		case "MultipartForm":
+			ep.body("multipart/form-data", &APISchema{Type: "object"})
+		case "ShouldBindJSON", "BindJSON", "ShouldBind", "Bind", "MustBindWith", "ShouldBindWith", "ShouldBindBodyWith":
+			if a := arg(0); a != nil {
+				ep.body("application/json", g.exprSchema(sp, a))
+			}
+		case "ShouldBindQuery", "BindQuery":
+			g.bindParams(ep, sp, arg(0), "query", "form")
+		case "ShouldBindUri", "BindUri":
+			g.bindParams(ep, sp, arg(0), "path", "uri")
+		case "ShouldBindHeader", "BindHeader":
+			g.bindParams(ep, sp, arg(0), "header", "header")
+		case "JSON", "IndentedJSON", "SecureJSON", "PureJSON", "AsciiJSON", "AbortWithStatusJSON", "JSONP", "JSONPretty":
+			if a := arg(1); a != nil {
+				ep.respond(goStatus(sp, arg(0)), "application/json", g.exprSchema(sp, a))
+			}
+		case "JSONBlob":
+			ep.respond(goStatus(sp, arg(0)), "application/json", nil)
+		case "XML", "XMLPretty":
+			if a := arg(1); a != nil {
+				ep.respond(goStatus(sp, arg(0)), "application/xml", g.exprSchema(sp, a))
+			}
+		case "YAML":
+			ep.respond(goStatus(sp, arg(0)), "application/yaml", nil)
+		case "ProtoBuf":
+			ep.respond(goStatus(sp, arg(0)), "application/x-protobuf", nil)
+		case "String":
+			ep.respond(goStatus(sp, arg(0)), "text/plain", &APISchema{Type: "string"})
+		case "HTML":
+			ep.respond(goStatus(sp, arg(0)), "text/html", &APISchema{Type: "string"})
+		case "Data", "Blob", "DataFromReader":
+			contentType := "application/octet-stream"
+			index := 1
+			if sel.Sel.Name == "DataFromReader" {
+				index = 2
+			}
+			if s := str(index); s != "" {
+				contentType = s
+			}
+			ep.respond(goStatus(sp, arg(0)), contentType, &APISchema{Type: "string", Format: "binary"})
+		case "Stream":
+			if framework == "echo" {
+				ep.respond(goStatus(sp, arg(0)), firstNonEmpty(str(1), "application/octet-stream"), &APISchema{Type: "string", Format: "binary"})
+			} else {
+				ep.respond("200", "text/event-stream", &APISchema{Type: "string"})
+			}
+		case "SSEvent":
+			ep.respond("200", "text/event-stream", &APISchema{Type: "string"})
+		case "File", "FileAttachment", "FileFromFS", "Attachment", "Inline":
+			ep.respond("200", "application/octet-stream", &APISchema{Type: "string", Format: "binary"})
+		case "Redirect", "Status", "AbortWithStatus", "AbortWithError", "NoContent":
+			ep.respond(goStatus(sp, arg(0)), "", nil)
+		}
+		return true
+	})
+}
+
+// inspectNetHTTP net/http のハンドラー（w http.ResponseWriter, r *http.Request）を読む
+func (g *goAPIParser) inspectNetHTTP(ep *APIEndpoint, h goHandler) {
+	if len(h.params) < 2 {
+		return
+	}
+	w, r := h.params[0], h.params[1]
+	if w == nil || r == nil {
+		return
+	}
+	sp := h.sp
+	status, contentType := "", ""
+	pending := ""
+	queryVars := make(map[types.Object]bool)
+	write := func(ct string, schema *APISchema) {
+		if contentType != "" {
+			ct = contentType
+		}
+		ep.respond(firstNonEmpty(status, "200"), ct, schema)
+		status, pending = "", ""
+	}
+	isQuery := func(expr ast.Expr) bool {
+		if call, ok := ast.Unparen(expr).(*ast.CallExpr); ok {
+			return types.ExprString(call.Fun) == r.Name()+".URL.Query"
+		}
+		id, ok := ast.Unparen(expr).(*ast.Ident)
+		return ok && queryVars[sp.info.Uses[id]]
+	}
+	ast.Inspect(h.body, func(n ast.Node) bool {
+		if assign, ok := n.(*ast.AssignStmt); ok && len(assign.Lhs) == len(assign.Rhs) {
+			for i, rhs := range assign.Rhs {
+				if isQuery(rhs) {
+					if obj := g.objectOf(sp, assign.Lhs[i]); obj != nil {
+						queryVars[obj] = true
+					}
+				}
+			}
+			return true
+		}
+		// 早期リターンの分岐で決めたステータスを後の書き込みに持ち越さない
+		if _, ok := n.(*ast.ReturnStmt); ok {
+			if pending != "" {
+				ep.respond(pending, "", nil)
+			}
+			status, pending = "", ""
+			return true
+		}
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		str := func(i int) string {
+			if i < len(call.Args) {
+				s, _ := goStringValue(sp, call.Args[i])
+				return s
+			}
+			return ""
+		}
+		name := sel.Sel.Name
+		switch {
+		case isObject(sp, sel.X, r):
+			switch name {
+			case "PathValue":
+				ep.param(str(0), "path", true, nil)
+			case "FormValue", "PostFormValue":
+				ep.bodyProperty("application/x-www-form-urlencoded", str(0), &APISchema{Type: "string"})
+			case "FormFile":
+				ep.bodyProperty("multipart/form-data", str(0), &APISchema{Type: "string", Format: "binary"})
+			case "ParseMultipartForm":
+				ep.body("multipart/form-data", &APISchema{Type: "object"})
+			}
+		case name == "Get" && isQuery(sel.X):
+			ep.param(str(0), "query", false, nil)
+		case name == "Get" && types.ExprString(sel.X) == r.Name()+".Header":
+			ep.param(str(0), "header", false, nil)
+		case name == "Decode" && len(call.Args) == 1:
+			if inner, ok := ast.Unparen(sel.X).(*ast.CallExpr); ok && lastPathElement(types.ExprString(inner.Fun)) == "NewDecoder" {
+				ep.body("application/json", g.exprSchema(sp, call.Args[0]))
+			}
+		case name == "Encode" && len(call.Args) == 1:
+			if inner, ok := ast.Unparen(sel.X).(*ast.CallExpr); ok && lastPathElement(types.ExprString(inner.Fun)) == "NewEncoder" {
+				write("application/json", g.exprSchema(sp, call.Args[0]))
+			}
+		case name == "Unmarshal" && len(call.Args) == 2 && types.ExprString(sel.X) == "json":
+			ep.body("application/json", g.exprSchema(sp, call.Args[1]))
+		case name == "Set" && len(call.Args) == 2 && strings.EqualFold(str(0), "Content-Type"):
+			if inner, ok := ast.Unparen(sel.X).(*ast.CallExpr); ok && isHeaderOf(sp, inner, w) {
+				contentType = str(1)
+			}
+		case isObject(sp, sel.X, w) && name == "WriteHeader" && len(call.Args) == 1:
+			if pending != "" {
+				ep.respond(pending, "", nil)
+			}
+			status = goStatus(sp, call.Args[0])
+			pending = status
+		case isObject(sp, sel.X, w) && name == "Write":
+			write("text/plain", &APISchema{Type: "string"})
+		case types.ExprString(sel.X) == "http":
+			switch name {
+			case "Error":
+				if len(call.Args) == 3 {
+					ep.respond(goStatus(sp, call.Args[2]), "text/plain", &APISchema{Type: "string"})
+				}
+			case "NotFound":
+				ep.respond("404", "text/plain", &APISchema{Type: "string"})
+			case "Redirect":
+				if len(call.Args) == 4 {
+					ep.respond(goStatus(sp, call.Args[3]), "", nil)
+				}
+			case "ServeFile", "ServeContent":
+				ep.respond("200", "application/octet-stream", &APISchema{Type: "string", Format: "binary"})
+			}
+		case (name == "Fprintf" || name == "Fprint" || name == "Fprintln" || name == "WriteString") && len(call.Args) > 0 && isObject(sp, call.Args[0], w):
+			write("text/plain", &APISchema{Type: "string"})
+		}
+		return true
+	})
+	if pending != "" {
+		ep.respond(pending, "", nil)
+	}
+}
+
+func isHeaderOf(sp *goSourcePackage, call *ast.CallExpr, w types.Object) bool {
+	sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == "Header" && isObject(sp, sel.X, w)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// bindParams ShouldBindQuery などで構造体に読み込むパラメータを、タグ（form・uri・header）の名前で追加する
+func (g *goAPIParser) bindParams(ep *APIEndpoint, sp *goSourcePackage, expr ast.Expr, in, tagKey string) {
+	if expr == nil {
+		return
+	}
+	t := sp.info.TypeOf(expr)
+	if t == nil {
+		return
+	}
+	if ptr, ok := t.Underlying().(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	st, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		if !field.Exported() {
+			continue
+		}
+		tag := reflect.StructTag(st.Tag(i))
+		name := strings.Split(tag.Get(tagKey), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name()
+		}
+		required := strings.Contains(tag.Get("binding"), "required") || strings.Contains(tag.Get("validate"), "required")
+		ep.param(name, in, required, g.fieldSchema(field))
+	}
+}
+
+// exprSchema 式の値を JSON にしたときのスキーマ（gin.H などのマップリテラルはキーから組み立てる）
+func (g *goAPIParser) exprSchema(sp *goSourcePackage, expr ast.Expr) *APISchema {
+	expr = ast.Unparen(expr)
+	if u, ok := expr.(*ast.UnaryExpr); ok && u.Op == token.AND {
+		expr = u.X
+	}
+	if lit, ok := expr.(*ast.CompositeLit); ok {
+		if schema, ok := g.literalSchema(sp, lit); ok {
+			return schema
+		}
+	}
+	if t := sp.info.TypeOf(expr); t != nil && !isInvalidType(t) {
+		return g.typeSchema(t)
+	}
+	if lit, ok := expr.(*ast.BasicLit); ok {
+		switch lit.Kind {
+		case token.STRING, token.CHAR:
+			return &APISchema{Type: "string"}
+		case token.INT:
+			return &APISchema{Type: "integer"}
+		case token.FLOAT:
+			return &APISchema{Type: "number"}
+		}
+	}
+	return &APISchema{}
+}
+
+// literalSchema キーが文字列のマップリテラル・要素がそれであるスライスのリテラル
+func (g *goAPIParser) literalSchema(sp *goSourcePackage, lit *ast.CompositeLit) (*APISchema, bool) {
+	t := sp.info.TypeOf(lit)
+	typeName := ""
+	if lit.Type != nil {
+		typeName = types.ExprString(lit.Type)
+	}
+	isMap := typeName == "gin.H" || typeName == "echo.Map" || strings.HasPrefix(typeName, "map[string]")
+	if t != nil && !isInvalidType(t) {
+		if m, ok := t.Underlying().(*types.Map); ok {
+			if basic, ok := m.Key().Underlying().(*types.Basic); ok && basic.Info()&types.IsString != 0 {
+				isMap = true
+			}
+		}
+	}
+	if isMap {
+		schema := &APISchema{Type: "object", Properties: make(map[string]*APISchema)}
+		for _, elt := range lit.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			if key, ok := goStringValue(sp, kv.Key); ok {
+				schema.Properties[key] = g.exprSchema(sp, kv.Value)
+			}
+		}
+		return schema, true
+	}
+	if arr, ok := lit.Type.(*ast.ArrayType); ok && !hasValidElem(t) {
+		items := &APISchema{}
+		if len(lit.Elts) > 0 {
+			if inner, ok := ast.Unparen(lit.Elts[0]).(*ast.CompositeLit); ok {
+				if inner.Type == nil {
+					inner = &ast.CompositeLit{Type: arr.Elt, Elts: inner.Elts}
+				}
+				if s, ok := g.literalSchema(sp, inner); ok {
+					items = s
+				}
+			}
+		} else if types.ExprString(arr.Elt) == "gin.H" || types.ExprString(arr.Elt) == "echo.Map" {
+			items = &APISchema{Type: "object"}
+		}
+		return &APISchema{Type: "array", Items: items}, true
+	}
+	return nil, false
+}
+
+// hasValidElem スライスの要素の型が解決できているか
+func hasValidElem(t types.Type) bool {
+	if t == nil || isInvalidType(t) {
+		return false
+	}
+	slice, ok := t.Underlying().(*types.Slice)
+	return ok && !isInvalidType(slice.Elem())
+}
+
+func isInvalidType(t types.Type) bool {
+	basic, ok := t.(*types.Basic)
+	return ok && basic.Kind() == types.Invalid
+}
+
+// typeSchema Go の型を JSON にしたときのスキーマ。プロジェクトの構造体は components に登録して参照する
+func (g *goAPIParser) typeSchema(t types.Type) *APISchema {
+	t = types.Unalias(t)
+	switch t := t.(type) {
+	case *types.Basic:
+		info := t.Info()
+		switch {
+		case info&types.IsBoolean != 0:
+			return &APISchema{Type: "boolean"}
+		case info&types.IsInteger != 0:
+			switch t.Kind() {
+			case types.Int64, types.Uint64:
+				return &APISchema{Type: "integer", Format: "int64"}
+			case types.Int32, types.Uint32:
+				return &APISchema{Type: "integer", Format: "int32"}
+			}
+			return &APISchema{Type: "integer"}
+		case info&types.IsFloat != 0:
+			if t.Kind() == types.Float32 {
+				return &APISchema{Type: "number", Format: "float"}
+			}
+			return &APISchema{Type: "number", Format: "double"}
+		case info&types.IsString != 0:
+			return &APISchema{Type: "string"}
+		}
+		return &APISchema{}
+	case *types.Pointer:
+		return g.typeSchema(t.Elem())
+	case *types.Slice:
+		if basic, ok := t.Elem().(*types.Basic); ok && basic.Kind() == types.Byte {
+			return &APISchema{Type: "string", Format: "byte"}
+		}
+		return &APISchema{Type: "array", Items: g.typeSchema(t.Elem())}
+	case *types.Array:
+		return &APISchema{Type: "array", Items: g.typeSchema(t.Elem())}
+	case *types.Map:
+		return &APISchema{Type: "object", AdditionalProperties: g.typeSchema(t.Elem())}
+	case *types.Struct:
+		return g.structSchema(t)
+	case *types.Named:
+		tn := t.Obj()
+		if tn.Pkg() == nil {
+			if tn.Name() == "error" {
+				return &APISchema{Type: "string"}
+			}
+			return &APISchema{}
+		}
+		st, ok := t.Underlying().(*types.Struct)
+		if !ok {
+			return g.typeSchema(t.Underlying())
+		}
+		if t.TypeArgs().Len() > 0 {
+			return g.structSchema(st)
+		}
+		if name, ok := g.components[tn]; ok {
+			return apiRef(name)
+		}
+		name := tn.Name()
+		if other, taken := g.names[name]; taken && other != tn {
+			name = tn.Pkg().Name() + "." + name
+		}
+		g.components[tn] = name
+		g.names[name] = tn
+		g.c.schemas[name] = &APISchema{Type: "object"}
+		return g.c.define(name, g.structSchema(st))
+	}
+	return &APISchema{}
+}
+
+// structSchema 構造体のフィールドを json タグの名前でプロパティにする（埋め込みは展開する）
+func (g *goAPIParser) structSchema(st *types.Struct) *APISchema {
+	schema := &APISchema{Type: "object", Properties: make(map[string]*APISchema)}
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		tag := reflect.StructTag(st.Tag(i))
+		parts := strings.Split(tag.Get("json"), ",")
+		name := parts[0]
+		if name == "-" && len(parts) == 1 {
+			continue
+		}
+		if field.Embedded() && name == "" {
+			g.embed(schema, field)
+			continue
+		}
+		if !field.Exported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name()
+		}
+		prop := g.fieldSchema(field)
+		if containsString(parts[1:], "string") {
+			prop = &APISchema{Type: "string"}
+		}
+		schema.Properties[name] = prop
+		if strings.Contains(tag.Get("binding"), "required") || strings.Contains(tag.Get("validate"), "required") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	if len(schema.Properties) == 0 {
+		schema.Properties = nil
+	}
+	return schema
+}
+
+// embed 埋め込みフィールドのプロパティを外側の構造体に足す
+func (g *goAPIParser) embed(schema *APISchema, field *types.Var) {
+	t := field.Type()
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	if st, ok := t.Underlying().(*types.Struct); ok {
+		inner := g.structSchema(st)
+		for name, prop := range inner.Properties {
+			if _, exists := schema.Properties[name]; !exists {
+				schema.Properties[name] = prop
+			}
+		}
+		schema.Required = append(schema.Required, inner.Required...)
+		return
+	}
+	if expr, ok := g.fieldTypes[field.Pos()]; ok && strings.TrimPrefix(types.ExprString(expr), "*") == "gorm.Model" {
+		schema.Properties["ID"] = &APISchema{Type: "integer"}
+		for _, name := range []string{"CreatedAt", "UpdatedAt", "DeletedAt"} {
+			schema.Properties[name] = &APISchema{Type: "string", Format: "date-time"}
+		}
+	}
+}
+
+// fieldSchema フィールドの型のスキーマ（外部パッケージの型はソース上の型名で判断する）
+func (g *goAPIParser) fieldSchema(field *types.Var) *APISchema {
+	if expr, ok := g.fieldTypes[field.Pos()]; ok {
+		if schema, ok := goExternalSchema(expr); ok {
+			return schema
+		}
+	}
+	return g.typeSchema(field.Type())
+}
+
+func goExternalSchema(expr ast.Expr) (*APISchema, bool) {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return goExternalSchema(e.X)
+	case *ast.ArrayType:
+		if items, ok := goExternalSchema(e.Elt); ok {
+			return &APISchema{Type: "array", Items: items}, true
+		}
+	case *ast.SelectorExpr:
+		if schema, ok := goExternalTypeSchemas[types.ExprString(e)]; ok {
+			copied := schema
+			return &copied, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,1077 @@
+package services
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+var (
+	pyRouterDeclRe  = regexp.MustCompile(`(?m)^[ \t]*(\w+)\s*(?::\s*[\w.]+\s*)?=\s*(?:\w+\.)?(Flask|Blueprint|FastAPI|APIRouter)\s*\(`)
+	pyMountRe       = regexp.MustCompile(`\b(\w+)\.(register_blueprint|include_router)\s*\(`)
+	pyRouteDecoRe   = regexp.MustCompile(`(?m)^[ \t]*@(\w+)\.(route|get|post|put|delete|patch|head|options|api_route)\s*\(`)
+	pyAddURLRuleRe  = regexp.MustCompile(`\b(\w+)\.add_url_rule\s*\(`)
+	pyFromImportRe  = regexp.MustCompile(`(?m)^[ \t]*from\s+([\w.]+)\s+import\s+\(?([^)\n]+)\)?`)
+	pyDefRe         = regexp.MustCompile(`^(?:async\s+)?def\s+(\w+)\s*\(`)
+	pyReturnTypeRe  = regexp.MustCompile(`^\s*(?:->\s*([^:]+?))?\s*:`)
+	pyClassRe       = regexp.MustCompile(`(?m)^([ \t]*)class\s+(\w+)\s*(?:\(([^)]*)\))?\s*:`)
+	pyClassFieldRe  = regexp.MustCompile(`^(\w+)\s*:\s*(.+?)(?:\s*=\s*(.+))?$`)
+	pyEnumMemberRe  = regexp.MustCompile(`^(\w+)\s*=\s*(.+)$`)
+	pyFlaskParamRe  = regexp.MustCompile(`<(?:(\w+)(?:\([^)]*\))?:)?(\w+)>`)
+	pyFastParamRe   = regexp.MustCompile(`\{(\w+)(?::\w+)?\}`)
+	pyRequestDataRe = regexp.MustCompile(`\b(\w+)\s*=\s*request\.(?:get_json\s*\([^)]*\)|json)`)
+	pyRequestUseRe  = regexp.MustCompile(`\brequest\.(args|form|files|headers|json|get_json\s*\([^)]*\)|values)\s*(?:\.(get|getlist)\s*\(\s*|\[\s*)(['"])([^'"]+)['"]`)
+	pyReturnRe      = regexp.MustCompile(`(?m)^[ \t]*return\b`)
+	pyAbortRe       = regexp.MustCompile(`\b(?:abort|flask\.abort)\s*\(\s*(\d{3})`)
+	pyHTTPExcRe     = regexp.MustCompile(`\bHTTPException\s*\(\s*(?:status_code\s*=\s*)?([\w.]+)`)
+)
+
+// pyFlaskConverters Flask のパスのコンバーター
+var pyFlaskConverters = map[string]APISchema{
+	"int":   {Type: "integer"},
+	"float": {Type: "number"},
+	"uuid":  {Type: "string", Format: "uuid"},
+}
+
+// pyScalarTypes Python の型注釈（pydantic を含む）の JSON Schema
+var pyScalarTypes = map[string]APISchema{
+	"str":      {Type: "string"},
+	"int":      {Type: "integer"},
+	"float":    {Type: "number"},
+	"bool":     {Type: "boolean"},
+	"bytes":    {Type: "string", Format: "binary"},
+	"datetime": {Type: "string", Format: "date-time"},
+	"date":     {Type: "string", Format: "date"},
+	"time":     {Type: "string", Format: "time"},
+	"UUID":     {Type: "string", Format: "uuid"},
+	"UUID4":    {Type: "string", Format: "uuid"},
+	"EmailStr": {Type: "string", Format: "email"},
+	"HttpUrl":  {Type: "string", Format: "uri"},
+	"AnyUrl":   {Type: "string", Format: "uri"},
+	"Decimal":  {Type: "number"},
+	"dict":     {Type: "object"},
+	"Dict":     {Type: "object"},
+	"Any":      {},
+	"object":   {},
+}
+
+// pySkippedParamTypes FastAPI のエンドポイント関数でリクエストのパラメータにならない引数の型
+var pySkippedParamTypes = map[string]bool{
+	"Request": true, "Response": true, "BackgroundTasks": true, "WebSocket": true,
+	"Session": true, "AsyncSession": true, "HTTPConnection": true,
+}
+
+// pyRouter Flask・Blueprint・FastAPI・APIRouter のインスタンス
+type pyRouter struct {
+	framework string
+	prefix    string
+	tag       string
+}
+
+// pyMount register_blueprint・include_router によるマウント
+type pyMount struct {
+	parent string
+	child  string
+	prefix string
+}
+
+// pyImport from X import name as alias
+type pyImport struct {
+	module string
+	name   string
+}
+
+// pyFile ルート定義を読む Python のファイル
+type pyFile struct {
+	file    *models.File
+	text    string
+	imports map[string]pyImport
+}
+
+// pyRoute プレフィックスを解決する前のルート
+type pyRoute struct {
+	router    string
+	framework string
+	methods   []string
+	path      string
+	kwargs    map[string]string
+	file      *pyFile
+	line      int
+	funcName  string
+	params    string
+	returns   string
+	body      string
+}
+
+// pyClass Python のクラス（pydantic のモデル・Enum の判定に使う）
+type pyClass struct {
+	name   string
+	bases  []string
+	fields []string
+	file   *models.File
+}
+
+// pythonAPIParser Flask・FastAPI のルートをプロジェクト全体で集める
+type pythonAPIParser struct {
+	c       *apiCollector
+	files   []*pyFile
+	routers map[string]pyRouter
+	mounts  []pyMount
+	routes  []pyRoute
+	classes map[string]*pyClass
+	defined map[string]bool
+}
+
+// discoverPythonRoutes Flask（Blueprint を含む）と FastAPI（APIRouter を含む）のルートを探す
+func discoverPythonRoutes(c *apiCollector, files []models.File) {
+	p := &pythonAPIParser{c: c, routers: make(map[string]pyRouter), classes: make(map[string]*pyClass), defined: make(map[string]bool)}
+	for i := range files {
+		file := &files[i]
+		if file.Language != "python" || file.Content == "" {
+			continue
+		}
+		f := &pyFile{file: file, text: StripComments("python", file.Content), imports: make(map[string]pyImport)}
+		p.files = append(p.files, f)
+		p.collectClasses(f)
+		if !strings.Contains(f.text, "flask") && !strings.Contains(f.text, "Flask") && !strings.Contains(f.text, "fastapi") {
+			continue
+		}
+		for _, m := range pyFromImportRe.FindAllStringSubmatch(f.text, -1) {
+			for _, item := range strings.Split(m[2], ",") {
+				fields := strings.Fields(item)
+				switch {
+				case len(fields) == 1:
+					f.imports[fields[0]] = pyImport{module: m[1], name: fields[0]}
+				case len(fields) == 3 && fields[1] == "as":
+					f.imports[fields[2]] = pyImport{module: m[1], name: fields[0]}
+				}
+			}
+		}
+		for _, m := range pyRouterDeclRe.FindAllStringSubmatchIndex(f.text, -1) {
+			name, kind := f.text[m[2]:m[3]], f.text[m[4]:m[5]]
+			args, _ := callArguments(f.text, m[1]-1)
+			positional, kwargs := parseCallArgs(args)
+			r := pyRouter{framework: "flask"}
+			switch kind {
+			case "Blueprint":
+				r.prefix = unquoteLiteral(kwargs["url_prefix"])
+				if len(positional) > 0 {
+					r.tag = unquoteLiteral(positional[0])
+				}
+			case "FastAPI":
+				r.framework = "fastapi"
+			case "APIRouter":
+				r.framework = "fastapi"
+				r.prefix = unquoteLiteral(kwargs["prefix"])
+				if tags := strings.Trim(kwargs["tags"], "[] "); tags != "" {
+					r.tag = unquoteLiteral(strings.Split(tags, ",")[0])
+				}
+			}
+			p.routers[pyKey(f.file, name)] = r
+		}
+	}
+	for _, f := range p.files {
+		p.scanRoutes(f)
+	}
+	for _, route := range p.routes {
+		for _, base := range p.prefixes(route.router, map[string]bool{}) {
+			p.addRoute(route, base)
+		}
+	}
+}
+
+func pyKey(file *models.File, name string) string {
+	return file.Name + "#" + name
+}
+
+// resolve 変数名（import したものを含む）をルーターのキーにする。mod.router の形も受け付ける
+func (p *pythonAPIParser) resolve(f *pyFile, expr string) string {
+	expr = strings.TrimSpace(expr)
+	parts := strings.Split(expr, ".")
+	if len(parts) == 1 {
+		if _, ok := p.routers[pyKey(f.file, expr)]; ok {
+			return pyKey(f.file, expr)
+		}
+		imp, ok := f.imports[expr]
+		if !ok {
+			return ""
+		}
+		if file := p.moduleFile(f, imp.module); file != nil {
+			return pyKey(file, imp.name)
+		}
+		// from app.api import users の users がモジュールで、変数名と同じ名前のとき
+		if file := p.moduleFile(f, pyJoinModule(imp.module, imp.name)); file != nil {
+			return pyKey(file, imp.name)
+		}
+		return ""
+	}
+	module := strings.Join(parts[:len(parts)-1], ".")
+	if imp, ok := f.imports[parts[0]]; ok {
+		module = pyJoinModule(imp.module, imp.name) + strings.TrimPrefix(module, parts[0])
+	}
+	if file := p.moduleFile(f, module); file != nil {
+		return pyKey(file, parts[len(parts)-1])
+	}
+	return ""
+}
+
+// pyJoinModule from . import x のような相対 import でもモジュール名をつなぐ
+func pyJoinModule(module, name string) string {
+	if strings.HasSuffix(module, ".") {
+		return module + name
+	}
+	return module + "." + name
+}
+
+// moduleFile モジュール名（相対 import を含む）に当たるプロジェクト内のファイル
+func (p *pythonAPIParser) moduleFile(from *pyFile, module string) *models.File {
+	rel := strings.TrimLeft(module, ".")
+	dots := len(module) - len(rel)
+	target := strings.ReplaceAll(rel, ".", "/")
+	if dots > 0 {
+		dir := path.Dir(from.file.Name)
+		for i := 1; i < dots; i++ {
+			dir = path.Dir(dir)
+		}
+		target = path.Join(dir, target)
+	}
+	for _, f := range p.files {
+		name := f.file.Name
+		if name == target+".py" || name == target+"/__init__.py" ||
+			(dots == 0 && (strings.HasSuffix(name, "/"+target+".py") || strings.HasSuffix(name, "/"+target+"/__init__.py"))) {
+			return f.file
+		}
+	}
+	return nil
+}
+
+// scanRoutes デコレーター・add_url_rule によるルートの登録とマウントを集める
+func (p *pythonAPIParser) scanRoutes(f *pyFile) {
+	text := f.text
+	for _, m := range pyMountRe.FindAllStringSubmatchIndex(text, -1) {
+		args, _ := callArguments(text, m[1]-1)
+		positional, kwargs := parseCallArgs(args)
+		if len(positional) == 0 {
+			continue
+		}
+		parent := p.resolve(f, text[m[2]:m[3]])
+		child := p.resolve(f, positional[0])
+		if parent == "" || child == "" {
+			continue
+		}
+		prefix := unquoteLiteral(kwargs["url_prefix"])
+		if text[m[4]:m[5]] == "include_router" {
+			prefix = unquoteLiteral(kwargs["prefix"])
+		}
+		p.mounts = append(p.mounts, pyMount{parent: parent, child: child, prefix: prefix})
+	}
+
+	for _, m := range pyRouteDecoRe.FindAllStringSubmatchIndex(text, -1) {
+		receiver, method := text[m[2]:m[3]], text[m[4]:m[5]]
+		router := p.resolve(f, receiver)
+		framework := ""
+		if r, ok := p.routers[router]; ok {
+			framework = r.framework
+		} else if strings.Contains(text, "fastapi") {
+			framework, router = "fastapi", pyKey(f.file, receiver)
+		} else if strings.Contains(text, "flask") {
+			framework, router = "flask", pyKey(f.file, receiver)
+		} else {
+			continue
+		}
+		args, end := callArguments(text, m[1]-1)
+		positional, kwargs := parseCallArgs(args)
+		routePath := unquoteLiteral(kwargs["path"])
+		if len(positional) > 0 {
+			routePath = unquoteLiteral(positional[0])
+		}
+		if kwargs["rule"] != "" {
+			routePath = unquoteLiteral(kwargs["rule"])
+		}
+		route := pyRoute{router: router, framework: framework, path: routePath, kwargs: kwargs, file: f, line: lineAt(text, m[0]+strings.IndexByte(text[m[0]:], '@'))}
+		switch method {
+		case "route", "api_route":
+			route.methods = pyMethodList(kwargs["methods"])
+		default:
+			route.methods = []string{method}
+		}
+		if !p.attachFunction(&route, text, end) {
+			continue
+		}
+		p.routes = append(p.routes, route)
+	}
+
+	for _, m := range pyAddURLRuleRe.FindAllStringSubmatchIndex(text, -1) {
+		router := p.resolve(f, text[m[2]:m[3]])
+		if router == "" {
+			router = pyKey(f.file, text[m[2]:m[3]])
+		}
+		args, _ := callArguments(text, m[1]-1)
+		positional, kwargs := parseCallArgs(args)
+		if len(positional) == 0 {
+			continue
+		}
+		view := kwargs["view_func"]
+		if view == "" && len(positional) > 2 {
+			view = positional[2]
+		}
+		route := pyRoute{router: router, framework: "flask", path: unquoteLiteral(positional[0]), kwargs: kwargs, file: f, line: lineAt(text, m[0]), methods: pyMethodList(kwargs["methods"])}
+		if def := regexp.MustCompile(`(?m)^[ \t]*(?:async\s+)?def\s+` + regexp.QuoteMeta(lastPathElement(view)) + `\s*\(`).FindStringIndex(text); def != nil {
+			p.attachFunction(&route, text, def[0])
+		} else {
+			route.funcName = view
+		}
+		p.routes = append(p.routes, route)
+	}
+}
+
+// pyMethodList methods=['GET', 'POST'] の一覧（指定がなければ GET）
+func pyMethodList(list string) []string {
+	var methods []string
+	for _, item := range splitCallArgs(strings.Trim(strings.TrimSpace(list), "[]()")) {
+		if m := strings.ToLower(unquoteLiteral(item)); m != "" {
+			methods = append(methods, m)
+		}
+	}
+	if len(methods) == 0 {
+		methods = []string{"get"}
+	}
+	return methods
+}
+
+// attachFunction デコレーターに続く関数定義（他のデコレーターは飛ばす）の名前・引数・戻り値の型・本体を読む
+func (p *pythonAPIParser) attachFunction(route *pyRoute, text string, i int) bool {
+	for {
+		for i < len(text) && (text[i] == ' ' || text[i] == '\t' || text[i] == '\n' || text[i] == '\r') {
+			i++
+		}
+		if i >= len(text) || text[i] != '@' {
+			break
+		}
+		// 別のデコレーター
+		j := i + 1
+		for j < len(text) && text[j] != '(' && text[j] != '\n' {
+			j++
+		}
+		if j < len(text) && text[j] == '(' {
+			_, j = callArguments(text, j)
+		}
+		i = j
+	}
+	m := pyDefRe.FindStringSubmatchIndex(text[i:])
+	if m == nil {
+		return false
+	}
+	route.funcName = text[i+m[2] : i+m[3]]
+	params, end := callArguments(text, i+m[1]-1)
+	route.params = params
+	rm := pyReturnTypeRe.FindStringSubmatchIndex(text[end:])
+	if rm == nil {
+		return false
+	}
+	if rm[2] >= 0 {
+		route.returns = strings.TrimSpace(text[end+rm[2] : end+rm[3]])
+	}
+	route.body = pyBlock(text, lineStart(text, i), end+rm[1])
+	return true
+}
+
+func lineStart(text string, i int) int {
+	return strings.LastIndexByte(text[:i], '\n') + 1
+}
+
+// pyBlock start の行より深く字下げされた、bodyStart から始まるブロック
+func pyBlock(text string, start, bodyStart int) string {
+	indent := 0
+	for start+indent < len(text) && (text[start+indent] == ' ' || text[start+indent] == '\t') {
+		indent++
+	}
+	end := bodyStart
+	// def f(): return x のように同じ行に本体があるとき
+	if nl := strings.IndexByte(text[bodyStart:], '\n'); nl < 0 {
+		return text[bodyStart:]
+	} else if strings.TrimSpace(text[bodyStart:bodyStart+nl]) != "" {
+		return text[bodyStart : bodyStart+nl]
+	} else {
+		end = bodyStart + nl + 1
+	}
+	for end < len(text) {
+		nl := strings.IndexByte(text[end:], '\n')
+		line := text[end:]
+		if nl >= 0 {
+			line = text[end : end+nl]
+		}
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && len(line)-len(trimmed) <= indent {
+			break
+		}
+		if nl < 0 {
+			end = len(text)
+			break
+		}
+		end += nl + 1
+	}
+	return text[bodyStart:end]
+}
+
+// prefixes ルーターのマウント先のプレフィックス（ルーター自身の prefix・url_prefix を含む）
+func (p *pythonAPIParser) prefixes(key string, seen map[string]bool) []pyRouter {
+	r := p.routers[key]
+	if seen[key] {
+		return nil
+	}
+	seen[key] = true
+	defer delete(seen, key)
+	var out []pyRouter
+	for _, m := range p.mounts {
+		if m.child != key {
+			continue
+		}
+		for _, parent := range p.prefixes(m.parent, seen) {
+			// register_blueprint の url_prefix は Blueprint の url_prefix を置き換える
+			own := r.prefix
+			if r.framework == "flask" && m.prefix != "" {
+				own = ""
+			}
+			out = append(out, pyRouter{framework: r.framework, tag: firstNonEmpty(r.tag, parent.tag), prefix: joinAPIPath(joinAPIPath(parent.prefix, m.prefix), own)})
+		}
+	}
+	if len(out) == 0 {
+		out = append(out, r)
+	}
+	return out
+}
+
+// addRoute ルートを登録し、関数の引数・本体からパラメータとレスポンスを推定する
+func (p *pythonAPIParser) addRoute(route pyRoute, base pyRouter) {
+	raw := route.path
+	if base.prefix != "" {
+		raw = joinAPIPath(base.prefix, route.path)
+	}
+	framework := firstNonEmpty(base.framework, route.framework)
+	openPath := raw
+	pathTypes := make(map[string]*APISchema)
+	if framework == "flask" {
+		openPath = pyFlaskParamRe.ReplaceAllStringFunc(raw, func(s string) string {
+			m := pyFlaskParamRe.FindStringSubmatch(s)
+			if schema, ok := pyFlaskConverters[m[1]]; ok {
+				copied := schema
+				pathTypes[m[2]] = &copied
+			}
+			return "{" + m[2] + "}"
+		})
+	} else {
+		openPath = pyFastParamRe.ReplaceAllString(raw, "{$1}")
+	}
+	for _, method := range route.methods {
+		ep := &APIEndpoint{
+			Method:    method,
+			Path:      openPath,
+			RawPath:   raw,
+			Framework: framework,
+			Handler:   route.funcName,
+			Tag:       base.tag,
+			File:      route.file.file.Name,
+			Line:      route.line,
+		}
+		for name, schema := range pathTypes {
+			ep.param(name, "path", true, schema)
+		}
+		if framework == "fastapi" {
+			p.inspectFastAPI(ep, route)
+		} else {
+			p.inspectFlask(ep, route)
+		}
+		p.c.add(ep)
+	}
+}
+
+// inspectFastAPI 関数の引数の型注釈と response_model・status_code からパラメータとレスポンスを決める
+func (p *pythonAPIParser) inspectFastAPI(ep *APIEndpoint, route pyRoute) {
+	pathParams := make(map[string]bool)
+	for _, m := range apiPathParamRe.FindAllStringSubmatch(ep.Path, -1) {
+		pathParams[m[1]] = true
+	}
+	var bodies []string
+	bodySchemas := make(map[string]*APISchema)
+	for _, param := range splitCallArgs(route.params) {
+		name, annotation, def := splitPyParam(param)
+		if name == "" || name == "self" || name == "cls" || strings.HasPrefix(name, "*") {
+			continue
+		}
+		typ, marker := annotation, ""
+		if strings.HasPrefix(typ, "Annotated[") {
+			inner := splitCallArgs(strings.TrimSuffix(strings.TrimPrefix(typ, "Annotated["), "]"))
+			if len(inner) > 0 {
+				typ = inner[0]
+			}
+			if len(inner) > 1 {
+				marker = inner[1]
+			}
+		}
+		if marker == "" {
+			marker = def
+		}
+		markerName := marker
+		if i := strings.IndexByte(markerName, '('); i >= 0 {
+			markerName = markerName[:i]
+		}
+		markerName = lastPathElement(markerName)
+		baseType := lastPathElement(pyUnwrapOptional(typ))
+		if pySkippedParamTypes[baseType] || markerName == "Depends" || markerName == "Security" {
+			continue
+		}
+		schema := p.typeSchema(typ)
+		required := def == "" || strings.HasPrefix(strings.TrimPrefix(marker, markerName+"("), "...")
+		if pyIsOptional(typ) {
+			required = false
+		}
+		switch {
+		case pathParams[name] || markerName == "Path":
+			ep.param(name, "path", true, schema)
+		case markerName == "Query":
+			ep.param(pyAlias(marker, name), "query", required, schema)
+		case markerName == "Header":
+			ep.param(pyAlias(marker, strings.ReplaceAll(name, "_", "-")), "header", required, schema)
+		case markerName == "Cookie":
+			ep.param(pyAlias(marker, name), "cookie", required, schema)
+		case markerName == "File" || baseType == "UploadFile":
+			ep.bodyProperty("multipart/form-data", name, &APISchema{Type: "string", Format: "binary"})
+		case markerName == "Form":
+			ep.bodyProperty("application/x-www-form-urlencoded", name, schema)
+		case markerName == "Body" || p.isModelType(typ):
+			bodies = append(bodies, name)
+			bodySchemas[name] = schema
+		default:
+			ep.param(name, "query", required, schema)
+		}
+	}
+	// 本体が1つならそのまま、複数ならパラメータ名をキーにしたオブジェクトになる
+	switch len(bodies) {
+	case 0:
+	case 1:
+		ep.body("application/json", bodySchemas[bodies[0]])
+	default:
+		for _, name := range bodies {
+			ep.bodyProperty("application/json", name, bodySchemas[name])
+		}
+	}
+
+	status := "200"
+	if code := route.kwargs["status_code"]; code != "" {
+		status = statusString(code)
+	}
+	model := route.kwargs["response_model"]
+	if model == "" && route.returns != "" && route.returns != "None" {
+		model = route.returns
+	}
+	switch {
+	case model == "None" || status == "204":
+		ep.respond(status, "", nil)
+	case model != "" && !strings.Contains(model, "Response"):
+		ep.respond(status, "application/json", p.typeSchema(model))
+	default:
+		p.inspectReturns(ep, route.body, status, "application/json")
+		if len(ep.Responses) == 0 {
+			ep.respond(status, "application/json", &APISchema{})
+		}
+	}
+	for _, m := range pyHTTPExcRe.FindAllStringSubmatch(route.body, -1) {
+		ep.respond(statusString(m[1]), "application/json", &APISchema{Type: "object", Properties: map[string]*APISchema{"detail": {Type: "string"}}})
+	}
+}
+
+// splitPyParam name: annotation = default に分ける
+func splitPyParam(param string) (string, string, string) {
+	name, rest := param, ""
+	if i := strings.IndexAny(param, ":="); i >= 0 {
+		name, rest = param[:i], param[i:]
+	}
+	name = strings.TrimSpace(name)
+	annotation, def := "", ""
+	if strings.HasPrefix(rest, ":") {
+		rest = rest[1:]
+		if i := topLevelIndex(rest, '='); i >= 0 {
+			annotation, def = rest[:i], rest[i+1:]
+		} else {
+			annotation = rest
+		}
+	} else if strings.HasPrefix(rest, "=") {
+		def = rest[1:]
+	}
+	return name, strings.TrimSpace(annotation), strings.TrimSpace(def)
+}
+
+// topLevelIndex 括弧・引用符の外にある最初の c の位置
+func topLevelIndex(s string, c byte) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			i = scanQuoted(s, i, s[i], false, true) - 1
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case c:
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// pyAlias Query(alias="x") の別名
+func pyAlias(marker, name string) string {
+	if i := strings.IndexByte(marker, '('); i >= 0 {
+		_, kwargs := parseCallArgs(strings.TrimSuffix(marker[i+1:], ")"))
+		if alias := unquoteLiteral(kwargs["alias"]); alias != "" {
+			return alias
+		}
+	}
+	return name
+}
+
+// pyIsOptional Optional[X]・X | None・Union[X, None]
+func pyIsOptional(typ string) bool {
+	return strings.HasPrefix(typ, "Optional[") || strings.Contains(typ, "| None") || strings.Contains(typ, "None |") ||
+		strings.HasPrefix(typ, "Union[") && strings.Contains(typ, "None")
+}
+
+// pyUnwrapOptional Optional・None との Union を外した型
+func pyUnwrapOptional(typ string) string {
+	typ = strings.TrimSpace(typ)
+	if strings.HasPrefix(typ, "Optional[") && strings.HasSuffix(typ, "]") {
+		return pyUnwrapOptional(typ[len("Optional[") : len(typ)-1])
+	}
+	if strings.HasPrefix(typ, "Union[") && strings.HasSuffix(typ, "]") {
+		var rest []string
+		for _, part := range splitCallArgs(typ[len("Union[") : len(typ)-1]) {
+			if part != "None" {
+				rest = append(rest, part)
+			}
+		}
+		if len(rest) == 1 {
+			return rest[0]
+		}
+	}
+	if strings.Contains(typ, "|") {
+		var rest []string
+		for _, part := range strings.Split(typ, "|") {
+			if part = strings.TrimSpace(part); part != "None" {
+				rest = append(rest, part)
+			}
+		}
+		if len(rest) == 1 {
+			return rest[0]
+		}
+	}
+	return typ
+}
+
+// inspectFlask 関数の本体の request.*・return からパラメータとレスポンスを推定する
+func (p *pythonAPIParser) inspectFlask(ep *APIEndpoint, route pyRoute) {
+	body := route.body
+	for _, m := range pyRequestDataRe.FindAllStringSubmatch(body, -1) {
+		ep.body("application/json", &APISchema{Type: "object"})
+		re := regexp.MustCompile(`\b` + regexp.QuoteMeta(m[1]) + `(?:\.get\s*\(\s*|\[\s*)['"]([^'"]+)['"]`)
+		for _, use := range re.FindAllStringSubmatch(body, -1) {
+			ep.bodyProperty("application/json", use[1], nil)
+		}
+	}
+	for _, m := range pyRequestUseRe.FindAllStringSubmatch(body, -1) {
+		source, accessor, name := m[1], m[2], m[4]
+		switch {
+		case source == "args" || (source == "values" && ep.Method == "get"):
+			schema := &APISchema{Type: "string"}
+			if accessor == "getlist" {
+				schema = &APISchema{Type: "array", Items: &APISchema{Type: "string"}}
+			}
+			ep.param(name, "query", false, schema)
+		case source == "form" || source == "values":
+			ep.bodyProperty("application/x-www-form-urlencoded", name, &APISchema{Type: "string"})
+		case source == "files":
+			ep.bodyProperty("multipart/form-data", name, &APISchema{Type: "string", Format: "binary"})
+		case source == "headers":
+			ep.param(name, "header", false, nil)
+		default:
+			ep.bodyProperty("application/json", name, nil)
+		}
+	}
+	if strings.Contains(body, "request.get_json") || strings.Contains(body, "request.json") {
+		ep.body("application/json", &APISchema{Type: "object"})
+	}
+	p.inspectReturns(ep, body, "200", "text/html")
+	for _, m := range pyAbortRe.FindAllStringSubmatch(body, -1) {
+		ep.respond(m[1], "text/html", &APISchema{Type: "string"})
+	}
+}
+
+// inspectReturns return 文の値（jsonify・dict リテラル・(値, ステータス) のタプル）からレスポンスを推定する
+func (p *pythonAPIParser) inspectReturns(ep *APIEndpoint, body, status, textType string) {
+	for _, m := range pyReturnRe.FindAllStringIndex(body, -1) {
+		expr := strings.TrimSpace(pyStatement(body, m[1]))
+		if expr == "" {
+			continue
+		}
+		parts := splitCallArgs(strings.TrimSuffix(strings.TrimPrefix(expr, "("), ")"))
+		if !(strings.HasPrefix(expr, "(") && strings.HasSuffix(expr, ")")) {
+			parts = splitCallArgs(expr)
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		code := status
+		if len(parts) > 1 {
+			code = statusString(parts[1])
+		}
+		p.responseValue(ep, parts[0], code, textType)
+	}
+}
+
+// responseValue 返している値ごとのレスポンス
+func (p *pythonAPIParser) responseValue(ep *APIEndpoint, value, status, textType string) {
+	call, args := value, ""
+	if i := strings.IndexByte(value, '('); i > 0 && strings.HasSuffix(value, ")") {
+		call = value[:i]
+		args, _ = callArguments(value, i)
+	}
+	positional, kwargs := parseCallArgs(args)
+	switch lastPathElement(call) {
+	case "jsonify":
+		schema := &APISchema{}
+		switch {
+		case len(positional) == 1:
+			schema = pyValueSchema(positional[0])
+		case len(kwargs) > 0:
+			schema = &APISchema{Type: "object", Properties: make(map[string]*APISchema)}
+			for key, v := range kwargs {
+				schema.Properties[key] = pyValueSchema(v)
+			}
+		}
+		ep.respond(status, "application/json", schema)
+	case "make_response":
+		if len(positional) > 1 {
+			status = statusString(positional[1])
+		}
+		if len(positional) > 0 {
+			p.responseValue(ep, positional[0], status, textType)
+		}
+	case "JSONResponse", "ORJSONResponse", "UJSONResponse":
+		if code := kwargs["status_code"]; code != "" {
+			status = statusString(code)
+		}
+		content := kwargs["content"]
+		if content == "" && len(positional) > 0 {
+			content = positional[0]
+		}
+		ep.respond(status, "application/json", pyValueSchema(content))
+	case "Response", "PlainTextResponse", "HTMLResponse":
+		if code := kwargs["status_code"]; code != "" {
+			status = statusString(code)
+		} else if code := kwargs["status"]; code != "" {
+			status = statusString(code)
+		}
+		contentType := unquoteLiteral(firstNonEmpty(kwargs["mimetype"], kwargs["media_type"], kwargs["content_type"]))
+		if contentType == "" {
+			contentType = map[string]string{"PlainTextResponse": "text/plain", "HTMLResponse": "text/html"}[lastPathElement(call)]
+		}
+		ep.respond(status, firstNonEmpty(contentType, textType), &APISchema{Type: "string"})
+	case "render_template", "render_template_string":
+		ep.respond(status, "text/html", &APISchema{Type: "string"})
+	case "redirect", "RedirectResponse":
+		code := "302"
+		if c := firstNonEmpty(kwargs["code"], kwargs["status_code"]); c != "" {
+			code = statusString(c)
+		} else if lastPathElement(call) == "RedirectResponse" {
+			code = "307"
+		}
+		ep.respond(code, "", nil)
+	case "send_file", "send_from_directory", "FileResponse", "StreamingResponse":
+		ep.respond(status, "application/octet-stream", &APISchema{Type: "string", Format: "binary"})
+	default:
+		schema := pyValueSchema(value)
+		switch {
+		case schema.Type == "string" && (value[0] == '"' || value[0] == '\''):
+			if unquoteLiteral(value) == "" {
+				ep.respond(status, "", nil)
+			} else {
+				ep.respond(status, textType, schema)
+			}
+		case schema.Type == "object" || schema.Type == "array":
+			ep.respond(status, "application/json", schema)
+		case value == "None":
+			ep.respond(status, "", nil)
+		default:
+			ep.respond(status, "application/json", &APISchema{})
+		}
+	}
+}
+
+// pyStatement i から文の終わり（括弧の外の改行）まで
+func pyStatement(s string, i int) string {
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '"', '\'':
+			j = scanQuoted(s, j, s[j], false, true) - 1
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case '\\':
+			j++
+		case '\n':
+			if depth <= 0 {
+				return s[i:j]
+			}
+		}
+	}
+	return s[i:]
+}
+
+// pyValueSchema Python のリテラル（dict・list・文字列・数値）のスキーマ
+func pyValueSchema(value string) *APISchema {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return &APISchema{}
+	}
+	switch {
+	case value[0] == '{' && strings.HasSuffix(value, "}"):
+		inner, _ := callArguments(value, 0)
+		schema := &APISchema{Type: "object", Properties: make(map[string]*APISchema)}
+		for _, entry := range splitCallArgs(inner) {
+			i := topLevelIndex(entry, ':')
+			if i < 0 {
+				continue
+			}
+			key := strings.TrimSpace(entry[:i])
+			if len(key) < 2 || (key[0] != '"' && key[0] != '\'') {
+				continue
+			}
+			schema.Properties[unquoteLiteral(key)] = pyValueSchema(entry[i+1:])
+		}
+		return schema
+	case value[0] == '[' && strings.HasSuffix(value, "]"):
+		inner, _ := callArguments(value, 0)
+		items := &APISchema{}
+		if elems := splitCallArgs(inner); len(elems) > 0 && !strings.Contains(inner, " for ") {
+			items = pyValueSchema(elems[0])
+		}
+		return &APISchema{Type: "array", Items: items}
+	case strings.HasPrefix(value, "dict(") && strings.HasSuffix(value, ")"):
+		inner, _ := callArguments(value, 4)
+		_, kwargs := parseCallArgs(inner)
+		schema := &APISchema{Type: "object", Properties: make(map[string]*APISchema)}
+		for key, v := range kwargs {
+			schema.Properties[key] = pyValueSchema(v)
+		}
+		return schema
+	case value[0] == '"' || value[0] == '\'' || len(value) > 1 && strings.IndexByte("fFrRbBuU", value[0]) >= 0 && (value[1] == '"' || value[1] == '\''):
+		return &APISchema{Type: "string"}
+	case value == "True" || value == "False":
+		return &APISchema{Type: "boolean"}
+	case isPyNumber(value):
+		if strings.ContainsAny(value, ".eE") {
+			return &APISchema{Type: "number"}
+		}
+		return &APISchema{Type: "integer"}
+	case strings.HasPrefix(value, "str("):
+		return &APISchema{Type: "string"}
+	case strings.HasPrefix(value, "len(") || strings.HasPrefix(value, "int("):
+		return &APISchema{Type: "integer"}
+	}
+	return &APISchema{}
+}
+
+func isPyNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if (r < '0' || r > '9') && r != '.' && r != '_' && !(i == 0 && r == '-') && r != 'e' && r != 'E' {
+			return false
+		}
+	}
+	return true
+}
+
+// collectClasses pydantic のモデル・Enum を判定するためにクラスとフィールドを集める
+func (p *pythonAPIParser) collectClasses(f *pyFile) {
+	for _, m := range pyClassRe.FindAllStringSubmatchIndex(f.text, -1) {
+		cls := &pyClass{name: f.text[m[4]:m[5]], file: f.file}
+		if m[6] >= 0 {
+			for _, base := range splitCallArgs(f.text[m[6]:m[7]]) {
+				if !strings.Contains(base, "=") {
+					cls.bases = append(cls.bases, lastPathElement(strings.TrimSpace(base)))
+				}
+			}
+		}
+		// クラスの直下の行だけをフィールドとして読む（入れ子の class Config などは飛ばす）
+		block := pyBlock(f.text, m[0], m[1])
+		fieldIndent := -1
+		for _, line := range strings.Split(block, "\n") {
+			trimmed := strings.TrimLeft(line, " \t")
+			if trimmed == "" {
+				continue
+			}
+			indent := len(line) - len(trimmed)
+			if fieldIndent < 0 {
+				fieldIndent = indent
+			}
+			if indent == fieldIndent {
+				cls.fields = append(cls.fields, strings.TrimSpace(trimmed))
+			}
+		}
+		if _, exists := p.classes[cls.name]; !exists {
+			p.classes[cls.name] = cls
+		}
+	}
+}
+
+// pyModelBases pydantic・SQLModel のモデルの基底クラス
+var pyModelBases = map[string]bool{"BaseModel": true, "SQLModel": true, "Schema": true, "TypedDict": true}
+
+// isModel クラスが pydantic のモデルか（基底クラスをたどる）
+func (p *pythonAPIParser) isModel(name string, depth int) bool {
+	cls, ok := p.classes[name]
+	if !ok || depth > 10 {
+		return false
+	}
+	for _, base := range cls.bases {
+		if pyModelBases[base] || p.isModel(base, depth+1) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *pythonAPIParser) isEnum(name string) bool {
+	cls, ok := p.classes[name]
+	if !ok {
+		return false
+	}
+	for _, base := range cls.bases {
+		if strings.HasSuffix(base, "Enum") {
+			return true
+		}
+	}
+	return false
+}
+
+// isModelType 型注釈がモデル（またはそのリスト）か
+func (p *pythonAPIParser) isModelType(typ string) bool {
+	t := pyUnwrapOptional(typ)
+	for _, prefix := range []string{"list[", "List[", "Sequence[", "set[", "Set["} {
+		if strings.HasPrefix(t, prefix) && strings.HasSuffix(t, "]") {
+			t = t[len(prefix) : len(t)-1]
+		}
+	}
+	return p.isModel(lastPathElement(strings.TrimSpace(t)), 0)
+}
+
+// typeSchema Python の型注釈のスキーマ。pydantic のモデルは components に登録して参照する
+func (p *pythonAPIParser) typeSchema(typ string) *APISchema {
+	typ = strings.Trim(strings.TrimSpace(pyUnwrapOptional(typ)), `"'`)
+	if typ == "" {
+		return &APISchema{Type: "string"}
+	}
+	if i := strings.IndexByte(typ, '['); i > 0 && strings.HasSuffix(typ, "]") {
+		outer, inner := lastPathElement(typ[:i]), typ[i+1:len(typ)-1]
+		args := splitCallArgs(inner)
+		switch outer {
+		case "list", "List", "Sequence", "set", "Set", "frozenset", "Iterable", "tuple", "Tuple":
+			items := &APISchema{}
+			if len(args) > 0 {
+				items = p.typeSchema(args[0])
+			}
+			return &APISchema{Type: "array", Items: items}
+		case "dict", "Dict", "Mapping":
+			schema := &APISchema{Type: "object"}
+			if len(args) == 2 {
+				schema.AdditionalProperties = p.typeSchema(args[1])
+			}
+			return schema
+		case "Literal":
+			schema := &APISchema{Type: "string"}
+			for _, arg := range args {
+				schema.Enum = append(schema.Enum, unquoteLiteral(arg))
+			}
+			return schema
+		case "Annotated", "Optional":
+			if len(args) > 0 {
+				return p.typeSchema(args[0])
+			}
+		case "conlist":
+			if len(args) > 0 {
+				return &APISchema{Type: "array", Items: p.typeSchema(args[0])}
+			}
+		}
+		return &APISchema{}
+	}
+	name := lastPathElement(typ)
+	if strings.HasPrefix(name, "con") && strings.HasSuffix(typ, ")") {
+		// constr(...)・conint(...) などの制約付きの型
+		name = strings.SplitN(strings.TrimPrefix(name, "con"), "(", 2)[0]
+		if name == "decimal" {
+			name = "float"
+		}
+	}
+	if schema, ok := pyScalarTypes[name]; ok {
+		copied := schema
+		return &copied
+	}
+	if p.isEnum(name) {
+		schema := &APISchema{Type: "string"}
+		for _, field := range p.classes[name].fields {
+			if m := pyEnumMemberRe.FindStringSubmatch(field); m != nil {
+				schema.Enum = append(schema.Enum, unquoteLiteral(m[2]))
+			}
+		}
+		return schema
+	}
+	if p.isModel(name, 0) {
+		return p.modelSchema(name)
+	}
+	return &APISchema{}
+}
+
+// modelSchema pydantic のモデルのフィールドを components に登録する（基底のモデルのフィールドも含む）
+func (p *pythonAPIParser) modelSchema(name string) *APISchema {
+	if p.defined[name] {
+		return apiRef(name)
+	}
+	p.defined[name] = true
+	p.c.schemas[name] = &APISchema{Type: "object"}
+	schema := &APISchema{Type: "object", Properties: make(map[string]*APISchema)}
+	p.addModelFields(schema, name, 0)
+	if len(schema.Properties) == 0 {
+		schema.Properties = nil
+	}
+	return p.c.define(name, schema)
+}
+
+func (p *pythonAPIParser) addModelFields(schema *APISchema, name string, depth int) {
+	cls, ok := p.classes[name]
+	if !ok || depth > 10 {
+		return
+	}
+	for _, base := range cls.bases {
+		p.addModelFields(schema, base, depth+1)
+	}
+	for _, field := range cls.fields {
+		m := pyClassFieldRe.FindStringSubmatch(field)
+		if m == nil || m[1] == "model_config" || strings.HasPrefix(m[2], "ClassVar") {
+			continue
+		}
+		schema.Properties[m[1]] = p.typeSchema(m[2])
+		def := strings.TrimSpace(m[3])
+		required := !pyIsOptional(m[2]) && (def == "" || strings.HasPrefix(def, "Field(...") || strings.HasPrefix(def, "Field()"))
+		if required && !containsString(schema.Required, m[1]) {
+			schema.Required = append(schema.Required, m[1])
+		}
+	}
+}
@@ -0,0 +1,533 @@
+package services
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+var (
+	railsDoRe         = regexp.MustCompile(`\s+do\s*(?:\|[^|]*\|)?\s*$`)
+	railsRouteStmtRe  = regexp.MustCompile(`^(\w+)\b[ \t]*\(?(.*?)\)?$`)
+	railsOptionalRe   = regexp.MustCompile(`\([^()]*\)`)
+	railsPermitRe     = regexp.MustCompile(`\bparams\s*\.\s*(?:require\(\s*:(\w+)\s*\)\s*\.\s*permit|permit|expect)\s*\(`)
+	railsParamRe      = regexp.MustCompile(`\bparams\s*(?:\[\s*:(\w+)\s*\]|\.fetch\(\s*:(\w+)|\.dig\(\s*:(\w+))`)
+	railsHelperRe     = regexp.MustCompile(`\b(\w+_params)\b`)
+	railsRenderRe     = regexp.MustCompile(`\brender\b\s*\(?\s*([^\n]*)`)
+	railsHeadRe       = regexp.MustCompile(`\bhead\b\s*\(?\s*:?(\w+)`)
+	railsRedirectRe   = regexp.MustCompile(`\bredirect_to\b([^\n]*)`)
+	railsSendFileRe   = regexp.MustCompile(`\bsend_(?:file|data)\b`)
+	railsStatusOptRe  = regexp.MustCompile(`\bstatus:\s*:?(\w+)`)
+	railsBlockOpenRe  = regexp.MustCompile(`^(?:if|unless|case|begin|while|until|for)\b`)
+	railsDefLineRe    = regexp.MustCompile(`(?m)^([ \t]*)def[ \t]+(?:self\.)?(\w+[?!]?)`)
+	railsResourceActs = []string{"index", "create", "new", "show", "update", "destroy", "edit"}
+)
+
+// railsScope routes.rb の do ... end の入れ子（namespace・scope・resources など）
+type railsScope struct {
+	path       string // 入れ子のルートのプレフィックス
+	module     string // コントローラーの名前空間（admin/ など）
+	controller string
+	member     string // resources の /posts/{id}
+	collection string // resources の /posts
+	resource   bool
+	skip       bool // concern の中は登録しない
+}
+
+// railsRoute routes.rb から読んだルート
+type railsRoute struct {
+	methods    []string
+	path       string
+	controller string
+	action     string
+	handler    string
+	line       int
+}
+
+// discoverRailsRoutes config/routes.rb を読み、対応するコントローラーのアクションからパラメータとレスポンスを推定する
+func discoverRailsRoutes(c *apiCollector, files []models.File) {
+	controllers := make(map[string]*models.File)
+	var routeFiles []*models.File
+	for i := range files {
+		file := &files[i]
+		if file.Language != "ruby" || file.Content == "" {
+			continue
+		}
+		name := strings.ReplaceAll(file.Name, "\\", "/")
+		if i := strings.LastIndex(name, "app/controllers/"); i >= 0 && strings.HasSuffix(name, "_controller.rb") {
+			controllers[strings.TrimSuffix(name[i+len("app/controllers/"):], "_controller.rb")] = file
+		}
+		if strings.HasSuffix(name, "config/routes.rb") || strings.Contains(name, "config/routes/") {
+			routeFiles = append(routeFiles, file)
+		}
+	}
+	for _, file := range routeFiles {
+		for _, route := range parseRailsRoutes(StripComments("ruby", file.Content)) {
+			for _, method := range route.methods {
+				ep := &APIEndpoint{
+					Method:    method,
+					RawPath:   route.path,
+					Path:      railsOpenAPIPath(route.path),
+					Framework: "rails",
+					Handler:   route.handler,
+					Tag:       route.controller,
+					File:      file.Name,
+					Line:      route.line,
+				}
+				if ep.Handler == "" {
+					ep.Handler = route.controller + "#" + route.action
+				}
+				if ctrl, ok := controllers[route.controller]; ok && route.action != "" {
+					inspectRailsAction(ep, StripComments("ruby", ctrl.Content), route.action)
+				}
+				c.add(ep)
+			}
+		}
+	}
+}
+
+// railsOpenAPIPath (.:format) などの省略できる部分を外し、:id を {id} にする
+func railsOpenAPIPath(p string) string {
+	for railsOptionalRe.MatchString(p) {
+		p = railsOptionalRe.ReplaceAllString(p, "")
+	}
+	return colonPathToOpenAPI(p)
+}
+
+// parseRailsRoutes routes.rb のルーティング DSL を行ごとに読む
+func parseRailsRoutes(text string) []railsRoute {
+	var routes []railsRoute
+	stack := []railsScope{{}}
+	for ln, raw := range strings.Split(text, "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+		scope := stack[len(stack)-1]
+		if line == "end" || strings.HasPrefix(line, "end ") || strings.HasPrefix(line, "end.") {
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+		block := railsDoRe.MatchString(line)
+		line = railsDoRe.ReplaceAllString(line, "")
+		if railsBlockOpenRe.MatchString(line) {
+			stack = append(stack, scope)
+			continue
+		}
+		m := railsRouteStmtRe.FindStringSubmatch(line)
+		if m == nil {
+			if block {
+				stack = append(stack, scope)
+			}
+			continue
+		}
+		keyword, rest := m[1], m[2]
+		args, options := railsRouteArgs(rest)
+		next := scope
+		emit := func(methods []string, p, controller, action, handler string) {
+			if scope.skip {
+				return
+			}
+			routes = append(routes, railsRoute{methods: methods, path: p, controller: controller, action: action, handler: handler, line: ln + 1})
+		}
+
+		switch keyword {
+		case "namespace":
+			if len(args) > 0 {
+				next.path = joinAPIPath(scope.path, firstNonEmpty(options["path"], args[0]))
+				next.module = scope.module + firstNonEmpty(options["module"], args[0]) + "/"
+				next.resource = false
+			}
+		case "scope":
+			segment := firstNonEmpty(options["path"], func() string {
+				if len(args) > 0 {
+					return args[0]
+				}
+				return ""
+			}())
+			if segment != "" {
+				next.path = joinAPIPath(scope.path, segment)
+			}
+			if module := options["module"]; module != "" {
+				next.module = scope.module + module + "/"
+			}
+			if controller := options["controller"]; controller != "" {
+				next.controller = scope.module + controller
+			}
+			next.resource = false
+		case "controller":
+			if len(args) > 0 {
+				next.controller = scope.module + args[0]
+			}
+		case "concern":
+			next.skip = true
+		case "member":
+			next.path, next.resource = scope.member, false
+		case "collection":
+			next.path, next.resource = scope.collection, false
+		case "resources", "resource":
+			singular := keyword == "resource"
+			for _, name := range args {
+				controller := scope.module + firstNonEmpty(options["controller"], name)
+				if singular && options["controller"] == "" {
+					controller = scope.module + pluralizeTableName(name)
+				}
+				collection := joinAPIPath(scope.path, firstNonEmpty(options["path"], name))
+				member := collection
+				nested := collection
+				if !singular {
+					param := firstNonEmpty(options["param"], "id")
+					member = collection + "/:" + param
+					nested = collection + "/:" + singularizeTableName(name) + "_" + param
+				}
+				for _, action := range railsResourceActions(options) {
+					if singular && action == "index" {
+						continue
+					}
+					target := member
+					switch action {
+					case "index", "create":
+						target = collection
+					case "new":
+						target = collection + "/new"
+					case "edit":
+						target = member + "/edit"
+					}
+					emit(railsActionMethods(action), target, controller, action, "")
+				}
+				next = railsScope{path: nested, module: scope.module, controller: controller, member: member, collection: collection, resource: true, skip: scope.skip}
+			}
+		case "root":
+			to := firstNonEmpty(options["to"], func() string {
+				if len(args) > 0 {
+					return args[0]
+				}
+				return ""
+			}())
+			controller, action, handler := railsTarget(scope, to, options)
+			emit([]string{"get"}, joinAPIPath(scope.path, "/"), controller, action, handler)
+		case "get", "post", "put", "patch", "delete", "match":
+			if len(args) == 0 {
+				break
+			}
+			segment := args[0]
+			base := scope.path
+			switch options["on"] {
+			case "member":
+				base = scope.member
+			case "collection":
+				base = scope.collection
+			}
+			to := options["to"]
+			if to == "" && strings.Contains(segment, "#") {
+				// get 'pages#about' のように宛先だけを書いた形
+				to, segment = segment, strings.Split(segment, "#")[1]
+			}
+			controller, action, handler := railsTarget(scope, to, options)
+			if action == "" {
+				action = strings.Trim(railsOptionalRe.ReplaceAllString(path.Base(segment), ""), "/")
+				action = strings.TrimPrefix(action, ":")
+				if controller == "" {
+					if dir := path.Dir(strings.Trim(segment, "/")); dir != "." && !strings.Contains(dir, ":") {
+						controller = scope.module + dir
+					}
+				}
+			}
+			methods := []string{keyword}
+			if keyword == "match" {
+				methods = railsVia(options["via"])
+			}
+			emit(methods, joinAPIPath(base, segment), controller, action, handler)
+		}
+		if block {
+			stack = append(stack, next)
+		}
+	}
+	return routes
+}
+
+// railsRouteArgs ルートの引数。'path' => 'controller#action' の形は to: として扱う
+func railsRouteArgs(rest string) ([]string, map[string]string) {
+	parts := splitCallArgs(strings.TrimSpace(rest))
+	var arrow string
+	if len(parts) > 0 {
+		if i := strings.Index(parts[0], "=>"); i >= 0 && strings.ContainsAny(parts[0][:i], `"'`) {
+			arrow = unquoteLiteral(parts[0][i+2:])
+			parts[0] = parts[0][:i]
+		}
+	}
+	args, options := rubyArgs(strings.Join(parts, ", "))
+	if arrow != "" && options["to"] == "" {
+		options["to"] = arrow
+	}
+	var names []string
+	for _, arg := range args {
+		// %i[...]・[:a, :b] の配列はまとめて展開する
+		names = append(names, railsSymbolList(arg)...)
+	}
+	return names, options
+}
+
+// railsSymbolList :index・[:index, :show]・%i[index show] を名前の一覧にする
+func railsSymbolList(v string) []string {
+	v = strings.TrimSpace(v)
+	switch {
+	case strings.HasPrefix(v, "%i[") || strings.HasPrefix(v, "%w["):
+		return strings.Fields(strings.TrimSuffix(v[3:], "]"))
+	case strings.HasPrefix(v, "["):
+		var names []string
+		for _, item := range splitCallArgs(strings.Trim(v, "[]")) {
+			names = append(names, unquoteLiteral(item))
+		}
+		return names
+	case v == "":
+		return nil
+	}
+	return []string{unquoteLiteral(v)}
+}
+
+// railsResourceActions resources の only:・except: を反映したアクション
+func railsResourceActions(options map[string]string) []string {
+	if only, ok := options["only"]; ok {
+		var actions []string
+		for _, action := range railsResourceActs {
+			if containsString(railsSymbolList(only), action) {
+				actions = append(actions, action)
+			}
+		}
+		return actions
+	}
+	except := railsSymbolList(options["except"])
+	var actions []string
+	for _, action := range railsResourceActs {
+		if !containsString(except, action) {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// railsActionMethods resources の標準アクションの HTTP メソッド
+func railsActionMethods(action string) []string {
+	switch action {
+	case "create":
+		return []string{"post"}
+	case "update":
+		return []string{"patch", "put"}
+	case "destroy":
+		return []string{"delete"}
+	}
+	return []string{"get"}
+}
+
+// railsVia match の via:（:all はすべてのメソッド）
+func railsVia(via string) []string {
+	names := railsSymbolList(via)
+	if len(names) == 0 || containsString(names, "all") {
+		return []string{"any"}
+	}
+	return names
+}
+
+// railsTarget to: 'controller#action'・controller:・action: から宛先を決める。Rack アプリなどはそのままハンドラ名にする
+func railsTarget(scope railsScope, to string, options map[string]string) (string, string, string) {
+	controller := scope.controller
+	if c := options["controller"]; c != "" {
+		controller = scope.module + c
+	}
+	action := options["action"]
+	if to != "" {
+		if i := strings.IndexByte(to, '#'); i >= 0 {
+			if to[:i] != "" {
+				controller = scope.module + to[:i]
+			}
+			action = to[i+1:]
+		} else {
+			return controller, "", to
+		}
+	}
+	return controller, action, ""
+}
+
+// railsMethodBody def name ... end の本体（インデントで end を探す）
+func railsMethodBody(text, name string) string {
+	for _, m := range railsDefLineRe.FindAllStringSubmatchIndex(text, -1) {
+		if text[m[4]:m[5]] != name {
+			continue
+		}
+		indent := len(text[m[2]:m[3]])
+		start := m[1]
+		lines := strings.SplitAfter(text[start:], "\n")
+		var sb strings.Builder
+		for i, line := range lines {
+			trimmed := strings.TrimSpace(line)
+			lead := len(line) - len(strings.TrimLeft(line, " \t"))
+			if i > 0 && trimmed != "" && lead <= indent {
+				break
+			}
+			sb.WriteString(line)
+		}
+		return sb.String()
+	}
+	return ""
+}
+
+// inspectRailsAction コントローラーのアクションの params・render・head からパラメータとレスポンスを推定する
+func inspectRailsAction(ep *APIEndpoint, text, action string) {
+	body := railsMethodBody(text, action)
+	if body == "" {
+		return
+	}
+	// post_params などのストロングパラメータのメソッドも読む
+	sources := []string{body}
+	for _, m := range railsHelperRe.FindAllStringSubmatch(body, -1) {
+		if helper := railsMethodBody(text, m[1]); helper != "" {
+			sources = append(sources, helper)
+		}
+	}
+	readsBody := ep.Method != "get" && ep.Method != "delete" && ep.Method != "head"
+	for _, src := range sources {
+		for _, m := range railsPermitRe.FindAllStringSubmatchIndex(src, -1) {
+			args, _ := callArguments(src, m[1]-1)
+			schema := railsPermitSchema(args)
+			if m[2] >= 0 {
+				schema = &APISchema{Type: "object", Properties: map[string]*APISchema{src[m[2]:m[3]]: schema}, Required: []string{src[m[2]:m[3]]}}
+			}
+			if readsBody {
+				ep.body("application/json", schema)
+				continue
+			}
+			for _, name := range sortedSchemaKeys(schema.Properties) {
+				ep.param(name, "query", false, nil)
+			}
+		}
+		for _, m := range railsParamRe.FindAllStringSubmatch(src, -1) {
+			name := firstNonEmpty(m[1], m[2], m[3])
+			if name == "controller" || name == "action" || name == "format" || railsHasPathParam(ep, name) {
+				continue
+			}
+			if readsBody {
+				ep.bodyProperty("application/json", name, nil)
+			} else {
+				ep.param(name, "query", false, nil)
+			}
+		}
+	}
+
+	responded := false
+	for _, m := range railsRenderRe.FindAllStringSubmatch(body, -1) {
+		_, options := rubyArgs(m[1])
+		status := "200"
+		if sm := railsStatusOptRe.FindStringSubmatch(m[1]); sm != nil {
+			status = statusString(sm[1])
+		}
+		switch {
+		case options["json"] != "":
+			ep.respond(status, "application/json", railsValueSchema(options["json"]))
+		case options["xml"] != "":
+			ep.respond(status, "application/xml", &APISchema{})
+		case options["plain"] != "" || options["body"] != "":
+			ep.respond(status, "text/plain", &APISchema{Type: "string"})
+		default:
+			ep.respond(status, "text/html", &APISchema{Type: "string"})
+		}
+		responded = true
+	}
+	for _, m := range railsHeadRe.FindAllStringSubmatch(body, -1) {
+		ep.respond(statusString(m[1]), "", nil)
+		responded = true
+	}
+	for _, m := range railsRedirectRe.FindAllStringSubmatch(body, -1) {
+		status := "302"
+		if sm := railsStatusOptRe.FindStringSubmatch(m[1]); sm != nil {
+			status = statusString(sm[1])
+		}
+		ep.respond(status, "", nil)
+		responded = true
+	}
+	if railsSendFileRe.MatchString(body) {
+		ep.respond("200", "application/octet-stream", &APISchema{Type: "string", Format: "binary"})
+		responded = true
+	}
+	if !responded {
+		// 明示的な render がなければビュー（jbuilder など）を描画する
+		ep.respond("200", "", nil)
+	}
+}
+
+// railsPermitSchema permit(:title, tags: [], address: [:city]) のオブジェクトのスキーマ
+func railsPermitSchema(args string) *APISchema {
+	schema := &APISchema{Type: "object", Properties: make(map[string]*APISchema)}
+	for _, arg := range splitCallArgs(args) {
+		if m := railsHashRe.FindStringSubmatch(arg); m != nil {
+			value := strings.TrimSpace(m[2])
+			switch {
+			case value == "[]":
+				schema.Properties[m[1]] = &APISchema{Type: "array", Items: &APISchema{Type: "string"}}
+			case value == "{}":
+				schema.Properties[m[1]] = &APISchema{Type: "object"}
+			case strings.HasPrefix(value, "[[") || strings.HasPrefix(value, "[ ["):
+				inner, _ := callArguments(value, strings.IndexByte(value[1:], '[')+1)
+				schema.Properties[m[1]] = &APISchema{Type: "array", Items: railsPermitSchema(inner)}
+			case strings.HasPrefix(value, "["):
+				inner, _ := callArguments(value, 0)
+				schema.Properties[m[1]] = railsPermitSchema(inner)
+			}
+			continue
+		}
+		if name := unquoteLiteral(arg); name != "" {
+			schema.Properties[name] = &APISchema{}
+		}
+	}
+	if len(schema.Properties) == 0 {
+		schema.Properties = nil
+	}
+	return schema
+}
+
+// railsValueSchema render json: に渡した値のスキーマ（ハッシュのリテラルはキーを拾う）
+func railsValueSchema(v string) *APISchema {
+	v = strings.TrimSpace(v)
+	if strings.HasPrefix(v, "{") {
+		inner, _ := callArguments(v, 0)
+		schema := &APISchema{Type: "object", Properties: make(map[string]*APISchema)}
+		for _, item := range splitCallArgs(inner) {
+			if m := railsHashRe.FindStringSubmatch(item); m != nil {
+				schema.Properties[m[1]] = railsValueSchema(m[2])
+			}
+		}
+		return schema
+	}
+	switch {
+	case strings.HasPrefix(v, "["), strings.HasSuffix(v, ".all"), strings.Contains(v, ".where("):
+		return &APISchema{Type: "array", Items: &APISchema{}}
+	case strings.HasPrefix(v, `"`), strings.HasPrefix(v, "'"):
+		return &APISchema{Type: "string"}
+	case v == "true" || v == "false":
+		return &APISchema{Type: "boolean"}
+	case isPyNumber(v):
+		return &APISchema{Type: "number"}
+	}
+	return &APISchema{}
+}
+
+func railsHasPathParam(ep *APIEndpoint, name string) bool {
+	for _, p := range ep.Parameters {
+		if p.In == "path" && p.Name == name {
+			return true
+		}
+	}
+	return strings.Contains(ep.Path, "{"+name+"}")
+}
+
+func sortedSchemaKeys(m map[string]*APISchema) []string {
+	keys := make(map[string]bool, len(m))
+	for k := range m {
+		keys[k] = true
+	}
+	return sortedKeys(keys)
+}
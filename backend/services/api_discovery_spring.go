@@ -0,0 +1,600 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+var (
+	springKotlinFunRe    = regexp.MustCompile(`\bfun\s+(?:<[^>]*>\s*)?(\w+)\s*\(`)
+	springRecordRe       = regexp.MustCompile(`\brecord\s+(\w+)\s*(?:<[^>]*>)?\s*\(`)
+	springStatusRe       = regexp.MustCompile(`\bHttpStatus\.(\w+)`)
+	springEntityCallRe   = regexp.MustCompile(`\bResponseEntity\s*\.\s*(ok|created|accepted|noContent|notFound|badRequest|unprocessableEntity|internalServerError)\s*\(`)
+	springExceptionRe    = regexp.MustCompile(`\bResponseStatusException\s*\(\s*HttpStatus\.(\w+)`)
+	springReturnTypeRe   = regexp.MustCompile(`\)\s*:\s*([^=]+?)\s*(?:=|$)`)
+	springEntityStatuses = map[string]string{
+		"ok": "200", "created": "201", "accepted": "202", "noContent": "204", "notFound": "404",
+		"badRequest": "400", "unprocessableEntity": "422", "internalServerError": "500",
+	}
+)
+
+// springMappings Spring MVC・WebFlux のリクエストマッピングのアノテーション
+var springMappings = map[string]string{
+	"GetMapping": "get", "PostMapping": "post", "PutMapping": "put", "DeleteMapping": "delete",
+	"PatchMapping": "patch", "RequestMapping": "",
+}
+
+// springScalarTypes Java・Kotlin の型の JSON Schema
+var springScalarTypes = map[string]APISchema{
+	"String": {Type: "string"}, "CharSequence": {Type: "string"}, "char": {Type: "string"}, "Character": {Type: "string"}, "Char": {Type: "string"},
+	"int": {Type: "integer", Format: "int32"}, "Integer": {Type: "integer", Format: "int32"}, "Int": {Type: "integer", Format: "int32"},
+	"short": {Type: "integer"}, "Short": {Type: "integer"}, "byte": {Type: "integer"}, "Byte": {Type: "integer"},
+	"long": {Type: "integer", Format: "int64"}, "Long": {Type: "integer", Format: "int64"}, "BigInteger": {Type: "integer"},
+	"double": {Type: "number", Format: "double"}, "Double": {Type: "number", Format: "double"},
+	"float": {Type: "number", Format: "float"}, "Float": {Type: "number", Format: "float"}, "BigDecimal": {Type: "number"},
+	"boolean": {Type: "boolean"}, "Boolean": {Type: "boolean"},
+	"LocalDate": {Type: "string", Format: "date"}, "LocalTime": {Type: "string", Format: "time"},
+	"LocalDateTime": {Type: "string", Format: "date-time"}, "Instant": {Type: "string", Format: "date-time"},
+	"OffsetDateTime": {Type: "string", Format: "date-time"}, "ZonedDateTime": {Type: "string", Format: "date-time"},
+	"Date": {Type: "string", Format: "date-time"}, "Timestamp": {Type: "string", Format: "date-time"},
+	"UUID": {Type: "string", Format: "uuid"}, "URI": {Type: "string", Format: "uri"}, "URL": {Type: "string", Format: "uri"},
+	"byte[]": {Type: "string", Format: "binary"}, "ByteArray": {Type: "string", Format: "binary"},
+	"Resource": {Type: "string", Format: "binary"}, "MultipartFile": {Type: "string", Format: "binary"},
+	"FilePart": {Type: "string", Format: "binary"}, "InputStreamResource": {Type: "string", Format: "binary"},
+	"Object": {}, "Any": {}, "JsonNode": {}, "ObjectNode": {},
+}
+
+// springWrapperTypes 中身の型をそのまま返す型
+var springWrapperTypes = map[string]bool{
+	"ResponseEntity": true, "HttpEntity": true, "Optional": true, "Mono": true, "CompletableFuture": true,
+	"CompletionStage": true, "Callable": true, "DeferredResult": true, "WebAsyncTask": true, "EntityModel": true,
+}
+
+// springCollectionTypes 配列になる型
+var springCollectionTypes = map[string]bool{
+	"List": true, "Set": true, "Collection": true, "Iterable": true, "Flux": true, "Page": true, "Slice": true,
+	"MutableList": true, "MutableSet": true, "Sequence": true, "Array": true, "CollectionModel": true, "Stream": true,
+}
+
+// springSkippedParams リクエストのパラメータにならない引数の型
+var springSkippedParams = map[string]bool{
+	"HttpServletRequest": true, "HttpServletResponse": true, "ServerHttpRequest": true, "ServerHttpResponse": true,
+	"Principal": true, "Authentication": true, "Model": true, "ModelMap": true, "BindingResult": true, "Errors": true,
+	"Locale": true, "HttpHeaders": true, "WebRequest": true, "ServerWebExchange": true, "UriComponentsBuilder": true,
+	"HttpSession": true, "RedirectAttributes": true, "SessionStatus": true, "Continuation": true,
+}
+
+// springParser Spring のコントローラーと DTO のクラス
+type springParser struct {
+	c       *apiCollector
+	dto     *jpaParser
+	defined map[string]bool
+}
+
+// discoverSpringRoutes @RestController・@Controller のリクエストマッピングを探す
+func discoverSpringRoutes(c *apiCollector, files []models.File) {
+	p := &springParser{c: c, dto: &jpaParser{classes: make(map[string]*jpaClass), enums: make(map[string]bool), tables: make(map[string]string)}, defined: make(map[string]bool)}
+	type source struct {
+		file *models.File
+		text string
+	}
+	var sources []source
+	for i := range files {
+		file := &files[i]
+		if (file.Language != "java" && file.Language != "kotlin") || file.Content == "" {
+			continue
+		}
+		text := StripComments(file.Language, file.Content)
+		for _, m := range jpaEnumRe.FindAllStringSubmatch(text, -1) {
+			p.dto.enums[m[1]] = true
+		}
+		p.dto.collect(file, text, 0, len(text))
+		p.collectRecords(file, text)
+		if strings.Contains(text, "Controller") {
+			sources = append(sources, source{file: file, text: text})
+		}
+	}
+	for _, src := range sources {
+		p.scanControllers(src.file, src.text, 0, len(src.text))
+	}
+}
+
+// collectRecords Java の record をフィールドを持つクラスとして登録する
+func (p *springParser) collectRecords(file *models.File, text string) {
+	for _, m := range springRecordRe.FindAllStringSubmatchIndex(text, -1) {
+		name := text[m[2]:m[3]]
+		if _, exists := p.dto.classes[name]; exists {
+			continue
+		}
+		params, _ := callArguments(text, m[1]-1)
+		cls := &jpaClass{name: name, annotations: map[string]string{}, file: file, line: lineAt(text, m[0])}
+		for _, param := range splitCallArgs(params) {
+			if member, ok := jpaParseMember(param, cls.line, false); ok {
+				cls.members = append(cls.members, member)
+			}
+		}
+		p.dto.classes[name] = cls
+		p.dto.order = append(p.dto.order, cls)
+	}
+}
+
+// springStripAnnotations 引数・フィールドの先頭のアノテーションを外す
+func springStripAnnotations(s string) (map[string]string, string) {
+	annotations := make(map[string]string)
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		if s[i] == '@' {
+			if name, args, j, ok := jpaAnnotation(s, i); ok {
+				annotations[name] = args
+				i = j
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+		i++
+	}
+	return annotations, strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// scanControllers コントローラーのクラス（入れ子を含む）のメソッドのマッピングを読む
+func (p *springParser) scanControllers(file *models.File, text string, start, end int) {
+	kotlin := file.Language == "kotlin"
+	for _, decl := range jpaScan(text, start, end, kotlin) {
+		m := jpaClassRe.FindStringSubmatch(decl.text)
+		if m == nil || m[1] != "class" || decl.body == "" {
+			continue
+		}
+		_, rest := decl.annotations["RestController"]
+		_, controller := decl.annotations["Controller"]
+		if !rest && !controller {
+			p.scanControllers(file, text, decl.bodyOffset, decl.bodyOffset+len(decl.body))
+			continue
+		}
+		_, classBody := decl.annotations["ResponseBody"]
+		className := m[2]
+		bases := []string{""}
+		if args, ok := decl.annotations["RequestMapping"]; ok {
+			bases = springPaths(args)
+		}
+		for _, member := range jpaScan(text, decl.bodyOffset, decl.bodyOffset+len(decl.body), kotlin) {
+			method, args, ok := springMapping(member.annotations)
+			if !ok {
+				continue
+			}
+			_, methodBody := member.annotations["ResponseBody"]
+			line := lineAt(text, max(member.offset, 0))
+			for _, base := range bases {
+				for _, rel := range springPaths(args) {
+					for _, m := range springMethods(method, args) {
+						ep := &APIEndpoint{
+							Method:    m,
+							RawPath:   joinAPIPath(base, rel),
+							Framework: "spring",
+							Tag:       className,
+							File:      file.Name,
+							Line:      line,
+						}
+						ep.Path = springOpenAPIPath(ep.RawPath)
+						p.inspectMethod(ep, className, member, args, kotlin, rest || classBody || methodBody)
+						p.c.add(ep)
+					}
+				}
+			}
+		}
+	}
+}
+
+// springMapping メソッドのマッピングのアノテーション（メソッド名・引数）
+func springMapping(annotations map[string]string) (string, string, bool) {
+	for name, method := range springMappings {
+		if args, ok := annotations[name]; ok {
+			return method, args, true
+		}
+	}
+	return "", "", false
+}
+
+// springPaths マッピングのパス（value・path・位置引数、配列は展開する）
+func springPaths(args string) []string {
+	positional, kwargs := parseCallArgs(args)
+	value := kwargs["value"]
+	if value == "" {
+		value = kwargs["path"]
+	}
+	if value == "" && len(positional) > 0 {
+		value = positional[0]
+	}
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "{") || strings.HasPrefix(value, "[") {
+		inner, _ := callArguments(value, 0)
+		var paths []string
+		for _, item := range splitCallArgs(inner) {
+			paths = append(paths, unquoteLiteral(item))
+		}
+		if len(paths) > 0 {
+			return paths
+		}
+	}
+	return []string{unquoteLiteral(value)}
+}
+
+// springMethods @RequestMapping(method = ...) のメソッド（指定がなければ全メソッド）
+func springMethods(method, args string) []string {
+	if method != "" {
+		return []string{method}
+	}
+	_, kwargs := parseCallArgs(args)
+	list := strings.Trim(strings.TrimSpace(kwargs["method"]), "{}[]")
+	var methods []string
+	for _, item := range splitCallArgs(list) {
+		methods = append(methods, strings.ToLower(lastPathElement(item)))
+	}
+	if len(methods) == 0 {
+		methods = []string{"any"}
+	}
+	return methods
+}
+
+// springOpenAPIPath {id:\d+} の正規表現・{*path} を外す
+func springOpenAPIPath(p string) string {
+	var sb strings.Builder
+	for i := 0; i < len(p); i++ {
+		if p[i] != '{' {
+			sb.WriteByte(p[i])
+			continue
+		}
+		inner, end := callArguments(p, i)
+		if j := strings.IndexByte(inner, ':'); j >= 0 {
+			inner = inner[:j]
+		}
+		sb.WriteString("{" + strings.TrimPrefix(inner, "*") + "}")
+		i = end - 1
+	}
+	return sb.String()
+}
+
+// inspectMethod メソッドの引数のアノテーション・戻り値の型・本体からパラメータとレスポンスを決める
+func (p *springParser) inspectMethod(ep *APIEndpoint, className string, member jpaDecl, args string, kotlin, responseBody bool) {
+	name, params, returnType := springSignature(member.text, kotlin)
+	ep.Handler = className + "." + name
+	_, mappingArgs := parseCallArgs(args)
+	consumes := springFirstValue(mappingArgs["consumes"])
+	produces := springFirstValue(mappingArgs["produces"])
+
+	for _, param := range splitCallArgs(params) {
+		annotations, rest := springStripAnnotations(param)
+		pname, ptype, hasDefault := springParam(rest, kotlin)
+		if pname == "" {
+			continue
+		}
+		baseType := springBaseType(ptype)
+		if springSkippedParams[baseType] {
+			continue
+		}
+		if _, ok := annotations["AuthenticationPrincipal"]; ok {
+			continue
+		}
+		optional := strings.HasSuffix(ptype, "?") || strings.HasPrefix(ptype, "Optional<") || hasDefault
+		schema := p.typeSchema(ptype)
+		paramName := func(key string) string {
+			positional, kwargs := parseCallArgs(annotations[key])
+			if v := firstNonEmpty(kwargs["value"], kwargs["name"]); v != "" {
+				return unquoteLiteral(v)
+			}
+			if len(positional) > 0 {
+				return unquoteLiteral(positional[0])
+			}
+			return pname
+		}
+		required := func(key string) bool {
+			_, kwargs := parseCallArgs(annotations[key])
+			return !optional && kwargs["required"] != "false" && kwargs["defaultValue"] == ""
+		}
+		switch {
+		case hasKey(annotations, "PathVariable"):
+			ep.param(paramName("PathVariable"), "path", true, schema)
+		case hasKey(annotations, "RequestParam") && baseType != "MultipartFile":
+			ep.param(paramName("RequestParam"), "query", required("RequestParam"), schema)
+		case hasKey(annotations, "RequestHeader"):
+			ep.param(paramName("RequestHeader"), "header", required("RequestHeader"), schema)
+		case hasKey(annotations, "CookieValue"):
+			ep.param(paramName("CookieValue"), "cookie", required("CookieValue"), schema)
+		case hasKey(annotations, "RequestBody"):
+			ep.body(firstNonEmpty(consumes, "application/json"), schema)
+		case hasKey(annotations, "RequestPart") || baseType == "MultipartFile" || baseType == "FilePart":
+			key := "RequestPart"
+			if !hasKey(annotations, key) {
+				key = "RequestParam"
+			}
+			ep.bodyProperty("multipart/form-data", paramName(key), schema)
+		case baseType == "Pageable":
+			ep.param("page", "query", false, &APISchema{Type: "integer"})
+			ep.param("size", "query", false, &APISchema{Type: "integer"})
+			ep.param("sort", "query", false, &APISchema{Type: "array", Items: &APISchema{Type: "string"}})
+		case hasKey(annotations, "ModelAttribute") || !isSpringScalar(baseType):
+			// 単純な型でない引数はクエリ・フォームのパラメータをフィールドに割り当てる
+			if cls, ok := p.dto.classes[baseType]; ok {
+				for _, field := range p.fields(cls, 0) {
+					ep.param(field.name, "query", false, p.typeSchema(field.typ))
+				}
+			}
+		default:
+			ep.param(pname, "query", false, schema)
+		}
+	}
+
+	status := "200"
+	if args, ok := member.annotations["ResponseStatus"]; ok {
+		positional, kwargs := parseCallArgs(args)
+		code := firstNonEmpty(kwargs["value"], kwargs["code"])
+		if code == "" && len(positional) > 0 {
+			code = positional[0]
+		}
+		status = statusString(code)
+	}
+
+	base := springBaseType(returnType)
+	contentType := firstNonEmpty(produces, "application/json")
+	var schema *APISchema
+	switch {
+	case returnType == "" || base == "void" || base == "Void" || base == "Unit":
+		contentType = ""
+	case !responseBody:
+		// @Controller のメソッドはビュー名を返す
+		contentType, schema = "text/html", &APISchema{Type: "string"}
+	case base == "String" && produces == "":
+		contentType, schema = "text/plain", &APISchema{Type: "string"}
+	default:
+		schema = p.typeSchema(returnType)
+		if schema != nil && schema.Format == "binary" && produces == "" {
+			contentType = "application/octet-stream"
+		}
+	}
+	if schema == nil && contentType != "" && contentType != "text/html" {
+		contentType = ""
+	}
+
+	// ResponseEntity.created(...)・HttpStatus.X・ResponseStatusException からステータスを集める
+	var successes []string
+	errors := make(map[string]bool)
+	addStatus := func(code string) {
+		if code == "default" {
+			return
+		}
+		if code < "300" {
+			if !containsString(successes, code) {
+				successes = append(successes, code)
+			}
+		} else {
+			errors[code] = true
+		}
+	}
+	for _, m := range springEntityCallRe.FindAllStringSubmatch(member.body, -1) {
+		addStatus(springEntityStatuses[m[1]])
+	}
+	for _, m := range springStatusRe.FindAllStringSubmatch(member.body, -1) {
+		addStatus(statusString(m[1]))
+	}
+	for _, m := range springExceptionRe.FindAllStringSubmatch(member.body, -1) {
+		addStatus(statusString(m[1]))
+	}
+	if len(successes) == 0 {
+		successes = []string{status}
+	}
+	for _, code := range successes {
+		if code == "204" {
+			ep.respond(code, "", nil)
+			continue
+		}
+		ep.respond(code, contentType, schema)
+	}
+	for _, code := range sortedKeys(errors) {
+		ep.respond(code, "", nil)
+	}
+}
+
+func hasKey(m map[string]string, key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+// springFirstValue produces・consumes の最初の値（MediaType.APPLICATION_JSON_VALUE などの定数も受け付ける）
+func springFirstValue(v string) string {
+	v = strings.Trim(strings.TrimSpace(v), "{}[]")
+	if v == "" {
+		return ""
+	}
+	first := strings.TrimSpace(splitCallArgs(v)[0])
+	if strings.HasPrefix(first, "\"") {
+		return unquoteLiteral(first)
+	}
+	constant := strings.TrimSuffix(lastPathElement(first), "_VALUE")
+	return strings.ToLower(strings.Replace(strings.ReplaceAll(constant, "_", "-"), "-", "/", 1))
+}
+
+// springSignature メソッドの宣言から名前・引数・戻り値の型を取り出す
+func springSignature(text string, kotlin bool) (string, string, string) {
+	if kotlin {
+		m := springKotlinFunRe.FindStringSubmatchIndex(text)
+		if m == nil {
+			return "", "", ""
+		}
+		params, end := callArguments(text, m[1]-1)
+		returnType := ""
+		if rm := springReturnTypeRe.FindStringSubmatch(text[end-1:]); rm != nil {
+			returnType = strings.TrimSpace(rm[1])
+		} else if strings.Contains(text[end:], "=") {
+			returnType = "Any"
+		}
+		return text[m[2]:m[3]], params, returnType
+	}
+	open := strings.IndexByte(text, '(')
+	if open < 0 {
+		return "", "", ""
+	}
+	params, _ := callArguments(text, open)
+	head := strings.TrimSpace(jpaModifierRe.ReplaceAllString(text[:open], ""))
+	head = strings.TrimSpace(strings.TrimPrefix(head, "static "))
+	i := strings.LastIndexAny(head, " >")
+	if i < 0 {
+		return head, params, ""
+	}
+	returnType := strings.TrimSpace(head[:i+1])
+	// <T> ResponseEntity<T> のような型引数の宣言を外す
+	if strings.HasPrefix(returnType, "<") {
+		returnType = strings.TrimSpace(skipBalanced(returnType, '<', '>'))
+	}
+	return strings.TrimSpace(head[i+1:]), params, returnType
+}
+
+// springParam 引数の名前・型・既定値の有無（Java は「型 名前」、Kotlin は「名前: 型 = 既定値」）
+func springParam(text string, kotlin bool) (string, string, bool) {
+	text = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), "final "))
+	if kotlin {
+		i := strings.IndexByte(text, ':')
+		if i < 0 {
+			return "", "", false
+		}
+		typ, hasDefault := text[i+1:], false
+		if j := topLevelIndex(typ, '='); j >= 0 {
+			typ, hasDefault = typ[:j], true
+		}
+		return strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(text[:i], "val "), "var ")), strings.TrimSpace(typ), hasDefault
+	}
+	fields := strings.Fields(text)
+	if len(fields) < 2 {
+		return "", "", false
+	}
+	return fields[len(fields)-1], strings.Join(fields[:len(fields)-1], ""), false
+}
+
+// springBaseType 型引数・null 許容・パッケージを外した型名
+func springBaseType(t string) string {
+	t = strings.TrimSuffix(strings.TrimSpace(t), "?")
+	if i := strings.IndexByte(t, '<'); i >= 0 {
+		t = t[:i]
+	}
+	return lastPathElement(strings.TrimSpace(t))
+}
+
+func isSpringScalar(t string) bool {
+	_, ok := springScalarTypes[t]
+	return ok || strings.HasSuffix(t, "[]")
+}
+
+// springTypeArgs List<A, B> の A・B
+func springTypeArgs(t string) []string {
+	t = strings.TrimSuffix(strings.TrimSpace(t), "?")
+	i := strings.IndexByte(t, '<')
+	if i < 0 || !strings.HasSuffix(t, ">") {
+		return nil
+	}
+	var args []string
+	depth, start := 0, i+1
+	for j := i + 1; j < len(t)-1; j++ {
+		switch t[j] {
+		case '<':
+			depth++
+		case '>':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(t[start:j]))
+				start = j + 1
+			}
+		}
+	}
+	args = append(args, strings.TrimSpace(t[start:len(t)-1]))
+	return args
+}
+
+// typeSchema Java・Kotlin の型のスキーマ。プロジェクトの DTO は components に登録して参照する
+func (p *springParser) typeSchema(t string) *APISchema {
+	t = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(t), "out "), "in "))
+	t = strings.TrimSuffix(t, "?")
+	if strings.HasSuffix(t, "[]") && t != "byte[]" {
+		return &APISchema{Type: "array", Items: p.typeSchema(strings.TrimSuffix(t, "[]"))}
+	}
+	base := springBaseType(t)
+	args := springTypeArgs(t)
+	switch {
+	case springWrapperTypes[base]:
+		if len(args) > 0 && args[0] != "?" && args[0] != "*" {
+			return p.typeSchema(args[0])
+		}
+		return &APISchema{}
+	case springCollectionTypes[base]:
+		items := &APISchema{}
+		if len(args) > 0 {
+			items = p.typeSchema(args[0])
+		}
+		return &APISchema{Type: "array", Items: items}
+	case base == "Map" || base == "HashMap" || base == "MutableMap" || base == "LinkedHashMap":
+		schema := &APISchema{Type: "object"}
+		if len(args) == 2 {
+			schema.AdditionalProperties = p.typeSchema(args[1])
+		}
+		return schema
+	}
+	if schema, ok := springScalarTypes[base]; ok {
+		copied := schema
+		return &copied
+	}
+	if p.dto.enums[base] {
+		return &APISchema{Type: "string"}
+	}
+	cls, ok := p.dto.classes[base]
+	if !ok {
+		return &APISchema{}
+	}
+	if p.defined[base] {
+		return apiRef(base)
+	}
+	p.defined[base] = true
+	p.c.schemas[base] = &APISchema{Type: "object"}
+	schema := &APISchema{Type: "object", Properties: make(map[string]*APISchema)}
+	for _, field := range p.fields(cls, 0) {
+		name := field.name
+		if args, ok := field.annotations["JsonProperty"]; ok {
+			positional, kwargs := parseCallArgs(args)
+			if v := firstNonEmpty(kwargs["value"], func() string {
+				if len(positional) > 0 {
+					return positional[0]
+				}
+				return ""
+			}()); v != "" {
+				name = unquoteLiteral(v)
+			}
+		}
+		schema.Properties[name] = p.typeSchema(field.typ)
+		required := hasKey(field.annotations, "NotNull") || hasKey(field.annotations, "NotBlank") ||
+			hasKey(field.annotations, "NotEmpty") || hasKey(field.annotations, "NonNull")
+		if cls.file.Language == "kotlin" && !strings.HasSuffix(field.typ, "?") {
+			required = true
+		}
+		if required && !containsString(schema.Required, name) {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	if len(schema.Properties) == 0 {
+		schema.Properties = nil
+	}
+	return p.c.define(base, schema)
+}
+
+// fields DTO のフィールド（基底クラスのものを含む。static・@JsonIgnore は除く）
+func (p *springParser) fields(cls *jpaClass, depth int) []jpaMember {
+	var fields []jpaMember
+	if base, ok := p.dto.classes[cls.base]; ok && depth < 10 && base != cls {
+		fields = append(fields, p.fields(base, depth+1)...)
+	}
+	for _, member := range cls.members {
+		if member.static || hasKey(member.annotations, "JsonIgnore") || hasKey(member.annotations, "Transient") {
+			continue
+		}
+		fields = append(fields, member)
+	}
+	return fields
+}
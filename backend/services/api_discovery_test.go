@@ -0,0 +1,362 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"reverse-engineering-backend/models"
+)
+
+// apiRoutes ルートを "メソッド パス フレームワーク ハンドラー" の形で並べる
+func apiRoutes(d *APIDiscovery) []string {
+	var routes []string
+	for _, ep := range d.Endpoints {
+		routes = append(routes, strings.TrimSpace(ep.Method+" "+ep.Path+" "+ep.Framework+" "+ep.Handler))
+	}
+	return routes
+}
+
+// apiEndpoint メソッドとパスが一致するルート
+func apiEndpoint(t *testing.T, d *APIDiscovery, method, path string) *APIEndpoint {
+	t.Helper()
+	for _, ep := range d.Endpoints {
+		if ep.Method == method && ep.Path == path {
+			return ep
+		}
+	}
+	t.Fatalf("%s %s not found in %q", method, path, apiRoutes(d))
+	return nil
+}
+
+func TestDiscoverAPIGo(t *testing.T) {
+	files := []models.File{
+		{Name: "main.go", Language: "go", Content: `package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateUser struct {
+	Name  string ` + "`json:\"name\" binding:\"required\"`" + `
+	Email string ` + "`json:\"email\"`" + `
+}
+
+type User struct {
+	ID   int    ` + "`json:\"id\"`" + `
+	Name string ` + "`json:\"name\"`" + `
+}
+
+func main() {
+	r := gin.Default()
+	api := r.Group("/api/v1")
+	registerUsers(api.Group("/users"))
+	http.HandleFunc("/healthz", health)
+	r.Run()
+}
+
+func registerUsers(g *gin.RouterGroup) {
+	g.GET("/:id", getUser)
+	g.POST("", createUser)
+}
+
+func getUser(c *gin.Context) {
+	id := c.Param("id")
+	verbose := c.Query("verbose")
+	_, _ = id, verbose
+	c.JSON(http.StatusOK, User{})
+}
+
+func createUser(c *gin.Context) {
+	var req CreateUser
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, User{})
+}
+
+func health(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+`},
+	}
+	d := DiscoverAPI(files)
+	want := []string{
+		"post /api/v1/users gin main.createUser",
+		"get /api/v1/users/{id} gin main.getUser",
+		"get /healthz net/http main.health",
+	}
+	if got := apiRoutes(d); !reflect.DeepEqual(got, want) {
+		t.Fatalf("routes = %q, want %q", got, want)
+	}
+
+	get := apiEndpoint(t, d, "get", "/api/v1/users/{id}")
+	if get.RawPath != "/api/v1/users/:id" || get.File != "main.go" || get.Line != 28 {
+		t.Errorf("get = %+v", get)
+	}
+	wantParams := []APIParameter{
+		{Name: "id", In: "path", Required: true, Schema: &APISchema{Type: "string"}},
+		{Name: "verbose", In: "query", Schema: &APISchema{Type: "string"}},
+	}
+	if !reflect.DeepEqual(get.Parameters, wantParams) {
+		t.Errorf("parameters = %+v", get.Parameters)
+	}
+
+	// バインドする構造体とレスポンスの構造体は components に登録して参照する
+	post := apiEndpoint(t, d, "post", "/api/v1/users")
+	if post.RequestBody == nil || post.RequestBody.ContentType != "application/json" || post.RequestBody.Schema.Ref != "#/components/schemas/CreateUser" {
+		t.Errorf("request body = %+v", post.RequestBody)
+	}
+	var statuses []string
+	for _, r := range post.Responses {
+		statuses = append(statuses, r.Status)
+	}
+	if !reflect.DeepEqual(statuses, []string{"400", "201"}) || post.Responses[1].Schema.Ref != "#/components/schemas/User" {
+		t.Errorf("responses = %+v", post.Responses)
+	}
+	if s := d.Schemas["CreateUser"]; s == nil || !reflect.DeepEqual(s.Required, []string{"name"}) || s.Properties["email"].Type != "string" {
+		t.Errorf("CreateUser = %+v", s)
+	}
+
+	// 早期リターンの分岐の WriteHeader は後の書き込みのステータスにしない
+	health := apiEndpoint(t, d, "get", "/healthz")
+	wantResponses := []APIResponse{{Status: "405"}, {Status: "200", ContentType: "text/plain", Schema: &APISchema{Type: "string"}}}
+	if !reflect.DeepEqual(health.Responses, wantResponses) {
+		t.Errorf("health responses = %+v", health.Responses)
+	}
+}
+
+func TestDiscoverAPI(t *testing.T) {
+	files := []models.File{
+		{Name: "server/app.js", Language: "javascript", Content: `const express = require('express');
+const items = require('./routes/items');
+const app = express();
+app.use('/api/items', items);
+app.get('/', (req, res) => res.send('hello'));
+app.listen(3000);
+`},
+		{Name: "server/routes/items.js", Language: "javascript", Content: `const router = require('express').Router();
+
+router.get('/:id', (req, res) => {
+  const { fields } = req.query;
+  res.json({ id: req.params.id, name: 'x' });
+});
+
+router.post('/', async (req, res) => {
+  const { name, price } = req.body;
+  res.status(201).json({ id: 1 });
+});
+
+module.exports = router;
+`},
+		{Name: "app.py", Language: "python", Content: `from flask import Flask, request, jsonify
+from fastapi import APIRouter
+from pydantic import BaseModel
+
+app = Flask(__name__)
+
+@app.route("/login", methods=["POST"])
+def login():
+    user = request.form["user"]
+    return jsonify(ok=True), 200
+
+router = APIRouter(prefix="/orders")
+
+class Order(BaseModel):
+    item: str
+    qty: int = 1
+
+@router.post("/", status_code=201)
+async def create_order(order: Order):
+    return order
+
+@router.get("/{order_id}")
+async def read_order(order_id: int, expand: bool = False):
+    return {}
+`},
+		{Name: "src/UserController.java", Language: "java", Content: `package demo;
+
+@RestController
+@RequestMapping("/users")
+public class UserController {
+    @GetMapping("/{id}")
+    public User get(@PathVariable Long id, @RequestParam(required = false) String fields) {
+        return null;
+    }
+
+    @PostMapping
+    @ResponseStatus(HttpStatus.CREATED)
+    public User create(@RequestBody User user) {
+        return user;
+    }
+}
+`},
+		{Name: "config/routes.rb", Language: "ruby", Content: `Rails.application.routes.draw do
+  namespace :admin do
+    resources :reports, only: [:index, :show]
+  end
+  get "status", to: "health#show"
+end
+`},
+	}
+	d := DiscoverAPI(files)
+	want := []string{
+		"get / express",
+		"get /admin/reports rails admin/reports#index",
+		"get /admin/reports/{id} rails admin/reports#show",
+		"post /api/items/ express",
+		"get /api/items/{id} express",
+		"post /login flask login",
+		"post /orders/ fastapi create_order",
+		"get /orders/{order_id} fastapi read_order",
+		"get /status rails health#show",
+		"post /users spring UserController.create",
+		"get /users/{id} spring UserController.get",
+	}
+	if got := apiRoutes(d); !reflect.DeepEqual(got, want) {
+		t.Fatalf("routes = %q, want %q", got, want)
+	}
+
+	// 別ファイルの Router をマウントしたパスで登録する
+	items := apiEndpoint(t, d, "post", "/api/items/")
+	if items.File != "server/routes/items.js" || items.RequestBody == nil || !reflect.DeepEqual(sortedKeys(items.RequestBody.Schema.Properties), []string{"name", "price"}) ||
+		len(items.Responses) != 1 || items.Responses[0].Status != "201" {
+		t.Errorf("express post = %+v", items)
+	}
+	if login := apiEndpoint(t, d, "post", "/login"); login.RequestBody == nil || login.RequestBody.ContentType != "application/x-www-form-urlencoded" {
+		t.Errorf("flask login = %+v", login)
+	}
+	// FastAPI は型ヒントからパラメータとボディの型を決める
+	read := apiEndpoint(t, d, "get", "/orders/{order_id}")
+	if len(read.Parameters) != 2 || read.Parameters[0].Schema.Type != "integer" || read.Parameters[1].Name != "expand" || read.Parameters[1].Schema.Type != "boolean" {
+		t.Errorf("fastapi parameters = %+v", read.Parameters)
+	}
+	if s := d.Schemas["Order"]; s == nil || !reflect.DeepEqual(s.Required, []string{"item"}) {
+		t.Errorf("Order = %+v", s)
+	}
+	spring := apiEndpoint(t, d, "get", "/users/{id}")
+	if spring.Parameters[0].Schema.Format != "int64" || spring.Parameters[1].In != "query" || spring.Parameters[1].Required {
+		t.Errorf("spring parameters = %+v", spring.Parameters)
+	}
+	if create := apiEndpoint(t, d, "post", "/users"); create.Responses[0].Status != "201" {
+		t.Errorf("spring create responses = %+v", create.Responses)
+	}
+}
+
+func TestAPIDiscoveryOpenAPI(t *testing.T) {
+	d := &APIDiscovery{
+		Endpoints: []*APIEndpoint{
+			{Method: "get", Path: "/items/{id}", Framework: "gin", Handler: "main.get", Tag: "items", File: "main.go", Line: 3,
+				Parameters: []APIParameter{{Name: "id", In: "path", Required: true}},
+				Responses:  []APIResponse{{Status: "200", ContentType: "application/json", Schema: apiRef("Item")}}},
+			// 同じメソッド・パスは最初のものを使う
+			{Method: "get", Path: "/items/{id}", Framework: "gin", Handler: "main.other", File: "other.go"},
+			{Method: "any", Path: "/hook", Framework: "net/http", Handler: "main.get", File: "hook.go"},
+			{Method: "post", Path: "/raw", Framework: "express", File: "app.js", RequestBody: &APIRequestBody{ContentType: "text/plain"}},
+		},
+		Schemas: map[string]*APISchema{"Item": {Type: "object"}},
+	}
+	doc := d.OpenAPI("demo")
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Title string `json:"title"`
+		} `json:"info"`
+		Paths map[string]map[string]struct {
+			OperationID string                     `json:"operationId"`
+			Source      string                     `json:"x-source"`
+			AnyMethod   bool                       `json:"x-any-method"`
+			Tags        []string                   `json:"tags"`
+			Parameters  []map[string]interface{}   `json:"parameters"`
+			RequestBody map[string]interface{}     `json:"requestBody"`
+			Responses   map[string]json.RawMessage `json:"responses"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]APISchema `json:"schemas"`
+		} `json:"components"`
+		Tags []map[string]string `json:"tags"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.OpenAPI != "3.1.0" || got.Info.Title != "demo" || len(got.Paths) != 3 || got.Components.Schemas["Item"].Type != "object" {
+		t.Errorf("document = %s", data)
+	}
+	item := got.Paths["/items/{id}"]["get"]
+	if item.OperationID != "main_get" || item.Source != "main.go:3" || !reflect.DeepEqual(item.Tags, []string{"items"}) || len(item.Parameters) != 1 {
+		t.Errorf("GET /items/{id} = %+v", item)
+	}
+	if !strings.Contains(string(item.Responses["200"]), `"$ref":"#/components/schemas/Item"`) {
+		t.Errorf("responses = %s", item.Responses["200"])
+	}
+	// メソッドを限定しないルートは get として出力し、operationId の重複には番号を付ける
+	hook := got.Paths["/hook"]["get"]
+	if hook.OperationID != "main_get_2" || !hook.AnyMethod || hook.Source != "hook.go" {
+		t.Errorf("/hook = %+v", hook)
+	}
+	raw := got.Paths["/raw"]["post"]
+	if raw.OperationID != "post_raw" || raw.RequestBody["required"] != true || raw.Responses["default"] == nil {
+		t.Errorf("/raw = %+v", raw)
+	}
+	if !reflect.DeepEqual(got.Tags, []map[string]string{{"name": "items"}}) {
+		t.Errorf("tags = %v", got.Tags)
+	}
+}
+
+func TestHTTPStatusCode(t *testing.T) {
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"404", 404},
+		{"http.StatusNotFound", 404},
+		{"HttpStatus.NOT_FOUND", 404},
+		{":unprocessable_entity", 422},
+		{"status.HTTP_201_CREATED", 201},
+		{"HTTPStatus::TEAPOT", 418},
+		{"Status::TooManyRequests", 429},
+		{"999", 0},
+		{"somethingElse", 0},
+	}
+	for _, tt := range tests {
+		if got, _ := httpStatusCode(tt.name); got != tt.want {
+			t.Errorf("httpStatusCode(%q) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAPIPaths(t *testing.T) {
+	for _, tt := range []struct{ prefix, rel, want string }{
+		{"", "", "/"},
+		{"/api", "", "/api"},
+		{"/api/", "/users/", "/api/users/"},
+		{"api", "users", "/api/users"},
+		{"/", "/", "/"},
+	} {
+		if got := joinAPIPath(tt.prefix, tt.rel); got != tt.want {
+			t.Errorf("joinAPIPath(%q, %q) = %q, want %q", tt.prefix, tt.rel, got, tt.want)
+		}
+	}
+	for raw, want := range map[string]string{
+		"/users/:id":              "/users/{id}",
+		"/files/*path":            "/files/{path}",
+		"/posts/:id(\\d+)/:slug?": "/posts/{id}/{slug}",
+		"/plain":                  "/plain",
+	} {
+		if got := colonPathToOpenAPI(raw); got != want {
+			t.Errorf("colonPathToOpenAPI(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
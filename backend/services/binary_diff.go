@@ -0,0 +1,289 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BinaryFunctionRef 差分結果に載せる関数の概要
+type BinaryFunctionRef struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Size    int    `json:"size"`
+	Blocks  int    `json:"blocks"`
+}
+
+// BinaryFunctionChange 対応付けられたが内容が変わった関数
+type BinaryFunctionChange struct {
+	Old        BinaryFunctionRef `json:"old"`
+	New        BinaryFunctionRef `json:"new"`
+	Similarity float64           `json:"similarity"`
+	MatchedBy  string            `json:"matched_by"` // symbol, instruction_hash, cfg_shape, similarity
+}
+
+// BinaryDiffSide 比較した片方のバイナリ
+type BinaryDiffSide struct {
+	FileID    uint   `json:"file_id"`
+	Name      string `json:"name"`
+	Format    string `json:"format"`
+	Arch      string `json:"arch"`
+	Stripped  bool   `json:"stripped"`
+	Functions int    `json:"functions"`
+}
+
+// BinaryDiffSummary 差分の件数
+type BinaryDiffSummary struct {
+	Matched    int     `json:"matched"`
+	Identical  int     `json:"identical"`
+	Changed    int     `json:"changed"`
+	Added      int     `json:"added"`
+	Removed    int     `json:"removed"`
+	Similarity float64 `json:"similarity"`
+}
+
+// BinaryDiffResult 2つのバイナリの関数単位の差分
+type BinaryDiffResult struct {
+	Old         BinaryDiffSide         `json:"old"`
+	New         BinaryDiffSide         `json:"new"`
+	Summary     BinaryDiffSummary      `json:"summary"`
+	Changed     []BinaryFunctionChange `json:"changed"`
+	Added       []BinaryFunctionRef    `json:"added"`
+	Removed     []BinaryFunctionRef    `json:"removed"`
+	Notes       []string               `json:"notes,omitempty"`
+	Explanation string                 `json:"explanation,omitempty"`
+}
+
+// 類似度による対応付けの閾値と、総当たりで比較する組み合わせ数の上限
+const (
+	binaryMatchThreshold = 0.6
+	maxSimilarityPairs   = 4000000
+)
+
+// DiffBinaryImages 関数をシンボル名・命令ハッシュ・CFG形状・類似度の順に対応付け、追加・削除・変更を求める
+// 変更なしとするのはバイト列が一致する関数と、関数の外への分岐・呼び出しの飛び先（再配置でずれる部分）だけが違う関数
+// 命令ハッシュはオペランドを含まないので対応付けにだけ使い、オペランドだけが違う関数は変更として報告する
+func DiffBinaryImages(oldImg, newImg *BinaryImage) BinaryDiffResult {
+	result := BinaryDiffResult{
+		Old:     BinaryDiffSide{Format: oldImg.Format, Arch: oldImg.Arch, Stripped: oldImg.Stripped, Functions: len(oldImg.Functions)},
+		New:     BinaryDiffSide{Format: newImg.Format, Arch: newImg.Arch, Stripped: newImg.Stripped, Functions: len(newImg.Functions)},
+		Changed: []BinaryFunctionChange{},
+		Added:   []BinaryFunctionRef{},
+		Removed: []BinaryFunctionRef{},
+	}
+	if oldImg.Arch != newImg.Arch {
+		result.Notes = append(result.Notes, fmt.Sprintf("architectures differ (%s vs %s); only symbol matching is meaningful", oldImg.Arch, newImg.Arch))
+	}
+
+	oldFns, newFns := oldImg.Functions, newImg.Functions
+	matchOld := make([]int, len(oldFns))
+	matchNew := make([]int, len(newFns))
+	matchedBy := make([]string, len(oldFns))
+	for i := range matchOld {
+		matchOld[i] = -1
+	}
+	for i := range matchNew {
+		matchNew[i] = -1
+	}
+	link := func(o, n int, by string) {
+		matchOld[o], matchNew[n], matchedBy[o] = n, o, by
+	}
+
+	// 1. シンボル名（重複しない名前のみ）
+	oldByName := uniqueFunctionIndex(oldFns, func(fn *BinaryFunction) (string, bool) { return fn.Name, fn.Named })
+	newByName := uniqueFunctionIndex(newFns, func(fn *BinaryFunction) (string, bool) { return fn.Name, fn.Named })
+	for name, o := range oldByName {
+		if n, ok := newByName[name]; ok {
+			link(o, n, "symbol")
+		}
+	}
+
+	// 2. 命令ハッシュ、3. CFG形状（ブロック数3以上）が未対応の関数の中で一意に一致するもの
+	keyed := []struct {
+		by  string
+		key func(fn *BinaryFunction) (string, bool)
+	}{
+		{"instruction_hash", func(fn *BinaryFunction) (string, bool) {
+			return fmt.Sprintf("%x", fn.OpHash), len(fn.Insns) >= 4
+		}},
+		{"cfg_shape", func(fn *BinaryFunction) (string, bool) {
+			return fmt.Sprintf("%x:%d", fn.ShapeHash, len(fn.Insns)/8), fn.Blocks >= 3
+		}},
+	}
+	for _, stage := range keyed {
+		oldIdx := uniqueFunctionIndex(oldFns, stage.key)
+		newIdx := uniqueFunctionIndex(newFns, stage.key)
+		for k, o := range oldIdx {
+			if n, ok := newIdx[k]; ok && matchOld[o] < 0 && matchNew[n] < 0 {
+				link(o, n, stage.by)
+			}
+		}
+	}
+
+	// 4. 残りを類似度の高い順に貪欲に対応付ける
+	var remOld, remNew []int
+	for i := range oldFns {
+		if matchOld[i] < 0 {
+			remOld = append(remOld, i)
+		}
+	}
+	for i := range newFns {
+		if matchNew[i] < 0 {
+			remNew = append(remNew, i)
+		}
+	}
+	if len(remOld)*len(remNew) > maxSimilarityPairs {
+		result.Notes = append(result.Notes, fmt.Sprintf("similarity matching skipped: %d x %d unmatched functions", len(remOld), len(remNew)))
+	} else {
+		type candidate struct {
+			o, n  int
+			score float64
+		}
+		var candidates []candidate
+		for _, o := range remOld {
+			for _, n := range remNew {
+				a, b := &oldFns[o], &newFns[n]
+				if ratio(len(a.Bytes), len(b.Bytes)) < 0.5 {
+					continue
+				}
+				if s := FunctionSimilarity(a, b); s >= binaryMatchThreshold {
+					candidates = append(candidates, candidate{o, n, s})
+				}
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+		for _, c := range candidates {
+			if matchOld[c.o] < 0 && matchNew[c.n] < 0 {
+				link(c.o, c.n, "similarity")
+			}
+		}
+	}
+
+	// 結果の集計
+	var totalSize, weighted float64
+	for i := range oldFns {
+		totalSize += float64(len(oldFns[i].Bytes))
+	}
+	for i := range newFns {
+		totalSize += float64(len(newFns[i].Bytes))
+	}
+	for o, n := range matchOld {
+		if n < 0 {
+			result.Removed = append(result.Removed, binaryFunctionRef(&oldFns[o]))
+			continue
+		}
+		a, b := &oldFns[o], &newFns[n]
+		result.Summary.Matched++
+		score := FunctionSimilarity(a, b)
+		weighted += score * float64(len(a.Bytes)+len(b.Bytes))
+		if a.ByteHash == b.ByteHash || a.RelocHash == b.RelocHash {
+			result.Summary.Identical++
+			continue
+		}
+		result.Changed = append(result.Changed, BinaryFunctionChange{
+			Old:        binaryFunctionRef(a),
+			New:        binaryFunctionRef(b),
+			Similarity: roundScore(score),
+			MatchedBy:  matchedBy[o],
+		})
+	}
+	for n, o := range matchNew {
+		if o < 0 {
+			result.Added = append(result.Added, binaryFunctionRef(&newFns[n]))
+		}
+	}
+	sort.SliceStable(result.Changed, func(i, j int) bool { return result.Changed[i].Similarity < result.Changed[j].Similarity })
+
+	result.Summary.Changed = len(result.Changed)
+	result.Summary.Added = len(result.Added)
+	result.Summary.Removed = len(result.Removed)
+	if totalSize > 0 {
+		result.Summary.Similarity = roundScore(weighted / totalSize)
+	}
+	return result
+}
+
+// FunctionSimilarity 命令2-gramの重み付きJaccard・CFGの規模・サイズから 0〜1 の類似度を求める
+func FunctionSimilarity(a, b *BinaryFunction) float64 {
+	if a.ByteHash == b.ByteHash {
+		return 1
+	}
+	var inter, union int
+	for k, ca := range a.OpBag {
+		cb := b.OpBag[k]
+		if ca < cb {
+			inter += ca
+			union += cb
+		} else {
+			inter += cb
+			union += ca
+		}
+	}
+	for k, cb := range b.OpBag {
+		if _, ok := a.OpBag[k]; !ok {
+			union += cb
+		}
+	}
+	bagSim := 1.0
+	if union > 0 {
+		bagSim = float64(inter) / float64(union)
+	}
+
+	cfgSim := (ratio(a.Blocks, b.Blocks) + ratio(a.Edges, b.Edges)) / 2
+	if a.ShapeHash == b.ShapeHash {
+		cfgSim = 1
+	}
+	return 0.6*bagSim + 0.3*cfgSim + 0.1*ratio(len(a.Bytes), len(b.Bytes))
+}
+
+func ratio(a, b int) float64 {
+	if a == b {
+		return 1
+	}
+	if a > b {
+		a, b = b, a
+	}
+	return float64(a) / float64(b)
+}
+
+func roundScore(v float64) float64 {
+	return float64(int(v*1000+0.5)) / 1000
+}
+
+// uniqueFunctionIndex キーが1つの関数にだけ対応するものを索引にする
+func uniqueFunctionIndex(fns []BinaryFunction, key func(fn *BinaryFunction) (string, bool)) map[string]int {
+	index := make(map[string]int)
+	dup := make(map[string]bool)
+	for i := range fns {
+		k, ok := key(&fns[i])
+		if !ok {
+			continue
+		}
+		if _, exists := index[k]; exists {
+			dup[k] = true
+			continue
+		}
+		index[k] = i
+	}
+	for k := range dup {
+		delete(index, k)
+	}
+	return index
+}
+
+func binaryFunctionRef(fn *BinaryFunction) BinaryFunctionRef {
+	return BinaryFunctionRef{Name: fn.Name, Address: fmt.Sprintf("0x%x", fn.Address), Size: len(fn.Bytes), Blocks: fn.Blocks}
+}
+
+// FormatFunctionBytes 関数の先頭から命令ごとに16進ダンプする（AIへの説明用）
+func FormatFunctionBytes(fn *BinaryFunction, maxInsns int) string {
+	var sb strings.Builder
+	for i, insn := range fn.Insns {
+		if i >= maxInsns {
+			fmt.Fprintf(&sb, "  ... (%d more instructions)\n", len(fn.Insns)-maxInsns)
+			break
+		}
+		fmt.Fprintf(&sb, "  %08x: % x\n", fn.Address+uint64(insn.Offset), fn.Bytes[insn.Offset:insn.Offset+insn.Len])
+	}
+	return sb.String()
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// BinaryDiffRequest binary_diff 解析の Metadata に保存する比較対象（ファイル同士かプロジェクト同士のどちらか）
+type BinaryDiffRequest struct {
+	OldFileID    uint `json:"old_file_id,omitempty"`
+	NewFileID    uint `json:"new_file_id,omitempty"`
+	OldProjectID uint `json:"old_project_id,omitempty"`
+	NewProjectID uint `json:"new_project_id,omitempty"`
+
+	RedactSecrets *bool `json:"redact_secrets,omitempty"` // AnalysisOptions と同じ
+}
+
+// AIに説明を求める変更関数の数と、関数ごとに渡す命令数の上限
+const (
+	maxExplainedFunctions = 10
+	maxExplainedInsns     = 60
+)
+
+// runBinaryDiff 2つのバイナリ（またはプロジェクト内の同名バイナリ同士）の関数を対応付けて差分を求める
+func (w *AnalysisWorker) runBinaryDiff(analysis *models.Analysis) (string, error) {
+	var req BinaryDiffRequest
+	if err := json.Unmarshal([]byte(analysis.Metadata), &req); err != nil {
+		return "", fmt.Errorf("invalid binary_diff metadata: %w", err)
+	}
+	ai := w.aiFor(analysis)
+
+	if req.OldFileID != 0 && req.NewFileID != 0 {
+		var oldFile, newFile models.File
+		if err := w.db.First(&oldFile, req.OldFileID).Error; err != nil {
+			return "", fmt.Errorf("old file %d not found: %w", req.OldFileID, err)
+		}
+		if err := w.db.First(&newFile, req.NewFileID).Error; err != nil {
+			return "", fmt.Errorf("new file %d not found: %w", req.NewFileID, err)
+		}
+		result, err := w.diffBinaryFiles(ai, &oldFile, &newFile)
+		if err != nil {
+			return "", err
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+
+	if req.OldProjectID == 0 || req.NewProjectID == 0 {
+		return "", fmt.Errorf("binary_diff requires old_file_id/new_file_id or old_project_id/new_project_id")
+	}
+
+	oldBins, err := w.projectBinaries(req.OldProjectID)
+	if err != nil {
+		return "", err
+	}
+	newBins, err := w.projectBinaries(req.NewProjectID)
+	if err != nil {
+		return "", err
+	}
+
+	pairs := []BinaryDiffResult{}
+	matched, unpairedOld, unpairedNew, ambiguous := pairBinaryFiles(oldBins, newBins)
+	for _, pair := range matched {
+		oldFile, newFile := pair[0], pair[1]
+		result, err := w.diffBinaryFiles(ai, oldFile, newFile)
+		if err != nil {
+			result = BinaryDiffResult{
+				Old:   BinaryDiffSide{FileID: oldFile.ID, Name: oldFile.Name},
+				New:   BinaryDiffSide{FileID: newFile.ID, Name: newFile.Name},
+				Notes: []string{err.Error()},
+			}
+		}
+		pairs = append(pairs, result)
+	}
+
+	if len(pairs) == 0 {
+		return "", fmt.Errorf("no binaries with matching names found in both projects")
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"pairs":        pairs,
+		"unpaired_old": unpairedOld,
+		"unpaired_new": unpairedNew,
+		"ambiguous":    ambiguous,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// projectBinaries プロジェクトにアップロードされた実行ファイルを名前順に返す
+func (w *AnalysisWorker) projectBinaries(projectID uint) ([]*models.File, error) {
+	var files []models.File
+	if err := w.db.Where("project_id = ? AND origin = ?", projectID, "").Order("name, id").Find(&files).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch files of project %d: %w", projectID, err)
+	}
+
+	var bins []*models.File
+	for i := range files {
+		file := &files[i]
+		if file.Content != "" {
+			continue
+		}
+		data, err := os.ReadFile(file.Path)
+		if err != nil || !IsExecutableBinary(data) {
+			continue
+		}
+		bins = append(bins, file)
+	}
+	return bins, nil
+}
+
+// pairBinaryFiles 2つのプロジェクトの実行ファイルを、パスが同じもの、次にファイル名（basename）が同じものの順に対応付ける
+// ディレクトリ構成が変わっても追えるようファイル名でも対応付けるが、同じ名前が複数あるものは推測せずに ambiguous として返す
+func pairBinaryFiles(oldBins, newBins []*models.File) (pairs [][2]*models.File, unpairedOld, unpairedNew, ambiguous []string) {
+	pairedOld := make(map[*models.File]bool)
+	pairedNew := make(map[*models.File]bool)
+	group := func(files []*models.File, paired map[*models.File]bool, key func(name string) string) map[string][]*models.File {
+		groups := make(map[string][]*models.File)
+		for _, file := range files {
+			if !paired[file] {
+				k := key(file.Name)
+				groups[k] = append(groups[k], file)
+			}
+		}
+		return groups
+	}
+
+	for _, key := range []func(string) string{path.Clean, path.Base} {
+		oldGroups := group(oldBins, pairedOld, key)
+		newGroups := group(newBins, pairedNew, key)
+		for _, oldFile := range oldBins {
+			k := key(oldFile.Name)
+			if pairedOld[oldFile] || len(oldGroups[k]) != 1 || len(newGroups[k]) != 1 {
+				continue
+			}
+			newFile := newGroups[k][0]
+			pairs = append(pairs, [2]*models.File{oldFile, newFile})
+			pairedOld[oldFile], pairedNew[newFile] = true, true
+		}
+	}
+
+	// 両方にあるが一意に決まらなかった名前
+	oldGroups := group(oldBins, pairedOld, path.Base)
+	newGroups := group(newBins, pairedNew, path.Base)
+	collided := make(map[string]bool)
+	for k := range oldGroups {
+		if len(newGroups[k]) > 0 {
+			collided[k] = true
+			ambiguous = append(ambiguous, k)
+		}
+	}
+	sort.Strings(ambiguous)
+	unpairedOld, unpairedNew = []string{}, []string{}
+	for _, file := range oldBins {
+		if !pairedOld[file] && !collided[path.Base(file.Name)] {
+			unpairedOld = append(unpairedOld, file.Name)
+		}
+	}
+	for _, file := range newBins {
+		if !pairedNew[file] && !collided[path.Base(file.Name)] {
+			unpairedNew = append(unpairedNew, file.Name)
+		}
+	}
+	if ambiguous == nil {
+		ambiguous = []string{}
+	}
+	return pairs, unpairedOld, unpairedNew, ambiguous
+}
+
+// diffBinaryFiles 2つのファイルを読み込んで差分を求め、変更された関数の説明をAIに依頼する
+func (w *AnalysisWorker) diffBinaryFiles(ai *AIService, oldFile, newFile *models.File) (BinaryDiffResult, error) {
+	oldImg, err := loadBinaryFile(oldFile)
+	if err != nil {
+		return BinaryDiffResult{}, err
+	}
+	newImg, err := loadBinaryFile(newFile)
+	if err != nil {
+		return BinaryDiffResult{}, err
+	}
+
+	result := DiffBinaryImages(oldImg, newImg)
+	result.Old.FileID, result.Old.Name = oldFile.ID, oldFile.Name
+	result.New.FileID, result.New.Name = newFile.ID, newFile.Name
+
+	if len(result.Changed) > 0 {
+		explanation, err := ai.ExplainBinaryChanges(newImg.Arch, formatBinaryChanges(oldImg, newImg, result.Changed))
+		if err != nil {
+			result.Notes = append(result.Notes, fmt.Sprintf("change explanation failed: %v", err))
+		} else {
+			result.Explanation = explanation
+		}
+	}
+	return result, nil
+}
+
+func loadBinaryFile(file *models.File) (*BinaryImage, error) {
+	data, err := os.ReadFile(file.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file.Name, err)
+	}
+	img, err := LoadBinaryImage(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file.Name, err)
+	}
+	return img, nil
+}
+
+// formatBinaryChanges 類似度の低い（変更の大きい）関数から順に新旧の命令列を並べる
+func formatBinaryChanges(oldImg, newImg *BinaryImage, changed []BinaryFunctionChange) string {
+	var sb strings.Builder
+	for i, change := range changed {
+		if i >= maxExplainedFunctions {
+			fmt.Fprintf(&sb, "... (%d more changed functions)\n", len(changed)-maxExplainedFunctions)
+			break
+		}
+		oldFn := findBinaryFunction(oldImg, change.Old.Address)
+		newFn := findBinaryFunction(newImg, change.New.Address)
+		if oldFn == nil || newFn == nil {
+			continue
+		}
+		fmt.Fprintf(&sb, "## %s (similarity %.3f)\n", change.New.Name, change.Similarity)
+		fmt.Fprintf(&sb, "### old %s, %d bytes\n%s", change.Old.Address, change.Old.Size, FormatFunctionBytes(oldFn, maxExplainedInsns))
+		fmt.Fprintf(&sb, "### new %s, %d bytes\n%s\n", change.New.Address, change.New.Size, FormatFunctionBytes(newFn, maxExplainedInsns))
+	}
+	return sb.String()
+}
+
+func findBinaryFunction(img *BinaryImage, address string) *BinaryFunction {
+	for i := range img.Functions {
+		if fmt.Sprintf("0x%x", img.Functions[i].Address) == address {
+			return &img.Functions[i]
+		}
+	}
+	return nil
+}
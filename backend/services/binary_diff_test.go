@@ -0,0 +1,249 @@
+package services
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"reverse-engineering-backend/models"
+)
+
+func TestDecodeMachineCodeX86(t *testing.T) {
+	code := []byte{
+		0x55,             // push rbp
+		0x48, 0x89, 0xe5, // mov rbp, rsp
+		0x48, 0xb8, 1, 2, 3, 4, 5, 6, 7, 8, // mov rax, imm64
+		0x66, 0x0f, 0x1f, 0x44, 0x00, 0x00, // nop word [rax+rax+0]
+		0x0f, 0x84, 0x10, 0x00, 0x00, 0x00, // je +0x10
+		0xe8, 0x00, 0x01, 0x00, 0x00, // call +0x100
+		0xeb, 0xfe, // jmp $
+		0xff, 0xe0, // jmp rax
+		0xc3, // ret
+	}
+	const addr = 0x1000
+	insns := DecodeMachineCode("amd64", code, addr)
+
+	type insn struct {
+		Offset, Len int
+		Branch      MachineBranch
+		Target      uint64
+	}
+	var got []insn
+	for _, i := range insns {
+		got = append(got, insn{i.Offset, i.Len, i.Branch, i.Target})
+	}
+	want := []insn{
+		{0, 1, BranchNone, 0},
+		{1, 3, BranchNone, 0},
+		{4, 10, BranchNone, 0},
+		{14, 6, BranchNone, 0},
+		{20, 6, BranchCond, addr + 26 + 0x10},
+		{26, 5, BranchCall, addr + 31 + 0x100},
+		{31, 2, BranchJump, addr + 31},
+		{33, 2, BranchIndirect, 0},
+		{35, 1, BranchReturn, 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("instructions = %+v, want %+v", got, want)
+	}
+
+	// 同じ命令はオペランドが違っても Sig が同じ
+	a := DecodeMachineCode("amd64", []byte{0x83, 0xc0, 0x01}, 0) // add eax, 1
+	b := DecodeMachineCode("amd64", []byte{0x83, 0xc0, 0x7f}, 0) // add eax, 0x7f
+	c := DecodeMachineCode("amd64", []byte{0x83, 0xe8, 0x01}, 0) // sub eax, 1
+	if a[0].Sig != b[0].Sig || a[0].Sig == c[0].Sig {
+		t.Errorf("Sig: add 1 = %x, add 0x7f = %x, sub 1 = %x", a[0].Sig, b[0].Sig, c[0].Sig)
+	}
+
+	// 途中で切れた命令は1バイトの不明命令として読み飛ばし、続きから読む（00 01 は add [rcx], al）
+	truncated := DecodeMachineCode("amd64", []byte{0xe8, 0x00, 0x01}, 0)
+	if len(truncated) != 2 || truncated[0].Len != 1 || truncated[0].Branch != BranchNone || truncated[1].Len != 2 {
+		t.Errorf("truncated call = %+v", truncated)
+	}
+}
+
+func TestDecodeMachineCodeARM64(t *testing.T) {
+	var code []byte
+	for _, ins := range []uint32{
+		0xd503201f, // nop
+		0x94000010, // bl +0x40
+		0x54ffffe1, // b.ne -4
+		0x17ffffff, // b -4
+		0xd61f0200, // br x16
+		0xd65f03c0, // ret
+	} {
+		code = binary.LittleEndian.AppendUint32(code, ins)
+	}
+	code = append(code, 0xaa) // 4バイトに満たない末尾は命令にしない
+
+	const addr = 0x4000
+	var got []MachineBranch
+	var targets []uint64
+	for _, insn := range DecodeMachineCode("arm64", code, addr) {
+		got = append(got, insn.Branch)
+		targets = append(targets, insn.Target)
+	}
+	if want := []MachineBranch{BranchNone, BranchCall, BranchCond, BranchJump, BranchIndirect, BranchReturn}; !reflect.DeepEqual(got, want) {
+		t.Errorf("branches = %v, want %v", got, want)
+	}
+	if want := []uint64{0, addr + 4 + 0x40, addr + 8 - 4, addr + 12 - 4, 0, 0}; !reflect.DeepEqual(targets, want) {
+		t.Errorf("targets = %x, want %x", targets, want)
+	}
+
+	// 対応していないアーキテクチャは4バイトごとに区切る
+	if insns := DecodeMachineCode("mips", make([]byte, 10), 0); len(insns) != 3 || insns[2].Len != 2 {
+		t.Errorf("unknown arch = %+v", insns)
+	}
+}
+
+// testBinaryFunction amd64 のコードから比較用の特徴量を計算した関数（name が空なら名前なし）
+func testBinaryFunction(name string, addr uint64, code ...byte) BinaryFunction {
+	fn := BinaryFunction{Name: name, Named: name != "", Address: addr, Bytes: code}
+	if name == "" {
+		fn.Name = "sub"
+	}
+	analyzeBinaryFunction("amd64", &fn)
+	return fn
+}
+
+// testLoopFunction 条件分岐を含む関数（limit は比較する即値）
+func testLoopFunction(name string, addr uint64, limit byte) BinaryFunction {
+	return testBinaryFunction(name, addr,
+		0x31, 0xc0, // xor eax, eax
+		0x83, 0xc0, 0x01, // add eax, 1
+		0x83, 0xf8, limit, // cmp eax, limit
+		0x75, 0xf8, // jne -8（add へ戻る）
+		0xc3, // ret
+	)
+}
+
+func TestAnalyzeBinaryFunction(t *testing.T) {
+	fn := testLoopFunction("loop", 0x1000, 10)
+	if len(fn.Insns) != 5 || fn.Blocks != 3 || fn.Edges != 3 {
+		t.Errorf("insns = %d, blocks = %d, edges = %d, want 5, 3, 3", len(fn.Insns), fn.Blocks, fn.Edges)
+	}
+
+	// 即値だけが違えば命令ハッシュは同じで、バイト列のハッシュは違う
+	other := testLoopFunction("loop", 0x1000, 20)
+	if fn.OpHash != other.OpHash || fn.ShapeHash != other.ShapeHash || fn.ByteHash == other.ByteHash || fn.RelocHash == other.RelocHash {
+		t.Errorf("hashes: %+v vs %+v", fn, other)
+	}
+
+	// 関数の外への呼び出しの飛び先だけが違うものは RelocHash が同じ
+	call := testBinaryFunction("f", 0x1000, 0xe8, 0x00, 0x01, 0x00, 0x00, 0xc3)
+	moved := testBinaryFunction("f", 0x2000, 0xe8, 0x00, 0x02, 0x00, 0x00, 0xc3)
+	if call.ByteHash == moved.ByteHash || call.RelocHash != moved.RelocHash {
+		t.Errorf("relocated call: ByteHash %x/%x, RelocHash %x/%x", call.ByteHash, moved.ByteHash, call.RelocHash, moved.RelocHash)
+	}
+	if !reflect.DeepEqual(call.Calls, []uint64{0x1105}) {
+		t.Errorf("calls = %x", call.Calls)
+	}
+}
+
+func TestFunctionSimilarity(t *testing.T) {
+	base := testLoopFunction("", 0x1000, 10)
+	nop := testBinaryFunction("", 0x1000, 0x90, 0x90, 0x90, 0x90, 0x90, 0x90, 0x90, 0x90, 0x90, 0x90, 0xc3)
+	tests := []struct {
+		name     string
+		b        BinaryFunction
+		min, max float64
+	}{
+		{"same bytes", testLoopFunction("", 0x2000, 10), 1, 1},
+		{"operand changed", testLoopFunction("", 0x1000, 20), 0.999, 1},
+		{"instruction inserted", testBinaryFunction("", 0x1000, 0x31, 0xc0, 0x90, 0x83, 0xc0, 0x01, 0x83, 0xf8, 0x0a, 0x75, 0xf8, 0xc3), 0.6, 0.95},
+		{"unrelated", nop, 0, 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FunctionSimilarity(&base, &tt.b)
+			if got < tt.min || got > tt.max {
+				t.Errorf("FunctionSimilarity() = %v, want [%v, %v]", got, tt.min, tt.max)
+			}
+			if rev := FunctionSimilarity(&tt.b, &base); rev != got {
+				t.Errorf("not symmetric: %v vs %v", got, rev)
+			}
+		})
+	}
+}
+
+func TestDiffBinaryImages(t *testing.T) {
+	ret := func(name string, n int) BinaryFunction {
+		code := make([]byte, n)
+		for i := range code {
+			code[i] = 0x90
+		}
+		code[n-1] = 0xc3
+		return testBinaryFunction(name, 0x9000, code...)
+	}
+	oldImg := &BinaryImage{Format: "elf", Arch: "amd64", Functions: []BinaryFunction{
+		// 呼び出し先の移動で飛び先だけが変わった関数
+		testBinaryFunction("main", 0x1000, 0x55, 0xe8, 0x00, 0x01, 0x00, 0x00, 0x5d, 0xc3),
+		// 即値だけが変わった関数
+		testLoopFunction("compute", 0x1100, 10),
+		// 名前の無い関数は命令列で対応付ける
+		testBinaryFunction("", 0x1200, 0x55, 0x48, 0x89, 0xe5, 0xb8, 0x01, 0x00, 0x00, 0x00, 0x5d, 0xc3),
+		ret("removed", 2),
+	}}
+	newImg := &BinaryImage{Format: "elf", Arch: "amd64", Functions: []BinaryFunction{
+		testBinaryFunction("main", 0x1000, 0x55, 0xe8, 0x40, 0x02, 0x00, 0x00, 0x5d, 0xc3),
+		testLoopFunction("compute", 0x1100, 20),
+		testBinaryFunction("", 0x1300, 0x55, 0x48, 0x89, 0xe5, 0xb8, 0x02, 0x00, 0x00, 0x00, 0x5d, 0xc3),
+		ret("added", 40),
+	}}
+
+	result := DiffBinaryImages(oldImg, newImg)
+	want := BinaryDiffSummary{Matched: 3, Identical: 1, Changed: 2, Added: 1, Removed: 1}
+	got := result.Summary
+	got.Similarity = 0
+	if got != want {
+		t.Errorf("summary = %+v, want %+v", result.Summary, want)
+	}
+	var changed []string
+	for _, c := range result.Changed {
+		changed = append(changed, c.Old.Name+"->"+c.New.Name+":"+c.MatchedBy)
+	}
+	if want := []string{"compute->compute:symbol", "sub->sub:instruction_hash"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %v, want %v", changed, want)
+	}
+	if len(result.Added) != 1 || result.Added[0].Name != "added" || len(result.Removed) != 1 || result.Removed[0].Name != "removed" {
+		t.Errorf("added = %+v, removed = %+v", result.Added, result.Removed)
+	}
+	if s := result.Summary.Similarity; s <= 0.5 || s >= 1 {
+		t.Errorf("similarity = %v", s)
+	}
+
+	// アーキテクチャが違えば注記する
+	newImg.Arch = "arm64"
+	if result := DiffBinaryImages(oldImg, newImg); len(result.Notes) == 0 {
+		t.Error("no note for different architectures")
+	}
+}
+
+func TestPairBinaryFiles(t *testing.T) {
+	files := func(names ...string) []*models.File {
+		var fs []*models.File
+		for _, name := range names {
+			fs = append(fs, &models.File{Name: name})
+		}
+		return fs
+	}
+	oldBins := files("bin/app", "lib/app", "tool", "sbin/init", "a/dup", "b/dup", "gone")
+	newBins := files("bin/app", "usr/lib/app", "usr/bin/tool", "init", "c/dup", "d/dup", "fresh")
+
+	pairs, unpairedOld, unpairedNew, ambiguous := pairBinaryFiles(oldBins, newBins)
+	var got []string
+	for _, p := range pairs {
+		got = append(got, p[0].Name+"="+p[1].Name)
+	}
+	// パスの一致が先で、残りは basename が両方で1つずつのものだけ
+	want := []string{"bin/app=bin/app", "lib/app=usr/lib/app", "tool=usr/bin/tool", "sbin/init=init"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pairs = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(ambiguous, []string{"dup"}) {
+		t.Errorf("ambiguous = %v", ambiguous)
+	}
+	if !reflect.DeepEqual(unpairedOld, []string{"gone"}) || !reflect.DeepEqual(unpairedNew, []string{"fresh"}) {
+		t.Errorf("unpaired = %v, %v", unpairedOld, unpairedNew)
+	}
+}
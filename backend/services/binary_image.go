@@ -0,0 +1,486 @@
+package services
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BinaryImage 実行ファイルから取り出した関数の一覧
+type BinaryImage struct {
+	Format    string           `json:"format"` // elf, pe, macho
+	Arch      string           `json:"arch"`
+	Entry     uint64           `json:"entry"`
+	Stripped  bool             `json:"stripped"`
+	Functions []BinaryFunction `json:"-"`
+}
+
+// BinaryFunction 関数1つ分のコードと構造的特徴
+type BinaryFunction struct {
+	Name    string
+	Named   bool // シンボル由来の名前か（false は sub_XXXX）
+	Address uint64
+	Bytes   []byte
+	Insns   []MachineInsn
+	Blocks  int
+	Edges   int
+	Calls   []uint64
+	// 比較用の特徴量
+	ByteHash  uint64
+	RelocHash uint64 // 関数の外を指す分岐・呼び出しの飛び先を除いたバイト列のハッシュ（再配置で変わる部分を無視する）
+	OpHash    uint64
+	ShapeHash uint64
+	OpBag     map[uint32]int
+}
+
+// binaryTextSection 実行可能セクション
+type binaryTextSection struct {
+	Addr uint64
+	Data []byte
+}
+
+// binarySymbol アドレス付きの関数シンボル（Size が0なら次のシンボルまで）
+type binarySymbol struct {
+	Name string
+	Addr uint64
+	Size uint64
+}
+
+// IsExecutableBinary ELF / PE / Mach-O のいずれかかを判定
+func IsExecutableBinary(data []byte) bool {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x7fELF")), bytes.HasPrefix(data, []byte("MZ")):
+		return true
+	case len(data) >= 4:
+		magic := binary.LittleEndian.Uint32(data)
+		return magic == macho.Magic32 || magic == macho.Magic64 || magic == macho.MagicFat ||
+			binary.BigEndian.Uint32(data) == macho.MagicFat
+	}
+	return false
+}
+
+// LoadBinaryImage 実行ファイルを読み込み、シンボル（無ければ呼び出し先の探索）から関数を切り出す
+func LoadBinaryImage(data []byte) (*BinaryImage, error) {
+	var (
+		img      BinaryImage
+		sections []binaryTextSection
+		symbols  []binarySymbol
+		err      error
+	)
+	switch {
+	case bytes.HasPrefix(data, []byte("\x7fELF")):
+		img.Format = "elf"
+		sections, symbols, err = loadELF(data, &img)
+	case bytes.HasPrefix(data, []byte("MZ")):
+		img.Format = "pe"
+		sections, symbols, err = loadPE(data, &img)
+	default:
+		img.Format = "macho"
+		sections, symbols, err = loadMachO(data, &img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(sections) == 0 {
+		return nil, errors.New("no executable sections found")
+	}
+
+	img.Stripped = len(symbols) == 0
+	img.Functions = splitBinaryFunctions(img.Arch, sections, symbols, img.Entry)
+	for i := range img.Functions {
+		analyzeBinaryFunction(img.Arch, &img.Functions[i])
+	}
+	return &img, nil
+}
+
+func loadELF(data []byte, img *BinaryImage) ([]binaryTextSection, []binarySymbol, error) {
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	img.Entry = f.Entry
+	img.Arch = map[elf.Machine]string{elf.EM_X86_64: "amd64", elf.EM_386: "386", elf.EM_AARCH64: "arm64",
+		elf.EM_ARM: "arm", elf.EM_MIPS: "mips", elf.EM_PPC64: "ppc64", elf.EM_RISCV: "riscv"}[f.Machine]
+	if img.Arch == "" {
+		img.Arch = strings.ToLower(strings.TrimPrefix(f.Machine.String(), "EM_"))
+	}
+
+	var sections []binaryTextSection
+	for _, s := range f.Sections {
+		if s.Type == elf.SHT_PROGBITS && s.Flags&elf.SHF_EXECINSTR != 0 {
+			if d, err := s.Data(); err == nil {
+				sections = append(sections, binaryTextSection{Addr: s.Addr, Data: d})
+			}
+		}
+	}
+
+	var symbols []binarySymbol
+	syms, _ := f.Symbols()
+	dyn, _ := f.DynamicSymbols()
+	for _, s := range append(syms, dyn...) {
+		if elf.ST_TYPE(s.Info) == elf.STT_FUNC && s.Value != 0 && s.Name != "" {
+			symbols = append(symbols, binarySymbol{Name: s.Name, Addr: s.Value, Size: s.Size})
+		}
+	}
+	return sections, symbols, nil
+}
+
+func loadPE(data []byte, img *BinaryImage) ([]binaryTextSection, []binarySymbol, error) {
+	f, err := pe.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	var imageBase uint64
+	var exportDir pe.DataDirectory
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		imageBase = uint64(oh.ImageBase)
+		img.Entry = imageBase + uint64(oh.AddressOfEntryPoint)
+		if len(oh.DataDirectory) > 0 {
+			exportDir = oh.DataDirectory[0]
+		}
+	case *pe.OptionalHeader64:
+		imageBase = oh.ImageBase
+		img.Entry = imageBase + uint64(oh.AddressOfEntryPoint)
+		if len(oh.DataDirectory) > 0 {
+			exportDir = oh.DataDirectory[0]
+		}
+	}
+	img.Arch = map[uint16]string{pe.IMAGE_FILE_MACHINE_AMD64: "amd64", pe.IMAGE_FILE_MACHINE_I386: "386",
+		pe.IMAGE_FILE_MACHINE_ARM64: "arm64", pe.IMAGE_FILE_MACHINE_ARMNT: "arm"}[f.Machine]
+
+	var sections []binaryTextSection
+	for _, s := range f.Sections {
+		if s.Characteristics&pe.IMAGE_SCN_MEM_EXECUTE != 0 {
+			if d, err := s.Data(); err == nil {
+				size := int(s.VirtualSize)
+				if size == 0 || size > len(d) {
+					size = len(d)
+				}
+				sections = append(sections, binaryTextSection{Addr: imageBase + uint64(s.VirtualAddress), Data: d[:size]})
+			}
+		}
+	}
+
+	var symbols []binarySymbol
+	for _, s := range f.Symbols {
+		// COFF シンボル（MinGW などでビルドされた場合に残る）: Type 0x20 は関数
+		if s.Type == 0x20 && s.SectionNumber > 0 && int(s.SectionNumber) <= len(f.Sections) {
+			sec := f.Sections[s.SectionNumber-1]
+			symbols = append(symbols, binarySymbol{Name: s.Name, Addr: imageBase + uint64(sec.VirtualAddress) + uint64(s.Value)})
+		}
+	}
+	for name, rva := range peExports(f, exportDir) {
+		symbols = append(symbols, binarySymbol{Name: name, Addr: imageBase + uint64(rva)})
+	}
+	return sections, symbols, nil
+}
+
+// peExports エクスポートディレクトリから名前付きエクスポートの RVA を読む
+func peExports(f *pe.File, dir pe.DataDirectory) map[string]uint32 {
+	exports := make(map[string]uint32)
+	if dir.VirtualAddress == 0 || dir.Size == 0 {
+		return exports
+	}
+	sectionData := make([][]byte, len(f.Sections))
+	for i, s := range f.Sections {
+		sectionData[i], _ = s.Data()
+	}
+	read := func(rva uint32, n int) []byte {
+		for i, s := range f.Sections {
+			if rva >= s.VirtualAddress && rva < s.VirtualAddress+s.VirtualSize {
+				off := int(rva - s.VirtualAddress)
+				if off+n > len(sectionData[i]) {
+					return nil
+				}
+				return sectionData[i][off : off+n]
+			}
+		}
+		return nil
+	}
+	readString := func(rva uint32) string {
+		var sb strings.Builder
+		for i := uint32(0); i < 512; i++ {
+			c := read(rva+i, 1)
+			if c == nil || c[0] == 0 {
+				break
+			}
+			sb.WriteByte(c[0])
+		}
+		return sb.String()
+	}
+
+	hdr := read(dir.VirtualAddress, 40)
+	if hdr == nil {
+		return exports
+	}
+	numFuncs := binary.LittleEndian.Uint32(hdr[20:])
+	numNames := binary.LittleEndian.Uint32(hdr[24:])
+	funcs := binary.LittleEndian.Uint32(hdr[28:])
+	names := binary.LittleEndian.Uint32(hdr[32:])
+	ordinals := binary.LittleEndian.Uint32(hdr[36:])
+	for i := uint32(0); i < numNames && i < 65536; i++ {
+		nameRVA := read(names+i*4, 4)
+		ord := read(ordinals+i*2, 2)
+		if nameRVA == nil || ord == nil {
+			break
+		}
+		idx := uint32(binary.LittleEndian.Uint16(ord))
+		if idx >= numFuncs {
+			continue
+		}
+		fn := read(funcs+idx*4, 4)
+		if fn == nil {
+			continue
+		}
+		rva := binary.LittleEndian.Uint32(fn)
+		// フォワーダー（エクスポートディレクトリ内を指す）は除外
+		if rva >= dir.VirtualAddress && rva < dir.VirtualAddress+dir.Size {
+			continue
+		}
+		if name := readString(binary.LittleEndian.Uint32(nameRVA)); name != "" {
+			exports[name] = rva
+		}
+	}
+	return exports
+}
+
+func loadMachO(data []byte, img *BinaryImage) ([]binaryTextSection, []binarySymbol, error) {
+	f, err := macho.NewFile(bytes.NewReader(data))
+	if err != nil {
+		fat, ferr := macho.NewFatFile(bytes.NewReader(data))
+		if ferr != nil || len(fat.Arches) == 0 {
+			return nil, nil, err
+		}
+		// ユニバーサルバイナリは x86_64 → arm64 → 先頭の順で1つ選ぶ
+		f = fat.Arches[0].File
+		for _, want := range []macho.Cpu{macho.CpuAmd64, macho.CpuArm64} {
+			for _, arch := range fat.Arches {
+				if arch.Cpu == want {
+					f = arch.File
+					break
+				}
+			}
+			if f.Cpu == want {
+				break
+			}
+		}
+	}
+	img.Arch = map[macho.Cpu]string{macho.CpuAmd64: "amd64", macho.Cpu386: "386", macho.CpuArm64: "arm64", macho.CpuArm: "arm"}[f.Cpu]
+
+	var sections []binaryTextSection
+	textSect := make(map[uint8]bool)
+	for i, s := range f.Sections {
+		if s.Flags&0x80000000 != 0 || s.Flags&0x400 != 0 { // S_ATTR_PURE_INSTRUCTIONS / S_ATTR_SOME_INSTRUCTIONS
+			if d, err := s.Data(); err == nil {
+				sections = append(sections, binaryTextSection{Addr: s.Addr, Data: d})
+				textSect[uint8(i+1)] = true
+			}
+		}
+	}
+	if len(sections) > 0 {
+		img.Entry = sections[0].Addr
+	}
+
+	var symbols []binarySymbol
+	if f.Symtab != nil {
+		for _, s := range f.Symtab.Syms {
+			if s.Type&0x0e == 0x0e && textSect[s.Sect] && s.Type&0xe0 == 0 { // N_SECT かつ stab でない
+				symbols = append(symbols, binarySymbol{Name: strings.TrimPrefix(s.Name, "_"), Addr: s.Value})
+			}
+		}
+	}
+	return sections, symbols, nil
+}
+
+// splitBinaryFunctions シンボルから関数範囲を決める。シンボルが無い場合はエントリポイントと
+// 直接呼び出しの飛び先を関数の先頭とみなす
+func splitBinaryFunctions(arch string, sections []binaryTextSection, symbols []binarySymbol, entry uint64) []BinaryFunction {
+	starts := make(map[uint64]binarySymbol)
+	for _, s := range symbols {
+		if prev, ok := starts[s.Addr]; !ok || (prev.Size == 0 && s.Size > 0) {
+			starts[s.Addr] = s
+		}
+	}
+
+	if len(starts) == 0 {
+		if entry != 0 {
+			starts[entry] = binarySymbol{Addr: entry}
+		}
+		for _, sec := range sections {
+			starts[sec.Addr] = binarySymbol{Addr: sec.Addr}
+			for _, insn := range DecodeMachineCode(arch, sec.Data, sec.Addr) {
+				if insn.Branch == BranchCall && insn.Target >= sec.Addr && insn.Target < sec.Addr+uint64(len(sec.Data)) {
+					starts[insn.Target] = binarySymbol{Addr: insn.Target}
+				}
+			}
+		}
+	}
+
+	addrs := make([]uint64, 0, len(starts))
+	for addr := range starts {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+
+	var functions []BinaryFunction
+	for i, addr := range addrs {
+		sym := starts[addr]
+		var sec *binaryTextSection
+		for k := range sections {
+			if addr >= sections[k].Addr && addr < sections[k].Addr+uint64(len(sections[k].Data)) {
+				sec = &sections[k]
+				break
+			}
+		}
+		if sec == nil {
+			continue
+		}
+		end := sec.Addr + uint64(len(sec.Data))
+		if sym.Size > 0 && addr+sym.Size < end {
+			end = addr + sym.Size
+		} else if i+1 < len(addrs) && addrs[i+1] < end {
+			end = addrs[i+1]
+		}
+		if end <= addr {
+			continue
+		}
+
+		fn := BinaryFunction{Name: sym.Name, Named: sym.Name != "", Address: addr, Bytes: sec.Data[addr-sec.Addr : end-sec.Addr]}
+		if !fn.Named {
+			fn.Name = fmt.Sprintf("sub_%x", addr)
+		}
+		functions = append(functions, fn)
+	}
+	return functions
+}
+
+// analyzeBinaryFunction 命令列・基本ブロック・CFG形状と各種ハッシュを計算する
+func analyzeBinaryFunction(arch string, fn *BinaryFunction) {
+	fn.Insns = DecodeMachineCode(arch, fn.Bytes, fn.Address)
+	end := fn.Address + uint64(len(fn.Bytes))
+	inside := func(addr uint64) bool { return addr >= fn.Address && addr < end }
+
+	// 基本ブロックの先頭を集める
+	leaders := map[uint64]bool{fn.Address: true}
+	for i, insn := range fn.Insns {
+		switch insn.Branch {
+		case BranchJump, BranchCond:
+			if inside(insn.Target) {
+				leaders[insn.Target] = true
+			}
+			fallthrough
+		case BranchReturn, BranchIndirect:
+			if i+1 < len(fn.Insns) {
+				leaders[fn.Address+uint64(fn.Insns[i+1].Offset)] = true
+			}
+		case BranchCall:
+			fn.Calls = append(fn.Calls, insn.Target)
+		}
+	}
+
+	// 辺を数え、各ブロックの (入次数, 出次数) から形状ハッシュを作る
+	outDeg := make(map[uint64]int)
+	inDeg := make(map[uint64]int)
+	block := fn.Address
+	for i, insn := range fn.Insns {
+		addr := fn.Address + uint64(insn.Offset)
+		if leaders[addr] {
+			block = addr
+		}
+		var next uint64
+		hasNext := i+1 < len(fn.Insns)
+		if hasNext {
+			next = fn.Address + uint64(fn.Insns[i+1].Offset)
+		}
+		addEdge := func(to uint64) {
+			outDeg[block]++
+			inDeg[to]++
+			fn.Edges++
+		}
+		switch insn.Branch {
+		case BranchJump:
+			if inside(insn.Target) {
+				addEdge(insn.Target)
+			}
+		case BranchCond:
+			if inside(insn.Target) {
+				addEdge(insn.Target)
+			}
+			if hasNext {
+				addEdge(next)
+			}
+		case BranchReturn, BranchIndirect:
+		default:
+			if hasNext && leaders[next] {
+				addEdge(next)
+			}
+		}
+	}
+	fn.Blocks = len(leaders)
+
+	degrees := make([]uint64, 0, len(leaders))
+	for addr := range leaders {
+		degrees = append(degrees, uint64(inDeg[addr])<<32|uint64(outDeg[addr]))
+	}
+	sort.Slice(degrees, func(i, j int) bool { return degrees[i] < degrees[j] })
+	fn.ShapeHash = fnv64(0, uint64(fn.Blocks), uint64(fn.Edges))
+	for _, d := range degrees {
+		fn.ShapeHash = fnv64(fn.ShapeHash, d)
+	}
+
+	fn.ByteHash = fnv64Bytes(fn.Bytes)
+	fn.RelocHash = 14695981039346656037
+	for _, insn := range fn.Insns {
+		switch insn.Branch {
+		case BranchJump, BranchCond, BranchCall:
+			if !inside(insn.Target) {
+				fn.RelocHash = fnv64(fn.RelocHash, uint64(insn.Sig), uint64(insn.Len))
+				continue
+			}
+		}
+		for _, c := range fn.Bytes[insn.Offset : insn.Offset+insn.Len] {
+			fn.RelocHash ^= uint64(c)
+			fn.RelocHash *= 1099511628211
+		}
+	}
+	fn.OpHash = 14695981039346656037
+	fn.OpBag = make(map[uint32]int)
+	for i, insn := range fn.Insns {
+		fn.OpHash = fnv64(fn.OpHash, uint64(insn.Sig))
+		// 命令の2-gramを袋として持ち、類似度計算に使う
+		gram := insn.Sig
+		if i > 0 {
+			gram = gram*31 + fn.Insns[i-1].Sig
+		}
+		fn.OpBag[gram]++
+	}
+}
+
+func fnv64(h uint64, values ...uint64) uint64 {
+	if h == 0 {
+		h = 14695981039346656037
+	}
+	for _, v := range values {
+		for k := 0; k < 8; k++ {
+			h ^= (v >> (8 * k)) & 0xff
+			h *= 1099511628211
+		}
+	}
+	return h
+}
+
+func fnv64Bytes(b []byte) uint64 {
+	h := uint64(14695981039346656037)
+	for _, c := range b {
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	return h
+}
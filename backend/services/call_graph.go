@@ -0,0 +1,307 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CallGraphNode 呼び出しグラフの関数
+type CallGraphNode struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Container string `json:"container,omitempty"` // レシーバー型・所属クラス
+	Package   string `json:"package,omitempty"`   // Go のパッケージ
+	FileID    uint   `json:"file_id,omitempty"`
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Language  string `json:"language"`
+	Entry     bool   `json:"entry,omitempty"` // main やスクリプトのトップレベルなどの起点
+}
+
+// CallGraphEdge 呼び出し関係
+type CallGraphEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Line  int    `json:"line"`  // 最初の呼び出し位置
+	Count int    `json:"count"` // 呼び出し箇所の数
+	Kind  string `json:"kind"`  // static: 型解決済み, interface: インターフェース経由（実装すべてへ）, name: 名前の一致による推定
+}
+
+// CallGraph 静的な呼び出しグラフ
+type CallGraph struct {
+	Nodes       []CallGraphNode `json:"nodes"`
+	Edges       []CallGraphEdge `json:"edges"`
+	EntryPoints []string        `json:"entry_points"`
+}
+
+// callGraphBuilder ノードと辺を重複なく集める
+type callGraphBuilder struct {
+	nodes map[string]*CallGraphNode
+	order []string
+	edges map[[2]string]*CallGraphEdge
+}
+
+func newCallGraphBuilder() *callGraphBuilder {
+	return &callGraphBuilder{nodes: make(map[string]*CallGraphNode), edges: make(map[[2]string]*CallGraphEdge)}
+}
+
+func (b *callGraphBuilder) addNode(node CallGraphNode) {
+	if _, ok := b.nodes[node.ID]; ok {
+		return
+	}
+	b.nodes[node.ID] = &node
+	b.order = append(b.order, node.ID)
+}
+
+func (b *callGraphBuilder) addEdge(from, to string, line int, kind string) {
+	key := [2]string{from, to}
+	if edge, ok := b.edges[key]; ok {
+		edge.Count++
+		if line < edge.Line {
+			edge.Line = line
+		}
+		return
+	}
+	b.edges[key] = &CallGraphEdge{From: from, To: to, Line: line, Count: 1, Kind: kind}
+}
+
+func (b *callGraphBuilder) graph() *CallGraph {
+	g := &CallGraph{Nodes: []CallGraphNode{}, Edges: []CallGraphEdge{}, EntryPoints: []string{}}
+	for _, id := range b.order {
+		node := b.nodes[id]
+		g.Nodes = append(g.Nodes, *node)
+		if node.Entry {
+			g.EntryPoints = append(g.EntryPoints, id)
+		}
+	}
+	for _, edge := range b.edges {
+		if b.nodes[edge.From] != nil && b.nodes[edge.To] != nil {
+			g.Edges = append(g.Edges, *edge)
+		}
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+	return g
+}
+
+// FindNodes ID、名前、Type.Method のいずれかで一致するノードを返す
+func (g *CallGraph) FindNodes(query string) []string {
+	var ids []string
+	for _, node := range g.Nodes {
+		if node.ID == query {
+			return []string{node.ID}
+		}
+	}
+	for _, node := range g.Nodes {
+		if node.Name == query || (node.Container != "" && node.Container+"."+node.Name == query) {
+			ids = append(ids, node.ID)
+		}
+	}
+	return ids
+}
+
+// Callers targets を呼び出している関数を depth 段までさかのぼった部分グラフを返す
+func (g *CallGraph) Callers(targets []string, depth int) *CallGraph {
+	incoming := make(map[string][]CallGraphEdge)
+	for _, edge := range g.Edges {
+		incoming[edge.To] = append(incoming[edge.To], edge)
+	}
+	keep := make(map[string]bool)
+	var edges []CallGraphEdge
+	frontier := targets
+	for _, id := range targets {
+		keep[id] = true
+	}
+	for level := 0; level < depth && len(frontier) > 0; level++ {
+		var next []string
+		for _, id := range frontier {
+			for _, edge := range incoming[id] {
+				edges = append(edges, edge)
+				if !keep[edge.From] {
+					keep[edge.From] = true
+					next = append(next, edge.From)
+				}
+			}
+		}
+		frontier = next
+	}
+	return g.subgraph(keep, edges)
+}
+
+// Paths from のいずれかから to のいずれかへ至る経路を短い順に最大 maxPaths 本返す（同じ関数は1経路で1度だけ通る）
+func (g *CallGraph) Paths(from, to []string, maxPaths, maxLength int) [][]string {
+	outgoing := make(map[string][]string)
+	for _, edge := range g.Edges {
+		outgoing[edge.From] = append(outgoing[edge.From], edge.To)
+	}
+	goal := make(map[string]bool)
+	for _, id := range to {
+		goal[id] = true
+	}
+
+	// 幅優先で短い経路から列挙する
+	var paths [][]string
+	queue := [][]string{}
+	for _, id := range from {
+		queue = append(queue, []string{id})
+	}
+	for len(queue) > 0 && len(paths) < maxPaths {
+		path := queue[0]
+		queue = queue[1:]
+		last := path[len(path)-1]
+		if goal[last] {
+			paths = append(paths, path)
+			continue
+		}
+		if len(path) >= maxLength {
+			continue
+		}
+		for _, next := range outgoing[last] {
+			if containsString(path, next) {
+				continue
+			}
+			extended := make([]string, len(path), len(path)+1)
+			copy(extended, path)
+			queue = append(queue, append(extended, next))
+		}
+		// 分岐の多いグラフで経路が爆発しないように打ち切る
+		if len(queue) > 100000 {
+			break
+		}
+	}
+	return paths
+}
+
+// PathsGraph 経路に含まれるノードと辺だけの部分グラフを返す
+func (g *CallGraph) PathsGraph(paths [][]string) *CallGraph {
+	keep := make(map[string]bool)
+	onPath := make(map[[2]string]bool)
+	for _, path := range paths {
+		for i, id := range path {
+			keep[id] = true
+			if i > 0 {
+				onPath[[2]string{path[i-1], id}] = true
+			}
+		}
+	}
+	var edges []CallGraphEdge
+	for _, edge := range g.Edges {
+		if onPath[[2]string{edge.From, edge.To}] {
+			edges = append(edges, edge)
+		}
+	}
+	return g.subgraph(keep, edges)
+}
+
+func (g *CallGraph) subgraph(keep map[string]bool, edges []CallGraphEdge) *CallGraph {
+	sub := &CallGraph{Nodes: []CallGraphNode{}, Edges: []CallGraphEdge{}, EntryPoints: []string{}}
+	for _, node := range g.Nodes {
+		if keep[node.ID] {
+			sub.Nodes = append(sub.Nodes, node)
+			if node.Entry {
+				sub.EntryPoints = append(sub.EntryPoints, node.ID)
+			}
+		}
+	}
+	seen := make(map[[2]string]bool)
+	for _, edge := range edges {
+		key := [2]string{edge.From, edge.To}
+		if !seen[key] && keep[edge.From] && keep[edge.To] {
+			seen[key] = true
+			sub.Edges = append(sub.Edges, edge)
+		}
+	}
+	return sub
+}
+
+// nodeLabel 図に表示する名前
+func (node CallGraphNode) nodeLabel() string {
+	label := node.Name
+	if node.Container != "" {
+		label = node.Container + "." + label
+	}
+	if node.Package != "" {
+		label = node.Package + "." + label
+	}
+	return label
+}
+
+// DOT Graphviz の DOT 形式で出力する
+func (g *CallGraph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph callgraph {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, fontname=\"Helvetica\"];\n")
+	for _, node := range g.Nodes {
+		attrs := fmt.Sprintf("label=%s", dotQuote(node.nodeLabel()))
+		if node.File != "" {
+			attrs += fmt.Sprintf(", tooltip=%s", dotQuote(fmt.Sprintf("%s:%d", node.File, node.Line)))
+		}
+		if node.Entry {
+			attrs += ", style=bold, color=\"#1f6feb\""
+		}
+		fmt.Fprintf(&b, "  %s [%s];\n", dotQuote(node.ID), attrs)
+	}
+	for _, edge := range g.Edges {
+		attrs := ""
+		switch edge.Kind {
+		case "interface":
+			attrs = " [style=dashed]"
+		case "name":
+			attrs = " [style=dotted]"
+		}
+		fmt.Fprintf(&b, "  %s -> %s%s;\n", dotQuote(edge.From), dotQuote(edge.To), attrs)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid Mermaid の flowchart 形式で出力する（ノード ID は n0, n1, ... に置き換える）
+func (g *CallGraph) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	ids := make(map[string]string)
+	for i, node := range g.Nodes {
+		ids[node.ID] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[node.ID], mermaidEscape(node.nodeLabel()))
+	}
+	for _, edge := range g.Edges {
+		arrow := "-->"
+		switch edge.Kind {
+		case "interface", "name":
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "  %s %s %s\n", ids[edge.From], arrow, ids[edge.To])
+	}
+	var entries []string
+	for _, id := range g.EntryPoints {
+		entries = append(entries, ids[id])
+	}
+	if len(entries) > 0 {
+		b.WriteString("  classDef entry stroke:#1f6feb,stroke-width:2px\n")
+		fmt.Fprintf(&b, "  class %s entry\n", strings.Join(entries, ","))
+	}
+	return b.String()
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// 名前( を呼び出しとみなす（コメント・文字列を除いたソースに対して使う）
+var callSiteRe = regexp.MustCompile(`([A-Za-z_$][\w$]*)\s*\(`)
+
+// 同名の定義がこれより多い呼び出しは推定をあきらめる
+const maxNameCallTargets = 5
+
+// トップレベルのコードがスクリプトとして実行される言語（ファイル自体を起点のノードにする）
+var scriptLanguages = map[string]bool{
+	"python": true, "javascript": true, "typescript": true, "ruby": true, "php": true,
+	"shell": true, "r": true, "powershell": true,
+}
+
+// 修飾なしの呼び出しで同じクラスのメソッドを呼べる言語
+var implicitReceiverLanguages = map[string]bool{
+	"java": true, "csharp": true, "kotlin": true, "swift": true, "scala": true, "cpp": true, "ruby": true,
+}
+
+// callGraphFamily 互いに呼び出し合える言語をまとめる
+func callGraphFamily(language string) string {
+	switch language {
+	case "javascript", "typescript":
+		return "js"
+	case "c", "cpp":
+		return "c"
+	}
+	return language
+}
+
+// BuildCallGraph プロジェクトのファイルから静的な呼び出しグラフを作る
+// Go は型検査に基づいて正確に、その他の言語はシンボル抽出と名前の一致で推定する
+func BuildCallGraph(files []models.File) *CallGraph {
+	b := newCallGraphBuilder()
+	addGoCallGraph(b, files)
+	addNameCallGraph(b, files)
+	return b.graph()
+}
+
+type nameCallFunction struct {
+	id    string
+	def   SymbolDef
+	file  *models.File
+	start int
+	end   int // 関数とみなす最終行（次の定義の直前まで）
+}
+
+// addNameCallGraph Go 以外の言語の呼び出しを名前の一致で推定する
+func addNameCallGraph(b *callGraphBuilder, files []models.File) {
+	byName := make(map[string][]*nameCallFunction)
+	perFile := make(map[uint][]*nameCallFunction)
+
+	for i := range files {
+		file := &files[i]
+		if file.Content == "" || file.Language == "go" || symbolRules[file.Language] == nil {
+			continue
+		}
+		masked := strings.Split(MaskSource(file.Language, file.Content), "\n")
+		for _, def := range ExtractSymbols(file.Language, file.Content) {
+			if def.Kind != "function" && def.Kind != "method" {
+				continue
+			}
+			end := functionEndLine(file.Language, masked, def)
+			qualified := def.Name
+			if def.Container != "" {
+				qualified = def.Container + "." + def.Name
+			}
+			id := file.Name + ":" + qualified
+			if _, ok := b.nodes[id]; ok {
+				id = fmt.Sprintf("%s@%d", id, def.Line)
+			}
+			b.addNode(CallGraphNode{
+				ID:        id,
+				Name:      def.Name,
+				Container: def.Container,
+				FileID:    file.ID,
+				File:      file.Name,
+				Line:      def.Line,
+				Language:  file.Language,
+				// C の main、Java・Kotlin などのクラス内の static main、C# の Main
+				Entry: def.Name == "main" || (def.Name == "Main" && file.Language == "csharp"),
+			})
+			fn := &nameCallFunction{id: id, def: def, file: file, start: def.Line, end: end}
+			key := callGraphFamily(file.Language) + ":" + def.Name
+			byName[key] = append(byName[key], fn)
+			perFile[file.ID] = append(perFile[file.ID], fn)
+		}
+	}
+
+	for i := range files {
+		file := &files[i]
+		functions := perFile[file.ID]
+		if file.Content == "" || (len(functions) == 0 && !scriptLanguages[file.Language]) || symbolRules[file.Language] == nil {
+			continue
+		}
+		family := callGraphFamily(file.Language)
+		moduleID := file.Name + ":<module>"
+
+		for ln, line := range strings.Split(MaskSource(file.Language, file.Content), "\n") {
+			lineNo := ln + 1
+			// 行を含む最も内側（開始行が最も後ろ）の関数を呼び出し元とする
+			var caller *nameCallFunction
+			for _, fn := range functions {
+				if fn.start <= lineNo && lineNo <= fn.end && (caller == nil || fn.start > caller.start) {
+					caller = fn
+				}
+			}
+
+			for _, m := range callSiteRe.FindAllStringSubmatchIndex(line, -1) {
+				name := line[m[2]:m[3]]
+				if symbolKeywords[name] {
+					continue
+				}
+				// 定義自体の 名前( は呼び出しではない
+				if caller != nil && caller.start == lineNo && caller.def.Column == m[2]+1 {
+					continue
+				}
+				candidates := byName[family+":"+name]
+				if len(candidates) == 0 {
+					continue
+				}
+
+				callerID := ""
+				callerContainer := ""
+				if caller != nil {
+					callerID, callerContainer = caller.id, caller.def.Container
+				} else if scriptLanguages[file.Language] {
+					b.addNode(CallGraphNode{ID: moduleID, Name: "<module>", FileID: file.ID, File: file.Name, Line: 1, Language: file.Language, Entry: true})
+					callerID = moduleID
+				} else {
+					continue
+				}
+
+				receiver, member := callReceiver(line[:m[2]])
+				switch {
+				case receiver == "this" || receiver == "self" || receiver == "$this" || (!member && implicitReceiverLanguages[file.Language]):
+					// 自分自身のメソッド呼び出しは同じクラスの定義を優先する
+					if same := filterCallTargets(candidates, func(fn *nameCallFunction) bool {
+						return callerContainer != "" && fn.def.Container == callerContainer
+					}); len(same) > 0 {
+						candidates = same
+					}
+				case !member:
+					// 修飾なしの呼び出しはメソッドではない
+					candidates = filterCallTargets(candidates, func(fn *nameCallFunction) bool { return fn.def.Kind == "function" })
+				}
+				if len(candidates) > 1 {
+					if local := filterCallTargets(candidates, func(fn *nameCallFunction) bool { return fn.file.ID == file.ID }); len(local) > 0 {
+						candidates = local
+					}
+				}
+				if len(candidates) == 0 || len(candidates) > maxNameCallTargets {
+					continue
+				}
+				for _, target := range candidates {
+					b.addEdge(callerID, target.id, lineNo, "name")
+				}
+			}
+		}
+	}
+}
+
+// functionEndLine 関数本体の最終行を求める（インデントの言語は字下げ、その他は対応する } まで）
+// 本体が見つからない宣言だけの関数は定義行だけを範囲とする
+func functionEndLine(language string, lines []string, def SymbolDef) int {
+	start := def.Line - 1
+	if start < 0 || start >= len(lines) {
+		return def.Line
+	}
+	if indentLanguages[language] {
+		indent := len(lines[start]) - len(strings.TrimLeft(lines[start], " \t"))
+		end := start
+		for i := start + 1; i < len(lines); i++ {
+			trimmed := strings.TrimLeft(lines[i], " \t")
+			if strings.TrimSpace(trimmed) == "" {
+				continue
+			}
+			if len(lines[i])-len(trimmed) <= indent {
+				break
+			}
+			end = i
+		}
+		return end + 1
+	}
+
+	depth, parens := 0, 0
+	col := def.Column - 1
+	for i := start; i < len(lines) && (depth > 0 || i < start+10); i++ {
+		line := lines[i]
+		from := 0
+		if i == start && col > 0 && col <= len(line) {
+			from = col
+		}
+		for _, c := range []byte(line[from:]) {
+			switch c {
+			case '{':
+				depth++
+			case '}':
+				if depth--; depth == 0 {
+					return i + 1
+				}
+				if depth < 0 {
+					return def.Line
+				}
+			case '(':
+				parens++
+			case ')':
+				parens--
+			case ';':
+				if depth == 0 {
+					return def.Line
+				}
+			case '=':
+				// Kotlin・Scala の式本体（fun f() = ...）
+				if depth == 0 && parens == 0 && (language == "kotlin" || language == "scala") {
+					return def.Line
+				}
+			}
+		}
+	}
+	return def.Line
+}
+
+// callReceiver 呼び出しの直前にある . -> :: の左側の識別子を返す
+func callReceiver(before string) (string, bool) {
+	before = strings.TrimRight(before, " \t")
+	var rest string
+	switch {
+	case strings.HasSuffix(before, "?."):
+		rest = before[:len(before)-2]
+	case strings.HasSuffix(before, "."):
+		rest = before[:len(before)-1]
+	case strings.HasSuffix(before, "->"), strings.HasSuffix(before, "::"):
+		rest = before[:len(before)-2]
+	default:
+		return "", false
+	}
+	rest = strings.TrimRight(rest, " \t")
+	i := len(rest)
+	for i > 0 && isCallIdentByte(rest[i-1]) {
+		i--
+	}
+	return rest[i:], true
+}
+
+func isCallIdentByte(c byte) bool {
+	return c == '_' || c == '$' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func filterCallTargets(candidates []*nameCallFunction, keep func(*nameCallFunction) bool) []*nameCallFunction {
+	var out []*nameCallFunction
+	for _, fn := range candidates {
+		if keep(fn) {
+			out = append(out, fn)
+		}
+	}
+	return out
+}
+
+// runCallGraph プロジェクト全体の呼び出しグラフを作る
+func (w *AnalysisWorker) runCallGraph(files []models.File) (string, error) {
+	graph := BuildCallGraph(files)
+	if len(graph.Nodes) == 0 {
+		return "", fmt.Errorf("no functions found in project")
+	}
+
+	languages := make(map[string]int)
+	for _, node := range graph.Nodes {
+		languages[node.Language]++
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"graph": graph,
+		"summary": map[string]interface{}{
+			"nodes":        len(graph.Nodes),
+			"edges":        len(graph.Edges),
+			"entry_points": len(graph.EntryPoints),
+			"languages":    languages,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"sort"
+
+	"reverse-engineering-backend/models"
+)
+
+// goSourcePackage 型検査の単位（同じディレクトリ・同じパッケージ名のファイル）
+type goSourcePackage struct {
+	path     string
+	name     string
+	files    []*ast.File
+	sources  []*models.File
+	pkg      *types.Package
+	info     *types.Info
+	checking bool
+}
+
+// goProjectImporter プロジェクト内のパッケージは型検査した結果を返し、それ以外は空のパッケージとして扱う
+// 標準ライブラリや外部モジュールの関数は解決できないが、プロジェクト内の呼び出しは型に基づいて辿れる
+type goProjectImporter struct {
+	fset     *token.FileSet
+	byName   map[string]*goSourcePackage
+	external map[string]*types.Package
+}
+
+func (imp *goProjectImporter) Import(importPath string) (*types.Package, error) {
+	name := path.Base(importPath)
+	if sp, ok := imp.byName[name]; ok && !sp.checking {
+		imp.check(sp)
+		return sp.pkg, nil
+	}
+	if pkg, ok := imp.external[importPath]; ok {
+		return pkg, nil
+	}
+	pkg := types.NewPackage(importPath, name)
+	pkg.MarkComplete()
+	imp.external[importPath] = pkg
+	return pkg, nil
+}
+
+func (imp *goProjectImporter) check(sp *goSourcePackage) {
+	if sp.pkg != nil {
+		return
+	}
+	sp.checking = true
+	sp.info = &types.Info{
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+	}
+	conf := types.Config{
+		Importer:    imp,
+		FakeImportC: true,
+		// 解決できない import があるのは前提なので、エラーがあっても最後まで検査させる
+		Error: func(error) {},
+	}
+	sp.pkg, _ = conf.Check(sp.path, imp.fset, sp.files, sp.info)
+	sp.checking = false
+}
+
+// goProject 型検査したプロジェクト内の Go パッケージ
+type goProject struct {
+	fset     *token.FileSet
+	packages []*goSourcePackage // パスの順
+	pkgs     map[*types.Package]bool
+}
+
+// loadGoProject プロジェクト内の Go ソースをパッケージごとにまとめて型検査する（Go のファイルがなければ nil）
+func loadGoProject(files []models.File) *goProject {
+	fset := token.NewFileSet()
+	packages := make(map[string]*goSourcePackage)
+	var keys []string
+	for i := range files {
+		file := &files[i]
+		if file.Language != "go" || file.Content == "" {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file.Name, file.Content, parser.SkipObjectResolution)
+		if f == nil || (err != nil && len(f.Decls) == 0) {
+			continue
+		}
+		dir := path.Dir(file.Name)
+		pkgPath := f.Name.Name
+		if dir != "." {
+			pkgPath = dir
+			if path.Base(dir) != f.Name.Name {
+				pkgPath = dir + "/" + f.Name.Name
+			}
+		}
+		sp, ok := packages[pkgPath]
+		if !ok {
+			sp = &goSourcePackage{path: pkgPath, name: f.Name.Name}
+			packages[pkgPath] = sp
+			keys = append(keys, pkgPath)
+		}
+		sp.files = append(sp.files, f)
+		sp.sources = append(sp.sources, file)
+	}
+	if len(packages) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+
+	imp := &goProjectImporter{fset: fset, byName: make(map[string]*goSourcePackage), external: make(map[string]*types.Package)}
+	for _, key := range keys {
+		sp := packages[key]
+		if _, ok := imp.byName[sp.name]; !ok {
+			imp.byName[sp.name] = sp
+		}
+	}
+	p := &goProject{fset: fset, pkgs: make(map[*types.Package]bool)}
+	for _, key := range keys {
+		sp := packages[key]
+		imp.check(sp)
+		p.packages = append(p.packages, sp)
+		p.pkgs[sp.pkg] = true
+	}
+	return p
+}
+
+// namedTypes プロジェクトで定義された名前付きの型（エイリアスを除く）
+func (p *goProject) namedTypes() []*types.Named {
+	var named []*types.Named
+	for _, sp := range p.packages {
+		scope := sp.pkg.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() {
+				continue
+			}
+			if n, ok := tn.Type().(*types.Named); ok {
+				named = append(named, n)
+			}
+		}
+	}
+	return named
+}
+
+// addGoCallGraph Go のソースを go/types で型検査し、呼び出し先を解決して辺を追加する
+// インターフェースのメソッド呼び出しはプロジェクト内の実装すべてへの辺にする
+func addGoCallGraph(b *callGraphBuilder, files []models.File) {
+	p := loadGoProject(files)
+	if p == nil {
+		return
+	}
+	fset, projectPkgs := p.fset, p.pkgs
+	var named []*types.Named
+	for _, n := range p.namedTypes() {
+		if n.TypeParams().Len() == 0 && !types.IsInterface(n) {
+			named = append(named, n)
+		}
+	}
+	implCache := make(map[*types.Func][]string)
+	implementations := func(method *types.Func) []string {
+		if ids, ok := implCache[method]; ok {
+			return ids
+		}
+		var ids []string
+		iface, _ := method.Type().(*types.Signature).Recv().Type().Underlying().(*types.Interface)
+		if iface != nil {
+			for _, n := range named {
+				ptr := types.NewPointer(n)
+				if !types.Implements(n, iface) && !types.Implements(ptr, iface) {
+					continue
+				}
+				obj, _, _ := types.LookupFieldOrMethod(ptr, false, method.Pkg(), method.Name())
+				if fn, ok := obj.(*types.Func); ok && projectPkgs[fn.Pkg()] {
+					ids = append(ids, fn.FullName())
+				}
+			}
+		}
+		implCache[method] = ids
+		return ids
+	}
+
+	for _, sp := range p.packages {
+		for i, f := range sp.files {
+			source := sp.sources[i]
+			for _, decl := range f.Decls {
+				fd, ok := decl.(*ast.FuncDecl)
+				if !ok {
+					continue
+				}
+				id := goFuncNodeID(sp, fd)
+				container := ""
+				if fd.Recv != nil && len(fd.Recv.List) > 0 {
+					container = goReceiverName(fd.Recv.List[0].Type)
+				}
+				b.addNode(CallGraphNode{
+					ID:        id,
+					Name:      fd.Name.Name,
+					Container: container,
+					Package:   sp.name,
+					FileID:    source.ID,
+					File:      source.Name,
+					Line:      fset.Position(fd.Pos()).Line,
+					Language:  "go",
+					Entry:     fd.Recv == nil && (fd.Name.Name == "init" || (fd.Name.Name == "main" && sp.name == "main")),
+				})
+				if fd.Body == nil {
+					continue
+				}
+				ast.Inspect(fd.Body, func(n ast.Node) bool {
+					call, ok := n.(*ast.CallExpr)
+					if !ok {
+						return true
+					}
+					fn := goCallee(sp.info, call.Fun)
+					if fn == nil || !projectPkgs[fn.Pkg()] {
+						return true
+					}
+					line := fset.Position(call.Pos()).Line
+					if recv := fn.Type().(*types.Signature).Recv(); recv != nil && types.IsInterface(recv.Type()) {
+						for _, target := range implementations(fn) {
+							b.addEdge(id, target, line, "interface")
+						}
+						return true
+					}
+					b.addEdge(id, fn.FullName(), line, "static")
+					return true
+				})
+			}
+		}
+	}
+}
+
+// goFuncNodeID 関数のノード ID（types.Func.FullName と同じ形式。init は複数あり得るので1つにまとめる）
+func goFuncNodeID(sp *goSourcePackage, fd *ast.FuncDecl) string {
+	if fn, ok := sp.info.Defs[fd.Name].(*types.Func); ok && fd.Name.Name != "init" {
+		return fn.FullName()
+	}
+	if fd.Recv != nil && len(fd.Recv.List) > 0 {
+		recv := goReceiverName(fd.Recv.List[0].Type)
+		if _, ok := fd.Recv.List[0].Type.(*ast.StarExpr); ok {
+			recv = "*" + recv
+		}
+		return sp.path + ".(" + recv + ")." + fd.Name.Name
+	}
+	return sp.path + "." + fd.Name.Name
+}
+
+// goCallee 呼び出し式の関数部分から呼び出し先の関数を求める（関数値の呼び出しなど解決できない場合は nil）
+func goCallee(info *types.Info, fun ast.Expr) *types.Func {
+	var obj types.Object
+	switch f := ast.Unparen(fun).(type) {
+	case *ast.Ident:
+		obj = info.Uses[f]
+	case *ast.SelectorExpr:
+		if sel, ok := info.Selections[f]; ok {
+			obj = sel.Obj()
+		} else {
+			obj = info.Uses[f.Sel]
+		}
+	case *ast.IndexExpr:
+		return goCallee(info, f.X)
+	case *ast.IndexListExpr:
+		return goCallee(info, f.X)
+	}
+	fn, ok := obj.(*types.Func)
+	if !ok || fn.Pkg() == nil {
+		return nil
+	}
+	return fn.Origin()
+}
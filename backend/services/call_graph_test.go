@@ -0,0 +1,163 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"reverse-engineering-backend/models"
+)
+
+// testCallGraphFiles main から store パッケージのインターフェースを経由して保存する Go のコードと、Python のスクリプト
+func testCallGraphFiles() []models.File {
+	return []models.File{
+		{ID: 1, Name: "main.go", Language: "go", Content: `package main
+
+import "app/store"
+
+func main() {
+	s := store.New()
+	run(s)
+	run(s)
+}
+
+func run(s store.Store) {
+	s.Save("x")
+	helper()
+}
+
+func helper() {}
+`},
+		{ID: 2, Name: "store/store.go", Language: "go", Content: `package store
+
+type Store interface {
+	Save(key string) error
+}
+
+type memory struct{}
+
+func New() Store { return &memory{} }
+
+func (m *memory) Save(key string) error {
+	return m.validate(key)
+}
+
+func (m *memory) validate(key string) error { return nil }
+`},
+		{ID: 3, Name: "tool.py", Language: "python", Content: `def load(path):
+    return parse(path)
+
+def parse(path):
+    return path
+
+class Job:
+    def run(self):
+        return self.step()
+
+    def step(self):
+        return load("x")
+
+load("config")
+`},
+	}
+}
+
+func TestBuildCallGraph(t *testing.T) {
+	g := BuildCallGraph(testCallGraphFiles())
+
+	var edges []string
+	for _, e := range g.Edges {
+		edges = append(edges, e.From+" -> "+e.To+" ("+e.Kind+")")
+	}
+	want := []string{
+		"main.main -> store.New (static)",
+		"main.main -> main.run (static)",
+		"main.run -> main.helper (static)",
+		"main.run -> (*store.memory).Save (interface)",
+		"(*store.memory).Save -> (*store.memory).validate (static)",
+		"tool.py:<module> -> tool.py:load (name)",
+		"tool.py:Job.run -> tool.py:Job.step (name)",
+		"tool.py:Job.step -> tool.py:load (name)",
+		"tool.py:load -> tool.py:parse (name)",
+	}
+	for _, w := range want {
+		if !containsString(edges, w) {
+			t.Errorf("edge %q not found in %q", w, edges)
+		}
+	}
+	if len(edges) != len(want) {
+		t.Errorf("got %d edges, want %d: %q", len(edges), len(want), edges)
+	}
+	for _, e := range g.Edges {
+		if e.From == "main.main" && e.To == "main.run" && (e.Count != 2 || e.Line != 7) {
+			t.Errorf("main -> run = %+v, want 2 calls from line 7", e)
+		}
+	}
+	if want := []string{"main.main", "tool.py:<module>"}; !reflect.DeepEqual(g.EntryPoints, want) {
+		t.Errorf("entry points = %v, want %v", g.EntryPoints, want)
+	}
+	if ids := g.FindNodes("memory.Save"); !reflect.DeepEqual(ids, []string{"(*store.memory).Save"}) {
+		t.Errorf("FindNodes(memory.Save) = %v", ids)
+	}
+	if ids := g.FindNodes("run"); len(ids) != 2 {
+		t.Errorf("FindNodes(run) = %v", ids)
+	}
+}
+
+func TestCallGraphQueries(t *testing.T) {
+	g := BuildCallGraph(testCallGraphFiles())
+
+	callers := g.Callers(g.FindNodes("validate"), 2)
+	var ids []string
+	for _, n := range callers.Nodes {
+		ids = append(ids, n.ID)
+	}
+	if want := []string{"main.run", "(*store.memory).Save", "(*store.memory).validate"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("callers = %v, want %v", ids, want)
+	}
+	if len(callers.Edges) != 2 || len(callers.EntryPoints) != 0 {
+		t.Errorf("callers graph = %+v", callers)
+	}
+
+	paths := g.Paths(g.FindNodes("main"), g.FindNodes("validate"), 10, 10)
+	if want := [][]string{{"main.main", "main.run", "(*store.memory).Save", "(*store.memory).validate"}}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("paths = %v, want %v", paths, want)
+	}
+	if short := g.Paths(g.FindNodes("main"), g.FindNodes("validate"), 10, 3); len(short) != 0 {
+		t.Errorf("paths longer than the limit = %v", short)
+	}
+	if sub := g.PathsGraph(paths); len(sub.Nodes) != 4 || len(sub.Edges) != 3 || !reflect.DeepEqual(sub.EntryPoints, []string{"main.main"}) {
+		t.Errorf("paths graph = %+v", sub)
+	}
+}
+
+func TestCallGraphExport(t *testing.T) {
+	g := &CallGraph{
+		Nodes: []CallGraphNode{
+			{ID: "main.main", Name: "main", Package: "main", File: "main.go", Line: 3, Entry: true},
+			{ID: `a"b`, Name: "Get<T>", Container: "Repo"},
+		},
+		Edges:       []CallGraphEdge{{From: "main.main", To: `a"b`, Kind: "interface"}},
+		EntryPoints: []string{"main.main"},
+	}
+	dot := g.DOT()
+	for _, want := range []string{
+		"digraph callgraph {",
+		`"main.main" [label="main.main", tooltip="main.go:3", style=bold`,
+		`"a\"b" [label="Repo.Get<T>"];`,
+		`"main.main" -> "a\"b" [style=dashed];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT() does not contain %q:\n%s", want, dot)
+		}
+	}
+	want := "flowchart LR\n" +
+		"  n0[\"main.main\"]\n" +
+		"  n1[\"Repo.Get#lt;T#gt;\"]\n" +
+		"  n0 -.-> n1\n" +
+		"  classDef entry stroke:#1f6feb,stroke-width:2px\n" +
+		"  class n0 entry\n"
+	if got := g.Mermaid(); got != want {
+		t.Errorf("Mermaid() = %q, want %q", got, want)
+	}
+}
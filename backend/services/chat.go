@@ -0,0 +1,355 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"reverse-engineering-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// 会話で資料に含める量
+const (
+	chatCodeSources     = 6    // 意味検索で選ぶコード片の数
+	chatSymbolSources   = 4    // 質問に名前が出てきたシンボルの定義の数
+	chatSymbolLines     = 30   // シンボルの定義から資料に含める行数
+	chatAnalysisSources = 3    // 直近の解析結果の数（種類ごとに1つ）
+	chatAnalysisChars   = 1500 // 解析結果から資料に含める文字数
+	chatHistoryMessages = 10   // AI に渡す会話の履歴の数
+	chatTitleLength     = 60
+)
+
+// chatAnalysisTypes 会話の資料にする解析の種類（結果がコードの説明になっているもの）
+var chatAnalysisTypes = []string{
+	"code_analysis", "documentation", "pattern_detection", "dependency_map", "api_discovery",
+	"schema_recovery", "call_graph", "secret_scan", "vulnerability_scan", "license_scan",
+}
+
+// chatCitationPattern 回答中の [1] や [2, 3] のような資料の番号
+var chatCitationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// chatIdentifierPattern 質問の中の識別子らしい語
+var chatIdentifierPattern = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]{2,}`)
+
+// ChatCitation 回答が根拠にした資料（kind が file ならファイルの行の範囲、analysis なら解析結果）
+type ChatCitation struct {
+	Index        int    `json:"index"`
+	Kind         string `json:"kind"`
+	FileID       uint   `json:"file_id,omitempty"`
+	FileName     string `json:"file_name,omitempty"`
+	StartLine    int    `json:"start_line,omitempty"`
+	EndLine      int    `json:"end_line,omitempty"`
+	Symbol       string `json:"symbol,omitempty"`
+	AnalysisID   uint   `json:"analysis_id,omitempty"`
+	AnalysisType string `json:"analysis_type,omitempty"`
+}
+
+// Label 回答の末尾の参照一覧に載せる表記
+func (c ChatCitation) Label() string {
+	if c.Kind == "analysis" {
+		return fmt.Sprintf("%s analysis #%d", c.AnalysisType, c.AnalysisID)
+	}
+	return fmt.Sprintf("%s:%d-%d", c.FileName, c.StartLine, c.EndLine)
+}
+
+// ChatSource AI に渡す資料
+type ChatSource struct {
+	Citation ChatCitation
+	Text     string
+}
+
+// ChatMessageView 保存した発言に参照を展開したもの
+type ChatMessageView struct {
+	models.Message
+	Citations []ChatCitation `json:"citations"`
+	Uncited   bool           `json:"uncited,omitempty"` // 資料を1つも示さなかった回答（根拠を確かめられない）
+}
+
+// ChatReply 質問に対する回答
+type ChatReply struct {
+	Conversation models.Conversation `json:"conversation"`
+	Question     ChatMessageView     `json:"question"`
+	Answer       ChatMessageView     `json:"answer"`
+}
+
+// ViewChatMessage 参照の JSON を展開する
+func ViewChatMessage(message models.Message) ChatMessageView {
+	view := ChatMessageView{Message: message, Citations: []ChatCitation{}}
+	if message.Citations != "" {
+		_ = json.Unmarshal([]byte(message.Citations), &view.Citations)
+	}
+	view.Uncited = message.Role == "assistant" && len(view.Citations) == 0
+	return view
+}
+
+// StartConversation 最初の質問を題名にして会話を作る
+func StartConversation(db *gorm.DB, projectID uint, question string) (models.Conversation, error) {
+	title := strings.Join(strings.Fields(question), " ")
+	if utf8.RuneCountInString(title) > chatTitleLength {
+		title = string([]rune(title)[:chatTitleLength]) + "…"
+	}
+	conversation := models.Conversation{ProjectID: projectID, Title: title}
+	return conversation, db.Create(&conversation).Error
+}
+
+// AnswerChat 質問に関係するコード片・シンボル・解析結果を集めて AI に答えさせ、質問と回答を会話に保存する
+// 回答には示した資料の参照一覧（ファイル名と行の範囲）を付け、資料を示さなかった回答にはその旨を付ける
+// onDelta には回答を生成された順に渡す
+func AnswerChat(ctx context.Context, db *gorm.DB, ai *AIService, embeddings *EmbeddingService, conversation models.Conversation, question string, onDelta func(string)) (*ChatReply, error) {
+	var previous []models.Message
+	if err := db.Where("conversation_id = ?", conversation.ID).Order("id DESC").Limit(chatHistoryMessages).Find(&previous).Error; err != nil {
+		return nil, err
+	}
+	history := make([]ChatTurn, 0, len(previous))
+	for i := len(previous) - 1; i >= 0; i-- {
+		history = append(history, ChatTurn{Role: previous[i].Role, Content: previous[i].Content})
+	}
+
+	sources, err := RetrieveChatSources(ctx, db, embeddings, conversation.ProjectID, question)
+	if err != nil {
+		return nil, err
+	}
+	// プロジェクトの出力言語と、プロジェクト・チームで上書きしたテンプレートを使う
+	language := ResolveOutputLanguage(db, conversation.ProjectID, "")
+	ai = ai.WithPrompts(NewPromptSet(db, conversation.ProjectID, language, nil))
+	answer, err := ai.AnswerQuestion(ctx, FormatChatSources(language, sources), history, question, onDelta)
+	if err != nil {
+		return nil, err
+	}
+
+	citations := CitedSources(answer, sources)
+	footer := chatReferenceFooter(language, citations)
+	answer += footer
+	if onDelta != nil {
+		onDelta(footer)
+	}
+	citationsJSON, err := json.Marshal(citations)
+	if err != nil {
+		return nil, err
+	}
+
+	// 回答できたときだけ質問と回答をそろえて保存する
+	questionMessage := models.Message{ConversationID: conversation.ID, Role: "user", Content: question, Citations: "[]"}
+	answerMessage := models.Message{ConversationID: conversation.ID, Role: "assistant", Content: answer, Citations: string(citationsJSON)}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&questionMessage).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&answerMessage).Error; err != nil {
+			return err
+		}
+		return tx.Model(&conversation).Update("updated_at", answerMessage.CreatedAt).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChatReply{
+		Conversation: conversation,
+		Question:     ViewChatMessage(questionMessage),
+		Answer:       ViewChatMessage(answerMessage),
+	}, nil
+}
+
+// RetrieveChatSources 意味検索のコード片、質問に名前が出てきたシンボルの定義、直近の解析結果を資料にする
+func RetrieveChatSources(ctx context.Context, db *gorm.DB, embeddings *EmbeddingService, projectID uint, question string) ([]ChatSource, error) {
+	var sources chatSources
+
+	symbols, err := questionSymbols(db, projectID, question)
+	if err != nil {
+		return nil, err
+	}
+	for _, symbol := range symbols {
+		var file models.File
+		if err := db.Select("id, name, content").First(&file, symbol.FileID).Error; err != nil {
+			continue
+		}
+		sources.addSymbol(&file, symbol)
+	}
+
+	results, err := SearchCode(ctx, db, embeddings, projectID, question, "", chatCodeSources)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		sources.addSearchResult(r)
+	}
+
+	var analyses []models.Analysis
+	if err := db.Select("id, type, result, updated_at").
+		Where("project_id = ? AND status = ? AND type IN ?", projectID, "completed", chatAnalysisTypes).
+		Order("updated_at DESC").Limit(50).Find(&analyses).Error; err != nil {
+		return nil, err
+	}
+	sources.addAnalyses(analyses)
+	return sources, nil
+}
+
+// chatSources 資料を集めながら 1 からの番号を振る
+type chatSources []ChatSource
+
+func (s *chatSources) add(citation ChatCitation, text string) {
+	citation.Index = len(*s) + 1
+	*s = append(*s, ChatSource{Citation: citation, Text: text})
+}
+
+// overlaps 同じファイルの重なる範囲は1つの資料で足りる
+func (s chatSources) overlaps(fileID uint, start, end int) bool {
+	for _, source := range s {
+		c := source.Citation
+		if c.Kind == "file" && c.FileID == fileID && start <= c.EndLine && c.StartLine <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// addSymbol シンボルの定義から chatSymbolLines 行を資料にする
+func (s *chatSources) addSymbol(file *models.File, symbol models.Symbol) {
+	lines := strings.Split(file.Content, "\n")
+	start := max(symbol.Line, 1)
+	end := min(start+chatSymbolLines-1, len(lines))
+	if start > end || s.overlaps(file.ID, start, end) {
+		return
+	}
+	s.add(ChatCitation{Kind: "file", FileID: file.ID, FileName: file.Name, StartLine: start, EndLine: end, Symbol: symbol.Name},
+		numberLines(lines[start-1:end], start))
+}
+
+// addSearchResult 意味検索のコード片を資料にする
+func (s *chatSources) addSearchResult(r CodeSearchResult) {
+	if s.overlaps(r.FileID, r.StartLine, r.EndLine) {
+		return
+	}
+	s.add(ChatCitation{Kind: "file", FileID: r.FileID, FileName: r.FileName, StartLine: r.StartLine, EndLine: r.EndLine},
+		numberLines(strings.Split(r.Snippet, "\n"), r.StartLine))
+}
+
+// addAnalyses 新しい順の解析から、種類ごとに最新の結果を chatAnalysisSources 個まで資料にする
+func (s *chatSources) addAnalyses(analyses []models.Analysis) {
+	seen := make(map[string]bool)
+	for _, analysis := range analyses {
+		if seen[analysis.Type] || strings.TrimSpace(analysis.Result) == "" {
+			continue
+		}
+		seen[analysis.Type] = true
+		text := analysis.Result
+		if utf8.RuneCountInString(text) > chatAnalysisChars {
+			text = string([]rune(text)[:chatAnalysisChars]) + "…"
+		}
+		s.add(ChatCitation{Kind: "analysis", AnalysisID: analysis.ID, AnalysisType: analysis.Type}, text)
+		if len(seen) >= chatAnalysisSources {
+			break
+		}
+	}
+}
+
+// questionSymbols 質問に含まれる識別子らしい語と同じ名前のシンボルの定義
+func questionSymbols(db *gorm.DB, projectID uint, question string) ([]models.Symbol, error) {
+	names := questionSymbolNames(question)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	var symbols []models.Symbol
+	err := db.Where("project_id = ? AND LOWER(name) IN ?", projectID, names).
+		Order("kind IN ('function', 'method', 'class', 'struct', 'interface') DESC, name, file_id, line").
+		Limit(chatSymbolSources).Find(&symbols).Error
+	return symbols, err
+}
+
+// questionSymbolNames 質問の中のシンボル名らしい語（小文字にして重複を除く）
+func questionSymbolNames(question string) []string {
+	var names []string
+	for _, word := range chatIdentifierPattern.FindAllString(question, -1) {
+		// 普通の英単語と区別できるよう、大文字・数字・_ を含む語か、4文字以上の語に限る
+		if strings.ToLower(word) == word && len(word) < 4 || chatStopWords[strings.ToLower(word)] {
+			continue
+		}
+		if !containsString(names, strings.ToLower(word)) {
+			names = append(names, strings.ToLower(word))
+		}
+	}
+	return names
+}
+
+// chatStopWords シンボル名として探さない英単語
+var chatStopWords = map[string]bool{
+	"what": true, "where": true, "which": true, "when": true, "does": true, "work": true, "works": true,
+	"this": true, "that": true, "there": true, "these": true, "those": true, "with": true, "from": true,
+	"have": true, "into": true, "about": true, "code": true, "file": true, "files": true, "used": true,
+	"uses": true, "using": true, "they": true, "them": true, "their": true, "should": true, "would": true,
+	"could": true, "how": true, "why": true, "who": true, "the": true, "and": true, "for": true, "are": true,
+	"app": true, "application": true, "explain": true, "show": true, "find": true, "logic": true,
+}
+
+// FormatChatSources 資料を番号付きで並べる（コード片には行番号を付ける。見出しは lang の言語で書く）
+func FormatChatSources(lang string, sources []ChatSource) string {
+	if len(sources) == 0 {
+		return localize(lang, "（関係する資料は見つかりませんでした）")
+	}
+	var sb strings.Builder
+	for _, source := range sources {
+		c := source.Citation
+		switch {
+		case c.Kind == "analysis":
+			fmt.Fprintf(&sb, localize(lang, "[%d] %s の解析結果\n"), c.Index, c.AnalysisType)
+		case c.Symbol != "":
+			fmt.Fprintf(&sb, localize(lang, "[%d] %s（%s の定義）\n"), c.Index, c.Label(), c.Symbol)
+		default:
+			fmt.Fprintf(&sb, "[%d] %s\n", c.Index, c.Label())
+		}
+		sb.WriteString("```\n")
+		sb.WriteString(strings.TrimRight(source.Text, "\n"))
+		sb.WriteString("\n```\n\n")
+	}
+	return sb.String()
+}
+
+// CitedSources 回答が番号で示した資料（示さなかった資料を根拠として補うことはしない）
+func CitedSources(answer string, sources []ChatSource) []ChatCitation {
+	cited := make(map[int]bool)
+	for _, m := range chatCitationPattern.FindAllStringSubmatch(answer, -1) {
+		for _, part := range strings.Split(m[1], ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && n >= 1 && n <= len(sources) {
+				cited[n] = true
+			}
+		}
+	}
+	citations := []ChatCitation{}
+	for _, source := range sources {
+		if cited[source.Citation.Index] {
+			citations = append(citations, source.Citation)
+		}
+	}
+	sort.SliceStable(citations, func(i, j int) bool { return citations[i].Index < citations[j].Index })
+	return citations
+}
+
+// chatReferenceFooter 回答の末尾に付ける参照一覧（資料を示さなかった回答にはその旨）
+func chatReferenceFooter(lang string, citations []ChatCitation) string {
+	if len(citations) == 0 {
+		return localize(lang, "\n\n（この回答は資料を示していません。内容はコードで確かめてください）\n")
+	}
+	var sb strings.Builder
+	sb.WriteString(localize(lang, "\n\n参照:\n"))
+	for _, c := range citations {
+		fmt.Fprintf(&sb, "[%d] %s\n", c.Index, c.Label())
+	}
+	return sb.String()
+}
+
+// numberLines 行番号を付ける
+func numberLines(lines []string, first int) string {
+	var sb strings.Builder
+	for i, line := range lines {
+		fmt.Fprintf(&sb, "%d| %s\n", first+i, strings.TrimSuffix(line, "\r"))
+	}
+	return sb.String()
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"reverse-engineering-backend/models"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestQuestionSymbolNames(t *testing.T) {
+	tests := []struct {
+		question string
+		want     []string
+	}{
+		{"What does parseConfig do?", []string{"parseconfig"}},
+		// 小文字だけの短い語・よくある英単語は探さない
+		{"how does the app work", nil},
+		{"Where is load_user used? Is load_user exported?", []string{"load_user", "exported"}},
+		{"Explain Handler and handler", []string{"handler"}},
+		{"token と refresh の関係は", []string{"token", "refresh"}},
+	}
+	for _, tt := range tests {
+		if got := questionSymbolNames(tt.question); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("questionSymbolNames(%q) = %v, want %v", tt.question, got, tt.want)
+		}
+	}
+}
+
+func TestChatSources(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 100; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	file := &models.File{ID: 7, Name: "main.go", Content: strings.Join(lines, "\n")}
+
+	var sources chatSources
+	sources.addSymbol(file, models.Symbol{Name: "run", Line: 10})
+	// シンボルの定義と重なるコード片は加えない
+	sources.addSearchResult(CodeSearchResult{FileID: 7, FileName: "main.go", StartLine: 31, EndLine: 40, Snippet: "line 31"})
+	sources.addSearchResult(CodeSearchResult{FileID: 7, FileName: "main.go", StartLine: 40, EndLine: 45, Snippet: "line 40\nline 41"})
+	sources.addSearchResult(CodeSearchResult{FileID: 8, FileName: "util.go", StartLine: 1, EndLine: 5, Snippet: "a"})
+	// 範囲外の行を指すシンボルは使わない
+	sources.addSymbol(file, models.Symbol{Name: "gone", Line: 500})
+	sources.addAnalyses([]models.Analysis{
+		{ID: 5, Type: "code_analysis", Result: strings.Repeat("x", chatAnalysisChars+10)},
+		{ID: 4, Type: "code_analysis", Result: "older"},
+		{ID: 3, Type: "documentation", Result: "  "},
+		{ID: 2, Type: "call_graph", Result: "graph"},
+		{ID: 1, Type: "dependency_map", Result: "deps"},
+		{ID: 0, Type: "secret_scan", Result: "over the limit"},
+	})
+
+	var got []string
+	for i, s := range sources {
+		if s.Citation.Index != i+1 {
+			t.Errorf("source %d has index %d", i, s.Citation.Index)
+		}
+		got = append(got, s.Citation.Label())
+	}
+	want := []string{
+		"main.go:10-39",
+		"main.go:40-45",
+		"util.go:1-5",
+		"code_analysis analysis #5",
+		"call_graph analysis #2",
+		"dependency_map analysis #1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sources = %v, want %v", got, want)
+	}
+	if c := sources[0].Citation; c.Symbol != "run" || !strings.HasPrefix(sources[0].Text, "10| line 10\n11| line 11\n") {
+		t.Errorf("symbol source = %+v %q", c, sources[0].Text)
+	}
+	if text := sources[1].Text; text != "40| line 40\n41| line 41\n" {
+		t.Errorf("search result text = %q", text)
+	}
+	if text := sources[3].Text; !strings.HasSuffix(text, "…") || len([]rune(text)) != chatAnalysisChars+1 {
+		t.Errorf("analysis text is not truncated: %d runes", len([]rune(text)))
+	}
+}
+
+func TestCitedSources(t *testing.T) {
+	sources := []ChatSource{
+		{Citation: ChatCitation{Index: 1, Kind: "file", FileName: "a.go", StartLine: 1, EndLine: 5}},
+		{Citation: ChatCitation{Index: 2, Kind: "file", FileName: "b.go", StartLine: 3, EndLine: 9}},
+		{Citation: ChatCitation{Index: 3, Kind: "analysis", AnalysisID: 4, AnalysisType: "call_graph"}},
+	}
+	tests := []struct {
+		answer string
+		want   []int
+	}{
+		{"The handler is in a.go [1].", []int{1}},
+		{"See [3] and [2, 1]; again [2].", []int{1, 2, 3}},
+		// 資料に無い番号・番号でない括弧は無視する
+		{"Out of range [4] [0] [x] [1a]", nil},
+		// 番号を示さなかった回答に資料を補わない
+		{"I could not find it.", nil},
+	}
+	for _, tt := range tests {
+		var got []int
+		for _, c := range CitedSources(tt.answer, sources) {
+			got = append(got, c.Index)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("CitedSources(%q) = %v, want %v", tt.answer, got, tt.want)
+		}
+	}
+}
+
+func TestChatReferenceFooter(t *testing.T) {
+	citations := []ChatCitation{
+		{Index: 1, Kind: "file", FileName: "a.go", StartLine: 1, EndLine: 5},
+		{Index: 3, Kind: "analysis", AnalysisID: 4, AnalysisType: "call_graph"},
+	}
+	if got, want := chatReferenceFooter("en", citations), "\n\nReferences:\n[1] a.go:1-5\n[3] call_graph analysis #4\n"; got != want {
+		t.Errorf("footer = %q, want %q", got, want)
+	}
+	if got := chatReferenceFooter("ja", citations); !strings.HasPrefix(got, "\n\n参照:\n[1] a.go:1-5\n") {
+		t.Errorf("footer = %q", got)
+	}
+	// 資料を示さなかった回答にはその旨を書く
+	if got := chatReferenceFooter("en", nil); !strings.Contains(got, "does not cite any source") {
+		t.Errorf("uncited footer = %q", got)
+	}
+}
+
+func TestViewChatMessage(t *testing.T) {
+	cited := ViewChatMessage(models.Message{Role: "assistant", Citations: `[{"index":1,"kind":"file","file_name":"a.go","start_line":1,"end_line":2}]`})
+	if cited.Uncited || len(cited.Citations) != 1 || cited.Citations[0].FileName != "a.go" {
+		t.Errorf("cited answer = %+v", cited)
+	}
+	if uncited := ViewChatMessage(models.Message{Role: "assistant", Citations: "[]"}); !uncited.Uncited {
+		t.Error("answer without citations is not marked as uncited")
+	}
+	if question := ViewChatMessage(models.Message{Role: "user", Citations: "[]"}); question.Uncited || question.Citations == nil {
+		t.Errorf("question = %+v", question)
+	}
+}
+
+func TestFormatChatSources(t *testing.T) {
+	sources := []ChatSource{
+		{Citation: ChatCitation{Index: 1, Kind: "file", FileName: "a.go", StartLine: 1, EndLine: 2, Symbol: "run"}, Text: "1| func run() {\n2| }\n"},
+		{Citation: ChatCitation{Index: 2, Kind: "analysis", AnalysisID: 9, AnalysisType: "call_graph"}, Text: "{}"},
+	}
+	want := "[1] a.go:1-2 (definition of run)\n```\n1| func run() {\n2| }\n```\n\n" +
+		"[2] result of the call_graph analysis\n```\n{}\n```\n\n"
+	if got := FormatChatSources("en", sources); got != want {
+		t.Errorf("FormatChatSources() = %q, want %q", got, want)
+	}
+	if got := FormatChatSources("en", nil); got != "(no relevant sources were found)" {
+		t.Errorf("FormatChatSources(nil) = %q", got)
+	}
+}
+
+func TestAnswerQuestionStream(t *testing.T) {
+	deltas := []string{"The handler ", "is in a.go ", "[1]."}
+	var request openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &request)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, d := range append([]string{""}, deltas...) {
+			chunk, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+				Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: d}}},
+			})
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	config := openai.DefaultConfig("test")
+	config.BaseURL = server.URL
+	ai := &AIService{client: openai.NewClientWithConfig(config)}
+
+	var streamed []string
+	history := []ChatTurn{{Role: "user", Content: "earlier"}, {Role: "assistant", Content: "reply"}}
+	answer, err := ai.AnswerQuestion(context.Background(), "[1] a.go:1-5", history, "Where is the handler?", func(d string) {
+		streamed = append(streamed, d)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 空の差分は渡さず、受け取った順に渡す
+	if !reflect.DeepEqual(streamed, deltas) || answer != strings.Join(deltas, "") {
+		t.Errorf("streamed = %q, answer = %q", streamed, answer)
+	}
+
+	var roles []string
+	for _, m := range request.Messages {
+		roles = append(roles, m.Role)
+	}
+	if want := []string{"system", "user", "assistant", "user"}; !reflect.DeepEqual(roles, want) {
+		t.Errorf("roles = %v, want %v", roles, want)
+	}
+	if !request.Stream || !strings.Contains(request.Messages[0].Content, "[1] a.go:1-5") || request.Messages[3].Content != "Where is the handler?" {
+		t.Errorf("request = %+v", request)
+	}
+}
+
+func TestAnswerQuestionDemo(t *testing.T) {
+	// API キーが無いときは資料の見出しを並べ、番号付きで引用する
+	ai := &AIService{}
+	var streamed strings.Builder
+	answer, err := ai.AnswerQuestion(context.Background(), "[1] a.go:1-5\n```\ncode\n```\n", nil, "q", func(d string) { streamed.WriteString(d) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if streamed.String() != answer {
+		t.Errorf("streamed %q, answer %q", streamed.String(), answer)
+	}
+	if cited := CitedSources(answer, []ChatSource{{Citation: ChatCitation{Index: 1}}}); len(cited) != 1 {
+		t.Errorf("demo answer %q cites %v", answer, cited)
+	}
+}
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"reverse-engineering-backend/models"
+)
+
+// CloneFragment クローングループに含まれるコード片
+type CloneFragment struct {
+	ProjectID uint   `json:"project_id"`
+	FileID    uint   `json:"file_id"`
+	File      string `json:"file"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Tokens    int    `json:"tokens"`
+}
+
+// CloneGroup 互いに複製とみなせるコード片のまとまり
+// Type は含まれる組のうち最も緩い一致（type-1: 空白・コメント以外同一、type-2: 識別子・リテラルだけが違う、type-3: 文の追加・削除を含む）
+type CloneGroup struct {
+	ID           int             `json:"id"`
+	Type         string          `json:"type"`
+	Similarity   float64         `json:"similarity"` // 組ごとの一致したトークンの割合の最小値
+	Tokens       int             `json:"tokens"`
+	Lines        int             `json:"lines"`
+	CrossProject bool            `json:"cross_project"`
+	Fragments    []CloneFragment `json:"fragments"`
+}
+
+// cloneSource トークンに分けたファイル（external は比較対象として読み込んだ他のプロジェクトのファイル）
+type cloneSource struct {
+	file     models.File
+	tokens   []cloneToken
+	external bool
+}
+
+// cloneNode グループを作るためのコード片（同じファイルで大きく重なるコード片は1つにまとめる）
+type cloneNode struct {
+	source     int
+	start, end int
+	parent     int
+	cloneType  int
+	similarity float64
+}
+
+// runCloneDetection トークンの winnowing によるフィンガープリントでプロジェクト内（と指定した他のプロジェクトとの間）の重複コードを探す
+// 他のプロジェクトどうしの重複は報告せず、少なくとも1つのコード片がこのプロジェクトにあるグループだけを返す
+func (w *AnalysisWorker) runCloneDetection(analysis *models.Analysis, files []models.File) (string, error) {
+	options := w.optionsFor(analysis)
+	minTokens := cloneMinTokens
+	if options.CloneMinTokens > 0 {
+		minTokens = max(options.CloneMinTokens, cloneKGram)
+	}
+
+	var sources []cloneSource
+	add := func(file models.File, external bool) {
+		if file.Content == "" || !MetricsLanguages(file.Language) {
+			return
+		}
+		if tokens := tokenizeForClones(file.Language, file.Content); len(tokens) >= cloneKGram {
+			sources = append(sources, cloneSource{file: file, tokens: tokens, external: external})
+		}
+	}
+	for _, file := range files {
+		add(file, false)
+	}
+	if len(sources) == 0 {
+		return "", fmt.Errorf("no source files with a supported language found in project")
+	}
+	var compared []uint
+	for _, id := range options.CompareProjects {
+		if id == analysis.ProjectID || containsUint(compared, id) {
+			continue
+		}
+		var others []models.File
+		if err := w.db.Where("project_id = ?", id).Find(&others).Error; err != nil {
+			return "", fmt.Errorf("failed to fetch files of project %d: %w", id, err)
+		}
+		for _, file := range others {
+			add(file, true)
+		}
+		compared = append(compared, id)
+	}
+
+	// フィンガープリントの索引からファイルの組ごとに一致の起点を集める
+	type occurrence struct{ source, pos int }
+	index := make(map[uint64][]occurrence)
+	for i, src := range sources {
+		for _, fp := range winnowFingerprints(src.tokens) {
+			index[fp.hash] = append(index[fp.hash], occurrence{source: i, pos: fp.pos})
+		}
+	}
+	seeds := make(map[[2]int][][2]int)
+	for _, occurrences := range index {
+		if len(occurrences) < 2 || len(occurrences) > cloneMaxOccurrences {
+			continue
+		}
+		for i := 0; i < len(occurrences); i++ {
+			for j := i + 1; j < len(occurrences); j++ {
+				x, y := occurrences[i], occurrences[j]
+				if x.source > y.source || x.source == y.source && x.pos > y.pos {
+					x, y = y, x
+				}
+				a, b := sources[x.source], sources[y.source]
+				if a.external && b.external || derivedFrom(a.file, b.file) {
+					continue
+				}
+				key := [2]int{x.source, y.source}
+				seeds[key] = append(seeds[key], [2]int{x.pos, y.pos})
+			}
+		}
+	}
+
+	var nodes []*cloneNode
+	nodesBySource := make(map[int][]int)
+	find := func(i int) int {
+		for nodes[i].parent != i {
+			nodes[i].parent = nodes[nodes[i].parent].parent
+			i = nodes[i].parent
+		}
+		return i
+	}
+	nodeFor := func(source, start, end int) int {
+		for _, i := range nodesBySource[source] {
+			n := nodes[i]
+			overlap := min(n.end, end) - max(n.start, start)
+			if overlap*2 >= min(n.end-n.start, end-start) {
+				n.start, n.end = min(n.start, start), max(n.end, end)
+				return i
+			}
+		}
+		nodes = append(nodes, &cloneNode{source: source, start: start, end: end, parent: len(nodes), similarity: 1})
+		nodesBySource[source] = append(nodesBySource[source], len(nodes)-1)
+		return len(nodes) - 1
+	}
+
+	keys := make([][2]int, 0, len(seeds))
+	for key := range seeds {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, key := range keys {
+		a, b := sources[key[0]].tokens, sources[key[1]].tokens
+		for _, m := range findCloneMatches(a, b, seeds[key], key[0] == key[1]) {
+			if max(m.endA-m.startA, m.endB-m.startB) < minTokens {
+				continue
+			}
+			if a[m.endA-1].line-a[m.startA].line+1 < cloneMinLines || b[m.endB-1].line-b[m.startB].line+1 < cloneMinLines {
+				continue
+			}
+			cloneType := 2
+			switch {
+			case m.gapped:
+				cloneType = 3
+			case identicalTokens(a[m.startA:m.endA], b[m.startB:m.endB]):
+				cloneType = 1
+			}
+			x, y := nodeFor(key[0], m.startA, m.endA), nodeFor(key[1], m.startB, m.endB)
+			rx, ry := find(x), find(y)
+			if rx != ry {
+				nodes[ry].parent = rx
+				nodes[rx].cloneType = max(nodes[rx].cloneType, nodes[ry].cloneType)
+				nodes[rx].similarity = min(nodes[rx].similarity, nodes[ry].similarity)
+			}
+			nodes[rx].cloneType = max(nodes[rx].cloneType, cloneType)
+			nodes[rx].similarity = min(nodes[rx].similarity, m.similarity())
+		}
+	}
+
+	// グループにまとめ、このプロジェクトのコード片が重複している行を数える
+	members := make(map[int][]int)
+	for i := range nodes {
+		root := find(i)
+		members[root] = append(members[root], i)
+	}
+	duplicatedLines := make(map[int]map[int]bool)
+	var groups []CloneGroup
+	for root, ids := range members {
+		group := CloneGroup{Type: fmt.Sprintf("type-%d", nodes[root].cloneType), Similarity: roundMetric(nodes[root].similarity)}
+		internal := false
+		for _, id := range ids {
+			n := nodes[id]
+			src := sources[n.source]
+			fragment := CloneFragment{
+				ProjectID: src.file.ProjectID,
+				FileID:    src.file.ID,
+				File:      src.file.Name,
+				StartLine: src.tokens[n.start].line,
+				EndLine:   src.tokens[n.end-1].line,
+				Tokens:    n.end - n.start,
+			}
+			group.Fragments = append(group.Fragments, fragment)
+			group.Tokens = max(group.Tokens, fragment.Tokens)
+			group.Lines = max(group.Lines, fragment.EndLine-fragment.StartLine+1)
+			if src.external {
+				group.CrossProject = true
+			} else {
+				internal = true
+			}
+		}
+		if !internal || len(group.Fragments) < 2 {
+			continue
+		}
+		for _, id := range ids {
+			n := nodes[id]
+			if sources[n.source].external {
+				continue
+			}
+			if duplicatedLines[n.source] == nil {
+				duplicatedLines[n.source] = make(map[int]bool)
+			}
+			for _, t := range sources[n.source].tokens[n.start:n.end] {
+				duplicatedLines[n.source][t.line] = true
+			}
+		}
+		sort.Slice(group.Fragments, func(i, j int) bool {
+			a, b := group.Fragments[i], group.Fragments[j]
+			if a.ProjectID != b.ProjectID {
+				return a.ProjectID == analysis.ProjectID
+			}
+			if a.File != b.File {
+				return a.File < b.File
+			}
+			return a.StartLine < b.StartLine
+		})
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Tokens != groups[j].Tokens {
+			return groups[i].Tokens > groups[j].Tokens
+		}
+		a, b := groups[i].Fragments[0], groups[j].Fragments[0]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.StartLine < b.StartLine
+	})
+	byType := make(map[string]int)
+	crossProject := 0
+	for i := range groups {
+		groups[i].ID = i + 1
+		byType[groups[i].Type]++
+		if groups[i].CrossProject {
+			crossProject++
+		}
+	}
+	if groups == nil {
+		groups = []CloneGroup{}
+	}
+
+	fileReports := []map[string]interface{}{}
+	codeLines, duplicated, scanned := 0, 0, 0
+	for i, src := range sources {
+		if src.external {
+			continue
+		}
+		scanned++
+		lines := make(map[int]bool)
+		for _, t := range src.tokens {
+			lines[t.line] = true
+		}
+		codeLines += len(lines)
+		dup := len(duplicatedLines[i])
+		duplicated += dup
+		if dup == 0 {
+			continue
+		}
+		fileReports = append(fileReports, map[string]interface{}{
+			"file_id":          src.file.ID,
+			"name":             src.file.Name,
+			"code_lines":       len(lines),
+			"duplicated_lines": dup,
+			"duplication":      roundMetric(float64(dup) * 100 / float64(len(lines))),
+		})
+	}
+	sort.Slice(fileReports, func(i, j int) bool {
+		a, b := fileReports[i]["duplication"].(float64), fileReports[j]["duplication"].(float64)
+		if a != b {
+			return a > b
+		}
+		return fileReports[i]["name"].(string) < fileReports[j]["name"].(string)
+	})
+	duplication := 0.0
+	if codeLines > 0 {
+		duplication = roundMetric(float64(duplicated) * 100 / float64(codeLines))
+	}
+	if compared == nil {
+		compared = []uint{}
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"groups": groups,
+		"files":  fileReports,
+		"summary": map[string]interface{}{
+			"files_scanned":        scanned,
+			"code_lines":           codeLines,
+			"duplicated_lines":     duplicated,
+			"duplication":          duplication,
+			"groups":               len(groups),
+			"by_type":              byType,
+			"cross_project_groups": crossProject,
+			"compared_projects":    compared,
+			"min_tokens":           minTokens,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// derivedFrom 一方が他方から生成されたファイル（バンドルと分割したモジュールなど）か
+func derivedFrom(a, b models.File) bool {
+	return a.ParentID != nil && *a.ParentID == b.ID || b.ParentID != nil && *b.ParentID == a.ID
+}
+
+func containsUint(list []uint, v uint) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
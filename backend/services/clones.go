@@ -0,0 +1,302 @@
+package services
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// クローン検出の既定値
+const (
+	cloneKGram          = 15  // フィンガープリントにする正規化済みトークンの連なりの長さ
+	cloneWindow         = 8   // winnowing の窓の大きさ（k+w-1 トークン以上の一致は必ず見つかる）
+	cloneMinTokens      = 50  // クローンとして報告する最小のトークン数
+	cloneMinLines       = 5   // クローンとして報告する最小の行数
+	cloneMaxGap         = 30  // Type-3 として一続きにみなす、一致と一致の間のトークン数の上限
+	cloneMinSimilarity  = 0.7 // Type-3 のクローンで一致していなければならないトークンの割合
+	cloneMaxOccurrences = 64  // これより多くの場所に現れるフィンガープリントは定型句として比較に使わない
+)
+
+// cloneKeywords 正規化しても識別子に置き換えないキーワード（対応する言語のものをまとめたもの）
+var cloneKeywords = map[string]bool{
+	"if": true, "else": true, "elif": true, "for": true, "while": true, "do": true, "switch": true, "case": true,
+	"default": true, "break": true, "continue": true, "return": true, "goto": true, "try": true, "catch": true,
+	"except": true, "finally": true, "throw": true, "throws": true, "raise": true, "with": true, "yield": true,
+	"await": true, "async": true, "func": true, "function": true, "def": true, "fn": true, "fun": true,
+	"class": true, "struct": true, "interface": true, "enum": true, "trait": true, "impl": true, "type": true,
+	"var": true, "let": true, "const": true, "val": true, "static": true, "final": true, "public": true,
+	"private": true, "protected": true, "internal": true, "new": true, "delete": true, "this": true,
+	"self": true, "super": true, "import": true, "from": true, "package": true, "module": true, "export": true,
+	"in": true, "of": true, "is": true, "as": true, "not": true, "and": true, "or": true, "lambda": true,
+	"go": true, "defer": true, "select": true, "chan": true, "map": true, "range": true, "match": true,
+	"mut": true, "pub": true, "use": true, "where": true, "end": true, "then": true, "begin": true,
+	"unless": true, "until": true, "void": true, "null": true, "nil": true, "None": true, "true": true,
+	"false": true, "True": true, "False": true, "typeof": true, "instanceof": true, "extends": true,
+	"implements": true, "abstract": true, "override": true, "virtual": true, "namespace": true,
+}
+
+// cloneToken 元の表記と正規化した表記（識別子は $id、リテラルは $lit）
+type cloneToken struct {
+	raw  string
+	norm string
+	line int
+}
+
+// tokenizeForClones コメントと空白を除いてトークンに分け、Type-2 の比較用に識別子とリテラルを正規化する
+func tokenizeForClones(language, src string) []cloneToken {
+	syntax, ok := commentSyntaxes[language]
+	if !ok {
+		return nil
+	}
+	var tokens []cloneToken
+	line := 1
+	emit := func(raw, norm string, startLine int) {
+		tokens = append(tokens, cloneToken{raw: raw, norm: norm, line: startLine})
+	}
+	n := len(src)
+	for i := 0; i < n; {
+		c := src[i]
+		if c == '\n' {
+			line++
+			i++
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v' {
+			i++
+			continue
+		}
+		if end, ok := matchComment(syntax, src, i); ok {
+			line += strings.Count(src[i:min(end, n)], "\n")
+			i = end
+			continue
+		}
+
+		end := -1
+		switch {
+		case syntax.triple && (c == '"' || c == '\'') && strings.HasPrefix(src[i:], strings.Repeat(string(c), 3)):
+			delim := src[i : i+3]
+			if k := strings.Index(src[i+3:], delim); k >= 0 {
+				end = i + 3 + k + 3
+			} else {
+				end = n
+			}
+		case strings.IndexByte(syntax.multiline, c) >= 0:
+			end = scanQuoted(src, i, c, true, !syntax.raw)
+		case c == '\'' && syntax.char:
+			if e := scanQuoted(src, i, c, false, true); isCharLiteral(src[i:e]) {
+				end = e
+			}
+		case strings.IndexByte(syntax.quotes, c) >= 0:
+			end = scanQuoted(src, i, c, false, true)
+		}
+		if end > i {
+			emit(src[i:end], "$lit", line)
+			line += strings.Count(src[i:end], "\n")
+			i = end
+			continue
+		}
+
+		switch {
+		case c >= '0' && c <= '9':
+			j := i + 1
+			for j < n && (isCallIdentByte(src[j]) || src[j] == '.') {
+				j++
+			}
+			emit(src[i:j], "$lit", line)
+			i = j
+		case isCallIdentByte(c):
+			j := i + 1
+			for j < n && isCallIdentByte(src[j]) {
+				j++
+			}
+			word := src[i:j]
+			norm := "$id"
+			if cloneKeywords[word] {
+				norm = word
+			}
+			emit(word, norm, line)
+			i = j
+		case c >= 0x80:
+			// 識別子に含まれる非 ASCII 文字はまとめて1つの識別子にする
+			j := i + 1
+			for j < n && (src[j] >= 0x80 || isCallIdentByte(src[j])) {
+				j++
+			}
+			emit(src[i:j], "$id", line)
+			i = j
+		default:
+			emit(string(c), string(c), line)
+			i++
+		}
+	}
+	return tokens
+}
+
+// cloneFingerprint winnowing で選んだ k-gram のハッシュと、その先頭のトークン位置
+type cloneFingerprint struct {
+	hash uint64
+	pos  int
+}
+
+// winnowFingerprints 正規化したトークン列の k-gram ハッシュを求め、窓ごとの最小値を選ぶ（Schleimer らの winnowing）
+func winnowFingerprints(tokens []cloneToken) []cloneFingerprint {
+	if len(tokens) < cloneKGram {
+		return nil
+	}
+	const base = 1099511628211
+	hashes := make([]uint64, len(tokens))
+	for i, t := range tokens {
+		h := fnv.New64a()
+		h.Write([]byte(t.norm))
+		hashes[i] = h.Sum64()
+	}
+	var pow uint64 = 1
+	for i := 1; i < cloneKGram; i++ {
+		pow *= base
+	}
+	grams := make([]uint64, 0, len(tokens)-cloneKGram+1)
+	var rolling uint64
+	for i := range tokens {
+		if i >= cloneKGram {
+			rolling -= hashes[i-cloneKGram] * pow
+		}
+		rolling = rolling*base + hashes[i]
+		if i >= cloneKGram-1 {
+			grams = append(grams, rolling)
+		}
+	}
+
+	var prints []cloneFingerprint
+	last := -1
+	for start := 0; start+cloneWindow <= len(grams) || start == 0; start++ {
+		end := min(start+cloneWindow, len(grams))
+		best := start
+		for j := start; j < end; j++ {
+			if grams[j] <= grams[best] {
+				best = j
+			}
+		}
+		if best != last {
+			prints = append(prints, cloneFingerprint{hash: grams[best], pos: best})
+			last = best
+		}
+		if end == len(grams) {
+			break
+		}
+	}
+	return prints
+}
+
+// cloneMatch 2つのトークン列で正規化した表記が一致した範囲（終端は含まない）
+type cloneMatch struct {
+	startA, endA int
+	startB, endB int
+	matched      int // 一致したトークン数（Type-3 では間のトークンを含まない）
+	gapped       bool
+}
+
+// findCloneMatches 共通のフィンガープリントを起点に一致を前後に広げ、間の短い一致をつないで Type-3 のクローンにする
+// same は同じファイルどうしの比較で、重なり合う範囲は報告しない
+func findCloneMatches(a, b []cloneToken, seeds [][2]int, same bool) []cloneMatch {
+	sort.Slice(seeds, func(i, j int) bool {
+		di, dj := seeds[i][1]-seeds[i][0], seeds[j][1]-seeds[j][0]
+		if di != dj {
+			return di < dj
+		}
+		return seeds[i][0] < seeds[j][0]
+	})
+
+	var exact []cloneMatch
+	covered := make(map[int]int) // 対角線ごとに、広げ終えた一致の終端
+	for _, seed := range seeds {
+		pa, pb := seed[0], seed[1]
+		diagonal := pb - pa
+		if same && diagonal <= 0 {
+			continue
+		}
+		if end, ok := covered[diagonal]; ok && pa < end {
+			continue
+		}
+		if a[pa].norm != b[pb].norm {
+			continue
+		}
+		sa, sb := pa, pb
+		for sa > 0 && sb > 0 && a[sa-1].norm == b[sb-1].norm {
+			sa--
+			sb--
+		}
+		ea, eb := pa, pb
+		for ea < len(a) && eb < len(b) && a[ea].norm == b[eb].norm {
+			ea++
+			eb++
+		}
+		covered[diagonal] = ea
+		if same && ea > sb {
+			// 自分自身と重なる繰り返しは重ならない長さまで縮める
+			ea = sb
+			eb = sb + (ea - sa)
+		}
+		if ea-sa < cloneKGram {
+			continue
+		}
+		exact = append(exact, cloneMatch{startA: sa, endA: ea, startB: sb, endB: eb, matched: ea - sa})
+	}
+
+	// A 側の位置順に、どちらの側でも前の一致の少し後ろから始まる一致をつなぐ
+	sort.Slice(exact, func(i, j int) bool {
+		if exact[i].startA != exact[j].startA {
+			return exact[i].startA < exact[j].startA
+		}
+		return exact[i].startB < exact[j].startB
+	})
+	used := make([]bool, len(exact))
+	var merged []cloneMatch
+	for i := range exact {
+		if used[i] {
+			continue
+		}
+		cur := exact[i]
+		used[i] = true
+		for j := i + 1; j < len(exact); j++ {
+			next := exact[j]
+			if used[j] || next.startA-cur.endA > cloneMaxGap {
+				if next.startA-cur.endA > cloneMaxGap {
+					break
+				}
+				continue
+			}
+			gapA, gapB := next.startA-cur.endA, next.startB-cur.endB
+			if gapA < 0 || gapB < 0 || gapB > cloneMaxGap || same && next.endA > cur.startB {
+				continue
+			}
+			matched := cur.matched + next.matched
+			span := max(next.endA-cur.startA, next.endB-cur.startB)
+			if float64(matched)/float64(span) < cloneMinSimilarity {
+				continue
+			}
+			cur.endA, cur.endB, cur.matched = next.endA, next.endB, matched
+			cur.gapped = cur.gapped || gapA > 0 || gapB > 0
+			used[j] = true
+		}
+		merged = append(merged, cur)
+	}
+	return merged
+}
+
+// similarity 一致したトークンの割合
+func (m cloneMatch) similarity() float64 {
+	return float64(m.matched) / float64(max(m.endA-m.startA, m.endB-m.startB))
+}
+
+// identicalTokens 元の表記まで一致しているか（Type-1）
+func identicalTokens(a, b []cloneToken) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].raw != b[i].raw {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testCloneSource 変数名と定数を変えられる、十分な長さの Go の関数（extra を途中に挿入する）
+func testCloneSource(name, total string, limit int, extra string) string {
+	return fmt.Sprintf(`// %[1]s 合計を求める
+func %[1]s(items []Item) int {
+	%[2]s := 0
+	for i, item := range items {
+		if item.Price > %[3]d {
+			%[2]s += item.Price * item.Count
+		} else {
+			%[2]s += item.Count
+		}%[4]s
+		if i%%2 == 0 {
+			log.Printf("item %%d: %%s", i, item.Name)
+		}
+	}
+	return %[2]s
+}
+`, name, total, limit, extra)
+}
+
+// cloneSeeds 2つのトークン列で同じフィンガープリントの位置の組
+func cloneSeeds(a, b []cloneToken) [][2]int {
+	positions := make(map[uint64][]int)
+	for _, fp := range winnowFingerprints(a) {
+		positions[fp.hash] = append(positions[fp.hash], fp.pos)
+	}
+	var seeds [][2]int
+	for _, fp := range winnowFingerprints(b) {
+		for _, pa := range positions[fp.hash] {
+			seeds = append(seeds, [2]int{pa, fp.pos})
+		}
+	}
+	return seeds
+}
+
+func TestTokenizeForClones(t *testing.T) {
+	tokens := tokenizeForClones("go", "x := \"a // b\" /* c */ + 42\n// d\nreturn y\n")
+	var norms []string
+	var lines []int
+	for _, tok := range tokens {
+		norms = append(norms, tok.norm)
+		lines = append(lines, tok.line)
+	}
+	if want := []string{"$id", ":", "=", "$lit", "+", "$lit", "return", "$id"}; !reflect.DeepEqual(norms, want) {
+		t.Errorf("norms = %q, want %q", norms, want)
+	}
+	if want := []int{1, 1, 1, 1, 1, 1, 3, 3}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines = %v, want %v", lines, want)
+	}
+	if tokens := tokenizeForClones("cobol", "x"); tokens != nil {
+		t.Errorf("unsupported language = %v", tokens)
+	}
+}
+
+func TestWinnowFingerprints(t *testing.T) {
+	a := tokenizeForClones("go", testCloneSource("sumPrices", "total", 100, ""))
+	if len(a) < cloneKGram+cloneWindow {
+		t.Fatalf("only %d tokens", len(a))
+	}
+	prints := winnowFingerprints(a)
+	if len(prints) == 0 || len(prints) > len(a)-cloneKGram+1 {
+		t.Fatalf("got %d fingerprints for %d tokens", len(prints), len(a))
+	}
+	// どの窓にも選ばれたフィンガープリントがある
+	for i := 1; i < len(prints); i++ {
+		if prints[i].pos <= prints[i-1].pos || prints[i].pos-prints[i-1].pos > cloneWindow {
+			t.Errorf("fingerprints %d and %d are at %d and %d", i-1, i, prints[i-1].pos, prints[i].pos)
+		}
+	}
+
+	// 識別子とリテラルだけが違えば同じフィンガープリントになる
+	renamed := winnowFingerprints(tokenizeForClones("go", testCloneSource("addUp", "sum", 5, "")))
+	if !reflect.DeepEqual(prints, renamed) {
+		t.Error("renamed copy has different fingerprints")
+	}
+
+	if prints := winnowFingerprints(a[:cloneKGram-1]); prints != nil {
+		t.Errorf("too short = %v", prints)
+	}
+	if prints := winnowFingerprints(a[:cloneKGram]); len(prints) != 1 {
+		t.Errorf("single k-gram = %v", prints)
+	}
+}
+
+func TestFindCloneMatches(t *testing.T) {
+	base := tokenizeForClones("go", testCloneSource("sumPrices", "total", 100, ""))
+	tests := []struct {
+		name        string
+		other       string
+		wantMatches int
+		gapped      bool
+		identical   bool
+	}{
+		{"exact copy", testCloneSource("sumPrices", "total", 100, ""), 1, false, true},
+		{"renamed", testCloneSource("addUp", "sum", 5, ""), 1, false, false},
+		{"statement inserted", testCloneSource("sumPrices", "total", 100, "\n\t\tcount++"), 1, true, false},
+		{"unrelated", "package main\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n", 0, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := tokenizeForClones("go", tt.other)
+			matches := findCloneMatches(base, other, cloneSeeds(base, other), false)
+			if len(matches) != tt.wantMatches {
+				t.Fatalf("matches = %+v, want %d", matches, tt.wantMatches)
+			}
+			if len(matches) == 0 {
+				return
+			}
+			m := matches[0]
+			if m.gapped != tt.gapped {
+				t.Errorf("gapped = %v, want %v", m.gapped, tt.gapped)
+			}
+			if m.similarity() < cloneMinSimilarity || m.matched < cloneMinTokens {
+				t.Errorf("similarity = %v, matched = %d", m.similarity(), m.matched)
+			}
+			if got := identicalTokens(base[m.startA:m.endA], other[m.startB:m.endB]); got != tt.identical {
+				t.Errorf("identicalTokens() = %v, want %v", got, tt.identical)
+			}
+			if !tt.gapped && (m.endA-m.startA != len(base) || m.endB-m.startB != len(other)) {
+				t.Errorf("match %+v does not cover both functions (%d, %d tokens)", m, len(base), len(other))
+			}
+		})
+	}
+}
+
+func TestFindCloneMatchesSameFile(t *testing.T) {
+	// 同じファイルの中の2つのコピーは重ならない1つのクローンとして報告する
+	src := testCloneSource("first", "a", 1, "") + testCloneSource("second", "b", 2, "")
+	tokens := tokenizeForClones("go", src)
+	matches := findCloneMatches(tokens, tokens, cloneSeeds(tokens, tokens), true)
+	if len(matches) != 1 {
+		t.Fatalf("matches = %+v, want 1", matches)
+	}
+	m := matches[0]
+	if m.endA > m.startB || m.startA != 0 || m.endB != len(tokens) {
+		t.Errorf("match = %+v for %d tokens", m, len(tokens))
+	}
+	if line := tokens[m.startB].line; line != strings.Count(testCloneSource("first", "a", 1, ""), "\n")+2 {
+		t.Errorf("second copy starts at line %d", line)
+	}
+}
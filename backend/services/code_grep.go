@@ -0,0 +1,374 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"unicode/utf8"
+
+	"reverse-engineering-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// grep の既定値と上限
+const (
+	grepMaxLineLength = 500 // 結果に含める1行の長さの上限（長い行は切り詰める）
+	grepMinLiteral    = 3   // トライグラム索引で絞り込むのに使う、正規表現から取り出した文字列の最小の長さ
+)
+
+// trigramIndexEnabled files.content に pg_trgm の索引を作れたか（InitCodeSearchIndex で決まる）
+var trigramIndexEnabled bool
+
+// InitCodeSearchIndex pg_trgm 拡張を有効にし、ファイルの内容とパスにトライグラムの GIN 索引を作る
+// LIKE・ILIKE による絞り込みが索引で速くなる。拡張が無くても grep はそのまま動く
+func InitCodeSearchIndex(db *gorm.DB) bool {
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_files_content_trgm ON files USING gin (content gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_files_name_trgm ON files USING gin (name gin_trgm_ops)",
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			log.Println("pg_trgm is not available, grep runs without the trigram index:", err)
+			trigramIndexEnabled = false
+			return false
+		}
+	}
+	trigramIndexEnabled = true
+	return true
+}
+
+// GrepOptions grep の条件
+type GrepOptions struct {
+	Query      string
+	Regex      bool     // false なら Query をそのままの文字列として探す
+	IgnoreCase bool     // 大文字と小文字を区別しない
+	Paths      []string // 対象にするパスのグロブ（** は / をまたぐ。/ を含まないグロブはファイル名の部分にも当てる）
+	Excludes   []string // 除外するパスのグロブ
+	Language   string
+	Context    int // 一致した行の前後に含める行数
+	Limit      int // 返す一致の数の上限
+}
+
+// GrepLine 一致した行と前後の行
+type GrepLine struct {
+	Line    int      `json:"line"`
+	Column  int      `json:"column"` // 最初の一致の位置（文字単位、1始まり）
+	Text    string   `json:"text"`
+	Before  []string `json:"before,omitempty"`
+	After   []string `json:"after,omitempty"`
+	Matches [][2]int `json:"matches"` // 行内の一致の範囲（文字単位、終端は含まない）
+}
+
+// GrepFileResult ファイルごとの一致
+type GrepFileResult struct {
+	FileID   uint       `json:"file_id"`
+	FileName string     `json:"file_name"`
+	Language string     `json:"language"`
+	Lines    []GrepLine `json:"lines"`
+}
+
+// GrepResult grep の結果
+type GrepResult struct {
+	Files         []GrepFileResult `json:"files"`
+	FilesSearched int              `json:"files_searched"` // 索引で絞り込んだ後に内容を調べたファイルの数
+	FilesMatched  int              `json:"files_matched"`
+	Matches       int              `json:"matches"` // 一致した行の数
+	Truncated     bool             `json:"truncated"`
+	Indexed       bool             `json:"indexed"` // トライグラム索引を使えたか
+}
+
+// CompileGrepPattern 検索語を行ごとに当てる正規表現にする（文字列検索もエスケープして正規表現にそろえる）
+func CompileGrepPattern(options GrepOptions) (*regexp.Regexp, error) {
+	if options.Query == "" {
+		return nil, fmt.Errorf("query is empty")
+	}
+	if strings.ContainsAny(options.Query, "\r\n") {
+		return nil, fmt.Errorf("query must not contain line breaks")
+	}
+	pattern := options.Query
+	if !options.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if options.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %w", err)
+	}
+	return re, nil
+}
+
+// GrepProject プロジェクトのファイルの内容を行ごとに検索する
+// 正規表現が必ず含む文字列を LIKE・ILIKE の条件にしてデータベース側で候補を絞り込み、残ったファイルだけを読む
+func GrepProject(db *gorm.DB, projectID uint, options GrepOptions) (*GrepResult, error) {
+	re, err := CompileGrepPattern(options)
+	if err != nil {
+		return nil, err
+	}
+	includes, err := compileGlobs(options.Paths)
+	if err != nil {
+		return nil, err
+	}
+	excludes, err := compileGlobs(options.Excludes)
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.Model(&models.File{}).Select("id, name, language, content").
+		Where("project_id = ? AND content <> ''", projectID)
+	if options.Language != "" {
+		query = query.Where("language = ?", options.Language)
+	}
+	for _, literal := range requiredLiterals(re) {
+		operator := "LIKE"
+		if literal.foldCase {
+			operator = "ILIKE"
+		}
+		query = query.Where("content "+operator+" ? ESCAPE '\\'", "%"+EscapeLike(literal.text)+"%")
+	}
+	if len(options.Paths) > 0 {
+		// グロブを LIKE に直して候補を絞る（LIKE の % は / もまたぐので、正確な判定は読んだ後に行う）
+		var conditions []string
+		var args []interface{}
+		for _, glob := range options.Paths {
+			conditions = append(conditions, "name LIKE ? ESCAPE '\\'")
+			args = append(args, globToLike(glob))
+		}
+		query = query.Where(strings.Join(conditions, " OR "), args...)
+	}
+
+	rows, err := query.Order("name, id").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &GrepResult{Files: []GrepFileResult{}, Indexed: trigramIndexEnabled}
+	for rows.Next() {
+		var file models.File
+		if err := db.ScanRows(rows, &file); err != nil {
+			return nil, err
+		}
+		if len(includes) > 0 && !matchAnyGlob(includes, file.Name) || matchAnyGlob(excludes, file.Name) {
+			continue
+		}
+		result.FilesSearched++
+
+		lines := grepContent(re, file.Content, options.Context, options.Limit-result.Matches)
+		if len(lines) == 0 {
+			continue
+		}
+		result.Files = append(result.Files, GrepFileResult{
+			FileID:   file.ID,
+			FileName: file.Name,
+			Language: file.Language,
+			Lines:    lines,
+		})
+		result.FilesMatched++
+		result.Matches += len(lines)
+		if result.Matches >= options.Limit {
+			result.Truncated = true
+			break
+		}
+	}
+	return result, rows.Err()
+}
+
+// grepContent 一致した行を最大 limit 行まで返す
+func grepContent(re *regexp.Regexp, content string, context, limit int) []GrepLine {
+	lines := strings.Split(content, "\n")
+	var results []GrepLine
+	for i, line := range lines {
+		if len(results) >= limit {
+			break
+		}
+		line = strings.TrimSuffix(line, "\r")
+		locations := re.FindAllStringIndex(line, -1)
+		if len(locations) == 0 {
+			continue
+		}
+		match := GrepLine{Line: i + 1, Text: truncateGrepLine(line)}
+		for _, loc := range locations {
+			// ^ や a* のような空の一致は、他に一致が無いときだけ位置として残す
+			if loc[0] == loc[1] && (len(match.Matches) > 0 || len(locations) > 1) {
+				continue
+			}
+			match.Matches = append(match.Matches, [2]int{utf8.RuneCountInString(line[:loc[0]]), utf8.RuneCountInString(line[:loc[1]])})
+		}
+		if len(match.Matches) == 0 {
+			loc := locations[0]
+			match.Matches = append(match.Matches, [2]int{utf8.RuneCountInString(line[:loc[0]]), utf8.RuneCountInString(line[:loc[0]])})
+		}
+		match.Column = match.Matches[0][0] + 1
+		for j := max(0, i-context); j < i; j++ {
+			match.Before = append(match.Before, truncateGrepLine(strings.TrimSuffix(lines[j], "\r")))
+		}
+		for j := i + 1; j <= min(len(lines)-1, i+context); j++ {
+			match.After = append(match.After, truncateGrepLine(strings.TrimSuffix(lines[j], "\r")))
+		}
+		results = append(results, match)
+	}
+	return results
+}
+
+func truncateGrepLine(line string) string {
+	if len(line) <= grepMaxLineLength {
+		return line
+	}
+	return strings.ToValidUTF8(line[:grepMaxLineLength], "") + "…"
+}
+
+// grepLiteral 一致する行に必ず含まれる文字列
+type grepLiteral struct {
+	text     string
+	foldCase bool
+}
+
+// requiredLiterals 正規表現の最上位の連結から、どの一致にも必ず含まれる文字列を取り出す
+// 選択（|）や繰り返しの中の文字列は必ず現れるとは限らないので使わない
+func requiredLiterals(re *regexp.Regexp) []grepLiteral {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	parsed = parsed.Simplify()
+	for parsed.Op == syntax.OpCapture {
+		parsed = parsed.Sub[0]
+	}
+	var parts []*syntax.Regexp
+	switch parsed.Op {
+	case syntax.OpLiteral:
+		parts = []*syntax.Regexp{parsed}
+	case syntax.OpConcat:
+		parts = parsed.Sub
+	}
+
+	var literals []grepLiteral
+	for _, part := range parts {
+		for part.Op == syntax.OpCapture {
+			part = part.Sub[0]
+		}
+		if part.Op != syntax.OpLiteral {
+			continue
+		}
+		text := string(part.Rune)
+		if utf8.RuneCountInString(text) < grepMinLiteral {
+			continue
+		}
+		literals = append(literals, grepLiteral{text: text, foldCase: part.Flags&syntax.FoldCase != 0})
+	}
+	return literals
+}
+
+// compileGlobs パスのグロブを正規表現にする
+func compileGlobs(globs []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, glob := range globs {
+		re, err := globToRegexp(glob)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// globToRegexp * は / 以外、** は / を含む任意の文字列、? は1文字、[...] は文字クラスに対応する
+// / を含まないグロブはどのディレクトリのファイル名にも当たるようにする
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	if !strings.Contains(glob, "/") {
+		b.WriteString("(?:.*/)?")
+	}
+	glob = strings.TrimPrefix(glob, "./")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					// **/ は0個以上のディレクトリ
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid glob %q: unterminated character class", glob)
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", glob, err)
+	}
+	return re, nil
+}
+
+func matchAnyGlob(globs []*regexp.Regexp, name string) bool {
+	name = strings.ReplaceAll(name, "\\", "/")
+	for _, re := range globs {
+		if re.MatchString(name) || re.MatchString(path.Clean(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// globToLike グロブを、それに一致する名前を必ず含む LIKE のパターンにする
+func globToLike(glob string) string {
+	var b strings.Builder
+	if !strings.Contains(glob, "/") {
+		b.WriteString("%")
+	}
+	glob = strings.TrimPrefix(glob, "./")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			// **/ は0個以上のディレクトリなので / を必須にしない
+			if strings.HasPrefix(glob[i:], "**/") {
+				i += 2
+			}
+			b.WriteString("%")
+		case '?':
+			b.WriteString("_")
+		case '[':
+			if end := strings.IndexByte(glob[i+1:], ']'); end >= 0 {
+				i += end + 1
+			}
+			b.WriteString("_")
+		default:
+			b.WriteString(EscapeLike(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// EscapeLike LIKE のワイルドカードをエスケープする（ESCAPE '\' と組み合わせて使う）
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestRequiredLiterals(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []grepLiteral
+	}{
+		{`parseConfig`, []grepLiteral{{text: "parseConfig"}}},
+		{`func \w+Handler\(`, []grepLiteral{{text: "func "}, {text: "Handler("}}},
+		// 大文字小文字を区別しない文字列は正規化された形（大文字）になり、ILIKE で探す
+		{`(?i)select.*from`, []grepLiteral{{text: "SELECT", foldCase: true}, {text: "FROM", foldCase: true}}},
+		{`(token)\s*=`, []grepLiteral{{text: "token"}}},
+		// 選択や繰り返しの中の文字列は必ず現れるとは限らない
+		{`alpha|beta`, nil},
+		{`load_(user|group)`, []grepLiteral{{text: "load_"}}},
+		{`(?:abcd)+x`, nil},
+		{`(?:abcd)*`, nil},
+		{`colou?r`, []grepLiteral{{text: "colo"}}},
+		// 短すぎる文字列は絞り込みに使わない
+		{`ab.cd`, nil},
+	}
+	for _, tt := range tests {
+		if got := requiredLiterals(regexp.MustCompile(tt.pattern)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("requiredLiterals(%q) = %+v, want %+v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob    string
+		matches []string
+		rejects []string
+	}{
+		{"*.go", []string{"main.go", "cmd/app/main.go"}, []string{"main.go.bak", "main.gox"}},
+		{"src/*.ts", []string{"src/a.ts"}, []string{"src/lib/a.ts", "other/src/a.ts"}},
+		{"**/test/*.py", []string{"test/a.py", "pkg/sub/test/a.py"}, []string{"pkg/test/sub/a.py"}},
+		{"src/**", []string{"src/a", "src/a/b/c"}, []string{"lib/src/a"}},
+		{"./cmd/?.go", []string{"cmd/a.go"}, []string{"cmd/ab.go", "cmd/a/b.go"}},
+		{"[abc].c", []string{"a.c", "dir/b.c"}, []string{"d.c"}},
+		{"[!x]*.js", []string{"app.js"}, []string{"xapp.js"}},
+		{"a+b(1).txt", []string{"a+b(1).txt"}, []string{"aab1.txt"}},
+	}
+	for _, tt := range tests {
+		re, err := globToRegexp(tt.glob)
+		if err != nil {
+			t.Errorf("globToRegexp(%q) error = %v", tt.glob, err)
+			continue
+		}
+		for _, name := range tt.matches {
+			if !re.MatchString(name) {
+				t.Errorf("%q does not match %q (%s)", tt.glob, name, re)
+			}
+		}
+		for _, name := range tt.rejects {
+			if re.MatchString(name) {
+				t.Errorf("%q matches %q (%s)", tt.glob, name, re)
+			}
+		}
+	}
+	if _, err := globToRegexp("[abc.go"); err == nil {
+		t.Error("globToRegexp() with an unterminated class error = nil")
+	}
+}
+
+func TestGlobToLike(t *testing.T) {
+	tests := []struct {
+		glob, want string
+	}{
+		{"*.go", "%%.go"},
+		{"src/*.ts", "src/%.ts"},
+		{"**/test/*.py", "%test/%.py"},
+		{"./cmd/?.go", "cmd/_.go"},
+		{"[!x]*.js", "%_%.js"},
+		{"a_b%.txt", `%a\_b\%.txt`},
+	}
+	for _, tt := range tests {
+		if got := globToLike(tt.glob); got != tt.want {
+			t.Errorf("globToLike(%q) = %q, want %q", tt.glob, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got, want := EscapeLike(`50%_off\`), `50\%\_off\\`; got != want {
+		t.Errorf("EscapeLike() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const cpioTrailer = "TRAILER!!!"
+
+// ReadCPIO newc（070701/070702）・odc（070707）形式の cpio アーカイブを読み、アーカイブのサイズを返す
+func ReadCPIO(data []byte) ([]FirmwareEntry, int, error) {
+	var entries []FirmwareEntry
+	var total int64
+	pos := 0
+	for {
+		if pos+6 > len(data) {
+			return entries, pos, errors.New("cpio: missing trailer")
+		}
+		magic := string(data[pos : pos+6])
+		var mode uint32
+		var size int64
+		var name string
+		var dataStart int
+
+		switch magic {
+		case "070701", "070702":
+			if pos+110 > len(data) {
+				return entries, pos, errors.New("cpio: truncated header")
+			}
+			field := func(i int) (uint64, error) {
+				return strconv.ParseUint(string(data[pos+6+i*8:pos+14+i*8]), 16, 32)
+			}
+			m, err1 := field(1)
+			s, err2 := field(6)
+			nameSize, err3 := field(11)
+			if err1 != nil || err2 != nil || err3 != nil || nameSize == 0 {
+				return entries, pos, errors.New("cpio: invalid header")
+			}
+			nameEnd := pos + 110 + int(nameSize)
+			if nameEnd > len(data) {
+				return entries, pos, errors.New("cpio: truncated name")
+			}
+			mode, size = uint32(m), int64(s)
+			name = strings.TrimRight(string(data[pos+110:nameEnd]), "\x00")
+			dataStart = pos + (110+int(nameSize)+3)&^3
+		case "070707":
+			if pos+76 > len(data) {
+				return entries, pos, errors.New("cpio: truncated header")
+			}
+			field := func(off, n int) (uint64, error) {
+				return strconv.ParseUint(string(data[pos+off:pos+off+n]), 8, 64)
+			}
+			m, err1 := field(18, 6)
+			nameSize, err2 := field(59, 6)
+			s, err3 := field(65, 11)
+			if err1 != nil || err2 != nil || err3 != nil || nameSize == 0 {
+				return entries, pos, errors.New("cpio: invalid header")
+			}
+			nameEnd := pos + 76 + int(nameSize)
+			if nameEnd > len(data) {
+				return entries, pos, errors.New("cpio: truncated name")
+			}
+			mode, size = uint32(m), int64(s)
+			name = strings.TrimRight(string(data[pos+76:nameEnd]), "\x00")
+			dataStart = nameEnd
+		default:
+			return entries, pos, fmt.Errorf("cpio: invalid magic at 0x%x", pos)
+		}
+
+		if size < 0 || int64(dataStart)+size > int64(len(data)) {
+			return entries, pos, errors.New("cpio: truncated file data")
+		}
+		next := dataStart + int(size)
+		if magic != "070707" {
+			next = (next + 3) &^ 3
+		}
+		if name == cpioTrailer {
+			if next > len(data) {
+				next = len(data)
+			}
+			return entries, next, nil
+		}
+		if len(entries) >= maxFirmwareEntries {
+			return entries, next, fmt.Errorf("cpio: more than %d entries", maxFirmwareEntries)
+		}
+
+		entry := FirmwareEntry{Path: path.Clean("/" + name)[1:], Mode: mode & 0xFFF, Size: size, Type: unixFileType(mode)}
+		content := data[dataStart : dataStart+int(size)]
+		switch entry.Type {
+		case "file":
+			total += size
+			if total > maxFirmwareBytes {
+				return entries, next, errors.New("cpio: extracted data too large")
+			}
+			entry.Data = content
+		case "symlink":
+			entry.Target = string(content)
+		}
+		if entry.Path != "" {
+			entries = append(entries, entry)
+		}
+		pos = next
+	}
+}
+
+// unixFileType st_mode の種別ビットを FirmwareEntry.Type に変換する
+func unixFileType(mode uint32) string {
+	switch mode & 0170000 {
+	case 0100000:
+		return "file"
+	case 0040000:
+		return "dir"
+	case 0120000:
+		return "symlink"
+	case 0020000, 0060000:
+		return "device"
+	case 0010000:
+		return "fifo"
+	case 0140000:
+		return "socket"
+	}
+	return "file"
+}
+
+const (
+	cramfsMagic     = 0x28cd3d45
+	cramfsSignature = "Compressed ROMFS"
+	cramfsPageSize  = 4096
+)
+
+// ReadCramfs CRAMFS イメージ（リトルエンディアン・ビッグエンディアンの両方）を読み、イメージのサイズを返す
+func ReadCramfs(data []byte) ([]FirmwareEntry, int, error) {
+	if len(data) < 76 {
+		return nil, 0, errors.New("cramfs: truncated superblock")
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if binary.LittleEndian.Uint32(data) != cramfsMagic {
+		if binary.BigEndian.Uint32(data) != cramfsMagic {
+			return nil, 0, errors.New("cramfs: invalid magic")
+		}
+		order = binary.BigEndian
+	}
+	if string(data[16:32]) != cramfsSignature {
+		return nil, 0, errors.New("cramfs: invalid signature")
+	}
+	size := int(order.Uint32(data[4:]))
+	if size < 76 || size > len(data) {
+		return nil, 0, errors.New("cramfs: invalid image size")
+	}
+	image := data[:size]
+
+	r := &cramfsReader{data: image, order: order}
+	// ルート inode はスーパーブロックの 64 バイト目から
+	mode, _, _, offset := r.inode(64)
+	if mode&0170000 != 0040000 {
+		return nil, size, errors.New("cramfs: root is not a directory")
+	}
+	err := r.walkDir(offset, int(r.inodeSize(64)), "")
+	return r.entries, size, err
+}
+
+type cramfsReader struct {
+	data    []byte
+	order   binary.ByteOrder
+	entries []FirmwareEntry
+	total   int64
+}
+
+// inode 12バイトの inode を解釈する（ビットフィールドの並びはエンディアンに合わせて異なる）
+func (r *cramfsReader) inode(pos int) (mode uint32, fileSize uint32, nameLen int, offset int) {
+	mode = uint32(r.order.Uint16(r.data[pos:]))
+	w1 := r.order.Uint32(r.data[pos+4:])
+	w2 := r.order.Uint32(r.data[pos+8:])
+	if r.order == binary.LittleEndian {
+		fileSize = w1 & 0xFFFFFF
+		nameLen = int(w2&0x3F) * 4
+		offset = int(w2>>6) * 4
+	} else {
+		fileSize = w1 >> 8
+		nameLen = int(w2>>26) * 4
+		offset = int(w2&0x3FFFFFF) * 4
+	}
+	return
+}
+
+func (r *cramfsReader) inodeSize(pos int) uint32 {
+	_, size, _, _ := r.inode(pos)
+	return size
+}
+
+func (r *cramfsReader) walkDir(offset, size int, dir string) error {
+	end := offset + size
+	if end > len(r.data) {
+		return errors.New("cramfs: directory out of range")
+	}
+	for pos := offset; pos+12 <= end; {
+		mode, fileSize, nameLen, dataOffset := r.inode(pos)
+		if pos+12+nameLen > len(r.data) || nameLen == 0 {
+			return errors.New("cramfs: invalid directory entry")
+		}
+		name := strings.TrimRight(string(r.data[pos+12:pos+12+nameLen]), "\x00")
+		pos += 12 + nameLen
+		if name == "" || name == "." || name == ".." || path.Base(name) != name {
+			continue
+		}
+		if len(r.entries) >= maxFirmwareEntries {
+			return fmt.Errorf("cramfs: more than %d entries", maxFirmwareEntries)
+		}
+
+		entry := FirmwareEntry{Path: path.Join(dir, name), Mode: mode & 0xFFF, Size: int64(fileSize), Type: unixFileType(mode)}
+		switch entry.Type {
+		case "dir":
+			r.entries = append(r.entries, entry)
+			if dataOffset > 0 && dataOffset <= pos-12-nameLen {
+				// ディレクトリは後方にしか置かれないため、循環参照は不正として扱う
+				return errors.New("cramfs: directory loop")
+			}
+			if err := r.walkDir(dataOffset, int(fileSize), entry.Path); err != nil {
+				return err
+			}
+			continue
+		case "file", "symlink":
+			content, err := r.readFile(dataOffset, int(fileSize))
+			if err != nil {
+				return fmt.Errorf("cramfs: %s: %w", entry.Path, err)
+			}
+			if entry.Type == "symlink" {
+				entry.Target = string(content)
+			} else {
+				entry.Data = content
+			}
+		}
+		r.entries = append(r.entries, entry)
+	}
+	return nil
+}
+
+// readFile ブロックポインタ配列（各ブロックの終端位置）に続く zlib 圧縮ブロックを展開する
+func (r *cramfsReader) readFile(offset, size int) ([]byte, error) {
+	if size == 0 {
+		return []byte{}, nil
+	}
+	r.total += int64(size)
+	if r.total > maxFirmwareBytes {
+		return nil, errors.New("extracted data too large")
+	}
+	numBlocks := (size + cramfsPageSize - 1) / cramfsPageSize
+	if offset+numBlocks*4 > len(r.data) {
+		return nil, errors.New("block pointers out of range")
+	}
+	out := make([]byte, 0, size)
+	start := offset + numBlocks*4
+	for i := 0; i < numBlocks; i++ {
+		end := int(r.order.Uint32(r.data[offset+i*4:]))
+		if end < start || end > len(r.data) {
+			return nil, errors.New("block out of range")
+		}
+		if end > start {
+			zr, err := zlib.NewReader(bytes.NewReader(r.data[start:end]))
+			if err != nil {
+				return nil, err
+			}
+			block, err := io.ReadAll(io.LimitReader(zr, cramfsPageSize))
+			zr.Close()
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, block...)
+		} else {
+			// 空ブロックはゼロで埋める
+			n := size - len(out)
+			if n > cramfsPageSize {
+				n = cramfsPageSize
+			}
+			out = append(out, make([]byte, n)...)
+		}
+		start = end
+	}
+	if len(out) > size {
+		out = out[:size]
+	}
+	return out, nil
+}
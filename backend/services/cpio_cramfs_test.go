@@ -0,0 +1,208 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// cpioNewc newc 形式のエントリ（ヘッダー・名前・データをそれぞれ4バイト境界に揃える）
+func cpioNewc(name string, mode uint32, data string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "070701%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X",
+		1, mode, 0, 0, 1, 0, len(data), 0, 0, 0, 0, len(name)+1, 0)
+	b.WriteString(name + "\x00")
+	for b.Len()%4 != 0 {
+		b.WriteByte(0)
+	}
+	b.WriteString(data)
+	for b.Len()%4 != 0 {
+		b.WriteByte(0)
+	}
+	return b.Bytes()
+}
+
+func sampleCPIO() []byte {
+	return bytes.Join([][]byte{
+		cpioNewc("bin", 0040755, ""),
+		cpioNewc("bin/sh", 0100755, "#!shell"),
+		cpioNewc("bin/ash", 0120777, "sh"),
+		cpioNewc("../../etc/passwd", 0100644, "root::0:0"),
+		cpioNewc("..", 0040755, ""),
+		cpioNewc(cpioTrailer, 0, ""),
+	}, nil)
+}
+
+func TestReadCPIO(t *testing.T) {
+	archive := sampleCPIO()
+	entries, size, err := ReadCPIO(append(append([]byte{}, archive...), 0, 0, 0, 0, 'x'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != len(archive) {
+		t.Errorf("size = %d, want %d", size, len(archive))
+	}
+	want := []FirmwareEntry{
+		{Path: "bin", Type: "dir", Mode: 0755},
+		{Path: "bin/sh", Type: "file", Mode: 0755, Size: 7, Data: []byte("#!shell")},
+		{Path: "bin/ash", Type: "symlink", Mode: 0777, Size: 2, Target: "sh"},
+		// ../ は取り除いてアーカイブの中に収める
+		{Path: "etc/passwd", Type: "file", Mode: 0644, Size: 9, Data: []byte("root::0:0")},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries = %+v, want %+v", entries, want)
+	}
+
+	// odc 形式
+	odc := fmt.Sprintf("070707%06o%06o%06o%06o%06o%06o%06o%011o%06o%011o%s\x00%s", 0, 1, 0100644, 0, 0, 1, 0, 0, 2, 2, "a", "hi")
+	odc += fmt.Sprintf("070707%06o%06o%06o%06o%06o%06o%06o%011o%06o%011o%s\x00", 0, 0, 0, 0, 0, 1, 0, 0, 11, 0, cpioTrailer)
+	entries, size, err = ReadCPIO([]byte(odc))
+	if err != nil || size != len(odc) || len(entries) != 1 || string(entries[0].Data) != "hi" {
+		t.Errorf("ReadCPIO(odc) = %+v, %d, %v", entries, size, err)
+	}
+}
+
+func TestReadCPIOInvalid(t *testing.T) {
+	archive := sampleCPIO()
+	badHex := append([]byte{}, archive...)
+	copy(badHex[6+8:], "zzzzzzzz")
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad magic", []byte("070799")},
+		{"no trailer", cpioNewc("a", 0100644, "x")},
+		{"bad hex field", badHex},
+		{"zero name size", []byte("070701" + string(bytes.Repeat([]byte("0"), 104)))},
+		{"data beyond archive", cpioNewc("a", 0100644, "data")[:114]},
+		{"truncated header", archive[:50]},
+		{"truncated trailer", archive[:len(archive)-1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ReadCPIO(tt.data); err == nil {
+				t.Error("ReadCPIO() error = nil")
+			}
+		})
+	}
+}
+
+// cramfsInode リトルエンディアンの inode（名前の長さ・オフセットは4バイト単位）
+func cramfsInode(mode uint16, size uint32, nameLen, offset int) []byte {
+	b := binary.LittleEndian.AppendUint16(nil, mode)
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	b = binary.LittleEndian.AppendUint32(b, size&0xFFFFFF)
+	return binary.LittleEndian.AppendUint32(b, uint32(nameLen/4)|uint32(offset/4)<<6)
+}
+
+// cramfsName 名前を4バイト境界まで NUL で埋める
+func cramfsName(name string) []byte {
+	b := []byte(name)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// cramfsBlob offset に置くファイル内容（ブロックポインタ1つと zlib 圧縮データ）
+func cramfsBlob(offset int, content string) []byte {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write([]byte(content))
+	zw.Close()
+	b := binary.LittleEndian.AppendUint32(nil, uint32(offset+4+z.Len()))
+	b = append(b, z.Bytes()...)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// sampleCramfs ルートに hello.txt とディレクトリ sub（中に link → ../hello.txt）を持つイメージ
+func sampleCramfs() []byte {
+	const (
+		rootDir = 76                // ルートディレクトリのエントリ
+		subDir  = rootDir + 24 + 16 // sub のエントリ
+		blobs   = subDir + 16       // ファイル内容
+		content = "hello cramfs\n"
+		target  = "../hello.txt"
+	)
+	fileBlob := cramfsBlob(blobs, content)
+	linkBlob := cramfsBlob(blobs+len(fileBlob), target)
+
+	var b bytes.Buffer
+	b.Write(binary.LittleEndian.AppendUint32(nil, cramfsMagic))
+	b.Write(make([]byte, 12)) // size（後で埋める）, flags, future
+	b.WriteString(cramfsSignature)
+	b.Write(make([]byte, 16)) // fsid
+	b.Write(cramfsName("test image\x00\x00\x00\x00\x00\x00"))
+	b.Write(cramfsInode(0040755, subDir-rootDir, 0, rootDir))
+	b.Write(cramfsInode(0100644, uint32(len(content)), 12, blobs))
+	b.Write(cramfsName("hello.txt"))
+	b.Write(cramfsInode(0040755, 16, 4, subDir))
+	b.Write(cramfsName("sub"))
+	b.Write(cramfsInode(0120777, uint32(len(target)), 4, blobs+len(fileBlob)))
+	b.Write(cramfsName("link"))
+	b.Write(fileBlob)
+	b.Write(linkBlob)
+
+	image := b.Bytes()
+	binary.LittleEndian.PutUint32(image[4:], uint32(len(image)))
+	return image
+}
+
+func TestReadCramfs(t *testing.T) {
+	image := sampleCramfs()
+	entries, size, err := ReadCramfs(append(append([]byte{}, image...), "trailing"...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != len(image) {
+		t.Errorf("size = %d, want %d", size, len(image))
+	}
+	want := []FirmwareEntry{
+		{Path: "hello.txt", Type: "file", Mode: 0644, Size: 13, Data: []byte("hello cramfs\n")},
+		{Path: "sub", Type: "dir", Mode: 0755, Size: 16},
+		{Path: "sub/link", Type: "symlink", Mode: 0777, Size: 12, Target: "../hello.txt"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries = %+v, want %+v", entries, want)
+	}
+}
+
+func TestReadCramfsInvalid(t *testing.T) {
+	valid := sampleCramfs()
+	modify := func(f func(b []byte)) []byte {
+		b := append([]byte{}, valid...)
+		f(b)
+		return b
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad magic", modify(func(b []byte) { b[0] = 0 })},
+		{"bad signature", modify(func(b []byte) { b[16] = 'c' })},
+		{"size beyond data", modify(func(b []byte) { binary.LittleEndian.PutUint32(b[4:], uint32(len(b)+1)) })},
+		{"root not a directory", modify(func(b []byte) { copy(b[64:], cramfsInode(0100644, 0, 0, 76)) })},
+		// sub がルートディレクトリ自身を指す
+		{"directory loop", modify(func(b []byte) { copy(b[100:], cramfsInode(0040755, 40, 4, 76)) })},
+		{"block pointer out of range", modify(func(b []byte) { binary.LittleEndian.PutUint32(b[132:], 0xffffff) })},
+		{"truncated superblock", valid[:40]},
+		{"truncated", valid[:len(valid)-1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ReadCramfs(tt.data); err == nil {
+				t.Error("ReadCramfs() error = nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"math"
+	"strings"
+)
+
+// cvssWeights CVSS v3.x の基本評価基準の値（PR は S:C のときに別の値を使う）
+var cvssWeights = map[string]map[string]float64{
+	"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+	"AC": {"L": 0.77, "H": 0.44},
+	"PR": {"N": 0.85, "L": 0.62, "H": 0.27},
+	"UI": {"N": 0.85, "R": 0.62},
+	"C":  {"H": 0.56, "L": 0.22, "N": 0},
+	"I":  {"H": 0.56, "L": 0.22, "N": 0},
+	"A":  {"H": 0.56, "L": 0.22, "N": 0},
+}
+
+// CVSSv3BaseScore CVSS:3.0・3.1 のベクトルから基本値を計算する（読めなければ ok = false）
+func CVSSv3BaseScore(vector string) (float64, bool) {
+	parts := strings.Split(vector, "/")
+	if len(parts) == 0 || !strings.HasPrefix(parts[0], "CVSS:3") {
+		return 0, false
+	}
+	metrics := make(map[string]string)
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, ":"); ok {
+			metrics[k] = v
+		}
+	}
+	values := make(map[string]float64)
+	for metric, weights := range cvssWeights {
+		w, ok := weights[metrics[metric]]
+		if !ok {
+			return 0, false
+		}
+		values[metric] = w
+	}
+	changed := metrics["S"] == "C"
+	if !changed && metrics["S"] != "U" {
+		return 0, false
+	}
+	if changed {
+		switch metrics["PR"] {
+		case "L":
+			values["PR"] = 0.68
+		case "H":
+			values["PR"] = 0.5
+		}
+	}
+
+	iss := 1 - (1-values["C"])*(1-values["I"])*(1-values["A"])
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	if impact <= 0 {
+		return 0, true
+	}
+	exploitability := 8.22 * values["AV"] * values["AC"] * values["PR"] * values["UI"]
+	if changed {
+		return cvssRoundUp(math.Min(1.08*(impact+exploitability), 10)), true
+	}
+	return cvssRoundUp(math.Min(impact+exploitability, 10)), true
+}
+
+// cvssRoundUp CVSS v3.1 の切り上げ（小数第1位へ。浮動小数点の誤差を避けるため整数で計算する）
+func cvssRoundUp(x float64) float64 {
+	n := int64(math.Round(x * 100000))
+	if n%10000 == 0 {
+		return float64(n) / 100000
+	}
+	return float64(n/10000+1) / 10
+}
+
+// CVSSSeverity 基本値から重大度を決める
+func CVSSSeverity(score float64) string {
+	switch {
+	case score >= 9:
+		return "critical"
+	case score >= 7:
+		return "high"
+	case score >= 4:
+		return "medium"
+	case score > 0:
+		return "low"
+	}
+	return ""
+}
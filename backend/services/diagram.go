@@ -0,0 +1,508 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiagramNode 図の要素（ファイル・モジュール・クラスなど）
+type DiagramNode struct {
+	ID         string             `json:"id"`
+	Label      string             `json:"label"`
+	Kind       string             `json:"kind"`                 // file, module, class, struct, interface, enum など
+	Members    []string           `json:"members,omitempty"`    // クラス図のフィールド・メソッド
+	Attributes []DiagramAttribute `json:"attributes,omitempty"` // ER 図の列
+	File       string             `json:"file,omitempty"`
+	External   bool               `json:"external,omitempty"` // プロジェクト外（標準ライブラリ・外部パッケージなど）
+}
+
+// DiagramAttribute ER 図のエンティティの列
+type DiagramAttribute struct {
+	Name string   `json:"name"`
+	Type string   `json:"type"`
+	Keys []string `json:"keys,omitempty"` // PK, FK, UK
+}
+
+// DiagramEdge 図の関係。クラス図では From が子、To が親（埋め込みでは From が外側の型）、ER 図では From が外部キーを持つ側
+// シーケンス図では Edges の順番が時刻の順
+type DiagramEdge struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Kind        string `json:"kind"`                  // depends, extends, implements, embeds, references, inferred, request, response
+	Label       string `json:"label,omitempty"`       // ER 図の外部キーの列
+	Cardinality string `json:"cardinality,omitempty"` // ER 図の many_to_one, one_to_one
+	Cycle       bool   `json:"cycle,omitempty"`       // 循環依存に含まれる
+}
+
+// Diagram 依存関係図・クラス図
+type Diagram struct {
+	Type  string        `json:"type"` // dependencies, classes, er, sequence
+	Nodes []DiagramNode `json:"nodes"`
+	Edges []DiagramEdge `json:"edges"`
+}
+
+// 1つのクラスに表示するメンバー数の上限
+const maxDiagramMembers = 20
+
+// diagramBuilder ノードと辺を重複なく集める
+type diagramBuilder struct {
+	diagram *Diagram
+	nodes   map[string]int
+	edges   map[[2]string]bool
+}
+
+func newDiagramBuilder(diagramType string) *diagramBuilder {
+	return &diagramBuilder{
+		diagram: &Diagram{Type: diagramType, Nodes: []DiagramNode{}, Edges: []DiagramEdge{}},
+		nodes:   make(map[string]int),
+		edges:   make(map[[2]string]bool),
+	}
+}
+
+// addNode ノードを追加する。既にある場合は外部扱いだけ上書きし、既存のノードを返す
+func (b *diagramBuilder) addNode(node DiagramNode) *DiagramNode {
+	if i, ok := b.nodes[node.ID]; ok {
+		existing := &b.diagram.Nodes[i]
+		if !node.External && existing.External {
+			existing.External = false
+			existing.Kind = node.Kind
+		}
+		return existing
+	}
+	b.nodes[node.ID] = len(b.diagram.Nodes)
+	b.diagram.Nodes = append(b.diagram.Nodes, node)
+	return &b.diagram.Nodes[len(b.diagram.Nodes)-1]
+}
+
+func (b *diagramBuilder) node(id string) *DiagramNode {
+	if i, ok := b.nodes[id]; ok {
+		return &b.diagram.Nodes[i]
+	}
+	return nil
+}
+
+func (b *diagramBuilder) addEdge(from, to, kind string) {
+	b.addLabeledEdge(from, to, kind, "", "")
+}
+
+// addLabeledEdge ラベルとカーディナリティ付きの辺を追加する（ER 図では同じ2表の間の別の外部キーも別の辺にする）
+func (b *diagramBuilder) addLabeledEdge(from, to, kind, label, cardinality string) {
+	key := [2]string{from, to + "\x00" + label}
+	if from == "" || to == "" || b.edges[key] {
+		return
+	}
+	b.edges[key] = true
+	b.diagram.Edges = append(b.diagram.Edges, DiagramEdge{From: from, To: to, Kind: kind, Label: label, Cardinality: cardinality})
+}
+
+// build 循環している辺に印を付けて図を返す
+func (b *diagramBuilder) build() *Diagram {
+	// 表どうしの相互参照は異常ではないので ER 図では循環を扱わない
+	if b.diagram.Type != "er" {
+		markDiagramCycles(b.diagram)
+	}
+	return b.diagram
+}
+
+// markDiagramCycles 強連結成分（Tarjan）を求め、同じ成分の中の辺を循環として印を付ける
+func markDiagramCycles(d *Diagram) {
+	index := make(map[string]int, len(d.Nodes))
+	for i, node := range d.Nodes {
+		index[node.ID] = i
+	}
+	adj := make([][]int, len(d.Nodes))
+	for _, edge := range d.Edges {
+		from, ok1 := index[edge.From]
+		to, ok2 := index[edge.To]
+		if ok1 && ok2 {
+			adj[from] = append(adj[from], to)
+		}
+	}
+
+	order := make([]int, len(d.Nodes))
+	low := make([]int, len(d.Nodes))
+	onStack := make([]bool, len(d.Nodes))
+	component := make([]int, len(d.Nodes))
+	for i := range order {
+		order[i] = -1
+	}
+	var stack []int
+	counter, components := 0, 0
+	var visit func(v int)
+	visit = func(v int) {
+		order[v], low[v] = counter, counter
+		counter++
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range adj[v] {
+			if order[w] < 0 {
+				visit(w)
+				low[v] = min(low[v], low[w])
+			} else if onStack[w] {
+				low[v] = min(low[v], order[w])
+			}
+		}
+		if low[v] == order[v] {
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				component[w] = components
+				if w == v {
+					break
+				}
+			}
+			components++
+		}
+	}
+	for v := range d.Nodes {
+		if order[v] < 0 {
+			visit(v)
+		}
+	}
+
+	for i := range d.Edges {
+		from, ok1 := index[d.Edges[i].From]
+		to, ok2 := index[d.Edges[i].To]
+		d.Edges[i].Cycle = ok1 && ok2 && (from == to || component[from] == component[to])
+	}
+}
+
+// diagramAliases 図の記法で使うノードの短い ID（n0, n1, ...）
+func (d *Diagram) diagramAliases() map[string]string {
+	aliases := make(map[string]string, len(d.Nodes))
+	for i, node := range d.Nodes {
+		aliases[node.ID] = fmt.Sprintf("n%d", i)
+	}
+	return aliases
+}
+
+// memberLines ノードに表示する行（ER 図は 列名 型 キー）
+func (node DiagramNode) memberLines() []string {
+	if node.Attributes == nil {
+		return node.Members
+	}
+	lines := make([]string, 0, len(node.Attributes))
+	for _, attr := range node.Attributes {
+		line := attr.Name + " " + attr.Type
+		if len(attr.Keys) > 0 {
+			line += " " + strings.Join(attr.Keys, ",")
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// mermaidERWord erDiagram の属性の型・名前に使えない文字を置き換える
+func mermaidERWord(s string) string {
+	word := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '(', r == ')', r == '[', r == ']':
+			return r
+		}
+		return '_'
+	}, s)
+	if word == "" || word[0] >= '0' && word[0] <= '9' || word[0] == '-' {
+		word = "_" + word
+	}
+	return word
+}
+
+// stereotype クラス図でクラス以外の種別に付ける表記
+func (node DiagramNode) stereotype() string {
+	switch node.Kind {
+	case "interface", "enum", "module", "message", "service", "annotation":
+		return node.Kind
+	}
+	return ""
+}
+
+// Mermaid 依存関係図は flowchart、クラス図は classDiagram、ER 図は erDiagram、シーケンス図は sequenceDiagram で出力する
+func (d *Diagram) Mermaid() string {
+	if d.Type == "sequence" {
+		return d.sequenceMermaid()
+	}
+	var b strings.Builder
+	ids := d.diagramAliases()
+
+	if d.Type == "er" {
+		b.WriteString("erDiagram\n")
+		for _, node := range d.Nodes {
+			fmt.Fprintf(&b, "  %s[\"%s\"] {\n", ids[node.ID], mermaidEscape(node.Label))
+			for _, attr := range node.Attributes {
+				line := mermaidERWord(attr.Type) + " " + mermaidERWord(attr.Name)
+				if len(attr.Keys) > 0 {
+					line += " " + strings.Join(attr.Keys, ",")
+				}
+				fmt.Fprintf(&b, "    %s\n", line)
+			}
+			b.WriteString("  }\n")
+		}
+		for _, edge := range d.Edges {
+			line := "--"
+			if edge.Kind == "inferred" {
+				line = ".."
+			}
+			child := "o{"
+			if edge.Cardinality == "one_to_one" {
+				child = "o|"
+			}
+			fmt.Fprintf(&b, "  %s ||%s%s %s : \"%s\"\n", ids[edge.To], line, child, ids[edge.From], mermaidEscape(edge.Label))
+		}
+		return b.String()
+	}
+
+	if d.Type != "classes" {
+		b.WriteString("flowchart LR\n")
+		var external []string
+		for _, node := range d.Nodes {
+			fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[node.ID], mermaidEscape(node.Label))
+			if node.External {
+				external = append(external, ids[node.ID])
+			}
+		}
+		var cycles []string
+		for i, edge := range d.Edges {
+			fmt.Fprintf(&b, "  %s --> %s\n", ids[edge.From], ids[edge.To])
+			if edge.Cycle {
+				cycles = append(cycles, fmt.Sprint(i))
+			}
+		}
+		if len(external) > 0 {
+			b.WriteString("  classDef external stroke-dasharray:4 3,fill:#f6f8fa,color:#57606a\n")
+			fmt.Fprintf(&b, "  class %s external\n", strings.Join(external, ","))
+		}
+		if len(cycles) > 0 {
+			fmt.Fprintf(&b, "  linkStyle %s stroke:#cf222e,stroke-width:2px\n", strings.Join(cycles, ","))
+		}
+		return b.String()
+	}
+
+	b.WriteString("classDiagram\n")
+	// Mermaid のクラス図ではジェネリクスを ~T~ で書く
+	escape := strings.NewReplacer("<", "~", ">", "~", `"`, "'", "{", "(", "}", ")")
+	for _, node := range d.Nodes {
+		fmt.Fprintf(&b, "  class %s[\"%s\"]\n", ids[node.ID], escape.Replace(node.Label))
+		for _, member := range node.Members {
+			fmt.Fprintf(&b, "  %s : %s\n", ids[node.ID], escape.Replace(member))
+		}
+		if st := node.stereotype(); st != "" {
+			fmt.Fprintf(&b, "  <<%s>> %s\n", st, ids[node.ID])
+		} else if node.External {
+			fmt.Fprintf(&b, "  <<external>> %s\n", ids[node.ID])
+		}
+	}
+	for _, edge := range d.Edges {
+		from, to := ids[edge.From], ids[edge.To]
+		switch edge.Kind {
+		case "implements":
+			fmt.Fprintf(&b, "  %s <|.. %s\n", to, from)
+		case "embeds":
+			fmt.Fprintf(&b, "  %s *-- %s\n", from, to)
+		default:
+			fmt.Fprintf(&b, "  %s <|-- %s\n", to, from)
+		}
+	}
+	return b.String()
+}
+
+// PlantUML PlantUML 形式で出力する
+func (d *Diagram) PlantUML() string {
+	if d.Type == "sequence" {
+		return d.sequencePlantUML()
+	}
+	var b strings.Builder
+	ids := d.diagramAliases()
+	quote := func(s string) string { return `"` + strings.ReplaceAll(s, `"`, "'") + `"` }
+
+	b.WriteString("@startuml\n")
+	if d.Type == "er" {
+		b.WriteString("hide circle\n")
+		b.WriteString("skinparam linetype ortho\n")
+		for _, node := range d.Nodes {
+			fmt.Fprintf(&b, "entity %s as %s {\n", quote(node.Label), ids[node.ID])
+			keys := 0
+			for _, attr := range node.Attributes {
+				if containsString(attr.Keys, "PK") {
+					fmt.Fprintf(&b, "  * %s : %s <<PK>>\n", attr.Name, attr.Type)
+					keys++
+				}
+			}
+			if keys > 0 && keys < len(node.Attributes) {
+				b.WriteString("  --\n")
+			}
+			for _, attr := range node.Attributes {
+				if containsString(attr.Keys, "PK") {
+					continue
+				}
+				line := "  " + attr.Name + " : " + attr.Type
+				for _, key := range attr.Keys {
+					line += " <<" + key + ">>"
+				}
+				b.WriteString(line + "\n")
+			}
+			b.WriteString("}\n")
+		}
+		for _, edge := range d.Edges {
+			line := "--"
+			if edge.Kind == "inferred" {
+				line = ".."
+			}
+			child := "o{"
+			if edge.Cardinality == "one_to_one" {
+				child = "o|"
+			}
+			fmt.Fprintf(&b, "%s ||%s%s %s : %s\n", ids[edge.To], line, child, ids[edge.From], edge.Label)
+		}
+		b.WriteString("@enduml\n")
+		return b.String()
+	}
+	if d.Type != "classes" {
+		b.WriteString("left to right direction\n")
+		for _, node := range d.Nodes {
+			if node.External {
+				fmt.Fprintf(&b, "rectangle %s as %s #f6f8fa;line.dashed\n", quote(node.Label), ids[node.ID])
+			} else {
+				fmt.Fprintf(&b, "rectangle %s as %s\n", quote(node.Label), ids[node.ID])
+			}
+		}
+		for _, edge := range d.Edges {
+			arrow := "-->"
+			if edge.Cycle {
+				arrow = "-[#cf222e,bold]->"
+			}
+			fmt.Fprintf(&b, "%s %s %s\n", ids[edge.From], arrow, ids[edge.To])
+		}
+		b.WriteString("@enduml\n")
+		return b.String()
+	}
+
+	b.WriteString("hide empty members\n")
+	for _, node := range d.Nodes {
+		keyword := "class"
+		switch node.Kind {
+		case "interface", "enum", "annotation":
+			keyword = node.Kind
+		case "struct":
+			keyword = "struct"
+		}
+		header := fmt.Sprintf("%s %s as %s", keyword, quote(node.Label), ids[node.ID])
+		switch {
+		case node.External:
+			header += " <<external>>"
+		case keyword == "class" && node.stereotype() != "":
+			header += " <<" + node.stereotype() + ">>"
+		}
+		if len(node.Members) == 0 {
+			b.WriteString(header + "\n")
+			continue
+		}
+		b.WriteString(header + " {\n")
+		for _, member := range node.Members {
+			fmt.Fprintf(&b, "  %s\n", strings.NewReplacer("{", "(", "}", ")").Replace(member))
+		}
+		b.WriteString("}\n")
+	}
+	for _, edge := range d.Edges {
+		from, to := ids[edge.From], ids[edge.To]
+		switch edge.Kind {
+		case "implements":
+			fmt.Fprintf(&b, "%s <|.. %s\n", to, from)
+		case "embeds":
+			fmt.Fprintf(&b, "%s *-- %s\n", from, to)
+		default:
+			fmt.Fprintf(&b, "%s <|-- %s\n", to, from)
+		}
+	}
+	b.WriteString("@enduml\n")
+	return b.String()
+}
+
+// DOT Graphviz の DOT 形式で出力する（クラス図・ER 図は record 形のノード）
+func (d *Diagram) DOT() string {
+	if d.Type == "sequence" {
+		return d.sequenceDOT()
+	}
+	var b strings.Builder
+	b.WriteString("digraph diagram {\n")
+	if d.Type == "er" {
+		// 参照される表を上に置く
+		b.WriteString("  rankdir=BT;\n")
+		b.WriteString("  node [shape=record, fontname=\"Helvetica\", fontsize=10];\n")
+	} else if d.Type == "classes" {
+		// 親を上に置く
+		b.WriteString("  rankdir=BT;\n")
+		b.WriteString("  node [shape=record, fontname=\"Helvetica\", fontsize=10];\n")
+	} else {
+		b.WriteString("  rankdir=LR;\n")
+		b.WriteString("  node [shape=box, fontname=\"Helvetica\"];\n")
+	}
+
+	record := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "{", `\{`, "}", `\}`, "|", `\|`, "<", `\<`, ">", `\>`)
+	for _, node := range d.Nodes {
+		var attrs []string
+		if d.Type == "er" {
+			var columns strings.Builder
+			for _, line := range node.memberLines() {
+				columns.WriteString(record.Replace(line) + `\l`)
+			}
+			attrs = append(attrs, `label="{`+record.Replace(node.Label)+"|"+columns.String()+`}"`)
+		} else if d.Type == "classes" {
+			title := record.Replace(node.Label)
+			if st := node.stereotype(); st != "" {
+				title = `\<\<` + st + `\>\>\n` + title
+			}
+			label := title
+			if len(node.Members) > 0 {
+				var members strings.Builder
+				for _, member := range node.Members {
+					members.WriteString(record.Replace(member) + `\l`)
+				}
+				label = title + "|" + members.String()
+			}
+			attrs = append(attrs, `label="{`+label+`}"`)
+		} else {
+			attrs = append(attrs, "label="+dotQuote(node.Label))
+		}
+		if node.File != "" {
+			attrs = append(attrs, "tooltip="+dotQuote(node.File))
+		}
+		if node.External {
+			attrs = append(attrs, `style=dashed`, `color="#8c959f"`, `fontcolor="#57606a"`)
+		}
+		fmt.Fprintf(&b, "  %s [%s];\n", dotQuote(node.ID), strings.Join(attrs, ", "))
+	}
+
+	for _, edge := range d.Edges {
+		var attrs []string
+		switch edge.Kind {
+		case "extends":
+			attrs = append(attrs, "arrowhead=empty")
+		case "implements":
+			attrs = append(attrs, "arrowhead=empty", "style=dashed")
+		case "embeds":
+			attrs = append(attrs, "arrowhead=none", "arrowtail=diamond", "dir=both")
+		case "references", "inferred":
+			attrs = append(attrs, "arrowhead=tee", "arrowtail=crow", "dir=both")
+			if edge.Cardinality == "one_to_one" {
+				attrs[len(attrs)-2] = "arrowtail=teeodot"
+			}
+			if edge.Kind == "inferred" {
+				attrs = append(attrs, "style=dashed")
+			}
+			if edge.Label != "" {
+				attrs = append(attrs, "label="+dotQuote(edge.Label), "fontsize=9")
+			}
+		}
+		if edge.Cycle {
+			attrs = append(attrs, `color="#cf222e"`, "penwidth=2")
+		}
+		suffix := ""
+		if len(attrs) > 0 {
+			suffix = " [" + strings.Join(attrs, ", ") + "]"
+		}
+		fmt.Fprintf(&b, "  %s -> %s%s;\n", dotQuote(edge.From), dotQuote(edge.To), suffix)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,520 @@
+package services
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"regexp"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// クラス図に載せる型の種別
+var classDiagramKinds = map[string]bool{
+	"class": true, "struct": true, "interface": true, "enum": true, "module": true, "message": true, "annotation": true,
+}
+
+// クラス図にメンバーとして載せる種別
+var classMemberKinds = map[string]bool{
+	"method": true, "function": true, "property": true, "field": true, "variable": true, "constant": true,
+}
+
+var (
+	extendsClauseRe    = regexp.MustCompile(`\bextends\s+(.+?)(?:\bimplements\b|\bwith\b|\{|$)`)
+	implementsClauseRe = regexp.MustCompile(`\bimplements\s+(.+?)(?:\bextends\b|\{|$)`)
+	scalaWithRe        = regexp.MustCompile(`\bwith\s+([\w.\[\], ]+?)(?:\bwith\b|\{|$)`)
+	rubySuperclassRe   = regexp.MustCompile(`^\s*<\s*([\w:]+)`)
+	rustImplForRe      = regexp.MustCompile(`^\s*(?:unsafe\s+)?impl\s*(?:<[^{]*?>)?\s+([\w:]+)(?:<[^{]*?>)?\s+for\s+([\w:]+)`)
+	cppAccessRe        = regexp.MustCompile(`^(?:(?:public|private|protected|virtual|internal)\s+)+`)
+)
+
+// classRelation 継承元の宣言（解決前）
+type classRelation struct {
+	from string // ノード ID
+	file string
+	to   string // 宣言に書かれたままの名前
+	kind string // extends, implements。宣言から判断できない場合は空
+}
+
+// ClassDiagram アップロードされたソースからクラス・構造体・インターフェースの継承関係とメンバーを取り出す
+// Go は go/types で埋め込みとインターフェースの実装を解決し、その他の言語はシンボル抽出と継承の宣言から推定する
+func ClassDiagram(files []models.File) *Diagram {
+	b := newDiagramBuilder("classes")
+	addGoClassDiagram(b, files)
+	addSourceClassDiagram(b, files)
+	return b.build()
+}
+
+// addGoClassDiagram Go の構造体・インターフェースと、埋め込み・実装の関係を追加する
+func addGoClassDiagram(b *diagramBuilder, files []models.File) {
+	p := loadGoProject(files)
+	if p == nil {
+		return
+	}
+	multiple := len(p.packages) > 1
+	typeID := func(obj *types.TypeName) string {
+		return obj.Pkg().Path() + "." + obj.Name()
+	}
+	// パッケージが1つだけならパッケージ名は付けない
+	typeLabel := func(obj *types.TypeName) string {
+		if multiple {
+			return obj.Pkg().Name() + "." + obj.Name()
+		}
+		return obj.Name()
+	}
+	// 埋め込みの型のノード。プロジェクト外のパッケージは型検査で空のパッケージとして扱っているので、
+	// 型が解決できない場合はソース上の記述（sync.Mutex など）で外部の型として追加する
+	embedded := func(info *types.Info, expr ast.Expr) string {
+		if star, ok := expr.(*ast.StarExpr); ok {
+			expr = star.X
+		}
+		switch e := expr.(type) {
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		}
+		var ident *ast.Ident
+		switch e := expr.(type) {
+		case *ast.Ident:
+			ident = e
+		case *ast.SelectorExpr:
+			ident = e.Sel
+		default:
+			// 型制約の ~int | string など
+			return ""
+		}
+		if obj, ok := info.Uses[ident].(*types.TypeName); ok && obj.Pkg() != nil && p.pkgs[obj.Pkg()] {
+			return typeID(obj)
+		}
+		name := types.ExprString(expr)
+		b.addNode(DiagramNode{ID: name, Label: name, Kind: "class", External: true})
+		return name
+	}
+	// 埋め込みの記述を型ごとに集める（構造体の埋め込みフィールド・インターフェースの埋め込み）
+	type embedding struct {
+		info  *types.Info
+		exprs []ast.Expr
+	}
+	embeddings := make(map[types.Object]*embedding)
+	for _, sp := range p.packages {
+		for _, f := range sp.files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				spec, ok := n.(*ast.TypeSpec)
+				if !ok {
+					return true
+				}
+				obj := sp.info.Defs[spec.Name]
+				var fields *ast.FieldList
+				switch t := spec.Type.(type) {
+				case *ast.StructType:
+					fields = t.Fields
+				case *ast.InterfaceType:
+					fields = t.Methods
+				}
+				if obj == nil || fields == nil {
+					return false
+				}
+				e := &embedding{info: sp.info}
+				for _, field := range fields.List {
+					if len(field.Names) == 0 {
+						e.exprs = append(e.exprs, field.Type)
+					}
+				}
+				embeddings[obj] = e
+				return false
+			})
+		}
+	}
+
+	var named []*types.Named
+	for _, n := range p.namedTypes() {
+		obj := n.Obj()
+		qualifier := types.RelativeTo(obj.Pkg())
+		var members []string
+		kind := ""
+		switch u := n.Underlying().(type) {
+		case *types.Struct:
+			kind = "struct"
+			for i := 0; i < u.NumFields(); i++ {
+				field := u.Field(i)
+				if !field.Embedded() {
+					members = append(members, field.Name()+" "+types.TypeString(field.Type(), qualifier))
+				}
+			}
+		case *types.Interface:
+			kind = "interface"
+			for i := 0; i < u.NumExplicitMethods(); i++ {
+				m := u.ExplicitMethod(i)
+				members = append(members, m.Name()+strings.TrimPrefix(types.TypeString(m.Type(), qualifier), "func"))
+			}
+		default:
+			// type Kind int のような型はメソッドを持つものだけ載せる
+			if n.NumMethods() == 0 {
+				continue
+			}
+			kind = "type"
+		}
+		for i := 0; i < n.NumMethods(); i++ {
+			m := n.Method(i)
+			members = append(members, m.Name()+strings.TrimPrefix(types.TypeString(m.Type(), qualifier), "func"))
+		}
+		b.addNode(DiagramNode{
+			ID:      typeID(obj),
+			Label:   typeLabel(obj),
+			Kind:    kind,
+			Members: limitDiagramMembers(members),
+			File:    p.fset.Position(obj.Pos()).Filename,
+		})
+		named = append(named, n)
+	}
+
+	for _, n := range named {
+		e := embeddings[n.Obj()]
+		if e == nil {
+			continue
+		}
+		kind := "embeds"
+		if types.IsInterface(n) {
+			kind = "extends"
+		}
+		for _, expr := range e.exprs {
+			b.addEdge(typeID(n.Obj()), embedded(e.info, expr), kind)
+		}
+	}
+
+	// メソッドを持つインターフェースを満たすプロジェクト内の型（空のインターフェースはすべての型が満たすので除く）
+	for _, iface := range named {
+		it, ok := iface.Underlying().(*types.Interface)
+		if !ok || it.NumMethods() == 0 || iface.TypeParams().Len() > 0 {
+			continue
+		}
+		for _, n := range named {
+			if types.IsInterface(n) || n.TypeParams().Len() > 0 {
+				continue
+			}
+			if goImplements(n, it) {
+				b.addEdge(typeID(n.Obj()), typeID(iface.Obj()), "implements")
+			}
+		}
+	}
+}
+
+// goImplements 型（またはそのポインタ）がインターフェースを満たすか
+// 解決できない外部の型を埋め込んでいると types.Implements は何でも満たすとみなすので、メソッドが実際に見つかることも確かめる
+func goImplements(n *types.Named, iface *types.Interface) bool {
+	ptr := types.NewPointer(n)
+	if !types.Implements(n, iface) && !types.Implements(ptr, iface) {
+		return false
+	}
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		obj, _, _ := types.LookupFieldOrMethod(ptr, false, m.Pkg(), m.Name())
+		if _, ok := obj.(*types.Func); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// addSourceClassDiagram Go 以外の言語のクラスと継承関係を追加する
+func addSourceClassDiagram(b *diagramBuilder, files []models.File) {
+	var relations []classRelation
+	// 名前ごとのノード ID（別のファイルの同名のクラスは ファイル名:クラス名 で区別する）
+	byName := make(map[string][]string)
+	fileOf := make(map[string]string)
+	for i := range files {
+		file := &files[i]
+		if file.Content == "" || file.Language == "go" || symbolRules[file.Language] == nil {
+			continue
+		}
+		masked := strings.Split(MaskSource(file.Language, file.Content), "\n")
+		defs := ExtractSymbols(file.Language, file.Content)
+		defLines := make(map[int]bool)
+		for _, def := range defs {
+			defLines[def.Line] = true
+		}
+		for _, def := range defs {
+			if !classDiagramKinds[def.Kind] {
+				continue
+			}
+			var members []string
+			for _, member := range defs {
+				if member.Container != def.Name || !classMemberKinds[member.Kind] {
+					continue
+				}
+				if member.Kind == "method" || member.Kind == "function" {
+					members = append(members, member.Name+"()")
+				} else {
+					members = append(members, member.Name)
+				}
+			}
+			id := def.Name
+			if existing := b.node(id); existing != nil {
+				// 同じファイルで開き直したクラス（Ruby など）は1つにまとめる
+				if existing.File == file.Name {
+					continue
+				}
+				id = file.Name + ":" + def.Name
+			}
+			b.addNode(DiagramNode{ID: id, Label: def.Name, Kind: def.Kind, Members: limitDiagramMembers(members), File: file.Name})
+			byName[def.Name] = append(byName[def.Name], id)
+			fileOf[id] = file.Name
+			for _, rel := range classHeritage(file.Language, def.Kind, classHeader(file.Language, masked, defLines, def)) {
+				rel.from, rel.file = id, file.Name
+				relations = append(relations, rel)
+			}
+		}
+		if file.Language == "rust" {
+			for _, line := range masked {
+				if m := rustImplForRe.FindStringSubmatch(line); m != nil {
+					relations = append(relations, classRelation{from: lastPathElement(m[2]), file: file.Name, to: m[1], kind: "implements"})
+				}
+			}
+		}
+	}
+	// 同じ名前の型が複数あれば同じファイルのものを優先する
+	resolve := func(name, file string) string {
+		ids := byName[name]
+		for _, id := range ids {
+			if fileOf[id] == file {
+				return id
+			}
+		}
+		if len(ids) > 0 {
+			return ids[0]
+		}
+		return ""
+	}
+
+	for _, rel := range relations {
+		if rel.from = resolve(lastPathElement(rel.from), rel.file); rel.from == "" {
+			continue
+		}
+		// プロジェクト内に同名の型があればそれにつなぎ、なければ書かれた名前で外部の型として追加する
+		target := resolve(lastPathElement(rel.to), rel.file)
+		node := b.node(target)
+		if node == nil {
+			target = rel.to
+			if node = b.node(target); node == nil {
+				node = b.addNode(DiagramNode{ID: target, Label: target, Kind: "class", External: true})
+			}
+		}
+		if target == rel.from {
+			continue
+		}
+		kind := rel.kind
+		if node.Kind == "interface" {
+			// インターフェースがインターフェースを継承する場合だけ extends
+			kind = "implements"
+			if b.node(rel.from).Kind == "interface" {
+				kind = "extends"
+			}
+		} else if kind == "" {
+			kind = "extends"
+		}
+		b.addEdge(rel.from, target, kind)
+	}
+}
+
+// classHeader 型名の直後から本体の { までの宣言を返す（複数行の宣言は1行にまとめる）
+// Python・Ruby は1行目だけ、その他は次の定義の行・; の手前で打ち切る
+func classHeader(language string, masked []string, defLines map[int]bool, def SymbolDef) string {
+	start := def.Line - 1
+	if start < 0 || start >= len(masked) {
+		return ""
+	}
+	limit := start + 5
+	if indentLanguages[language] {
+		limit = start + 1
+	}
+	var sb strings.Builder
+	for i := start; i < len(masked) && i < limit; i++ {
+		if i > start && defLines[i+1] {
+			break
+		}
+		line := masked[i]
+		if i == start {
+			col := def.Column - 1 + len(def.Name)
+			if col < 0 || col > len(line) {
+				return ""
+			}
+			line = line[col:]
+		}
+		if j := strings.IndexAny(line, "{;"); j >= 0 {
+			sb.WriteString(line[:j])
+			break
+		}
+		sb.WriteString(line + " ")
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// classHeritage 宣言から継承元を取り出す
+func classHeritage(language, kind, header string) []classRelation {
+	var relations []classRelation
+	add := func(list, relKind string) {
+		for _, name := range splitTopLevel(list, ',') {
+			if name = cleanTypeName(name); name != "" {
+				relations = append(relations, classRelation{to: name, kind: relKind})
+			}
+		}
+	}
+	header = skipBalanced(strings.TrimSpace(header), '<', '>')
+
+	switch language {
+	case "python":
+		if strings.HasPrefix(header, "(") {
+			inner := strings.TrimSuffix(strings.TrimSpace(strings.SplitN(header, ":", 2)[0]), ")")
+			for _, base := range splitTopLevel(strings.TrimPrefix(inner, "("), ',') {
+				base = strings.TrimSpace(base)
+				// metaclass=... などのキーワード引数と object は継承元として扱わない
+				if base == "" || base == "object" || strings.Contains(base, "=") || strings.HasPrefix(base, "*") {
+					continue
+				}
+				relations = append(relations, classRelation{to: cleanTypeName(base), kind: "extends"})
+			}
+		}
+	case "ruby":
+		if m := rubySuperclassRe.FindStringSubmatch(header); m != nil {
+			relations = append(relations, classRelation{to: m[1], kind: "extends"})
+		}
+	case "javascript", "typescript", "java", "php", "scala", "groovy":
+		if language == "scala" {
+			header = skipBalanced(header, '(', ')')
+		}
+		if m := extendsClauseRe.FindStringSubmatch(header); m != nil {
+			extendsKind := "extends"
+			if language == "scala" && kind == "interface" {
+				extendsKind = ""
+			}
+			add(m[1], extendsKind)
+		}
+		if m := implementsClauseRe.FindStringSubmatch(header); m != nil {
+			add(m[1], "implements")
+		}
+		if language == "scala" {
+			for _, m := range scalaWithRe.FindAllStringSubmatch(header, -1) {
+				add(m[1], "implements")
+			}
+		}
+	case "csharp", "kotlin", "swift", "cpp", "c":
+		// Kotlin の主コンストラクタ class A(val x: Int) : B()、C++ の struct A final : B
+		header = strings.TrimSpace(strings.TrimPrefix(skipBalanced(header, '(', ')'), "final"))
+		if !strings.HasPrefix(header, ":") {
+			break
+		}
+		list := header[1:]
+		if i := strings.Index(list, " where "); i >= 0 {
+			list = list[:i]
+		}
+		for i, base := range splitTopLevel(list, ',') {
+			base = strings.TrimSpace(cppAccessRe.ReplaceAllString(strings.TrimSpace(base), ""))
+			relKind := ""
+			switch language {
+			case "kotlin":
+				// スーパークラスはコンストラクタ呼び出しを伴う
+				relKind = "implements"
+				if strings.Contains(base, "(") {
+					relKind = "extends"
+				}
+			case "csharp":
+				if name := cleanTypeName(base); len(name) > 1 && name[0] == 'I' && name[1] >= 'A' && name[1] <= 'Z' {
+					relKind = "implements"
+				}
+			case "swift":
+				// 構造体・列挙型は継承できないのでプロトコルへの準拠
+				if kind != "class" || i > 0 {
+					relKind = "implements"
+				}
+			}
+			if name := cleanTypeName(base); name != "" {
+				relations = append(relations, classRelation{to: name, kind: relKind})
+			}
+		}
+	case "rust":
+		if strings.HasPrefix(header, ":") {
+			for _, base := range strings.Split(strings.TrimPrefix(header, ":"), "+") {
+				if name := cleanTypeName(base); name != "" && !strings.HasPrefix(name, "'") {
+					relations = append(relations, classRelation{to: name, kind: "extends"})
+				}
+			}
+		}
+	}
+	return relations
+}
+
+// cleanTypeName 継承元の記述から型名だけを取り出す（ジェネリクス・コンストラクタ引数・修飾を除く）
+func cleanTypeName(s string) string {
+	s = strings.TrimSpace(s)
+	for _, open := range []byte{'<', '(', '['} {
+		if i := strings.IndexByte(s, open); i >= 0 {
+			s = s[:i]
+		}
+	}
+	if fields := strings.Fields(s); len(fields) > 0 {
+		s = fields[len(fields)-1]
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, `\`), "?")
+	if s == "" || !isCallIdentByte(s[0]) {
+		return ""
+	}
+	return s
+}
+
+// lastPathElement 修飾された名前（a.b.C、a::C、A\B\C）の最後の要素
+func lastPathElement(name string) string {
+	if i := strings.LastIndexAny(name, `.:\`); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// skipBalanced 先頭が open の場合、対応する close の後ろを返す
+func skipBalanced(s string, open, close byte) string {
+	if !strings.HasPrefix(s, string(open)) {
+		return s
+	}
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case open:
+			depth++
+		case close:
+			if depth--; depth == 0 {
+				return strings.TrimSpace(s[i+1:])
+			}
+		}
+	}
+	return ""
+}
+
+// splitTopLevel 括弧の外にある sep で区切る
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(', '<', '[', '{':
+			depth++
+		case ')', '>', ']', '}':
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// limitDiagramMembers 表示するメンバーを上限までに切り詰める
+func limitDiagramMembers(members []string) []string {
+	if len(members) <= maxDiagramMembers {
+		return members
+	}
+	rest := len(members) - maxDiagramMembers
+	return append(members[:maxDiagramMembers:maxDiagramMembers], fmt.Sprintf("... %d more", rest))
+}
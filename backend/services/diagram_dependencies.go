@@ -0,0 +1,231 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// 依存関係の一覧として扱うキー（AI の回答によって名前が揺れる）
+var dependencyMapKeys = []string{"dependency_map", "dependencies", "file_dependencies", "dependency_graph", "dependencyMap"}
+
+// 1ファイル分のオブジェクトの中で依存先の一覧として扱うキー
+var dependencyListKeys = []string{"imports", "depends_on", "dependencies", "requires", "uses", "internal", "external", "modules"}
+
+// DependencyDiagram dependency_map 解析の結果から依存関係図を作る
+// AI の回答の {"dependency_map": {"a.go": ["b.go"]}} のほか、依存先をオブジェクトや from/to の配列で返す形、
+// .pyc から復元した import（bytecode）にも対応する。projectFiles にないファイル・モジュールは外部として扱う
+func DependencyDiagram(result string, projectFiles []string) (*Diagram, error) {
+	root, err := decodeAIJSON(result)
+	if err != nil {
+		return nil, fmt.Errorf("analysis result is not JSON: %w", err)
+	}
+	// AI の回答が JSON でなかった場合、mergeBytecodeDependencies は元の文字列を analysis に入れている
+	if raw, ok := root["analysis"].(string); ok {
+		if inner, err := decodeAIJSON(raw); err == nil {
+			for key, value := range inner {
+				if _, exists := root[key]; !exists {
+					root[key] = value
+				}
+			}
+		}
+	}
+
+	known := make(map[string]bool)
+	for _, name := range projectFiles {
+		known[name] = true
+		known[path.Base(name)] = true
+	}
+	b := newDiagramBuilder("dependencies")
+	for _, key := range dependencyMapKeys {
+		if value, ok := root[key]; ok && addDependencyEntries(b, value, known) {
+			break
+		}
+	}
+	if bytecode, ok := root["bytecode"].(map[string]interface{}); ok {
+		addBytecodeDependencies(b, bytecode)
+	}
+	if len(b.diagram.Nodes) == 0 {
+		return nil, fmt.Errorf("no dependency map found in analysis result")
+	}
+	return b.build(), nil
+}
+
+// decodeAIJSON AI の回答から JSON オブジェクトを取り出す（```json のコードブロックや前後の説明文を許す）
+func decodeAIJSON(text string) (map[string]interface{}, error) {
+	var root map[string]interface{}
+	text = strings.TrimSpace(text)
+	err := json.Unmarshal([]byte(text), &root)
+	if err == nil {
+		return root, nil
+	}
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end <= start {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(text[start:end+1]), &root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// addDependencyEntries 依存関係の一覧を図に追加する。1件でも読み取れれば true
+func addDependencyEntries(b *diagramBuilder, value interface{}, known map[string]bool) bool {
+	added := false
+	addTarget := func(from string, dep dependencyTarget) {
+		b.addNode(dependencyNode(dep.name, dep.external || !known[dep.name]))
+		b.addEdge(from, dep.name, "depends")
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		// キーになっているものはプロジェクト内のファイル・モジュール
+		for _, key := range keys {
+			b.addNode(dependencyNode(key, false))
+		}
+		for _, key := range keys {
+			for _, dep := range dependencyTargets(v[key]) {
+				addTarget(key, dep)
+			}
+			added = true
+		}
+
+	case []interface{}:
+		for _, item := range v {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			from := firstString(obj, "from", "source", "file", "name", "module")
+			if from == "" {
+				continue
+			}
+			b.addNode(dependencyNode(from, false))
+			added = true
+			if to := firstString(obj, "to", "target"); to != "" {
+				addTarget(from, dependencyTarget{name: to})
+				continue
+			}
+			for _, dep := range dependencyTargets(obj) {
+				addTarget(from, dep)
+			}
+		}
+	}
+	return added
+}
+
+type dependencyTarget struct {
+	name     string
+	external bool
+}
+
+// dependencyTargets 1ファイル分の依存先（文字列、文字列の配列、{"imports": [...]} のようなオブジェクト）を取り出す
+func dependencyTargets(value interface{}) []dependencyTarget {
+	var targets []dependencyTarget
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			targets = append(targets, dependencyTarget{name: v})
+		}
+	case []interface{}:
+		for _, item := range v {
+			switch item := item.(type) {
+			case string:
+				if item != "" {
+					targets = append(targets, dependencyTarget{name: item})
+				}
+			case map[string]interface{}:
+				if name := firstString(item, "name", "file", "module", "path", "target", "to"); name != "" {
+					targets = append(targets, dependencyTarget{name: name})
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, key := range dependencyListKeys {
+			for _, target := range dependencyTargets(v[key]) {
+				target.external = key == "external"
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets
+}
+
+func firstString(obj map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if s, ok := obj[key].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// dependencyNode 依存関係図のノード（一覧のキーになっているものはプロジェクト内として後から上書きされる）
+func dependencyNode(name string, external bool) DiagramNode {
+	kind := "module"
+	if path.Ext(name) != "" {
+		kind = "file"
+	}
+	return DiagramNode{ID: name, Label: name, Kind: kind, External: external}
+}
+
+// addBytecodeDependencies .pyc から復元した import を依存関係として追加する
+func addBytecodeDependencies(b *diagramBuilder, bytecode map[string]interface{}) {
+	files := make([]string, 0, len(bytecode))
+	for name := range bytecode {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+
+	// 同じプロジェクトの .pyc・.py はモジュール名で引けるようにする
+	modules := make(map[string]string)
+	for _, node := range b.diagram.Nodes {
+		if strings.HasSuffix(node.ID, ".py") || strings.HasSuffix(node.ID, ".pyc") {
+			modules[pythonModuleName(node.ID)] = node.ID
+		}
+	}
+	for _, name := range files {
+		modules[pythonModuleName(name)] = name
+	}
+
+	for _, name := range files {
+		b.addNode(DiagramNode{ID: name, Label: name, Kind: "file"})
+		structure, _ := bytecode[name].(map[string]interface{})
+		imports, _ := structure["imports"].([]interface{})
+		for _, item := range imports {
+			imp, _ := item.(map[string]interface{})
+			module, _ := imp["module"].(string)
+			if module == "" {
+				continue
+			}
+			if target, ok := modules[module]; ok {
+				b.addEdge(name, target, "depends")
+				continue
+			}
+			b.addNode(DiagramNode{ID: module, Label: module, Kind: "module", External: true})
+			b.addEdge(name, module, "depends")
+		}
+	}
+}
+
+// pythonModuleName ファイル名からモジュール名を求める（pkg/mod.cpython-311.pyc → pkg.mod）
+func pythonModuleName(name string) string {
+	name = strings.TrimPrefix(name, "__pycache__/")
+	name = strings.ReplaceAll(name, "/__pycache__/", "/")
+	base := path.Base(name)
+	if i := strings.Index(base, "."); i >= 0 {
+		base = base[:i]
+	}
+	dir := path.Dir(name)
+	module := base
+	if dir != "." {
+		module = strings.ReplaceAll(dir, "/", ".") + "." + base
+	}
+	return strings.TrimSuffix(module, ".__init__")
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+)
+
+// シーケンス図の配置
+const (
+	svgSequenceColumnGap = 40.0 // 参加者の間隔（ラベルの幅を足す）
+	svgSequenceRowHeight = 28.0 // 矢印1本分の高さ
+	svgSequenceHeader    = 32.0 // 参加者の箱の高さ
+)
+
+// sequenceMermaid sequenceDiagram の記法で出力する
+func (d *Diagram) sequenceMermaid() string {
+	var b strings.Builder
+	ids := d.diagramAliases()
+	b.WriteString("sequenceDiagram\n")
+	for _, node := range d.Nodes {
+		keyword := "participant"
+		if node.Kind == "client" {
+			keyword = "actor"
+		}
+		fmt.Fprintf(&b, "  %s %s as %s\n", keyword, ids[node.ID], strings.NewReplacer(";", ",", "#", "").Replace(node.Label))
+	}
+	label := strings.NewReplacer(";", ",", "#", "", "\n", " ")
+	for _, edge := range d.Edges {
+		arrow := "->>"
+		if edge.Kind == "response" {
+			arrow = "-->>"
+		}
+		fmt.Fprintf(&b, "  %s%s%s: %s\n", ids[edge.From], arrow, ids[edge.To], label.Replace(edge.Label))
+	}
+	return b.String()
+}
+
+// sequencePlantUML PlantUML のシーケンス図で出力する
+func (d *Diagram) sequencePlantUML() string {
+	var b strings.Builder
+	ids := d.diagramAliases()
+	b.WriteString("@startuml\n")
+	for _, node := range d.Nodes {
+		keyword := "participant"
+		if node.Kind == "client" {
+			keyword = "actor"
+		}
+		fmt.Fprintf(&b, "%s \"%s\" as %s\n", keyword, strings.ReplaceAll(node.Label, `"`, "'"), ids[node.ID])
+	}
+	for _, edge := range d.Edges {
+		arrow := "->"
+		if edge.Kind == "response" {
+			arrow = "-->"
+		}
+		fmt.Fprintf(&b, "%s %s %s : %s\n", ids[edge.From], arrow, ids[edge.To], edge.Label)
+	}
+	b.WriteString("@enduml\n")
+	return b.String()
+}
+
+// sequenceDOT DOT には時間の軸がないので、矢印に順番の番号を付ける
+func (d *Diagram) sequenceDOT() string {
+	var b strings.Builder
+	b.WriteString("digraph diagram {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, fontname=\"Helvetica\"];\n")
+	b.WriteString("  edge [fontname=\"Helvetica\", fontsize=10];\n")
+	for _, node := range d.Nodes {
+		shape := ""
+		if node.Kind == "client" {
+			shape = ", shape=ellipse"
+		}
+		fmt.Fprintf(&b, "  %s [label=%s%s];\n", dotQuote(node.ID), dotQuote(node.Label), shape)
+	}
+	for i, edge := range d.Edges {
+		style := ""
+		if edge.Kind == "response" {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&b, "  %s -> %s [label=%s%s];\n", dotQuote(edge.From), dotQuote(edge.To), dotQuote(fmt.Sprintf("%d. %s", i+1, edge.Label)), style)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// sequenceSVG 参加者を横に並べ、矢印を上から時刻順に描く
+func (d *Diagram) sequenceSVG() string {
+	index := make(map[string]int, len(d.Nodes))
+	centers := make([]float64, len(d.Nodes))
+	widths := make([]float64, len(d.Nodes))
+	for i, node := range d.Nodes {
+		index[node.ID] = i
+		widths[i] = math.Max(svgTextWidth(node.Label)+24, 80)
+	}
+	// 隣り合う参加者の間はその間を通る矢印のラベルが収まる幅にする
+	gaps := make([]float64, len(d.Nodes))
+	for _, edge := range d.Edges {
+		from, to := index[edge.From], index[edge.To]
+		if from > to {
+			from, to = to, from
+		}
+		if from == to {
+			continue
+		}
+		need := (svgTextWidth(edge.Label) + 16) / float64(to-from)
+		for i := from; i < to; i++ {
+			gaps[i] = math.Max(gaps[i], need)
+		}
+	}
+	x := svgMargin
+	for i := range d.Nodes {
+		centers[i] = x + widths[i]/2
+		next := widths[i]/2 + svgSequenceColumnGap
+		if i+1 < len(d.Nodes) {
+			next = math.Max(next+widths[i+1]/2, gaps[i])
+		}
+		x = centers[i] + next
+	}
+	width := svgMargin
+	if len(d.Nodes) > 0 {
+		width = centers[len(d.Nodes)-1] + widths[len(d.Nodes)-1]/2 + svgMargin
+	}
+	top := svgMargin + svgSequenceHeader
+	height := top + svgSequenceRowHeight*float64(len(d.Edges)+1) + svgMargin
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f">`+"\n", width, height, width, height)
+	b.WriteString(`<style>
+text{font-family:Menlo,Consolas,"DejaVu Sans Mono",monospace;font-size:12px;fill:#24292f}
+.participant rect{fill:#ffffff;stroke:#57606a;stroke-width:1}
+.participant.client rect{fill:#f6f8fa}
+.lifeline{stroke:#8c959f;stroke-dasharray:4 3}
+.message{stroke:#57606a;stroke-width:1.2;fill:none}
+.message.response{stroke-dasharray:6 4}
+</style>
+<defs>
+<marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto-start-reverse"><path d="M0,0 L10,5 L0,10 z" fill="#57606a"/></marker>
+</defs>
+`)
+	for i, node := range d.Nodes {
+		fmt.Fprintf(&b, `<line class="lifeline" x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f"/>`+"\n", centers[i], top, centers[i], height-svgMargin)
+		fmt.Fprintf(&b, `<g class="participant %s"><rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" rx="4"/><text x="%.1f" y="%.1f" text-anchor="middle">%s</text></g>`+"\n",
+			node.Kind, centers[i]-widths[i]/2, svgMargin, widths[i], svgSequenceHeader, centers[i], svgMargin+svgSequenceHeader/2+4, html.EscapeString(node.Label))
+	}
+	for i, edge := range d.Edges {
+		from, ok1 := index[edge.From]
+		to, ok2 := index[edge.To]
+		if !ok1 || !ok2 {
+			continue
+		}
+		y := top + svgSequenceRowHeight*float64(i+1)
+		x1, x2 := centers[from], centers[to]
+		if from == to {
+			x2 = x1 + 30
+		}
+		fmt.Fprintf(&b, `<line class="message %s" x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" marker-end="url(#arrow)"/>`+"\n", edge.Kind, x1, y, x2, y)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`+"\n", (x1+x2)/2, y-5, html.EscapeString(edge.Label))
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
@@ -0,0 +1,561 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// SVG で描くノード数の上限（それを超える図は DOT などを外部のツールで描く）
+const maxSVGNodes = 400
+
+const (
+	svgMargin     = 20.0
+	svgNodeGap    = 28.0 // 同じ層のノードの間隔
+	svgDummyGap   = 12.0 // 層をまたぐ辺の中継点の間隔
+	svgLayerGap   = 60.0 // 層の間隔
+	svgCharWidth  = 7.2  // 12px の等幅フォントの1文字の幅
+	svgLineHeight = 15.0
+	svgSweeps     = 24 // 交差を減らす並べ替えの回数
+)
+
+// layoutVertex レイアウト上の頂点（ノード、または層をまたぐ辺の中継点）
+type layoutVertex struct {
+	node          int // d.Nodes の添字。中継点は -1
+	layer         int
+	pos           int // 層の中の順番
+	x, y          float64
+	width, height float64
+	up, down      []int // 隣接する頂点（上の層・下の層）
+}
+
+// layoutEdge 上の層から下の層へ向かう辺
+type layoutEdge struct {
+	edge     int // d.Edges の添字
+	upper    int
+	lower    int
+	fromLow  bool  // 元の辺の From が下側のノード
+	vertices []int // upper から lower までの頂点（中継点を含む）
+}
+
+// SVG 図を階層レイアウト（Sugiyama 法の簡易版）で配置して SVG として出力する
+// 依存関係図は依存する側を上に、クラス図は親を上に置く
+func (d *Diagram) SVG() (string, error) {
+	if d.Type == "sequence" {
+		return d.sequenceSVG(), nil
+	}
+	if len(d.Nodes) > maxSVGNodes {
+		return "", fmt.Errorf("diagram has %d nodes; SVG rendering is limited to %d (use dot, mermaid or plantuml)", len(d.Nodes), maxSVGNodes)
+	}
+	index := make(map[string]int, len(d.Nodes))
+	for i, node := range d.Nodes {
+		index[node.ID] = i
+	}
+
+	vertices := make([]*layoutVertex, len(d.Nodes))
+	for i, node := range d.Nodes {
+		w, h := d.svgNodeSize(node)
+		vertices[i] = &layoutVertex{node: i, width: w, height: h}
+	}
+
+	// 辺ごとに上下の向きを決める
+	var edges []*layoutEdge
+	for i, edge := range d.Edges {
+		from, ok1 := index[edge.From]
+		to, ok2 := index[edge.To]
+		if !ok1 || !ok2 || from == to {
+			continue
+		}
+		upper, lower, fromLow := from, to, false
+		if d.Type != "dependencies" {
+			upper, lower, fromLow = to, from, true
+		}
+		edges = append(edges, &layoutEdge{edge: i, upper: upper, lower: lower, fromLow: fromLow})
+	}
+
+	connected := make([]bool, len(d.Nodes))
+	for _, e := range edges {
+		connected[e.upper], connected[e.lower] = true, true
+	}
+	breakLayoutCycles(len(d.Nodes), edges)
+	layers := assignLayers(len(d.Nodes), edges, connected)
+	for v, layer := range layers {
+		vertices[v].layer = layer
+	}
+
+	// 2層以上またぐ辺には中継点を置く
+	for _, e := range edges {
+		e.vertices = []int{e.upper}
+		prev := e.upper
+		for layer := vertices[e.upper].layer + 1; layer < vertices[e.lower].layer; layer++ {
+			dummy := len(vertices)
+			vertices = append(vertices, &layoutVertex{node: -1, layer: layer})
+			vertices[prev].down = append(vertices[prev].down, dummy)
+			vertices[dummy].up = append(vertices[dummy].up, prev)
+			e.vertices = append(e.vertices, dummy)
+			prev = dummy
+		}
+		vertices[prev].down = append(vertices[prev].down, e.lower)
+		vertices[e.lower].up = append(vertices[e.lower].up, prev)
+		e.vertices = append(e.vertices, e.lower)
+	}
+
+	var isolated []int
+	maxLayer := -1
+	for v := range d.Nodes {
+		if connected[v] {
+			maxLayer = max(maxLayer, vertices[v].layer)
+		} else {
+			isolated = append(isolated, v)
+		}
+	}
+	rows := make([][]int, maxLayer+1)
+	for v, vertex := range vertices {
+		if vertex.node < 0 || connected[vertex.node] {
+			rows[vertex.layer] = append(rows[vertex.layer], v)
+		}
+	}
+
+	orderLayers(vertices, rows)
+	width, height := placeLayers(vertices, rows)
+
+	// どの辺にもつながっていないノードは下にまとめて並べる
+	if len(isolated) > 0 {
+		rowWidth := math.Max(width, 960)
+		x, y, lineHeight := svgMargin, height+svgLayerGap/2, 0.0
+		if len(rows) == 0 {
+			y = svgMargin
+		}
+		for _, v := range isolated {
+			vertex := vertices[v]
+			if x > svgMargin && x+vertex.width > rowWidth-svgMargin {
+				x, y, lineHeight = svgMargin, y+lineHeight+svgNodeGap, 0
+			}
+			vertex.x, vertex.y = x+vertex.width/2, y
+			x += vertex.width + svgNodeGap
+			lineHeight = math.Max(lineHeight, vertex.height)
+			width = math.Max(width, x-svgNodeGap+svgMargin)
+		}
+		height = y + lineHeight + svgMargin
+	}
+
+	return d.renderSVG(vertices, edges, width, height), nil
+}
+
+// breakLayoutCycles 深さ優先探索で戻り辺を見つけ、向きを反転して閉路をなくす
+func breakLayoutCycles(n int, edges []*layoutEdge) {
+	out := make([][]*layoutEdge, n)
+	for _, e := range edges {
+		out[e.upper] = append(out[e.upper], e)
+	}
+	state := make([]int, n) // 0: 未訪問, 1: 探索中, 2: 完了
+	var visit func(v int)
+	visit = func(v int) {
+		state[v] = 1
+		for _, e := range out[v] {
+			if e.upper != v {
+				continue // 反転済み
+			}
+			switch state[e.lower] {
+			case 0:
+				visit(e.lower)
+			case 1:
+				e.upper, e.lower = e.lower, e.upper
+				e.fromLow = !e.fromLow
+			}
+		}
+		state[v] = 2
+	}
+	for v := 0; v < n; v++ {
+		if state[v] == 0 {
+			visit(v)
+		}
+	}
+}
+
+// assignLayers 最長経路法で層を割り当てる（上に辺のないノードが 0 層）
+func assignLayers(n int, edges []*layoutEdge, connected []bool) []int {
+	indegree := make([]int, n)
+	out := make([][]int, n)
+	for _, e := range edges {
+		out[e.upper] = append(out[e.upper], e.lower)
+		indegree[e.lower]++
+	}
+	layers := make([]int, n)
+	var queue []int
+	for v := 0; v < n; v++ {
+		if connected[v] && indegree[v] == 0 {
+			queue = append(queue, v)
+		}
+	}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		for _, w := range out[v] {
+			layers[w] = max(layers[w], layers[v]+1)
+			if indegree[w]--; indegree[w] == 0 {
+				queue = append(queue, w)
+			}
+		}
+	}
+	return layers
+}
+
+// orderLayers 隣接する層の重心で並べ替えを繰り返し、辺の交差が最も少ない並びを採用する
+func orderLayers(vertices []*layoutVertex, rows [][]int) {
+	setPositions := func() {
+		for _, row := range rows {
+			for i, v := range row {
+				vertices[v].pos = i
+			}
+		}
+	}
+	// 初期配置は深さ優先の訪問順（つながったノードが近くに並ぶ）
+	seen := make(map[int]bool)
+	ordered := make([][]int, len(rows))
+	var visit func(v int)
+	visit = func(v int) {
+		if seen[v] {
+			return
+		}
+		seen[v] = true
+		ordered[vertices[v].layer] = append(ordered[vertices[v].layer], v)
+		for _, w := range vertices[v].down {
+			visit(w)
+		}
+	}
+	for _, row := range rows {
+		for _, v := range row {
+			visit(v)
+		}
+	}
+	copy(rows, ordered)
+	setPositions()
+
+	best := cloneRows(rows)
+	bestCrossings := countCrossings(vertices, rows)
+	barycenter := func(neighbors []int, fallback int) float64 {
+		if len(neighbors) == 0 {
+			return float64(fallback)
+		}
+		sum := 0.0
+		for _, w := range neighbors {
+			sum += float64(vertices[w].pos)
+		}
+		return sum / float64(len(neighbors))
+	}
+	sortRow := func(row []int, downward bool) {
+		keys := make(map[int]float64, len(row))
+		for _, v := range row {
+			if downward {
+				keys[v] = barycenter(vertices[v].up, vertices[v].pos)
+			} else {
+				keys[v] = barycenter(vertices[v].down, vertices[v].pos)
+			}
+		}
+		sort.SliceStable(row, func(i, j int) bool { return keys[row[i]] < keys[row[j]] })
+		for i, v := range row {
+			vertices[v].pos = i
+		}
+	}
+
+	for sweep := 0; sweep < svgSweeps && bestCrossings > 0; sweep++ {
+		if sweep%2 == 0 {
+			for layer := 1; layer < len(rows); layer++ {
+				sortRow(rows[layer], true)
+			}
+		} else {
+			for layer := len(rows) - 2; layer >= 0; layer-- {
+				sortRow(rows[layer], false)
+			}
+		}
+		if crossings := countCrossings(vertices, rows); crossings < bestCrossings {
+			best, bestCrossings = cloneRows(rows), crossings
+		}
+	}
+	copy(rows, best)
+	setPositions()
+}
+
+func cloneRows(rows [][]int) [][]int {
+	clone := make([][]int, len(rows))
+	for i, row := range rows {
+		clone[i] = append([]int(nil), row...)
+	}
+	return clone
+}
+
+// countCrossings 隣接する層の間の辺の交差数
+// 上端の位置で並べた辺の下端の位置の転倒数を Fenwick 木で数える
+func countCrossings(vertices []*layoutVertex, rows [][]int) int {
+	total := 0
+	for layer := 0; layer+1 < len(rows); layer++ {
+		var segments [][2]int
+		for _, v := range rows[layer] {
+			for _, w := range vertices[v].down {
+				segments = append(segments, [2]int{vertices[v].pos, vertices[w].pos})
+			}
+		}
+		sort.Slice(segments, func(i, j int) bool {
+			if segments[i][0] != segments[j][0] {
+				return segments[i][0] < segments[j][0]
+			}
+			return segments[i][1] < segments[j][1]
+		})
+		tree := make([]int, len(rows[layer+1])+1)
+		for i, segment := range segments {
+			// これまでに見た辺のうち下端が segment より右にあるものと交差する
+			below := 0
+			for k := segment[1] + 1; k > 0; k -= k & -k {
+				below += tree[k]
+			}
+			total += i - below
+			for k := segment[1] + 1; k < len(tree); k += k & -k {
+				tree[k]++
+			}
+		}
+	}
+	return total
+}
+
+// placeLayers 層ごとの y 座標と、隣接する頂点の中央に寄せた x 座標を決める。図全体の幅と高さを返す
+func placeLayers(vertices []*layoutVertex, rows [][]int) (float64, float64) {
+	gap := func(a, b int) float64 {
+		g := svgNodeGap
+		if vertices[a].node < 0 || vertices[b].node < 0 {
+			g = svgDummyGap
+		}
+		return (vertices[a].width+vertices[b].width)/2 + g
+	}
+
+	// 左詰めで並べてから、上下の隣接する頂点の平均位置に寄せることを繰り返す
+	for _, row := range rows {
+		x := 0.0
+		for i, v := range row {
+			if i > 0 {
+				x += gap(row[i-1], v)
+			}
+			vertices[v].x = x
+		}
+	}
+	for pass := 0; pass < 8; pass++ {
+		for _, row := range rows {
+			desired := make([]float64, len(row))
+			for i, v := range row {
+				neighbors := append(append([]int(nil), vertices[v].up...), vertices[v].down...)
+				if len(neighbors) == 0 {
+					desired[i] = vertices[v].x
+					continue
+				}
+				sum := 0.0
+				for _, w := range neighbors {
+					sum += vertices[w].x
+				}
+				desired[i] = sum / float64(len(neighbors))
+			}
+			// 左から詰めた位置と右から詰めた位置の中間を取り、順番と間隔を保つ
+			left := make([]float64, len(row))
+			right := make([]float64, len(row))
+			for i := range row {
+				left[i] = desired[i]
+				if i > 0 {
+					left[i] = math.Max(left[i], left[i-1]+gap(row[i-1], row[i]))
+				}
+			}
+			for i := len(row) - 1; i >= 0; i-- {
+				right[i] = desired[i]
+				if i < len(row)-1 {
+					right[i] = math.Min(right[i], right[i+1]-gap(row[i], row[i+1]))
+				}
+			}
+			for i, v := range row {
+				x := (left[i] + right[i]) / 2
+				if i > 0 {
+					x = math.Max(x, vertices[row[i-1]].x+gap(row[i-1], v))
+				}
+				vertices[v].x = x
+			}
+		}
+	}
+
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	for _, row := range rows {
+		for _, v := range row {
+			minX = math.Min(minX, vertices[v].x-vertices[v].width/2)
+			maxX = math.Max(maxX, vertices[v].x+vertices[v].width/2)
+		}
+	}
+	if math.IsInf(minX, 1) {
+		return 2 * svgMargin, 0
+	}
+	y := svgMargin
+	for _, row := range rows {
+		layerHeight := 0.0
+		for _, v := range row {
+			layerHeight = math.Max(layerHeight, vertices[v].height)
+		}
+		for _, v := range row {
+			vertices[v].x += svgMargin - minX
+			if vertices[v].node < 0 {
+				// 中継点は層の上端から下端までを縦に通る
+				vertices[v].y, vertices[v].height = y, layerHeight
+				continue
+			}
+			vertices[v].y = y + (layerHeight-vertices[v].height)/2
+		}
+		y += layerHeight + svgLayerGap
+	}
+	return maxX - minX + 2*svgMargin, y - svgLayerGap + svgMargin
+}
+
+// svgTextWidth 等幅フォントで描いた場合の文字列の幅（全角文字は2文字分）
+func svgTextWidth(s string) float64 {
+	width := 0.0
+	for _, r := range s {
+		if utf8.RuneLen(r) >= 3 {
+			width += 2 * svgCharWidth
+		} else {
+			width += svgCharWidth
+		}
+	}
+	return width
+}
+
+// svgNodeSize ノードの大きさ（クラス図・ER 図ではメンバー・列の行を含む）
+func (d *Diagram) svgNodeSize(node DiagramNode) (float64, float64) {
+	if d.Type == "dependencies" {
+		return svgTextWidth(node.Label) + 24, 32
+	}
+	width := svgTextWidth(node.Label) + 24
+	height := 28.0
+	if node.stereotype() != "" {
+		width = math.Max(width, svgTextWidth("«"+node.stereotype()+"»")+24)
+		height += svgLineHeight
+	}
+	if members := node.memberLines(); len(members) > 0 {
+		height += 8 + svgLineHeight*float64(len(members))
+		for _, member := range members {
+			width = math.Max(width, svgTextWidth(member)+20)
+		}
+	}
+	return math.Max(width, 80), height
+}
+
+// renderSVG 配置済みの頂点と辺を SVG に書き出す
+func (d *Diagram) renderSVG(vertices []*layoutVertex, edges []*layoutEdge, width, height float64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f">`+"\n", width, height, width, height)
+	b.WriteString(`<style>
+text{font-family:Menlo,Consolas,"DejaVu Sans Mono",monospace;font-size:12px;fill:#24292f}
+.node rect{fill:#ffffff;stroke:#57606a;stroke-width:1}
+.node.external rect{fill:#f6f8fa;stroke:#8c959f;stroke-dasharray:4 3}
+.node.external text{fill:#57606a}
+.node .title{font-weight:bold}
+.node .stereotype{font-style:italic;font-size:11px}
+.node line{stroke:#57606a}
+.edge{fill:none;stroke:#57606a;stroke-width:1.2}
+.edge.implements,.edge.inferred{stroke-dasharray:6 4}
+.edge.cycle{stroke:#cf222e;stroke-width:2}
+</style>
+<defs>
+<marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto-start-reverse"><path d="M0,0 L10,5 L0,10 z" fill="#57606a"/></marker>
+<marker id="arrow-cycle" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto-start-reverse"><path d="M0,0 L10,5 L0,10 z" fill="#cf222e"/></marker>
+<marker id="inherit" viewBox="0 0 12 12" refX="12" refY="6" markerWidth="12" markerHeight="12" orient="auto-start-reverse"><path d="M0,0 L12,6 L0,12 z" fill="#ffffff" stroke="#57606a"/></marker>
+<marker id="diamond" viewBox="0 0 16 10" refX="0" refY="5" markerWidth="14" markerHeight="10" orient="auto"><path d="M0,5 L8,0 L16,5 L8,10 z" fill="#57606a"/></marker>
+</defs>
+`)
+
+	for _, e := range edges {
+		edge := d.Edges[e.edge]
+		points := make([][2]float64, 0, len(e.vertices))
+		for i, v := range e.vertices {
+			vertex := vertices[v]
+			switch {
+			case i == 0:
+				points = append(points, [2]float64{vertex.x, vertex.y + vertex.height})
+			case i == len(e.vertices)-1:
+				points = append(points, [2]float64{vertex.x, vertex.y})
+			default:
+				points = append(points, [2]float64{vertex.x, vertex.y}, [2]float64{vertex.x, vertex.y + vertex.height})
+			}
+		}
+		if e.fromLow {
+			for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+				points[i], points[j] = points[j], points[i]
+			}
+		}
+
+		var path strings.Builder
+		for i, p := range points {
+			command := "L"
+			if i == 0 {
+				command = "M"
+			}
+			fmt.Fprintf(&path, "%s%.1f,%.1f ", command, p[0], p[1])
+		}
+		class := "edge " + edge.Kind
+		markers := ` marker-end="url(#arrow)"`
+		switch edge.Kind {
+		case "extends", "implements":
+			markers = ` marker-end="url(#inherit)"`
+		case "embeds":
+			markers = ` marker-start="url(#diamond)"`
+		}
+		if edge.Cycle {
+			class += " cycle"
+			if edge.Kind == "depends" {
+				markers = ` marker-end="url(#arrow-cycle)"`
+			}
+		}
+		title := edge.From + " → " + edge.To
+		if edge.Label != "" {
+			title += " (" + edge.Label + ")"
+		}
+		fmt.Fprintf(&b, `<path class="%s" d="%s"%s><title>%s</title></path>`+"\n",
+			class, strings.TrimSpace(path.String()), markers, html.EscapeString(title))
+	}
+
+	for _, vertex := range vertices {
+		if vertex.node < 0 {
+			continue
+		}
+		node := d.Nodes[vertex.node]
+		class := "node"
+		if node.External {
+			class += " external"
+		}
+		left := vertex.x - vertex.width/2
+		fmt.Fprintf(&b, `<g class="%s">`, class)
+		tooltip := node.ID
+		if node.File != "" {
+			tooltip += " (" + node.File + ")"
+		}
+		fmt.Fprintf(&b, `<title>%s</title>`, html.EscapeString(tooltip))
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" rx="3"/>`, left, vertex.y, vertex.width, vertex.height)
+
+		if d.Type == "dependencies" {
+			fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text></g>`+"\n", vertex.x, vertex.y+20, html.EscapeString(node.Label))
+			continue
+		}
+		y := vertex.y + 18
+		if st := node.stereotype(); st != "" {
+			fmt.Fprintf(&b, `<text class="stereotype" x="%.1f" y="%.1f" text-anchor="middle">«%s»</text>`, vertex.x, y, html.EscapeString(st))
+			y += svgLineHeight
+		}
+		fmt.Fprintf(&b, `<text class="title" x="%.1f" y="%.1f" text-anchor="middle">%s</text>`, vertex.x, y, html.EscapeString(node.Label))
+		if members := node.memberLines(); len(members) > 0 {
+			y += 10
+			fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f"/>`, left, y, left+vertex.width, y)
+			for _, member := range members {
+				y += svgLineHeight
+				fmt.Fprintf(&b, `<text x="%.1f" y="%.1f">%s</text>`, left+8, y, html.EscapeString(member))
+			}
+		}
+		b.WriteString("</g>\n")
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
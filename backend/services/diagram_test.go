@@ -0,0 +1,230 @@
+package services
+
+import (
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"reverse-engineering-backend/models"
+)
+
+// diagramEdges 辺を "from -> to (kind)" の形で並べる（循環は末尾に * を付ける）
+func diagramEdges(d *Diagram) []string {
+	var edges []string
+	for _, e := range d.Edges {
+		s := e.From + " -> " + e.To + " (" + e.Kind + ")"
+		if e.Cycle {
+			s += "*"
+		}
+		edges = append(edges, s)
+	}
+	return edges
+}
+
+func TestDependencyDiagram(t *testing.T) {
+	tests := []struct {
+		name   string
+		result string
+		want   []string
+	}{
+		{
+			"map in code block",
+			"Here is the map:\n```json\n{\"dependency_map\": {\"main.go\": [\"util.go\", \"fmt\"], \"util.go\": \"main.go\"}}\n```",
+			[]string{"main.go -> util.go (depends)*", "main.go -> fmt (depends)", "util.go -> main.go (depends)*"},
+		},
+		{
+			"object per file",
+			`{"dependencies": {"app.py": {"internal": ["models.py"], "external": ["requests"]}}}`,
+			[]string{"app.py -> models.py (depends)", "app.py -> requests (depends)"},
+		},
+		{
+			"from/to list",
+			`{"dependency_graph": [{"from": "a.js", "to": "b.js"}, {"source": "b.js", "imports": [{"module": "lodash"}]}, "skip"]}`,
+			[]string{"a.js -> b.js (depends)", "b.js -> lodash (depends)"},
+		},
+		{
+			// AI の回答が JSON でなかったときは analysis の中の JSON と .pyc の import を使う
+			"analysis text and bytecode",
+			`{"analysis": "deps: {\"dependency_map\": {\"models.py\": []}}", "bytecode": {"__pycache__/app.cpython-311.pyc": {"imports": [{"module": "models"}, {"module": "json"}]}}}`,
+			[]string{"__pycache__/app.cpython-311.pyc -> models.py (depends)", "__pycache__/app.cpython-311.pyc -> json (depends)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := DependencyDiagram(tt.result, []string{"main.go", "src/util.go", "models.py", "a.js", "b.js"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := diagramEdges(d); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("edges = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	d, err := DependencyDiagram(tests[0].result, []string{"main.go", "src/util.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nodes []string
+	for _, n := range d.Nodes {
+		nodes = append(nodes, n.ID+":"+n.Kind+":"+map[bool]string{true: "external", false: "project"}[n.External])
+	}
+	if want := []string{"main.go:file:project", "util.go:file:project", "fmt:module:external"}; !reflect.DeepEqual(nodes, want) {
+		t.Errorf("nodes = %v, want %v", nodes, want)
+	}
+
+	for _, result := range []string{"not json", `{"summary": "no map"}`, `{"dependency_map": []}`} {
+		if _, err := DependencyDiagram(result, nil); err == nil {
+			t.Errorf("DependencyDiagram(%q) error = nil", result)
+		}
+	}
+}
+
+func TestClassDiagram(t *testing.T) {
+	files := []models.File{
+		{Name: "shape.go", Language: "go", Content: `package shape
+
+import "sync"
+
+type Shape interface {
+	Area() float64
+}
+
+type Named interface {
+	Shape
+	Name() string
+}
+
+type base struct {
+	sync.Mutex
+	id int
+}
+
+type Square struct {
+	base
+	Side float64
+}
+
+func (s *Square) Area() float64 { return s.Side * s.Side }
+`},
+		{Name: "animals.py", Language: "python", Content: `class Animal:
+    def speak(self):
+        pass
+
+class Dog(Animal, Exception):
+    def speak(self):
+        return "woof"
+`},
+	}
+	d := ClassDiagram(files)
+	want := []string{
+		"shape.Named -> shape.Shape (extends)",
+		"shape.Square -> shape.base (embeds)",
+		"shape.base -> sync.Mutex (embeds)",
+		"shape.Square -> shape.Shape (implements)",
+		"Dog -> Animal (extends)",
+		"Dog -> Exception (extends)",
+	}
+	if got := diagramEdges(d); !reflect.DeepEqual(got, want) {
+		t.Errorf("edges = %q, want %q", got, want)
+	}
+	members := make(map[string][]string)
+	for _, n := range d.Nodes {
+		members[n.Label] = n.Members
+	}
+	if got := members["Square"]; !reflect.DeepEqual(got, []string{"Side float64", "Area() float64"}) {
+		t.Errorf("Square members = %q", got)
+	}
+	if got := members["Dog"]; !reflect.DeepEqual(got, []string{"speak()"}) {
+		t.Errorf("Dog members = %q", got)
+	}
+}
+
+func TestDiagramFormats(t *testing.T) {
+	classes := &Diagram{
+		Type: "classes",
+		Nodes: []DiagramNode{
+			{ID: "Repo", Label: "Repo<T>", Kind: "interface", Members: []string{"Get(id) T"}},
+			{ID: "SQLRepo", Label: "SQLRepo", Kind: "class"},
+			{ID: "Base", Label: "Base", Kind: "class", External: true},
+		},
+		Edges: []DiagramEdge{{From: "SQLRepo", To: "Repo", Kind: "implements"}, {From: "SQLRepo", To: "Base", Kind: "extends"}},
+	}
+	wantMermaid := "classDiagram\n" +
+		"  class n0[\"Repo~T~\"]\n" +
+		"  n0 : Get(id) T\n" +
+		"  <<interface>> n0\n" +
+		"  class n1[\"SQLRepo\"]\n" +
+		"  class n2[\"Base\"]\n" +
+		"  <<external>> n2\n" +
+		"  n0 <|.. n1\n" +
+		"  n2 <|-- n1\n"
+	if got := classes.Mermaid(); got != wantMermaid {
+		t.Errorf("Mermaid() = %q, want %q", got, wantMermaid)
+	}
+	for _, want := range []string{"interface \"Repo<T>\" as n0 {\n  Get(id) T\n}\n", "class \"Base\" as n2 <<external>>\n", "n0 <|.. n1\n", "n2 <|-- n1\n"} {
+		if got := classes.PlantUML(); !strings.Contains(got, want) {
+			t.Errorf("PlantUML() does not contain %q:\n%s", want, got)
+		}
+	}
+	if got := classes.DOT(); !strings.Contains(got, `label="{\<\<interface\>\>\nRepo\<T\>|Get(id) T\l}"`) {
+		t.Errorf("DOT() = %s", got)
+	}
+
+	er := &Diagram{
+		Type: "er",
+		Nodes: []DiagramNode{
+			{ID: "users", Label: "users", Kind: "table", Attributes: []DiagramAttribute{{Name: "id", Type: "bigint", Keys: []string{"PK"}}}},
+			{ID: "posts", Label: "posts", Kind: "table", Attributes: []DiagramAttribute{{Name: "user id", Type: "varchar(20)", Keys: []string{"FK"}}}},
+		},
+		Edges: []DiagramEdge{{From: "posts", To: "users", Kind: "references", Label: "user_id", Cardinality: "many_to_one"}},
+	}
+	wantER := "erDiagram\n" +
+		"  n0[\"users\"] {\n    bigint id PK\n  }\n" +
+		"  n1[\"posts\"] {\n    varchar(20) user_id FK\n  }\n" +
+		"  n0 ||--o{ n1 : \"user_id\"\n"
+	if got := er.Mermaid(); got != wantER {
+		t.Errorf("Mermaid() = %q, want %q", got, wantER)
+	}
+}
+
+func TestDiagramSVG(t *testing.T) {
+	d, err := DependencyDiagram(`{"dependency_map": {"a.go": ["b.go", "c.go"], "b.go": ["c.go"], "c.go": ["a.go"], "lone.go": []}}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Nodes[0].Label = `<a & "b">`
+	svg, err := d.SVG()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 整形式の XML で、ノードごとに g、辺ごとに path がある
+	dec := xml.NewDecoder(strings.NewReader(svg))
+	counts := make(map[string]int)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("SVG is not well-formed: %v\n%s", err, svg)
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			counts[start.Name.Local]++
+		}
+	}
+	if counts["svg"] != 1 || counts["g"] != len(d.Nodes) || counts["path"] != len(d.Edges)+4 {
+		t.Errorf("elements = %v for %d nodes and %d edges", counts, len(d.Nodes), len(d.Edges))
+	}
+	if !strings.Contains(svg, "&lt;a &amp; &#34;b&#34;&gt;") || !strings.Contains(svg, `class="edge depends cycle"`) {
+		t.Errorf("SVG = %s", svg)
+	}
+
+	too := &Diagram{Type: "dependencies", Nodes: make([]DiagramNode, maxSVGNodes+1)}
+	if _, err := too.SVG(); err == nil {
+		t.Error("SVG() of a too large diagram error = nil")
+	}
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// localEmbeddingModel 埋め込み API を設定していない場合に使う、語の特徴ハッシュによる埋め込み
+const (
+	localEmbeddingModel      = "local-hash-384"
+	localEmbeddingDimensions = 384
+	embeddingBatchSize       = 64 // 1回の API 呼び出しで送るコード片の数
+)
+
+// EmbeddingService コード片と検索語の埋め込みベクトルを計算する
+// OpenAI の埋め込み API か、OpenAI 互換のローカルの埋め込みサーバー（Ollama・LocalAI・text-embeddings-inference など）を使う
+type EmbeddingService struct {
+	client        *openai.Client
+	model         string
+	dimensions    int  // 0 ならモデルの既定の次元数
+	redactSecrets bool // true なら外部の API に送る前に秘密情報を伏せ字にする（AI_REDACT_SECRETS）
+}
+
+// NewEmbeddingService 環境変数から埋め込みの計算先を決める
+// EMBEDDING_API_URL を設定するとその OpenAI 互換サーバーを、無ければ OPENAI_API_KEY で OpenAI を使う
+// どちらも無ければ API を使わない簡易な埋め込みにする（語の一致に近い精度）
+func NewEmbeddingService() *EmbeddingService {
+	baseURL := os.Getenv("EMBEDDING_API_URL")
+	apiKey := os.Getenv("EMBEDDING_API_KEY")
+	if apiKey == "" {
+		apiKey = os.Getenv("OPENAI_API_KEY")
+	}
+	if baseURL == "" && apiKey == "" {
+		return &EmbeddingService{model: localEmbeddingModel, dimensions: localEmbeddingDimensions}
+	}
+
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = strings.TrimRight(baseURL, "/")
+	}
+	model := os.Getenv("EMBEDDING_MODEL")
+	if model == "" {
+		model = string(openai.SmallEmbedding3)
+	}
+	dimensions := 0
+	fmt.Sscanf(os.Getenv("EMBEDDING_DIMENSIONS"), "%d", &dimensions)
+
+	redact, _ := strconv.ParseBool(os.Getenv("AI_REDACT_SECRETS"))
+
+	return &EmbeddingService{
+		client:        openai.NewClientWithConfig(config),
+		model:         model,
+		dimensions:    dimensions,
+		redactSecrets: redact,
+	}
+}
+
+// Model 保存した埋め込みと検索語の埋め込みを比べてよいかの判定に使うモデル名
+func (es *EmbeddingService) Model() string {
+	if es.dimensions > 0 && es.client != nil {
+		return fmt.Sprintf("%s@%d", es.model, es.dimensions)
+	}
+	return es.model
+}
+
+// Embed テキストごとの埋め込みを長さ1に正規化して返す
+func (es *EmbeddingService) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	if es.client == nil {
+		for _, text := range texts {
+			vectors = append(vectors, localEmbedding(text))
+		}
+		return vectors, nil
+	}
+
+	if es.redactSecrets {
+		redacted := make([]string, len(texts))
+		for i, text := range texts {
+			redacted[i], _ = RedactSecrets(text)
+		}
+		texts = redacted
+	}
+	for start := 0; start < len(texts); start += embeddingBatchSize {
+		batch := texts[start:min(start+embeddingBatchSize, len(texts))]
+		resp, err := es.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+			Input:      batch,
+			Model:      openai.EmbeddingModel(es.model),
+			Dimensions: es.dimensions,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute embeddings: %w", err)
+		}
+		if len(resp.Data) != len(batch) {
+			return nil, fmt.Errorf("embedding API returned %d vectors for %d inputs", len(resp.Data), len(batch))
+		}
+		result := make([][]float32, len(batch))
+		for _, data := range resp.Data {
+			if data.Index < 0 || data.Index >= len(batch) {
+				return nil, fmt.Errorf("embedding API returned an out-of-range index %d", data.Index)
+			}
+			result[data.Index] = normalizeVector(data.Embedding)
+		}
+		vectors = append(vectors, result...)
+	}
+	return vectors, nil
+}
+
+// localEmbedding 識別子を語に分けて語幹にそろえ、語と語の3文字片を符号付きの特徴ハッシュで固定長のベクトルにする
+func localEmbedding(text string) []float32 {
+	counts := make(map[string]float64)
+	for _, word := range embeddingWords(text) {
+		counts[word]++
+		if len(word) > 4 {
+			padded := "^" + word + "$"
+			for i := 0; i+3 <= len(padded); i++ {
+				counts["#"+padded[i:i+3]] += 0.25
+			}
+		}
+	}
+
+	vector := make([]float32, localEmbeddingDimensions)
+	for feature, count := range counts {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		weight := float32(1 + math.Log(count))
+		if strings.HasPrefix(feature, "#") {
+			weight = float32(count)
+		}
+		if sum>>63 == 1 {
+			weight = -weight
+		}
+		vector[sum%localEmbeddingDimensions] += weight
+	}
+	return normalizeVector(vector)
+}
+
+// embeddingWords 英数字の並びを camelCase・snake_case の境目で語に分け、小文字にして簡単な語尾を落とす
+func embeddingWords(text string) []string {
+	var words []string
+	flush := func(word []rune) {
+		if len(word) < 2 {
+			return
+		}
+		w := strings.ToLower(string(word))
+		if cloneKeywords[w] {
+			return
+		}
+		words = append(words, stemWord(w))
+	}
+	var current []rune
+	runes := []rune(text)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush(current)
+			current = current[:0]
+			continue
+		}
+		if len(current) > 0 {
+			prev := runes[i-1]
+			upperStart := unicode.IsUpper(r) && unicode.IsLower(prev)
+			acronymEnd := unicode.IsUpper(prev) && unicode.IsUpper(r) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			digitEdge := unicode.IsDigit(r) != unicode.IsDigit(prev)
+			if upperStart || acronymEnd || digitEdge {
+				flush(current)
+				current = current[:0]
+			}
+		}
+		current = append(current, r)
+	}
+	flush(current)
+	return words
+}
+
+// stemWord retries・retrying・retried などを retry にそろえる程度の語尾の除去
+func stemWord(w string) string {
+	switch {
+	case len(w) > 4 && strings.HasSuffix(w, "ies"):
+		return w[:len(w)-3] + "y"
+	case len(w) > 4 && strings.HasSuffix(w, "ied"):
+		return w[:len(w)-3] + "y"
+	case len(w) > 5 && strings.HasSuffix(w, "ing"):
+		return w[:len(w)-3]
+	case len(w) > 4 && strings.HasSuffix(w, "ed"):
+		return w[:len(w)-2]
+	case len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss"):
+		return w[:len(w)-1]
+	}
+	return w
+}
+
+// normalizeVector 長さ1にする（コサイン類似度を内積で求められるように）
+func normalizeVector(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(math.Sqrt(sum))
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = x / norm
+	}
+	return out
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// 展開したペイロードをさらにカーブする深さの上限
+const maxCarveDepth = 3
+
+// FirmwareItem firmware_carve の結果に載せるセクション
+type FirmwareItem struct {
+	Offset         int            `json:"offset"`
+	Size           int            `json:"size"`
+	Type           string         `json:"type"`
+	Description    string         `json:"description"`
+	FileID         *uint          `json:"file_id,omitempty"` // 展開したペイロードのファイル
+	Entries        int            `json:"entries,omitempty"`
+	CreatedFileIDs []uint         `json:"created_file_ids,omitempty"`
+	Symlinks       []string       `json:"symlinks,omitempty"`
+	Items          []FirmwareItem `json:"items,omitempty"` // ペイロード内で見つかったセクション
+	Error          string         `json:"error,omitempty"`
+}
+
+// FirmwareReport ファイルごとのカーブ結果
+type FirmwareReport struct {
+	FileID uint           `json:"file_id"`
+	Name   string         `json:"name"`
+	Items  []FirmwareItem `json:"items"`
+}
+
+type firmwareCarver struct {
+	w     *AnalysisWorker
+	files int
+	bytes int64
+}
+
+// runFirmwareCarve アップロードされたバイナリから圧縮データやファイルシステムを取り出し、派生ファイルとして登録する
+func (w *AnalysisWorker) runFirmwareCarve(files []models.File) (string, error) {
+	carver := &firmwareCarver{w: w}
+	reports := []FirmwareReport{}
+	for i := range files {
+		file := &files[i]
+		if file.Origin != "" || file.Content != "" {
+			continue
+		}
+		data, err := os.ReadFile(file.Path)
+		if err != nil {
+			continue
+		}
+		w.removeDerivedFiles(file.ID, "firmware_carve")
+		items := carver.carve(file, data, 0)
+		if len(items) == 0 {
+			continue
+		}
+		reports = append(reports, FirmwareReport{FileID: file.ID, Name: file.Name, Items: items})
+	}
+
+	if len(reports) == 0 {
+		return "", fmt.Errorf("no known firmware signatures found in project")
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"files": reports,
+		"summary": map[string]interface{}{
+			"created_files": carver.files,
+			"created_bytes": carver.bytes,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (fc *firmwareCarver) carve(parent *models.File, data []byte, depth int) []FirmwareItem {
+	var items []FirmwareItem
+	for _, section := range CarveFirmware(data) {
+		item := FirmwareItem{Offset: section.Offset, Size: section.Size, Type: section.Type, Description: section.Description}
+		if section.Err != nil {
+			item.Error = section.Err.Error()
+		}
+		prefix := fmt.Sprintf("0x%X_%s", section.Offset, section.Type)
+
+		if section.Payload != nil {
+			name := prefix
+			if base := sanitizeCarvedPath(section.PayloadName); base != "" {
+				name += "/" + path.Base(base)
+			}
+			if child, err := fc.save(parent, name, section.Offset, section.Payload); err != nil {
+				item.Error = err.Error()
+			} else {
+				item.FileID = &child.ID
+				if depth+1 < maxCarveDepth {
+					item.Items = fc.carve(child, section.Payload, depth+1)
+				}
+			}
+		}
+
+		item.Entries = len(section.Entries)
+		for _, entry := range section.Entries {
+			switch entry.Type {
+			case "file":
+				rel := sanitizeCarvedPath(entry.Path)
+				if rel == "" {
+					continue
+				}
+				child, err := fc.save(parent, prefix+"/"+rel, section.Offset, entry.Data)
+				if err != nil {
+					item.Error = err.Error()
+					break
+				}
+				item.CreatedFileIDs = append(item.CreatedFileIDs, child.ID)
+			case "symlink":
+				// シンボリックリンクは実体を作らず一覧にだけ載せる（展開先の外を指す可能性があるため）
+				item.Symlinks = append(item.Symlinks, entry.Path+" -> "+entry.Target)
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// save 取り出したデータを派生ファイルとして登録し、派生元での位置を記録する
+func (fc *firmwareCarver) save(parent *models.File, name string, offset int, data []byte) (*models.File, error) {
+	if fc.files >= maxFirmwareEntries || fc.bytes+int64(len(data)) > maxFirmwareBytes {
+		return nil, fmt.Errorf("extraction limit reached (%d files, %d bytes)", maxFirmwareEntries, maxFirmwareBytes)
+	}
+	child, err := fc.w.createDerivedFile(parent, "firmware_carve", name, data)
+	if err != nil {
+		return nil, err
+	}
+	off := int64(offset)
+	child.Offset = &off
+	fc.w.db.Model(child).Update("offset", off)
+	fc.files++
+	fc.bytes += int64(len(data))
+	return child, nil
+}
+
+// sanitizeCarvedPath イメージ内のパスを展開先ディレクトリの外に出ない相対パスにする
+func sanitizeCarvedPath(p string) string {
+	p = strings.ReplaceAll(p, "\\", "/")
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
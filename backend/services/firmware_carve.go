@@ -0,0 +1,237 @@
+package services
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ファームウェアから取り出すエントリ数・データ量の上限
+const (
+	maxFirmwareEntries = 10000
+	maxFirmwareBytes   = 512 << 20
+)
+
+// FirmwareSection イメージ内で見つかった（検証済みの）シグネチャ
+// 圧縮ストリームと uImage は Payload に展開結果を、ファイルシステムは Entries に中身を持つ
+type FirmwareSection struct {
+	Offset      int
+	Size        int
+	Type        string // uimage, gzip, xz, lzma, squashfs, cpio, cramfs
+	Description string
+	Payload     []byte
+	PayloadName string
+	Entries     []FirmwareEntry
+	Err         error
+}
+
+type firmwareSignature struct {
+	typ   string
+	magic []byte
+}
+
+var firmwareSignatures = []firmwareSignature{
+	{"uimage", []byte{0x27, 0x05, 0x19, 0x56}},
+	{"gzip", []byte{0x1F, 0x8B, 0x08}},
+	{"xz", xzMagic},
+	{"lzma", []byte{0x5D, 0x00, 0x00}},
+	{"squashfs", []byte("hsqs")},
+	{"squashfs-be", []byte("sqsh")},
+	{"cpio", []byte("07070")},
+	{"cramfs", []byte{0x45, 0x3D, 0xCD, 0x28}},
+	{"cramfs", []byte{0x28, 0xCD, 0x3D, 0x45}},
+}
+
+var uImageTypes = map[byte]string{1: "standalone", 2: "kernel", 3: "ramdisk", 4: "multi", 5: "firmware", 6: "script", 7: "filesystem", 8: "flat_dt"}
+var uImageCompressions = map[byte]string{0: "none", 1: "gzip", 2: "bzip2", 3: "lzma", 4: "lzo", 5: "lz4", 6: "zstd"}
+
+// CarveFirmware binwalk と同様にシグネチャを探し、検証できたものを展開する
+// 取り出した範囲の内側にあるシグネチャは（圧縮データ中の偶然の一致として）無視する
+func CarveFirmware(data []byte) []FirmwareSection {
+	type candidate struct {
+		offset int
+		typ    string
+	}
+	var candidates []candidate
+	for _, sig := range firmwareSignatures {
+		for pos := 0; ; {
+			i := bytes.Index(data[pos:], sig.magic)
+			if i < 0 {
+				break
+			}
+			candidates = append(candidates, candidate{pos + i, sig.typ})
+			pos += i + 1
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].offset < candidates[j].offset })
+
+	var sections []FirmwareSection
+	covered := 0
+	for _, c := range candidates {
+		if c.offset < covered {
+			continue
+		}
+		section, ok := carveSection(data[c.offset:], c.typ)
+		if !ok {
+			continue
+		}
+		section.Offset = c.offset
+		sections = append(sections, section)
+		if section.Size > 0 {
+			covered = c.offset + section.Size
+		}
+	}
+	return sections
+}
+
+// carveSection シグネチャの位置から中身を検証する。誤検出と判断した場合は ok = false
+func carveSection(data []byte, typ string) (FirmwareSection, bool) {
+	section := FirmwareSection{Type: typ}
+	switch typ {
+	case "uimage":
+		return carveUImage(data)
+	case "gzip":
+		// FLG の予約ビットが立っているものは誤検出
+		if len(data) < 10 || data[3]&0xE0 != 0 {
+			return section, false
+		}
+		br := bytes.NewReader(data)
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return section, false
+		}
+		zr.Multistream(false)
+		out, err := io.ReadAll(io.LimitReader(zr, maxDecompressedSize))
+		if err != nil || len(out) == 0 {
+			return section, false
+		}
+		section.Size = len(data) - br.Len()
+		section.Payload, section.PayloadName = out, zr.Name
+		section.Description = "gzip compressed data"
+		if zr.Name != "" {
+			section.Description += fmt.Sprintf(", original name %q", zr.Name)
+		}
+	case "xz":
+		out, n, err := DecompressXZ(data)
+		if err != nil && len(out) == 0 {
+			return section, false
+		}
+		section.Size, section.Payload, section.Err = n, out, err
+		section.Description = "xz compressed data"
+	case "lzma":
+		if len(data) < 13 {
+			return section, false
+		}
+		dictSize := binary.LittleEndian.Uint32(data[1:5])
+		size := int64(binary.LittleEndian.Uint64(data[5:13]))
+		if dictSize < 1<<12 || dictSize > 1<<28 || size == 0 || size > maxDecompressedSize {
+			return section, false
+		}
+		out, n, err := DecompressLZMA(data)
+		// サイズ不明（-1）で終端マーカーがないストリームは途中までの結果を採用する
+		if err != nil && (size >= 0 || len(out) < 4096) {
+			return section, false
+		}
+		section.Size, section.Payload, section.Err = n, out, err
+		section.Description = fmt.Sprintf("LZMA compressed data, dictionary size %d", dictSize)
+	case "squashfs":
+		entries, n, err := ReadSquashfs(data)
+		if n == 0 {
+			return section, false
+		}
+		section.Size, section.Entries, section.Err = n, entries, err
+		section.Description = fmt.Sprintf("Squashfs filesystem, version 4.%d, %s compressed", binary.LittleEndian.Uint16(data[30:]), squashfsCompressors[binary.LittleEndian.Uint16(data[20:])])
+	case "squashfs-be":
+		if len(data) < 30 || binary.BigEndian.Uint16(data[28:]) > 4 {
+			return section, false
+		}
+		section.Type = "squashfs"
+		section.Description = fmt.Sprintf("Squashfs filesystem, big endian, version %d", binary.BigEndian.Uint16(data[28:]))
+		section.Err = errors.New("big-endian squashfs is not supported")
+	case "cpio":
+		entries, n, err := ReadCPIO(data)
+		if len(entries) == 0 {
+			return section, false
+		}
+		section.Size, section.Entries, section.Err = n, entries, err
+		section.Description = fmt.Sprintf("cpio archive, %d entries", len(entries))
+	case "cramfs":
+		entries, n, err := ReadCramfs(data)
+		if n == 0 {
+			return section, false
+		}
+		section.Size, section.Entries, section.Err = n, entries, err
+		section.Description = fmt.Sprintf("CramFS filesystem, %d bytes", n)
+	default:
+		return section, false
+	}
+	return section, true
+}
+
+// carveUImage U-Boot の legacy イメージ（64バイトのヘッダー）を検証し、ペイロードを展開する
+func carveUImage(data []byte) (FirmwareSection, bool) {
+	section := FirmwareSection{Type: "uimage"}
+	if len(data) < 64 {
+		return section, false
+	}
+	header := make([]byte, 64)
+	copy(header, data[:64])
+	headerCRC := binary.BigEndian.Uint32(header[4:])
+	binary.BigEndian.PutUint32(header[4:], 0)
+	if crc32.ChecksumIEEE(header) != headerCRC {
+		return section, false
+	}
+
+	size := int(binary.BigEndian.Uint32(data[12:]))
+	imageType, comp := data[30], data[31]
+	name := strings.TrimRight(string(data[32:64]), "\x00")
+	section.Size = 64 + size
+	section.Description = fmt.Sprintf("uImage header, name %q, type %s, compression %s, load 0x%08X, entry 0x%08X",
+		name, uImageTypes[imageType], uImageCompressions[comp], binary.BigEndian.Uint32(data[16:]), binary.BigEndian.Uint32(data[20:]))
+	if section.Size > len(data) {
+		section.Size = len(data)
+		section.Err = errors.New("image data truncated")
+	}
+	payload := data[64:section.Size]
+	if section.Err == nil && crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(data[24:]) {
+		section.Err = errors.New("data CRC mismatch")
+	}
+
+	section.PayloadName = name
+	switch uImageCompressions[comp] {
+	case "none":
+		section.Payload = payload
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err == nil {
+			section.Payload, err = io.ReadAll(io.LimitReader(zr, maxDecompressedSize))
+		}
+		if err != nil {
+			section.Err = err
+		}
+	case "bzip2":
+		out, err := io.ReadAll(io.LimitReader(bzip2.NewReader(bytes.NewReader(payload)), maxDecompressedSize))
+		section.Payload = out
+		if err != nil {
+			section.Err = err
+		}
+	case "lzma":
+		out, _, err := DecompressLZMA(payload)
+		section.Payload = out
+		if err != nil {
+			section.Err = err
+		}
+	default:
+		// 未対応の圧縮形式は圧縮されたまま取り出す
+		section.Payload = payload
+		section.Err = fmt.Errorf("compression %s is not supported", uImageCompressions[comp])
+	}
+	return section, true
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"hash/crc32"
+	"reflect"
+	"testing"
+)
+
+// testUImage 無圧縮ペイロードの uImage（ヘッダーとデータの CRC を計算する）
+func testUImage(name string, payload []byte) []byte {
+	header := make([]byte, 64)
+	binary.BigEndian.PutUint32(header[0:], 0x27051956)
+	binary.BigEndian.PutUint32(header[12:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(header[16:], 0x80008000)
+	binary.BigEndian.PutUint32(header[20:], 0x80008000)
+	binary.BigEndian.PutUint32(header[24:], crc32.ChecksumIEEE(payload))
+	header[28], header[29], header[30], header[31] = 5, 2, 2, 0 // linux, arm, kernel, none
+	copy(header[32:], name)
+	binary.BigEndian.PutUint32(header[4:], crc32.ChecksumIEEE(header))
+	return append(header, payload...)
+}
+
+func TestCarveFirmware(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Name = "vmlinux"
+	zw.Write([]byte("kernel image"))
+	zw.Close()
+
+	parts := [][]byte{
+		[]byte("\x00\x00bootloader\x1f\x8b\x08\xff"), // FLG の予約ビットが立った gzip の誤検出
+		testUImage("Linux", []byte("kernel")),
+		gz.Bytes(),
+		make([]byte, 5),
+		mustHex(t, testXZCRC64),
+		[]byte("pad"),
+		sampleCPIO(),
+		sampleSquashfs().build(),
+		[]byte{0xff, 0xff},
+		sampleCramfs(),
+		[]byte("070707 not a cpio header"),
+	}
+	blob := bytes.Join(parts, nil)
+	offset := func(i int) int {
+		n := 0
+		for _, p := range parts[:i] {
+			n += len(p)
+		}
+		return n
+	}
+
+	sections := CarveFirmware(blob)
+	type summary struct {
+		Offset, Size int
+		Type         string
+		Payload      string
+		Entries      int
+	}
+	var got []summary
+	for _, s := range sections {
+		if s.Err != nil {
+			t.Errorf("section %s at 0x%x: %v", s.Type, s.Offset, s.Err)
+		}
+		got = append(got, summary{s.Offset, s.Size, s.Type, string(s.Payload), len(s.Entries)})
+	}
+	want := []summary{
+		{offset(1), len(parts[1]), "uimage", "kernel", 0},
+		{offset(2), len(parts[2]), "gzip", "kernel image", 0},
+		{offset(4), len(parts[4]), "xz", string(testLZMAPlain), 0},
+		{offset(6), len(parts[6]), "cpio", "", 4},
+		{offset(7), len(parts[7]), "squashfs", "", 2},
+		{offset(9), len(parts[9]), "cramfs", "", 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sections = %+v, want %+v", got, want)
+	}
+}
+
+func TestSanitizeCarvedPath(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"bin/sh", "bin/sh"},
+		{"/etc/passwd", "etc/passwd"},
+		{"../../etc/shadow", "etc/shadow"},
+		{"a/../../b", "b"},
+		{"./a//b/", "a/b"},
+		{`..\..\win.ini`, "win.ini"},
+		{"..", ""},
+	}
+	for _, tt := range tests {
+		if got := sanitizeCarvedPath(tt.path); got != tt.want {
+			t.Errorf("sanitizeCarvedPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
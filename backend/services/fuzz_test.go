@@ -0,0 +1,156 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// 信頼できない入力を読む処理のファズテスト。go test ではシードだけを実行する
+// 本格的に探すときは go test -run '^$' -fuzz '^FuzzJSPipeline$' ./services のように1つずつ指定する
+
+// FuzzJSPipeline 壊れたバンドルでも分割・難読化解除・整形が panic しない
+func FuzzJSPipeline(f *testing.F) {
+	f.Add("!function(e){var t={};function n(r){return e[r].call(t,n)}n(0)}([function(e,t,n){var a=[\"\\x68\\x69\",'b\\\\'];" +
+		"console[a[0]](a[1]+(1+2)),`x${a}`;/re\\/g/.test(a)},function(e){e.exports=void 0}]);\n" +
+		"//# sourceMappingURL=data:application/json;base64,e30=\n")
+	f.Add("var a=\"\\x68\\x69\";if(!0){a[\"b\"]=!1}")
+	f.Fuzz(func(t *testing.T, src string) {
+		SplitJSBundle(src)
+		DeobfuscateJS(src)
+		BeautifyJS(src)
+	})
+}
+
+// FuzzTokenizeJS どんな入力でも panic せず、トークンが入力の範囲に収まる
+func FuzzTokenizeJS(f *testing.F) {
+	f.Add("var s = 'a\\'b', t = `x${y + \"\\\\\"}z`, r = /[\\]/]+\\//g; \\u0062ar(0b1010n, .5e-3) // end\n")
+	f.Add("var s = 'unterminated")
+	f.Fuzz(func(t *testing.T, src string) {
+		for _, token := range TokenizeJS(src) {
+			if token.Text == "" || !strings.Contains(src, token.Text) {
+				t.Fatalf("TokenizeJS(%q) produced token %q outside the input", src, token.Text)
+			}
+		}
+	})
+}
+
+// FuzzParsePyc 壊れた .pyc でも panic せず、読めたものは構造の復元と逆アセンブルができる
+func FuzzParsePyc(f *testing.F) {
+	f.Add(samplePyc38())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pyc, err := ParsePyc(data)
+		if err != nil {
+			return
+		}
+		RecoverPycStructure(pyc.Code, pyc.Header.Major, pyc.Header.Minor)
+		FormatDisassembly(pyc.Code, pyc.Header.Major, pyc.Header.Minor)
+	})
+}
+
+// FuzzParseFileDescriptor 壊れた FileDescriptorProto でも panic せず、実行ファイルの中の記述子の探索も止まる
+func FuzzParseFileDescriptor(f *testing.F) {
+	valid := sampleFileDescriptor("demo/a.proto")
+	f.Add(valid)
+	f.Add(protoConcat([]byte("\x7fELF junk"), valid, []byte("trailing")))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if file, err := ParseFileDescriptor(data); err == nil {
+			BuildProtoCatalog([]ProtoFile{file})
+		}
+		FindEmbeddedDescriptors(data)
+	})
+}
+
+// FuzzYaraRules どんなソースでも panic せず、解析できたルールはどんなデータにも評価できる
+func FuzzYaraRules(f *testing.F) {
+	f.Add(testYaraSource, []byte("MZ UPX! upx1.0"))
+	f.Add(`rule a { strings: $h = { 4D 5A ?3 ( 01 | 02 ) [1-2] 03 } $r = /[0-9]\.[0-9]+/ condition: #h > 0 and @r[1] < filesize and uint16be(0) == 0x4d5a }`, []byte("MZ\x93\x01\x00\x03 1.0"))
+	f.Fuzz(func(t *testing.T, source string, data []byte) {
+		if rules, err := ParseYaraRules(source); err == nil {
+			ScanYaraRules("fuzz", rules, data)
+		}
+	})
+}
+
+// FuzzReadSquashfs 壊れた squashfs イメージでも panic しない
+func FuzzReadSquashfs(f *testing.F) {
+	f.Add(sampleSquashfs().build())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ReadSquashfs(data)
+	})
+}
+
+// FuzzReadCPIO 壊れた cpio アーカイブでも panic しない
+func FuzzReadCPIO(f *testing.F) {
+	f.Add(sampleCPIO())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ReadCPIO(data)
+	})
+}
+
+// FuzzReadCramfs 壊れた cramfs イメージでも panic しない
+func FuzzReadCramfs(f *testing.F) {
+	f.Add(sampleCramfs())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ReadCramfs(data)
+	})
+}
+
+// FuzzCarveFirmware 壊れた・途中で切れたファームウェアでも切り出しが panic しない
+func FuzzCarveFirmware(f *testing.F) {
+	f.Add(bytes.Join([][]byte{
+		testUImage("Linux", []byte("kernel")),
+		mustHex(f, testXZCRC64),
+		sampleCPIO(),
+		sampleSquashfs().build(),
+		sampleCramfs(),
+	}, []byte("pad")))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		CarveFirmware(data)
+	})
+}
+
+// FuzzDecompressLZMA 壊れた圧縮データでも panic せずに止まる
+func FuzzDecompressLZMA(f *testing.F) {
+	for _, s := range []string{testLZMAAlone, testLZMA2Raw, testXZCRC64, testXZSHA256} {
+		f.Add(mustHex(f, s))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		DecompressLZMA(data)
+		DecompressLZMA2(data)
+		DecompressXZ(data)
+	})
+}
+
+// FuzzReadPacketCapture 壊れた pcapng・pcap でも panic しない
+func FuzzReadPacketCapture(f *testing.F) {
+	le := binary.LittleEndian
+	f.Add(bytes.Join([][]byte{
+		pcapngSHB(le),
+		pcapngIDB(le, linkTypeEthernet, 9),
+		pcapngEPB(le, 0, 1_600_000_000_123_456_789, []byte("packet")),
+		pcapngBlock(le, pcapngSimplePacket, append(le.AppendUint32(nil, 3), "abc"...)),
+	}, nil))
+	pcap := le.AppendUint32(nil, pcapMagicMicroseconds)
+	pcap = append(pcap, 2, 0, 4, 0)
+	pcap = append(pcap, make([]byte, 12)...)
+	pcap = le.AppendUint32(pcap, linkTypeEthernet)
+	pcap = append(pcap, 0, 0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 3, 0, 0, 0, 'o', 'n', 'e')
+	f.Add(pcap)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ReadPacketCapture(data)
+	})
+}
+
+// FuzzExtractHTTPExchanges 壊れたフレームをどのリンク層として読んでも panic しない
+func FuzzExtractHTTPExchanges(f *testing.F) {
+	client, server := [4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}
+	f.Add(testTCPFrame(client, server, 40000, 80, 1, tcpFlagACK, "GET / HTTP/1.1\r\nHost: a\r\n\r\n"),
+		testTCPFrame(server, client, 80, 40000, 1, tcpFlagACK|tcpFlagFIN, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+	f.Fuzz(func(t *testing.T, request, response []byte) {
+		for _, linkType := range []uint16{linkTypeEthernet, linkTypeRaw, linkTypeLinuxSLL, linkTypeLinuxSLL2} {
+			ExtractHTTPExchanges([]CapturedPacket{{LinkType: linkType, Data: request}, {LinkType: linkType, Data: response}}, "")
+		}
+	})
+}
@@ -0,0 +1,441 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"reverse-engineering-backend/models"
+
+	"github.com/sashabaranov/go-openai"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 調査の予算
+const (
+	investigationDefaultSteps = 12   // 既定のステップ数（AI の応答1回を1ステップと数える）
+	investigationMaxSteps     = 30   // 指定できるステップ数の上限
+	investigationMaxOutput    = 8000 // ツールの出力を AI に渡すときの文字数の上限
+	investigationReadLines    = 200  // read_file で一度に読める行数
+	investigationListLimit    = 500  // list_tree で返すファイル数の上限
+	investigationGrepLimit    = 50   // grep で返す行数の上限
+	investigationSymbolLimit  = 30   // search_identifiers で返すシンボル数の上限
+	investigationAnalysisPage = 4000 // read_analysis で一度に読める文字数
+)
+
+// investigationTools 調査で AI に使わせるツール（説明は lang の言語で書く）
+func investigationTools(lang string) []openai.Tool {
+	t := func(text string) string { return localize(lang, text) }
+	return []openai.Tool{
+		investigationTool("list_tree", t("プロジェクトのファイルをパス順に一覧する（言語・サイズ・行数付き）"), map[string]interface{}{
+			"prefix":   map[string]interface{}{"type": "string", "description": t("このパスで始まるファイルだけを一覧する")},
+			"language": map[string]interface{}{"type": "string", "description": t("この言語のファイルだけを一覧する")},
+		}),
+		investigationTool("read_file", t("ファイルの指定した行の範囲を行番号付きで読む（一度に最大200行）"), map[string]interface{}{
+			"file":       map[string]interface{}{"type": "string", "description": t("list_tree で得たファイルのパス")},
+			"start_line": map[string]interface{}{"type": "integer", "description": t("読み始める行（1始まり、省略時は1）")},
+			"end_line":   map[string]interface{}{"type": "integer", "description": t("読み終える行（省略時は開始行から200行）")},
+		}, "file"),
+		investigationTool("grep", t("ファイルの内容を行ごとに検索し、一致した行を ファイル:行: 内容 の形で返す"), map[string]interface{}{
+			"pattern":     map[string]interface{}{"type": "string", "description": t("探す文字列（regex が true なら RE2 の正規表現）")},
+			"regex":       map[string]interface{}{"type": "boolean"},
+			"ignore_case": map[string]interface{}{"type": "boolean"},
+			"path":        map[string]interface{}{"type": "string", "description": t("対象にするパスのグロブ（例: **/*.go）")},
+		}, "pattern"),
+		investigationTool("search_identifiers", t("関数・型・メソッド・定数などの定義を名前の部分一致で探す"), map[string]interface{}{
+			"name": map[string]interface{}{"type": "string", "description": t("識別子の名前（大文字小文字は区別しない）")},
+			"kind": map[string]interface{}{"type": "string", "description": t("function, method, class, struct, interface, constant など")},
+		}, "name"),
+		investigationTool("list_analyses", t("このプロジェクトで完了した過去の解析の一覧"), map[string]interface{}{}),
+		investigationTool("read_analysis", t("過去の解析の結果を読む（一度に4000文字）"), map[string]interface{}{
+			"analysis_id": map[string]interface{}{"type": "integer"},
+			"offset":      map[string]interface{}{"type": "integer", "description": t("読み始める位置（文字数、省略時は0）")},
+		}, "analysis_id"),
+	}
+}
+
+func investigationTool(name, description string, properties map[string]interface{}, required ...string) openai.Tool {
+	parameters := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		parameters["required"] = required
+	}
+	return openai.Tool{
+		Type:     openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{Name: name, Description: description, Parameters: parameters},
+	}
+}
+
+// InvestigationToolCall 監査用に記録するツールの呼び出し
+type InvestigationToolCall struct {
+	ID        string          `json:"id"`
+	Tool      string          `json:"tool"`
+	Arguments json.RawMessage `json:"arguments"`
+	Output    string          `json:"output"`
+	Error     string          `json:"error,omitempty"`
+	Truncated bool            `json:"truncated,omitempty"` // AI に渡す出力を切り詰めたか
+}
+
+// InvestigationStep AI の応答1回と、そのとき呼び出したツール
+type InvestigationStep struct {
+	Step      int                     `json:"step"`
+	Content   string                  `json:"content,omitempty"`
+	ToolCalls []InvestigationToolCall `json:"tool_calls"`
+}
+
+// investigator ツールの実行に使うプロジェクトの情報
+type investigator struct {
+	db         *gorm.DB
+	projectID  uint
+	analysisID uint
+	filesRead  map[string][][2]int
+	lang       string // ツールの出力に使う言語
+}
+
+// runInvestigation 指定された質問について、AI がツールでファイルをたどりながら調べて答える
+// ステップ数の予算を使い切ったら、それまでに分かったことで答えさせる。ツールの呼び出しはすべて結果に残す
+func (w *AnalysisWorker) runInvestigation(ctx context.Context, analysis *models.Analysis) (string, error) {
+	options := w.optionsFor(analysis)
+	question := strings.TrimSpace(options.Question)
+	if question == "" {
+		return "", fmt.Errorf("investigation requires a question")
+	}
+	maxSteps := investigationDefaultSteps
+	if options.InvestigationSteps > 0 {
+		maxSteps = min(options.InvestigationSteps, investigationMaxSteps)
+	}
+
+	ai := w.aiFor(analysis)
+	system, err := ai.render("investigation", PromptData{})
+	if err != nil {
+		return "", err
+	}
+	inv := &investigator{db: w.db, projectID: analysis.ProjectID, analysisID: analysis.ID, filesRead: make(map[string][][2]int), lang: ai.outputLanguage()}
+	tools := investigationTools(inv.lang)
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: system},
+		{Role: openai.ChatMessageRoleUser, Content: question},
+	}
+
+	var steps []InvestigationStep
+	toolCounts := make(map[string]int)
+	answer, answered := "", false
+	for step := 1; step <= maxSteps; step++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		message, err := ai.CompleteWithTools(ctx, messages, tools, true)
+		if err != nil {
+			return "", fmt.Errorf("investigation step %d failed: %w", step, err)
+		}
+		messages = append(messages, message)
+		record := InvestigationStep{Step: step, Content: message.Content, ToolCalls: []InvestigationToolCall{}}
+		if len(message.ToolCalls) == 0 {
+			steps = append(steps, record)
+			answer, answered = message.Content, true
+			break
+		}
+		for _, call := range message.ToolCalls {
+			output, err := inv.call(call.Function.Name, call.Function.Arguments)
+			entry := InvestigationToolCall{ID: call.ID, Tool: call.Function.Name, Arguments: rawArguments(call.Function.Arguments), Output: output}
+			if err != nil {
+				entry.Error = err.Error()
+				output = "error: " + err.Error()
+			}
+			if len(output) > investigationMaxOutput {
+				output = strings.ToValidUTF8(output[:investigationMaxOutput], "") + localize(inv.lang, "\n…（出力が長いため省略。範囲を絞って呼び出してください）")
+				entry.Truncated = true
+			}
+			toolCounts[entry.Tool]++
+			record.ToolCalls = append(record.ToolCalls, entry)
+			messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleTool, Content: output, ToolCallID: call.ID})
+		}
+		steps = append(steps, record)
+	}
+
+	status := "answered"
+	if !answered {
+		// 予算を使い切ったので、ツールを使わずに答えさせる
+		status = "budget_exhausted"
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: localize(inv.lang, "調査に使えるステップを使い切りました。ここまでに分かったことだけで回答し、未確認の点はそう明記してください。"),
+		})
+		message, err := ai.CompleteWithTools(ctx, messages, tools, false)
+		if err != nil {
+			return "", fmt.Errorf("investigation final answer failed: %w", err)
+		}
+		answer = message.Content
+		steps = append(steps, InvestigationStep{Step: len(steps) + 1, Content: message.Content, ToolCalls: []InvestigationToolCall{}})
+	}
+
+	filesRead := []map[string]interface{}{}
+	for _, name := range sortedKeys(inv.filesRead) {
+		filesRead = append(filesRead, map[string]interface{}{"file": name, "ranges": inv.filesRead[name]})
+	}
+	toolCalls := 0
+	for _, n := range toolCounts {
+		toolCalls += n
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"question":   question,
+		"answer":     answer,
+		"status":     status,
+		"steps":      steps,
+		"files_read": filesRead,
+		"summary": map[string]interface{}{
+			"max_steps":  maxSteps,
+			"steps_used": len(steps),
+			"tool_calls": toolCalls,
+			"by_tool":    toolCounts,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// rawArguments AI が返した引数が JSON でなければ文字列として記録する
+func rawArguments(arguments string) json.RawMessage {
+	if json.Valid([]byte(arguments)) {
+		return json.RawMessage(arguments)
+	}
+	data, _ := json.Marshal(arguments)
+	return data
+}
+
+// call ツールを実行する
+func (inv *investigator) call(name, arguments string) (string, error) {
+	var args struct {
+		Prefix     string `json:"prefix"`
+		Language   string `json:"language"`
+		File       string `json:"file"`
+		StartLine  int    `json:"start_line"`
+		EndLine    int    `json:"end_line"`
+		Pattern    string `json:"pattern"`
+		Regex      bool   `json:"regex"`
+		IgnoreCase bool   `json:"ignore_case"`
+		Path       string `json:"path"`
+		Name       string `json:"name"`
+		Kind       string `json:"kind"`
+		AnalysisID uint   `json:"analysis_id"`
+		Offset     int    `json:"offset"`
+	}
+	if strings.TrimSpace(arguments) != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+	}
+
+	switch name {
+	case "list_tree":
+		return inv.listTree(args.Prefix, args.Language)
+	case "read_file":
+		return inv.readFile(args.File, args.StartLine, args.EndLine)
+	case "grep":
+		return inv.grep(args.Pattern, args.Regex, args.IgnoreCase, args.Path)
+	case "search_identifiers":
+		return inv.searchIdentifiers(args.Name, args.Kind)
+	case "list_analyses":
+		return inv.listAnalyses()
+	case "read_analysis":
+		return inv.readAnalysis(args.AnalysisID, args.Offset)
+	}
+	return "", fmt.Errorf("unknown tool: %s", name)
+}
+
+func (inv *investigator) listTree(prefix, language string) (string, error) {
+	query := inv.db.Model(&models.File{}).
+		Select("name, language, size, LENGTH(content) - LENGTH(REPLACE(content, E'\\n', '')) + 1 AS lines, content = '' AS is_binary").
+		Where("project_id = ?", inv.projectID)
+	if prefix != "" {
+		query = query.Where("name LIKE ? ESCAPE '\\'", EscapeLike(prefix)+"%")
+	}
+	if language != "" {
+		query = query.Where("language = ?", language)
+	}
+	var rows []struct {
+		Name     string
+		Language string
+		Size     int64
+		Lines    int
+		IsBinary bool
+	}
+	if err := query.Order("name").Limit(investigationListLimit + 1).Scan(&rows).Error; err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return localize(inv.lang, "（該当するファイルはありません）"), nil
+	}
+	var sb strings.Builder
+	for i, row := range rows {
+		if i == investigationListLimit {
+			fmt.Fprintf(&sb, localize(inv.lang, "…（%d件を超えるため省略。prefix で絞ってください）\n"), investigationListLimit)
+			break
+		}
+		if row.IsBinary {
+			fmt.Fprintf(&sb, "%s\t%s\t%d bytes\t(binary)\n", row.Name, row.Language, row.Size)
+		} else {
+			fmt.Fprintf(&sb, "%s\t%s\t%d bytes\t%d lines\n", row.Name, row.Language, row.Size, row.Lines)
+		}
+	}
+	return sb.String(), nil
+}
+
+func (inv *investigator) readFile(name string, start, end int) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("file is required")
+	}
+	var file models.File
+	err := inv.db.Where("project_id = ? AND name = ?", inv.projectID, name).Order("id").First(&file).Error
+	if err == gorm.ErrRecordNotFound {
+		// パスの末尾だけで指定された場合
+		err = inv.db.Where("project_id = ? AND name LIKE ? ESCAPE '\\'", inv.projectID, "%/"+EscapeLike(name)).Order("id").First(&file).Error
+	}
+	if err == gorm.ErrRecordNotFound {
+		return "", fmt.Errorf("file not found: %s", name)
+	}
+	if err != nil {
+		return "", err
+	}
+	if file.Content == "" {
+		return "", fmt.Errorf("%s is a binary file and has no text content", file.Name)
+	}
+
+	lines := strings.Split(file.Content, "\n")
+	start = max(start, 1)
+	if end <= 0 {
+		end = start + investigationReadLines - 1
+	}
+	end = min(end, start+investigationReadLines-1, len(lines))
+	if start > len(lines) {
+		return "", fmt.Errorf("%s has only %d lines", file.Name, len(lines))
+	}
+	if end < start {
+		return "", fmt.Errorf("end_line must not be before start_line")
+	}
+	inv.filesRead[file.Name] = append(inv.filesRead[file.Name], [2]int{start, end})
+
+	header := fmt.Sprintf(localize(inv.lang, "%s:%d-%d（全%d行）\n"), file.Name, start, end, len(lines))
+	return header + numberLines(lines[start-1:end], start), nil
+}
+
+func (inv *investigator) grep(pattern string, regex, ignoreCase bool, glob string) (string, error) {
+	options := GrepOptions{Query: pattern, Regex: regex, IgnoreCase: ignoreCase, Limit: investigationGrepLimit}
+	if glob != "" {
+		options.Paths = []string{glob}
+	}
+	result, err := GrepProject(inv.db, inv.projectID, options)
+	if err != nil {
+		return "", err
+	}
+	if result.Matches == 0 {
+		return localize(inv.lang, "（一致する行はありません）"), nil
+	}
+	var sb strings.Builder
+	for _, file := range result.Files {
+		for _, line := range file.Lines {
+			fmt.Fprintf(&sb, "%s:%d: %s\n", file.FileName, line.Line, line.Text)
+		}
+	}
+	if result.Truncated {
+		fmt.Fprintf(&sb, localize(inv.lang, "…（%d行を超えるため省略。パターンかパスを絞ってください）\n"), investigationGrepLimit)
+	}
+	return sb.String(), nil
+}
+
+func (inv *investigator) searchIdentifiers(name, kind string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+	query := inv.db.Table("symbols").
+		Select("symbols.name, symbols.kind, symbols.container, symbols.line, symbols.signature, files.name AS file_name").
+		Joins("JOIN files ON files.id = symbols.file_id AND files.deleted_at IS NULL").
+		Where("symbols.project_id = ? AND LOWER(symbols.name) LIKE ? ESCAPE '\\'", inv.projectID, "%"+EscapeLike(name)+"%")
+	if kind != "" {
+		query = query.Where("symbols.kind = ?", kind)
+	}
+	var rows []struct {
+		Name      string
+		Kind      string
+		Container string
+		Line      int
+		Signature string
+		FileName  string
+	}
+	if err := query.Order(clause.OrderBy{Expression: clause.Expr{
+		SQL:  "LOWER(symbols.name) = ? DESC, symbols.name, files.name, symbols.line",
+		Vars: []interface{}{name},
+	}}).
+		Limit(investigationSymbolLimit).Scan(&rows).Error; err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return localize(inv.lang, "（該当する定義はありません）"), nil
+	}
+	var sb strings.Builder
+	for _, row := range rows {
+		qualified := row.Name
+		if row.Container != "" {
+			qualified = row.Container + "." + row.Name
+		}
+		fmt.Fprintf(&sb, "%s (%s) %s:%d", qualified, row.Kind, row.FileName, row.Line)
+		if row.Signature != "" {
+			fmt.Fprintf(&sb, "  %s", row.Signature)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+func (inv *investigator) listAnalyses() (string, error) {
+	var rows []struct {
+		ID        uint
+		Type      string
+		UpdatedAt time.Time
+		Length    int
+	}
+	if err := inv.db.Model(&models.Analysis{}).Select("id, type, updated_at, LENGTH(result) AS length").
+		Where("project_id = ? AND status = ? AND id <> ?", inv.projectID, "completed", inv.analysisID).
+		Order("id DESC").Limit(100).Scan(&rows).Error; err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return localize(inv.lang, "（完了した解析はありません）"), nil
+	}
+	var sb strings.Builder
+	for _, row := range rows {
+		fmt.Fprintf(&sb, "#%d\t%s\t%s\t%d chars\n", row.ID, row.Type, row.UpdatedAt.Format("2006-01-02 15:04"), row.Length)
+	}
+	return sb.String(), nil
+}
+
+func (inv *investigator) readAnalysis(id uint, offset int) (string, error) {
+	if id == 0 {
+		return "", fmt.Errorf("analysis_id is required")
+	}
+	var analysis models.Analysis
+	err := inv.db.Where("id = ? AND project_id = ? AND status = ?", id, inv.projectID, "completed").First(&analysis).Error
+	if err == gorm.ErrRecordNotFound {
+		return "", fmt.Errorf("completed analysis #%d not found in this project", id)
+	}
+	if err != nil {
+		return "", err
+	}
+	runes := []rune(analysis.Result)
+	offset = max(offset, 0)
+	if offset >= len(runes) {
+		return "", fmt.Errorf("offset is beyond the end of the result (%d chars)", len(runes))
+	}
+	end := min(offset+investigationAnalysisPage, len(runes))
+	text := fmt.Sprintf(localize(inv.lang, "#%d %s（%d-%d / %d chars）\n%s"), analysis.ID, analysis.Type, offset, end, len(runes), string(runes[offset:end]))
+	if end < len(runes) {
+		text += fmt.Sprintf(localize(inv.lang, "\n…（続きは offset=%d で読めます）"), end)
+	}
+	return text, nil
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"reverse-engineering-backend/models"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// testToolServer 受け取ったリクエストを記録し、reply が返すメッセージを応答する OpenAI 互換のサーバー
+func testToolServer(t *testing.T, reply func(n int) openai.ChatCompletionMessage) (*AIService, *[]openai.ChatCompletionRequest) {
+	t.Helper()
+	var requests []openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request openai.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		requests = append(requests, request)
+		message := reply(len(requests))
+		message.Role = openai.ChatMessageRoleAssistant
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: message}}})
+	}))
+	t.Cleanup(server.Close)
+
+	config := openai.DefaultConfig("test")
+	config.BaseURL = server.URL
+	return &AIService{client: openai.NewClientWithConfig(config)}, &requests
+}
+
+func testToolCall(id, name, arguments string) openai.ToolCall {
+	return openai.ToolCall{ID: id, Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: name, Arguments: arguments}}
+}
+
+// investigationResult runInvestigation の結果のうちテストで見る部分
+type investigationResult struct {
+	Question string              `json:"question"`
+	Answer   string              `json:"answer"`
+	Status   string              `json:"status"`
+	Steps    []InvestigationStep `json:"steps"`
+	Summary  struct {
+		MaxSteps  int            `json:"max_steps"`
+		StepsUsed int            `json:"steps_used"`
+		ToolCalls int            `json:"tool_calls"`
+		ByTool    map[string]int `json:"by_tool"`
+	} `json:"summary"`
+}
+
+func runTestInvestigation(t *testing.T, ai *AIService, language string, options AnalysisOptions) investigationResult {
+	t.Helper()
+	metadata, _ := json.Marshal(options)
+	analysis := &models.Analysis{ID: 1, ProjectID: 2, Type: "investigation", Metadata: string(metadata)}
+	w := &AnalysisWorker{aiService: ai}
+	w.promptSets.Store(analysis.ID, NewPromptSet(nil, 0, language, nil))
+	data, err := w.runInvestigation(context.Background(), analysis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result investigationResult
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestRunInvestigation(t *testing.T) {
+	ai, requests := testToolServer(t, func(n int) openai.ChatCompletionMessage {
+		switch n {
+		case 1:
+			// 1回の応答で複数のツールを呼べる。データベースを使う前に失敗する呼び出しだけを使う
+			return openai.ChatCompletionMessage{Content: "Let me look.", ToolCalls: []openai.ToolCall{
+				testToolCall("call_a", "delete_project", `{}`),
+				testToolCall("call_b", "read_file", `{"file": 3`),
+			}}
+		case 2:
+			return openai.ChatCompletionMessage{ToolCalls: []openai.ToolCall{testToolCall("call_c", "search_identifiers", `{"name": "  "}`)}}
+		}
+		return openai.ChatCompletionMessage{Content: "The token is refreshed in auth.go."}
+	})
+	result := runTestInvestigation(t, ai, "en", AnalysisOptions{Question: "  Where is the token refreshed?  "})
+
+	if result.Question != "Where is the token refreshed?" || result.Status != "answered" || result.Answer != "The token is refreshed in auth.go." {
+		t.Errorf("result = %+v", result)
+	}
+	if s := result.Summary; s.MaxSteps != investigationDefaultSteps || s.StepsUsed != 3 || s.ToolCalls != 3 ||
+		!reflect.DeepEqual(s.ByTool, map[string]int{"delete_project": 1, "read_file": 1, "search_identifiers": 1}) {
+		t.Errorf("summary = %+v", s)
+	}
+
+	// ツールの呼び出しと失敗はすべて記録し、JSON でない引数は文字列として残す
+	calls := result.Steps[0].ToolCalls
+	if result.Steps[0].Content != "Let me look." || len(calls) != 2 {
+		t.Fatalf("step 1 = %+v", result.Steps[0])
+	}
+	if calls[0].Error != "unknown tool: delete_project" || string(calls[0].Arguments) != "{}" {
+		t.Errorf("unknown tool call = %+v", calls[0])
+	}
+	if !strings.HasPrefix(calls[1].Error, "invalid arguments") || string(calls[1].Arguments) != `"{\"file\": 3"` {
+		t.Errorf("invalid arguments call = %+v", calls[1])
+	}
+	if last := result.Steps[2]; len(last.ToolCalls) != 0 || last.Content != result.Answer {
+		t.Errorf("last step = %+v", last)
+	}
+
+	// ツールの結果は呼び出しの ID を付けて、応答の後ろに順に渡す
+	if len(*requests) != 3 {
+		t.Fatalf("got %d requests, want 3", len(*requests))
+	}
+	second := (*requests)[1]
+	var roles []string
+	for _, m := range second.Messages {
+		roles = append(roles, m.Role)
+	}
+	if want := []string{"system", "user", "assistant", "tool", "tool"}; !reflect.DeepEqual(roles, want) {
+		t.Errorf("roles = %v, want %v", roles, want)
+	}
+	if m := second.Messages[3]; m.ToolCallID != "call_a" || m.Content != "error: unknown tool: delete_project" {
+		t.Errorf("tool message = %+v", m)
+	}
+	if len(second.Tools) != 6 || second.ToolChoice != nil || second.Messages[1].Content != result.Question {
+		t.Errorf("request = %+v", second)
+	}
+	if d := second.Tools[1].Function; d.Name != "read_file" || !strings.Contains(d.Description, "line numbers") {
+		t.Errorf("read_file tool = %+v", d)
+	}
+}
+
+func TestRunInvestigationBudget(t *testing.T) {
+	// ツールを呼び続ける AI は予算を使い切ったところでツールなしで答えさせる
+	ai, requests := testToolServer(t, func(n int) openai.ChatCompletionMessage {
+		if n <= 2 {
+			return openai.ChatCompletionMessage{ToolCalls: []openai.ToolCall{testToolCall("call", "read_analysis", `{}`)}}
+		}
+		return openai.ChatCompletionMessage{Content: "Unverified: ran out of steps."}
+	})
+	result := runTestInvestigation(t, ai, "en", AnalysisOptions{Question: "q", InvestigationSteps: 2})
+
+	if result.Status != "budget_exhausted" || result.Answer != "Unverified: ran out of steps." || result.Summary.StepsUsed != 3 || result.Summary.MaxSteps != 2 {
+		t.Errorf("result = %+v", result)
+	}
+	if len(*requests) != 3 {
+		t.Fatalf("got %d requests, want 3", len(*requests))
+	}
+	final := (*requests)[2]
+	if final.ToolChoice != "none" {
+		t.Errorf("final tool_choice = %v, want none", final.ToolChoice)
+	}
+	if last := final.Messages[len(final.Messages)-1]; last.Role != "user" || !strings.Contains(last.Content, "used up") {
+		t.Errorf("final message = %+v", last)
+	}
+}
+
+func TestRunInvestigationOptions(t *testing.T) {
+	w := &AnalysisWorker{aiService: &AIService{}}
+	if _, err := w.runInvestigation(context.Background(), &models.Analysis{Metadata: `{"question": " "}`}); err == nil {
+		t.Error("investigation without a question error = nil")
+	}
+
+	// ステップ数は上限までに抑える
+	ai, _ := testToolServer(t, func(int) openai.ChatCompletionMessage { return openai.ChatCompletionMessage{Content: "ok"} })
+	if result := runTestInvestigation(t, ai, "ja", AnalysisOptions{Question: "q", InvestigationSteps: 1000}); result.Summary.MaxSteps != investigationMaxSteps {
+		t.Errorf("max steps = %d, want %d", result.Summary.MaxSteps, investigationMaxSteps)
+	}
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"strings"
+)
+
+// 直後に空白を置くキーワード
+var jsSpacedKeywords = map[string]bool{
+	"if": true, "for": true, "while": true, "switch": true, "catch": true, "with": true,
+	"return": true, "typeof": true, "instanceof": true, "in": true, "of": true, "new": true,
+	"delete": true, "void": true, "throw": true, "case": true, "do": true, "else": true,
+	"var": true, "let": true, "const": true, "function": true, "yield": true, "await": true,
+	"async": true, "class": true, "extends": true, "import": true, "export": true, "from": true,
+}
+
+// 前後に空白を置く二項演算子
+var jsBinaryOperators = map[string]bool{
+	"=": true, "==": true, "===": true, "!=": true, "!==": true, "<": true, ">": true, "<=": true,
+	">=": true, "&&": true, "||": true, "??": true, "+": true, "-": true, "*": true, "/": true,
+	"%": true, "**": true, "&": true, "|": true, "^": true, "<<": true, ">>": true, ">>>": true,
+	"+=": true, "-=": true, "*=": true, "/=": true, "%=": true, "**=": true, "&=": true, "|=": true,
+	"^=": true, "<<=": true, ">>=": true, ">>>=": true, "&&=": true, "||=": true, "??=": true,
+	"=>": true, "?": true,
+}
+
+// BeautifyJS JavaScriptソースを整形する
+func BeautifyJS(src string) string {
+	return BeautifyJSTokens(TokenizeJS(src))
+}
+
+// BeautifyJSTokens トークン列をインデント付きのソースに整形する
+// js-beautify ほど厳密ではないが、1行に詰め込まれたバンドルを読める形にすることが目的
+func BeautifyJSTokens(tokens []JSToken) string {
+	b := &jsBeautifier{}
+	for i, t := range tokens {
+		var next *JSToken
+		for k := i + 1; k < len(tokens); k++ {
+			if tokens[k].Kind != JSTokenComment {
+				next = &tokens[k]
+				break
+			}
+		}
+		b.emit(t, next)
+	}
+	return strings.TrimRight(b.sb.String(), " \n") + "\n"
+}
+
+type jsBeautifier struct {
+	sb           strings.Builder
+	indent       int
+	atLineStart  bool
+	pendingSpace bool
+	prev         *JSToken
+	parenDepth   int
+	forParens    []int
+	ternaries    []int
+	caseLabel    bool
+	emptyBlock   bool
+}
+
+func (b *jsBeautifier) newline() {
+	if b.sb.Len() == 0 {
+		return
+	}
+	b.sb.WriteByte('\n')
+	b.atLineStart = true
+	b.pendingSpace = false
+}
+
+func (b *jsBeautifier) write(s string) {
+	if b.atLineStart || b.sb.Len() == 0 {
+		b.sb.WriteString(strings.Repeat("  ", b.indent))
+		b.atLineStart = false
+	} else if b.pendingSpace {
+		b.sb.WriteByte(' ')
+	}
+	b.pendingSpace = false
+	b.sb.WriteString(s)
+}
+
+func (b *jsBeautifier) isWordLike(t *JSToken) bool {
+	return t != nil && (t.Kind == JSTokenIdent || t.Kind == JSTokenNumber || t.Kind == JSTokenString ||
+		t.Kind == JSTokenTemplate || t.Kind == JSTokenRegex)
+}
+
+// isOperand トークンが値で終わっているか（単項/二項演算子の判別に使う）
+func (b *jsBeautifier) isOperand(t *JSToken) bool {
+	if t == nil {
+		return false
+	}
+	if t.Kind == JSTokenIdent {
+		return !jsRegexPrecedingKeywords[t.Text]
+	}
+	if t.Kind == JSTokenPunct {
+		return t.Text == ")" || t.Text == "]" || t.Text == "}" || t.Text == "++" || t.Text == "--"
+	}
+	return true
+}
+
+func (b *jsBeautifier) emit(t JSToken, next *JSToken) {
+	if t.Kind == JSTokenComment {
+		if strings.HasPrefix(t.Text, "//") {
+			if t.NewlineBefore && !b.atLineStart {
+				b.newline()
+			} else {
+				b.pendingSpace = true
+			}
+			b.write(t.Text)
+			b.newline()
+		} else {
+			if t.NewlineBefore && !b.atLineStart {
+				b.newline()
+			} else {
+				b.pendingSpace = true
+			}
+			b.write(t.Text)
+			b.pendingSpace = true
+			if next != nil && next.NewlineBefore {
+				b.newline()
+			}
+		}
+		return
+	}
+
+	prev := b.prev
+	tok := t
+	b.prev = &tok
+
+	if t.Kind != JSTokenPunct {
+		if b.isWordLike(prev) || (prev != nil && isJSPunct(*prev, ")")) {
+			b.pendingSpace = true
+		}
+		b.write(t.Text)
+		if t.Kind == JSTokenIdent && jsSpacedKeywords[t.Text] {
+			b.pendingSpace = true
+		}
+		if t.Kind == JSTokenIdent && (t.Text == "case" || t.Text == "default") {
+			b.caseLabel = true
+		}
+		return
+	}
+
+	switch t.Text {
+	case "{":
+		if prev != nil && !(prev.Kind == JSTokenPunct && (prev.Text == "(" || prev.Text == "[" || prev.Text == "!")) {
+			b.pendingSpace = true
+		}
+		if next != nil && isJSPunct(*next, "}") {
+			b.write("{")
+			b.emptyBlock = true
+			return
+		}
+		b.write("{")
+		b.indent++
+		b.newline()
+	case "}":
+		if b.emptyBlock {
+			b.emptyBlock = false
+			b.write("}")
+		} else {
+			if b.indent > 0 {
+				b.indent--
+			}
+			if !b.atLineStart {
+				b.newline()
+			}
+			b.write("}")
+		}
+		switch {
+		case next == nil:
+			b.newline()
+		case next.Kind == JSTokenPunct && strings.Contains(");,.]([`", next.Text):
+		case next.Kind == JSTokenPunct && next.Text == "?.":
+		case isJSKeyword(*next, "else", "catch", "finally", "while"):
+			b.pendingSpace = true
+		default:
+			b.newline()
+		}
+	case ";":
+		b.write(";")
+		if len(b.forParens) > 0 && b.forParens[len(b.forParens)-1] == b.parenDepth {
+			b.pendingSpace = true
+		} else {
+			b.newline()
+		}
+	case "(":
+		if prev != nil && prev.Kind == JSTokenIdent && jsSpacedKeywords[prev.Text] && prev.Text != "function" {
+			b.pendingSpace = true
+		} else if prev != nil && isJSPunct(*prev, "=>") {
+			b.pendingSpace = true
+		}
+		b.write("(")
+		b.parenDepth++
+		if prev != nil && isJSKeyword(*prev, "for") {
+			b.forParens = append(b.forParens, b.parenDepth)
+		}
+	case ")":
+		if len(b.forParens) > 0 && b.forParens[len(b.forParens)-1] == b.parenDepth {
+			b.forParens = b.forParens[:len(b.forParens)-1]
+		}
+		b.parenDepth--
+		b.write(")")
+	case "[":
+		if prev != nil && (isJSPunct(*prev, "=") || isJSPunct(*prev, ",") || isJSPunct(*prev, ":") || isJSKeyword(*prev, "return")) {
+			b.pendingSpace = prev.Kind == JSTokenIdent || !isJSPunct(*prev, ",")
+		}
+		b.write("[")
+	case "]", ".", "?.", "...":
+		b.write(t.Text)
+	case ",":
+		b.write(",")
+		b.pendingSpace = true
+	case ":":
+		if len(b.ternaries) > 0 && b.ternaries[len(b.ternaries)-1] == b.parenDepth {
+			b.ternaries = b.ternaries[:len(b.ternaries)-1]
+			b.pendingSpace = true
+			b.write(":")
+			b.pendingSpace = true
+			return
+		}
+		b.write(":")
+		if b.caseLabel {
+			b.caseLabel = false
+			b.newline()
+			return
+		}
+		b.pendingSpace = true
+	case "!", "~":
+		if b.isWordLike(prev) && !b.isOperand(prev) {
+			b.pendingSpace = true
+		}
+		b.write(t.Text)
+	case "++", "--":
+		b.write(t.Text)
+	default:
+		unary := (t.Text == "+" || t.Text == "-") && !b.isOperand(prev)
+		if unary {
+			if prev != nil && b.isWordLike(prev) {
+				b.pendingSpace = true
+			}
+			b.write(t.Text)
+			return
+		}
+		if jsBinaryOperators[t.Text] {
+			if t.Text == "?" {
+				b.ternaries = append(b.ternaries, b.parenDepth)
+			}
+			b.pendingSpace = true
+			b.write(t.Text)
+			b.pendingSpace = true
+			return
+		}
+		b.write(t.Text)
+	}
+}
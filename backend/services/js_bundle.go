@@ -0,0 +1,266 @@
+package services
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// esbuild / rollup 等が出力するモジュール境界コメント（例: "// src/components/App.js"）
+var jsModuleBannerPattern = regexp.MustCompile(`^//\s*((?:\.{0,2}/)?[\w@.\-]+(?:/[\w@.\-]+)*\.(?:m?js|cjs|jsx|ts|tsx|vue|svelte))\s*$`)
+
+// eval形式のwebpackモジュールに付与される sourceURL
+var jsSourceURLPattern = regexp.MustCompile(`//[#@] sourceURL=(\S+)`)
+
+// SplitJSBundle バンドルをモジュール単位に分割する
+// webpack（4/5、jsonpチャンク含む）、browserify、モジュール境界コメント付きのバンドル（esbuild/rollup）に対応する
+func SplitJSBundle(src string) JSBundle {
+	tokens := TokenizeJS(src)
+
+	if modules := splitJSByBanners(tokens); len(modules) >= 2 {
+		return JSBundle{Bundler: "banner", Modules: modules}
+	}
+
+	code := stripJSComments(tokens)
+	match := matchJSBrackets(code)
+	bundler := "webpack"
+	if strings.Contains(src, "typeof require&&require") || strings.Contains(src, "typeof require == \"function\" && require") {
+		bundler = "browserify"
+	}
+	isWebpack := strings.Contains(src, "__webpack_require__") || strings.Contains(src, "__webpack_modules__") ||
+		strings.Contains(src, "webpackChunk") || strings.Contains(src, "webpackJsonp")
+
+	var modules []JSModule
+	for i := 0; i < len(code); i++ {
+		if !isJSPunct(code[i], "{") && !isJSPunct(code[i], "[") {
+			continue
+		}
+		entries, ok := parseJSModuleTable(code, match, i)
+		if !ok || len(entries) == 0 {
+			continue
+		}
+		// マーカーが無いミニファイ済みバンドルは、数値IDまたはパスIDの表が2件以上ある場合のみ採用する
+		if !isWebpack && bundler != "browserify" && (len(entries) < 2 || !jsModuleIDsLookBundled(entries)) {
+			continue
+		}
+		modules = append(modules, entries...)
+		i = match[i]
+	}
+
+	if len(modules) == 0 {
+		return JSBundle{}
+	}
+	return JSBundle{Bundler: bundler, Modules: modules}
+}
+
+func jsModuleIDsLookBundled(modules []JSModule) bool {
+	for _, m := range modules {
+		if _, err := strconv.Atoi(m.ID); err != nil && !strings.HasPrefix(m.ID, "./") {
+			return false
+		}
+	}
+	return true
+}
+
+// splitJSByBanners トップレベルのパスコメントでトークン列を区切る
+func splitJSByBanners(tokens []JSToken) []JSModule {
+	var modules []JSModule
+	var current *JSModule
+	var body []JSToken
+	depth := 0
+
+	flush := func() {
+		if current != nil && len(body) > 0 {
+			current.Source = BeautifyJSTokens(body)
+			modules = append(modules, *current)
+		}
+		body = nil
+	}
+
+	for _, t := range tokens {
+		if t.Kind == JSTokenComment && depth <= 1 {
+			if m := jsModuleBannerPattern.FindStringSubmatch(t.Text); m != nil {
+				flush()
+				current = &JSModule{ID: m[1], Name: m[1]}
+				continue
+			}
+		}
+		if t.Kind == JSTokenPunct {
+			switch t.Text {
+			case "{", "(", "[":
+				depth++
+			case "}", ")", "]":
+				depth--
+			}
+		}
+		if current != nil {
+			body = append(body, t)
+		}
+	}
+	flush()
+	return modules
+}
+
+// parseJSModuleTable { id: function(module, exports, require){...}, ... } または [function(){...}, ...] を解析する
+func parseJSModuleTable(tokens []JSToken, match []int, open int) ([]JSModule, bool) {
+	end := match[open]
+	if end < 0 || end == open+1 {
+		return nil, false
+	}
+	isArray := tokens[open].Text == "["
+
+	var modules []JSModule
+	i := open + 1
+	index := 0
+	for i < end {
+		if isArray && isJSPunct(tokens[i], ",") {
+			// 疎配列の穴
+			index++
+			i++
+			continue
+		}
+
+		var id string
+		if isArray {
+			id = strconv.Itoa(index)
+		} else {
+			key := tokens[i]
+			switch key.Kind {
+			case JSTokenNumber, JSTokenIdent:
+				id = key.Text
+			case JSTokenString:
+				v, ok := UnquoteJSString(key.Text)
+				if !ok {
+					return nil, false
+				}
+				id = v
+			default:
+				return nil, false
+			}
+			if i+1 >= end || !isJSPunct(tokens[i+1], ":") {
+				return nil, false
+			}
+			i += 2
+		}
+
+		// browserify: id: [function(require,module,exports){...}, {"./dep": 2}]
+		valueEnd := -1
+		wrapped := false
+		if isJSPunct(tokens[i], "[") && !isArray && match[i] > 0 {
+			wrapped = true
+			valueEnd = match[i]
+			i++
+		}
+
+		params, bodyStart, bodyEnd, fnEnd, ok := parseJSFunctionExpr(tokens, match, i)
+		if !ok {
+			return nil, false
+		}
+		module := JSModule{ID: id, Params: strings.Join(params, ", ")}
+		module.Name, module.Source = jsModuleSource(tokens[bodyStart+1:bodyEnd], id)
+		modules = append(modules, module)
+
+		if wrapped {
+			i = valueEnd + 1
+		} else {
+			i = fnEnd + 1
+		}
+		if i < end {
+			if !isJSPunct(tokens[i], ",") {
+				return nil, false
+			}
+			i++
+		}
+		index++
+	}
+	return modules, true
+}
+
+// parseJSFunctionExpr function(a,b,c){...} / (a,b,c)=>{...} / a=>{...} を解析する（括弧で包まれていてもよい）
+func parseJSFunctionExpr(tokens []JSToken, match []int, i int) (params []string, bodyStart, bodyEnd, end int, ok bool) {
+	if i >= len(tokens) {
+		return nil, 0, 0, 0, false
+	}
+	if isJSPunct(tokens[i], "(") && match[i] > 0 {
+		if params, bodyStart, bodyEnd, end, ok = parseJSFunctionExpr(tokens, match, i+1); ok && end+1 == match[i] {
+			return params, bodyStart, bodyEnd, match[i], true
+		}
+	}
+
+	paramsStart := -1
+	switch {
+	case isJSKeyword(tokens[i], "function"):
+		paramsStart = i + 1
+		if paramsStart < len(tokens) && tokens[paramsStart].Kind == JSTokenIdent {
+			paramsStart++
+		}
+	case isJSPunct(tokens[i], "("):
+		paramsStart = i
+	case tokens[i].Kind == JSTokenIdent && i+2 < len(tokens) && isJSPunct(tokens[i+1], "=>") && isJSPunct(tokens[i+2], "{"):
+		return []string{tokens[i].Text}, i + 2, match[i+2], match[i+2], match[i+2] > 0
+	default:
+		return nil, 0, 0, 0, false
+	}
+
+	if paramsStart >= len(tokens) || !isJSPunct(tokens[paramsStart], "(") || match[paramsStart] < 0 {
+		return nil, 0, 0, 0, false
+	}
+	paramsEnd := match[paramsStart]
+	for k := paramsStart + 1; k < paramsEnd; k++ {
+		if k%2 == (paramsStart+1)%2 {
+			if tokens[k].Kind != JSTokenIdent {
+				return nil, 0, 0, 0, false
+			}
+			params = append(params, tokens[k].Text)
+		} else if !isJSPunct(tokens[k], ",") {
+			return nil, 0, 0, 0, false
+		}
+	}
+	// webpack のモジュール関数は (module, exports, require) の3引数まで
+	if len(params) > 3 {
+		return nil, 0, 0, 0, false
+	}
+
+	bodyStart = paramsEnd + 1
+	if !isJSKeyword(tokens[i], "function") {
+		if bodyStart >= len(tokens) || !isJSPunct(tokens[bodyStart], "=>") {
+			return nil, 0, 0, 0, false
+		}
+		bodyStart++
+	}
+	if bodyStart >= len(tokens) || !isJSPunct(tokens[bodyStart], "{") || match[bodyStart] < 0 {
+		return nil, 0, 0, 0, false
+	}
+	return params, bodyStart, match[bodyStart], match[bodyStart], true
+}
+
+// jsModuleSource モジュール本体を整形し、モジュール名を推測する
+func jsModuleSource(body []JSToken, id string) (string, string) {
+	name := id
+
+	// webpack devtool: eval — 本体は eval("...") 1文だけ
+	if len(body) >= 4 && isJSKeyword(body[0], "eval") && isJSPunct(body[1], "(") && body[2].Kind == JSTokenString && isJSPunct(body[3], ")") {
+		if inner, ok := UnquoteJSString(body[2].Text); ok {
+			if m := jsSourceURLPattern.FindStringSubmatch(inner); m != nil {
+				name = m[1]
+			}
+			return normalizeJSModuleName(name, id), BeautifyJS(inner)
+		}
+	}
+
+	return normalizeJSModuleName(name, id), BeautifyJSTokens(body)
+}
+
+// normalizeJSModuleName モジュールIDを保存可能な相対パスにする
+func normalizeJSModuleName(name, id string) string {
+	if p := NormalizeSourcePath(name, ""); p != "" && path.Ext(p) != "" {
+		return p
+	}
+	return "module_" + strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == '.' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, id) + ".js"
+}
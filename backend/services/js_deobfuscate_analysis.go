@@ -0,0 +1,157 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// JSBundleReport js_deobfuscate 解析のファイル単位の結果
+type JSBundleReport struct {
+	FileID         uint                  `json:"file_id"`
+	Name           string                `json:"name"`
+	Bundler        string                `json:"bundler,omitempty"`
+	Modules        []JSModule            `json:"modules,omitempty"`
+	SourceMap      string                `json:"source_map,omitempty"`
+	Sources        []ReconstructedSource `json:"reconstructed_sources,omitempty"`
+	Deobfuscation  JSDeobfuscationStats  `json:"deobfuscation"`
+	CreatedFileIDs []uint                `json:"created_file_ids"`
+	Errors         []string              `json:"errors,omitempty"`
+}
+
+// runJSDeobfuscate 整形・文字列配列の復元・バンドル分割・ソースマップ適用を行い、結果を新しいファイルとして登録する
+func (w *AnalysisWorker) runJSDeobfuscate(files []models.File) (string, error) {
+	byName := make(map[string]*models.File)
+	for i := range files {
+		byName[path.Base(files[i].Name)] = &files[i]
+	}
+
+	var reports []JSBundleReport
+	usedMaps := make(map[uint]bool)
+
+	for i := range files {
+		file := &files[i]
+		if file.Language != "javascript" || file.Origin != "" || file.Content == "" {
+			continue
+		}
+		w.removeDerivedFiles(file.ID, "js_deobfuscate")
+
+		report := JSBundleReport{FileID: file.ID, Name: file.Name, CreatedFileIDs: []uint{}}
+		deobfuscated, stats := DeobfuscateJS(file.Content)
+		report.Deobfuscation = stats
+
+		splitSource := file.Content
+		if stats.StringsDecoded > 0 {
+			splitSource = deobfuscated
+		}
+		bundle := SplitJSBundle(splitSource)
+		report.Bundler = bundle.Bundler
+		report.Modules = bundle.Modules
+
+		// ソースマップの適用
+		mapData, mapName, mapFile := w.resolveSourceMap(file, byName)
+		if mapFile != nil {
+			usedMaps[mapFile.ID] = true
+		}
+		if mapData != nil {
+			report.SourceMap = mapName
+			if sm, err := ParseSourceMap(mapData); err != nil {
+				report.Errors = append(report.Errors, err.Error())
+			} else if sources, err := ReconstructSources(sm, file.Content); err != nil {
+				report.Errors = append(report.Errors, err.Error())
+			} else {
+				report.Sources = sources
+			}
+		}
+
+		created := w.saveJSDeobfuscationOutputs(file, &report, bundle, deobfuscated)
+		report.CreatedFileIDs = append(report.CreatedFileIDs, created...)
+		reports = append(reports, report)
+	}
+
+	// 対応するJavaScriptが無いソースマップ単体のアップロード
+	for i := range files {
+		file := &files[i]
+		if file.Language != "sourcemap" || file.Origin != "" || usedMaps[file.ID] || file.Content == "" {
+			continue
+		}
+		w.removeDerivedFiles(file.ID, "js_deobfuscate")
+
+		report := JSBundleReport{FileID: file.ID, Name: file.Name, SourceMap: file.Name, CreatedFileIDs: []uint{}}
+		sm, err := ParseSourceMap([]byte(file.Content))
+		if err == nil {
+			report.Sources, err = ReconstructSources(sm, "")
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+		report.CreatedFileIDs = append(report.CreatedFileIDs, w.saveJSDeobfuscationOutputs(file, &report, JSBundle{}, "")...)
+		reports = append(reports, report)
+	}
+
+	if len(reports) == 0 {
+		return "", fmt.Errorf("no JavaScript bundles or source maps found in project")
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"bundles": reports})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// resolveSourceMap sourceMappingURL（インライン含む）またはファイル名からソースマップを探す
+func (w *AnalysisWorker) resolveSourceMap(file *models.File, byName map[string]*models.File) ([]byte, string, *models.File) {
+	ref := ExtractSourceMappingURL(file.Content)
+	if data, ok := DecodeInlineSourceMap(ref); ok {
+		return data, "inline", nil
+	}
+
+	candidates := []string{path.Base(file.Name) + ".map"}
+	if ref != "" {
+		if i := strings.IndexAny(ref, "?#"); i >= 0 {
+			ref = ref[:i]
+		}
+		candidates = append([]string{path.Base(ref)}, candidates...)
+	}
+	for _, name := range candidates {
+		if mapFile, ok := byName[name]; ok && mapFile.Content != "" {
+			return []byte(mapFile.Content), mapFile.Name, mapFile
+		}
+	}
+	return nil, "", nil
+}
+
+// saveJSDeobfuscationOutputs 復元したソース・分割したモジュールを派生ファイルとして保存する
+func (w *AnalysisWorker) saveJSDeobfuscationOutputs(file *models.File, report *JSBundleReport, bundle JSBundle, deobfuscated string) []uint {
+	var created []uint
+	save := func(name, content string) {
+		derived, err := w.createDerivedFile(file, "js_deobfuscate", name, []byte(content))
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("failed to save %s: %v", name, err))
+			return
+		}
+		created = append(created, derived.ID)
+	}
+
+	for _, src := range report.Sources {
+		save(src.Path, src.Content)
+	}
+
+	base := strings.TrimSuffix(path.Base(file.Name), path.Ext(file.Name))
+	for _, module := range bundle.Modules {
+		header := fmt.Sprintf("// %s module %s", bundle.Bundler, module.ID)
+		if module.Params != "" {
+			header += fmt.Sprintf(" (params: %s)", module.Params)
+		}
+		save(path.Join(base+"_modules", module.Name), header+"\n"+module.Source)
+	}
+
+	if len(bundle.Modules) == 0 && deobfuscated != "" {
+		save(base+".deobfuscated.js", deobfuscated)
+	}
+	return created
+}
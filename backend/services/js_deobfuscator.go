@@ -0,0 +1,837 @@
+package services
+
+import (
+	"encoding/base64"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// JSDeobfuscationStats 難読化解除の統計情報
+type JSDeobfuscationStats struct {
+	StringArrays       int  `json:"string_arrays"`
+	StringsDecoded     int  `json:"strings_decoded"`
+	ArrayRotated       bool `json:"array_rotated"`
+	PropertiesDotted   int  `json:"properties_dotted"`
+	LiteralsSimplified int  `json:"literals_simplified"`
+}
+
+// JSModule バンドルから分割したモジュール
+type JSModule struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Params string `json:"params,omitempty"`
+	Source string `json:"-"`
+}
+
+// JSBundle バンドル分割の結果
+type JSBundle struct {
+	Bundler string     `json:"bundler"` // webpack, browserify, banner
+	Modules []JSModule `json:"modules"`
+}
+
+// jsStringArray 難読化された文字列配列
+type jsStringArray struct {
+	values []string
+	// isFunc 配列が関数呼び出し（NAME()）で取得される形式かどうか
+	isFunc bool
+}
+
+// jsStringAccessor 文字列配列を参照するデコード関数
+type jsStringAccessor struct {
+	array    *jsStringArray
+	offset   int
+	encoding string // plain, base64, rc4
+}
+
+const obfuscatorBase64Alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789+/="
+
+// IsMinifiedJS 1行が極端に長いなど、ミニファイされたコードかどうかを判定
+func IsMinifiedJS(src string) bool {
+	if len(src) < 512 {
+		return false
+	}
+	lines := strings.Count(src, "\n") + 1
+	if len(src)/lines > 200 {
+		return true
+	}
+	for _, line := range strings.Split(src, "\n") {
+		if len(line) > 2000 {
+			return true
+		}
+	}
+	return false
+}
+
+// DeobfuscateJS 文字列配列難読化を解除して整形したソースを返す
+func DeobfuscateJS(src string) (string, JSDeobfuscationStats) {
+	tokens, stats := DeobfuscateJSTokens(TokenizeJS(src))
+	return BeautifyJSTokens(tokens), stats
+}
+
+// DeobfuscateJSTokens トークン列に対して難読化解除を適用する
+// javascript-obfuscator 系の文字列配列（回転・base64・rc4を含む）と、よくある冗長表現を元に戻す
+func DeobfuscateJSTokens(tokens []JSToken) ([]JSToken, JSDeobfuscationStats) {
+	var stats JSDeobfuscationStats
+	tokens = stripJSComments(tokens)
+	match := matchJSBrackets(tokens)
+
+	arrays := findJSStringArrays(tokens, match)
+	if len(arrays) > 0 {
+		stats.StringArrays = len(arrays)
+		accessors := findJSStringAccessors(tokens, match, arrays)
+		findJSAccessorAliases(tokens, accessors)
+		stats.ArrayRotated = applyJSArrayRotations(tokens, match, arrays, accessors)
+
+		var decoded int
+		tokens, decoded = replaceJSStringLookups(tokens, match, arrays, accessors)
+		stats.StringsDecoded = decoded
+	}
+
+	tokens, stats.LiteralsSimplified = simplifyJSLiterals(tokens)
+	tokens, stats.PropertiesDotted = dotJSProperties(tokens)
+	return tokens, stats
+}
+
+func stripJSComments(tokens []JSToken) []JSToken {
+	out := make([]JSToken, 0, len(tokens))
+	for _, t := range tokens {
+		if t.Kind != JSTokenComment {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func isJSPunct(t JSToken, text string) bool {
+	return t.Kind == JSTokenPunct && t.Text == text
+}
+
+func isJSKeyword(t JSToken, words ...string) bool {
+	if t.Kind != JSTokenIdent {
+		return false
+	}
+	for _, w := range words {
+		if t.Text == w {
+			return true
+		}
+	}
+	return false
+}
+
+// findJSStringArrays 文字列リテラルのみで構成された配列の宣言を探す
+func findJSStringArrays(tokens []JSToken, match []int) map[string]*jsStringArray {
+	arrays := make(map[string]*jsStringArray)
+	for i := 2; i < len(tokens); i++ {
+		if !isJSPunct(tokens[i], "[") || match[i] < 0 || !isJSPunct(tokens[i-1], "=") || tokens[i-2].Kind != JSTokenIdent {
+			continue
+		}
+		values, ok := jsStringArrayValues(tokens[i+1 : match[i]])
+		if !ok || len(values) < 3 {
+			continue
+		}
+
+		// function NAME(){ var X = [...]; ... } 形式
+		if i >= 8 && isJSKeyword(tokens[i-3], "var", "let", "const") && isJSPunct(tokens[i-4], "{") &&
+			isJSPunct(tokens[i-5], ")") && isJSPunct(tokens[i-6], "(") && tokens[i-7].Kind == JSTokenIdent &&
+			isJSKeyword(tokens[i-8], "function") {
+			arrays[tokens[i-7].Text] = &jsStringArray{values: values, isFunc: true}
+			continue
+		}
+		arrays[tokens[i-2].Text] = &jsStringArray{values: values}
+	}
+	return arrays
+}
+
+func jsStringArrayValues(tokens []JSToken) ([]string, bool) {
+	var values []string
+	for k, t := range tokens {
+		if k%2 == 1 {
+			if !isJSPunct(t, ",") {
+				return nil, false
+			}
+			continue
+		}
+		if t.Kind != JSTokenString {
+			return nil, false
+		}
+		v, ok := UnquoteJSString(t.Text)
+		if !ok {
+			return nil, false
+		}
+		values = append(values, v)
+	}
+	return values, true
+}
+
+// findJSStringAccessors 文字列配列を参照し、インデックスをずらして返す関数を探す
+func findJSStringAccessors(tokens []JSToken, match []int, arrays map[string]*jsStringArray) map[string]*jsStringAccessor {
+	accessors := make(map[string]*jsStringAccessor)
+	for i := 0; i+2 < len(tokens); i++ {
+		var name string
+		var fnStart int
+		switch {
+		case isJSKeyword(tokens[i], "function") && tokens[i+1].Kind == JSTokenIdent && isJSPunct(tokens[i+2], "("):
+			name, fnStart = tokens[i+1].Text, i+2
+		case isJSKeyword(tokens[i], "var", "let", "const") && tokens[i+1].Kind == JSTokenIdent &&
+			isJSPunct(tokens[i+2], "=") && i+3 < len(tokens) && isJSKeyword(tokens[i+3], "function"):
+			name, fnStart = tokens[i+1].Text, i+4
+			if fnStart < len(tokens) && tokens[fnStart].Kind == JSTokenIdent {
+				fnStart++
+			}
+		default:
+			continue
+		}
+		if _, isArray := arrays[name]; isArray || fnStart >= len(tokens) || !isJSPunct(tokens[fnStart], "(") {
+			continue
+		}
+		paramsEnd := match[fnStart]
+		if paramsEnd < 0 || paramsEnd+1 >= len(tokens) || !isJSPunct(tokens[paramsEnd+1], "{") {
+			continue
+		}
+		bodyStart, bodyEnd := paramsEnd+1, match[paramsEnd+1]
+		if bodyEnd < 0 {
+			continue
+		}
+		body := tokens[bodyStart+1 : bodyEnd]
+
+		var array *jsStringArray
+		for _, t := range body {
+			if t.Kind == JSTokenIdent {
+				if a, ok := arrays[t.Text]; ok {
+					array = a
+					break
+				}
+			}
+		}
+		if array == nil {
+			continue
+		}
+
+		offset, ok := jsAccessorOffset(body)
+		if !ok {
+			continue
+		}
+
+		encoding := "plain"
+		for _, t := range body {
+			if t.Kind == JSTokenString {
+				if v, ok := UnquoteJSString(t.Text); ok && v == obfuscatorBase64Alphabet {
+					encoding = "base64"
+				}
+			}
+		}
+		if encoding == "base64" {
+			for _, t := range body {
+				if t.Kind == JSTokenNumber {
+					if v, ok := ParseJSNumber(t.Text); ok && v == 256 {
+						encoding = "rc4"
+						break
+					}
+				}
+			}
+		}
+
+		accessors[name] = &jsStringAccessor{array: array, offset: offset, encoding: encoding}
+	}
+	return accessors
+}
+
+// jsAccessorOffset "a = a - 0x1a2" または "a -= 0x1a2" からオフセットを取り出す
+func jsAccessorOffset(body []JSToken) (int, bool) {
+	for k := 0; k+3 < len(body); k++ {
+		if body[k].Kind != JSTokenIdent {
+			continue
+		}
+		var exprStart int
+		switch {
+		case isJSPunct(body[k+1], "=") && body[k+2].Kind == JSTokenIdent && body[k+2].Text == body[k].Text && isJSPunct(body[k+3], "-"):
+			exprStart = k + 4
+		case isJSPunct(body[k+1], "-="):
+			exprStart = k + 2
+		default:
+			continue
+		}
+		exprEnd := exprStart
+		depth := 0
+		for exprEnd < len(body) {
+			t := body[exprEnd]
+			if t.Kind == JSTokenPunct {
+				if t.Text == "(" {
+					depth++
+				} else if t.Text == ")" {
+					if depth == 0 {
+						break
+					}
+					depth--
+				} else if depth == 0 && (t.Text == ";" || t.Text == ",") {
+					break
+				}
+			} else if t.Kind != JSTokenNumber {
+				break
+			}
+			exprEnd++
+		}
+		if v, ok := evalJSArithmetic(body[exprStart:exprEnd], nil); ok && !v.isStr {
+			return int(v.num), true
+		}
+	}
+	return 0, false
+}
+
+// findJSAccessorAliases "const _0x4b = _0x5678;" のような別名を登録する
+func findJSAccessorAliases(tokens []JSToken, accessors map[string]*jsStringAccessor) {
+	for changed := true; changed; {
+		changed = false
+		for i := 1; i+3 < len(tokens); i++ {
+			if tokens[i].Kind != JSTokenIdent || !isJSPunct(tokens[i+1], "=") || tokens[i+2].Kind != JSTokenIdent {
+				continue
+			}
+			if !isJSKeyword(tokens[i-1], "var", "let", "const") && !isJSPunct(tokens[i-1], ",") {
+				continue
+			}
+			if !isJSPunct(tokens[i+3], ";") && !isJSPunct(tokens[i+3], ",") {
+				continue
+			}
+			target, ok := accessors[tokens[i+2].Text]
+			if _, exists := accessors[tokens[i].Text]; ok && !exists {
+				accessors[tokens[i].Text] = target
+				changed = true
+			}
+		}
+	}
+}
+
+// applyJSArrayRotations 配列を回転させるIIFEを検出し、同じ回転を適用する
+func applyJSArrayRotations(tokens []JSToken, match []int, arrays map[string]*jsStringArray, accessors map[string]*jsStringAccessor) bool {
+	rotated := false
+	for i := 0; i+1 < len(tokens); i++ {
+		if !isJSKeyword(tokens[i], "function") {
+			continue
+		}
+		paramsStart := i + 1
+		if tokens[paramsStart].Kind == JSTokenIdent {
+			paramsStart++
+		}
+		if paramsStart >= len(tokens) || !isJSPunct(tokens[paramsStart], "(") || match[paramsStart] < 0 {
+			continue
+		}
+		bodyStart := match[paramsStart] + 1
+		if bodyStart >= len(tokens) || !isJSPunct(tokens[bodyStart], "{") || match[bodyStart] < 0 {
+			continue
+		}
+		bodyEnd := match[bodyStart]
+		body := tokens[bodyStart+1 : bodyEnd]
+		if !jsTokensContain(body, "push") || !jsTokensContain(body, "shift") {
+			continue
+		}
+
+		// 呼び出し引数: (function(a,b){...}(ARR, N)) または (function(a,b){...})(ARR, N)
+		callStart := bodyEnd + 1
+		if callStart < len(tokens) && isJSPunct(tokens[callStart], ")") {
+			callStart++
+		}
+		if callStart+2 >= len(tokens) || !isJSPunct(tokens[callStart], "(") || match[callStart] < 0 {
+			continue
+		}
+		array, ok := arrays[tokens[callStart+1].Text]
+		if !ok || !isJSPunct(tokens[callStart+2], ",") {
+			continue
+		}
+		target, ok := evalJSArithmetic(tokens[callStart+3:match[callStart]], nil)
+		if !ok || target.isStr {
+			continue
+		}
+
+		if !jsTokensContain(body, "parseInt") {
+			// 旧来の形式: while(--n){ arr.push(arr.shift()) } を n 回
+			rotateJSStrings(array.values, int(target.num))
+			rotated = true
+			i = bodyEnd
+			continue
+		}
+
+		expr := jsChecksumExpression(body)
+		if expr == nil {
+			continue
+		}
+		lookup := func(name string, args []jsValue) (jsValue, bool) {
+			acc, ok := accessors[name]
+			if !ok || len(args) == 0 || args[0].isStr {
+				return jsValue{}, false
+			}
+			key := ""
+			if len(args) > 1 {
+				key = args[1].str
+			}
+			s, ok := acc.lookup(int(args[0].num), key)
+			return jsValue{str: s, isStr: true}, ok
+		}
+		for attempt := 0; attempt < len(array.values); attempt++ {
+			if v, ok := evalJSArithmetic(expr, lookup); ok && !v.isStr && v.num == target.num {
+				rotated = true
+				break
+			}
+			rotateJSStrings(array.values, 1)
+		}
+		i = bodyEnd
+	}
+	return rotated
+}
+
+func rotateJSStrings(values []string, n int) {
+	if len(values) == 0 {
+		return
+	}
+	n %= len(values)
+	if n < 0 {
+		n += len(values)
+	}
+	rotated := append(append([]string{}, values[n:]...), values[:n]...)
+	copy(values, rotated)
+}
+
+func jsTokensContain(tokens []JSToken, word string) bool {
+	for _, t := range tokens {
+		if t.Kind == JSTokenIdent && t.Text == word {
+			return true
+		}
+		if t.Kind == JSTokenString {
+			if v, ok := UnquoteJSString(t.Text); ok && v == word {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsChecksumExpression 回転IIFE内の parseInt(...) を含む検算式を取り出す
+func jsChecksumExpression(body []JSToken) []JSToken {
+	for k, t := range body {
+		if t.Kind != JSTokenIdent || t.Text != "parseInt" {
+			continue
+		}
+		start := k
+		for start > 0 && !isJSPunct(body[start-1], "=") {
+			start--
+		}
+		end := k
+		depth := 0
+		for end < len(body) {
+			if body[end].Kind == JSTokenPunct {
+				switch body[end].Text {
+				case "(":
+					depth++
+				case ")":
+					depth--
+				case ";":
+					if depth == 0 {
+						return body[start:end]
+					}
+				}
+				if depth < 0 {
+					return body[start:end]
+				}
+			}
+			end++
+		}
+		return body[start:end]
+	}
+	return nil
+}
+
+// lookup インデックスとキーから復号済み文字列を返す
+func (acc *jsStringAccessor) lookup(index int, key string) (string, bool) {
+	index -= acc.offset
+	if index < 0 || index >= len(acc.array.values) {
+		return "", false
+	}
+	value := acc.array.values[index]
+	switch acc.encoding {
+	case "base64":
+		return decodeObfuscatorBase64(value)
+	case "rc4":
+		decoded, ok := decodeObfuscatorBase64Bytes(value)
+		if !ok || key == "" {
+			return "", false
+		}
+		return string(rc4Decrypt(decoded, []byte(key))), true
+	}
+	return value, true
+}
+
+func decodeObfuscatorBase64Bytes(s string) ([]byte, bool) {
+	// javascript-obfuscator は小文字始まりのアルファベットを使うので標準形に並べ替える
+	const standard = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/="
+	var sb strings.Builder
+	for _, r := range s {
+		idx := strings.IndexRune(obfuscatorBase64Alphabet, r)
+		if idx < 0 {
+			return nil, false
+		}
+		if idx < 64 {
+			sb.WriteByte(standard[idx])
+		}
+	}
+	decoded, err := base64.RawStdEncoding.DecodeString(sb.String())
+	if err != nil {
+		return nil, false
+	}
+	return decoded, true
+}
+
+func decodeObfuscatorBase64(s string) (string, bool) {
+	decoded, ok := decodeObfuscatorBase64Bytes(s)
+	if !ok {
+		return "", false
+	}
+	// 元の実装は decodeURIComponent を通すため、結果はUTF-8になる
+	return string(decoded), true
+}
+
+func rc4Decrypt(data, key []byte) []byte {
+	// javascript-obfuscator の rc4 はUTF-16コード単位を扱うが、キーは通常ASCIIなのでバイト単位で十分
+	var s [256]int
+	for i := range s {
+		s[i] = i
+	}
+	j := 0
+	for i := 0; i < 256; i++ {
+		j = (j + s[i] + int(key[i%len(key)])) % 256
+		s[i], s[j] = s[j], s[i]
+	}
+	out := make([]byte, len(data))
+	i, j := 0, 0
+	for k, b := range data {
+		i = (i + 1) % 256
+		j = (j + s[i]) % 256
+		s[i], s[j] = s[j], s[i]
+		out[k] = b ^ byte(s[(s[i]+s[j])%256])
+	}
+	return out
+}
+
+// replaceJSStringLookups デコード関数呼び出しと配列参照を文字列リテラルに置き換える
+func replaceJSStringLookups(tokens []JSToken, match []int, arrays map[string]*jsStringArray, accessors map[string]*jsStringAccessor) ([]JSToken, int) {
+	out := make([]JSToken, 0, len(tokens))
+	replaced := 0
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		prevIsDot := i > 0 && (isJSPunct(tokens[i-1], ".") || isJSKeyword(tokens[i-1], "function"))
+		if t.Kind != JSTokenIdent || prevIsDot || i+1 >= len(tokens) {
+			out = append(out, t)
+			continue
+		}
+
+		// ACC(0x1a3) / ACC(0x1a3, 'key')
+		if acc, ok := accessors[t.Text]; ok && isJSPunct(tokens[i+1], "(") && match[i+1] > 0 {
+			args, ok := evalJSCallArgs(tokens[i+2 : match[i+1]])
+			if ok && len(args) >= 1 && len(args) <= 2 {
+				index, idxOK := args[0].toIndex()
+				key := ""
+				if len(args) == 2 {
+					key = args[1].str
+				}
+				if s, found := acc.lookup(index, key); idxOK && found {
+					out = append(out, JSToken{Kind: JSTokenString, Text: QuoteJSString(s, '\''), NewlineBefore: t.NewlineBefore, Line: t.Line})
+					replaced++
+					i = match[i+1]
+					continue
+				}
+			}
+		}
+
+		// ARR[0x1]（16進インデックスによる直接参照）
+		if array, ok := arrays[t.Text]; ok && !array.isFunc && isJSPunct(tokens[i+1], "[") && i+3 < len(tokens) &&
+			tokens[i+2].Kind == JSTokenNumber && strings.HasPrefix(strings.ToLower(tokens[i+2].Text), "0x") && isJSPunct(tokens[i+3], "]") {
+			if v, ok := ParseJSNumber(tokens[i+2].Text); ok && int(v) < len(array.values) {
+				out = append(out, JSToken{Kind: JSTokenString, Text: QuoteJSString(array.values[int(v)], '\''), NewlineBefore: t.NewlineBefore, Line: t.Line})
+				replaced++
+				i += 3
+				continue
+			}
+		}
+
+		out = append(out, t)
+	}
+	return out, replaced
+}
+
+// simplifyJSLiterals !![] / ![] / 16進数 / エスケープ済み文字列を読みやすい形に戻す
+func simplifyJSLiterals(tokens []JSToken) ([]JSToken, int) {
+	out := make([]JSToken, 0, len(tokens))
+	simplified := 0
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case isJSPunct(t, "!") && i+3 < len(tokens) && isJSPunct(tokens[i+1], "!") && isJSPunct(tokens[i+2], "[") && isJSPunct(tokens[i+3], "]"):
+			out = append(out, JSToken{Kind: JSTokenIdent, Text: "true", NewlineBefore: t.NewlineBefore, Line: t.Line})
+			simplified++
+			i += 3
+		case isJSPunct(t, "!") && i+2 < len(tokens) && isJSPunct(tokens[i+1], "[") && isJSPunct(tokens[i+2], "]") &&
+			(i == 0 || !isJSPunct(tokens[i-1], "!")):
+			out = append(out, JSToken{Kind: JSTokenIdent, Text: "false", NewlineBefore: t.NewlineBefore, Line: t.Line})
+			simplified++
+			i += 2
+		case t.Kind == JSTokenNumber && len(t.Text) > 2 && (t.Text[1] == 'x' || t.Text[1] == 'X') && !strings.HasSuffix(t.Text, "n"):
+			if v, ok := ParseJSNumber(t.Text); ok && v < 1<<53 {
+				t.Text = strconv.FormatInt(int64(v), 10)
+				simplified++
+			}
+			out = append(out, t)
+		case t.Kind == JSTokenString && (strings.Contains(t.Text, `\x`) || strings.Contains(t.Text, `\u`)):
+			if v, ok := UnquoteJSString(t.Text); ok {
+				t.Text = QuoteJSString(v, t.Text[0])
+				simplified++
+			}
+			out = append(out, t)
+		default:
+			out = append(out, t)
+		}
+	}
+	return out, simplified
+}
+
+// dotJSProperties obj['prop'] を obj.prop に書き換える
+func dotJSProperties(tokens []JSToken) ([]JSToken, int) {
+	out := make([]JSToken, 0, len(tokens))
+	dotted := 0
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if isJSPunct(t, "[") && i > 0 && i+2 < len(tokens) && tokens[i+1].Kind == JSTokenString && isJSPunct(tokens[i+2], "]") {
+			prev := tokens[i-1]
+			isMember := (prev.Kind == JSTokenIdent && !jsRegexPrecedingKeywords[prev.Text]) ||
+				isJSPunct(prev, ")") || isJSPunct(prev, "]") || prev.Kind == JSTokenString
+			if v, ok := UnquoteJSString(tokens[i+1].Text); ok && isMember && IsJSIdentifier(v) {
+				out = append(out,
+					JSToken{Kind: JSTokenPunct, Text: ".", Line: t.Line},
+					JSToken{Kind: JSTokenIdent, Text: v, Line: t.Line},
+				)
+				dotted++
+				i += 2
+				continue
+			}
+		}
+		out = append(out, t)
+	}
+	return out, dotted
+}
+
+// jsValue 簡易評価器の値
+type jsValue struct {
+	num   float64
+	str   string
+	isStr bool
+}
+
+func (v jsValue) toNumber() float64 {
+	if !v.isStr {
+		return v.num
+	}
+	f, ok := ParseJSNumber(strings.TrimSpace(v.str))
+	if !ok {
+		return math.NaN()
+	}
+	return f
+}
+
+func (v jsValue) toIndex() (int, bool) {
+	f := v.toNumber()
+	if math.IsNaN(f) || f != math.Trunc(f) {
+		return 0, false
+	}
+	return int(f), true
+}
+
+// jsParseInt JavaScriptの parseInt(s) と同じ規則で先頭の整数を読む
+func jsParseInt(s string) float64 {
+	s = strings.TrimLeft(s, " \t\n\r\v\f")
+	sign := 1.0
+	if strings.HasPrefix(s, "-") {
+		sign, s = -1, s[1:]
+	} else if strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+	base := 10
+	if len(s) > 1 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		base, s = 16, s[2:]
+	}
+	end := 0
+	for end < len(s) {
+		c := s[end]
+		if !(isJSDigit(c) || (base == 16 && isJSHexDigit(c))) {
+			break
+		}
+		end++
+	}
+	if end == 0 {
+		return math.NaN()
+	}
+	v, err := strconv.ParseInt(s[:end], base, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return sign * float64(v)
+}
+
+type jsCallFunc func(name string, args []jsValue) (jsValue, bool)
+
+// evalJSArithmetic 数値・文字列・四則演算・関数呼び出しのみからなる式を評価する
+func evalJSArithmetic(tokens []JSToken, call jsCallFunc) (jsValue, bool) {
+	p := &jsArithParser{tokens: tokens, call: call}
+	v, ok := p.expr()
+	if !ok || p.pos != len(tokens) {
+		return jsValue{}, false
+	}
+	return v, true
+}
+
+// evalJSCallArgs カンマ区切りの引数リストを評価する
+func evalJSCallArgs(tokens []JSToken) ([]jsValue, bool) {
+	var args []jsValue
+	start, depth := 0, 0
+	for k := 0; k <= len(tokens); k++ {
+		if k < len(tokens) && tokens[k].Kind == JSTokenPunct {
+			switch tokens[k].Text {
+			case "(", "[":
+				depth++
+			case ")", "]":
+				depth--
+			}
+		}
+		if k == len(tokens) || (depth == 0 && isJSPunct(tokens[k], ",")) {
+			v, ok := evalJSArithmetic(tokens[start:k], nil)
+			if !ok {
+				return nil, false
+			}
+			args = append(args, v)
+			start = k + 1
+		}
+	}
+	return args, true
+}
+
+type jsArithParser struct {
+	tokens []JSToken
+	pos    int
+	call   jsCallFunc
+}
+
+func (p *jsArithParser) peek(text string) bool {
+	return p.pos < len(p.tokens) && isJSPunct(p.tokens[p.pos], text)
+}
+
+func (p *jsArithParser) expr() (jsValue, bool) {
+	left, ok := p.term()
+	for ok && (p.peek("+") || p.peek("-")) {
+		op := p.tokens[p.pos].Text
+		p.pos++
+		var right jsValue
+		right, ok = p.term()
+		if op == "+" && (left.isStr || right.isStr) {
+			left = jsValue{str: jsValueString(left) + jsValueString(right), isStr: true}
+		} else if op == "+" {
+			left = jsValue{num: left.toNumber() + right.toNumber()}
+		} else {
+			left = jsValue{num: left.toNumber() - right.toNumber()}
+		}
+	}
+	return left, ok
+}
+
+func jsValueString(v jsValue) string {
+	if v.isStr {
+		return v.str
+	}
+	return strconv.FormatFloat(v.num, 'f', -1, 64)
+}
+
+func (p *jsArithParser) term() (jsValue, bool) {
+	left, ok := p.unary()
+	for ok && (p.peek("*") || p.peek("/") || p.peek("%")) {
+		op := p.tokens[p.pos].Text
+		p.pos++
+		var right jsValue
+		right, ok = p.unary()
+		a, b := left.toNumber(), right.toNumber()
+		switch op {
+		case "*":
+			left = jsValue{num: a * b}
+		case "/":
+			left = jsValue{num: a / b}
+		default:
+			left = jsValue{num: math.Mod(a, b)}
+		}
+	}
+	return left, ok
+}
+
+func (p *jsArithParser) unary() (jsValue, bool) {
+	if p.peek("-") || p.peek("+") {
+		neg := p.tokens[p.pos].Text == "-"
+		p.pos++
+		v, ok := p.unary()
+		if neg {
+			return jsValue{num: -v.toNumber()}, ok
+		}
+		return jsValue{num: v.toNumber()}, ok
+	}
+	return p.primary()
+}
+
+func (p *jsArithParser) primary() (jsValue, bool) {
+	if p.pos >= len(p.tokens) {
+		return jsValue{}, false
+	}
+	t := p.tokens[p.pos]
+	switch t.Kind {
+	case JSTokenNumber:
+		p.pos++
+		v, ok := ParseJSNumber(t.Text)
+		return jsValue{num: v}, ok
+	case JSTokenString:
+		p.pos++
+		s, ok := UnquoteJSString(t.Text)
+		return jsValue{str: s, isStr: true}, ok
+	case JSTokenPunct:
+		if t.Text != "(" {
+			return jsValue{}, false
+		}
+		p.pos++
+		v, ok := p.expr()
+		if !ok || !p.peek(")") {
+			return jsValue{}, false
+		}
+		p.pos++
+		return v, true
+	case JSTokenIdent:
+		p.pos++
+		if !p.peek("(") {
+			return jsValue{}, false
+		}
+		p.pos++
+		var args []jsValue
+		for !p.peek(")") {
+			v, ok := p.expr()
+			if !ok {
+				return jsValue{}, false
+			}
+			args = append(args, v)
+			if p.peek(",") {
+				p.pos++
+			} else if !p.peek(")") {
+				return jsValue{}, false
+			}
+		}
+		p.pos++
+		if t.Text == "parseInt" && len(args) >= 1 {
+			return jsValue{num: jsParseInt(jsValueString(args[0]))}, true
+		}
+		if p.call == nil {
+			return jsValue{}, false
+		}
+		return p.call(t.Text, args)
+	}
+	return jsValue{}, false
+}
@@ -0,0 +1,20 @@
+package services
+
+import "testing"
+
+func TestDeobfuscateJS(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`var a="\x68\x69";`, "var a = \"hi\";\n"},
+		{`a["b"]=!1;`, "a.b = !1;\n"},
+		{`a["b-c"]=1;`, "a[\"b-c\"] = 1;\n"},
+		{`if(!0){y()}`, "if (!0) {\n  y()\n}\n"},
+	}
+	for _, tt := range tests {
+		if got, _ := DeobfuscateJS(tt.src); got != tt.want {
+			t.Errorf("DeobfuscateJS(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,515 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// JSTokenKind JavaScriptトークンの種別
+type JSTokenKind int
+
+const (
+	JSTokenPunct JSTokenKind = iota
+	JSTokenIdent
+	JSTokenNumber
+	JSTokenString
+	JSTokenTemplate
+	JSTokenRegex
+	JSTokenComment
+)
+
+// JSToken JavaScriptのトークン
+type JSToken struct {
+	Kind JSTokenKind
+	Text string
+	// NewlineBefore 直前に改行があったかどうか（ASIやコメント出力に利用）
+	NewlineBefore bool
+	// Line トークン開始位置の行番号（1始まり）
+	Line int
+}
+
+// 長い記号から順に照合する
+var jsPunctuators = []string{
+	">>>=", "...", "===", "!==", "**=", "<<=", ">>=", ">>>", "&&=", "||=", "??=",
+	"=>", "==", "!=", "<=", ">=", "&&", "||", "??", "?.", "++", "--", "+=", "-=", "*=", "/=",
+	"%=", "&=", "|=", "^=", "<<", ">>", "**",
+	"{", "}", "(", ")", "[", "]", ";", ",", "<", ">", "+", "-", "*", "/", "%", "&", "|",
+	"^", "!", "~", "?", ":", "=", ".", "@", "#",
+}
+
+// 直後に正規表現リテラルが来うるキーワード
+var jsRegexPrecedingKeywords = map[string]bool{
+	"return": true, "typeof": true, "instanceof": true, "in": true, "of": true, "new": true,
+	"delete": true, "void": true, "throw": true, "case": true, "do": true, "else": true,
+	"yield": true, "await": true,
+}
+
+// TokenizeJS JavaScriptソースをトークン列に分解する
+// 構文エラーがあっても可能な限り読み進める（難読化コードの解析が目的のため）
+func TokenizeJS(src string) []JSToken {
+	var tokens []JSToken
+	line := 1
+	newline := false
+	i := 0
+	n := len(src)
+
+	for i < n {
+		c := src[i]
+
+		// 空白
+		if c == '\n' {
+			line++
+			newline = true
+			i++
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v' {
+			i++
+			continue
+		}
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(src[i:])
+			if r == '\u2028' || r == '\u2029' {
+				line++
+				newline = true
+				i += size
+				continue
+			}
+			if unicode.IsSpace(r) || r == '\uFEFF' {
+				i += size
+				continue
+			}
+		}
+
+		start := i
+		startLine := line
+		var kind JSTokenKind
+
+		switch {
+		case c == '/' && i+1 < n && src[i+1] == '/':
+			for i < n && src[i] != '\n' {
+				i++
+			}
+			kind = JSTokenComment
+		case c == '/' && i+1 < n && src[i+1] == '*':
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				i = n
+			} else {
+				i += end + 4
+			}
+			line += strings.Count(src[start:i], "\n")
+			kind = JSTokenComment
+		case c == '\'' || c == '"':
+			i = scanJSString(src, i)
+			kind = JSTokenString
+		case c == '`':
+			i = scanJSTemplate(src, i)
+			line += strings.Count(src[start:i], "\n")
+			kind = JSTokenTemplate
+		case c == '/' && jsRegexAllowed(tokens):
+			i = scanJSRegex(src, i)
+			kind = JSTokenRegex
+		case isJSDigit(c) || (c == '.' && i+1 < n && isJSDigit(src[i+1])):
+			i = scanJSNumber(src, i)
+			kind = JSTokenNumber
+		case isJSIdentStart(src, i):
+			for i < n && isJSIdentPart(src, i) {
+				if src[i] == '\\' {
+					i += 2
+					continue
+				}
+				_, size := utf8.DecodeRuneInString(src[i:])
+				i += size
+			}
+			kind = JSTokenIdent
+		default:
+			kind = JSTokenPunct
+			matched := false
+			for _, p := range jsPunctuators {
+				if strings.HasPrefix(src[i:], p) {
+					i += len(p)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				_, size := utf8.DecodeRuneInString(src[i:])
+				i += size
+			}
+		}
+
+		tokens = append(tokens, JSToken{
+			Kind:          kind,
+			Text:          src[start:i],
+			NewlineBefore: newline,
+			Line:          startLine,
+		})
+		newline = false
+	}
+
+	return tokens
+}
+
+func scanJSString(src string, i int) int {
+	quote := src[i]
+	i++
+	for i < len(src) {
+		switch src[i] {
+		case '\\':
+			i += 2
+			continue
+		case quote:
+			return i + 1
+		case '\n':
+			// 閉じられていない文字列は行末で打ち切る
+			return i
+		}
+		i++
+	}
+	return len(src)
+}
+
+func scanJSTemplate(src string, i int) int {
+	i++
+	for i < len(src) {
+		switch src[i] {
+		case '\\':
+			i += 2
+			continue
+		case '`':
+			return i + 1
+		case '$':
+			if i+1 < len(src) && src[i+1] == '{' {
+				i = scanJSTemplateExpr(src, i+2)
+				continue
+			}
+		}
+		i++
+	}
+	return len(src)
+}
+
+// scanJSTemplateExpr テンプレートリテラル内の ${...} を読み飛ばす
+func scanJSTemplateExpr(src string, i int) int {
+	depth := 1
+	for i < len(src) {
+		switch src[i] {
+		case '\'', '"':
+			i = scanJSString(src, i)
+			continue
+		case '`':
+			i = scanJSTemplate(src, i)
+			continue
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+		i++
+	}
+	return len(src)
+}
+
+func scanJSRegex(src string, i int) int {
+	i++
+	inClass := false
+	for i < len(src) {
+		switch src[i] {
+		case '\\':
+			i += 2
+			continue
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '\n':
+			return i
+		case '/':
+			if !inClass {
+				i++
+				for i < len(src) && isJSIdentPart(src, i) {
+					i++
+				}
+				return i
+			}
+		}
+		i++
+	}
+	return len(src)
+}
+
+func scanJSNumber(src string, i int) int {
+	if src[i] == '0' && i+1 < len(src) && strings.ContainsRune("xXoObB", rune(src[i+1])) {
+		i += 2
+		for i < len(src) && (isJSHexDigit(src[i]) || src[i] == '_') {
+			i++
+		}
+	} else {
+		for i < len(src) && (isJSDigit(src[i]) || src[i] == '.' || src[i] == '_') {
+			i++
+		}
+		if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+			i++
+			if i < len(src) && (src[i] == '+' || src[i] == '-') {
+				i++
+			}
+			for i < len(src) && isJSDigit(src[i]) {
+				i++
+			}
+		}
+	}
+	if i < len(src) && src[i] == 'n' {
+		i++
+	}
+	return i
+}
+
+// jsRegexAllowed 直前のトークンから "/" が正規表現の開始かどうかを判定
+func jsRegexAllowed(tokens []JSToken) bool {
+	for k := len(tokens) - 1; k >= 0; k-- {
+		t := tokens[k]
+		switch t.Kind {
+		case JSTokenComment:
+			continue
+		case JSTokenIdent:
+			return jsRegexPrecedingKeywords[t.Text]
+		case JSTokenNumber, JSTokenString, JSTokenTemplate, JSTokenRegex:
+			return false
+		default:
+			return t.Text != ")" && t.Text != "]" && t.Text != "++" && t.Text != "--"
+		}
+	}
+	return true
+}
+
+func isJSDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isJSHexDigit(c byte) bool {
+	return isJSDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isJSIdentStart(src string, i int) bool {
+	c := src[i]
+	if c == '$' || c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+		return true
+	}
+	if c == '\\' {
+		// \u0041 のようなエスケープ。末尾に残った \ は区切り記号として扱う
+		return i+1 < len(src)
+	}
+	if c >= utf8.RuneSelf {
+		r, _ := utf8.DecodeRuneInString(src[i:])
+		return unicode.IsLetter(r)
+	}
+	return false
+}
+
+func isJSIdentPart(src string, i int) bool {
+	if isJSIdentStart(src, i) || isJSDigit(src[i]) {
+		return true
+	}
+	if src[i] >= utf8.RuneSelf {
+		r, _ := utf8.DecodeRuneInString(src[i:])
+		return unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Mc, r)
+	}
+	return false
+}
+
+// IsJSIdentifier 文字列がそのまま識別子として使えるかを判定
+func IsJSIdentifier(s string) bool {
+	if s == "" || !isJSIdentStart(s, 0) || s[0] == '\\' {
+		return false
+	}
+	for i := 0; i < len(s); {
+		if !isJSIdentPart(s, i) || s[i] == '\\' {
+			return false
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return true
+}
+
+// UnquoteJSString JavaScriptの文字列リテラル（引用符付き）をデコードする
+func UnquoteJSString(lit string) (string, bool) {
+	if len(lit) < 2 {
+		return "", false
+	}
+	quote := lit[0]
+	if (quote != '\'' && quote != '"' && quote != '`') || lit[len(lit)-1] != quote {
+		return "", false
+	}
+	body := lit[1 : len(lit)-1]
+	if quote == '`' && strings.Contains(body, "${") {
+		return "", false
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c != '\\' {
+			sb.WriteByte(c)
+			continue
+		}
+		i++
+		if i >= len(body) {
+			return "", false
+		}
+		switch e := body[i]; e {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'v':
+			sb.WriteByte('\v')
+		case '0':
+			sb.WriteByte(0)
+		case '\n':
+			// 行継続
+		case '\r':
+			if i+1 < len(body) && body[i+1] == '\n' {
+				i++
+			}
+		case 'x':
+			if i+3 > len(body) {
+				return "", false
+			}
+			v, err := strconv.ParseUint(body[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", false
+			}
+			sb.WriteRune(rune(v))
+			i += 2
+		case 'u':
+			var hex string
+			if i+1 < len(body) && body[i+1] == '{' {
+				end := strings.IndexByte(body[i:], '}')
+				if end < 0 {
+					return "", false
+				}
+				hex = body[i+2 : i+end]
+				i += end
+			} else {
+				if i+5 > len(body) {
+					return "", false
+				}
+				hex = body[i+1 : i+5]
+				i += 4
+			}
+			v, err := strconv.ParseUint(hex, 16, 32)
+			if err != nil {
+				return "", false
+			}
+			r := rune(v)
+			// サロゲートペアの結合
+			if r >= 0xD800 && r < 0xDC00 && i+6 < len(body) && body[i+1] == '\\' && body[i+2] == 'u' {
+				if lo, err := strconv.ParseUint(body[i+3:i+7], 16, 32); err == nil && lo >= 0xDC00 && lo < 0xE000 {
+					r = (r-0xD800)<<10 + (rune(lo) - 0xDC00) + 0x10000
+					i += 6
+				}
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte(e)
+		}
+	}
+	return sb.String(), true
+}
+
+// QuoteJSString 文字列を読みやすいJavaScript文字列リテラルに変換する
+func QuoteJSString(s string, quote byte) string {
+	var sb strings.Builder
+	sb.WriteByte(quote)
+	for _, r := range s {
+		switch {
+		case r == rune(quote) || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r == utf8.RuneError:
+			sb.WriteString(`\ufffd`)
+		case r < 0x20 || r == 0x7f || r == '\u2028' || r == '\u2029':
+			sb.WriteString(`\u`)
+			sb.WriteString(strings.Repeat("0", 4-len(strconv.FormatInt(int64(r), 16))))
+			sb.WriteString(strconv.FormatInt(int64(r), 16))
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte(quote)
+	return sb.String()
+}
+
+// ParseJSNumber 数値リテラルを評価する
+func ParseJSNumber(text string) (float64, bool) {
+	text = strings.ReplaceAll(strings.TrimSuffix(text, "n"), "_", "")
+	if len(text) > 2 && text[0] == '0' {
+		base := 0
+		switch text[1] {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 0 {
+			v, err := strconv.ParseUint(text[2:], base, 64)
+			if err != nil {
+				return 0, false
+			}
+			return float64(v), true
+		}
+	}
+	v, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// matchJSBrackets 対応する括弧のインデックス表を作成する
+func matchJSBrackets(tokens []JSToken) []int {
+	match := make([]int, len(tokens))
+	for i := range match {
+		match[i] = -1
+	}
+	var stack []int
+	for i, t := range tokens {
+		if t.Kind != JSTokenPunct {
+			continue
+		}
+		switch t.Text {
+		case "(", "[", "{":
+			stack = append(stack, i)
+		case ")", "]", "}":
+			if len(stack) == 0 {
+				continue
+			}
+			open := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			match[open] = i
+			match[i] = open
+		}
+	}
+	return match
+}
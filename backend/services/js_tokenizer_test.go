@@ -0,0 +1,156 @@
+package services
+
+import "testing"
+
+func TestTokenizeJS(t *testing.T) {
+	type tok struct {
+		kind JSTokenKind
+		text string
+	}
+	tests := []struct {
+		name string
+		src  string
+		want []tok
+	}{
+		{
+			name: "statement",
+			src:  "var a = 0x1F + b;",
+			want: []tok{{JSTokenIdent, "var"}, {JSTokenIdent, "a"}, {JSTokenPunct, "="}, {JSTokenNumber, "0x1F"}, {JSTokenPunct, "+"}, {JSTokenIdent, "b"}, {JSTokenPunct, ";"}},
+		},
+		{
+			name: "longest punctuator",
+			src:  "a >>>= b ?? c?.d",
+			want: []tok{{JSTokenIdent, "a"}, {JSTokenPunct, ">>>="}, {JSTokenIdent, "b"}, {JSTokenPunct, "??"}, {JSTokenIdent, "c"}, {JSTokenPunct, "?."}, {JSTokenIdent, "d"}},
+		},
+		{
+			name: "division",
+			src:  "a / b / c",
+			want: []tok{{JSTokenIdent, "a"}, {JSTokenPunct, "/"}, {JSTokenIdent, "b"}, {JSTokenPunct, "/"}, {JSTokenIdent, "c"}},
+		},
+		{
+			name: "regex after return",
+			src:  `return /a\/[/]b/gi.test(x)`,
+			want: []tok{{JSTokenIdent, "return"}, {JSTokenRegex, `/a\/[/]b/gi`}, {JSTokenPunct, "."}, {JSTokenIdent, "test"}, {JSTokenPunct, "("}, {JSTokenIdent, "x"}, {JSTokenPunct, ")"}},
+		},
+		{
+			name: "strings and comments",
+			src:  `'it\'s' /* c */ "x" // tail`,
+			want: []tok{{JSTokenString, `'it\'s'`}, {JSTokenComment, "/* c */"}, {JSTokenString, `"x"`}, {JSTokenComment, "// tail"}},
+		},
+		{
+			name: "template with nested expression",
+			src:  "`a${ {b: `c`}.b }d` + 1",
+			want: []tok{{JSTokenTemplate, "`a${ {b: `c`}.b }d`"}, {JSTokenPunct, "+"}, {JSTokenNumber, "1"}},
+		},
+		{
+			name: "unicode escape identifier",
+			src:  `\u0061bc = 1`,
+			want: []tok{{JSTokenIdent, `\u0061bc`}, {JSTokenPunct, "="}, {JSTokenNumber, "1"}},
+		},
+		{
+			name: "unterminated string stops at newline",
+			src:  "'abc\nx",
+			want: []tok{{JSTokenString, "'abc"}, {JSTokenIdent, "x"}},
+		},
+		// 末尾の \ で範囲外を読まない
+		{
+			name: "identifier ending in backslash",
+			src:  `a\`,
+			want: []tok{{JSTokenIdent, "a"}, {JSTokenPunct, `\`}},
+		},
+		{
+			name: "lone backslash",
+			src:  `\`,
+			want: []tok{{JSTokenPunct, `\`}},
+		},
+		{
+			name: "string ending in backslash",
+			src:  `"a\`,
+			want: []tok{{JSTokenString, `"a\`}},
+		},
+		{
+			name: "template ending in backslash",
+			src:  "`a\\",
+			want: []tok{{JSTokenTemplate, "`a\\"}},
+		},
+		{
+			name: "regex ending in backslash",
+			src:  `x = /a\`,
+			want: []tok{{JSTokenIdent, "x"}, {JSTokenPunct, "="}, {JSTokenRegex, `/a\`}},
+		},
+		{
+			name: "unterminated block comment",
+			src:  "a /* b",
+			want: []tok{{JSTokenIdent, "a"}, {JSTokenComment, "/* b"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := TokenizeJS(tt.src)
+			got := make([]tok, len(tokens))
+			for i, token := range tokens {
+				got[i] = tok{token.Kind, token.Text}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("TokenizeJS(%q) = %v, want %v", tt.src, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("TokenizeJS(%q)[%d] = %v, want %v", tt.src, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTokenizeJSLines(t *testing.T) {
+	tokens := TokenizeJS("a\n/* x\ny */ b\n`c\nd` e")
+	want := []struct {
+		line    int
+		newline bool
+	}{{1, false}, {2, true}, {3, false}, {4, true}, {5, false}}
+	if len(tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(tokens), len(want))
+	}
+	for i, w := range want {
+		if tokens[i].Line != w.line || tokens[i].NewlineBefore != w.newline {
+			t.Errorf("token %q: line %d newline %v, want line %d newline %v", tokens[i].Text, tokens[i].Line, tokens[i].NewlineBefore, w.line, w.newline)
+		}
+	}
+}
+
+func TestUnquoteJSString(t *testing.T) {
+	tests := []struct {
+		lit  string
+		want string
+		ok   bool
+	}{
+		{`'abc'`, "abc", true},
+		{`"a\nb\tc"`, "a\nb\tc", true},
+		{`'\x41B\u{43}'`, "ABC", true},
+		{`'\uD83D\uDE00'`, "\U0001F600", true},
+		{"`plain`", "plain", true},
+		{"`a${b}`", "", false},
+		{`'a`, "", false},
+		{`'`, "", false},
+		{`'\'`, "", false},
+		{`'\x4'`, "", false},
+		{`'\u12'`, "", false},
+		{`'\u{41'`, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := UnquoteJSString(tt.lit)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("UnquoteJSString(%q) = %q, %v, want %q, %v", tt.lit, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestQuoteJSStringRoundTrip(t *testing.T) {
+	for _, s := range []string{"", "plain", "it's", "a\nb\r\tc\\", "\x00\x1f ", "日本語"} {
+		got, ok := UnquoteJSString(QuoteJSString(s, '\''))
+		if !ok || got != s {
+			t.Errorf("round trip of %q = %q, %v", s, got, ok)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// unrecognizedLicense 本文がコーパスのどれにも一致しなかったライセンスファイル
+const unrecognizedLicense = "LicenseRef-unrecognized"
+
+// licenseSourceLanguages ライセンスの記載が無いことを問題とするソースコードの言語
+var licenseSourceLanguages = map[string]bool{
+	"go": true, "javascript": true, "typescript": true, "python": true, "java": true, "c": true, "cpp": true,
+	"csharp": true, "php": true, "ruby": true, "rust": true, "swift": true, "kotlin": true, "scala": true,
+	"shell": true, "powershell": true, "protobuf": true,
+}
+
+// LicenseFileResult ファイルごとのライセンスの検出結果
+type LicenseFileResult struct {
+	FileID        uint           `json:"file_id"`
+	Name          string         `json:"name"`
+	Language      string         `json:"language"`
+	LicenseFile   bool           `json:"license_file"`
+	Headers       []SPDXHeader   `json:"headers,omitempty"`
+	Matches       []LicenseMatch `json:"matches,omitempty"`
+	Licenses      []string       `json:"licenses"`                 // ファイルに適用されるライセンス
+	InheritedFrom string         `json:"inherited_from,omitempty"` // ファイル自身に記載が無く、上位のディレクトリのライセンスファイルを適用した場合
+	Copyleft      bool           `json:"copyleft"`
+	Conflicts     []string       `json:"conflicts,omitempty"`
+	Missing       bool           `json:"missing"`
+}
+
+// runLicenseScan ライセンスファイル・SPDX ヘッダー・本文中のライセンス文を探し、プロジェクトのライセンスとの両立を調べる
+// ルートのディレクトリにあるライセンスファイルをプロジェクトのライセンスとし、記載の無いファイルには最も近い上位のディレクトリのライセンスファイルを適用する
+func (w *AnalysisWorker) runLicenseScan(files []models.File) (string, error) {
+	sorted := make([]models.File, len(files))
+	copy(sorted, files)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var results []*LicenseFileResult
+	licensesByDir := make(map[string][]string)
+	licenseFileByDir := make(map[string]string)
+	for _, file := range sorted {
+		if file.Content == "" {
+			continue
+		}
+		result := &LicenseFileResult{
+			FileID:      file.ID,
+			Name:        file.Name,
+			Language:    file.Language,
+			LicenseFile: IsLicenseFile(file.Name, file.Language),
+			Headers:     FindSPDXHeaders(file.Content),
+			Matches:     MatchLicenseTexts(file.Content),
+			Licenses:    []string{},
+		}
+		for _, h := range result.Headers {
+			for _, id := range h.Licenses {
+				if !containsString(result.Licenses, id) {
+					result.Licenses = append(result.Licenses, id)
+				}
+			}
+		}
+		for _, m := range result.Matches {
+			if !containsString(result.Licenses, m.License) {
+				result.Licenses = append(result.Licenses, m.License)
+			}
+		}
+		if result.LicenseFile {
+			if len(result.Licenses) == 0 {
+				result.Licenses = append(result.Licenses, unrecognizedLicense)
+			}
+			dir := licenseDir(file.Name)
+			for _, id := range result.Licenses {
+				if !containsString(licensesByDir[dir], id) {
+					licensesByDir[dir] = append(licensesByDir[dir], id)
+				}
+			}
+			if licenseFileByDir[dir] == "" {
+				licenseFileByDir[dir] = file.Name
+			}
+		}
+		results = append(results, result)
+	}
+
+	projectLicenses := licensesByDir["."]
+	if projectLicenses == nil {
+		projectLicenses = []string{}
+	}
+
+	licenseCounts := make(map[string]int)
+	categoryCounts := make(map[string]int)
+	copyleft := make(map[string][]string)
+	conflicts := []map[string]interface{}{}
+	missing := []map[string]interface{}{}
+	var reported []*LicenseFileResult
+	for _, result := range results {
+		// ヘッダーの宣言と本文のライセンスが食い違っていないか
+		declared := map[string]bool{}
+		for _, h := range result.Headers {
+			for _, id := range h.Licenses {
+				declared[id] = true
+			}
+		}
+		if len(declared) > 0 {
+			for _, m := range result.Matches {
+				if !declared[m.License] && !sameLicenseFamily(declared, m.License) {
+					result.Conflicts = append(result.Conflicts, "SPDX header declares "+strings.Join(sortedKeys(declared), ", ")+" but the file contains "+m.License+" text")
+				}
+			}
+		}
+
+		own := len(result.Licenses) > 0
+		if !own && !result.LicenseFile {
+			for dir := licenseDir(result.Name); ; dir = path.Dir(dir) {
+				if ids, ok := licensesByDir[dir]; ok {
+					result.Licenses = append(result.Licenses, ids...)
+					result.InheritedFrom = licenseFileByDir[dir]
+					break
+				}
+				if dir == "." || dir == "/" {
+					break
+				}
+			}
+		}
+		if len(result.Licenses) == 0 {
+			result.Missing = licenseSourceLanguages[result.Language]
+			if result.Missing {
+				missing = append(missing, map[string]interface{}{"file_id": result.FileID, "name": result.Name})
+			}
+			continue
+		}
+
+		// ルートのライセンスファイル自身とそれを引き継いだファイルはプロジェクトのライセンスそのもの
+		rootLicense := result.LicenseFile && licenseDir(result.Name) == "." || result.InheritedFrom != "" && result.InheritedFrom == licenseFileByDir["."]
+		if !rootLicense {
+			result.Conflicts = append(result.Conflicts, projectLicenseConflicts(projectLicenses, result)...)
+		}
+		for _, id := range result.Licenses {
+			if IsCopyleft(id) {
+				result.Copyleft = true
+				copyleft[id] = append(copyleft[id], result.Name)
+			}
+		}
+		if own {
+			for _, id := range result.Licenses {
+				licenseCounts[id]++
+				categoryCounts[LicenseCategory(id)]++
+			}
+		}
+		if len(result.Conflicts) > 0 {
+			conflicts = append(conflicts, map[string]interface{}{
+				"file_id":  result.FileID,
+				"name":     result.Name,
+				"licenses": result.Licenses,
+				"reasons":  result.Conflicts,
+			})
+		}
+		if own || result.Copyleft || len(result.Conflicts) > 0 {
+			reported = append(reported, result)
+		}
+	}
+
+	copyleftReport := []map[string]interface{}{}
+	for _, id := range sortedKeys(copyleft) {
+		copyleftReport = append(copyleftReport, map[string]interface{}{
+			"license":  id,
+			"category": LicenseCategory(id),
+			"files":    copyleft[id],
+		})
+	}
+	var licenseFiles []string
+	for _, result := range results {
+		if result.LicenseFile {
+			licenseFiles = append(licenseFiles, result.Name)
+		}
+	}
+	if reported == nil {
+		reported = []*LicenseFileResult{}
+	}
+	if licenseFiles == nil {
+		licenseFiles = []string{}
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"project_licenses": projectLicenses,
+		"license_files":    licenseFiles,
+		"files":            reported,
+		"copyleft":         copyleftReport,
+		"conflicts":        conflicts,
+		"missing":          missing,
+		"summary": map[string]interface{}{
+			"files_scanned":       len(results),
+			"license_files":       len(licenseFiles),
+			"project_license":     strings.Join(projectLicenses, ", "),
+			"no_project_license":  len(projectLicenses) == 0,
+			"licenses":            licenseCounts,
+			"categories":          categoryCounts,
+			"copyleft_licenses":   len(copyleft),
+			"files_with_conflict": len(conflicts),
+			"files_missing":       len(missing),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// projectLicenseConflicts ファイルのライセンスがプロジェクトのライセンスのいずれとも両立しない理由
+// SPDX の OR で選べる場合は、どれか1つが両立すれば問題としない
+func projectLicenseConflicts(projectLicenses []string, result *LicenseFileResult) []string {
+	if len(projectLicenses) == 0 {
+		return nil
+	}
+	choice := false
+	for _, h := range result.Headers {
+		if strings.Contains(strings.ToUpper(h.Expression), " OR ") {
+			choice = true
+		}
+	}
+	var reasons []string
+	compatible := false
+	for _, id := range result.Licenses {
+		var reason string
+		for _, project := range projectLicenses {
+			if reason = licenseConflict(project, id); reason == "" {
+				break
+			}
+		}
+		if reason == "" {
+			compatible = true
+		} else if !containsString(reasons, reason) {
+			reasons = append(reasons, reason)
+		}
+	}
+	if choice && compatible {
+		return nil
+	}
+	return reasons
+}
+
+// sameLicenseFamily ヘッダーの GPL-2.0-or-later と本文の GPL-2.0-only のように、版の指定だけが違うか
+func sameLicenseFamily(declared map[string]bool, id string) bool {
+	family, version, _ := licenseFamily(id)
+	for d := range declared {
+		if f, v, _ := licenseFamily(d); f == family && v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// licenseDir ファイル名のディレクトリ部分（区切りは / にそろえる）
+func licenseDir(name string) string {
+	return path.Dir(strings.ReplaceAll(name, "\\", "/"))
+}
@@ -0,0 +1,410 @@
+package services
+
+import (
+	"embed"
+	"hash/fnv"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// licenseTexts SPDX のライセンス本文と、ソースファイルの先頭に書く定型の通知文（*.notice.txt）
+//
+//go:embed licenses/*.txt
+var licenseTexts embed.FS
+
+// licenseShingleSize 本文の類似度を測る単語 n-gram の長さ
+const licenseShingleSize = 3
+
+// licenseMatchThreshold テンプレートの n-gram のうちこの割合以上が含まれていれば一致とみなす
+const licenseMatchThreshold = 0.8
+
+// licenseMinShingles 一致とみなすのに必要な n-gram の最小数（短すぎる断片での誤検出を避ける）
+const licenseMinShingles = 20
+
+// LicenseInfo ライセンスの名前と分類
+type LicenseInfo struct {
+	Name     string `json:"name"`
+	Category string `json:"category"` // permissive, public_domain, weak_copyleft, strong_copyleft, network_copyleft, unknown
+}
+
+// licenseInfos 分類が分かっている SPDX ライセンス
+var licenseInfos = map[string]LicenseInfo{
+	"MIT":               {"MIT License", "permissive"},
+	"BSD-1-Clause":      {"BSD 1-Clause License", "permissive"},
+	"BSD-2-Clause":      {"BSD 2-Clause \"Simplified\" License", "permissive"},
+	"BSD-3-Clause":      {"BSD 3-Clause \"New\" or \"Revised\" License", "permissive"},
+	"0BSD":              {"BSD Zero Clause License", "permissive"},
+	"ISC":               {"ISC License", "permissive"},
+	"Apache-2.0":        {"Apache License 2.0", "permissive"},
+	"Zlib":              {"zlib License", "permissive"},
+	"BSL-1.0":           {"Boost Software License 1.0", "permissive"},
+	"Python-2.0":        {"Python License 2.0", "permissive"},
+	"PostgreSQL":        {"PostgreSQL License", "permissive"},
+	"X11":               {"X11 License", "permissive"},
+	"Unlicense":         {"The Unlicense", "public_domain"},
+	"CC0-1.0":           {"Creative Commons Zero v1.0 Universal", "public_domain"},
+	"WTFPL":             {"Do What The F*ck You Want To Public License", "public_domain"},
+	"LGPL-2.0-only":     {"GNU Library General Public License v2 only", "weak_copyleft"},
+	"LGPL-2.0-or-later": {"GNU Library General Public License v2 or later", "weak_copyleft"},
+	"LGPL-2.1-only":     {"GNU Lesser General Public License v2.1 only", "weak_copyleft"},
+	"LGPL-2.1-or-later": {"GNU Lesser General Public License v2.1 or later", "weak_copyleft"},
+	"LGPL-3.0-only":     {"GNU Lesser General Public License v3.0 only", "weak_copyleft"},
+	"LGPL-3.0-or-later": {"GNU Lesser General Public License v3.0 or later", "weak_copyleft"},
+	"MPL-1.1":           {"Mozilla Public License 1.1", "weak_copyleft"},
+	"MPL-2.0":           {"Mozilla Public License 2.0", "weak_copyleft"},
+	"EPL-1.0":           {"Eclipse Public License 1.0", "weak_copyleft"},
+	"EPL-2.0":           {"Eclipse Public License 2.0", "weak_copyleft"},
+	"CDDL-1.0":          {"Common Development and Distribution License 1.0", "weak_copyleft"},
+	"CDDL-1.1":          {"Common Development and Distribution License 1.1", "weak_copyleft"},
+	"GPL-2.0-only":      {"GNU General Public License v2.0 only", "strong_copyleft"},
+	"GPL-2.0-or-later":  {"GNU General Public License v2.0 or later", "strong_copyleft"},
+	"GPL-3.0-only":      {"GNU General Public License v3.0 only", "strong_copyleft"},
+	"GPL-3.0-or-later":  {"GNU General Public License v3.0 or later", "strong_copyleft"},
+	"AGPL-3.0-only":     {"GNU Affero General Public License v3.0 only", "network_copyleft"},
+	"AGPL-3.0-or-later": {"GNU Affero General Public License v3.0 or later", "network_copyleft"},
+	"SSPL-1.0":          {"Server Side Public License v1", "network_copyleft"},
+}
+
+// deprecatedLicenseIDs 廃止された SPDX ID と現在の ID
+var deprecatedLicenseIDs = map[string]string{
+	"GPL-2.0": "GPL-2.0-only", "GPL-2.0+": "GPL-2.0-or-later",
+	"GPL-3.0": "GPL-3.0-only", "GPL-3.0+": "GPL-3.0-or-later",
+	"LGPL-2.0": "LGPL-2.0-only", "LGPL-2.0+": "LGPL-2.0-or-later",
+	"LGPL-2.1": "LGPL-2.1-only", "LGPL-2.1+": "LGPL-2.1-or-later",
+	"LGPL-3.0": "LGPL-3.0-only", "LGPL-3.0+": "LGPL-3.0-or-later",
+	"AGPL-3.0": "AGPL-3.0-only", "AGPL-3.0+": "AGPL-3.0-or-later",
+}
+
+// LicenseCategory ライセンスの分類（知らないライセンスは unknown）
+func LicenseCategory(id string) string {
+	if info, ok := licenseInfos[id]; ok {
+		return info.Category
+	}
+	return "unknown"
+}
+
+// IsCopyleft 派生物に同じライセンスを求める（弱いものを含む）コピーレフトのライセンスか
+func IsCopyleft(id string) bool {
+	switch LicenseCategory(id) {
+	case "weak_copyleft", "strong_copyleft", "network_copyleft":
+		return true
+	}
+	return false
+}
+
+// LicenseMatch ファイルの中で見つけたライセンス
+type LicenseMatch struct {
+	License   string  `json:"license"`
+	Kind      string  `json:"kind"`            // spdx_header, text（本文）, notice（定型の通知文）
+	Score     float64 `json:"score,omitempty"` // テンプレートの n-gram が含まれていた割合
+	StartLine int     `json:"start_line"`
+	EndLine   int     `json:"end_line"`
+}
+
+// licenseTemplate 類似度の計算用に n-gram にしたライセンス本文
+type licenseTemplate struct {
+	id       string
+	notice   bool
+	shingles map[uint64]bool
+}
+
+// licenseCorpus 同梱のライセンス本文と、n-gram からテンプレートを引く索引
+var licenseCorpus = loadLicenseCorpus()
+
+type licenseCorpusIndex struct {
+	templates []licenseTemplate
+	index     map[uint64][]int
+}
+
+func loadLicenseCorpus() *licenseCorpusIndex {
+	corpus := &licenseCorpusIndex{index: make(map[uint64][]int)}
+	entries, _ := licenseTexts.ReadDir("licenses")
+	for _, entry := range entries {
+		data, err := licenseTexts.ReadFile("licenses/" + entry.Name())
+		if err != nil {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ".txt")
+		id := strings.TrimSuffix(name, ".notice")
+		t := licenseTemplate{id: id, notice: id != name, shingles: make(map[uint64]bool)}
+		tokens := licenseTokens(string(data))
+		for i := 0; i+licenseShingleSize <= len(tokens); i++ {
+			t.shingles[licenseShingle(tokens[i:i+licenseShingleSize])] = true
+		}
+		for h := range t.shingles {
+			corpus.index[h] = append(corpus.index[h], len(corpus.templates))
+		}
+		corpus.templates = append(corpus.templates, t)
+	}
+	return corpus
+}
+
+// licenseToken 正規化した単語と、その単語があった行
+type licenseToken struct {
+	word string
+	line int
+}
+
+var (
+	licenseWordPattern = regexp.MustCompile(`[a-z0-9]+`)
+	// licenseCopyrightLine 著作権者の行は本文ごとに違うので比べない
+	licenseCopyrightLine = regexp.MustCompile(`^[^a-z0-9]*(copyright\s*(\(c\)|©|[0-9<])|\(c\)\s*[0-9]|©)`)
+)
+
+// licenseWordVariants 綴りの揺れをそろえる
+var licenseWordVariants = map[string]string{
+	"licence": "license", "licences": "licenses", "licenced": "licensed", "sublicence": "sublicense",
+	"licencing": "licensing", "https": "http",
+}
+
+// licenseTokens コメント記号・句読点・大文字小文字・著作権者の行を無視して単語に分ける
+func licenseTokens(text string) []licenseToken {
+	var tokens []licenseToken
+	for i, line := range strings.Split(strings.ToLower(text), "\n") {
+		if licenseCopyrightLine.MatchString(line) {
+			continue
+		}
+		line = strings.ReplaceAll(line, "&", " and ")
+		for _, word := range licenseWordPattern.FindAllString(line, -1) {
+			if v, ok := licenseWordVariants[word]; ok {
+				word = v
+			}
+			tokens = append(tokens, licenseToken{word: word, line: i + 1})
+		}
+	}
+	return tokens
+}
+
+func licenseShingle(tokens []licenseToken) uint64 {
+	h := fnv.New64a()
+	for _, t := range tokens {
+		h.Write([]byte(t.word))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// MatchLicenseTexts ファイルの本文に含まれるライセンス本文・通知文を同梱のコーパスとの類似度で探す
+// 同じ箇所に複数のテンプレートが当てはまるとき（BSD-2-Clause と BSD-3-Clause、本文とその中の通知文の例など）は、
+// より多くの n-gram が一致した方だけを残す
+func MatchLicenseTexts(content string) []LicenseMatch {
+	tokens := licenseTokens(content)
+	if len(tokens) < licenseShingleSize {
+		return nil
+	}
+
+	type candidate struct {
+		template    int
+		hits        map[uint64]bool
+		first, last int
+	}
+	candidates := make(map[int]*candidate)
+	for i := 0; i+licenseShingleSize <= len(tokens); i++ {
+		h := licenseShingle(tokens[i : i+licenseShingleSize])
+		for _, t := range licenseCorpus.index[h] {
+			c := candidates[t]
+			if c == nil {
+				c = &candidate{template: t, hits: make(map[uint64]bool), first: i}
+				candidates[t] = c
+			}
+			if !c.hits[h] {
+				c.hits[h] = true
+				c.last = i + licenseShingleSize - 1
+			}
+		}
+	}
+
+	type scored struct {
+		*candidate
+		score float64
+	}
+	var matches []scored
+	for _, c := range candidates {
+		t := licenseCorpus.templates[c.template]
+		score := float64(len(c.hits)) / float64(len(t.shingles))
+		if score >= licenseMatchThreshold && len(c.hits) >= licenseMinShingles {
+			matches = append(matches, scored{candidate: c, score: score})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		wi, wj := matches[i].score*float64(len(matches[i].hits)), matches[j].score*float64(len(matches[j].hits))
+		if wi != wj {
+			return wi > wj
+		}
+		return licenseCorpus.templates[matches[i].template].id < licenseCorpus.templates[matches[j].template].id
+	})
+
+	claimed := make(map[uint64]bool)
+	var results []LicenseMatch
+	for _, m := range matches {
+		fresh := 0
+		for h := range m.hits {
+			if !claimed[h] {
+				fresh++
+			}
+		}
+		if float64(fresh) < float64(len(m.hits))/2 {
+			continue
+		}
+		for h := range m.hits {
+			claimed[h] = true
+		}
+		t := licenseCorpus.templates[m.template]
+		kind := "text"
+		if t.notice {
+			kind = "notice"
+		}
+		results = append(results, LicenseMatch{
+			License:   t.id,
+			Kind:      kind,
+			Score:     roundMetric(m.score),
+			StartLine: tokens[m.first].line,
+			EndLine:   tokens[m.last].line,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].StartLine < results[j].StartLine })
+	return results
+}
+
+// spdxHeaderPattern SPDX-License-Identifier の行（コメントの閉じ記号の手前まで）
+var spdxHeaderPattern = regexp.MustCompile(`SPDX-License-Identifier:[ \t]*([^\r\n]*?)[ \t]*(?:\*/|-->|#\}|\r?$)`)
+
+// SPDXHeader ファイルに書かれた SPDX-License-Identifier
+type SPDXHeader struct {
+	Expression string   `json:"expression"`
+	Licenses   []string `json:"licenses"`
+	Line       int      `json:"line"`
+}
+
+// FindSPDXHeaders SPDX-License-Identifier の式を読み、含まれるライセンス ID を取り出す（廃止された ID は現在の ID にする）
+func FindSPDXHeaders(content string) []SPDXHeader {
+	var headers []SPDXHeader
+	for i, line := range strings.Split(content, "\n") {
+		if !strings.Contains(line, "SPDX-License-Identifier:") {
+			continue
+		}
+		m := spdxHeaderPattern.FindStringSubmatch(line)
+		if m == nil || strings.TrimSpace(m[1]) == "" {
+			continue
+		}
+		expr := strings.TrimSpace(strings.Trim(m[1], `"'`))
+		header := SPDXHeader{Expression: expr, Line: i + 1}
+		fields := strings.Fields(strings.NewReplacer("(", " ", ")", " ").Replace(expr))
+		for j := 0; j < len(fields); j++ {
+			switch strings.ToUpper(fields[j]) {
+			case "AND", "OR":
+				continue
+			case "WITH":
+				j++ // 例外（Classpath-exception-2.0 など）はライセンスとして数えない
+				continue
+			}
+			id := NormalizeLicenseID(fields[j])
+			if !containsString(header.Licenses, id) {
+				header.Licenses = append(header.Licenses, id)
+			}
+		}
+		if len(header.Licenses) > 0 {
+			headers = append(headers, header)
+		}
+	}
+	return headers
+}
+
+// NormalizeLicenseID 大文字小文字の違いと廃止された ID をそろえる
+func NormalizeLicenseID(id string) string {
+	id = strings.TrimSpace(id)
+	if current, ok := deprecatedLicenseIDs[id]; ok {
+		return current
+	}
+	for known := range licenseInfos {
+		if strings.EqualFold(known, id) {
+			return known
+		}
+	}
+	for old, current := range deprecatedLicenseIDs {
+		if strings.EqualFold(old, id) {
+			return current
+		}
+	}
+	return id
+}
+
+// licenseFilePattern ライセンスを書いたファイルの名前（LICENSE、COPYING.LESSER、LICENSE-MIT.md など）
+var licenseFilePattern = regexp.MustCompile(`(?i)^(un)?(licen[cs]e|copying|copyright|notice|legal)([-._][a-z0-9.-]*)?$`)
+
+// IsLicenseFile ライセンスを書いたファイルか（ソースコードの拡張子のものは除く）
+func IsLicenseFile(name, language string) bool {
+	base := path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if !licenseFilePattern.MatchString(base) {
+		return false
+	}
+	switch language {
+	case "", "unknown", "text", "markdown", "html":
+		return true
+	}
+	return false
+}
+
+// licenseFamily GPL 系のライセンスの種類と版（-only か -or-later か）
+func licenseFamily(id string) (family string, version float64, orLater bool) {
+	base := strings.TrimSuffix(strings.TrimSuffix(id, "-only"), "-or-later")
+	orLater = strings.HasSuffix(id, "-or-later")
+	name, ver, ok := strings.Cut(base, "-")
+	if !ok {
+		return id, 0, false
+	}
+	switch ver {
+	case "2.0":
+		version = 2
+	case "2.1":
+		version = 2.1
+	case "3.0":
+		version = 3
+	}
+	return name, version, orLater
+}
+
+// licenseConflict ファイルのライセンスがプロジェクトのライセンスと両立しない理由（両立すれば空）
+// 代表的な組み合わせだけを判定する（GPL の版の違い、Apache-2.0 と GPL-2.0、EPL と GPL、コピーレフトのコードを含む非コピーレフトのプロジェクト）
+func licenseConflict(project, file string) string {
+	if project == file {
+		return ""
+	}
+	projectCategory, fileCategory := LicenseCategory(project), LicenseCategory(file)
+	if projectCategory == "unknown" || fileCategory == "unknown" {
+		return ""
+	}
+	projectFamily, projectVersion, projectOrLater := licenseFamily(project)
+	fileFamily, fileVersion, fileOrLater := licenseFamily(file)
+
+	switch fileCategory {
+	case "permissive", "public_domain":
+		if file == "Apache-2.0" && projectFamily == "GPL" && projectVersion == 2 && !strings.HasSuffix(project, "-or-later") {
+			return "Apache-2.0 is incompatible with GPL-2.0-only"
+		}
+		return ""
+	case "weak_copyleft":
+		if strings.HasPrefix(file, "EPL-") && (projectFamily == "GPL" || projectFamily == "AGPL") {
+			return file + " is incompatible with " + project
+		}
+		return ""
+	}
+
+	switch projectFamily {
+	case "GPL", "AGPL":
+		if fileFamily == "SSPL" {
+			return file + " is incompatible with " + project
+		}
+		if fileFamily == "AGPL" && projectFamily == "GPL" && projectVersion < 3 && !projectOrLater {
+			return file + " is incompatible with " + project
+		}
+		// 版の違い：どちらかが -or-later なら新しい方の版を選べる
+		if fileVersion == projectVersion || fileOrLater && fileVersion < projectVersion || projectOrLater && projectVersion < fileVersion {
+			return ""
+		}
+		return file + " is incompatible with " + project
+	}
+	return fileCategory + " " + file + " code in a " + project + " project"
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testLicenseText 同梱のライセンス本文を、著作権者の行を付けたコメントにする（前に prefix 行を置く）
+func testLicenseText(t *testing.T, id string, prefix int) string {
+	t.Helper()
+	data, err := licenseTexts.ReadFile("licenses/" + id + ".txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	for i := 0; i < prefix; i++ {
+		fmt.Fprintf(&b, "package main // line %d\n", i+1)
+	}
+	b.WriteString("/*\n * Copyright (c) 2024 Example Corp.\n")
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		b.WriteString(" * " + line + "\n")
+	}
+	b.WriteString(" */\n")
+	return b.String()
+}
+
+func TestMatchLicenseTexts(t *testing.T) {
+	// MIT と BSD-2/BSD-3 は文言の一部が重なるが、一致の多い方だけを残す
+	for _, id := range []string{"MIT", "BSD-2-Clause", "BSD-3-Clause", "Apache-2.0", "GPL-3.0-only", "ISC"} {
+		t.Run(id, func(t *testing.T) {
+			content := testLicenseText(t, id, 3)
+			matches := MatchLicenseTexts(content)
+			if len(matches) != 1 || matches[0].License != id || matches[0].Kind != "text" || matches[0].Score < licenseMatchThreshold {
+				t.Fatalf("MatchLicenseTexts() = %+v, want one %s match", matches, id)
+			}
+			// 著作権者の行は比べないので、本文の最初の語の行から始まる（3行の前置き、/*、著作権者の行の次）
+			start := 6
+			for strings.TrimSpace(strings.TrimPrefix(strings.Split(content, "\n")[start-1], " *")) == "" {
+				start++
+			}
+			lines := strings.Count(content, "\n")
+			if m := matches[0]; m.StartLine != start || m.EndLine < lines-5 || m.EndLine > lines-1 {
+				t.Errorf("lines %d-%d, want %d-, content has %d lines", m.StartLine, m.EndLine, start, lines)
+			}
+		})
+	}
+
+	// 通知文だけのファイル
+	notice, err := licenseTexts.ReadFile("licenses/Apache-2.0.notice.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matches := MatchLicenseTexts("# " + strings.ReplaceAll(string(notice), "\n", "\n# ")); len(matches) != 1 || matches[0].License != "Apache-2.0" || matches[0].Kind != "notice" {
+		t.Errorf("notice = %+v", matches)
+	}
+
+	// 1つのファイルに2つのライセンスがあればどちらも返す
+	both := testLicenseText(t, "MIT", 0) + testLicenseText(t, "BSD-3-Clause", 0)
+	var got []string
+	for _, m := range MatchLicenseTexts(both) {
+		got = append(got, m.License)
+	}
+	if want := []string{"MIT", "BSD-3-Clause"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("two licenses = %v, want %v", got, want)
+	}
+
+	// 短い断片・無関係な文章は一致としない
+	for _, content := range []string{
+		"",
+		"Permission is hereby granted, free of charge, to any person",
+		strings.Repeat("the quick brown fox jumps over the lazy dog\n", 50),
+	} {
+		if matches := MatchLicenseTexts(content); len(matches) != 0 {
+			t.Errorf("MatchLicenseTexts(%.30q) = %+v", content, matches)
+		}
+	}
+}
+
+func TestFindSPDXHeaders(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []SPDXHeader
+	}{
+		{"// SPDX-License-Identifier: MIT\npackage a", []SPDXHeader{{"MIT", []string{"MIT"}, 1}}},
+		{"#!/bin/sh\n# SPDX-License-Identifier: GPL-2.0+\n", []SPDXHeader{{"GPL-2.0+", []string{"GPL-2.0-or-later"}, 2}}},
+		{"/* SPDX-License-Identifier: (apache-2.0 OR mit) */", []SPDXHeader{{"(apache-2.0 OR mit)", []string{"Apache-2.0", "MIT"}, 1}}},
+		{"<!-- SPDX-License-Identifier: GPL-2.0-only WITH Classpath-exception-2.0 -->", []SPDXHeader{{"GPL-2.0-only WITH Classpath-exception-2.0", []string{"GPL-2.0-only"}, 1}}},
+		{"// SPDX-License-Identifier:\n// SPDX-License-Identifier: \r\n", nil},
+		{"no header", nil},
+	}
+	for _, tt := range tests {
+		if got := FindSPDXHeaders(tt.content); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("FindSPDXHeaders(%q) = %+v, want %+v", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestIsLicenseFile(t *testing.T) {
+	tests := []struct {
+		name, language string
+		want           bool
+	}{
+		{"LICENSE", "", true},
+		{"pkg/COPYING.LESSER", "text", true},
+		{"LICENSE-MIT.md", "markdown", true},
+		{"UNLICENSE", "", true},
+		{"licence.txt", "text", true},
+		{"license.go", "go", false},
+		{"licenses.json", "json", false},
+		{"README.md", "markdown", false},
+	}
+	for _, tt := range tests {
+		if got := IsLicenseFile(tt.name, tt.language); got != tt.want {
+			t.Errorf("IsLicenseFile(%q, %q) = %v, want %v", tt.name, tt.language, got, tt.want)
+		}
+	}
+}
+
+func TestLicenseConflict(t *testing.T) {
+	tests := []struct {
+		project, file string
+		conflict      bool
+	}{
+		{"MIT", "MIT", false},
+		{"MIT", "BSD-3-Clause", false},
+		{"GPL-3.0-only", "MIT", false},
+		{"GPL-3.0-only", "Apache-2.0", false},
+		{"GPL-2.0-only", "Apache-2.0", true},
+		{"GPL-2.0-or-later", "Apache-2.0", false},
+		{"MIT", "GPL-3.0-only", true},
+		{"Apache-2.0", "LGPL-2.1-only", false},
+		{"GPL-2.0-only", "GPL-3.0-only", true},
+		{"GPL-3.0-only", "GPL-2.0-or-later", false},
+		{"GPL-2.0-or-later", "GPL-3.0-only", false},
+		{"GPL-2.0-only", "AGPL-3.0-only", true},
+		{"AGPL-3.0-only", "GPL-3.0-only", false},
+		{"GPL-3.0-only", "EPL-2.0", true},
+		{"GPL-3.0-only", "SSPL-1.0", true},
+		// 分類の分からないライセンスは判定しない
+		{"MIT", "Custom-1.0", false},
+		{"Proprietary", "GPL-3.0-only", false},
+	}
+	for _, tt := range tests {
+		if got := licenseConflict(tt.project, tt.file); (got != "") != tt.conflict {
+			t.Errorf("licenseConflict(%q, %q) = %q, want conflict = %v", tt.project, tt.file, got, tt.conflict)
+		}
+	}
+}
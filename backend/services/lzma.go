@@ -0,0 +1,464 @@
+package services
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// LZMA / LZMA2 の展開（7-Zip の LzmaSpec に沿った実装）
+// ファームウェアのカーブでは出力全体をメモリに保持するため、辞書は出力バッファそのものを使う
+
+var errLZMAInput = errors.New("lzma: unexpected end of input")
+
+// maxDecompressedSize 展開後サイズの上限（圧縮爆弾対策）
+const maxDecompressedSize = 256 << 20
+
+const (
+	lzmaNumStates          = 12
+	lzmaNumPosBitsMax      = 4
+	lzmaNumLenToPosStates  = 4
+	lzmaNumAlignBits       = 4
+	lzmaStartPosModelIndex = 4
+	lzmaEndPosModelIndex   = 14
+	lzmaNumFullDistances   = 1 << (lzmaEndPosModelIndex >> 1)
+	lzmaMatchMinLen        = 2
+	lzmaProbInit           = 1024
+)
+
+type lzmaRangeDecoder struct {
+	data  []byte
+	pos   int
+	rng   uint32
+	code  uint32
+	error error
+}
+
+func (rd *lzmaRangeDecoder) init(data []byte) error {
+	if len(data) < 5 {
+		return errLZMAInput
+	}
+	rd.data, rd.pos, rd.error = data, 5, nil
+	rd.rng = 0xFFFFFFFF
+	rd.code = binary.BigEndian.Uint32(data[1:5])
+	if data[0] != 0 || rd.code == rd.rng {
+		return errors.New("lzma: corrupted range coder header")
+	}
+	return nil
+}
+
+func (rd *lzmaRangeDecoder) nextByte() uint32 {
+	if rd.pos >= len(rd.data) {
+		rd.error = errLZMAInput
+		return 0
+	}
+	b := rd.data[rd.pos]
+	rd.pos++
+	return uint32(b)
+}
+
+func (rd *lzmaRangeDecoder) normalize() {
+	if rd.rng < 1<<24 {
+		rd.rng <<= 8
+		rd.code = rd.code<<8 | rd.nextByte()
+	}
+}
+
+func (rd *lzmaRangeDecoder) decodeBit(prob *uint16) uint32 {
+	bound := (rd.rng >> 11) * uint32(*prob)
+	var bit uint32
+	if rd.code < bound {
+		*prob += (2048 - *prob) >> 5
+		rd.rng = bound
+	} else {
+		*prob -= *prob >> 5
+		rd.code -= bound
+		rd.rng -= bound
+		bit = 1
+	}
+	rd.normalize()
+	return bit
+}
+
+func (rd *lzmaRangeDecoder) decodeDirectBits(n int) uint32 {
+	var res uint32
+	for ; n > 0; n-- {
+		rd.rng >>= 1
+		rd.code -= rd.rng
+		t := 0 - (rd.code >> 31)
+		rd.code += rd.rng & t
+		if rd.code == rd.rng {
+			rd.error = errors.New("lzma: corrupted data")
+		}
+		rd.normalize()
+		res = res<<1 + t + 1
+	}
+	return res
+}
+
+func (rd *lzmaRangeDecoder) bitTree(probs []uint16, numBits int) uint32 {
+	m := uint32(1)
+	for i := 0; i < numBits; i++ {
+		m = m<<1 + rd.decodeBit(&probs[m])
+	}
+	return m - uint32(1)<<uint(numBits)
+}
+
+func (rd *lzmaRangeDecoder) bitTreeReverse(probs []uint16, numBits int) uint32 {
+	m, sym := uint32(1), uint32(0)
+	for i := 0; i < numBits; i++ {
+		bit := rd.decodeBit(&probs[m])
+		m = m<<1 + bit
+		sym |= bit << uint(i)
+	}
+	return sym
+}
+
+type lzmaLenDecoder struct {
+	choice, choice2 uint16
+	low             [1 << lzmaNumPosBitsMax][1 << 3]uint16
+	mid             [1 << lzmaNumPosBitsMax][1 << 3]uint16
+	high            [1 << 8]uint16
+}
+
+func (ld *lzmaLenDecoder) reset() {
+	ld.choice, ld.choice2 = lzmaProbInit, lzmaProbInit
+	for i := range ld.low {
+		for j := range ld.low[i] {
+			ld.low[i][j], ld.mid[i][j] = lzmaProbInit, lzmaProbInit
+		}
+	}
+	for i := range ld.high {
+		ld.high[i] = lzmaProbInit
+	}
+}
+
+func (ld *lzmaLenDecoder) decode(rd *lzmaRangeDecoder, posState uint32) uint32 {
+	if rd.decodeBit(&ld.choice) == 0 {
+		return rd.bitTree(ld.low[posState][:], 3)
+	}
+	if rd.decodeBit(&ld.choice2) == 0 {
+		return 8 + rd.bitTree(ld.mid[posState][:], 3)
+	}
+	return 16 + rd.bitTree(ld.high[:], 8)
+}
+
+// lzmaDecoder 確率モデルと状態。LZMA2 ではチャンクをまたいで出力（辞書）を共有する
+type lzmaDecoder struct {
+	lc, lp, pb uint
+	literal    []uint16
+	posSlot    [lzmaNumLenToPosStates][1 << 6]uint16
+	posDecs    [1 + lzmaNumFullDistances - lzmaEndPosModelIndex]uint16
+	align      [1 << lzmaNumAlignBits]uint16
+	isMatch    [lzmaNumStates << lzmaNumPosBitsMax]uint16
+	isRep      [lzmaNumStates]uint16
+	isRepG0    [lzmaNumStates]uint16
+	isRepG1    [lzmaNumStates]uint16
+	isRepG2    [lzmaNumStates]uint16
+	isRep0Long [lzmaNumStates << lzmaNumPosBitsMax]uint16
+	lenDec     lzmaLenDecoder
+	repLenDec  lzmaLenDecoder
+
+	state                  uint32
+	rep0, rep1, rep2, rep3 uint32
+	out                    []byte
+	dictStart              int // 辞書の先頭（LZMA2 の辞書リセット位置）
+}
+
+func (d *lzmaDecoder) setProps(props byte) error {
+	if props >= 9*5*5 {
+		return errors.New("lzma: invalid properties")
+	}
+	d.lc = uint(props % 9)
+	props /= 9
+	d.lp = uint(props % 5)
+	d.pb = uint(props / 5)
+	return nil
+}
+
+func (d *lzmaDecoder) resetState() {
+	size := 0x300 << (d.lc + d.lp)
+	if cap(d.literal) >= size {
+		d.literal = d.literal[:size]
+	} else {
+		d.literal = make([]uint16, size)
+	}
+	fill := func(p []uint16) {
+		for i := range p {
+			p[i] = lzmaProbInit
+		}
+	}
+	fill(d.literal)
+	for i := range d.posSlot {
+		fill(d.posSlot[i][:])
+	}
+	fill(d.posDecs[:])
+	fill(d.align[:])
+	fill(d.isMatch[:])
+	fill(d.isRep[:])
+	fill(d.isRepG0[:])
+	fill(d.isRepG1[:])
+	fill(d.isRepG2[:])
+	fill(d.isRep0Long[:])
+	d.lenDec.reset()
+	d.repLenDec.reset()
+	d.state = 0
+	d.rep0, d.rep1, d.rep2, d.rep3 = 0, 0, 0, 0
+}
+
+func (d *lzmaDecoder) decodeLiteral(rd *lzmaRangeDecoder) {
+	prevByte := uint32(0)
+	total := len(d.out) - d.dictStart
+	if total > 0 {
+		prevByte = uint32(d.out[len(d.out)-1])
+	}
+	litState := ((uint32(total) & (1<<d.lp - 1)) << d.lc) + (prevByte >> (8 - d.lc))
+	probs := d.literal[0x300*litState:]
+
+	symbol := uint32(1)
+	if d.state >= 7 {
+		matchByte := uint32(d.out[len(d.out)-int(d.rep0)-1])
+		for symbol < 0x100 {
+			matchBit := (matchByte >> 7) & 1
+			matchByte <<= 1
+			bit := rd.decodeBit(&probs[((1+matchBit)<<8)+symbol])
+			symbol = symbol<<1 | bit
+			if matchBit != bit {
+				break
+			}
+		}
+	}
+	for symbol < 0x100 {
+		symbol = symbol<<1 | rd.decodeBit(&probs[symbol])
+	}
+	d.out = append(d.out, byte(symbol))
+}
+
+func (d *lzmaDecoder) decodeDistance(rd *lzmaRangeDecoder, length uint32) uint32 {
+	lenState := length
+	if lenState > lzmaNumLenToPosStates-1 {
+		lenState = lzmaNumLenToPosStates - 1
+	}
+	posSlot := rd.bitTree(d.posSlot[lenState][:], 6)
+	if posSlot < 4 {
+		return posSlot
+	}
+	numDirectBits := int(posSlot>>1) - 1
+	dist := (2 | posSlot&1) << uint(numDirectBits)
+	if posSlot < lzmaEndPosModelIndex {
+		return dist + rd.bitTreeReverse(d.posDecs[dist-posSlot:], numDirectBits)
+	}
+	dist += rd.decodeDirectBits(numDirectBits-lzmaNumAlignBits) << lzmaNumAlignBits
+	return dist + rd.bitTreeReverse(d.align[:], lzmaNumAlignBits)
+}
+
+// decode outSize バイト（-1 なら終端マーカーまで）を展開する
+func (d *lzmaDecoder) decode(rd *lzmaRangeDecoder, outSize int64, allowEndMarker bool) error {
+	target := int64(len(d.out)) + outSize
+	for outSize < 0 || int64(len(d.out)) < target {
+		if rd.error != nil {
+			return rd.error
+		}
+		if len(d.out) >= maxDecompressedSize {
+			return fmt.Errorf("lzma: output exceeds %d bytes", maxDecompressedSize)
+		}
+		posState := uint32(len(d.out)-d.dictStart) & (1<<d.pb - 1)
+		state := d.state
+
+		if rd.decodeBit(&d.isMatch[state<<lzmaNumPosBitsMax+posState]) == 0 {
+			d.decodeLiteral(rd)
+			switch {
+			case state < 4:
+				d.state = 0
+			case state < 10:
+				d.state = state - 3
+			default:
+				d.state = state - 6
+			}
+			continue
+		}
+
+		var length uint32
+		if rd.decodeBit(&d.isRep[state]) != 0 {
+			if len(d.out) == d.dictStart {
+				return errors.New("lzma: repeat match at stream start")
+			}
+			if rd.decodeBit(&d.isRepG0[state]) == 0 {
+				if rd.decodeBit(&d.isRep0Long[state<<lzmaNumPosBitsMax+posState]) == 0 {
+					// short rep: 1バイトのみ
+					if state < 7 {
+						d.state = 9
+					} else {
+						d.state = 11
+					}
+					d.out = append(d.out, d.out[len(d.out)-int(d.rep0)-1])
+					continue
+				}
+			} else {
+				var dist uint32
+				if rd.decodeBit(&d.isRepG1[state]) == 0 {
+					dist = d.rep1
+				} else {
+					if rd.decodeBit(&d.isRepG2[state]) == 0 {
+						dist = d.rep2
+					} else {
+						dist = d.rep3
+						d.rep3 = d.rep2
+					}
+					d.rep2 = d.rep1
+				}
+				d.rep1 = d.rep0
+				d.rep0 = dist
+			}
+			length = d.repLenDec.decode(rd, posState)
+			if state < 7 {
+				d.state = 8
+			} else {
+				d.state = 11
+			}
+		} else {
+			d.rep3, d.rep2, d.rep1 = d.rep2, d.rep1, d.rep0
+			length = d.lenDec.decode(rd, posState)
+			if state < 7 {
+				d.state = 7
+			} else {
+				d.state = 10
+			}
+			d.rep0 = d.decodeDistance(rd, length)
+			if d.rep0 == 0xFFFFFFFF {
+				// 終端マーカー
+				if !allowEndMarker {
+					return errors.New("lzma: unexpected end marker")
+				}
+				return rd.error
+			}
+		}
+
+		length += lzmaMatchMinLen
+		if int(d.rep0) >= len(d.out)-d.dictStart {
+			return errors.New("lzma: match distance out of range")
+		}
+		if outSize >= 0 && int64(len(d.out))+int64(length) > target {
+			return errors.New("lzma: match exceeds expected size")
+		}
+		src := len(d.out) - int(d.rep0) - 1
+		for i := 0; i < int(length); i++ {
+			d.out = append(d.out, d.out[src+i])
+		}
+	}
+	return rd.error
+}
+
+// DecompressLZMA lzma_alone 形式（13バイトのヘッダー付き）を展開し、展開結果と消費したバイト数を返す
+func DecompressLZMA(data []byte) ([]byte, int, error) {
+	if len(data) < 13 {
+		return nil, 0, errLZMAInput
+	}
+	var d lzmaDecoder
+	if err := d.setProps(data[0]); err != nil {
+		return nil, 0, err
+	}
+	if d.lc > 8 || d.lp > 4 || d.pb > 4 {
+		return nil, 0, errors.New("lzma: invalid properties")
+	}
+	size := int64(binary.LittleEndian.Uint64(data[5:13]))
+	if size > maxDecompressedSize {
+		return nil, 0, fmt.Errorf("lzma: declared size %d too large", size)
+	}
+	d.resetState()
+
+	var rd lzmaRangeDecoder
+	if err := rd.init(data[13:]); err != nil {
+		return nil, 0, err
+	}
+	err := d.decode(&rd, size, size < 0)
+	return d.out, 13 + rd.pos, err
+}
+
+// DecompressLZMA2 LZMA2 のチャンク列を展開し、展開結果と消費したバイト数を返す
+func DecompressLZMA2(data []byte) ([]byte, int, error) {
+	var d lzmaDecoder
+	pos := 0
+	needProps, needDictReset := true, true
+	for {
+		if pos >= len(data) {
+			return d.out, pos, errLZMAInput
+		}
+		control := data[pos]
+		pos++
+		if control == 0x00 {
+			return d.out, pos, nil
+		}
+
+		if control < 0x80 {
+			// 非圧縮チャンク（0x01 は辞書リセット付き）
+			if control > 0x02 {
+				return d.out, pos, fmt.Errorf("lzma2: invalid control byte 0x%02x", control)
+			}
+			if pos+2 > len(data) {
+				return d.out, pos, errLZMAInput
+			}
+			size := int(binary.BigEndian.Uint16(data[pos:])) + 1
+			pos += 2
+			if pos+size > len(data) {
+				return d.out, pos, errLZMAInput
+			}
+			if control == 0x01 {
+				d.dictStart = len(d.out)
+				needDictReset = false
+			} else if needDictReset {
+				return d.out, pos, errors.New("lzma2: missing dictionary reset")
+			}
+			if len(d.out)+size > maxDecompressedSize {
+				return d.out, pos, fmt.Errorf("lzma2: output exceeds %d bytes", maxDecompressedSize)
+			}
+			d.out = append(d.out, data[pos:pos+size]...)
+			pos += size
+			continue
+		}
+
+		if pos+4 > len(data) {
+			return d.out, pos, errLZMAInput
+		}
+		unpacked := int64(control&0x1F)<<16 + int64(binary.BigEndian.Uint16(data[pos:])) + 1
+		packed := int(binary.BigEndian.Uint16(data[pos+2:])) + 1
+		pos += 4
+		reset := (control >> 5) & 0x03
+		if reset == 3 {
+			d.dictStart = len(d.out)
+			needDictReset = false
+		} else if needDictReset {
+			return d.out, pos, errors.New("lzma2: missing dictionary reset")
+		}
+		if reset >= 2 {
+			if pos >= len(data) {
+				return d.out, pos, errLZMAInput
+			}
+			if err := d.setProps(data[pos]); err != nil {
+				return d.out, pos, err
+			}
+			if d.lc+d.lp > 4 {
+				return d.out, pos, errors.New("lzma2: invalid properties")
+			}
+			pos++
+			needProps = false
+		} else if needProps {
+			return d.out, pos, errors.New("lzma2: missing properties")
+		}
+		if reset >= 1 {
+			d.resetState()
+		}
+
+		if pos+packed > len(data) {
+			return d.out, pos, errLZMAInput
+		}
+		var rd lzmaRangeDecoder
+		if err := rd.init(data[pos : pos+packed]); err != nil {
+			return d.out, pos, err
+		}
+		if err := d.decode(&rd, unpacked, false); err != nil {
+			return d.out, pos, err
+		}
+		pos += packed
+	}
+}
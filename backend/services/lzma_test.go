@@ -0,0 +1,101 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// 以下は Python の lzma モジュールで "firmware firmware firmware!\n" を圧縮したもの（16進）
+var testLZMAPlain = []byte("firmware firmware firmware!\n")
+
+const (
+	// FORMAT_ALONE（サイズ不明・終端マーカーあり）
+	testLZMAAlone = ("5d00008000ffffffffffffffff00331a4aab8e77d7eb7253de76819045b567ffffa8280000")
+	// FORMAT_RAW の LZMA2 チャンク列
+	testLZMA2Raw = ("e0001b00115d00331a4aab8e77d7eb7253de76818f8ae00000")
+	// FORMAT_XZ、CHECK_CRC64
+	testXZCRC64 = ("fd377a585a000004e6d6b4460200210116000000742fe5a3e0001b00115d00331a4aab8e77d7eb7253de76818f8ae00000" +
+		"000000682fbff8da8d20a900012d1c8bb3ad141fb6f37d010000000004595a")
+	// FORMAT_XZ、CHECK_SHA256
+	testXZSHA256 = ("fd377a585a00000ae1fb0ca10200210116000000742fe5a3e0001b00115d00331a4aab8e77d7eb7253de76818f8ae00000" +
+		"000000094711c0da89eb04b7df7c51c52bd943e7546d8b08ac85bd69160125340b5dc60001451c245289b9189b4b9a01000000000a595a")
+)
+
+func mustHex(t testing.TB, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecompressLZMAFormats(t *testing.T) {
+	tests := []struct {
+		name       string
+		decompress func([]byte) ([]byte, int, error)
+		data       []byte
+	}{
+		{"lzma alone", DecompressLZMA, mustHex(t, testLZMAAlone)},
+		{"lzma2 raw", DecompressLZMA2, mustHex(t, testLZMA2Raw)},
+		{"xz crc64", DecompressXZ, mustHex(t, testXZCRC64)},
+		{"xz sha256", DecompressXZ, mustHex(t, testXZSHA256)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 後ろに続くデータは消費しない
+			input := append(append([]byte{}, tt.data...), "trailing"...)
+			out, n, err := tt.decompress(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out, testLZMAPlain) {
+				t.Errorf("output = %q, want %q", out, testLZMAPlain)
+			}
+			if n != len(tt.data) {
+				t.Errorf("consumed %d bytes, want %d", n, len(tt.data))
+			}
+		})
+	}
+}
+
+func TestDecompressLZMAInvalid(t *testing.T) {
+	alone, lzma2, xz, xzSHA256 := mustHex(t, testLZMAAlone), mustHex(t, testLZMA2Raw), mustHex(t, testXZCRC64), mustHex(t, testXZSHA256)
+	corrupt := func(data []byte, i int) []byte {
+		b := append([]byte{}, data...)
+		b[i] ^= 0xff
+		return b
+	}
+	tests := []struct {
+		name       string
+		decompress func([]byte) ([]byte, int, error)
+		data       []byte
+	}{
+		{"lzma empty", DecompressLZMA, nil},
+		{"lzma bad properties", DecompressLZMA, append([]byte{0xe1}, alone[1:]...)},
+		{"lzma oversized", DecompressLZMA, append([]byte{0x5d, 0, 0, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0x7f}, alone[13:]...)},
+		{"lzma2 empty", DecompressLZMA2, nil},
+		{"lzma2 bad control", DecompressLZMA2, []byte{0x03}},
+		{"lzma2 chunk without dictionary reset", DecompressLZMA2, append([]byte{0x80}, lzma2[1:]...)},
+		{"xz bad magic", DecompressXZ, corrupt(xz, 0)},
+		{"xz header crc", DecompressXZ, corrupt(xz, 8)},
+		{"xz block check", DecompressXZ, corrupt(xz, 52)},
+		{"xz sha256 check", DecompressXZ, corrupt(xzSHA256, 60)},
+		{"xz footer", DecompressXZ, corrupt(xz, len(xz)-3)},
+		// 途中で切れた入力
+		{"lzma truncated header", DecompressLZMA, alone[:5]},
+		{"lzma missing end marker", DecompressLZMA, alone[:len(alone)-1]},
+		{"lzma2 missing end of stream", DecompressLZMA2, lzma2[:len(lzma2)-1]},
+		{"lzma2 truncated chunk", DecompressLZMA2, lzma2[:len(lzma2)/2]},
+		{"xz truncated block", DecompressXZ, xz[:len(xz)/2]},
+		{"xz missing footer", DecompressXZ, xz[:len(xz)-1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := tt.decompress(tt.data); err == nil {
+				t.Error("error = nil")
+			}
+		})
+	}
+}
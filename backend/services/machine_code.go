@@ -0,0 +1,444 @@
+package services
+
+import (
+	"encoding/binary"
+)
+
+// MachineBranch 命令の制御フロー上の種別
+type MachineBranch int
+
+const (
+	BranchNone     MachineBranch = iota
+	BranchJump                   // 無条件ジャンプ（飛び先あり）
+	BranchCond                   // 条件分岐（飛び先とフォールスルー）
+	BranchCall                   // 直接呼び出し
+	BranchReturn                 // ret
+	BranchIndirect               // 間接ジャンプ・ud2 など、後続が分からない命令
+)
+
+// MachineInsn 長さと分岐情報だけを取り出した機械語命令
+type MachineInsn struct {
+	Offset int
+	Len    int
+	Sig    uint32 // オペランドを除いた命令の正規化ハッシュ（命令ハッシュの材料）
+	Branch MachineBranch
+	Target uint64 // Branch が Jump/Cond/Call のときの飛び先アドレス
+}
+
+// DecodeMachineCode 関数本体を命令列に分解する（対応していないアーキテクチャは4バイト単位のチャンクとして扱う）
+func DecodeMachineCode(arch string, code []byte, addr uint64) []MachineInsn {
+	switch arch {
+	case "amd64", "386":
+		return decodeX86Code(code, addr, arch == "amd64")
+	case "arm64":
+		return decodeARM64Code(code, addr)
+	}
+	var insns []MachineInsn
+	for off := 0; off < len(code); off += 4 {
+		n := 4
+		if off+n > len(code) {
+			n = len(code) - off
+		}
+		var sig uint32
+		for _, b := range code[off : off+n] {
+			sig = sig*16777619 ^ uint32(b)
+		}
+		insns = append(insns, MachineInsn{Offset: off, Len: n, Sig: sig})
+	}
+	return insns
+}
+
+func decodeX86Code(code []byte, addr uint64, mode64 bool) []MachineInsn {
+	var insns []MachineInsn
+	for off := 0; off < len(code); {
+		insn, ok := decodeX86(code[off:], mode64)
+		if !ok {
+			// 解釈できないバイトは1バイトの不明命令として読み進める
+			insn = MachineInsn{Len: 1, Sig: 0xffffffff}
+		}
+		insn.Offset = off
+		if insn.Branch == BranchJump || insn.Branch == BranchCond || insn.Branch == BranchCall {
+			insn.Target = uint64(int64(addr) + int64(off+insn.Len) + int64(insn.Target))
+		}
+		insns = append(insns, insn)
+		off += insn.Len
+	}
+	return insns
+}
+
+// x86 の1バイトオペコードのうち ModRM を持つもの
+var x86ModRM1 = func() [256]bool {
+	var t [256]bool
+	for op := 0; op < 0x40; op++ {
+		if op&7 < 4 {
+			t[op] = true
+		}
+	}
+	for _, op := range []int{0x62, 0x63, 0x69, 0x6b, 0xc0, 0xc1, 0xc4, 0xc5, 0xc6, 0xc7, 0xd0, 0xd1, 0xd2, 0xd3, 0xf6, 0xf7, 0xfe, 0xff} {
+		t[op] = true
+	}
+	for op := 0x80; op <= 0x8f; op++ {
+		t[op] = true
+	}
+	for op := 0xd8; op <= 0xdf; op++ {
+		t[op] = true
+	}
+	return t
+}()
+
+// x86 の 0F xx オペコードのうち ModRM を持たないもの
+var x86NoModRM2 = func() [256]bool {
+	var t [256]bool
+	for _, op := range []int{0x05, 0x06, 0x07, 0x08, 0x09, 0x0b, 0x0e, 0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x37, 0x77, 0xa0, 0xa1, 0xa2, 0xa8, 0xa9, 0xaa} {
+		t[op] = true
+	}
+	for op := 0x80; op <= 0x8f; op++ {
+		t[op] = true
+	}
+	for op := 0xc8; op <= 0xcf; op++ {
+		t[op] = true
+	}
+	return t
+}()
+
+// decodeX86 命令1つの長さ・分岐種別・正規化ハッシュを求める（オペランドの意味までは解釈しない）
+func decodeX86(b []byte, mode64 bool) (MachineInsn, bool) {
+	var insn MachineInsn
+	pos := 0
+	opsize16, addrsize := false, 32
+	if mode64 {
+		addrsize = 64
+	}
+	rexW := false
+	sig := uint32(2166136261)
+	mix := func(v byte) { sig = (sig ^ uint32(v)) * 16777619 }
+
+	// レガシープレフィックス
+	for pos < len(b) && pos < 14 {
+		switch b[pos] {
+		case 0x66:
+			opsize16 = true
+		case 0x67:
+			if mode64 {
+				addrsize = 32
+			} else {
+				addrsize = 16
+			}
+		case 0xf0, 0xf2, 0xf3:
+			mix(b[pos])
+		case 0x2e, 0x36, 0x3e, 0x26, 0x64, 0x65:
+		default:
+			goto prefixDone
+		}
+		pos++
+	}
+prefixDone:
+	if pos >= len(b) {
+		return insn, false
+	}
+	if mode64 && b[pos]&0xf0 == 0x40 {
+		rexW = b[pos]&0x08 != 0
+		pos++
+		if pos >= len(b) {
+			return insn, false
+		}
+	}
+	if opsize16 {
+		mix(0x66)
+	}
+	if rexW {
+		mix(0x48)
+	}
+
+	op := b[pos]
+	pos++
+
+	// VEX / EVEX（32bit モードでは次バイトの上位2ビットが 11 のときだけ）
+	if op == 0xc4 || op == 0xc5 || op == 0x62 {
+		if pos < len(b) && (mode64 || b[pos]&0xc0 == 0xc0) {
+			var mapSelect byte = 1
+			switch op {
+			case 0xc5:
+				pos++
+			case 0xc4:
+				mapSelect = b[pos] & 0x1f
+				pos += 2
+			case 0x62:
+				mapSelect = b[pos] & 0x07
+				pos += 3
+			}
+			if pos >= len(b) {
+				return insn, false
+			}
+			vop := b[pos]
+			pos++
+			mix(op)
+			mix(mapSelect)
+			mix(vop)
+			n, ok := x86ModRMLen(b[pos:], addrsize)
+			if !ok {
+				return insn, false
+			}
+			mix(b[pos] >> 6)
+			pos += n
+			if mapSelect == 3 || (mapSelect == 1 && x86Imm8Ops2(vop)) {
+				pos++
+			}
+			if pos > len(b) {
+				return insn, false
+			}
+			insn.Len, insn.Sig = pos, sig
+			return insn, true
+		}
+	}
+
+	if op == 0x0f {
+		if pos >= len(b) {
+			return insn, false
+		}
+		op2 := b[pos]
+		pos++
+		mix(0x0f)
+		mix(op2)
+		if op2 == 0x38 || op2 == 0x3a {
+			if pos >= len(b) {
+				return insn, false
+			}
+			mix(b[pos])
+			pos++
+			n, ok := x86ModRMLen(b[pos:], addrsize)
+			if !ok {
+				return insn, false
+			}
+			mix(b[pos] >> 6)
+			pos += n
+			if op2 == 0x3a {
+				pos++
+			}
+		} else {
+			if !x86NoModRM2[op2] {
+				n, ok := x86ModRMLen(b[pos:], addrsize)
+				if !ok {
+					return insn, false
+				}
+				mix(b[pos] >> 6)
+				pos += n
+			}
+			switch {
+			case op2 >= 0x80 && op2 <= 0x8f:
+				size := 4
+				if opsize16 && !mode64 {
+					size = 2
+				}
+				if pos+size > len(b) {
+					return insn, false
+				}
+				insn.Branch = BranchCond
+				insn.Target = uint64(readSigned(b[pos:], size))
+				pos += size
+			case x86Imm8Ops2(op2) || op2 == 0x0f:
+				pos++
+			case op2 == 0x0b:
+				insn.Branch = BranchIndirect
+			}
+		}
+		if pos > len(b) {
+			return insn, false
+		}
+		insn.Len, insn.Sig = pos, sig
+		return insn, true
+	}
+
+	mix(op)
+	immz := 4
+	if opsize16 {
+		immz = 2
+	}
+
+	// 32bit モード専用のオペコード
+	if !mode64 {
+		switch {
+		case op >= 0x40 && op <= 0x4f:
+			insn.Len, insn.Sig = pos, sig
+			return insn, true
+		case op == 0x9a || op == 0xea:
+			pos += immz + 2
+			if op == 0xea {
+				insn.Branch = BranchIndirect
+			}
+			insn.Len, insn.Sig = pos, sig
+			return insn, pos <= len(b)
+		}
+	}
+
+	reg := byte(0)
+	if x86ModRM1[op] {
+		if pos >= len(b) {
+			return insn, false
+		}
+		reg = (b[pos] >> 3) & 7
+		mix(b[pos] >> 6)
+		if op >= 0x80 && op <= 0x83 || op >= 0xc0 && op <= 0xd3 || op >= 0xf6 {
+			mix(reg) // グループ命令は reg フィールドが命令の種類を表す
+		}
+		n, ok := x86ModRMLen(b[pos:], addrsize)
+		if !ok {
+			return insn, false
+		}
+		pos += n
+	}
+
+	switch {
+	case op < 0x40 && op&7 == 4, op == 0x6a, op == 0x6b, op == 0x80, op == 0x82, op == 0x83, op == 0xa8,
+		op >= 0xb0 && op <= 0xb7, op == 0xc0, op == 0xc1, op == 0xc6, op == 0xcd, op == 0xd4, op == 0xd5,
+		op >= 0xe4 && op <= 0xe7:
+		pos++
+	case op < 0x40 && op&7 == 5, op == 0x68, op == 0x69, op == 0x81, op == 0xa9, op == 0xc7:
+		pos += immz
+	case op >= 0xb8 && op <= 0xbf:
+		if rexW {
+			pos += 8
+		} else {
+			pos += immz
+		}
+	case op >= 0xa0 && op <= 0xa3:
+		pos += addrsize / 8
+	case op == 0xc2 || op == 0xca:
+		pos += 2
+		insn.Branch = BranchReturn
+	case op == 0xc8:
+		pos += 3
+	case op == 0xc3 || op == 0xcb || op == 0xcf:
+		insn.Branch = BranchReturn
+	case op == 0xf4:
+		insn.Branch = BranchIndirect
+	case op == 0xf6 && reg < 2:
+		pos++
+	case op == 0xf7 && reg < 2:
+		pos += immz
+	case op >= 0x70 && op <= 0x7f, op >= 0xe0 && op <= 0xe3:
+		if pos >= len(b) {
+			return insn, false
+		}
+		insn.Branch = BranchCond
+		insn.Target = uint64(int64(int8(b[pos])))
+		pos++
+	case op == 0xeb:
+		if pos >= len(b) {
+			return insn, false
+		}
+		insn.Branch = BranchJump
+		insn.Target = uint64(int64(int8(b[pos])))
+		pos++
+	case op == 0xe8 || op == 0xe9:
+		size := immz
+		if mode64 {
+			size = 4 // 64bit モードでは 0x66 があっても rel32
+		}
+		if pos+size > len(b) {
+			return insn, false
+		}
+		insn.Branch = BranchCall
+		if op == 0xe9 {
+			insn.Branch = BranchJump
+		}
+		insn.Target = uint64(readSigned(b[pos:], size))
+		pos += size
+	case op == 0xff && (reg == 4 || reg == 5):
+		insn.Branch = BranchIndirect
+	}
+
+	if pos > len(b) {
+		return insn, false
+	}
+	insn.Len, insn.Sig = pos, sig
+	return insn, true
+}
+
+// x86Imm8Ops2 0F マップで ModRM の後に imm8 を取る命令
+func x86Imm8Ops2(op byte) bool {
+	switch op {
+	case 0x70, 0x71, 0x72, 0x73, 0xa4, 0xac, 0xba, 0xc2, 0xc4, 0xc5, 0xc6:
+		return true
+	}
+	return false
+}
+
+// x86ModRMLen ModRM・SIB・ディスプレースメントの合計バイト数
+func x86ModRMLen(b []byte, addrsize int) (int, bool) {
+	if len(b) == 0 {
+		return 0, false
+	}
+	modrm := b[0]
+	mod, rm := modrm>>6, modrm&7
+	n := 1
+	if mod == 3 {
+		return n, true
+	}
+	if addrsize == 16 {
+		switch {
+		case mod == 0 && rm == 6, mod == 2:
+			n += 2
+		case mod == 1:
+			n++
+		}
+		return n, n <= len(b)
+	}
+	if rm == 4 {
+		if len(b) < 2 {
+			return 0, false
+		}
+		if mod == 0 && b[1]&7 == 5 {
+			n += 4
+		}
+		n++
+	}
+	switch {
+	case mod == 0 && rm == 5, mod == 2:
+		n += 4
+	case mod == 1:
+		n++
+	}
+	return n, n <= len(b)
+}
+
+func readSigned(b []byte, size int) int64 {
+	switch size {
+	case 1:
+		return int64(int8(b[0]))
+	case 2:
+		return int64(int16(binary.LittleEndian.Uint16(b)))
+	default:
+		return int64(int32(binary.LittleEndian.Uint32(b)))
+	}
+}
+
+func decodeARM64Code(code []byte, addr uint64) []MachineInsn {
+	var insns []MachineInsn
+	signExtend := func(v uint32, bits uint) int64 {
+		return int64(int32(v<<(32-bits)) >> (32 - bits))
+	}
+	for off := 0; off+4 <= len(code); off += 4 {
+		ins := binary.LittleEndian.Uint32(code[off:])
+		pc := int64(addr) + int64(off)
+		insn := MachineInsn{Offset: off, Len: 4, Sig: ins >> 21}
+		switch {
+		case ins&0xfc000000 == 0x14000000: // B
+			insn.Branch, insn.Target, insn.Sig = BranchJump, uint64(pc+signExtend(ins&0x3ffffff, 26)*4), 0x14
+		case ins&0xfc000000 == 0x94000000: // BL
+			insn.Branch, insn.Target, insn.Sig = BranchCall, uint64(pc+signExtend(ins&0x3ffffff, 26)*4), 0x94
+		case ins&0xff000010 == 0x54000000: // B.cond
+			insn.Branch, insn.Target, insn.Sig = BranchCond, uint64(pc+signExtend((ins>>5)&0x7ffff, 19)*4), 0x54<<4|ins&0xf
+		case ins&0x7e000000 == 0x34000000: // CBZ / CBNZ
+			insn.Branch, insn.Target, insn.Sig = BranchCond, uint64(pc+signExtend((ins>>5)&0x7ffff, 19)*4), ins>>24
+		case ins&0x7e000000 == 0x36000000: // TBZ / TBNZ
+			insn.Branch, insn.Target, insn.Sig = BranchCond, uint64(pc+signExtend((ins>>5)&0x3fff, 14)*4), ins>>24
+		case ins&0xfffffc1f == 0xd65f0000: // RET
+			insn.Branch = BranchReturn
+		case ins&0xfffffc1f == 0xd61f0000: // BR
+			insn.Branch = BranchIndirect
+		}
+		insns = append(insns, insn)
+	}
+	return insns
+}
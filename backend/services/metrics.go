@@ -0,0 +1,593 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// FunctionMetrics 関数1つのコード指標
+type FunctionMetrics struct {
+	Name       string  `json:"name"`
+	Container  string  `json:"container,omitempty"` // レシーバー型・所属クラス
+	Line       int     `json:"line"`
+	EndLine    int     `json:"end_line"`
+	LogicalLOC int     `json:"logical_loc"`
+	Cyclomatic int     `json:"cyclomatic"`  // McCabe の循環的複雑度（1 + 分岐の数）
+	Cognitive  int     `json:"cognitive"`   // 認知的複雑度（入れ子の深さで重み付けした分岐の数）
+	MaxNesting int     `json:"max_nesting"` // 制御構造の入れ子の最大の深さ
+	FanIn      int     `json:"fan_in"`      // この関数を呼び出している関数の数
+	FanOut     int     `json:"fan_out"`     // この関数が呼び出している関数の数
+	Hotspot    float64 `json:"hotspot"`
+}
+
+// FileMetrics ファイル1つのコード指標
+// Cyclomatic・Cognitive は関数の合計、FanIn・FanOut は呼び出し関係のある他のファイルの数
+type FileMetrics struct {
+	FileID        uint              `json:"file_id"`
+	Name          string            `json:"name"`
+	Language      string            `json:"language"`
+	PhysicalLOC   int               `json:"physical_loc"`
+	LogicalLOC    int               `json:"logical_loc"`
+	CommentLOC    int               `json:"comment_loc"`
+	BlankLOC      int               `json:"blank_loc"`
+	Functions     []FunctionMetrics `json:"functions,omitempty"`
+	Cyclomatic    int               `json:"cyclomatic"`
+	MaxCyclomatic int               `json:"max_cyclomatic"`
+	Cognitive     int               `json:"cognitive"`
+	MaxCognitive  int               `json:"max_cognitive"`
+	MaxNesting    int               `json:"max_nesting"`
+	FanIn         int               `json:"fan_in"`
+	FanOut        int               `json:"fan_out"`
+	Hotspot       float64           `json:"hotspot"`
+}
+
+// 分岐・繰り返しとして数えるキーワードの役割
+type metricsRole int
+
+const (
+	roleIf        metricsRole = iota + 1
+	roleElseIf                // elif・elsif など（入れ子の重みなしで数える）
+	roleElse                  // else（if と続けば else if）
+	roleLoop                  // 条件付きの繰り返し
+	rolePlainLoop             // 条件のない繰り返し（Rust の loop など。循環的複雑度には数えない）
+	roleSwitch                // switch・match・when などの多分岐
+	roleArm                   // case・when などの分岐先
+	roleCatch                 // 例外の捕捉
+	roleNest                  // 入れ子だけを深くする（do など）
+	roleLogical               // and・or などの論理演算子
+)
+
+var (
+	cStyleMetricsRoles = map[string]metricsRole{
+		"if": roleIf, "else": roleElse, "for": roleLoop, "while": roleLoop, "do": roleNest,
+		"switch": roleSwitch, "case": roleArm, "catch": roleCatch,
+	}
+
+	// metricsRoles 言語ごとのキーワードの役割（Go は go/ast で計測し、構文エラーのときだけここを使う）
+	metricsRoles = map[string]map[string]metricsRole{
+		"javascript": cStyleMetricsRoles,
+		"typescript": cStyleMetricsRoles,
+		"java":       cStyleMetricsRoles,
+		"c":          cStyleMetricsRoles,
+		"cpp":        cStyleMetricsRoles,
+		"go": {
+			"if": roleIf, "else": roleElse, "for": roleLoop, "switch": roleSwitch, "select": roleSwitch, "case": roleArm,
+		},
+		"csharp": withMetricsRoles(cStyleMetricsRoles, map[string]metricsRole{"foreach": roleLoop}),
+		"php": withMetricsRoles(cStyleMetricsRoles, map[string]metricsRole{
+			"foreach": roleLoop, "elseif": roleElseIf, "and": roleLogical, "or": roleLogical,
+		}),
+		"swift": withMetricsRoles(cStyleMetricsRoles, map[string]metricsRole{"guard": roleIf, "repeat": roleNest}),
+		"kotlin": {
+			"if": roleIf, "else": roleElse, "for": roleLoop, "while": roleLoop, "do": roleNest, "when": roleSwitch, "catch": roleCatch,
+		},
+		"scala": {
+			"if": roleIf, "else": roleElse, "for": roleLoop, "while": roleLoop, "do": roleNest,
+			"match": roleSwitch, "case": roleArm, "catch": roleCatch,
+		},
+		"rust": {
+			"if": roleIf, "else": roleElse, "for": roleLoop, "while": roleLoop, "loop": rolePlainLoop, "match": roleSwitch,
+		},
+		"python": {
+			"if": roleIf, "elif": roleElseIf, "else": roleElse, "for": roleLoop, "while": roleLoop,
+			"match": roleSwitch, "case": roleArm, "except": roleCatch, "and": roleLogical, "or": roleLogical,
+		},
+		"ruby": {
+			"if": roleIf, "unless": roleIf, "elsif": roleElseIf, "else": roleElse, "while": roleLoop, "until": roleLoop,
+			"for": roleLoop, "case": roleSwitch, "when": roleArm, "rescue": roleCatch, "and": roleLogical, "or": roleLogical,
+		},
+		"shell": {
+			"if": roleIf, "elif": roleElseIf, "else": roleElse, "for": roleLoop, "while": roleLoop, "until": roleLoop, "case": roleSwitch,
+		},
+		"r": {
+			"if": roleIf, "else": roleElse, "for": roleLoop, "while": roleLoop, "repeat": rolePlainLoop,
+		},
+		"powershell": {
+			"if": roleIf, "elseif": roleElseIf, "else": roleElse, "for": roleLoop, "foreach": roleLoop, "while": roleLoop,
+			"do": roleNest, "switch": roleSwitch, "catch": roleCatch,
+		},
+	}
+
+	// 文末の ; を省略できる言語（行末を文の終わりとみなす）
+	optionalSemicolonLanguages = map[string]bool{
+		"go": true, "javascript": true, "typescript": true, "kotlin": true, "swift": true, "scala": true,
+		"python": true, "ruby": true, "shell": true, "r": true, "powershell": true,
+	}
+
+	// 三項演算子 ?: のある言語
+	ternaryLanguages = map[string]bool{
+		"javascript": true, "typescript": true, "java": true, "c": true, "cpp": true, "csharp": true,
+		"php": true, "swift": true, "ruby": true,
+	}
+
+	// ?? を持つ言語（循環的複雑度に数える）
+	nullCoalescingLanguages = map[string]bool{
+		"javascript": true, "typescript": true, "csharp": true, "php": true, "swift": true,
+	}
+
+	// 行全体がこれだけなら論理行に数えない
+	metricsClosers = map[string]bool{"end": true, "fi": true, "done": true, "esac": true}
+)
+
+func withMetricsRoles(base, extra map[string]metricsRole) map[string]metricsRole {
+	roles := make(map[string]metricsRole, len(base)+len(extra))
+	for k, v := range base {
+		roles[k] = v
+	}
+	for k, v := range extra {
+		roles[k] = v
+	}
+	return roles
+}
+
+// MetricsLanguages 指標を計測できる言語か（コメントの書き方が分かる言語）
+func MetricsLanguages(language string) bool {
+	_, ok := commentSyntaxes[language]
+	return ok
+}
+
+// ComputeFileMetrics ファイルの行数と関数ごとの複雑度を計測する（呼び出し関係は含まない）
+// Go は構文木から、その他の言語はコメント・文字列を除いたソースの字句から数える
+func ComputeFileMetrics(file models.File) *FileMetrics {
+	m := &FileMetrics{FileID: file.ID, Name: file.Name, Language: file.Language, Functions: []FunctionMetrics{}}
+	masked := strings.Split(MaskSource(file.Language, file.Content), "\n")
+	m.PhysicalLOC, m.BlankLOC, m.CommentLOC = countSourceLines(file.Language, file.Content)
+
+	if file.Language == "go" {
+		if functions, logical, ok := goFileMetrics(file.Content); ok {
+			m.LogicalLOC = logical
+			m.Functions = functions
+			m.summarize()
+			return m
+		}
+	}
+	m.LogicalLOC = countLogicalLines(file.Language, masked, 1, len(masked), nil)
+	if symbolRules[file.Language] != nil || file.Language == "go" {
+		m.Functions = scanFunctionMetrics(file.Language, file.Content, masked)
+	}
+	m.summarize()
+	return m
+}
+
+// countSourceLines 物理行・空行・コメントだけの行を数える（末尾の改行の後は行に数えない）
+func countSourceLines(language, content string) (physical, blank, comment int) {
+	content = strings.TrimSuffix(content, "\n")
+	if content == "" {
+		return 0, 0, 0
+	}
+	original := strings.Split(content, "\n")
+	stripped := strings.Split(StripComments(language, content), "\n")
+	for i, line := range original {
+		switch {
+		case strings.TrimSpace(line) == "":
+			blank++
+		case i < len(stripped) && strings.TrimSpace(stripped[i]) == "":
+			comment++
+		}
+	}
+	return len(original), blank, comment
+}
+
+// countLogicalLines from〜to 行目（1始まり）の論理行（文の数）を数える
+// ; と文の区切りになる { } で文を分け、; を省略できる言語では継続していない行末も区切りにする
+// skip の行は数えない（入れ子の関数の範囲など）
+func countLogicalLines(language string, masked []string, from, to int, skip func(line int) bool) int {
+	braceBlocks := !indentLanguages[language]
+	lineEnds := optionalSemicolonLanguages[language]
+	count, depth := 0, 0
+	pending := false
+	for ln := from; ln <= to && ln <= len(masked); ln++ {
+		if skip != nil && skip(ln) {
+			continue
+		}
+		line := masked[ln-1]
+		trimmed := strings.TrimSpace(line)
+		if metricsClosers[trimmed] {
+			continue
+		}
+		for i := 0; i < len(line); i++ {
+			switch c := line[i]; {
+			case c == '(' || c == '[' || (!braceBlocks && c == '{'):
+				depth++
+				pending = true
+			case c == ')' || c == ']' || (!braceBlocks && c == '}'):
+				if depth > 0 {
+					depth--
+				}
+			case c == ';' && depth == 0, (c == '{' || c == '}') && depth == 0:
+				if pending {
+					count++
+				}
+				pending = false
+			case c == '{' || c == '}' || c == ';':
+			case c != ' ' && c != '\t' && c != '\r':
+				pending = true
+			}
+		}
+		if lineEnds && pending && depth == 0 && !continuesLine(trimmed) {
+			count++
+			pending = false
+		}
+	}
+	if pending {
+		count++
+	}
+	return count
+}
+
+// continuesLine 行末が演算子などで終わり、次の行に文が続くか
+func continuesLine(trimmed string) bool {
+	if trimmed == "" {
+		return false
+	}
+	if strings.HasSuffix(trimmed, "++") || strings.HasSuffix(trimmed, "--") {
+		return false
+	}
+	return strings.IndexByte(",\\+-*/%=&|.<>?", trimmed[len(trimmed)-1]) >= 0
+}
+
+// scanFunctionMetrics シンボル抽出で見つけた関数ごとに字句を数える
+func scanFunctionMetrics(language, content string, masked []string) []FunctionMetrics {
+	type span struct {
+		def        SymbolDef
+		start, end int
+	}
+	var spans []span
+	for _, def := range ExtractSymbols(language, content) {
+		if def.Kind != "function" && def.Kind != "method" {
+			continue
+		}
+		spans = append(spans, span{def: def, start: def.Line, end: functionEndLine(language, masked, def)})
+	}
+
+	functions := []FunctionMetrics{}
+	for i, s := range spans {
+		// 入れ子の関数の行は外側の関数に数えない
+		var inner [][2]int
+		for j, other := range spans {
+			if j != i && other.start > s.start && other.end <= s.end {
+				inner = append(inner, [2]int{other.start, other.end})
+			}
+		}
+		skip := func(line int) bool {
+			for _, r := range inner {
+				if r[0] <= line && line <= r[1] {
+					return true
+				}
+			}
+			return false
+		}
+		fm := FunctionMetrics{Name: s.def.Name, Container: s.def.Container, Line: s.start, EndLine: s.end}
+		fm.LogicalLOC = countLogicalLines(language, masked, s.start, s.end, skip)
+		fm.Cyclomatic, fm.Cognitive, fm.MaxNesting = scanComplexity(language, masked, s.start, s.end, skip)
+		functions = append(functions, fm)
+	}
+	return functions
+}
+
+// metricsFrame 字句を数えるときの入れ子（波括弧または字下げ）
+type metricsFrame struct {
+	control bool // 制御構造の本体（入れ子の深さに数える）
+	switch_ bool // 多分岐の本体（Kotlin の ->、Rust の => を分岐先として数える）
+	indent  int
+}
+
+// complexityCounter 関数1つ分の字句を行ごとに読み、複雑度を数える
+type complexityCounter struct {
+	language    string
+	roles       map[string]metricsRole
+	cyclomatic  int
+	cognitive   int
+	maxNesting  int
+	stack       []metricsFrame
+	lastLogical string      // 直前の論理演算子（同じ演算子の連なりは1回だけ数える）
+	pending     metricsRole // 次の { で本体が始まる制御構造
+	parens      int
+	bodyOpened  bool // 関数本体の { を読んだか
+}
+
+// scanComplexity from〜to 行目の循環的複雑度・認知的複雑度・入れ子の最大の深さを数える
+// 入れ子は波括弧の言語では { }、Python・Ruby・シェルでは字下げで判断する
+func scanComplexity(language string, masked []string, from, to int, skip func(line int) bool) (cyclomatic, cognitive, maxNesting int) {
+	c := &complexityCounter{language: language, roles: metricsRoles[language], cyclomatic: 1}
+	byIndent := indentLanguages[language] || language == "shell"
+	for ln := from; ln <= to && ln <= len(masked); ln++ {
+		if skip != nil && skip(ln) {
+			continue
+		}
+		line := masked[ln-1]
+		tokens := metricsTokens(line, language)
+		if len(tokens) == 0 {
+			continue
+		}
+		if byIndent {
+			c.indentLine(line, tokens, ln == from)
+			continue
+		}
+		c.braceLine(tokens)
+		// 波括弧なしの本体（if (x) return; など）は行末で終わる
+		if c.parens == 0 && c.pending != 0 && !strings.HasPrefix(nextCodeLine(masked, ln, to), "{") {
+			c.pending = 0
+		}
+		if c.parens == 0 && !continuesLine(strings.TrimSpace(line)) {
+			c.lastLogical = ""
+		}
+	}
+	return c.cyclomatic, c.cognitive, c.maxNesting
+}
+
+func (c *complexityCounter) nesting() int {
+	n := 0
+	for _, f := range c.stack {
+		if f.control {
+			n++
+		}
+	}
+	return n
+}
+
+// control 制御構造を1つ数える（weighted なら入れ子の深さの分を足す）
+func (c *complexityCounter) control(weighted bool) {
+	level := c.nesting()
+	if weighted {
+		c.cognitive += 1 + level
+	} else {
+		c.cognitive++
+	}
+	c.maxNesting = max(c.maxNesting, level+1)
+}
+
+func (c *complexityCounter) logical(tok string) {
+	c.cyclomatic++
+	if tok != c.lastLogical {
+		c.cognitive++
+	}
+	c.lastLogical = tok
+}
+
+// indentLine 字下げで入れ子を判断する言語の1行。行頭の制御構造だけが本体を持つ
+func (c *complexityCounter) indentLine(line string, tokens []string, definition bool) {
+	indent := len(line) - len(strings.TrimLeft(line, " \t"))
+	first := c.roles[tokens[0]]
+	// Python の match・case は行頭でコロンで終わる場合だけ（変数名 match と区別する）
+	if c.language == "python" && (first == roleSwitch || first == roleArm) && !strings.HasSuffix(strings.TrimSpace(line), ":") {
+		first = 0
+	}
+	for len(c.stack) > 0 {
+		top := c.stack[len(c.stack)-1]
+		// Ruby の when は case と同じ字下げに並ぶ
+		if top.indent < indent || (top.indent == indent && first == roleArm && top.switch_) {
+			break
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+	if definition {
+		// 関数の定義行自体は数えない
+		return
+	}
+	for i, tok := range tokens {
+		role := c.roles[tok]
+		if i == 0 {
+			role = first
+		} else if c.language == "python" && (role == roleSwitch || role == roleArm) {
+			role = 0
+		}
+		switch {
+		case tok == "&&" || tok == "||" || role == roleLogical:
+			c.logical(tok)
+		case tok == "?" || role == roleIf || role == roleLoop:
+			c.cyclomatic++
+			c.control(true)
+		case role == rolePlainLoop || role == roleSwitch:
+			c.control(true)
+		case role == roleCatch:
+			c.cyclomatic++
+			c.control(true)
+		case role == roleElseIf:
+			c.cyclomatic++
+			c.control(false)
+		case role == roleElse && i == 0:
+			if len(tokens) > 1 && c.roles[tokens[1]] == roleIf {
+				c.cyclomatic++
+				tokens[1] = ""
+			}
+			c.control(false)
+		case role == roleArm:
+			c.cyclomatic++
+		}
+		if i == 0 && role != 0 && role != roleLogical && role != roleArm {
+			c.stack = append(c.stack, metricsFrame{control: true, switch_: role == roleSwitch, indent: indent})
+		}
+	}
+	c.lastLogical = ""
+}
+
+// braceLine 波括弧で入れ子を判断する言語の1行
+func (c *complexityCounter) braceLine(tokens []string) {
+	for i, tok := range tokens {
+		role := c.roles[tok]
+		switch {
+		case tok == "(" || tok == "[":
+			c.parens++
+		case tok == ")" || tok == "]":
+			if c.parens > 0 {
+				c.parens--
+			}
+		case tok == "{":
+			frame := metricsFrame{control: c.pending != 0 && c.pending != roleArm, switch_: c.pending == roleSwitch}
+			if len(c.stack) == 0 && !c.bodyOpened {
+				// 関数本体自体は入れ子に数えない
+				frame.control = false
+				c.bodyOpened = true
+			}
+			c.stack = append(c.stack, frame)
+			c.pending = 0
+			c.lastLogical = ""
+		case tok == "}":
+			if len(c.stack) > 0 {
+				c.stack = c.stack[:len(c.stack)-1]
+			}
+			c.lastLogical = ""
+		case tok == ";":
+			if c.parens == 0 {
+				c.pending = 0
+				c.lastLogical = ""
+			}
+		case tok == "&&" || tok == "||" || role == roleLogical:
+			c.logical(tok)
+		case tok == "??":
+			c.cyclomatic++
+		case tok == "?":
+			c.cyclomatic++
+			c.control(true)
+		case tok == "=>" || tok == "->":
+			c.arrow(tokens, i)
+		case tok == "function" && (c.language == "javascript" || c.language == "typescript"):
+			c.pending = roleNest
+		case role == roleElse:
+			switch {
+			case i+1 < len(tokens) && tokens[i+1] == "->":
+				// Kotlin の when の else -> は分岐先
+			case i+1 < len(tokens) && c.roles[tokens[i+1]] == roleIf:
+				c.cyclomatic++
+				c.control(false)
+				tokens[i+1] = ""
+				c.pending = roleElse
+			default:
+				c.control(false)
+				c.pending = roleElse
+			}
+		case role == roleIf || role == roleLoop:
+			// do { } while (...) の while は本体を持たない
+			if !(tok == "while" && i > 0 && tokens[i-1] == "}") {
+				c.pending = role
+			}
+			c.cyclomatic++
+			c.control(true)
+		case role == roleElseIf:
+			c.cyclomatic++
+			c.control(false)
+			c.pending = role
+		case role == rolePlainLoop || role == roleSwitch || role == roleCatch:
+			if role == roleCatch {
+				c.cyclomatic++
+			}
+			c.control(true)
+			c.pending = role
+		case role == roleNest:
+			c.pending = role
+		case role == roleArm:
+			c.cyclomatic++
+		}
+	}
+}
+
+// arrow Rust の match・Kotlin の when の分岐先（_ と else は数えない）と、JavaScript・C# のラムダ式
+func (c *complexityCounter) arrow(tokens []string, i int) {
+	tok := tokens[i]
+	arm := (c.language == "rust" && tok == "=>") || (c.language == "kotlin" && tok == "->")
+	if arm && len(c.stack) > 0 && c.stack[len(c.stack)-1].switch_ && c.parens == 0 {
+		if i == 0 || (tokens[i-1] != "_" && tokens[i-1] != "else") {
+			c.cyclomatic++
+		}
+		c.pending = roleArm
+		return
+	}
+	if tok == "=>" && (c.language == "javascript" || c.language == "typescript" || c.language == "csharp") {
+		c.pending = roleNest
+	}
+}
+
+// nextCodeLine ln 行目より後で最初の空でない行（前後の空白を除く）
+func nextCodeLine(masked []string, ln, to int) string {
+	for i := ln; i < to && i < len(masked); i++ {
+		if trimmed := strings.TrimSpace(masked[i]); trimmed != "" {
+			return trimmed
+		}
+	}
+	return ""
+}
+
+// metricsTokens コメント・文字列を除いた行を、語と複雑度に関わる記号に分ける
+func metricsTokens(line, language string) []string {
+	var tokens []string
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case isCallIdentByte(c):
+			j := i
+			for j < len(line) && isCallIdentByte(line[j]) {
+				j++
+			}
+			tokens = append(tokens, line[i:j])
+			i = j
+			continue
+		case strings.HasPrefix(line[i:], "&&"), strings.HasPrefix(line[i:], "||"), strings.HasPrefix(line[i:], "=>"), strings.HasPrefix(line[i:], "->"):
+			tokens = append(tokens, line[i:i+2])
+			i += 2
+			continue
+		case strings.HasPrefix(line[i:], "??"):
+			if nullCoalescingLanguages[language] {
+				tokens = append(tokens, "??")
+			}
+			i += 2
+			continue
+		case c == '?':
+			// 前後に空白のある ? だけを三項演算子とみなす（?. や型の ? と区別する）
+			if ternaryLanguages[language] && i > 0 && line[i-1] == ' ' && i+1 < len(line) && line[i+1] == ' ' {
+				tokens = append(tokens, "?")
+			}
+		case strings.IndexByte("{}();[]", c) >= 0:
+			tokens = append(tokens, string(c))
+		}
+		i++
+	}
+	return tokens
+}
+
+// summarize 関数の指標からファイルの合計・最大を求め、ホットスポットの値を付ける
+func (m *FileMetrics) summarize() {
+	m.Cyclomatic, m.MaxCyclomatic, m.Cognitive, m.MaxCognitive, m.MaxNesting, m.Hotspot = 0, 0, 0, 0, 0, 0
+	for i := range m.Functions {
+		fn := &m.Functions[i]
+		fn.Hotspot = functionHotspot(fn)
+		m.Cyclomatic += fn.Cyclomatic
+		m.Cognitive += fn.Cognitive
+		m.MaxCyclomatic = max(m.MaxCyclomatic, fn.Cyclomatic)
+		m.MaxCognitive = max(m.MaxCognitive, fn.Cognitive)
+		m.MaxNesting = max(m.MaxNesting, fn.MaxNesting)
+		m.Hotspot += fn.Hotspot
+	}
+	m.Hotspot = math.Round(m.Hotspot*100) / 100
+	sort.SliceStable(m.Functions, func(i, j int) bool { return m.Functions[i].Line < m.Functions[j].Line })
+}
+
+// functionHotspot 変更履歴を使わないホットスポットの値
+// 複雑度（循環的 + 認知的）に、呼び出し元の数の対数で重みを付ける（複雑で多くの箇所から使われる関数ほど高い）
+func functionHotspot(fn *FunctionMetrics) float64 {
+	score := float64(fn.Cyclomatic+fn.Cognitive) * math.Log2(2+float64(fn.FanIn))
+	return math.Round(score*100) / 100
+}
@@ -0,0 +1,355 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"reverse-engineering-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// プロンプトに載せるホットスポットの関数の数
+const promptHotspotFunctions = 5
+
+// ProjectMetrics プロジェクト全体の指標とホットスポットの順位
+type ProjectMetrics struct {
+	Files         int                         `json:"files"`
+	Functions     int                         `json:"functions"`
+	PhysicalLOC   int                         `json:"physical_loc"`
+	LogicalLOC    int                         `json:"logical_loc"`
+	CommentLOC    int                         `json:"comment_loc"`
+	BlankLOC      int                         `json:"blank_loc"`
+	CommentRatio  float64                     `json:"comment_ratio"` // コメント行 / 空行以外の行
+	AvgCyclomatic float64                     `json:"avg_cyclomatic"`
+	MaxCyclomatic int                         `json:"max_cyclomatic"`
+	AvgCognitive  float64                     `json:"avg_cognitive"`
+	MaxCognitive  int                         `json:"max_cognitive"`
+	MaxNesting    int                         `json:"max_nesting"`
+	Languages     map[string]*LanguageMetrics `json:"languages"`
+	SortBy        string                      `json:"sort_by"`
+	Hotspots      []FunctionHotspot           `json:"hotspots"` // 関数の上位
+	FileHotspots  []FileMetrics               `json:"file_hotspots"`
+}
+
+// LanguageMetrics 言語ごとの集計
+type LanguageMetrics struct {
+	Files      int `json:"files"`
+	Functions  int `json:"functions"`
+	LogicalLOC int `json:"logical_loc"`
+}
+
+// FunctionHotspot ファイル名付きの関数の指標
+type FunctionHotspot struct {
+	FileID uint   `json:"file_id"`
+	File   string `json:"file"`
+	FunctionMetrics
+}
+
+// 順位付けに使える指標（関数とファイルそれぞれの値）
+var metricsSortKeys = map[string]struct {
+	function func(*FunctionMetrics) float64
+	file     func(*FileMetrics) float64
+}{
+	"hotspot": {
+		func(f *FunctionMetrics) float64 { return f.Hotspot },
+		func(f *FileMetrics) float64 { return f.Hotspot },
+	},
+	"cyclomatic": {
+		func(f *FunctionMetrics) float64 { return float64(f.Cyclomatic) },
+		func(f *FileMetrics) float64 { return float64(f.Cyclomatic) },
+	},
+	"cognitive": {
+		func(f *FunctionMetrics) float64 { return float64(f.Cognitive) },
+		func(f *FileMetrics) float64 { return float64(f.Cognitive) },
+	},
+	"nesting": {
+		func(f *FunctionMetrics) float64 { return float64(f.MaxNesting) },
+		func(f *FileMetrics) float64 { return float64(f.MaxNesting) },
+	},
+	"fan_in": {
+		func(f *FunctionMetrics) float64 { return float64(f.FanIn) },
+		func(f *FileMetrics) float64 { return float64(f.FanIn) },
+	},
+	"fan_out": {
+		func(f *FunctionMetrics) float64 { return float64(f.FanOut) },
+		func(f *FileMetrics) float64 { return float64(f.FanOut) },
+	},
+	"loc": {
+		func(f *FunctionMetrics) float64 { return float64(f.LogicalLOC) },
+		func(f *FileMetrics) float64 { return float64(f.LogicalLOC) },
+	},
+}
+
+// ComputeProjectMetrics プロジェクトのソースファイルを計測し、呼び出しグラフから関数とファイルのファンイン・ファンアウトを求める
+// ミニファイされた JavaScript は指標に意味がないので計測せず、名前を skipped に返す
+func ComputeProjectMetrics(files []models.File) ([]*FileMetrics, []string) {
+	var metrics []*FileMetrics
+	var skipped []string
+	var measured []models.File
+	for _, file := range files {
+		if file.Content == "" || !MetricsLanguages(file.Language) {
+			continue
+		}
+		if file.Language == "javascript" && IsMinifiedJS(file.Content) {
+			skipped = append(skipped, file.Name)
+			continue
+		}
+		metrics = append(metrics, ComputeFileMetrics(file))
+		measured = append(measured, file)
+	}
+	if len(metrics) > 0 {
+		applyCallGraphMetrics(metrics, BuildCallGraph(measured))
+	}
+	return metrics, skipped
+}
+
+// applyCallGraphMetrics 呼び出しグラフのノードを関数の指標に対応付け、ファンイン・ファンアウトを数える
+// ノードと関数はファイル・定義行・名前で対応付ける
+func applyCallGraphMetrics(metrics []*FileMetrics, graph *CallGraph) {
+	byKey := make(map[string]*FunctionMetrics)
+	for _, m := range metrics {
+		for i := range m.Functions {
+			fn := &m.Functions[i]
+			byKey[fmt.Sprintf("%d:%d:%s", m.FileID, fn.Line, fn.Name)] = fn
+		}
+	}
+	nodes := make(map[string]*CallGraphNode, len(graph.Nodes))
+	for i := range graph.Nodes {
+		nodes[graph.Nodes[i].ID] = &graph.Nodes[i]
+	}
+
+	callerFiles := make(map[uint]map[uint]bool)
+	calleeFiles := make(map[uint]map[uint]bool)
+	for _, edge := range graph.Edges {
+		from, to := nodes[edge.From], nodes[edge.To]
+		if from == nil || to == nil || edge.From == edge.To {
+			continue
+		}
+		if fn := byKey[fmt.Sprintf("%d:%d:%s", from.FileID, from.Line, from.Name)]; fn != nil {
+			fn.FanOut++
+		}
+		if fn := byKey[fmt.Sprintf("%d:%d:%s", to.FileID, to.Line, to.Name)]; fn != nil {
+			fn.FanIn++
+		}
+		if from.FileID != to.FileID {
+			if callerFiles[to.FileID] == nil {
+				callerFiles[to.FileID] = make(map[uint]bool)
+			}
+			callerFiles[to.FileID][from.FileID] = true
+			if calleeFiles[from.FileID] == nil {
+				calleeFiles[from.FileID] = make(map[uint]bool)
+			}
+			calleeFiles[from.FileID][to.FileID] = true
+		}
+	}
+	for _, m := range metrics {
+		m.FanIn, m.FanOut = len(callerFiles[m.FileID]), len(calleeFiles[m.FileID])
+		m.summarize()
+	}
+}
+
+// AggregateMetrics ファイルごとの指標をプロジェクト全体に集計し、sortBy の指標で関数とファイルの上位 limit 件を並べる
+// sortBy は hotspot, cyclomatic, cognitive, nesting, fan_in, fan_out, loc のいずれか
+func AggregateMetrics(metrics []*FileMetrics, sortBy string, limit int) (*ProjectMetrics, error) {
+	key, ok := metricsSortKeys[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("sort must be one of hotspot, cyclomatic, cognitive, nesting, fan_in, fan_out, loc")
+	}
+	p := &ProjectMetrics{
+		Languages:    make(map[string]*LanguageMetrics),
+		SortBy:       sortBy,
+		Hotspots:     []FunctionHotspot{},
+		FileHotspots: []FileMetrics{},
+	}
+	cyclomatic, cognitive := 0, 0
+	for _, m := range metrics {
+		p.Files++
+		p.Functions += len(m.Functions)
+		p.PhysicalLOC += m.PhysicalLOC
+		p.LogicalLOC += m.LogicalLOC
+		p.CommentLOC += m.CommentLOC
+		p.BlankLOC += m.BlankLOC
+		cyclomatic += m.Cyclomatic
+		cognitive += m.Cognitive
+		p.MaxCyclomatic = max(p.MaxCyclomatic, m.MaxCyclomatic)
+		p.MaxCognitive = max(p.MaxCognitive, m.MaxCognitive)
+		p.MaxNesting = max(p.MaxNesting, m.MaxNesting)
+
+		lang := p.Languages[m.Language]
+		if lang == nil {
+			lang = &LanguageMetrics{}
+			p.Languages[m.Language] = lang
+		}
+		lang.Files++
+		lang.Functions += len(m.Functions)
+		lang.LogicalLOC += m.LogicalLOC
+
+		for _, fn := range m.Functions {
+			p.Hotspots = append(p.Hotspots, FunctionHotspot{FileID: m.FileID, File: m.Name, FunctionMetrics: fn})
+		}
+		summary := *m
+		summary.Functions = nil
+		p.FileHotspots = append(p.FileHotspots, summary)
+	}
+	if nonBlank := p.PhysicalLOC - p.BlankLOC; nonBlank > 0 {
+		p.CommentRatio = roundMetric(float64(p.CommentLOC) / float64(nonBlank))
+	}
+	if p.Functions > 0 {
+		p.AvgCyclomatic = roundMetric(float64(cyclomatic) / float64(p.Functions))
+		p.AvgCognitive = roundMetric(float64(cognitive) / float64(p.Functions))
+	}
+
+	sort.SliceStable(p.Hotspots, func(i, j int) bool {
+		a, b := key.function(&p.Hotspots[i].FunctionMetrics), key.function(&p.Hotspots[j].FunctionMetrics)
+		if a != b {
+			return a > b
+		}
+		return p.Hotspots[i].Hotspot > p.Hotspots[j].Hotspot
+	})
+	sort.SliceStable(p.FileHotspots, func(i, j int) bool {
+		a, b := key.file(&p.FileHotspots[i]), key.file(&p.FileHotspots[j])
+		if a != b {
+			return a > b
+		}
+		return p.FileHotspots[i].Hotspot > p.FileHotspots[j].Hotspot
+	})
+	if limit > 0 && len(p.Hotspots) > limit {
+		p.Hotspots = p.Hotspots[:limit]
+	}
+	if limit > 0 && len(p.FileHotspots) > limit {
+		p.FileHotspots = p.FileHotspots[:limit]
+	}
+	return p, nil
+}
+
+func roundMetric(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// Record 保存用のモデルにする
+func (m *FileMetrics) Record(projectID, analysisID uint) models.FileMetric {
+	functions, _ := json.Marshal(m.Functions)
+	return models.FileMetric{
+		ProjectID:     projectID,
+		FileID:        m.FileID,
+		AnalysisID:    analysisID,
+		Language:      m.Language,
+		PhysicalLOC:   m.PhysicalLOC,
+		LogicalLOC:    m.LogicalLOC,
+		CommentLOC:    m.CommentLOC,
+		BlankLOC:      m.BlankLOC,
+		FunctionCount: len(m.Functions),
+		Cyclomatic:    m.Cyclomatic,
+		MaxCyclomatic: m.MaxCyclomatic,
+		Cognitive:     m.Cognitive,
+		MaxCognitive:  m.MaxCognitive,
+		MaxNesting:    m.MaxNesting,
+		FanIn:         m.FanIn,
+		FanOut:        m.FanOut,
+		Hotspot:       m.Hotspot,
+		Functions:     string(functions),
+	}
+}
+
+// FileMetricsFromRecord 保存した指標を読み戻す（name はモデルに持たないので呼び出し側で渡す）
+func FileMetricsFromRecord(record models.FileMetric, name string) *FileMetrics {
+	m := &FileMetrics{
+		FileID:        record.FileID,
+		Name:          name,
+		Language:      record.Language,
+		PhysicalLOC:   record.PhysicalLOC,
+		LogicalLOC:    record.LogicalLOC,
+		CommentLOC:    record.CommentLOC,
+		BlankLOC:      record.BlankLOC,
+		Cyclomatic:    record.Cyclomatic,
+		MaxCyclomatic: record.MaxCyclomatic,
+		Cognitive:     record.Cognitive,
+		MaxCognitive:  record.MaxCognitive,
+		MaxNesting:    record.MaxNesting,
+		FanIn:         record.FanIn,
+		FanOut:        record.FanOut,
+		Hotspot:       record.Hotspot,
+	}
+	json.Unmarshal([]byte(record.Functions), &m.Functions)
+	return m
+}
+
+// RemoveFileMetrics ファイルの指標を削除する
+func RemoveFileMetrics(db *gorm.DB, fileID uint) error {
+	return db.Where("file_id = ?", fileID).Delete(&models.FileMetric{}).Error
+}
+
+// FormatMetricsForPrompt AI に渡すプロンプトに載せる指標の要約（lang はプロンプトの出力言語）
+func FormatMetricsForPrompt(m *FileMetrics, lang string) string {
+	if m == nil {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(localize(lang, "計測済みのコード指標（静的解析で算出した値）：\n"))
+	fmt.Fprintf(&b, localize(lang, "- 物理行 %d、論理行 %d、コメント行 %d、空行 %d\n"), m.PhysicalLOC, m.LogicalLOC, m.CommentLOC, m.BlankLOC)
+	if len(m.Functions) == 0 {
+		return b.String()
+	}
+	fmt.Fprintf(&b, localize(lang, "- 関数 %d 個、循環的複雑度 合計 %d・最大 %d、認知的複雑度 合計 %d・最大 %d、入れ子の最大の深さ %d\n"),
+		len(m.Functions), m.Cyclomatic, m.MaxCyclomatic, m.Cognitive, m.MaxCognitive, m.MaxNesting)
+	fmt.Fprintf(&b, localize(lang, "- このファイルを呼び出している他のファイル %d 個、このファイルが呼び出している他のファイル %d 個\n"), m.FanIn, m.FanOut)
+
+	functions := append([]FunctionMetrics(nil), m.Functions...)
+	sort.SliceStable(functions, func(i, j int) bool { return functions[i].Hotspot > functions[j].Hotspot })
+	if len(functions) > promptHotspotFunctions {
+		functions = functions[:promptHotspotFunctions]
+	}
+	b.WriteString(localize(lang, "複雑度の高い関数：\n"))
+	for _, fn := range functions {
+		name := fn.Name
+		if fn.Container != "" {
+			name = fn.Container + "." + fn.Name
+		}
+		fmt.Fprintf(&b, localize(lang, "- %s（%d〜%d行目）: 循環的複雑度 %d、認知的複雑度 %d、入れ子 %d、ファンイン %d、ファンアウト %d\n"),
+			name, fn.Line, fn.EndLine, fn.Cyclomatic, fn.Cognitive, fn.MaxNesting, fn.FanIn, fn.FanOut)
+	}
+	return b.String()
+}
+
+// runMetrics プロジェクトのソースを計測し、ファイルごとの指標を保存し直す
+func (w *AnalysisWorker) runMetrics(analysis *models.Analysis, files []models.File) (string, error) {
+	metrics, skipped := ComputeProjectMetrics(files)
+	if len(metrics) == 0 {
+		return "", fmt.Errorf("no source files to measure")
+	}
+
+	records := make([]models.FileMetric, 0, len(metrics))
+	for _, m := range metrics {
+		records = append(records, m.Record(analysis.ProjectID, analysis.ID))
+	}
+	err := w.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("project_id = ?", analysis.ProjectID).Delete(&models.FileMetric{}).Error; err != nil {
+			return err
+		}
+		return tx.CreateInBatches(records, 200).Error
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to save metrics: %w", err)
+	}
+
+	project, err := AggregateMetrics(metrics, "hotspot", 20)
+	if err != nil {
+		return "", err
+	}
+	result := map[string]interface{}{
+		"metrics": project,
+		"files":   metrics,
+	}
+	if len(skipped) > 0 {
+		result["skipped"] = skipped
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+)
+
+// goFileMetrics Go のソースを構文解析し、論理行（宣言と文の数）と関数ごとの指標を求める
+// 構文エラーのあるファイルは ok = false を返し、字句による計測に任せる
+func goFileMetrics(content string) ([]FunctionMetrics, int, bool) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", content, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, 0, false
+	}
+
+	logical := 1 // package 句
+	functions := []FunctionMetrics{}
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			logical += len(d.Specs)
+		case *ast.FuncDecl:
+			fm := FunctionMetrics{
+				Name:       d.Name.Name,
+				Line:       fset.Position(d.Pos()).Line,
+				EndLine:    fset.Position(d.End()).Line,
+				LogicalLOC: 1 + goStatementCount(d.Body),
+			}
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				fm.Container = goReceiverName(d.Recv.List[0].Type)
+			}
+			c := &goComplexity{cyclomatic: 1}
+			if d.Body != nil {
+				c.visit(d.Body, 0)
+			}
+			fm.Cyclomatic, fm.Cognitive, fm.MaxNesting = c.cyclomatic, c.cognitive, c.maxNesting
+			logical += fm.LogicalLOC
+			functions = append(functions, fm)
+		}
+	}
+	return functions, logical, true
+}
+
+// goStatementCount ブロックの中の文の数（ブロック自体と空文は数えない）
+func goStatementCount(body *ast.BlockStmt) int {
+	if body == nil {
+		return 0
+	}
+	count := 0
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.BlockStmt, *ast.EmptyStmt:
+		case ast.Stmt:
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// goComplexity 関数本体の複雑度を数える
+// 認知的複雑度は if・for・switch・select に 1 + 入れ子の深さ、else・else if・ラベル付きの分岐・
+// 同じ論理演算子の連なりごとに 1 を足す。関数リテラルは入れ子を深くする
+type goComplexity struct {
+	cyclomatic int
+	cognitive  int
+	maxNesting int
+}
+
+func (c *goComplexity) control(nesting int, weighted bool) {
+	if weighted {
+		c.cognitive += 1 + nesting
+	} else {
+		c.cognitive++
+	}
+	if nesting+1 > c.maxNesting {
+		c.maxNesting = nesting + 1
+	}
+}
+
+func (c *goComplexity) visit(node ast.Node, nesting int) {
+	if node == nil {
+		return
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch s := n.(type) {
+		case *ast.IfStmt:
+			c.ifStmt(s, nesting, false)
+			return false
+		case *ast.ForStmt:
+			c.cyclomatic++
+			c.control(nesting, true)
+			c.visitStmt(s.Init, nesting)
+			c.visitExpr(s.Cond, nesting)
+			c.visitStmt(s.Post, nesting)
+			c.visit(s.Body, nesting+1)
+			return false
+		case *ast.RangeStmt:
+			c.cyclomatic++
+			c.control(nesting, true)
+			c.visitExpr(s.X, nesting)
+			c.visit(s.Body, nesting+1)
+			return false
+		case *ast.SwitchStmt:
+			c.control(nesting, true)
+			c.visitStmt(s.Init, nesting)
+			c.visitExpr(s.Tag, nesting)
+			c.clauses(s.Body, nesting)
+			return false
+		case *ast.TypeSwitchStmt:
+			c.control(nesting, true)
+			c.visitStmt(s.Init, nesting)
+			c.visitStmt(s.Assign, nesting)
+			c.clauses(s.Body, nesting)
+			return false
+		case *ast.SelectStmt:
+			c.control(nesting, true)
+			c.clauses(s.Body, nesting)
+			return false
+		case *ast.FuncLit:
+			c.visit(s.Body, nesting+1)
+			return false
+		case *ast.BranchStmt:
+			if s.Label != nil {
+				c.cognitive++
+			}
+		case *ast.BinaryExpr:
+			if s.Op == token.LAND || s.Op == token.LOR {
+				c.logical(s, nesting)
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (c *goComplexity) visitStmt(s ast.Stmt, nesting int) {
+	if s != nil {
+		c.visit(s, nesting)
+	}
+}
+
+func (c *goComplexity) visitExpr(e ast.Expr, nesting int) {
+	if e != nil {
+		c.visit(e, nesting)
+	}
+}
+
+// ifStmt else if は入れ子の重みなしで、else は 1 だけ数える
+func (c *goComplexity) ifStmt(s *ast.IfStmt, nesting int, elseIf bool) {
+	c.cyclomatic++
+	c.control(nesting, !elseIf)
+	c.visitStmt(s.Init, nesting)
+	c.visitExpr(s.Cond, nesting)
+	c.visit(s.Body, nesting+1)
+	switch e := s.Else.(type) {
+	case *ast.IfStmt:
+		c.ifStmt(e, nesting, true)
+	case *ast.BlockStmt:
+		c.control(nesting, false)
+		c.visit(e, nesting+1)
+	}
+}
+
+// clauses case・default の節（default 以外を循環的複雑度に数える）
+func (c *goComplexity) clauses(body *ast.BlockStmt, nesting int) {
+	for _, stmt := range body.List {
+		switch cc := stmt.(type) {
+		case *ast.CaseClause:
+			if cc.List != nil {
+				c.cyclomatic++
+			}
+			for _, e := range cc.List {
+				c.visitExpr(e, nesting)
+			}
+			for _, s := range cc.Body {
+				c.visit(s, nesting+1)
+			}
+		case *ast.CommClause:
+			if cc.Comm != nil {
+				c.cyclomatic++
+			}
+			c.visitStmt(cc.Comm, nesting)
+			for _, s := range cc.Body {
+				c.visit(s, nesting+1)
+			}
+		}
+	}
+}
+
+// logical && と || の連なりを左から読み、演算子が変わるごとに認知的複雑度を 1 足す
+func (c *goComplexity) logical(e *ast.BinaryExpr, nesting int) {
+	var ops []token.Token
+	var operands []ast.Expr
+	var flatten func(x ast.Expr)
+	flatten = func(x ast.Expr) {
+		if p, ok := x.(*ast.ParenExpr); ok {
+			if b, ok := p.X.(*ast.BinaryExpr); ok && (b.Op == token.LAND || b.Op == token.LOR) {
+				x = b
+			}
+		}
+		if b, ok := x.(*ast.BinaryExpr); ok && (b.Op == token.LAND || b.Op == token.LOR) {
+			flatten(b.X)
+			ops = append(ops, b.Op)
+			flatten(b.Y)
+			return
+		}
+		operands = append(operands, x)
+	}
+	flatten(e)
+	c.cyclomatic += len(ops)
+	for i, op := range ops {
+		if i == 0 || op != ops[i-1] {
+			c.cognitive++
+		}
+	}
+	for _, x := range operands {
+		c.visit(x, nesting)
+	}
+}
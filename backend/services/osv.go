@@ -0,0 +1,315 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"reverse-engineering-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// osvImportBatchSize 1回のトランザクションで書き込む脆弱性の件数
+const osvImportBatchSize = 500
+
+// osvMaxEntrySize 1件の JSON として読み込む上限（これより大きいエントリは読み飛ばす）
+const osvMaxEntrySize = 16 << 20
+
+// OSVRecord OSV スキーマの脆弱性レコード（取り込みに使う項目だけ）
+type OSVRecord struct {
+	ID         string         `json:"id"`
+	Modified   time.Time      `json:"modified"`
+	Published  *time.Time     `json:"published"`
+	Withdrawn  *time.Time     `json:"withdrawn"`
+	Aliases    []string       `json:"aliases"`
+	Summary    string         `json:"summary"`
+	Details    string         `json:"details"`
+	Severity   []OSVSeverity  `json:"severity"`
+	Affected   []OSVAffected  `json:"affected"`
+	References []OSVReference `json:"references"`
+
+	DatabaseSpecific struct {
+		Severity string `json:"severity"` // GitHub Advisory Database の CRITICAL・HIGH・MODERATE・LOW
+	} `json:"database_specific"`
+}
+
+// OSVSeverity 重大度の表記（type は CVSS_V3 など、score はベクトル）
+type OSVSeverity struct {
+	Type  string `json:"type"`
+	Score string `json:"score"`
+}
+
+// OSVAffected 影響するパッケージとバージョン
+type OSVAffected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+		PURL      string `json:"purl,omitempty"`
+	} `json:"package"`
+	Severity []OSVSeverity `json:"severity"`
+	Ranges   []OSVRange    `json:"ranges"`
+	Versions []string      `json:"versions"`
+}
+
+// OSVRange 影響するバージョンの範囲（type は SEMVER・ECOSYSTEM・GIT）
+type OSVRange struct {
+	Type   string     `json:"type"`
+	Events []OSVEvent `json:"events"`
+}
+
+// OSVEvent 範囲の境界（いずれか1つだけが入る）
+type OSVEvent struct {
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+	Limit        string `json:"limit,omitempty"`
+}
+
+// OSVReference 参考情報の URL
+type OSVReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// ImportOSVArchive OSV のデータダンプ（JSON のレコードを集めた zip）を取り込む
+// 同じ ID のレコードは上書きし、取り下げられたレコードは削除する
+func ImportOSVArchive(db *gorm.DB, r io.ReaderAt, size int64, fileName string) (*models.VulnerabilityImport, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip archive: %w", err)
+	}
+
+	record := models.VulnerabilityImport{FileName: fileName}
+	if err := db.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	ecosystems := make(map[string]int)
+	var batch []OSVRecord
+	var withdrawn []string
+	flush := func() error {
+		if err := saveOSVBatch(db, record.ID, batch, withdrawn); err != nil {
+			return err
+		}
+		batch, withdrawn = batch[:0], withdrawn[:0]
+		return nil
+	}
+
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() || !strings.EqualFold(path.Ext(entry.Name), ".json") {
+			continue
+		}
+		osv, err := readOSVEntry(entry)
+		if err != nil || osv.ID == "" {
+			record.Skipped++
+			continue
+		}
+		if osv.Withdrawn != nil {
+			withdrawn = append(withdrawn, osv.ID)
+			record.Withdrawn++
+		} else {
+			batch = append(batch, *osv)
+			record.Imported++
+			seen := make(map[string]bool)
+			for _, affected := range osv.Affected {
+				if eco := osvBaseEcosystem(affected.Package.Ecosystem); eco != "" && !seen[eco] {
+					seen[eco] = true
+					ecosystems[eco]++
+				}
+			}
+		}
+		if len(batch)+len(withdrawn) >= osvImportBatchSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	data, _ := json.Marshal(ecosystems)
+	record.Ecosystems = string(data)
+	if err := db.Save(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// readOSVEntry zip のエントリを1件の OSV レコードとして読む
+func readOSVEntry(entry *zip.File) (*OSVRecord, error) {
+	if entry.UncompressedSize64 > osvMaxEntrySize {
+		return nil, fmt.Errorf("entry too large")
+	}
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	var osv OSVRecord
+	if err := json.NewDecoder(io.LimitReader(rc, osvMaxEntrySize)).Decode(&osv); err != nil {
+		return nil, err
+	}
+	return &osv, nil
+}
+
+// saveOSVBatch レコードをまとめて書き込み、影響するパッケージを入れ替える
+func saveOSVBatch(db *gorm.DB, importID uint, records []OSVRecord, withdrawn []string) error {
+	if len(records) == 0 && len(withdrawn) == 0 {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if len(withdrawn) > 0 {
+			if err := deleteVulnerabilities(tx, withdrawn); err != nil {
+				return err
+			}
+		}
+		if len(records) == 0 {
+			return nil
+		}
+
+		// 同じ ID が1つの文で2回書き込まれないように、後から読んだ方だけを残す
+		latest := make(map[string]int, len(records))
+		for i, osv := range records {
+			latest[osv.ID] = i
+		}
+		unique := records[:0:0]
+		for i, osv := range records {
+			if latest[osv.ID] == i {
+				unique = append(unique, osv)
+			}
+		}
+		records = unique
+
+		vulns := make([]models.Vulnerability, 0, len(records))
+		ids := make([]string, 0, len(records))
+		for _, osv := range records {
+			vulns = append(vulns, osvToVulnerability(osv, importID))
+			ids = append(ids, osv.ID)
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "osv_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"aliases", "summary", "details", "severity", "score", "cvss", "references", "published", "modified", "import_id", "updated_at"}),
+		}).Create(&vulns).Error; err != nil {
+			return err
+		}
+
+		// 上書きしたレコードは ID が返らないことがあるので引き直す
+		var saved []models.Vulnerability
+		if err := tx.Select("id", "osv_id").Where("osv_id IN ?", ids).Find(&saved).Error; err != nil {
+			return err
+		}
+		idByOSV := make(map[string]uint, len(saved))
+		var vulnIDs []uint
+		for _, v := range saved {
+			idByOSV[v.OSVID] = v.ID
+			vulnIDs = append(vulnIDs, v.ID)
+		}
+		if err := tx.Where("vulnerability_id IN ?", vulnIDs).Delete(&models.VulnerablePackage{}).Error; err != nil {
+			return err
+		}
+
+		var packages []models.VulnerablePackage
+		for _, osv := range records {
+			for _, affected := range osv.Affected {
+				if affected.Package.Name == "" {
+					continue
+				}
+				ranges, _ := json.Marshal(affected.Ranges)
+				versions, _ := json.Marshal(affected.Versions)
+				packages = append(packages, models.VulnerablePackage{
+					VulnerabilityID: idByOSV[osv.ID],
+					Ecosystem:       osvBaseEcosystem(affected.Package.Ecosystem),
+					Name:            osvPackageName(osvBaseEcosystem(affected.Package.Ecosystem), affected.Package.Name),
+					Ranges:          string(ranges),
+					Versions:        string(versions),
+				})
+			}
+		}
+		if len(packages) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&packages, osvImportBatchSize).Error
+	})
+}
+
+// deleteVulnerabilities 取り下げられた脆弱性と影響するパッケージを削除する
+func deleteVulnerabilities(tx *gorm.DB, osvIDs []string) error {
+	var ids []uint
+	if err := tx.Model(&models.Vulnerability{}).Where("osv_id IN ?", osvIDs).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Where("vulnerability_id IN ?", ids).Delete(&models.VulnerablePackage{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("id IN ?", ids).Delete(&models.Vulnerability{}).Error
+}
+
+// osvToVulnerability OSV レコードを保存用のモデルにする
+// 重大度は CVSS v3 のベクトルから計算し、無ければ GitHub Advisory Database の評価を使う
+func osvToVulnerability(osv OSVRecord, importID uint) models.Vulnerability {
+	v := models.Vulnerability{
+		OSVID:     osv.ID,
+		Aliases:   strings.Join(osv.Aliases, ","),
+		Summary:   osv.Summary,
+		Details:   osv.Details,
+		Published: osv.Published,
+		Modified:  osv.Modified,
+		ImportID:  importID,
+	}
+	severities := osv.Severity
+	for _, affected := range osv.Affected {
+		severities = append(severities, affected.Severity...)
+	}
+	for _, s := range severities {
+		if !strings.HasPrefix(s.Type, "CVSS_V3") {
+			continue
+		}
+		if score, ok := CVSSv3BaseScore(s.Score); ok && score >= v.Score {
+			v.Score, v.CVSS = score, s.Score
+		}
+	}
+	v.Severity = CVSSSeverity(v.Score)
+	if v.CVSS == "" {
+		switch strings.ToUpper(osv.DatabaseSpecific.Severity) {
+		case "CRITICAL":
+			v.Severity = "critical"
+		case "HIGH":
+			v.Severity = "high"
+		case "MODERATE", "MEDIUM":
+			v.Severity = "medium"
+		case "LOW":
+			v.Severity = "low"
+		}
+	}
+	references := osv.References
+	if references == nil {
+		references = []OSVReference{}
+	}
+	data, _ := json.Marshal(references)
+	v.References = string(data)
+	return v
+}
+
+// osvBaseEcosystem "Debian:11" のようなリリース付きの表記からエコシステム名だけを取り出す
+func osvBaseEcosystem(ecosystem string) string {
+	base, _, _ := strings.Cut(ecosystem, ":")
+	return strings.TrimSpace(base)
+}
+
+// osvPackageName 照合しやすいようにパッケージ名をそろえる（PyPI は PEP 503 で正規化する）
+func osvPackageName(ecosystem, name string) string {
+	if ecosystem == "PyPI" {
+		return normalizePythonName(name)
+	}
+	return name
+}
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"reverse-engineering-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// osvEcosystems SBOM のエコシステムと OSV のエコシステム名の対応
+var osvEcosystems = map[string]string{
+	"golang": "Go",
+	"npm":    "npm",
+	"pypi":   "PyPI",
+	"maven":  "Maven",
+	"cargo":  "crates.io",
+}
+
+// VulnerabilityMatch コンポーネントに当てはまった脆弱性
+type VulnerabilityMatch struct {
+	ID            string         `json:"id"`
+	CVE           []string       `json:"cve"`
+	GHSA          []string       `json:"ghsa"`
+	Aliases       []string       `json:"aliases"`
+	Summary       string         `json:"summary"`
+	Severity      string         `json:"severity,omitempty"`
+	Score         float64        `json:"score,omitempty"`
+	CVSS          string         `json:"cvss,omitempty"`
+	FixedVersions []string       `json:"fixed_versions"`
+	Recommended   string         `json:"recommended,omitempty"` // 今のバージョンより新しい修正版のうち最も古いもの
+	References    []OSVReference `json:"references"`
+}
+
+// VulnerableComponent 脆弱性が見つかったコンポーネント
+type VulnerableComponent struct {
+	Ref             string               `json:"ref"`
+	Ecosystem       string               `json:"ecosystem"`
+	Name            string               `json:"name"`
+	Version         string               `json:"version"`
+	Direct          bool                 `json:"direct"`
+	Scope           string               `json:"scope"`
+	Sources         []SBOMSource         `json:"sources"`
+	Vulnerabilities []VulnerabilityMatch `json:"vulnerabilities"`
+}
+
+// osvQuery 照合するパッケージ（OSV のエコシステム名と照合用の名前）
+type osvQuery struct {
+	ecosystem string
+	name      string
+	version   string
+	component *SBOMComponent
+}
+
+// osvQueryFor コンポーネントを照合に使う形にする（対応していないエコシステムやバージョンの無いものは ok = false）
+func osvQueryFor(c *SBOMComponent) (osvQuery, bool) {
+	ecosystem, ok := osvEcosystems[c.Ecosystem]
+	if !ok || c.Version == "" {
+		return osvQuery{}, false
+	}
+	name := c.Name
+	if c.Group != "" {
+		name = c.Group + ":" + c.Name
+	}
+	return osvQuery{ecosystem: ecosystem, name: osvPackageName(ecosystem, name), version: c.Version, component: c}, true
+}
+
+// MatchVulnerabilities 取り込んだ OSV データベースと照合し、脆弱性のあるコンポーネントを返す
+// Go のバイナリはビルドに使った Go のバージョンを標準ライブラリ（stdlib）として照合する
+// バージョンが分からず照合できなかったコンポーネントの数も返す
+func MatchVulnerabilities(db *gorm.DB, components []*SBOMComponent) ([]VulnerableComponent, int, error) {
+	var queries []osvQuery
+	unresolved := 0
+	for _, c := range components {
+		if c.Type == "application" {
+			if goVersion := c.Properties["go:version"]; c.Ecosystem == "golang" && strings.HasPrefix(goVersion, "go") {
+				queries = append(queries, osvQuery{ecosystem: "Go", name: "stdlib", version: strings.TrimPrefix(goVersion, "go"), component: c})
+			}
+			continue
+		}
+		if q, ok := osvQueryFor(c); ok {
+			queries = append(queries, q)
+		} else if _, supported := osvEcosystems[c.Ecosystem]; supported {
+			unresolved++
+		}
+	}
+
+	namesByEcosystem := make(map[string][]string)
+	for _, q := range queries {
+		if !containsString(namesByEcosystem[q.ecosystem], q.name) {
+			namesByEcosystem[q.ecosystem] = append(namesByEcosystem[q.ecosystem], q.name)
+		}
+	}
+	packagesByKey := make(map[string][]models.VulnerablePackage)
+	for _, ecosystem := range sortedKeys(namesByEcosystem) {
+		var packages []models.VulnerablePackage
+		if err := db.Where("ecosystem = ? AND name IN ?", ecosystem, namesByEcosystem[ecosystem]).Find(&packages).Error; err != nil {
+			return nil, unresolved, err
+		}
+		for _, p := range packages {
+			key := p.Ecosystem + "\x00" + p.Name
+			packagesByKey[key] = append(packagesByKey[key], p)
+		}
+	}
+
+	type hit struct {
+		query    osvQuery
+		packages []models.VulnerablePackage
+	}
+	var hits []hit
+	vulnIDs := make(map[uint]bool)
+	for _, q := range queries {
+		var affected []models.VulnerablePackage
+		for _, p := range packagesByKey[q.ecosystem+"\x00"+q.name] {
+			if osvPackageAffects(p, q.ecosystem, q.version) {
+				affected = append(affected, p)
+				vulnIDs[p.VulnerabilityID] = true
+			}
+		}
+		if affected != nil {
+			hits = append(hits, hit{query: q, packages: affected})
+		}
+	}
+	if len(hits) == 0 {
+		return []VulnerableComponent{}, unresolved, nil
+	}
+
+	ids := make([]uint, 0, len(vulnIDs))
+	for id := range vulnIDs {
+		ids = append(ids, id)
+	}
+	var vulns []models.Vulnerability
+	if err := db.Where("id IN ?", ids).Find(&vulns).Error; err != nil {
+		return nil, unresolved, err
+	}
+	vulnByID := make(map[uint]models.Vulnerability, len(vulns))
+	for _, v := range vulns {
+		vulnByID[v.ID] = v
+	}
+
+	var results []VulnerableComponent
+	for _, h := range hits {
+		c := h.query.component
+		result := VulnerableComponent{
+			Ref:       c.Ref,
+			Ecosystem: h.query.ecosystem,
+			Name:      h.query.name,
+			Version:   h.query.version,
+			Direct:    c.Direct || c.Type == "application",
+			Scope:     c.Scope,
+			Sources:   c.Sources,
+		}
+		seen := make(map[uint]bool)
+		for _, p := range h.packages {
+			v, ok := vulnByID[p.VulnerabilityID]
+			if !ok || seen[v.ID] {
+				continue
+			}
+			seen[v.ID] = true
+			result.Vulnerabilities = append(result.Vulnerabilities, newVulnerabilityMatch(v, h.packages, h.query))
+		}
+		if len(result.Vulnerabilities) == 0 {
+			continue
+		}
+		sort.Slice(result.Vulnerabilities, func(i, j int) bool {
+			a, b := result.Vulnerabilities[i], result.Vulnerabilities[j]
+			if a.Score != b.Score {
+				return a.Score > b.Score
+			}
+			return a.ID < b.ID
+		})
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Ecosystem != results[j].Ecosystem {
+			return results[i].Ecosystem < results[j].Ecosystem
+		}
+		if results[i].Name != results[j].Name {
+			return results[i].Name < results[j].Name
+		}
+		return results[i].Version < results[j].Version
+	})
+	return results, unresolved, nil
+}
+
+// newVulnerabilityMatch 脆弱性の情報と修正版をまとめる
+func newVulnerabilityMatch(v models.Vulnerability, packages []models.VulnerablePackage, q osvQuery) VulnerabilityMatch {
+	m := VulnerabilityMatch{
+		ID:            v.OSVID,
+		CVE:           []string{},
+		GHSA:          []string{},
+		Aliases:       []string{},
+		Summary:       v.Summary,
+		Severity:      v.Severity,
+		Score:         v.Score,
+		CVSS:          v.CVSS,
+		FixedVersions: []string{},
+		References:    []OSVReference{},
+	}
+	for _, id := range append([]string{v.OSVID}, strings.Split(v.Aliases, ",")...) {
+		id = strings.TrimSpace(id)
+		switch {
+		case id == "":
+		case strings.HasPrefix(id, "CVE-"):
+			if !containsString(m.CVE, id) {
+				m.CVE = append(m.CVE, id)
+			}
+		case strings.HasPrefix(id, "GHSA-"):
+			if !containsString(m.GHSA, id) {
+				m.GHSA = append(m.GHSA, id)
+			}
+		}
+		if id != "" && id != v.OSVID && !containsString(m.Aliases, id) {
+			m.Aliases = append(m.Aliases, id)
+		}
+	}
+	if m.Summary == "" {
+		m.Summary, _, _ = strings.Cut(strings.TrimSpace(v.Details), "\n")
+	}
+	if v.References != "" {
+		_ = json.Unmarshal([]byte(v.References), &m.References)
+	}
+
+	for _, p := range packages {
+		if p.VulnerabilityID != v.ID {
+			continue
+		}
+		var ranges []OSVRange
+		_ = json.Unmarshal([]byte(p.Ranges), &ranges)
+		for _, r := range ranges {
+			if r.Type == "GIT" {
+				continue
+			}
+			for _, e := range r.Events {
+				if e.Fixed != "" && !containsString(m.FixedVersions, e.Fixed) {
+					m.FixedVersions = append(m.FixedVersions, e.Fixed)
+				}
+			}
+		}
+	}
+	sort.Slice(m.FixedVersions, func(i, j int) bool {
+		return CompareVersions(q.ecosystem, m.FixedVersions[i], m.FixedVersions[j]) < 0
+	})
+	for _, fixed := range m.FixedVersions {
+		if CompareVersions(q.ecosystem, fixed, q.version) > 0 {
+			m.Recommended = fixed
+			break
+		}
+	}
+	return m
+}
+
+// osvPackageAffects バージョンが影響を受けるかを OSV の versions と ranges で判定する
+func osvPackageAffects(p models.VulnerablePackage, ecosystem, version string) bool {
+	var versions []string
+	if p.Versions != "" {
+		_ = json.Unmarshal([]byte(p.Versions), &versions)
+	}
+	for _, v := range versions {
+		if v == version || CompareVersions(ecosystem, v, version) == 0 {
+			return true
+		}
+	}
+	var ranges []OSVRange
+	if p.Ranges != "" {
+		_ = json.Unmarshal([]byte(p.Ranges), &ranges)
+	}
+	for _, r := range ranges {
+		if r.Type != "GIT" && osvRangeAffects(r, ecosystem, version) {
+			return true
+		}
+	}
+	return false
+}
+
+// osvRangeAffects OSV の評価手順どおりに、境界を古い順に並べて範囲に入っているかを調べる
+// introduced は以上、fixed と limit は以上で範囲外、last_affected はそれより新しければ範囲外とする
+func osvRangeAffects(r OSVRange, ecosystem, version string) bool {
+	events := make([]OSVEvent, len(r.Events))
+	copy(events, r.Events)
+	eventVersion := func(e OSVEvent) string {
+		switch {
+		case e.Introduced != "":
+			return e.Introduced
+		case e.Fixed != "":
+			return e.Fixed
+		case e.LastAffected != "":
+			return e.LastAffected
+		}
+		return e.Limit
+	}
+	compare := func(a, b string) int {
+		switch {
+		case a == "0" && b == "0":
+			return 0
+		case a == "0":
+			return -1
+		case b == "0":
+			return 1
+		}
+		return CompareVersions(ecosystem, a, b)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return compare(eventVersion(events[i]), eventVersion(events[j])) < 0
+	})
+
+	affected := false
+	for _, e := range events {
+		switch {
+		case e.Introduced != "":
+			if compare(version, e.Introduced) >= 0 {
+				affected = true
+			}
+		case e.Fixed != "":
+			if compare(version, e.Fixed) >= 0 {
+				affected = false
+			}
+		case e.LastAffected != "":
+			if compare(version, e.LastAffected) > 0 {
+				affected = false
+			}
+		case e.Limit != "":
+			if compare(version, e.Limit) >= 0 {
+				affected = false
+			}
+		}
+	}
+	return affected
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"reverse-engineering-backend/models"
+)
+
+func TestOSVRangeAffects(t *testing.T) {
+	introduced := func(v string) OSVEvent { return OSVEvent{Introduced: v} }
+	fixed := func(v string) OSVEvent { return OSVEvent{Fixed: v} }
+	lastAffected := func(v string) OSVEvent { return OSVEvent{LastAffected: v} }
+	limit := func(v string) OSVEvent { return OSVEvent{Limit: v} }
+
+	tests := []struct {
+		name      string
+		ecosystem string
+		events    []OSVEvent
+		version   string
+		want      bool
+	}{
+		{"before introduced", "npm", []OSVEvent{introduced("1.0.0"), fixed("1.2.0")}, "0.9.0", false},
+		{"at introduced", "npm", []OSVEvent{introduced("1.0.0"), fixed("1.2.0")}, "1.0.0", true},
+		{"inside", "npm", []OSVEvent{introduced("1.0.0"), fixed("1.2.0")}, "1.1.5", true},
+		{"at fixed", "npm", []OSVEvent{introduced("1.0.0"), fixed("1.2.0")}, "1.2.0", false},
+		{"prerelease of fixed", "npm", []OSVEvent{introduced("1.0.0"), fixed("1.2.0")}, "1.2.0-rc.1", true},
+		{"introduced zero", "Go", []OSVEvent{introduced("0"), fixed("v0.3.1")}, "v0.0.1", true},
+		{"introduced zero after fix", "Go", []OSVEvent{introduced("0"), fixed("v0.3.1")}, "v0.3.1", false},
+		{"no fix", "npm", []OSVEvent{introduced("2.0.0")}, "99.0.0", true},
+		{"last affected", "npm", []OSVEvent{introduced("1.0.0"), lastAffected("1.4.0")}, "1.4.0", true},
+		{"after last affected", "npm", []OSVEvent{introduced("1.0.0"), lastAffected("1.4.0")}, "1.4.1", false},
+		{"at limit", "npm", []OSVEvent{introduced("1.0.0"), limit("1.3.0")}, "1.3.0", false},
+		{"unsorted events", "npm", []OSVEvent{fixed("1.2.0"), introduced("2.0.0"), fixed("2.1.0"), introduced("1.0.0")}, "2.0.5", true},
+		{"between two ranges", "npm", []OSVEvent{introduced("1.0.0"), fixed("1.2.0"), introduced("2.0.0"), fixed("2.1.0")}, "1.5.0", false},
+		{"pypi prerelease", "PyPI", []OSVEvent{introduced("0"), fixed("2.0")}, "2.0rc1", true},
+		{"pypi post release", "PyPI", []OSVEvent{introduced("0"), fixed("2.0")}, "2.0.post1", false},
+		{"pypi local version of fix", "PyPI", []OSVEvent{introduced("0"), fixed("2.0")}, "2.0+deb1", false},
+		{"pypi local version of last affected", "PyPI", []OSVEvent{introduced("0"), lastAffected("2.0")}, "2.0+deb1", false},
+		{"maven qualifier", "Maven", []OSVEvent{introduced("0"), fixed("2.15.0")}, "2.15.0-rc1", true},
+		{"maven numeric", "Maven", []OSVEvent{introduced("2.0"), fixed("2.10")}, "2.9", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := OSVRange{Type: "ECOSYSTEM", Events: tt.events}
+			if got := osvRangeAffects(r, tt.ecosystem, tt.version); got != tt.want {
+				t.Errorf("osvRangeAffects(%v, %q) = %v, want %v", tt.events, tt.version, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOSVPackageAffects(t *testing.T) {
+	marshal := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	pkg := models.VulnerablePackage{
+		Ecosystem: "PyPI",
+		Name:      "example",
+		Versions:  marshal([]string{"0.9", "1.0.0"}),
+		Ranges: marshal([]OSVRange{
+			{Type: "GIT", Events: []OSVEvent{{Introduced: "0"}}},
+			{Type: "ECOSYSTEM", Events: []OSVEvent{{Introduced: "2.0"}, {Fixed: "2.3"}}},
+		}),
+	}
+
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"0.9", true},
+		{"1.0", true}, // versions も PEP 440 の順序で比べる
+		{"1.1", false},
+		{"2.2", true},
+		{"2.3", false},
+	}
+	for _, tt := range tests {
+		if got := osvPackageAffects(pkg, "PyPI", tt.version); got != tt.want {
+			t.Errorf("osvPackageAffects(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
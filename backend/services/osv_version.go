@@ -0,0 +1,300 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+// CompareVersions エコシステムの規則で2つのバージョンを比べる（a < b なら負、等しければ 0、a > b なら正）
+// PyPI は PEP 440、Maven は Maven の ComparableVersion、それ以外（Go・npm・crates.io）は SemVer 2.0 の順序で比べる
+func CompareVersions(ecosystem, a, b string) int {
+	switch ecosystem {
+	case "PyPI":
+		return comparePEP440(a, b)
+	case "Maven":
+		return compareMaven(a, b)
+	default:
+		return compareSemver(a, b)
+	}
+}
+
+// compareSemver SemVer 2.0 の優先順位（先頭の v と +build は無視し、足りない部分は 0 とみなす）
+func compareSemver(a, b string) int {
+	coreA, preA := splitSemver(a)
+	coreB, preB := splitSemver(b)
+	for i := 0; i < max(len(coreA), len(coreB), 3); i++ {
+		if c := compareNumeric(partAt(coreA, i), partAt(coreB, i)); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case preA == "" && preB == "":
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+	idsA, idsB := strings.Split(preA, "."), strings.Split(preB, ".")
+	for i := 0; i < len(idsA) && i < len(idsB); i++ {
+		numA, numB := isDigits(idsA[i]), isDigits(idsB[i])
+		var c int
+		switch {
+		case numA && numB:
+			c = compareNumeric(idsA[i], idsB[i])
+		case numA:
+			c = -1
+		case numB:
+			c = 1
+		default:
+			c = strings.Compare(idsA[i], idsB[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(idsA), len(idsB))
+}
+
+// splitSemver 数値部分とプレリリース部分に分ける
+func splitSemver(v string) ([]string, string) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		v = v[:i]
+	}
+	core, pre, _ := strings.Cut(v, "-")
+	return strings.Split(core, "."), pre
+}
+
+// pep440Pattern PEP 440 の正規化前の表記（エポック・リリース・プレ・ポスト・開発版・ローカル）
+var pep440Pattern = regexp.MustCompile(`^v?(?:(\d+)!)?(\d+(?:\.\d+)*)(?:[-_.]?(a|alpha|b|beta|c|rc|pre|preview)[-_.]?(\d*))?(?:-(\d+)|[-_.]?(post|rev|r)[-_.]?(\d*))?(?:[-_.]?(dev)[-_.]?(\d*))?(?:\+([a-z0-9._-]+))?$`)
+
+// pep440PreRanks プレリリースの種類の順序
+var pep440PreRanks = map[string]int{"a": 0, "alpha": 0, "b": 1, "beta": 1, "c": 2, "rc": 2, "pre": 2, "preview": 2}
+
+// comparePEP440 PEP 440 の順序（1.0.dev1 < 1.0a1 < 1.0 < 1.0+local < 1.0.post1）。読めない表記は SemVer として比べる
+func comparePEP440(a, b string) int {
+	ma := pep440Pattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(a)))
+	mb := pep440Pattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(b)))
+	if ma == nil || mb == nil {
+		return compareSemver(a, b)
+	}
+	if c := compareNumeric(orZero(ma[1]), orZero(mb[1])); c != 0 {
+		return c
+	}
+	relA, relB := strings.Split(ma[2], "."), strings.Split(mb[2], ".")
+	for i := 0; i < max(len(relA), len(relB)); i++ {
+		if c := compareNumeric(partAt(relA, i), partAt(relB, i)); c != 0 {
+			return c
+		}
+	}
+	keyA, keyB := pep440Suffix(ma), pep440Suffix(mb)
+	for i := range keyA {
+		if c := compareInts(keyA[i], keyB[i]); c != 0 {
+			return c
+		}
+	}
+	return comparePEP440Local(ma[10], mb[10])
+}
+
+// comparePEP440Local ローカル版（+ の後ろ）の順序。無いものが最小で、. - _ で区切った部分を順に比べる
+// 数字の部分は数値として文字の部分より後ろ、文字の部分は辞書順、同じところまで一致すれば部分の多い方が後ろ
+func comparePEP440Local(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return -1
+	case b == "":
+		return 1
+	}
+	split := func(r rune) bool { return r == '.' || r == '-' || r == '_' }
+	partsA, partsB := strings.FieldsFunc(a, split), strings.FieldsFunc(b, split)
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		numA, numB := isDigits(partsA[i]), isDigits(partsB[i])
+		var c int
+		switch {
+		case numA && numB:
+			c = compareNumeric(partsA[i], partsB[i])
+		case numA:
+			c = 1
+		case numB:
+			c = -1
+		default:
+			c = strings.Compare(partsA[i], partsB[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(partsA), len(partsB))
+}
+
+// pep440Suffix リリース番号より後ろの順序キー（プレの種類・番号、ポスト番号、開発版番号）
+// 無いものは、プレは開発版だけのとき最小・それ以外は最大、ポストは最小、開発版は最大として扱う
+func pep440Suffix(m []string) [4]int {
+	const none = 1 << 30
+	hasPost := m[5] != "" || m[6] != ""
+	hasDev := m[8] != ""
+	key := [4]int{none, 0, -1, none}
+	switch {
+	case m[3] != "":
+		key[0], key[1] = pep440PreRanks[m[3]], atoiOrZero(m[4])
+	case hasDev && !hasPost:
+		key[0] = -1
+	}
+	if m[5] != "" {
+		key[2] = atoiOrZero(m[5])
+	} else if m[6] != "" {
+		key[2] = atoiOrZero(m[7])
+	}
+	if hasDev {
+		key[3] = atoiOrZero(m[9])
+	}
+	return key
+}
+
+// mavenQualifierRanks Maven の修飾子の順序（空はリリース。未知の修飾子はこれらより後ろで辞書順）
+var mavenQualifierRanks = map[string]int{
+	"alpha": 0, "a": 0, "beta": 1, "b": 1, "milestone": 2, "m": 2, "rc": 3, "cr": 3,
+	"snapshot": 4, "": 5, "ga": 5, "final": 5, "release": 5, "sp": 6,
+}
+
+// compareMaven Maven の ComparableVersion に沿って比べる
+// . と - と数字・文字の境目で区切り、数字は数値として、文字は修飾子の順序で比べる
+func compareMaven(a, b string) int {
+	itemsA, itemsB := mavenItems(a), mavenItems(b)
+	for i := 0; i < max(len(itemsA), len(itemsB)); i++ {
+		var x, y string
+		if i < len(itemsA) {
+			x = itemsA[i]
+		}
+		if i < len(itemsB) {
+			y = itemsB[i]
+		}
+		if c := compareMavenItem(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// mavenItems バージョンを項目に分け、末尾の 0 とリリースを表す修飾子を落とす
+func mavenItems(v string) []string {
+	v = strings.ToLower(strings.TrimSpace(v))
+	var items []string
+	current := ""
+	for i := 0; i < len(v); i++ {
+		ch := v[i]
+		if ch == '.' || ch == '-' {
+			items = append(items, current)
+			current = ""
+			continue
+		}
+		if current != "" && isDigitByte(ch) != isDigitByte(current[len(current)-1]) {
+			items = append(items, current)
+			current = ""
+		}
+		current += string(ch)
+	}
+	items = append(items, current)
+	for len(items) > 0 {
+		last := items[len(items)-1]
+		if isDigits(last) && strings.Trim(last, "0") == "" || !isDigits(last) && mavenQualifierRanks[last] == mavenQualifierRanks[""] {
+			items = items[:len(items)-1]
+			continue
+		}
+		break
+	}
+	return items
+}
+
+// compareMavenItem 数値は修飾子より大きく、欠けた項目は 0 またはリリースとして比べる
+func compareMavenItem(x, y string) int {
+	numX, numY := isDigits(x), isDigits(y)
+	switch {
+	case numX && numY:
+		return compareNumeric(x, y)
+	case numX:
+		if y == "" {
+			return compareNumeric(x, "0")
+		}
+		return 1
+	case numY:
+		if x == "" {
+			return compareNumeric("0", y)
+		}
+		return -1
+	}
+	rankX, knownX := mavenQualifierRanks[x]
+	rankY, knownY := mavenQualifierRanks[y]
+	switch {
+	case knownX && knownY:
+		return compareInts(rankX, rankY)
+	case knownX:
+		return compareInts(rankX, mavenQualifierRanks["sp"]+1)
+	case knownY:
+		return compareInts(mavenQualifierRanks["sp"]+1, rankY)
+	}
+	return strings.Compare(x, y)
+}
+
+// compareNumeric 桁数に制限のない10進数として比べる（数字でなければ辞書順）
+func compareNumeric(a, b string) int {
+	if !isDigits(a) || !isDigits(b) {
+		return strings.Compare(a, b)
+	}
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if c := compareInts(len(a), len(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func partAt(parts []string, i int) string {
+	if i < len(parts) && parts[i] != "" {
+		return parts[i]
+	}
+	return "0"
+}
+
+func orZero(s string) string {
+	if s == "" {
+		return "0"
+	}
+	return s
+}
+
+func atoiOrZero(s string) int {
+	n := 0
+	for i := 0; i < len(s) && n < 1<<28; i++ {
+		n = n*10 + int(s[i]-'0')
+	}
+	return n
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isDigitByte(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigitByte(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
@@ -0,0 +1,61 @@
+package services
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		ecosystem string
+		a, b      string
+		want      int
+	}{
+		// SemVer
+		{"npm", "1.2.3", "1.2.3", 0},
+		{"npm", "v1.2.3", "1.2.3", 0},
+		{"npm", "1.2", "1.2.0", 0},
+		{"npm", "1.2.3", "1.2.10", -1},
+		{"npm", "2.0.0", "1.99.99", 1},
+		{"npm", "1.0.0-alpha", "1.0.0", -1},
+		{"npm", "1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"npm", "1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"npm", "1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"npm", "1.0.0-rc.1", "1.0.0", -1},
+		{"Go", "v1.0.0+build.1", "v1.0.0", 0},
+
+		// PEP 440
+		{"PyPI", "1.0", "1.0.0", 0},
+		{"PyPI", "1.0.dev1", "1.0a1", -1},
+		{"PyPI", "1.0a1", "1.0b1", -1},
+		{"PyPI", "1.0b2", "1.0rc1", -1},
+		{"PyPI", "1.0rc1", "1.0", -1},
+		{"PyPI", "1.0", "1.0.post1", -1},
+		{"PyPI", "1.0.post1.dev1", "1.0.post1", -1},
+		{"PyPI", "1.0-1", "1.0.post1", 0},
+		{"PyPI", "1!0.1", "2.0", 1},
+		{"PyPI", "1.0.ALPHA1", "1.0a1", 0},
+
+		// PEP 440 のローカル版
+		{"PyPI", "1.0+local", "1.0", 1},
+		{"PyPI", "1.0", "1.0+local", -1},
+		{"PyPI", "1.0+local", "1.0.post1", -1},
+		{"PyPI", "1.0+abc", "1.0+abd", -1},
+		{"PyPI", "1.0+ubuntu.1", "1.0+ubuntu.2", -1},
+		{"PyPI", "1.0+1", "1.0+abc", 1},
+		{"PyPI", "1.0+abc.5", "1.0+abc", 1},
+		{"PyPI", "1.0+abc.10", "1.0+abc.9", 1},
+		{"PyPI", "1.0+abc-1", "1.0+abc.1", 0},
+
+		// Maven
+		{"Maven", "1.0", "1.0.0", 0},
+		{"Maven", "1.0-alpha-1", "1.0-beta-1", -1},
+		{"Maven", "1.0-rc1", "1.0", -1},
+		{"Maven", "1.0-SNAPSHOT", "1.0", -1},
+		{"Maven", "1.0", "1.0-sp1", -1},
+		{"Maven", "1.0.Final", "1.0", 0},
+		{"Maven", "1.9", "1.10", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.ecosystem, tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q, %q) = %d, want %d", tt.ecosystem, tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"reverse-engineering-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// OutputLanguages 解析結果・ドキュメント・プロンプトに使える言語（コードから表示名）
+var OutputLanguages = map[string]string{
+	"ja": "日本語",
+	"en": "English",
+}
+
+// DefaultOutputLanguage 環境変数 AI_OUTPUT_LANGUAGE（省略時や対応していない言語なら ja）
+func DefaultOutputLanguage() string {
+	if lang, err := NormalizeOutputLanguage(os.Getenv("AI_OUTPUT_LANGUAGE")); err == nil && lang != "" {
+		return lang
+	}
+	return "ja"
+}
+
+// NormalizeOutputLanguage en-US や JA のような指定を en、ja にそろえる（空なら空のまま返す）
+func NormalizeOutputLanguage(lang string) (string, error) {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "" {
+		return "", nil
+	}
+	if i := strings.IndexAny(lang, "-_"); i > 0 {
+		lang = lang[:i]
+	}
+	if _, ok := OutputLanguages[lang]; !ok {
+		return "", fmt.Errorf("unsupported language: %s (supported: %s)", lang, strings.Join(sortedKeys(OutputLanguages), ", "))
+	}
+	return lang, nil
+}
+
+// ResolveOutputLanguage 指定された言語、プロジェクトの設定、プロジェクトの所有者の設定、既定値の順に決める
+func ResolveOutputLanguage(db *gorm.DB, projectID uint, requested string) string {
+	if requested != "" {
+		return requested
+	}
+	var project models.Project
+	if err := db.Preload("User").Select("id, user_id, output_language").First(&project, projectID).Error; err == nil {
+		if project.OutputLanguage != "" {
+			return project.OutputLanguage
+		}
+		if project.User.OutputLanguage != "" {
+			return project.User.OutputLanguage
+		}
+	}
+	return DefaultOutputLanguage()
+}
+
+// localize 結果やプロンプトに載せる定型文を出力言語に合わせる（日本語の文をキーにして、訳が無ければそのまま返す）
+func localize(lang, text string) string {
+	if translated, ok := outputMessages[lang][text]; ok {
+		return translated
+	}
+	return text
+}
+
+// outputMessages 日本語以外の言語での定型文
+var outputMessages = map[string]map[string]string{
+	"en": {
+		// FormatMetricsForPrompt
+		"計測済みのコード指標（静的解析で算出した値）：\n":                                      "Measured code metrics (computed by static analysis):\n",
+		"- 物理行 %d、論理行 %d、コメント行 %d、空行 %d\n":                               "- %d physical lines, %d logical lines, %d comment lines, %d blank lines\n",
+		"- 関数 %d 個、循環的複雑度 合計 %d・最大 %d、認知的複雑度 合計 %d・最大 %d、入れ子の最大の深さ %d\n": "- %d functions, cyclomatic complexity total %d / max %d, cognitive complexity total %d / max %d, max nesting depth %d\n",
+		"- このファイルを呼び出している他のファイル %d 個、このファイルが呼び出している他のファイル %d 個\n":        "- called by %d other files, calls %d other files\n",
+		"複雑度の高い関数：\n": "Most complex functions:\n",
+		"- %s（%d〜%d行目）: 循環的複雑度 %d、認知的複雑度 %d、入れ子 %d、ファンイン %d、ファンアウト %d\n": "- %s (lines %d-%d): cyclomatic %d, cognitive %d, nesting %d, fan-in %d, fan-out %d\n",
+
+		// 会話
+		"（関係する資料は見つかりませんでした）": "(no relevant sources were found)",
+		"[%d] %s の解析結果\n":     "[%d] result of the %s analysis\n",
+		"[%d] %s（%s の定義）\n":   "[%d] %s (definition of %s)\n",
+		"\n\n参照:\n":           "\n\nReferences:\n",
+		"\n\n（この回答は資料を示していません。内容はコードで確かめてください）\n": "\n\n(This answer does not cite any source; check it against the code.)\n",
+
+		// 調査のツール
+		"プロジェクトのファイルをパス順に一覧する（言語・サイズ・行数付き）":                       "List the project's files in path order (with language, size and line count)",
+		"このパスで始まるファイルだけを一覧する":                                     "Only list files whose path starts with this prefix",
+		"この言語のファイルだけを一覧する":                                        "Only list files in this language",
+		"ファイルの指定した行の範囲を行番号付きで読む（一度に最大200行）":                       "Read a range of lines of a file with line numbers (up to 200 lines at a time)",
+		"list_tree で得たファイルのパス":                                    "File path as returned by list_tree",
+		"読み始める行（1始まり、省略時は1）":                                      "First line to read (1-based, defaults to 1)",
+		"読み終える行（省略時は開始行から200行）":                                   "Last line to read (defaults to 200 lines from the start line)",
+		"ファイルの内容を行ごとに検索し、一致した行を ファイル:行: 内容 の形で返す":                 "Search file contents line by line and return matches as file:line: text",
+		"探す文字列（regex が true なら RE2 の正規表現）":                        "Text to search for (an RE2 regular expression if regex is true)",
+		"対象にするパスのグロブ（例: **/*.go）":                                 "Glob of paths to search (e.g. **/*.go)",
+		"関数・型・メソッド・定数などの定義を名前の部分一致で探す":                            "Find definitions of functions, types, methods, constants and so on by partial name match",
+		"識別子の名前（大文字小文字は区別しない）":                                    "Identifier name (case-insensitive)",
+		"function, method, class, struct, interface, constant など": "function, method, class, struct, interface, constant, etc.",
+		"このプロジェクトで完了した過去の解析の一覧":                                   "List completed past analyses of this project",
+		"過去の解析の結果を読む（一度に4000文字）":                                  "Read the result of a past analysis (4000 characters at a time)",
+		"読み始める位置（文字数、省略時は0）":                                      "Character offset to start reading from (defaults to 0)",
+
+		// 調査のツールの出力
+		"\n…（出力が長いため省略。範囲を絞って呼び出してください）":                         "\n… (output truncated; call again with a narrower range)",
+		"調査に使えるステップを使い切りました。ここまでに分かったことだけで回答し、未確認の点はそう明記してください。": "You have used up the investigation steps. Answer using only what you have found so far, and state clearly which points are unverified.",
+		"（該当するファイルはありません）":                                       "(no matching files)",
+		"…（%d件を超えるため省略。prefix で絞ってください）\n":                       "… (more than %d files; narrow down with prefix)\n",
+		"%s:%d-%d（全%d行）\n": "%s:%d-%d (%d lines in total)\n",
+		"（一致する行はありません）":    "(no matching lines)",
+		"…（%d行を超えるため省略。パターンかパスを絞ってください）\n": "… (more than %d lines; narrow down the pattern or path)\n",
+		"（該当する定義はありません）":                   "(no matching definitions)",
+		"（完了した解析はありません）":                   "(no completed analyses)",
+		"#%d %s（%d-%d / %d chars）\n%s":     "#%d %s (%d-%d / %d chars)\n%s",
+		"\n…（続きは offset=%d で読めます）":         "\n… (continue reading with offset=%d)",
+	},
+}
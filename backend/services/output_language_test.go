@@ -0,0 +1,102 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeOutputLanguage(t *testing.T) {
+	tests := []struct {
+		lang, want string
+		ok         bool
+	}{
+		{"en", "en", true},
+		{" EN-us ", "en", true},
+		{"ja_JP", "ja", true},
+		{"", "", true},
+		{"fr", "", false},
+		{"-en", "", false},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeOutputLanguage(tt.lang)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("NormalizeOutputLanguage(%q) = %q, %v, want %q (ok = %v)", tt.lang, got, err, tt.want, tt.ok)
+		}
+	}
+	if _, err := NormalizeOutputLanguage("de"); err == nil || !strings.Contains(err.Error(), "supported: en, ja") {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestDefaultOutputLanguage(t *testing.T) {
+	for env, want := range map[string]string{"": "ja", "en-GB": "en", "ja": "ja", "fr": "ja"} {
+		t.Setenv("AI_OUTPUT_LANGUAGE", env)
+		if got := DefaultOutputLanguage(); got != want {
+			t.Errorf("AI_OUTPUT_LANGUAGE=%q: DefaultOutputLanguage() = %q, want %q", env, got, want)
+		}
+	}
+
+	// 解析で指定された言語はプロジェクト・ユーザーの設定より優先する
+	if got := ResolveOutputLanguage(nil, 1, "en"); got != "en" {
+		t.Errorf("ResolveOutputLanguage() = %q, want en", got)
+	}
+	// 言語を指定しないプロンプトは AI_OUTPUT_LANGUAGE に従う
+	t.Setenv("AI_OUTPUT_LANGUAGE", "en")
+	if got := NewPromptSet(nil, 0, "", nil).Language(); got != "en" {
+		t.Errorf("PromptSet.Language() = %q, want en", got)
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	const ja = "（一致する行はありません）"
+	if got := localize("en", ja); got != "(no matching lines)" {
+		t.Errorf("localize(en) = %q", got)
+	}
+	// 日本語と訳の無い文はそのまま返す
+	if got := localize("ja", ja); got != ja {
+		t.Errorf("localize(ja) = %q", got)
+	}
+	if got := localize("en", "未登録の文"); got != "未登録の文" {
+		t.Errorf("localize(en) of an unknown text = %q", got)
+	}
+	for lang, messages := range outputMessages {
+		if _, ok := OutputLanguages[lang]; !ok {
+			t.Errorf("messages for unsupported language %q", lang)
+		}
+		for ja, text := range messages {
+			if strings.Count(ja, "%") != strings.Count(text, "%") {
+				t.Errorf("%s: %q and %q have different format verbs", lang, ja, text)
+			}
+		}
+	}
+}
+
+func TestBuiltinPromptLanguages(t *testing.T) {
+	// 既定のテンプレートはどの出力言語にもそろっている
+	entries, err := builtinPrompts.ReadDir("prompts/ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for lang := range OutputLanguages {
+		for _, entry := range entries {
+			if _, err := builtinPrompts.ReadFile("prompts/" + lang + "/" + entry.Name()); err != nil {
+				t.Errorf("%s: %v", lang, err)
+			}
+		}
+	}
+
+	en, err := NewPromptSet(nil, 0, "en", nil).Render("translation", PromptData{SourceLanguage: "日本語", TargetLanguage: "English", Text: "結果"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(en, "Translate it into English") || !strings.HasSuffix(strings.TrimSpace(en), "結果") {
+		t.Errorf("en translation prompt = %q", en)
+	}
+	ja, err := NewPromptSet(nil, 0, "ja", nil).Render("translation", PromptData{SourceLanguage: "English", TargetLanguage: "日本語", Text: "result"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ja == en || !strings.Contains(ja, "日本語") {
+		t.Errorf("ja translation prompt = %q", ja)
+	}
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// pcapng のブロックの種類
+const (
+	pcapngSectionHeader    = 0x0A0D0D0A
+	pcapngInterfaceDesc    = 0x00000001
+	pcapngObsoletePacket   = 0x00000002
+	pcapngSimplePacket     = 0x00000003
+	pcapngEnhancedPacket   = 0x00000006
+	pcapngByteOrderMagic   = 0x1A2B3C4D
+	pcapngByteOrderSwapped = 0x4D3C2B1A
+	pcapngOptionEnd        = 0
+	pcapngOptionTsResol    = 9
+	pcapngOptionTsOffset   = 14
+	pcapMagicMicroseconds  = 0xA1B2C3D4
+	pcapMagicNanoseconds   = 0xA1B23C4D
+)
+
+// CapturedPacket キャプチャファイルの1パケット
+type CapturedPacket struct {
+	Timestamp time.Time
+	LinkType  uint16 // LINKTYPE_*（1: Ethernet, 101: Raw IP, 113: Linux SLL など）
+	Data      []byte
+}
+
+// pcapngInterface Interface Description Block の内容
+type pcapngInterface struct {
+	linkType uint16
+	unitsPS  uint64 // タイムスタンプの1秒あたりの単位数
+	offset   int64  // タイムスタンプに足す秒数
+}
+
+// IsPacketCapture データが pcapng・pcap のキャプチャファイルか
+func IsPacketCapture(data []byte) bool {
+	if len(data) < 12 {
+		return false
+	}
+	if binary.LittleEndian.Uint32(data) == pcapngSectionHeader {
+		return true
+	}
+	magic := binary.LittleEndian.Uint32(data)
+	return magic == pcapMagicMicroseconds || magic == pcapMagicNanoseconds ||
+		binary.BigEndian.Uint32(data) == pcapMagicMicroseconds || binary.BigEndian.Uint32(data) == pcapMagicNanoseconds
+}
+
+// ReadPacketCapture pcapng（またはクラシックな pcap）のファイルからパケットを読む。libpcap は使わない
+func ReadPacketCapture(data []byte) ([]CapturedPacket, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("capture file too short")
+	}
+	if binary.LittleEndian.Uint32(data) == pcapngSectionHeader {
+		return readPcapng(data)
+	}
+	return readPcap(data)
+}
+
+// readPcapng セクションごとにバイトオーダーとインターフェースを切り替えながらブロックを読む
+func readPcapng(data []byte) ([]CapturedPacket, error) {
+	var packets []CapturedPacket
+	var order binary.ByteOrder = binary.LittleEndian
+	var interfaces []pcapngInterface
+	for pos := 0; pos+12 <= len(data); {
+		blockType := order.Uint32(data[pos:])
+		if binary.LittleEndian.Uint32(data[pos:]) == pcapngSectionHeader {
+			// Section Header Block のバイトオーダーの印で以降の読み方を決める
+			switch binary.LittleEndian.Uint32(data[pos+8:]) {
+			case pcapngByteOrderMagic:
+				order = binary.LittleEndian
+			case pcapngByteOrderSwapped:
+				order = binary.BigEndian
+			default:
+				return packets, fmt.Errorf("invalid pcapng byte-order magic at offset %d", pos)
+			}
+			blockType = pcapngSectionHeader
+			interfaces = nil
+		}
+		blockLen := int(order.Uint32(data[pos+4:]))
+		if blockLen < 12 || blockLen%4 != 0 || pos+blockLen > len(data) {
+			if len(packets) > 0 {
+				// 書き込み途中で切れたキャプチャは読めたところまでを使う
+				return packets, nil
+			}
+			return nil, fmt.Errorf("invalid pcapng block length %d at offset %d", blockLen, pos)
+		}
+		block := data[pos : pos+blockLen-4]
+
+		switch blockType {
+		case pcapngInterfaceDesc:
+			if len(block) < 16 {
+				break
+			}
+			iface := pcapngInterface{linkType: order.Uint16(block[8:]), unitsPS: 1_000_000}
+			for _, opt := range pcapngOptions(block[16:], order) {
+				switch opt.code {
+				case pcapngOptionTsResol:
+					if len(opt.value) > 0 {
+						iface.unitsPS = pcapngResolution(opt.value[0])
+					}
+				case pcapngOptionTsOffset:
+					if len(opt.value) >= 8 {
+						iface.offset = int64(order.Uint64(opt.value))
+					}
+				}
+			}
+			interfaces = append(interfaces, iface)
+
+		case pcapngEnhancedPacket, pcapngObsoletePacket:
+			if len(block) < 28 {
+				break
+			}
+			var ifaceID int
+			if blockType == pcapngEnhancedPacket {
+				ifaceID = int(order.Uint32(block[8:]))
+			} else {
+				ifaceID = int(order.Uint16(block[8:]))
+			}
+			if ifaceID >= len(interfaces) {
+				break
+			}
+			iface := interfaces[ifaceID]
+			ts := uint64(order.Uint32(block[12:]))<<32 | uint64(order.Uint32(block[16:]))
+			capLen := int(order.Uint32(block[20:]))
+			if capLen > len(block)-28 {
+				capLen = len(block) - 28
+			}
+			packets = append(packets, CapturedPacket{
+				Timestamp: pcapngTime(ts, iface),
+				LinkType:  iface.linkType,
+				Data:      block[28 : 28+capLen],
+			})
+
+		case pcapngSimplePacket:
+			// Simple Packet Block はインターフェース 0 でタイムスタンプを持たない
+			if len(block) < 12 || len(interfaces) == 0 {
+				break
+			}
+			capLen := int(order.Uint32(block[8:]))
+			if capLen > len(block)-12 {
+				capLen = len(block) - 12
+			}
+			packets = append(packets, CapturedPacket{LinkType: interfaces[0].linkType, Data: block[12 : 12+capLen]})
+		}
+		pos += blockLen
+	}
+	return packets, nil
+}
+
+type pcapngOption struct {
+	code  uint16
+	value []byte
+}
+
+// pcapngOptions ブロックのオプション（4バイト境界に詰められた code・length・value）を読む
+func pcapngOptions(b []byte, order binary.ByteOrder) []pcapngOption {
+	var options []pcapngOption
+	for len(b) >= 4 {
+		code, length := order.Uint16(b), int(order.Uint16(b[2:]))
+		if code == pcapngOptionEnd || 4+length > len(b) {
+			break
+		}
+		options = append(options, pcapngOption{code: code, value: b[4 : 4+length]})
+		padded := 4 + (length+3)&^3
+		if padded > len(b) {
+			break
+		}
+		b = b[padded:]
+	}
+	return options
+}
+
+// pcapngResolution if_tsresol（最上位ビットが 0 なら 10 の負のべき、1 なら 2 の負のべき）
+func pcapngResolution(v byte) uint64 {
+	exp := float64(v & 0x7F)
+	base := 10.0
+	if v&0x80 != 0 {
+		base = 2
+	}
+	units := math.Pow(base, exp)
+	if units < 1 || units > 1e18 {
+		return 1_000_000
+	}
+	return uint64(units)
+}
+
+func pcapngTime(ts uint64, iface pcapngInterface) time.Time {
+	sec := ts / iface.unitsPS
+	frac := ts % iface.unitsPS
+	// ピコ秒などの細かい分解能では frac * 1e9 が 64 ビットに収まらないため 128 ビットで計算する
+	hi, lo := bits.Mul64(frac, 1_000_000_000)
+	nsec, _ := bits.Div64(hi, lo, iface.unitsPS)
+	return time.Unix(int64(sec)+iface.offset, int64(nsec)).UTC()
+}
+
+// readPcap libpcap のクラシックな形式（マイクロ秒・ナノ秒、両バイトオーダー）を読む
+func readPcap(data []byte) ([]CapturedPacket, error) {
+	if len(data) < 24 {
+		return nil, fmt.Errorf("pcap header too short")
+	}
+	var order binary.ByteOrder
+	var nano bool
+	switch {
+	case binary.LittleEndian.Uint32(data) == pcapMagicMicroseconds:
+		order = binary.LittleEndian
+	case binary.LittleEndian.Uint32(data) == pcapMagicNanoseconds:
+		order, nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(data) == pcapMagicMicroseconds:
+		order = binary.BigEndian
+	case binary.BigEndian.Uint32(data) == pcapMagicNanoseconds:
+		order, nano = binary.BigEndian, true
+	default:
+		return nil, fmt.Errorf("not a pcapng or pcap file")
+	}
+	linkType := uint16(order.Uint32(data[20:]))
+
+	var packets []CapturedPacket
+	for pos := 24; pos+16 <= len(data); {
+		sec := int64(order.Uint32(data[pos:]))
+		frac := int64(order.Uint32(data[pos+4:]))
+		capLen := int(order.Uint32(data[pos+8:]))
+		pos += 16
+		if capLen > len(data)-pos {
+			break
+		}
+		if !nano {
+			frac *= 1000
+		}
+		packets = append(packets, CapturedPacket{Timestamp: time.Unix(sec, frac).UTC(), LinkType: linkType, Data: data[pos : pos+capLen]})
+		pos += capLen
+	}
+	return packets, nil
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// pcapngBlock ブロックの種類・全長・本体（4バイト境界まで埋める）・全長を並べる
+func pcapngBlock(order binary.AppendByteOrder, blockType uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	b := order.AppendUint32(nil, blockType)
+	b = order.AppendUint32(b, uint32(12+len(body)))
+	b = append(b, body...)
+	return order.AppendUint32(b, uint32(12+len(body)))
+}
+
+func pcapngSHB(order binary.AppendByteOrder) []byte {
+	body := order.AppendUint32(nil, pcapngByteOrderMagic)
+	body = order.AppendUint16(body, 1)
+	body = order.AppendUint16(body, 0)
+	body = append(body, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff) // セクション長は不明
+	return pcapngBlock(order, pcapngSectionHeader, body)
+}
+
+// pcapngIDB tsresol が 0 ならオプションを付けない
+func pcapngIDB(order binary.AppendByteOrder, linkType uint16, tsresol byte) []byte {
+	body := order.AppendUint16(nil, linkType)
+	body = order.AppendUint16(body, 0)
+	body = order.AppendUint32(body, 65535)
+	if tsresol != 0 {
+		body = order.AppendUint16(body, pcapngOptionTsResol)
+		body = order.AppendUint16(body, 1)
+		body = append(body, tsresol, 0, 0, 0)
+		body = append(body, 0, 0, 0, 0) // opt_endofopt
+	}
+	return pcapngBlock(order, pcapngInterfaceDesc, body)
+}
+
+func pcapngEPB(order binary.AppendByteOrder, iface uint32, ts uint64, data []byte) []byte {
+	body := order.AppendUint32(nil, iface)
+	body = order.AppendUint32(body, uint32(ts>>32))
+	body = order.AppendUint32(body, uint32(ts))
+	body = order.AppendUint32(body, uint32(len(data)))
+	body = order.AppendUint32(body, uint32(len(data)))
+	return pcapngBlock(order, pcapngEnhancedPacket, append(body, data...))
+}
+
+func TestReadPacketCapturePcapng(t *testing.T) {
+	le, be := binary.LittleEndian, binary.BigEndian
+	simple := append(le.AppendUint32(nil, 3), "abc"...)
+	capture := bytes.Join([][]byte{
+		pcapngSHB(le),
+		pcapngIDB(le, linkTypeEthernet, 0),
+		pcapngIDB(le, linkTypeRaw, 9),
+		pcapngEPB(le, 0, 1_600_000_000_123_456, []byte("first")),
+		pcapngEPB(le, 1, 1_600_000_000_123_456_789, []byte("second")),
+		pcapngEPB(le, 5, 0, []byte("unknown interface")),
+		pcapngBlock(le, pcapngSimplePacket, simple),
+		pcapngBlock(le, 0x0BAD, []byte("unknown block")),
+		// 2つ目のセクションはビッグエンディアンで、インターフェースは数え直す
+		pcapngSHB(be),
+		pcapngIDB(be, linkTypeLinuxSLL, 12), // ピコ秒
+		pcapngEPB(be, 0, 1_600_000_000_000_000_000+999_999_999_999, []byte("third")),
+	}, nil)
+	if !IsPacketCapture(capture) {
+		t.Fatal("IsPacketCapture() = false")
+	}
+	packets, err := ReadPacketCapture(capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CapturedPacket{
+		{Timestamp: time.Unix(1_600_000_000, 123_456_000).UTC(), LinkType: linkTypeEthernet, Data: []byte("first")},
+		{Timestamp: time.Unix(1_600_000_000, 123_456_789).UTC(), LinkType: linkTypeRaw, Data: []byte("second")},
+		{LinkType: linkTypeEthernet, Data: []byte("abc")},
+		{Timestamp: time.Unix(1_600_000, 999_999_999).UTC(), LinkType: linkTypeLinuxSLL, Data: []byte("third")},
+	}
+	if !reflect.DeepEqual(packets, want) {
+		t.Errorf("packets = %+v, want %+v", packets, want)
+	}
+
+	// 書き込み途中で切れたファイルは読めたところまでを返す
+	packets, err = ReadPacketCapture(capture[:len(capture)-1])
+	if err != nil || !reflect.DeepEqual(packets, want[:3]) {
+		t.Errorf("truncated capture = %+v, %v, want %+v", packets, err, want[:3])
+	}
+}
+
+func TestReadPacketCaptureInvalid(t *testing.T) {
+	le := binary.LittleEndian
+	badMagic := pcapngSHB(le)
+	le.PutUint32(badMagic[8:], 0x12345678)
+	shortBlock := append(pcapngSHB(le), 1, 0, 0, 0, 8, 0, 0, 0, 0, 0, 0, 0)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short", []byte{0x0a, 0x0d, 0x0d, 0x0a}},
+		{"not a capture", []byte("GET / HTTP/1.1\r\n\r\n")},
+		{"bad byte-order magic", badMagic},
+		{"block length too small", shortBlock},
+		{"block length beyond data", pcapngSHB(le)[:20]},
+		{"truncated pcap header", append(le.AppendUint32(nil, pcapMagicMicroseconds), make([]byte, 12)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadPacketCapture(tt.data); err == nil {
+				t.Error("ReadPacketCapture() error = nil")
+			}
+		})
+	}
+
+	// 壊れたオプション・短すぎるブロックは読み飛ばす
+	idb := pcapngIDB(le, linkTypeEthernet, 0)
+	brokenOption := append(idb[:len(idb)-4:len(idb)-4], 9, 0, 0xff, 0x7f)
+	le.PutUint32(brokenOption[4:], uint32(len(brokenOption)+4))
+	brokenOption = le.AppendUint32(brokenOption, uint32(len(brokenOption)+4))
+	packets, err := ReadPacketCapture(bytes.Join([][]byte{
+		pcapngSHB(le),
+		brokenOption,
+		pcapngBlock(le, pcapngEnhancedPacket, []byte{0, 0, 0, 0}),
+		pcapngEPB(le, 0, 0, []byte("ok")),
+	}, nil))
+	if err != nil || len(packets) != 1 || string(packets[0].Data) != "ok" {
+		t.Errorf("ReadPacketCapture() = %+v, %v", packets, err)
+	}
+}
+
+func TestReadPacketCapturePcap(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		order binary.AppendByteOrder
+		magic uint32
+		frac  uint32
+		nsec  int
+	}{
+		{"little endian microseconds", binary.LittleEndian, pcapMagicMicroseconds, 250, 250_000},
+		{"big endian nanoseconds", binary.BigEndian, pcapMagicNanoseconds, 250, 250},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			o := tt.order
+			capture := o.AppendUint32(nil, tt.magic)
+			capture = o.AppendUint16(capture, 2)
+			capture = o.AppendUint16(capture, 4)
+			capture = append(capture, make([]byte, 12)...)
+			capture = o.AppendUint32(capture, linkTypeEthernet)
+			for _, payload := range []string{"one", "two"} {
+				capture = o.AppendUint32(capture, 1_600_000_000)
+				capture = o.AppendUint32(capture, tt.frac)
+				capture = o.AppendUint32(capture, uint32(len(payload)))
+				capture = o.AppendUint32(capture, uint32(len(payload)))
+				capture = append(capture, payload...)
+			}
+			packets, err := ReadPacketCapture(capture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(packets) != 2 || string(packets[1].Data) != "two" || packets[0].LinkType != linkTypeEthernet ||
+				!packets[0].Timestamp.Equal(time.Unix(1_600_000_000, int64(tt.nsec))) {
+				t.Errorf("packets = %+v", packets)
+			}
+			// 最後のパケットが切れていればそこまでを返す
+			if packets, _ := ReadPacketCapture(capture[:len(capture)-1]); len(packets) != 1 {
+				t.Errorf("truncated capture: got %d packets, want 1", len(packets))
+			}
+		})
+	}
+}
+
+// testTCPFrame Ethernet・IPv4・TCP のフレーム
+func testTCPFrame(src, dst [4]byte, srcPort, dstPort uint16, seq uint32, flags byte, payload string) []byte {
+	tcp := binary.BigEndian.AppendUint16(nil, srcPort)
+	tcp = binary.BigEndian.AppendUint16(tcp, dstPort)
+	tcp = binary.BigEndian.AppendUint32(tcp, seq)
+	tcp = append(tcp, 0, 0, 0, 0, 5<<4, flags, 0xff, 0xff, 0, 0, 0, 0)
+	tcp = append(tcp, payload...)
+
+	ip := []byte{0x45, 0, 0, 0, 0, 0, 0x40, 0, 64, ipProtocolTCP, 0, 0}
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(tcp)))
+	ip = append(append(append(ip, src[:]...), dst[:]...), tcp...)
+
+	frame := make([]byte, 12)
+	frame = binary.BigEndian.AppendUint16(frame, etherTypeIPv4)
+	return append(frame, ip...)
+}
+
+func TestExtractHTTPExchanges(t *testing.T) {
+	client, server := [4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}
+	start := time.Unix(1_600_000_000, 0).UTC()
+	request := "POST /api/items?x=1 HTTP/1.1\r\nHost: api.example.com\r\nContent-Length: 7\r\n\r\n{\"a\":1}"
+	response := "HTTP/1.1 201 Created\r\nContent-Type: application/json\r\nContent-Length: 8\r\n\r\n{\"id\":5}"
+	frames := []struct {
+		up      bool
+		seq     uint32
+		flags   byte
+		payload string
+	}{
+		{true, 1000, tcpFlagSYN, ""},
+		{false, 5000, tcpFlagSYN | tcpFlagACK, ""},
+		// リクエストは2つのセグメントに分かれ、後半が先に届いて前半は再送される
+		{true, 1001 + 20, tcpFlagACK, request[20:]},
+		{true, 1001, tcpFlagACK, request[:20]},
+		{true, 1001, tcpFlagACK, request[:20]},
+		{false, 5001, tcpFlagACK | tcpFlagFIN, response},
+	}
+	var packets []CapturedPacket
+	for i, f := range frames {
+		src, dst, sp, dp := client, server, uint16(40000), uint16(80)
+		if !f.up {
+			src, dst, sp, dp = server, client, 80, 40000
+		}
+		packets = append(packets, CapturedPacket{
+			Timestamp: start.Add(time.Duration(i) * time.Millisecond),
+			LinkType:  linkTypeEthernet,
+			Data:      testTCPFrame(src, dst, sp, dp, f.seq, f.flags, f.payload),
+		})
+	}
+
+	exchanges := ExtractHTTPExchanges(packets, "test.pcapng")
+	if len(exchanges) != 1 {
+		t.Fatalf("got %d exchanges, want 1", len(exchanges))
+	}
+	ex := exchanges[0]
+	if ex.Method != "POST" || ex.URL != "/api/items?x=1" || ex.Server != "api.example.com" || ex.Client != "10.0.0.1" ||
+		string(ex.RequestBody) != `{"a":1}` || ex.Status != 201 || string(ex.ResponseBody) != `{"id":5}` || ex.Source != "test.pcapng" {
+		t.Errorf("exchange = %+v", ex)
+	}
+	if ex.Duration != 2*time.Millisecond {
+		t.Errorf("duration = %v, want 2ms", ex.Duration)
+	}
+
+	// 切れたフレームやリンク層の違うパケットは無視する
+	last := packets[len(packets)-1]
+	ignored := []CapturedPacket{
+		{LinkType: linkTypeEthernet, Data: last.Data[:30]},
+		{LinkType: linkTypeLinuxSLL2, Data: last.Data},
+		{LinkType: 0xffff, Data: last.Data},
+	}
+	if got := ExtractHTTPExchanges(append(ignored, packets...), ""); len(got) != 1 || got[0].Status != 201 {
+		t.Errorf("with broken packets = %+v", got)
+	}
+}
@@ -0,0 +1,393 @@
+package services
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+
+	"reverse-engineering-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// builtinPrompts 出力言語ごとの既定のプロンプト（上書きが無ければこれを使う）
+//
+//go:embed prompts/*/*.tmpl
+var builtinPrompts embed.FS
+
+// PromptNames テンプレートの名前と、テンプレートの中で使えるフィールド
+var PromptNames = map[string][]string{
+	"code_analysis":     {"Language", "Code", "Metrics"},
+	"documentation":     {"Language", "Code"},
+	"pattern_detection": {"Language", "Code", "Metrics"},
+	"dependency_map":    {"Files"},
+	"pyc_decompile":     {"Version", "Structure", "Disassembly"},
+	"binary_diff":       {"Arch", "Changes"},
+	"chat_answer":       {"Sources"},
+	"investigation":     {},
+	"translation":       {"SourceLanguage", "TargetLanguage", "Text"},
+}
+
+// プロンプトの指定の誤り（コントローラーは errors.Is で見分けて 400 を返す）
+var (
+	ErrUnknownPrompt          = errors.New("unknown prompt")
+	ErrInvalidTemplate        = errors.New("invalid template")
+	ErrPromptTemplateNotFound = errors.New("prompt template not found")
+	ErrPreviewNotSupported    = errors.New("preview is not supported")
+)
+
+// PromptData テンプレートに渡す値（テンプレートごとに使うフィールドは PromptNames のとおり）
+type PromptData struct {
+	Language    string
+	Code        string
+	Metrics     string // FormatMetricsForPrompt で作った指標の要約（空なら省く）
+	Files       []FileInfo
+	Version     string // Python のバージョン
+	Structure   string // 復元済みの構造（JSON）
+	Disassembly string
+	Arch        string
+	Changes     string
+	Sources     string // 会話の資料（FormatChatSources で作ったもの）
+
+	SourceLanguage string // 翻訳元の言語の表示名
+	TargetLanguage string // 翻訳先の言語の表示名
+	Text           string // 翻訳する解析結果
+}
+
+// ResolvedPrompt 解決したテンプレートと、その版の識別子
+type ResolvedPrompt struct {
+	Name       string `json:"name"`
+	Source     string `json:"source"`  // builtin, global, team, project, draft
+	Version    string `json:"version"` // 解析に記録する識別子（例: code_analysis@project:3/v2、code_analysis@builtin/en:1a2b3c4d）
+	Language   string `json:"language,omitempty"`
+	TemplateID uint   `json:"template_id,omitempty"`
+	Body       string `json:"body"`
+
+	tmpl *template.Template
+}
+
+// Render テンプレートに値を当てはめる
+func (p *ResolvedPrompt) Render(data PromptData) (string, error) {
+	var sb strings.Builder
+	if err := p.tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt %s: %w", p.Version, err)
+	}
+	return sb.String(), nil
+}
+
+// ParsePromptTemplate テンプレートの構文と、使っているフィールドが PromptData にあるかを確かめる
+func ParsePromptTemplate(name, body string) (*template.Template, error) {
+	if _, ok := PromptNames[name]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPrompt, name)
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+	}
+	// 空の値で一度実行して、存在しないフィールドの参照を見つける
+	if err := tmpl.Execute(&strings.Builder{}, PromptData{Files: []FileInfo{{}}}); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+	}
+	return tmpl, nil
+}
+
+// BuiltinPrompt 埋め込みの既定のテンプレート（版は言語と本文のハッシュ。その言語のものが無ければ日本語を使う）
+func BuiltinPrompt(name, language string) (*ResolvedPrompt, error) {
+	if _, ok := OutputLanguages[language]; !ok {
+		language = "ja"
+	}
+	body, err := builtinPrompts.ReadFile("prompts/" + language + "/" + name + ".tmpl")
+	if err != nil {
+		language = "ja"
+		if body, err = builtinPrompts.ReadFile("prompts/ja/" + name + ".tmpl"); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPrompt, name)
+		}
+	}
+	tmpl, err := ParsePromptTemplate(name, string(body))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	return &ResolvedPrompt{
+		Name:     name,
+		Source:   "builtin",
+		Version:  fmt.Sprintf("%s@builtin/%s:%s", name, language, hex.EncodeToString(sum[:4])),
+		Language: language,
+		Body:     string(body),
+		tmpl:     tmpl,
+	}, nil
+}
+
+// promptFromRecord データベースに保存したテンプレートの版
+func promptFromRecord(record models.PromptTemplate) (*ResolvedPrompt, error) {
+	tmpl, err := ParsePromptTemplate(record.Name, record.Body)
+	if err != nil {
+		return nil, fmt.Errorf("prompt template %d: %w", record.ID, err)
+	}
+	return &ResolvedPrompt{
+		Name:       record.Name,
+		Source:     record.Scope,
+		Version:    PromptVersion(record),
+		Language:   record.Language,
+		TemplateID: record.ID,
+		Body:       record.Body,
+		tmpl:       tmpl,
+	}, nil
+}
+
+// PromptVersion 保存したテンプレートの版の識別子（例: code_analysis@team:payments/v3、言語を限ったものは code_analysis@team:payments/en/v3）
+func PromptVersion(record models.PromptTemplate) string {
+	target := PromptTarget(record.Scope, record.Team, record.ProjectID)
+	if record.Language != "" {
+		target += "/" + record.Language
+	}
+	return fmt.Sprintf("%s@%s/v%d", record.Name, target, record.Version)
+}
+
+// PromptTarget 上書きの対象の表記（global、team:名前、project:ID）
+func PromptTarget(scope, team string, projectID *uint) string {
+	switch scope {
+	case "team":
+		return "team:" + team
+	case "project":
+		if projectID != nil {
+			return fmt.Sprintf("project:%d", *projectID)
+		}
+	}
+	return "global"
+}
+
+// applicablePrompts プロジェクトに使える名前のテンプレート（全体、プロジェクトのチーム、プロジェクト自身のもので、出力言語が合うもの）
+func applicablePrompts(db *gorm.DB, name, language string, projectID uint, team string) *gorm.DB {
+	return db.Where("name = ? AND language IN ?", name, []string{"", language}).
+		Where(db.Where("scope = ?", "global").
+			Or("scope = ? AND team = ? AND team <> ''", "team", team).
+			Or("scope = ? AND project_id = ?", "project", projectID))
+}
+
+// ResolvePrompt プロジェクト、チーム、全体の順に有効な上書きを探し、無ければ出力言語の既定のテンプレートを使う
+// 同じ対象の中では、出力言語を限った上書きをどの言語でも使う上書きより優先する
+// pinnedID を指定すると、その版を優先する（同じ名前のテンプレートの A/B 比較用なので有効でない版も使えるが、
+// 他のプロジェクト・チームのものや出力言語の違うものは ErrPromptTemplateNotFound にする）
+func ResolvePrompt(db *gorm.DB, name, language string, projectID uint, team string, pinnedID uint) (*ResolvedPrompt, error) {
+	if _, ok := PromptNames[name]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPrompt, name)
+	}
+	if db == nil {
+		return BuiltinPrompt(name, language)
+	}
+
+	if pinnedID != 0 {
+		var record models.PromptTemplate
+		if err := applicablePrompts(db, name, language, projectID, team).Where("id = ?", pinnedID).First(&record).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, fmt.Errorf("%w: %d for %s in project %d (%s)", ErrPromptTemplateNotFound, pinnedID, name, projectID, language)
+			}
+			return nil, err
+		}
+		return promptFromRecord(record)
+	}
+
+	var records []models.PromptTemplate
+	if err := applicablePrompts(db, name, language, projectID, team).Where("active = ?", true).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	precedence := map[string]int{"project": 3, "team": 2, "global": 1}
+	var best *models.PromptTemplate
+	for i := range records {
+		record := &records[i]
+		if best == nil || precedence[record.Scope] != precedence[best.Scope] {
+			if best == nil || precedence[record.Scope] > precedence[best.Scope] {
+				best = record
+			}
+			continue
+		}
+		if (record.Language != "") != (best.Language != "") {
+			if record.Language != "" {
+				best = record
+			}
+			continue
+		}
+		if record.Version > best.Version {
+			best = record
+		}
+	}
+	if best == nil {
+		return BuiltinPrompt(name, language)
+	}
+	return promptFromRecord(*best)
+}
+
+// PromptSet 1つの解析（または会話）で使うプロンプトを解決し、使った版を記録する
+type PromptSet struct {
+	db        *gorm.DB
+	projectID uint
+	language  string
+	pinned    map[string]uint
+
+	mu       sync.Mutex
+	team     *string
+	resolved map[string]*ResolvedPrompt
+	used     map[string]string
+}
+
+// NewPromptSet db が nil なら既定のテンプレートだけを使う（language が空なら AI_OUTPUT_LANGUAGE に従う）
+func NewPromptSet(db *gorm.DB, projectID uint, language string, pinned map[string]uint) *PromptSet {
+	return &PromptSet{
+		db:        db,
+		projectID: projectID,
+		language:  language,
+		pinned:    pinned,
+		resolved:  make(map[string]*ResolvedPrompt),
+		used:      make(map[string]string),
+	}
+}
+
+// Render 名前のテンプレートを解決して値を当てはめ、使った版を記録する
+func (ps *PromptSet) Render(name string, data PromptData) (string, error) {
+	prompt, err := ps.resolve(name)
+	if err != nil {
+		return "", err
+	}
+	text, err := prompt.Render(data)
+	if err != nil {
+		return "", err
+	}
+	ps.mu.Lock()
+	ps.used[name] = prompt.Version
+	ps.mu.Unlock()
+	return text, nil
+}
+
+// Versions これまでに使ったテンプレートの版を Analysis.Prompts に保存する形で返す（使っていなければ空）
+func (ps *PromptSet) Versions() string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if len(ps.used) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(ps.used)
+	return string(data)
+}
+
+// Language プロンプトと結果の出力言語
+func (ps *PromptSet) Language() string {
+	if ps.language == "" {
+		return DefaultOutputLanguage()
+	}
+	return ps.language
+}
+
+func (ps *PromptSet) resolve(name string) (*ResolvedPrompt, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if prompt, ok := ps.resolved[name]; ok {
+		return prompt, nil
+	}
+	if ps.team == nil {
+		team := ""
+		if ps.db != nil && ps.projectID != 0 {
+			var project models.Project
+			if err := ps.db.Select("id, team").First(&project, ps.projectID).Error; err == nil {
+				team = project.Team
+			}
+		}
+		ps.team = &team
+	}
+	prompt, err := ResolvePrompt(ps.db, name, ps.Language(), ps.projectID, *ps.team, ps.pinned[name])
+	if err != nil {
+		return nil, err
+	}
+	ps.resolved[name] = prompt
+	return prompt, nil
+}
+
+// PreviewPrompt ファイルを解析するときに AI に渡すプロンプトを、AI を呼ばずに作る
+// templateID を指定するとその版を、draft を指定すると保存前の本文を使う（どちらも無ければプロジェクトで有効な版）
+// language が空ならプロジェクトの出力言語、redactSecrets が nil なら AI_REDACT_SECRETS に従う
+func PreviewPrompt(db *gorm.DB, name string, file models.File, language string, templateID uint, draft string, redactSecrets *bool) (*ResolvedPrompt, string, error) {
+	var prompt *ResolvedPrompt
+	var err error
+	language = ResolveOutputLanguage(db, file.ProjectID, language)
+	if draft != "" {
+		tmpl, parseErr := ParsePromptTemplate(name, draft)
+		if parseErr != nil {
+			return nil, "", parseErr
+		}
+		prompt = &ResolvedPrompt{Name: name, Source: "draft", Version: name + "@draft", Language: language, Body: draft, tmpl: tmpl}
+	} else {
+		var project models.Project
+		if err := db.Select("id, team").First(&project, file.ProjectID).Error; err != nil {
+			return nil, "", err
+		}
+		prompt, err = ResolvePrompt(db, name, language, project.ID, project.Team, templateID)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	ai := NewAIService()
+	if redactSecrets != nil {
+		ai = ai.WithSecretRedaction(*redactSecrets)
+	}
+	data := PromptData{Language: file.Language}
+	switch name {
+	case "code_analysis", "pattern_detection", "documentation":
+		if file.Content == "" {
+			return nil, "", fmt.Errorf("%w for binary files with %s", ErrPreviewNotSupported, name)
+		}
+		data.Code = ai.redact(PrepareCodeForAI(file))
+		if name != "documentation" {
+			var files []models.File
+			if err := db.Where("project_id = ?", file.ProjectID).Find(&files).Error; err != nil {
+				return nil, "", err
+			}
+			// 呼び出し元・呼び出し先の数はプロジェクト全体から求めるので、解析と同じ入力で計測する
+			measured, _ := ComputeProjectMetrics(files)
+			for _, m := range measured {
+				if m.FileID == file.ID {
+					data.Metrics = FormatMetricsForPrompt(m, language)
+				}
+			}
+		}
+	case "dependency_map":
+		// 解析と同じく、プロジェクトの全ファイルを内容ごと渡す
+		var files []models.File
+		if err := db.Where("project_id = ?", file.ProjectID).Find(&files).Error; err != nil {
+			return nil, "", err
+		}
+		data = ai.dependencyPromptData(DependencyFileInfos(files))
+	case "pyc_decompile":
+		pyc, err := loadPyc(&file)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w for this file: %w", ErrPreviewNotSupported, err)
+		}
+		structure, _ := json.MarshalIndent(RecoverPycStructure(pyc.Code, pyc.Header.Major, pyc.Header.Minor), "", "  ")
+		data.Version = pyc.Header.Version
+		data.Structure = ai.redact(string(structure))
+		data.Disassembly = ai.redact(FormatDisassembly(pyc.Code, pyc.Header.Major, pyc.Header.Minor))
+	case "chat_answer":
+		// ファイルの先頭を資料にした例
+		lines := strings.Split(file.Content, "\n")
+		end := min(len(lines), chatSymbolLines)
+		data.Sources = ai.redact(FormatChatSources(language, []ChatSource{{
+			Citation: ChatCitation{Index: 1, Kind: "file", FileID: file.ID, FileName: file.Name, StartLine: 1, EndLine: end},
+			Text:     numberLines(lines[:end], 1),
+		}}))
+	case "investigation":
+	default:
+		return nil, "", fmt.Errorf("%w for %s", ErrPreviewNotSupported, name)
+	}
+
+	text, err := prompt.Render(data)
+	if err != nil {
+		return nil, "", err
+	}
+	return prompt, text, nil
+}
@@ -0,0 +1,597 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// protoToken .proto ソースのトークン
+type protoToken struct {
+	Text   string
+	String bool // 文字列リテラル（Text はアンクォート済み）
+	Line   int
+}
+
+// tokenizeProto コメントを除いて .proto ソースをトークンに分割する
+func tokenizeProto(src string) ([]protoToken, error) {
+	var tokens []protoToken
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != c {
+				if src[j] == '\\' {
+					j++
+				}
+				if j < len(src) && src[j] == '\n' {
+					return nil, fmt.Errorf("line %d: unterminated string", line)
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			text, err := strconv.Unquote(`"` + strings.ReplaceAll(src[i+1:j], `"`, `\"`) + `"`)
+			if err != nil {
+				text = src[i+1 : j]
+			}
+			tokens = append(tokens, protoToken{Text: text, String: true, Line: line})
+			i = j + 1
+		case isProtoWordChar(c) || c == '.':
+			j := i
+			for j < len(src) && (isProtoWordChar(src[j]) || src[j] == '.' ||
+				((src[j] == '+' || src[j] == '-') && j > i && (src[j-1] == 'e' || src[j-1] == 'E') && src[i] >= '0' && src[i] <= '9')) {
+				j++
+			}
+			tokens = append(tokens, protoToken{Text: src[i:j], Line: line})
+			i = j
+		default:
+			tokens = append(tokens, protoToken{Text: string(c), Line: line})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+func isProtoWordChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+var protoScalarTypes = map[string]bool{
+	"double": true, "float": true, "int64": true, "uint64": true, "int32": true, "fixed64": true, "fixed32": true,
+	"bool": true, "string": true, "bytes": true, "uint32": true, "sfixed32": true, "sfixed64": true,
+	"sint32": true, "sint64": true,
+}
+
+type protoParser struct {
+	tokens []protoToken
+	pos    int
+	syntax string
+}
+
+// ParseProtoSource .proto ソースをパースする（型名はソースに書かれたまま保持し、解決はしない）
+func ParseProtoSource(name, src string) (ProtoFile, error) {
+	pf := ProtoFile{Name: name, Source: "proto"}
+	tokens, err := tokenizeProto(src)
+	if err != nil {
+		return pf, err
+	}
+	p := &protoParser{tokens: tokens}
+
+	for !p.eof() {
+		switch tok := p.next(); tok.Text {
+		case ";":
+		case "syntax", "edition":
+			if err := p.expect("="); err != nil {
+				return pf, err
+			}
+			value := p.next()
+			pf.Syntax = value.Text
+			if tok.Text == "edition" {
+				pf.Syntax = "editions"
+			}
+			p.syntax = pf.Syntax
+			p.skipStatement()
+		case "package":
+			pf.Package = p.next().Text
+			p.skipStatement()
+		case "import":
+			dep := p.next()
+			if !dep.String {
+				dep = p.next() // public / weak
+			}
+			pf.Dependencies = append(pf.Dependencies, dep.Text)
+			p.skipStatement()
+		case "option":
+			name, value := p.option()
+			if pf.Options == nil {
+				pf.Options = make(map[string]string)
+			}
+			pf.Options[name] = value
+		case "message":
+			msg, err := p.message()
+			if err != nil {
+				return pf, err
+			}
+			pf.Messages = append(pf.Messages, msg)
+		case "enum":
+			enum, err := p.enum()
+			if err != nil {
+				return pf, err
+			}
+			pf.Enums = append(pf.Enums, enum)
+		case "service":
+			svc, err := p.service()
+			if err != nil {
+				return pf, err
+			}
+			pf.Services = append(pf.Services, svc)
+		case "extend":
+			fields, nested, err := p.extend()
+			if err != nil {
+				return pf, err
+			}
+			pf.Extensions = append(pf.Extensions, fields...)
+			pf.Messages = append(pf.Messages, nested...)
+		default:
+			return pf, fmt.Errorf("line %d: unexpected %q", tok.Line, tok.Text)
+		}
+	}
+	return pf, nil
+}
+
+func (p *protoParser) eof() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *protoParser) peek() protoToken {
+	if p.eof() {
+		return protoToken{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *protoParser) next() protoToken {
+	t := p.peek()
+	if !p.eof() {
+		p.pos++
+	}
+	return t
+}
+
+func (p *protoParser) expect(text string) error {
+	t := p.next()
+	if t.Text != text || t.String {
+		if t.Text == "" {
+			return fmt.Errorf("unexpected end of file, expected %q", text)
+		}
+		return fmt.Errorf("line %d: expected %q, got %q", t.Line, text, t.Text)
+	}
+	return nil
+}
+
+// skipStatement ; まで（途中の {} は対応を取って）読み飛ばす
+func (p *protoParser) skipStatement() {
+	depth := 0
+	for !p.eof() {
+		t := p.next()
+		if t.String {
+			continue
+		}
+		switch t.Text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth <= 0 {
+				if p.peek().Text == ";" && !p.peek().String {
+					p.next()
+				}
+				return
+			}
+		case ";":
+			if depth == 0 {
+				return
+			}
+		}
+	}
+}
+
+// option `option name = value;` を読み、値はソース表記のまま返す
+func (p *protoParser) option() (string, string) {
+	var name strings.Builder
+	for !p.eof() && p.peek().Text != "=" {
+		name.WriteString(p.next().Text)
+	}
+	p.next()
+	value := p.next()
+	text := value.Text
+	if value.String {
+		text = strconv.Quote(value.Text)
+	} else if text == "-" {
+		text += p.next().Text
+	} else if text == "{" {
+		p.pos--
+	}
+	p.skipStatement()
+	return name.String(), text
+}
+
+// fieldOptions [default = x, packed = true] を読み取る
+func (p *protoParser) fieldOptions(field *ProtoField) {
+	if p.peek().Text != "[" {
+		return
+	}
+	p.next()
+	for !p.eof() {
+		var name strings.Builder
+		for !p.eof() && p.peek().Text != "=" && p.peek().Text != "]" {
+			name.WriteString(p.next().Text)
+		}
+		if p.peek().Text == "]" {
+			p.next()
+			return
+		}
+		p.next()
+		value := p.next()
+		text := value.Text
+		if text == "-" && !value.String {
+			text += p.next().Text
+		}
+		switch name.String() {
+		case "default":
+			field.Default = text
+		case "packed":
+			field.Packed = text == "true"
+		case "deprecated":
+			field.Deprecated = text == "true"
+		}
+		// 集約値 {...} は読み飛ばす
+		if text == "{" && !value.String {
+			for depth := 1; depth > 0 && !p.eof(); {
+				switch p.next().Text {
+				case "{":
+					depth++
+				case "}":
+					depth--
+				}
+			}
+		}
+		if sep := p.next(); sep.Text == "]" {
+			return
+		}
+	}
+}
+
+func (p *protoParser) message() (ProtoMessage, error) {
+	msg := ProtoMessage{Name: p.next().Text}
+	if err := p.expect("{"); err != nil {
+		return msg, err
+	}
+	err := p.messageBody(&msg)
+	return msg, err
+}
+
+func (p *protoParser) messageBody(msg *ProtoMessage) error {
+	for {
+		if p.eof() {
+			return fmt.Errorf("message %s: unexpected end of file", msg.Name)
+		}
+		tok := p.peek()
+		switch tok.Text {
+		case "}":
+			p.next()
+			return nil
+		case ";":
+			p.next()
+		case "message":
+			p.next()
+			nested, err := p.message()
+			if err != nil {
+				return err
+			}
+			msg.Nested = append(msg.Nested, nested)
+		case "enum":
+			p.next()
+			enum, err := p.enum()
+			if err != nil {
+				return err
+			}
+			msg.Enums = append(msg.Enums, enum)
+		case "oneof":
+			p.next()
+			idx := len(msg.Oneofs)
+			msg.Oneofs = append(msg.Oneofs, p.next().Text)
+			if err := p.expect("{"); err != nil {
+				return err
+			}
+			for !p.eof() && p.peek().Text != "}" {
+				if p.peek().Text == "option" || p.peek().Text == ";" {
+					p.next()
+					p.skipStatement()
+					continue
+				}
+				field, err := p.field(msg, "")
+				if err != nil {
+					return err
+				}
+				i := idx
+				field.OneofIndex = &i
+				msg.Fields = append(msg.Fields, field)
+			}
+			p.next()
+		case "extend":
+			p.next()
+			fields, nested, err := p.extend()
+			if err != nil {
+				return err
+			}
+			msg.Extensions = append(msg.Extensions, fields...)
+			msg.Nested = append(msg.Nested, nested...)
+		case "reserved":
+			p.next()
+			p.reserved(msg)
+		case "option", "extensions":
+			p.next()
+			p.skipStatement()
+		default:
+			label := ""
+			if tok.Text == "optional" || tok.Text == "required" || tok.Text == "repeated" {
+				label = p.next().Text
+			}
+			field, err := p.field(msg, label)
+			if err != nil {
+				return err
+			}
+			msg.Fields = append(msg.Fields, field)
+		}
+	}
+}
+
+// field フィールド定義を1つ読む（map<K,V> と group は protoc と同様に入れ子メッセージへ展開する）
+func (p *protoParser) field(msg *ProtoMessage, label string) (ProtoField, error) {
+	field := ProtoField{Label: label}
+	typ := p.next()
+
+	switch typ.Text {
+	case "map":
+		if err := p.expect("<"); err != nil {
+			return field, err
+		}
+		key := p.next().Text
+		if err := p.expect(","); err != nil {
+			return field, err
+		}
+		value := p.next().Text
+		if err := p.expect(">"); err != nil {
+			return field, err
+		}
+		field.Name = p.next().Text
+		entry := ProtoMessage{Name: protoCamelCase(field.Name) + "Entry", MapEntry: true}
+		entry.Fields = []ProtoField{protoFieldOfType("key", 1, key), protoFieldOfType("value", 2, value)}
+		msg.Nested = append(msg.Nested, entry)
+		field.Label = "repeated"
+		field.Type = "message"
+		field.TypeName = entry.Name
+	case "group":
+		groupName := p.next().Text
+		field.Name = strings.ToLower(groupName)
+		field.Type = "group"
+		field.TypeName = groupName
+		if err := p.expect("="); err != nil {
+			return field, err
+		}
+		n, _ := strconv.Atoi(p.next().Text)
+		field.Number = n
+		p.fieldOptions(&field)
+		group := ProtoMessage{Name: groupName}
+		if err := p.expect("{"); err != nil {
+			return field, err
+		}
+		if err := p.messageBody(&group); err != nil {
+			return field, err
+		}
+		msg.Nested = append(msg.Nested, group)
+		return field, nil
+	default:
+		field = protoFieldOfType("", 0, typ.Text)
+		field.Label = label
+		field.Name = p.next().Text
+	}
+
+	if err := p.expect("="); err != nil {
+		return field, err
+	}
+	numTok := p.next()
+	n, err := strconv.ParseInt(numTok.Text, 0, 32)
+	if err != nil {
+		return field, fmt.Errorf("line %d: invalid field number %q", numTok.Line, numTok.Text)
+	}
+	field.Number = int(n)
+	p.fieldOptions(&field)
+	if label == "optional" && p.syntax == "proto3" {
+		field.Proto3Optional = true
+	}
+	return field, p.expect(";")
+}
+
+func protoFieldOfType(name string, number int, typ string) ProtoField {
+	field := ProtoField{Name: name, Number: number, Type: typ}
+	if !protoScalarTypes[typ] {
+		field.Type = ""
+		field.TypeName = typ
+	}
+	return field
+}
+
+// protoCamelCase map フィールド名から protoc と同じ規則で Entry メッセージ名を作る
+func protoCamelCase(name string) string {
+	var sb strings.Builder
+	upper := true
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == '_' {
+			upper = true
+			continue
+		}
+		if upper && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+func (p *protoParser) reserved(msg *ProtoMessage) {
+	for !p.eof() {
+		t := p.next()
+		if t.Text == ";" && !t.String {
+			return
+		}
+		if t.String {
+			msg.ReservedNames = append(msg.ReservedNames, t.Text)
+			continue
+		}
+		start, err := strconv.Atoi(t.Text)
+		if err != nil {
+			continue
+		}
+		r := [2]int{start, start}
+		if p.peek().Text == "to" {
+			p.next()
+			end := p.next().Text
+			if end == "max" {
+				r[1] = 536870911
+			} else if v, err := strconv.Atoi(end); err == nil {
+				r[1] = v
+			}
+		}
+		msg.Reserved = append(msg.Reserved, r)
+	}
+}
+
+func (p *protoParser) enum() (ProtoEnum, error) {
+	enum := ProtoEnum{Name: p.next().Text}
+	if err := p.expect("{"); err != nil {
+		return enum, err
+	}
+	for {
+		if p.eof() {
+			return enum, fmt.Errorf("enum %s: unexpected end of file", enum.Name)
+		}
+		t := p.next()
+		switch t.Text {
+		case "}":
+			return enum, nil
+		case ";":
+		case "option", "reserved":
+			p.skipStatement()
+		default:
+			if err := p.expect("="); err != nil {
+				return enum, err
+			}
+			num := p.next().Text
+			if num == "-" {
+				num += p.next().Text
+			}
+			n, err := strconv.ParseInt(num, 0, 32)
+			if err != nil {
+				return enum, fmt.Errorf("line %d: invalid enum value %q", t.Line, num)
+			}
+			enum.Values = append(enum.Values, ProtoEnumValue{Name: t.Text, Number: int(n)})
+			var opts ProtoField
+			p.fieldOptions(&opts)
+			if err := p.expect(";"); err != nil {
+				return enum, err
+			}
+		}
+	}
+}
+
+func (p *protoParser) service() (ProtoService, error) {
+	svc := ProtoService{Name: p.next().Text, Methods: []ProtoMethod{}}
+	if err := p.expect("{"); err != nil {
+		return svc, err
+	}
+	for {
+		if p.eof() {
+			return svc, fmt.Errorf("service %s: unexpected end of file", svc.Name)
+		}
+		t := p.next()
+		switch t.Text {
+		case "}":
+			return svc, nil
+		case ";":
+		case "rpc":
+			m := ProtoMethod{Name: p.next().Text}
+			var err error
+			if m.InputType, m.ClientStreaming, err = p.rpcType(); err != nil {
+				return svc, err
+			}
+			if err := p.expect("returns"); err != nil {
+				return svc, err
+			}
+			if m.OutputType, m.ServerStreaming, err = p.rpcType(); err != nil {
+				return svc, err
+			}
+			if p.peek().Text == "{" {
+				p.skipStatement()
+			} else if err := p.expect(";"); err != nil {
+				return svc, err
+			}
+			svc.Methods = append(svc.Methods, m)
+		default:
+			p.skipStatement()
+		}
+	}
+}
+
+// rpcType `( [stream] Type )` を読む
+func (p *protoParser) rpcType() (string, bool, error) {
+	if err := p.expect("("); err != nil {
+		return "", false, err
+	}
+	typ := p.next().Text
+	stream := false
+	if typ == "stream" && p.peek().Text != ")" {
+		stream = true
+		typ = p.next().Text
+	}
+	return typ, stream, p.expect(")")
+}
+
+// extend `extend Foo { fields }` を読み、拡張フィールドと group 用の入れ子メッセージを返す
+func (p *protoParser) extend() ([]ProtoField, []ProtoMessage, error) {
+	extendee := p.next().Text
+	if err := p.expect("{"); err != nil {
+		return nil, nil, err
+	}
+	holder := ProtoMessage{Name: extendee}
+	if err := p.messageBody(&holder); err != nil {
+		return nil, nil, err
+	}
+	for i := range holder.Fields {
+		holder.Fields[i].Extendee = extendee
+	}
+	return holder.Fields, holder.Nested, nil
+}
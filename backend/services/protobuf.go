@@ -0,0 +1,770 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProtoFile .proto ファイル1つ分の定義（FileDescriptorProto または .proto ソースから復元）
+type ProtoFile struct {
+	Name         string            `json:"name"`
+	Package      string            `json:"package,omitempty"`
+	Syntax       string            `json:"syntax,omitempty"`
+	Dependencies []string          `json:"dependencies,omitempty"`
+	Options      map[string]string `json:"options,omitempty"`
+	Messages     []ProtoMessage    `json:"messages,omitempty"`
+	Enums        []ProtoEnum       `json:"enums,omitempty"`
+	Services     []ProtoService    `json:"services,omitempty"`
+	Extensions   []ProtoField      `json:"extensions,omitempty"`
+	Source       string            `json:"source"` // descriptor, descriptor_gzip, java_class, proto
+	Offset       int               `json:"offset,omitempty"`
+}
+
+// ProtoMessage message 定義
+type ProtoMessage struct {
+	Name          string         `json:"name"`
+	Fields        []ProtoField   `json:"fields,omitempty"`
+	Oneofs        []string       `json:"oneofs,omitempty"`
+	Nested        []ProtoMessage `json:"nested,omitempty"`
+	Enums         []ProtoEnum    `json:"enums,omitempty"`
+	Extensions    []ProtoField   `json:"extensions,omitempty"`
+	ReservedNames []string       `json:"reserved_names,omitempty"`
+	Reserved      [][2]int       `json:"reserved_ranges,omitempty"`
+	MapEntry      bool           `json:"map_entry,omitempty"`
+}
+
+// ProtoField フィールド定義（TypeName が空のときは Type がスカラー型）
+type ProtoField struct {
+	Name           string `json:"name"`
+	Number         int    `json:"number"`
+	Label          string `json:"label,omitempty"` // optional, required, repeated
+	Type           string `json:"type"`
+	TypeName       string `json:"type_name,omitempty"`
+	Extendee       string `json:"extendee,omitempty"`
+	Default        string `json:"default,omitempty"`
+	OneofIndex     *int   `json:"oneof_index,omitempty"`
+	Proto3Optional bool   `json:"proto3_optional,omitempty"`
+	Packed         bool   `json:"packed,omitempty"`
+	Deprecated     bool   `json:"deprecated,omitempty"`
+}
+
+// ProtoEnum enum 定義
+type ProtoEnum struct {
+	Name   string           `json:"name"`
+	Values []ProtoEnumValue `json:"values"`
+}
+
+// ProtoEnumValue enum の値
+type ProtoEnumValue struct {
+	Name   string `json:"name"`
+	Number int    `json:"number"`
+}
+
+// ProtoService service 定義
+type ProtoService struct {
+	Name    string        `json:"name"`
+	Methods []ProtoMethod `json:"methods"`
+}
+
+// ProtoMethod rpc 定義
+type ProtoMethod struct {
+	Name            string `json:"name"`
+	InputType       string `json:"input_type"`
+	OutputType      string `json:"output_type"`
+	ClientStreaming bool   `json:"client_streaming,omitempty"`
+	ServerStreaming bool   `json:"server_streaming,omitempty"`
+}
+
+// ProtoCatalogEntry gRPC のサービス・メソッド一覧の1行
+type ProtoCatalogEntry struct {
+	File            string `json:"file"`
+	Package         string `json:"package,omitempty"`
+	Service         string `json:"service"`
+	Method          string `json:"method"`
+	Path            string `json:"path"`
+	InputType       string `json:"input_type"`
+	OutputType      string `json:"output_type"`
+	ClientStreaming bool   `json:"client_streaming"`
+	ServerStreaming bool   `json:"server_streaming"`
+}
+
+// FieldDescriptorProto.Type の番号と型名の対応
+var protoFieldTypes = map[uint64]string{
+	1: "double", 2: "float", 3: "int64", 4: "uint64", 5: "int32", 6: "fixed64", 7: "fixed32", 8: "bool",
+	9: "string", 10: "group", 11: "message", 12: "bytes", 13: "uint32", 14: "enum", 15: "sfixed32",
+	16: "sfixed64", 17: "sint32", 18: "sint64",
+}
+
+var protoFieldLabels = map[uint64]string{1: "optional", 2: "required", 3: "repeated"}
+
+// protoWireField ワイヤーフォーマットの1フィールド
+type protoWireField struct {
+	Number int
+	Wire   int
+	Varint uint64
+	Bytes  []byte
+}
+
+var errProtoWire = errors.New("malformed protobuf wire data")
+
+// maxProtoNestingDepth 入れ子の message をたどる深さの上限（protobuf の実装と同じ100）
+const maxProtoNestingDepth = 100
+
+// readProtoVarint varint を読み取り、値と消費バイト数を返す（不正な場合は n=0）
+func readProtoVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * uint(i))
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// readProtoField 先頭の1フィールドを読み取る
+func readProtoField(b []byte) (protoWireField, int, error) {
+	tag, n := readProtoVarint(b)
+	if n == 0 || tag>>3 == 0 || tag>>3 > 1<<29 {
+		return protoWireField{}, 0, errProtoWire
+	}
+	f := protoWireField{Number: int(tag >> 3), Wire: int(tag & 7)}
+	pos := n
+	switch f.Wire {
+	case 0:
+		v, m := readProtoVarint(b[pos:])
+		if m == 0 {
+			return f, 0, errProtoWire
+		}
+		f.Varint = v
+		pos += m
+	case 1:
+		if pos+8 > len(b) {
+			return f, 0, errProtoWire
+		}
+		f.Bytes = b[pos : pos+8]
+		pos += 8
+	case 2:
+		l, m := readProtoVarint(b[pos:])
+		if m == 0 || uint64(len(b)-pos-m) < l {
+			return f, 0, errProtoWire
+		}
+		pos += m
+		f.Bytes = b[pos : pos+int(l)]
+		pos += int(l)
+	case 5:
+		if pos+4 > len(b) {
+			return f, 0, errProtoWire
+		}
+		f.Bytes = b[pos : pos+4]
+		pos += 4
+	default:
+		return f, 0, errProtoWire
+	}
+	return f, pos, nil
+}
+
+// decodeProtoFields メッセージ全体をフィールド列に分解する
+func decodeProtoFields(b []byte) ([]protoWireField, error) {
+	var fields []protoWireField
+	for len(b) > 0 {
+		f, n, err := readProtoField(b)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+		b = b[n:]
+	}
+	return fields, nil
+}
+
+// protoString 文字列フィールドとして妥当か（制御文字を含まないか）を確認して返す
+func protoString(f protoWireField) (string, error) {
+	if f.Wire != 2 {
+		return "", errProtoWire
+	}
+	for _, c := range f.Bytes {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' {
+			return "", errProtoWire
+		}
+	}
+	return string(f.Bytes), nil
+}
+
+// FileDescriptorProto のフィールド番号と期待するワイヤータイプ（-1 は packed/非packed のどちらも許容）
+var fileDescriptorWire = map[int]int{1: 2, 2: 2, 3: 2, 4: 2, 5: 2, 6: 2, 7: 2, 8: 2, 9: 2, 10: -1, 11: -1, 12: 2, 14: 0}
+
+// ParseFileDescriptor シリアライズされた FileDescriptorProto をパースする
+func ParseFileDescriptor(b []byte) (ProtoFile, error) {
+	pf, n, err := parseFileDescriptorPrefix(b)
+	if err != nil {
+		return pf, err
+	}
+	if n != len(b) {
+		return pf, errProtoWire
+	}
+	return pf, nil
+}
+
+// parseFileDescriptorPrefix 先頭から FileDescriptorProto として解釈できる範囲をパースし、消費バイト数を返す
+// バイナリ中では記述子の終端が分からないため、不正なフィールドか2つ目の name が現れた位置で打ち切る
+func parseFileDescriptorPrefix(b []byte) (ProtoFile, int, error) {
+	pf := ProtoFile{Source: "descriptor"}
+	pos := 0
+	seenName := false
+	for pos < len(b) {
+		f, n, err := readProtoField(b[pos:])
+		if err != nil {
+			break
+		}
+		want, known := fileDescriptorWire[f.Number]
+		if !known || (want >= 0 && f.Wire != want) || (f.Number == 1 && seenName) {
+			break
+		}
+		if err := pf.applyField(f); err != nil {
+			break
+		}
+		if f.Number == 1 {
+			seenName = true
+		}
+		pos += n
+	}
+	if !seenName || !strings.HasSuffix(pf.Name, ".proto") {
+		return pf, 0, errors.New("not a FileDescriptorProto")
+	}
+	return pf, pos, nil
+}
+
+func (pf *ProtoFile) applyField(f protoWireField) error {
+	var err error
+	switch f.Number {
+	case 1:
+		pf.Name, err = protoString(f)
+	case 2:
+		pf.Package, err = protoString(f)
+	case 3:
+		var dep string
+		if dep, err = protoString(f); err == nil {
+			pf.Dependencies = append(pf.Dependencies, dep)
+		}
+	case 4:
+		var msg ProtoMessage
+		if msg, err = parseMessageDescriptor(f.Bytes, 0); err == nil {
+			pf.Messages = append(pf.Messages, msg)
+		}
+	case 5:
+		var enum ProtoEnum
+		if enum, err = parseEnumDescriptor(f.Bytes); err == nil {
+			pf.Enums = append(pf.Enums, enum)
+		}
+	case 6:
+		var svc ProtoService
+		if svc, err = parseServiceDescriptor(f.Bytes); err == nil {
+			pf.Services = append(pf.Services, svc)
+		}
+	case 7:
+		var field ProtoField
+		if field, err = parseFieldDescriptor(f.Bytes); err == nil {
+			pf.Extensions = append(pf.Extensions, field)
+		}
+	case 8:
+		var opts map[string]string
+		if opts, err = parseFileOptions(f.Bytes); err == nil && len(opts) > 0 {
+			pf.Options = opts
+		}
+	case 9:
+		_, err = decodeProtoFields(f.Bytes)
+	case 12:
+		pf.Syntax, err = protoString(f)
+	case 14:
+		pf.Syntax = "editions"
+	}
+	return err
+}
+
+func parseFileOptions(b []byte) (map[string]string, error) {
+	fields, err := decodeProtoFields(b)
+	if err != nil {
+		return nil, err
+	}
+	names := map[int]string{1: "java_package", 8: "java_outer_classname", 11: "go_package", 36: "objc_class_prefix",
+		37: "csharp_namespace", 39: "swift_prefix", 40: "php_class_prefix", 41: "php_namespace", 45: "ruby_package"}
+	opts := make(map[string]string)
+	for _, f := range fields {
+		if name, ok := names[f.Number]; ok && f.Wire == 2 {
+			opts[name] = strconv.Quote(string(f.Bytes))
+		}
+		if f.Number == 10 && f.Wire == 0 && f.Varint != 0 {
+			opts["java_multiple_files"] = "true"
+		}
+	}
+	return opts, nil
+}
+
+func parseMessageDescriptor(b []byte, depth int) (ProtoMessage, error) {
+	var msg ProtoMessage
+	if depth > maxProtoNestingDepth {
+		return msg, errors.New("messages nested too deeply")
+	}
+	fields, err := decodeProtoFields(b)
+	if err != nil {
+		return msg, err
+	}
+	for _, f := range fields {
+		switch f.Number {
+		case 1:
+			msg.Name, err = protoString(f)
+		case 2, 6:
+			var field ProtoField
+			if field, err = parseFieldDescriptor(f.Bytes); err == nil {
+				if f.Number == 2 {
+					msg.Fields = append(msg.Fields, field)
+				} else {
+					msg.Extensions = append(msg.Extensions, field)
+				}
+			}
+		case 3:
+			var nested ProtoMessage
+			if nested, err = parseMessageDescriptor(f.Bytes, depth+1); err == nil {
+				msg.Nested = append(msg.Nested, nested)
+			}
+		case 4:
+			var enum ProtoEnum
+			if enum, err = parseEnumDescriptor(f.Bytes); err == nil {
+				msg.Enums = append(msg.Enums, enum)
+			}
+		case 7:
+			var opts []protoWireField
+			if opts, err = decodeProtoFields(f.Bytes); err == nil {
+				for _, o := range opts {
+					if o.Number == 7 && o.Wire == 0 && o.Varint != 0 {
+						msg.MapEntry = true
+					}
+				}
+			}
+		case 8:
+			var oneof []protoWireField
+			if oneof, err = decodeProtoFields(f.Bytes); err == nil {
+				name := ""
+				for _, o := range oneof {
+					if o.Number == 1 {
+						name, err = protoString(o)
+					}
+				}
+				msg.Oneofs = append(msg.Oneofs, name)
+			}
+		case 9:
+			var rng []protoWireField
+			if rng, err = decodeProtoFields(f.Bytes); err == nil {
+				var r [2]int
+				for _, o := range rng {
+					if o.Number == 1 {
+						r[0] = int(int32(o.Varint))
+					} else if o.Number == 2 {
+						r[1] = int(int32(o.Varint)) - 1 // end は排他的
+					}
+				}
+				msg.Reserved = append(msg.Reserved, r)
+			}
+		case 10:
+			var name string
+			if name, err = protoString(f); err == nil {
+				msg.ReservedNames = append(msg.ReservedNames, name)
+			}
+		case 5:
+			_, err = decodeProtoFields(f.Bytes)
+		}
+		if err != nil {
+			return msg, err
+		}
+	}
+	if msg.Name == "" {
+		return msg, errors.New("message without name")
+	}
+	return msg, nil
+}
+
+func parseFieldDescriptor(b []byte) (ProtoField, error) {
+	var field ProtoField
+	fields, err := decodeProtoFields(b)
+	if err != nil {
+		return field, err
+	}
+	for _, f := range fields {
+		switch f.Number {
+		case 1:
+			field.Name, err = protoString(f)
+		case 2:
+			field.Extendee, err = protoString(f)
+		case 3:
+			field.Number = int(int32(f.Varint))
+		case 4:
+			field.Label = protoFieldLabels[f.Varint]
+		case 5:
+			field.Type = protoFieldTypes[f.Varint]
+		case 6:
+			field.TypeName, err = protoString(f)
+		case 7:
+			field.Default, err = protoString(f)
+		case 8:
+			var opts []protoWireField
+			if opts, err = decodeProtoFields(f.Bytes); err == nil {
+				for _, o := range opts {
+					if o.Number == 2 && o.Wire == 0 {
+						field.Packed = o.Varint != 0
+					} else if o.Number == 3 && o.Wire == 0 {
+						field.Deprecated = o.Varint != 0
+					}
+				}
+			}
+		case 9:
+			idx := int(int32(f.Varint))
+			field.OneofIndex = &idx
+		case 17:
+			field.Proto3Optional = f.Varint != 0
+		}
+		if err != nil {
+			return field, err
+		}
+	}
+	if field.Name == "" || field.Number <= 0 {
+		return field, errors.New("invalid field descriptor")
+	}
+	return field, nil
+}
+
+func parseEnumDescriptor(b []byte) (ProtoEnum, error) {
+	var enum ProtoEnum
+	fields, err := decodeProtoFields(b)
+	if err != nil {
+		return enum, err
+	}
+	for _, f := range fields {
+		switch f.Number {
+		case 1:
+			enum.Name, err = protoString(f)
+		case 2:
+			var value []protoWireField
+			if value, err = decodeProtoFields(f.Bytes); err == nil {
+				var v ProtoEnumValue
+				for _, o := range value {
+					if o.Number == 1 {
+						v.Name, err = protoString(o)
+					} else if o.Number == 2 {
+						v.Number = int(int32(o.Varint))
+					}
+				}
+				enum.Values = append(enum.Values, v)
+			}
+		}
+		if err != nil {
+			return enum, err
+		}
+	}
+	if enum.Name == "" {
+		return enum, errors.New("enum without name")
+	}
+	return enum, nil
+}
+
+func parseServiceDescriptor(b []byte) (ProtoService, error) {
+	var svc ProtoService
+	fields, err := decodeProtoFields(b)
+	if err != nil {
+		return svc, err
+	}
+	for _, f := range fields {
+		switch f.Number {
+		case 1:
+			svc.Name, err = protoString(f)
+		case 2:
+			var method []protoWireField
+			if method, err = decodeProtoFields(f.Bytes); err == nil {
+				var m ProtoMethod
+				for _, o := range method {
+					switch o.Number {
+					case 1:
+						m.Name, err = protoString(o)
+					case 2:
+						m.InputType, err = protoString(o)
+					case 3:
+						m.OutputType, err = protoString(o)
+					case 5:
+						m.ClientStreaming = o.Varint != 0
+					case 6:
+						m.ServerStreaming = o.Varint != 0
+					}
+				}
+				svc.Methods = append(svc.Methods, m)
+			}
+		}
+		if err != nil {
+			return svc, err
+		}
+	}
+	if svc.Name == "" {
+		return svc, errors.New("service without name")
+	}
+	return svc, nil
+}
+
+// FormatProtoFile 定義を .proto ソースとして出力する
+func FormatProtoFile(pf ProtoFile) string {
+	var sb strings.Builder
+	syntax := pf.Syntax
+	if syntax == "" {
+		syntax = "proto2"
+	}
+	if syntax != "editions" {
+		fmt.Fprintf(&sb, "syntax = %q;\n\n", syntax)
+	}
+	if pf.Package != "" {
+		fmt.Fprintf(&sb, "package %s;\n\n", pf.Package)
+	}
+	for _, dep := range pf.Dependencies {
+		fmt.Fprintf(&sb, "import %q;\n", dep)
+	}
+	if len(pf.Dependencies) > 0 {
+		sb.WriteString("\n")
+	}
+	optNames := make([]string, 0, len(pf.Options))
+	for name := range pf.Options {
+		optNames = append(optNames, name)
+	}
+	sort.Strings(optNames)
+	for _, name := range optNames {
+		fmt.Fprintf(&sb, "option %s = %s;\n", name, pf.Options[name])
+	}
+	if len(optNames) > 0 {
+		sb.WriteString("\n")
+	}
+
+	p := &protoPrinter{sb: &sb, pkg: pf.Package, proto3: syntax == "proto3"}
+	for _, enum := range pf.Enums {
+		p.enum(enum, 0)
+		sb.WriteString("\n")
+	}
+	for _, msg := range pf.Messages {
+		p.message(msg, 0)
+		sb.WriteString("\n")
+	}
+	p.extensions(pf.Extensions, 0)
+	for _, svc := range pf.Services {
+		fmt.Fprintf(&sb, "service %s {\n", svc.Name)
+		for _, m := range svc.Methods {
+			in, out := p.typeName(m.InputType), p.typeName(m.OutputType)
+			if m.ClientStreaming {
+				in = "stream " + in
+			}
+			if m.ServerStreaming {
+				out = "stream " + out
+			}
+			fmt.Fprintf(&sb, "  rpc %s(%s) returns (%s);\n", m.Name, in, out)
+		}
+		sb.WriteString("}\n\n")
+	}
+	return strings.TrimRight(sb.String(), "\n") + "\n"
+}
+
+type protoPrinter struct {
+	sb     *strings.Builder
+	pkg    string
+	proto3 bool
+}
+
+// typeName 完全修飾名（.pkg.Type）から同一パッケージの接頭辞を取り除く
+func (p *protoPrinter) typeName(name string) string {
+	name = strings.TrimPrefix(name, ".")
+	if p.pkg != "" && strings.HasPrefix(name, p.pkg+".") {
+		return name[len(p.pkg)+1:]
+	}
+	return name
+}
+
+func (p *protoPrinter) line(depth int, format string, args ...interface{}) {
+	p.sb.WriteString(strings.Repeat("  ", depth))
+	fmt.Fprintf(p.sb, format, args...)
+	p.sb.WriteString("\n")
+}
+
+func (p *protoPrinter) enum(enum ProtoEnum, depth int) {
+	p.line(depth, "enum %s {", enum.Name)
+	for _, v := range enum.Values {
+		p.line(depth+1, "%s = %d;", v.Name, v.Number)
+	}
+	p.line(depth, "}")
+}
+
+func (p *protoPrinter) message(msg ProtoMessage, depth int) {
+	p.line(depth, "message %s {", msg.Name)
+
+	entries := make(map[string]ProtoMessage)
+	for _, nested := range msg.Nested {
+		if nested.MapEntry {
+			entries[nested.Name] = nested
+		}
+	}
+	for _, enum := range msg.Enums {
+		p.enum(enum, depth+1)
+	}
+	for _, nested := range msg.Nested {
+		if !nested.MapEntry {
+			p.message(nested, depth+1)
+		}
+	}
+
+	printedOneof := make(map[int]bool)
+	for _, field := range msg.Fields {
+		if field.OneofIndex != nil && !field.Proto3Optional {
+			idx := *field.OneofIndex
+			if printedOneof[idx] {
+				continue
+			}
+			printedOneof[idx] = true
+			name := fmt.Sprintf("oneof_%d", idx)
+			if idx < len(msg.Oneofs) && msg.Oneofs[idx] != "" {
+				name = msg.Oneofs[idx]
+			}
+			p.line(depth+1, "oneof %s {", name)
+			for _, member := range msg.Fields {
+				if member.OneofIndex != nil && *member.OneofIndex == idx && !member.Proto3Optional {
+					p.line(depth+2, "%s", p.field(member, entries, true))
+				}
+			}
+			p.line(depth+1, "}")
+			continue
+		}
+		p.line(depth+1, "%s", p.field(field, entries, false))
+	}
+
+	for _, r := range msg.Reserved {
+		if r[0] == r[1] {
+			p.line(depth+1, "reserved %d;", r[0])
+		} else if r[1] >= 536870911 {
+			p.line(depth+1, "reserved %d to max;", r[0])
+		} else {
+			p.line(depth+1, "reserved %d to %d;", r[0], r[1])
+		}
+	}
+	if len(msg.ReservedNames) > 0 {
+		quoted := make([]string, len(msg.ReservedNames))
+		for i, name := range msg.ReservedNames {
+			quoted[i] = strconv.Quote(name)
+		}
+		p.line(depth+1, "reserved %s;", strings.Join(quoted, ", "))
+	}
+	p.extensions(msg.Extensions, depth+1)
+	p.line(depth, "}")
+}
+
+func (p *protoPrinter) extensions(fields []ProtoField, depth int) {
+	byExtendee := make(map[string][]ProtoField)
+	var order []string
+	for _, f := range fields {
+		if _, ok := byExtendee[f.Extendee]; !ok {
+			order = append(order, f.Extendee)
+		}
+		byExtendee[f.Extendee] = append(byExtendee[f.Extendee], f)
+	}
+	for _, extendee := range order {
+		p.line(depth, "extend %s {", p.typeName(extendee))
+		for _, f := range byExtendee[extendee] {
+			p.line(depth+1, "%s", p.field(f, nil, false))
+		}
+		p.line(depth, "}")
+	}
+}
+
+func (p *protoPrinter) field(f ProtoField, entries map[string]ProtoMessage, inOneof bool) string {
+	typ := f.Type
+	if f.TypeName != "" {
+		typ = p.typeName(f.TypeName)
+	}
+
+	// map<K, V> は repeated な XxxEntry メッセージとして表現されている
+	if f.Label == "repeated" && f.TypeName != "" {
+		short := f.TypeName[strings.LastIndex(f.TypeName, ".")+1:]
+		if entry, ok := entries[short]; ok && len(entry.Fields) == 2 {
+			key, value := entry.Fields[0], entry.Fields[1]
+			vt := value.Type
+			if value.TypeName != "" {
+				vt = p.typeName(value.TypeName)
+			}
+			return fmt.Sprintf("map<%s, %s> %s = %d;", key.Type, vt, f.Name, f.Number)
+		}
+	}
+
+	label := f.Label
+	switch {
+	case inOneof:
+		label = ""
+	case f.Proto3Optional:
+		label = "optional"
+	case p.proto3 && label == "optional":
+		label = ""
+	}
+	var opts []string
+	if f.Default != "" {
+		def := f.Default
+		if f.Type == "string" || f.Type == "bytes" {
+			def = strconv.Quote(def)
+		}
+		opts = append(opts, "default = "+def)
+	}
+	if f.Packed {
+		opts = append(opts, "packed = true")
+	}
+	if f.Deprecated {
+		opts = append(opts, "deprecated = true")
+	}
+
+	s := fmt.Sprintf("%s %s = %d", typ, f.Name, f.Number)
+	if label != "" {
+		s = label + " " + s
+	}
+	if len(opts) > 0 {
+		s += " [" + strings.Join(opts, ", ") + "]"
+	}
+	return s + ";"
+}
+
+// BuildProtoCatalog service/rpc 定義からgRPCメソッドの一覧を作る
+func BuildProtoCatalog(files []ProtoFile) []ProtoCatalogEntry {
+	catalog := []ProtoCatalogEntry{}
+	for _, pf := range files {
+		// 記述子の型名は完全修飾（.pkg.Type）、ソースの型名はパッケージ相対
+		qualify := func(name string) string {
+			if strings.HasPrefix(name, ".") {
+				return name[1:]
+			}
+			if pf.Package != "" && !strings.Contains(name, ".") {
+				return pf.Package + "." + name
+			}
+			return name
+		}
+		for _, svc := range pf.Services {
+			fullName := svc.Name
+			if pf.Package != "" {
+				fullName = pf.Package + "." + svc.Name
+			}
+			for _, m := range svc.Methods {
+				catalog = append(catalog, ProtoCatalogEntry{
+					File:            pf.Name,
+					Package:         pf.Package,
+					Service:         svc.Name,
+					Method:          m.Name,
+					Path:            "/" + fullName + "/" + m.Name,
+					InputType:       qualify(m.InputType),
+					OutputType:      qualify(m.OutputType),
+					ClientStreaming: m.ClientStreaming,
+					ServerStreaming: m.ServerStreaming,
+				})
+			}
+		}
+	}
+	sort.SliceStable(catalog, func(i, j int) bool { return catalog[i].Path < catalog[j].Path })
+	return catalog
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// ProtoFileSummary protobuf_recovery の結果に載せる .proto 単位の概要
+type ProtoFileSummary struct {
+	Name     string `json:"name"`
+	Package  string `json:"package,omitempty"`
+	Source   string `json:"source"`
+	Offset   int    `json:"offset,omitempty"`
+	Messages int    `json:"messages"`
+	Enums    int    `json:"enums"`
+	Services int    `json:"services"`
+}
+
+// ProtobufReport protobuf_recovery 解析のファイル単位の結果
+type ProtobufReport struct {
+	FileID         uint               `json:"file_id"`
+	Name           string             `json:"name"`
+	Protos         []ProtoFileSummary `json:"protos"`
+	WellKnown      []string           `json:"well_known,omitempty"`
+	CreatedFileIDs []uint             `json:"created_file_ids"`
+	Errors         []string           `json:"errors,omitempty"`
+}
+
+// isWellKnownProto google/protobuf/*.proto は protobuf ランタイムに同梱されるため復元対象から外す
+func isWellKnownProto(name string) bool {
+	return strings.HasPrefix(name, "google/protobuf/")
+}
+
+// runProtobufRecovery バイナリに埋め込まれた記述子と .proto ソースから定義を復元し、gRPCのサービス一覧を作る
+func (w *AnalysisWorker) runProtobufRecovery(files []models.File) (string, error) {
+	var reports []ProtobufReport
+	var recovered []ProtoFile
+
+	for i := range files {
+		file := &files[i]
+		if file.Origin != "" {
+			continue
+		}
+
+		var protos []ProtoFile
+		var errs []string
+		switch {
+		case file.Language == "protobuf":
+			pf, err := ParseProtoSource(file.Name, file.Content)
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+			protos = append(protos, pf)
+		case file.Content == "":
+			// テキストとして保存されていないファイル（実行ファイル・JAR・クラスファイルなど）
+			data, err := os.ReadFile(file.Path)
+			if err != nil {
+				continue
+			}
+			protos = FindEmbeddedDescriptors(data)
+		}
+		if len(protos) == 0 && len(errs) == 0 {
+			continue
+		}
+		w.removeDerivedFiles(file.ID, "protobuf_recovery")
+
+		report := ProtobufReport{FileID: file.ID, Name: file.Name, Protos: []ProtoFileSummary{}, CreatedFileIDs: []uint{}, Errors: errs}
+		for _, pf := range protos {
+			if isWellKnownProto(pf.Name) {
+				report.WellKnown = append(report.WellKnown, pf.Name)
+				continue
+			}
+			report.Protos = append(report.Protos, ProtoFileSummary{
+				Name:     pf.Name,
+				Package:  pf.Package,
+				Source:   pf.Source,
+				Offset:   pf.Offset,
+				Messages: len(pf.Messages),
+				Enums:    len(pf.Enums),
+				Services: len(pf.Services),
+			})
+			recovered = append(recovered, pf)
+
+			// ソースがそのまま手元にある .proto は再生成しない
+			if pf.Source == "proto" && file.Language == "protobuf" {
+				continue
+			}
+			// 記述子のファイル名はバイナリから読んだ値なので、出力先の外に出ないようにする
+			name := sanitizeCarvedPath(pf.Name)
+			if name == "" {
+				report.Errors = append(report.Errors, fmt.Sprintf("invalid proto file name %q", pf.Name))
+				continue
+			}
+			derived, err := w.createDerivedFile(file, "protobuf_recovery", name, []byte(FormatProtoFile(pf)))
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("failed to save %s: %v", pf.Name, err))
+				continue
+			}
+			report.CreatedFileIDs = append(report.CreatedFileIDs, derived.ID)
+		}
+		reports = append(reports, report)
+	}
+
+	if len(reports) == 0 {
+		return "", fmt.Errorf("no protobuf descriptors or .proto files found in project")
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"files":   reports,
+		"catalog": BuildProtoCatalog(recovered),
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
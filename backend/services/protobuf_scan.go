@@ -0,0 +1,247 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// 1つの埋め込み記述子として展開する最大サイズ
+const maxEmbeddedDescriptorSize = 8 << 20
+
+// FindEmbeddedDescriptors バイナリに埋め込まれたシリアライズ済み FileDescriptorProto を探す
+// Go（rawDesc / 旧来の gzip 圧縮記述子）、C++（descriptor_table_protodef_*）、
+// Java（クラスファイル定数プールの descriptorData、JAR 内のクラスも対象）に対応する
+func FindEmbeddedDescriptors(data []byte) []ProtoFile {
+	found := make(map[string]ProtoFile)
+	var order []string
+	add := func(pf ProtoFile) {
+		prev, ok := found[pf.Name]
+		if !ok {
+			order = append(order, pf.Name)
+		}
+		if !ok || protoDefinitionCount(pf) > protoDefinitionCount(prev) {
+			found[pf.Name] = pf
+		}
+	}
+
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		for _, pf := range scanJarDescriptors(data) {
+			add(pf)
+		}
+	} else if bytes.HasPrefix(data, []byte{0xca, 0xfe, 0xba, 0xbe}) {
+		for _, pf := range scanClassDescriptors(data) {
+			add(pf)
+		}
+	}
+	for _, pf := range scanRawDescriptors(data, "descriptor") {
+		add(pf)
+	}
+	for _, pf := range scanGzipDescriptors(data) {
+		add(pf)
+	}
+
+	result := make([]ProtoFile, 0, len(order))
+	for _, name := range order {
+		result = append(result, found[name])
+	}
+	return result
+}
+
+func protoDefinitionCount(pf ProtoFile) int {
+	return len(pf.Messages) + len(pf.Enums) + len(pf.Services) + len(pf.Extensions) + len(pf.Dependencies)
+}
+
+// scanRawDescriptors `0x0a <len> xxx.proto` で始まる位置から記述子をパースする
+func scanRawDescriptors(data []byte, source string) []ProtoFile {
+	var result []ProtoFile
+	for i := 0; i < len(data)-8; i++ {
+		if data[i] != 0x0a {
+			continue
+		}
+		l, n := readProtoVarint(data[i+1:])
+		if n == 0 || l < 7 || l > 512 || uint64(len(data)-i-1-n) < l {
+			continue
+		}
+		name := data[i+1+n : i+1+n+int(l)]
+		if !bytes.HasSuffix(name, []byte(".proto")) || !isProtoPath(name) {
+			continue
+		}
+		pf, consumed, err := parseFileDescriptorPrefix(data[i:])
+		if err != nil || protoDefinitionCount(pf) == 0 && pf.Package == "" {
+			continue
+		}
+		pf.Source = source
+		pf.Offset = i
+		result = append(result, pf)
+		i += consumed - 1
+	}
+	return result
+}
+
+func isProtoPath(name []byte) bool {
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("/._-", c) >= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// scanGzipDescriptors golang/protobuf v1 が埋め込む gzip 圧縮の記述子を展開する
+func scanGzipDescriptors(data []byte) []ProtoFile {
+	var result []ProtoFile
+	for i := 0; i+10 < len(data); i++ {
+		if data[i] != 0x1f || data[i+1] != 0x8b || data[i+2] != 0x08 {
+			continue
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(data[i:]))
+		if err != nil {
+			continue
+		}
+		zr.Multistream(false)
+		raw, err := io.ReadAll(io.LimitReader(zr, maxEmbeddedDescriptorSize))
+		if err != nil || len(raw) == 0 || raw[0] != 0x0a {
+			continue
+		}
+		pf, err := ParseFileDescriptor(raw)
+		if err != nil {
+			continue
+		}
+		pf.Source = "descriptor_gzip"
+		pf.Offset = i
+		result = append(result, pf)
+	}
+	return result
+}
+
+// scanJarDescriptors JAR 内のクラスファイルと .proto/.desc を走査する
+func scanJarDescriptors(data []byte) []ProtoFile {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil
+	}
+	var result []ProtoFile
+	for _, entry := range zr.File {
+		if entry.UncompressedSize64 > maxEmbeddedDescriptorSize {
+			continue
+		}
+		isClass := strings.HasSuffix(entry.Name, ".class")
+		isProto := strings.HasSuffix(entry.Name, ".proto")
+		if !isClass && !isProto && !strings.HasSuffix(entry.Name, ".desc") && !strings.HasSuffix(entry.Name, ".pb") {
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			continue
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case isClass:
+			result = append(result, scanClassDescriptors(content)...)
+		case isProto:
+			if pf, err := ParseProtoSource(entry.Name, string(content)); err == nil {
+				result = append(result, pf)
+			}
+		default:
+			result = append(result, scanDescriptorSet(content)...)
+		}
+	}
+	return result
+}
+
+// scanDescriptorSet FileDescriptorSet（protoc --descriptor_set_out）または単体の記述子をパースする
+func scanDescriptorSet(data []byte) []ProtoFile {
+	fields, err := decodeProtoFields(data)
+	if err == nil {
+		var result []ProtoFile
+		for _, f := range fields {
+			if f.Number != 1 || f.Wire != 2 {
+				result = nil
+				break
+			}
+			pf, err := ParseFileDescriptor(f.Bytes)
+			if err != nil {
+				result = nil
+				break
+			}
+			result = append(result, pf)
+		}
+		if len(result) > 0 {
+			return result
+		}
+	}
+	return scanRawDescriptors(data, "descriptor")
+}
+
+// scanClassDescriptors クラスファイルの定数プールから descriptorData 文字列を取り出す
+// protoc の Java 出力は記述子を複数の文字列定数に分割するため、連続する CONSTANT_Utf8 を連結してから探す
+func scanClassDescriptors(class []byte) []ProtoFile {
+	if len(class) < 10 || binary.BigEndian.Uint32(class) != 0xcafebabe {
+		return nil
+	}
+	count := int(binary.BigEndian.Uint16(class[8:]))
+	pos := 10
+	var joined []byte
+	for i := 1; i < count && pos < len(class); i++ {
+		tag := class[pos]
+		pos++
+		switch tag {
+		case 1: // Utf8
+			if pos+2 > len(class) {
+				return nil
+			}
+			l := int(binary.BigEndian.Uint16(class[pos:]))
+			pos += 2
+			if pos+l > len(class) {
+				return nil
+			}
+			joined = append(joined, decodeModifiedUTF8(class[pos:pos+l])...)
+			pos += l
+		case 7, 8, 16, 19, 20: // Class, String, MethodType, Module, Package
+			pos += 2
+		case 15: // MethodHandle
+			pos += 3
+		case 3, 4, 9, 10, 11, 12, 17, 18: // Integer, Float, ref 系, NameAndType, Dynamic
+			pos += 4
+		case 5, 6: // Long, Double は2スロットを使う
+			pos += 8
+			i++
+		default:
+			return nil
+		}
+	}
+
+	var result []ProtoFile
+	for _, pf := range scanRawDescriptors(joined, "java_class") {
+		pf.Offset = 0
+		result = append(result, pf)
+	}
+	return result
+}
+
+// decodeModifiedUTF8 Java の修正UTF-8を ISO-8859-1 のバイト列に戻す（descriptorData は 0〜255 の文字のみ）
+func decodeModifiedUTF8(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		if c&0xe0 == 0xc0 && i+1 < len(b) && b[i+1]&0xc0 == 0x80 {
+			r := int(c&0x1f)<<6 | int(b[i+1]&0x3f)
+			if r <= 0xff {
+				out = append(out, byte(r))
+				i++
+				continue
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
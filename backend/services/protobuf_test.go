@@ -0,0 +1,251 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"reverse-engineering-backend/models"
+)
+
+// テスト用のワイヤーフォーマットの組み立て
+func protoVarint(v uint64) []byte {
+	var b []byte
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func protoBytesField(number int, data []byte) []byte {
+	b := protoVarint(uint64(number)<<3 | 2)
+	b = append(b, protoVarint(uint64(len(data)))...)
+	return append(b, data...)
+}
+
+func protoStringField(number int, s string) []byte {
+	return protoBytesField(number, []byte(s))
+}
+
+func protoVarintField(number int, v uint64) []byte {
+	return append(protoVarint(uint64(number)<<3), protoVarint(v)...)
+}
+
+func protoConcat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// sampleFileDescriptor 次の .proto に相当する FileDescriptorProto
+//
+//	syntax = "proto3";
+//	package demo.v1;
+//	message HelloRequest { string name = 1; repeated int32 ids = 2; }
+//	enum Mood { MOOD_UNSPECIFIED = 0; HAPPY = 1; }
+//	service Greeter { rpc SayHello (HelloRequest) returns (stream HelloRequest); }
+func sampleFileDescriptor(name string) []byte {
+	message := protoConcat(
+		protoStringField(1, "HelloRequest"),
+		protoBytesField(2, protoConcat(protoStringField(1, "name"), protoVarintField(3, 1), protoVarintField(4, 1), protoVarintField(5, 9))),
+		protoBytesField(2, protoConcat(protoStringField(1, "ids"), protoVarintField(3, 2), protoVarintField(4, 3), protoVarintField(5, 5))),
+	)
+	enum := protoConcat(
+		protoStringField(1, "Mood"),
+		protoBytesField(2, protoConcat(protoStringField(1, "MOOD_UNSPECIFIED"), protoVarintField(2, 0))),
+		protoBytesField(2, protoConcat(protoStringField(1, "HAPPY"), protoVarintField(2, 1))),
+	)
+	service := protoConcat(
+		protoStringField(1, "Greeter"),
+		protoBytesField(2, protoConcat(
+			protoStringField(1, "SayHello"),
+			protoStringField(2, ".demo.v1.HelloRequest"),
+			protoStringField(3, ".demo.v1.HelloRequest"),
+			protoVarintField(6, 1),
+		)),
+	)
+	return protoConcat(
+		protoStringField(1, name),
+		protoStringField(2, "demo.v1"),
+		protoBytesField(4, message),
+		protoBytesField(5, enum),
+		protoBytesField(6, service),
+		protoStringField(12, "proto3"),
+	)
+}
+
+func TestParseFileDescriptor(t *testing.T) {
+	pf, err := ParseFileDescriptor(sampleFileDescriptor("demo/v1/hello.proto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pf.Name != "demo/v1/hello.proto" || pf.Package != "demo.v1" || pf.Syntax != "proto3" {
+		t.Errorf("file = %+v", pf)
+	}
+	wantFields := []ProtoField{
+		{Name: "name", Number: 1, Label: "optional", Type: "string"},
+		{Name: "ids", Number: 2, Label: "repeated", Type: "int32"},
+	}
+	if len(pf.Messages) != 1 || !reflect.DeepEqual(pf.Messages[0].Fields, wantFields) {
+		t.Errorf("messages = %+v", pf.Messages)
+	}
+	if len(pf.Enums) != 1 || len(pf.Enums[0].Values) != 2 || pf.Enums[0].Values[1] != (ProtoEnumValue{Name: "HAPPY", Number: 1}) {
+		t.Errorf("enums = %+v", pf.Enums)
+	}
+
+	catalog := BuildProtoCatalog([]ProtoFile{pf})
+	if len(catalog) != 1 || catalog[0].Path != "/demo.v1.Greeter/SayHello" || !catalog[0].ServerStreaming || catalog[0].ClientStreaming {
+		t.Errorf("catalog = %+v", catalog)
+	}
+
+	source := FormatProtoFile(pf)
+	for _, want := range []string{`syntax = "proto3";`, "package demo.v1;", "repeated int32 ids = 2;", "HAPPY = 1;",
+		"rpc SayHello(HelloRequest) returns (stream HelloRequest);"} {
+		if !strings.Contains(source, want) {
+			t.Errorf("formatted source does not contain %q:\n%s", want, source)
+		}
+	}
+
+	// 書き出した .proto を読み直しても同じ定義になる
+	reparsed, err := ParseProtoSource(pf.Name, source)
+	if err != nil {
+		t.Fatalf("ParseProtoSource() error = %v\n%s", err, source)
+	}
+	if !reflect.DeepEqual(BuildProtoCatalog([]ProtoFile{reparsed}), catalog) {
+		t.Errorf("catalog after round trip = %+v, want %+v", BuildProtoCatalog([]ProtoFile{reparsed}), catalog)
+	}
+}
+
+func TestParseFileDescriptorInvalid(t *testing.T) {
+	valid := sampleFileDescriptor("a.proto")
+
+	nested := protoStringField(1, "M")
+	for i := 0; i < maxProtoNestingDepth+10; i++ {
+		nested = protoConcat(protoStringField(1, "M"), protoBytesField(3, nested))
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", valid[:len(valid)-1]},
+		{"no name", protoStringField(2, "demo")},
+		{"not a proto name", protoStringField(1, "a.txt")},
+		{"bad wire type", protoConcat(protoStringField(1, "a.proto"), []byte{0x0f})},
+		{"length beyond data", protoConcat(protoStringField(1, "a.proto"), []byte{0x22, 0xff, 0xff, 0xff, 0xff, 0x0f})},
+		{"varint too long", protoConcat(protoStringField(1, "a.proto"), []byte{0x70}, bytes.Repeat([]byte{0xff}, 11))},
+		{"control characters in name", protoStringField(1, "a\x01.proto")},
+		{"nested too deeply", protoConcat(protoStringField(1, "a.proto"), protoBytesField(4, nested))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseFileDescriptor(tt.data); err == nil {
+				t.Error("ParseFileDescriptor() error = nil")
+			}
+		})
+	}
+}
+
+func TestFindEmbeddedDescriptors(t *testing.T) {
+	raw := sampleFileDescriptor("demo/raw.proto")
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(sampleFileDescriptor("demo/gzip.proto"))
+	zw.Close()
+
+	// 前後に無関係なバイト列がある実行ファイルを模す
+	prefix := []byte("\x7fELF\x00\x00garbage\x0a\x03abc")
+	binary := protoConcat(prefix, raw, []byte("\x00\x00\x00padding"), gz.Bytes(), []byte("trailer"))
+	found := FindEmbeddedDescriptors(binary)
+
+	var names []string
+	for _, pf := range found {
+		names = append(names, pf.Name+":"+pf.Source)
+	}
+	want := []string{"demo/raw.proto:descriptor", "demo/gzip.proto:descriptor_gzip"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("found %v, want %v", names, want)
+	}
+	if len(found) > 0 && found[0].Offset != len(prefix) {
+		t.Errorf("offset = %d, want %d", found[0].Offset, len(prefix))
+	}
+}
+
+func TestFindEmbeddedDescriptorsTraversalName(t *testing.T) {
+	// 記述子の名前に ../ があっても見つけるが、保存時に出力先の中へ収める
+	found := FindEmbeddedDescriptors(protoConcat([]byte("xx"), sampleFileDescriptor("../../etc/evil.proto")))
+	if len(found) != 1 {
+		t.Fatalf("found %d descriptors, want 1", len(found))
+	}
+	if got := sanitizeCarvedPath(found[0].Name); got != "etc/evil.proto" {
+		t.Errorf("sanitized name = %q", got)
+	}
+}
+
+func TestCreateDerivedFileOutsideDirectory(t *testing.T) {
+	t.Setenv("UPLOAD_PATH", t.TempDir())
+	w := &AnalysisWorker{}
+	parent := &models.File{ID: 1, ProjectID: 1}
+	for _, name := range []string{"../evil.proto", "../../evil.proto", "a/../../evil.proto", ".", ""} {
+		if _, err := w.createDerivedFile(parent, "protobuf_recovery", name, []byte("x")); err == nil {
+			t.Errorf("createDerivedFile(%q) error = nil", name)
+		}
+	}
+	matches, _ := filepath.Glob(filepath.Join(os.Getenv("UPLOAD_PATH"), "*", "*", "evil.proto"))
+	if len(matches) > 0 {
+		t.Errorf("files written outside the output directory: %v", matches)
+	}
+}
+
+func TestParseProtoSource(t *testing.T) {
+	src := `
+syntax = "proto3";
+package shop;
+import public "google/protobuf/timestamp.proto";
+option go_package = "example.com/shop";
+
+/* 注文 */
+message Order {
+  int64 id = 1 [deprecated = true];
+  map<string, int32> counts = 2;
+  oneof payment { string card = 3; string bank = 4; }
+  message Line { string sku = 1; }
+  repeated Line lines = 5;
+  reserved 8, 10 to 12;
+}
+
+service Shop {
+  rpc Watch(stream Order) returns (stream Order) { option deadline = 1.0; }
+}
+`
+	pf, err := ParseProtoSource("shop.proto", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pf.Package != "shop" || pf.Syntax != "proto3" || !reflect.DeepEqual(pf.Dependencies, []string{"google/protobuf/timestamp.proto"}) {
+		t.Errorf("file = %+v", pf)
+	}
+	if len(pf.Messages) != 1 || len(pf.Messages[0].Nested) < 1 || len(pf.Messages[0].Oneofs) != 1 {
+		t.Fatalf("messages = %+v", pf.Messages)
+	}
+	catalog := BuildProtoCatalog([]ProtoFile{pf})
+	if len(catalog) != 1 || catalog[0].Path != "/shop.Shop/Watch" || !catalog[0].ClientStreaming || !catalog[0].ServerStreaming {
+		t.Errorf("catalog = %+v", catalog)
+	}
+
+	for _, bad := range []string{
+		`message A {`,
+		`message A { string s = 1; /* unterminated`,
+		`syntax = "proto3`,
+		`service S { rpc M(`,
+		`}`,
+	} {
+		if _, err := ParseProtoSource("bad.proto", bad); err == nil {
+			t.Errorf("ParseProtoSource(%q) error = nil", bad)
+		}
+	}
+}
@@ -0,0 +1,683 @@
+package services
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// PycHeader .pyc ファイルのヘッダー情報
+type PycHeader struct {
+	Magic      uint16     `json:"magic"`
+	Version    string     `json:"version"`
+	Major      int        `json:"-"`
+	Minor      int        `json:"-"`
+	Flags      uint32     `json:"flags"`
+	HashBased  bool       `json:"hash_based"`
+	SourceTime *time.Time `json:"source_mtime,omitempty"`
+	SourceSize uint32     `json:"source_size,omitempty"`
+	HeaderSize int        `json:"header_size"`
+}
+
+// PycFile パース済みの .pyc ファイル
+type PycFile struct {
+	Header PycHeader
+	Code   *PyCode
+}
+
+// PyCode marshal された code オブジェクト
+type PyCode struct {
+	ArgCount        int
+	PosOnlyArgCount int
+	KwOnlyArgCount  int
+	NLocals         int
+	StackSize       int
+	Flags           uint32
+	Code            []byte
+	Consts          []PyObject
+	Names           []string
+	VarNames        []string
+	FreeVars        []string
+	CellVars        []string
+	LocalsPlusNames []string // 3.11+
+	LocalsPlusKinds []byte   // 3.11+
+	Filename        string
+	Name            string
+	QualName        string
+	FirstLineNo     int
+	LineTable       []byte
+	ExceptionTable  []byte
+}
+
+// PyObject marshal から復元したPythonオブジェクト
+// nil(None), bool, int64, *big.Int, float64, complex128, string(str), PyBytes, PyTuple, PyList, PyDict, PySet, *PyCode, PySingleton のいずれか
+type PyObject interface{}
+
+type (
+	PyBytes     []byte
+	PyTuple     []PyObject
+	PyList      []PyObject
+	PySet       []PyObject
+	PySingleton string // Ellipsis, StopIteration, NULL
+	PyDict      []PyDictItem
+)
+
+// PyDictItem 辞書の要素
+type PyDictItem struct {
+	Key   PyObject
+	Value PyObject
+}
+
+// マジックナンバー（リトルエンディアンのuint16）の範囲とバージョンの対応
+var pycMagicRanges = []struct {
+	from, to     uint16
+	major, minor int
+}{
+	{62011, 62021, 2, 3}, {62041, 62061, 2, 4}, {62071, 62131, 2, 5}, {62151, 62161, 2, 6}, {62171, 62211, 2, 7},
+	{3000, 3131, 3, 0}, {3141, 3151, 3, 1}, {3160, 3180, 3, 2}, {3190, 3230, 3, 3}, {3250, 3310, 3, 4},
+	{3320, 3351, 3, 5}, {3360, 3379, 3, 6}, {3390, 3399, 3, 7}, {3400, 3419, 3, 8}, {3420, 3429, 3, 9},
+	{3430, 3449, 3, 10}, {3450, 3499, 3, 11}, {3500, 3549, 3, 12}, {3550, 3599, 3, 13}, {3600, 3649, 3, 14},
+}
+
+// PycVersionForMagic マジックナンバーからPythonバージョンを求める
+func PycVersionForMagic(magic uint16) (int, int, bool) {
+	for _, r := range pycMagicRanges {
+		if magic >= r.from && magic <= r.to {
+			return r.major, r.minor, true
+		}
+	}
+	return 0, 0, false
+}
+
+// IsPycFile 先頭バイトが .pyc のマジックナンバーかどうかを判定
+func IsPycFile(data []byte) bool {
+	if len(data) < 8 || data[2] != '\r' || data[3] != '\n' {
+		return false
+	}
+	_, _, ok := PycVersionForMagic(binary.LittleEndian.Uint16(data))
+	return ok
+}
+
+// ParsePyc .pyc のヘッダーとトップレベルの code オブジェクトを読み込む
+func ParsePyc(data []byte) (*PycFile, error) {
+	if len(data) < 8 || data[2] != '\r' || data[3] != '\n' {
+		return nil, errors.New("not a pyc file")
+	}
+	magic := binary.LittleEndian.Uint16(data)
+	major, minor, ok := PycVersionForMagic(magic)
+	if !ok {
+		return nil, fmt.Errorf("unknown pyc magic number %d", magic)
+	}
+
+	h := PycHeader{
+		Magic:   magic,
+		Version: fmt.Sprintf("%d.%d", major, minor),
+		Major:   major,
+		Minor:   minor,
+	}
+
+	// ヘッダー長: 2.x/3.0-3.2 は8バイト、3.3-3.6 は12バイト、3.7+（PEP 552）は16バイト
+	switch {
+	case major == 3 && minor >= 7:
+		h.HeaderSize = 16
+	case major == 3 && minor >= 3:
+		h.HeaderSize = 12
+	default:
+		h.HeaderSize = 8
+	}
+	if len(data) < h.HeaderSize {
+		return nil, errors.New("truncated pyc header")
+	}
+
+	fields := data[4:h.HeaderSize]
+	if h.HeaderSize == 16 {
+		h.Flags = binary.LittleEndian.Uint32(fields)
+		h.HashBased = h.Flags&1 != 0
+		fields = fields[4:]
+	}
+	if !h.HashBased {
+		t := time.Unix(int64(binary.LittleEndian.Uint32(fields)), 0).UTC()
+		h.SourceTime = &t
+	}
+	if len(fields) >= 8 {
+		h.SourceSize = binary.LittleEndian.Uint32(fields[4:])
+	}
+
+	r := &marshalReader{data: data, pos: h.HeaderSize, major: major, minor: minor}
+	obj, err := r.readObject()
+	if err != nil {
+		return nil, err
+	}
+	code, ok := obj.(*PyCode)
+	if !ok {
+		return nil, errors.New("pyc does not contain a code object")
+	}
+	return &PycFile{Header: h, Code: code}, nil
+}
+
+// marshalReader Pythonの marshal 形式の読み取り
+type marshalReader struct {
+	data     []byte
+	pos      int
+	major    int
+	minor    int
+	refs     []PyObject
+	interned []string // Python 2 の 'R' 参照用
+	depth    int
+}
+
+var errMarshalEOF = errors.New("unexpected end of marshal data")
+
+func (r *marshalReader) readByte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, errMarshalEOF
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *marshalReader) readBytes(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, errMarshalEOF
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *marshalReader) readInt32() (int32, error) {
+	b, err := r.readBytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.LittleEndian.Uint32(b)), nil
+}
+
+func (r *marshalReader) readSize() (int, error) {
+	n, err := r.readInt32()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || int(n) > len(r.data) {
+		return 0, fmt.Errorf("invalid marshal size %d", n)
+	}
+	return int(n), nil
+}
+
+func (r *marshalReader) readObject() (PyObject, error) {
+	r.depth++
+	defer func() { r.depth-- }()
+	if r.depth > 200 {
+		return nil, errors.New("marshal data nested too deeply")
+	}
+
+	code, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	flag := code&0x80 != 0
+	typ := code &^ 0x80
+
+	// FLAG_REF 付きのコンテナは中身を読む前に参照番号を確保する
+	refIndex := -1
+	if flag {
+		refIndex = len(r.refs)
+		r.refs = append(r.refs, nil)
+	}
+
+	obj, err := r.readTyped(typ)
+	if err != nil {
+		return nil, err
+	}
+	if refIndex >= 0 {
+		r.refs[refIndex] = obj
+	}
+	return obj, nil
+}
+
+func (r *marshalReader) readTyped(typ byte) (PyObject, error) {
+	switch typ {
+	case '0':
+		return PySingleton("NULL"), nil
+	case 'N':
+		return nil, nil
+	case 'F':
+		return false, nil
+	case 'T':
+		return true, nil
+	case 'S':
+		return PySingleton("StopIteration"), nil
+	case '.':
+		return PySingleton("Ellipsis"), nil
+	case 'i':
+		v, err := r.readInt32()
+		return int64(v), err
+	case 'I':
+		b, err := r.readBytes(8)
+		if err != nil {
+			return nil, err
+		}
+		return int64(binary.LittleEndian.Uint64(b)), nil
+	case 'l':
+		return r.readLong()
+	case 'f':
+		n, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.readBytes(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return strconv.ParseFloat(string(b), 64)
+	case 'g':
+		b, err := r.readBytes(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case 'x':
+		var parts [2]float64
+		for i := range parts {
+			n, err := r.readByte()
+			if err != nil {
+				return nil, err
+			}
+			b, err := r.readBytes(int(n))
+			if err != nil {
+				return nil, err
+			}
+			if parts[i], err = strconv.ParseFloat(string(b), 64); err != nil {
+				return nil, err
+			}
+		}
+		return complex(parts[0], parts[1]), nil
+	case 'y':
+		b, err := r.readBytes(16)
+		if err != nil {
+			return nil, err
+		}
+		return complex(math.Float64frombits(binary.LittleEndian.Uint64(b)), math.Float64frombits(binary.LittleEndian.Uint64(b[8:]))), nil
+	case 's':
+		n, err := r.readSize()
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.readBytes(n)
+		if err != nil {
+			return nil, err
+		}
+		if r.major == 2 {
+			// Python 2 の str はバイト列だが、名前やファイル名として扱えるよう文字列にする
+			return string(b), nil
+		}
+		return PyBytes(append([]byte{}, b...)), nil
+	case 't', 'u', 'a', 'A':
+		n, err := r.readSize()
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.readBytes(n)
+		if err != nil {
+			return nil, err
+		}
+		s := string(b)
+		if typ == 't' && r.major == 2 {
+			r.interned = append(r.interned, s)
+		}
+		return s, nil
+	case 'z', 'Z':
+		n, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.readBytes(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case 'R':
+		idx, err := r.readInt32()
+		if err != nil {
+			return nil, err
+		}
+		if idx < 0 || int(idx) >= len(r.interned) {
+			return nil, fmt.Errorf("invalid string reference %d", idx)
+		}
+		return r.interned[idx], nil
+	case 'r':
+		idx, err := r.readInt32()
+		if err != nil {
+			return nil, err
+		}
+		if idx < 0 || int(idx) >= len(r.refs) {
+			return nil, fmt.Errorf("invalid object reference %d", idx)
+		}
+		return r.refs[idx], nil
+	case '(', '[', '<', '>':
+		n, err := r.readSize()
+		if err != nil {
+			return nil, err
+		}
+		items, err := r.readItems(n)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case '(':
+			return PyTuple(items), nil
+		case '[':
+			return PyList(items), nil
+		}
+		return PySet(items), nil
+	case ')':
+		n, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		items, err := r.readItems(int(n))
+		return PyTuple(items), err
+	case '{':
+		var dict PyDict
+		for {
+			key, err := r.readObject()
+			if err != nil {
+				return nil, err
+			}
+			if s, ok := key.(PySingleton); ok && s == "NULL" {
+				return dict, nil
+			}
+			value, err := r.readObject()
+			if err != nil {
+				return nil, err
+			}
+			dict = append(dict, PyDictItem{Key: key, Value: value})
+		}
+	case 'c':
+		return r.readCode()
+	}
+	return nil, fmt.Errorf("unknown marshal type %q at offset %d", typ, r.pos-1)
+}
+
+func (r *marshalReader) readItems(n int) ([]PyObject, error) {
+	items := make([]PyObject, 0, n)
+	for i := 0; i < n; i++ {
+		item, err := r.readObject()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// readLong 15ビット単位の多倍長整数
+func (r *marshalReader) readLong() (PyObject, error) {
+	n, err := r.readInt32()
+	if err != nil {
+		return nil, err
+	}
+	size := int(n)
+	if size < 0 {
+		size = -size
+	}
+	v := new(big.Int)
+	digits, err := r.readBytes(size * 2)
+	if err != nil {
+		return nil, err
+	}
+	for i := size - 1; i >= 0; i-- {
+		v.Lsh(v, 15)
+		v.Or(v, big.NewInt(int64(binary.LittleEndian.Uint16(digits[i*2:]))))
+	}
+	if n < 0 {
+		v.Neg(v)
+	}
+	if v.IsInt64() {
+		return v.Int64(), nil
+	}
+	return v, nil
+}
+
+func (r *marshalReader) readCode() (*PyCode, error) {
+	c := &PyCode{}
+	readInt := func(dst *int) error {
+		v, err := r.readInt32()
+		*dst = int(v)
+		return err
+	}
+
+	v311 := r.major == 3 && r.minor >= 11
+	var err error
+	if err = readInt(&c.ArgCount); err != nil {
+		return nil, err
+	}
+	if r.major == 3 && r.minor >= 8 {
+		if err = readInt(&c.PosOnlyArgCount); err != nil {
+			return nil, err
+		}
+	}
+	if r.major == 3 {
+		if err = readInt(&c.KwOnlyArgCount); err != nil {
+			return nil, err
+		}
+	}
+	if c.ArgCount < 0 || c.PosOnlyArgCount < 0 || c.KwOnlyArgCount < 0 {
+		return nil, fmt.Errorf("invalid argument count %d/%d/%d", c.ArgCount, c.PosOnlyArgCount, c.KwOnlyArgCount)
+	}
+	if !v311 {
+		if err = readInt(&c.NLocals); err != nil {
+			return nil, err
+		}
+	}
+	if err = readInt(&c.StackSize); err != nil {
+		return nil, err
+	}
+	var flags int
+	if err = readInt(&flags); err != nil {
+		return nil, err
+	}
+	c.Flags = uint32(flags)
+
+	if c.Code, err = r.readBytesObject(); err != nil {
+		return nil, err
+	}
+	consts, err := r.readObject()
+	if err != nil {
+		return nil, err
+	}
+	c.Consts = pySequence(consts)
+	if c.Names, err = r.readStringTuple(); err != nil {
+		return nil, err
+	}
+
+	if v311 {
+		if c.LocalsPlusNames, err = r.readStringTuple(); err != nil {
+			return nil, err
+		}
+		if c.LocalsPlusKinds, err = r.readBytesObject(); err != nil {
+			return nil, err
+		}
+		// 3.11+ では localsplus の種別から従来の varnames/cellvars/freevars を再構成する
+		for i, name := range c.LocalsPlusNames {
+			if i >= len(c.LocalsPlusKinds) {
+				break
+			}
+			kind := c.LocalsPlusKinds[i]
+			switch {
+			case kind&0x20 != 0: // CO_FAST_LOCAL
+				c.VarNames = append(c.VarNames, name)
+			case kind&0x80 != 0: // CO_FAST_FREE
+				c.FreeVars = append(c.FreeVars, name)
+			case kind&0x40 != 0: // CO_FAST_CELL
+				c.CellVars = append(c.CellVars, name)
+			}
+		}
+		c.NLocals = len(c.VarNames)
+	} else {
+		if c.VarNames, err = r.readStringTuple(); err != nil {
+			return nil, err
+		}
+		if c.FreeVars, err = r.readStringTuple(); err != nil {
+			return nil, err
+		}
+		if c.CellVars, err = r.readStringTuple(); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Filename, err = r.readString(); err != nil {
+		return nil, err
+	}
+	if c.Name, err = r.readString(); err != nil {
+		return nil, err
+	}
+	c.QualName = c.Name
+	if v311 {
+		if c.QualName, err = r.readString(); err != nil {
+			return nil, err
+		}
+	}
+	if err = readInt(&c.FirstLineNo); err != nil {
+		return nil, err
+	}
+	if c.LineTable, err = r.readBytesObject(); err != nil {
+		return nil, err
+	}
+	if v311 {
+		if c.ExceptionTable, err = r.readBytesObject(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (r *marshalReader) readBytesObject() ([]byte, error) {
+	obj, err := r.readObject()
+	if err != nil {
+		return nil, err
+	}
+	switch v := obj.(type) {
+	case PyBytes:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("expected bytes, got %T", obj)
+}
+
+func (r *marshalReader) readString() (string, error) {
+	obj, err := r.readObject()
+	if err != nil {
+		return "", err
+	}
+	switch v := obj.(type) {
+	case string:
+		return v, nil
+	case PyBytes:
+		return string(v), nil
+	}
+	return "", fmt.Errorf("expected string, got %T", obj)
+}
+
+func (r *marshalReader) readStringTuple() ([]string, error) {
+	obj, err := r.readObject()
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, item := range pySequence(obj) {
+		switch v := item.(type) {
+		case string:
+			out = append(out, v)
+		case PyBytes:
+			out = append(out, string(v))
+		default:
+			out = append(out, FormatPyObject(item))
+		}
+	}
+	return out, nil
+}
+
+func pySequence(obj PyObject) []PyObject {
+	switch v := obj.(type) {
+	case PyTuple:
+		return v
+	case PyList:
+		return v
+	case PySet:
+		return v
+	}
+	return nil
+}
+
+// FormatPyObject Pythonの repr に近い形で文字列化する
+func FormatPyObject(obj PyObject) string {
+	switch v := obj.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case *big.Int:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case complex128:
+		return fmt.Sprintf("(%g+%gj)", real(v), imag(v))
+	case string:
+		return pyQuote(v)
+	case PyBytes:
+		if utf8.Valid(v) {
+			return "b" + pyQuote(string(v))
+		}
+		return fmt.Sprintf("b'<%d bytes>'", len(v))
+	case PyTuple:
+		if len(v) == 1 {
+			return "(" + FormatPyObject(v[0]) + ",)"
+		}
+		return "(" + formatPyItems(v) + ")"
+	case PyList:
+		return "[" + formatPyItems(v) + "]"
+	case PySet:
+		return "{" + formatPyItems(v) + "}"
+	case PyDict:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = FormatPyObject(item.Key) + ": " + FormatPyObject(item.Value)
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case *PyCode:
+		return fmt.Sprintf("<code object %s, line %d>", v.Name, v.FirstLineNo)
+	case PySingleton:
+		return string(v)
+	}
+	return fmt.Sprintf("%v", obj)
+}
+
+func formatPyItems(items []PyObject) string {
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = FormatPyObject(item)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func pyQuote(s string) string {
+	q := strconv.Quote(s)
+	if !strings.Contains(s, "'") {
+		q = "'" + strings.ReplaceAll(q[1:len(q)-1], `\"`, `"`) + "'"
+	}
+	return q
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// PyImport バイトコードから復元した import 文
+type PyImport struct {
+	Module string   `json:"module"`
+	Names  []string `json:"names,omitempty"`
+	Level  int      `json:"level,omitempty"`
+}
+
+// PyFunctionInfo バイトコードから復元した関数・クラス本体
+type PyFunctionInfo struct {
+	QualName  string   `json:"qualname"`
+	Args      []string `json:"args,omitempty"`
+	FirstLine int      `json:"first_line"`
+}
+
+// PycStructure .pyc から復元した名前・定数・import の一覧
+type PycStructure struct {
+	Imports   []PyImport       `json:"imports"`
+	Functions []PyFunctionInfo `json:"functions"`
+	Names     []string         `json:"names"`
+	Constants []string         `json:"constants"`
+}
+
+// PycReport pyc_decompile 解析のファイル単位の結果
+type PycReport struct {
+	FileID         uint         `json:"file_id"`
+	Name           string       `json:"name"`
+	Header         *PycHeader   `json:"header,omitempty"`
+	Structure      PycStructure `json:"structure"`
+	CreatedFileIDs []uint       `json:"created_file_ids"`
+	Errors         []string     `json:"errors,omitempty"`
+}
+
+// 定数一覧に載せる件数の上限
+const maxPycConstants = 500
+
+// RecoverPycStructure code オブジェクトを再帰的にたどり、import・関数・名前・定数を復元する
+func RecoverPycStructure(code *PyCode, major, minor int) PycStructure {
+	s := PycStructure{Imports: []PyImport{}, Functions: []PyFunctionInfo{}, Names: []string{}, Constants: []string{}}
+	names := make(map[string]bool)
+	consts := make(map[string]bool)
+	imports := make(map[string]bool)
+
+	// 参照（'r'）で同じ code オブジェクトが何度も現れても一度だけたどる
+	seen := make(map[*PyCode]bool)
+	var walk func(c *PyCode, top bool)
+	walk = func(c *PyCode, top bool) {
+		if seen[c] {
+			return
+		}
+		seen[c] = true
+		if !top {
+			s.Functions = append(s.Functions, PyFunctionInfo{QualName: c.QualName, Args: c.argNames(), FirstLine: c.FirstLineNo})
+		}
+		for _, name := range c.Names {
+			names[name] = true
+		}
+
+		// IMPORT_NAME の直前に積まれる (level, fromlist) を追う
+		var prevConsts [2]PyObject
+		for _, in := range c.Disassemble(major, minor) {
+			switch in.Opname {
+			case "LOAD_CONST":
+				prevConsts[0], prevConsts[1] = prevConsts[1], nil
+				if in.Arg < len(c.Consts) {
+					prevConsts[1] = c.Consts[in.Arg]
+				}
+				continue
+			case "IMPORT_NAME":
+				imp := PyImport{Module: in.ArgRepr}
+				if level, ok := prevConsts[0].(int64); ok && level > 0 {
+					imp.Level = int(level)
+				}
+				for _, n := range pySequence(prevConsts[1]) {
+					if str, ok := n.(string); ok {
+						imp.Names = append(imp.Names, str)
+					}
+				}
+				key := fmt.Sprintf("%d:%s:%s", imp.Level, imp.Module, strings.Join(imp.Names, ","))
+				if !imports[key] {
+					imports[key] = true
+					s.Imports = append(s.Imports, imp)
+				}
+			}
+			prevConsts = [2]PyObject{}
+		}
+
+		for _, cst := range c.Consts {
+			switch v := cst.(type) {
+			case *PyCode:
+				walk(v, false)
+			case nil, bool, PyTuple, PySet, PyList, PyDict, PySingleton:
+			default:
+				repr := FormatPyObject(v)
+				if !consts[repr] && len(s.Constants) < maxPycConstants {
+					consts[repr] = true
+					s.Constants = append(s.Constants, repr)
+				}
+			}
+		}
+	}
+	walk(code, true)
+
+	for name := range names {
+		s.Names = append(s.Names, name)
+	}
+	sort.Strings(s.Names)
+	return s
+}
+
+// argNames 引数名（*args, **kwargs を含む）を返す
+func (c *PyCode) argNames() []string {
+	n := c.ArgCount + c.KwOnlyArgCount
+	if c.Flags&0x04 != 0 { // CO_VARARGS
+		n++
+	}
+	if c.Flags&0x08 != 0 { // CO_VARKEYWORDS
+		n++
+	}
+	n = min(max(n, 0), len(c.VarNames))
+	return c.VarNames[:n]
+}
+
+// FormatPyImports 復元した import を Python の構文で出力する
+func FormatPyImports(imports []PyImport) string {
+	var sb strings.Builder
+	for _, imp := range imports {
+		module := strings.Repeat(".", imp.Level) + imp.Module
+		if len(imp.Names) > 0 {
+			fmt.Fprintf(&sb, "from %s import %s\n", module, strings.Join(imp.Names, ", "))
+		} else {
+			fmt.Fprintf(&sb, "import %s\n", module)
+		}
+	}
+	return sb.String()
+}
+
+// loadPyc アップロードされた .pyc をディスクから読み込んでパースする
+func loadPyc(file *models.File) (*PycFile, error) {
+	data, err := os.ReadFile(file.Path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePyc(data)
+}
+
+// pycSourceName __pycache__/foo.cpython-311.pyc から foo を取り出す
+func pycSourceName(name string) string {
+	base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	if i := strings.Index(base, "."); i > 0 {
+		base = base[:i]
+	}
+	return base
+}
+
+// runPycDecompile .pyc を逆アセンブルし、復元した構造をAIに渡して近似ソースを生成する
+func (w *AnalysisWorker) runPycDecompile(ai *AIService, files []models.File) (string, error) {
+	var reports []PycReport
+	for i := range files {
+		file := &files[i]
+		if file.Language != "python-bytecode" || file.Origin != "" {
+			continue
+		}
+		w.removeDerivedFiles(file.ID, "pyc_decompile")
+
+		report := PycReport{FileID: file.ID, Name: file.Name, CreatedFileIDs: []uint{}}
+		pyc, err := loadPyc(file)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			reports = append(reports, report)
+			continue
+		}
+		report.Header = &pyc.Header
+		report.Structure = RecoverPycStructure(pyc.Code, pyc.Header.Major, pyc.Header.Minor)
+
+		listing := FormatDisassembly(pyc.Code, pyc.Header.Major, pyc.Header.Minor)
+		save := func(name, content string) {
+			derived, err := w.createDerivedFile(file, "pyc_decompile", name, []byte(content))
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("failed to save %s: %v", name, err))
+				return
+			}
+			report.CreatedFileIDs = append(report.CreatedFileIDs, derived.ID)
+		}
+
+		base := pycSourceName(file.Name)
+		save(base+".dis.txt", listing)
+
+		source, err := ai.DecompilePython(pyc.Header.Version, listing, report.Structure)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("decompile failed: %v", err))
+		} else {
+			save(base+".py", source)
+		}
+		reports = append(reports, report)
+	}
+
+	if len(reports) == 0 {
+		return "", fmt.Errorf("no Python bytecode files found in project")
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"files": reports})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// recoverPycStructures プロジェクト内の .pyc から import・名前・定数を復元する（dependency_map 用）
+func recoverPycStructures(files []models.File) map[string]PycStructure {
+	structures := make(map[string]PycStructure)
+	for i := range files {
+		file := &files[i]
+		if file.Language != "python-bytecode" {
+			continue
+		}
+		pyc, err := loadPyc(file)
+		if err != nil {
+			continue
+		}
+		structures[file.Name] = RecoverPycStructure(pyc.Code, pyc.Header.Major, pyc.Header.Minor)
+	}
+	return structures
+}
+
+// mergeBytecodeDependencies 依存関係分析の結果に .pyc から復元した構造を追加する
+func mergeBytecodeDependencies(result string, structures map[string]PycStructure) (string, error) {
+	if len(structures) == 0 {
+		return result, nil
+	}
+
+	var merged map[string]interface{}
+	if err := json.Unmarshal([]byte(result), &merged); err != nil {
+		merged = map[string]interface{}{"analysis": result}
+	}
+	merged["bytecode"] = structures
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,566 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PyInstruction 逆アセンブルした1命令
+type PyInstruction struct {
+	Offset   int    `json:"offset"`
+	Line     int    `json:"line,omitempty"`
+	Opname   string `json:"opname"`
+	Arg      int    `json:"arg"`
+	HasArg   bool   `json:"-"`
+	ArgRepr  string `json:"arg_repr,omitempty"`
+	JumpTo   int    `json:"jump_to,omitempty"`
+	IsTarget bool   `json:"-"`
+}
+
+// Python 2.7 のオペコード（2.3〜2.6 もほぼ同一）
+var pyOpcodes27 = map[int]string{
+	0: "STOP_CODE", 1: "POP_TOP", 2: "ROT_TWO", 3: "ROT_THREE", 4: "DUP_TOP", 5: "ROT_FOUR", 9: "NOP",
+	10: "UNARY_POSITIVE", 11: "UNARY_NEGATIVE", 12: "UNARY_NOT", 13: "UNARY_CONVERT", 15: "UNARY_INVERT",
+	19: "BINARY_POWER", 20: "BINARY_MULTIPLY", 21: "BINARY_DIVIDE", 22: "BINARY_MODULO", 23: "BINARY_ADD",
+	24: "BINARY_SUBTRACT", 25: "BINARY_SUBSCR", 26: "BINARY_FLOOR_DIVIDE", 27: "BINARY_TRUE_DIVIDE",
+	28: "INPLACE_FLOOR_DIVIDE", 29: "INPLACE_TRUE_DIVIDE", 30: "SLICE+0", 31: "SLICE+1", 32: "SLICE+2", 33: "SLICE+3",
+	40: "STORE_SLICE+0", 41: "STORE_SLICE+1", 42: "STORE_SLICE+2", 43: "STORE_SLICE+3",
+	50: "DELETE_SLICE+0", 51: "DELETE_SLICE+1", 52: "DELETE_SLICE+2", 53: "DELETE_SLICE+3", 54: "STORE_MAP",
+	55: "INPLACE_ADD", 56: "INPLACE_SUBTRACT", 57: "INPLACE_MULTIPLY", 58: "INPLACE_DIVIDE", 59: "INPLACE_MODULO",
+	60: "STORE_SUBSCR", 61: "DELETE_SUBSCR", 62: "BINARY_LSHIFT", 63: "BINARY_RSHIFT", 64: "BINARY_AND",
+	65: "BINARY_XOR", 66: "BINARY_OR", 67: "INPLACE_POWER", 68: "GET_ITER", 70: "PRINT_EXPR", 71: "PRINT_ITEM",
+	72: "PRINT_NEWLINE", 73: "PRINT_ITEM_TO", 74: "PRINT_NEWLINE_TO", 75: "INPLACE_LSHIFT", 76: "INPLACE_RSHIFT",
+	77: "INPLACE_AND", 78: "INPLACE_XOR", 79: "INPLACE_OR", 80: "BREAK_LOOP", 81: "WITH_CLEANUP", 82: "LOAD_LOCALS",
+	83: "RETURN_VALUE", 84: "IMPORT_STAR", 85: "EXEC_STMT", 86: "YIELD_VALUE", 87: "POP_BLOCK", 88: "END_FINALLY",
+	89: "BUILD_CLASS", 90: "STORE_NAME", 91: "DELETE_NAME", 92: "UNPACK_SEQUENCE", 93: "FOR_ITER", 94: "LIST_APPEND",
+	95: "STORE_ATTR", 96: "DELETE_ATTR", 97: "STORE_GLOBAL", 98: "DELETE_GLOBAL", 99: "DUP_TOPX", 100: "LOAD_CONST",
+	101: "LOAD_NAME", 102: "BUILD_TUPLE", 103: "BUILD_LIST", 104: "BUILD_SET", 105: "BUILD_MAP", 106: "LOAD_ATTR",
+	107: "COMPARE_OP", 108: "IMPORT_NAME", 109: "IMPORT_FROM", 110: "JUMP_FORWARD", 111: "JUMP_IF_FALSE_OR_POP",
+	112: "JUMP_IF_TRUE_OR_POP", 113: "JUMP_ABSOLUTE", 114: "POP_JUMP_IF_FALSE", 115: "POP_JUMP_IF_TRUE",
+	116: "LOAD_GLOBAL", 119: "CONTINUE_LOOP", 120: "SETUP_LOOP", 121: "SETUP_EXCEPT", 122: "SETUP_FINALLY",
+	124: "LOAD_FAST", 125: "STORE_FAST", 126: "DELETE_FAST", 130: "RAISE_VARARGS", 131: "CALL_FUNCTION",
+	132: "MAKE_FUNCTION", 133: "BUILD_SLICE", 134: "MAKE_CLOSURE", 135: "LOAD_CLOSURE", 136: "LOAD_DEREF",
+	137: "STORE_DEREF", 140: "CALL_FUNCTION_VAR", 141: "CALL_FUNCTION_KW", 142: "CALL_FUNCTION_VAR_KW",
+	143: "SETUP_WITH", 145: "EXTENDED_ARG", 146: "SET_ADD", 147: "MAP_ADD",
+}
+
+// Python 3.6 のオペコード（3.0〜3.10 の差分は pyOpcodeTable で上書きする）
+var pyOpcodes36 = map[int]string{
+	1: "POP_TOP", 2: "ROT_TWO", 3: "ROT_THREE", 4: "DUP_TOP", 5: "DUP_TOP_TWO", 9: "NOP", 10: "UNARY_POSITIVE",
+	11: "UNARY_NEGATIVE", 12: "UNARY_NOT", 15: "UNARY_INVERT", 16: "BINARY_MATRIX_MULTIPLY",
+	17: "INPLACE_MATRIX_MULTIPLY", 19: "BINARY_POWER", 20: "BINARY_MULTIPLY", 22: "BINARY_MODULO", 23: "BINARY_ADD",
+	24: "BINARY_SUBTRACT", 25: "BINARY_SUBSCR", 26: "BINARY_FLOOR_DIVIDE", 27: "BINARY_TRUE_DIVIDE",
+	28: "INPLACE_FLOOR_DIVIDE", 29: "INPLACE_TRUE_DIVIDE", 50: "GET_AITER", 51: "GET_ANEXT", 52: "BEFORE_ASYNC_WITH",
+	55: "INPLACE_ADD", 56: "INPLACE_SUBTRACT", 57: "INPLACE_MULTIPLY", 59: "INPLACE_MODULO", 60: "STORE_SUBSCR",
+	61: "DELETE_SUBSCR", 62: "BINARY_LSHIFT", 63: "BINARY_RSHIFT", 64: "BINARY_AND", 65: "BINARY_XOR", 66: "BINARY_OR",
+	67: "INPLACE_POWER", 68: "GET_ITER", 69: "GET_YIELD_FROM_ITER", 70: "PRINT_EXPR", 71: "LOAD_BUILD_CLASS",
+	72: "YIELD_FROM", 73: "GET_AWAITABLE", 75: "INPLACE_LSHIFT", 76: "INPLACE_RSHIFT", 77: "INPLACE_AND",
+	78: "INPLACE_XOR", 79: "INPLACE_OR", 80: "BREAK_LOOP", 81: "WITH_CLEANUP_START", 82: "WITH_CLEANUP_FINISH",
+	83: "RETURN_VALUE", 84: "IMPORT_STAR", 85: "SETUP_ANNOTATIONS", 86: "YIELD_VALUE", 87: "POP_BLOCK",
+	88: "END_FINALLY", 89: "POP_EXCEPT", 90: "STORE_NAME", 91: "DELETE_NAME", 92: "UNPACK_SEQUENCE", 93: "FOR_ITER",
+	94: "UNPACK_EX", 95: "STORE_ATTR", 96: "DELETE_ATTR", 97: "STORE_GLOBAL", 98: "DELETE_GLOBAL", 100: "LOAD_CONST",
+	101: "LOAD_NAME", 102: "BUILD_TUPLE", 103: "BUILD_LIST", 104: "BUILD_SET", 105: "BUILD_MAP", 106: "LOAD_ATTR",
+	107: "COMPARE_OP", 108: "IMPORT_NAME", 109: "IMPORT_FROM", 110: "JUMP_FORWARD", 111: "JUMP_IF_FALSE_OR_POP",
+	112: "JUMP_IF_TRUE_OR_POP", 113: "JUMP_ABSOLUTE", 114: "POP_JUMP_IF_FALSE", 115: "POP_JUMP_IF_TRUE",
+	116: "LOAD_GLOBAL", 119: "CONTINUE_LOOP", 120: "SETUP_LOOP", 121: "SETUP_EXCEPT", 122: "SETUP_FINALLY",
+	124: "LOAD_FAST", 125: "STORE_FAST", 126: "DELETE_FAST", 127: "STORE_ANNOTATION", 130: "RAISE_VARARGS",
+	131: "CALL_FUNCTION", 132: "MAKE_FUNCTION", 133: "BUILD_SLICE", 135: "LOAD_CLOSURE", 136: "LOAD_DEREF",
+	137: "STORE_DEREF", 138: "DELETE_DEREF", 141: "CALL_FUNCTION_KW", 142: "CALL_FUNCTION_EX", 143: "SETUP_WITH",
+	144: "EXTENDED_ARG", 145: "LIST_APPEND", 146: "SET_ADD", 147: "MAP_ADD", 148: "LOAD_CLASSDEREF",
+	149: "BUILD_LIST_UNPACK", 150: "BUILD_MAP_UNPACK", 151: "BUILD_MAP_UNPACK_WITH_CALL", 152: "BUILD_TUPLE_UNPACK",
+	153: "BUILD_SET_UNPACK", 154: "SETUP_ASYNC_WITH", 155: "FORMAT_VALUE", 156: "BUILD_CONST_KEY_MAP",
+	157: "BUILD_STRING", 158: "BUILD_TUPLE_UNPACK_WITH_CALL",
+}
+
+// Python 3.11 のオペコード
+var pyOpcodes311 = map[int]string{
+	0: "CACHE", 1: "POP_TOP", 2: "PUSH_NULL", 9: "NOP", 11: "UNARY_NEGATIVE", 12: "UNARY_NOT", 15: "UNARY_INVERT",
+	25: "BINARY_SUBSCR", 30: "GET_LEN", 31: "MATCH_MAPPING", 32: "MATCH_SEQUENCE", 33: "MATCH_KEYS",
+	35: "PUSH_EXC_INFO", 36: "CHECK_EXC_MATCH", 37: "CHECK_EG_MATCH", 49: "WITH_EXCEPT_START", 50: "GET_AITER",
+	51: "GET_ANEXT", 52: "BEFORE_ASYNC_WITH", 53: "BEFORE_WITH", 54: "END_ASYNC_FOR", 60: "STORE_SUBSCR",
+	61: "DELETE_SUBSCR", 68: "GET_ITER", 69: "GET_YIELD_FROM_ITER", 70: "PRINT_EXPR", 71: "LOAD_BUILD_CLASS",
+	74: "LOAD_ASSERTION_ERROR", 75: "RETURN_GENERATOR", 82: "LIST_TO_TUPLE", 83: "RETURN_VALUE", 84: "IMPORT_STAR",
+	85: "SETUP_ANNOTATIONS", 86: "YIELD_VALUE", 87: "ASYNC_GEN_WRAP", 88: "PREP_RERAISE_STAR", 89: "POP_EXCEPT",
+	90: "STORE_NAME", 91: "DELETE_NAME", 92: "UNPACK_SEQUENCE", 93: "FOR_ITER", 94: "UNPACK_EX", 95: "STORE_ATTR",
+	96: "DELETE_ATTR", 97: "STORE_GLOBAL", 98: "DELETE_GLOBAL", 99: "SWAP", 100: "LOAD_CONST", 101: "LOAD_NAME",
+	102: "BUILD_TUPLE", 103: "BUILD_LIST", 104: "BUILD_SET", 105: "BUILD_MAP", 106: "LOAD_ATTR", 107: "COMPARE_OP",
+	108: "IMPORT_NAME", 109: "IMPORT_FROM", 110: "JUMP_FORWARD", 111: "JUMP_IF_FALSE_OR_POP",
+	112: "JUMP_IF_TRUE_OR_POP", 114: "POP_JUMP_FORWARD_IF_FALSE", 115: "POP_JUMP_FORWARD_IF_TRUE",
+	116: "LOAD_GLOBAL", 117: "IS_OP", 118: "CONTAINS_OP", 119: "RERAISE", 120: "COPY", 122: "BINARY_OP", 123: "SEND",
+	124: "LOAD_FAST", 125: "STORE_FAST", 126: "DELETE_FAST", 128: "POP_JUMP_FORWARD_IF_NOT_NONE",
+	129: "POP_JUMP_FORWARD_IF_NONE", 130: "RAISE_VARARGS", 131: "GET_AWAITABLE", 132: "MAKE_FUNCTION",
+	133: "BUILD_SLICE", 134: "JUMP_BACKWARD_NO_INTERRUPT", 135: "MAKE_CELL", 136: "LOAD_CLOSURE", 137: "LOAD_DEREF",
+	138: "STORE_DEREF", 139: "DELETE_DEREF", 140: "JUMP_BACKWARD", 142: "CALL_FUNCTION_EX", 144: "EXTENDED_ARG",
+	145: "LIST_APPEND", 146: "SET_ADD", 147: "MAP_ADD", 148: "LOAD_CLASSDEREF", 149: "COPY_FREE_VARS", 151: "RESUME",
+	152: "MATCH_CLASS", 155: "FORMAT_VALUE", 156: "BUILD_CONST_KEY_MAP", 157: "BUILD_STRING", 160: "LOAD_METHOD",
+	162: "LIST_EXTEND", 163: "SET_UPDATE", 164: "DICT_MERGE", 165: "DICT_UPDATE", 166: "PRECALL", 171: "CALL",
+	172: "KW_NAMES", 173: "POP_JUMP_BACKWARD_IF_NOT_NONE", 174: "POP_JUMP_BACKWARD_IF_NONE",
+	175: "POP_JUMP_BACKWARD_IF_FALSE", 176: "POP_JUMP_BACKWARD_IF_TRUE",
+}
+
+// Python 3.12 のオペコード
+var pyOpcodes312 = map[int]string{
+	0: "CACHE", 1: "POP_TOP", 2: "PUSH_NULL", 3: "INTERPRETER_EXIT", 4: "END_FOR", 5: "END_SEND", 9: "NOP",
+	11: "UNARY_NEGATIVE", 12: "UNARY_NOT", 15: "UNARY_INVERT", 17: "RESERVED", 25: "BINARY_SUBSCR",
+	26: "BINARY_SLICE", 27: "STORE_SLICE", 30: "GET_LEN", 31: "MATCH_MAPPING", 32: "MATCH_SEQUENCE",
+	33: "MATCH_KEYS", 35: "PUSH_EXC_INFO", 36: "CHECK_EXC_MATCH", 37: "CHECK_EG_MATCH", 49: "WITH_EXCEPT_START",
+	50: "GET_AITER", 51: "GET_ANEXT", 52: "BEFORE_ASYNC_WITH", 53: "BEFORE_WITH", 54: "END_ASYNC_FOR",
+	55: "CLEANUP_THROW", 60: "STORE_SUBSCR", 61: "DELETE_SUBSCR", 68: "GET_ITER", 69: "GET_YIELD_FROM_ITER",
+	71: "LOAD_BUILD_CLASS", 74: "LOAD_ASSERTION_ERROR", 75: "RETURN_GENERATOR", 83: "RETURN_VALUE",
+	85: "SETUP_ANNOTATIONS", 87: "LOAD_LOCALS", 89: "POP_EXCEPT", 90: "STORE_NAME", 91: "DELETE_NAME",
+	92: "UNPACK_SEQUENCE", 93: "FOR_ITER", 94: "UNPACK_EX", 95: "STORE_ATTR", 96: "DELETE_ATTR", 97: "STORE_GLOBAL",
+	98: "DELETE_GLOBAL", 99: "SWAP", 100: "LOAD_CONST", 101: "LOAD_NAME", 102: "BUILD_TUPLE", 103: "BUILD_LIST",
+	104: "BUILD_SET", 105: "BUILD_MAP", 106: "LOAD_ATTR", 107: "COMPARE_OP", 108: "IMPORT_NAME", 109: "IMPORT_FROM",
+	110: "JUMP_FORWARD", 114: "POP_JUMP_IF_FALSE", 115: "POP_JUMP_IF_TRUE", 116: "LOAD_GLOBAL", 117: "IS_OP",
+	118: "CONTAINS_OP", 119: "RERAISE", 120: "COPY", 121: "RETURN_CONST", 122: "BINARY_OP", 123: "SEND",
+	124: "LOAD_FAST", 125: "STORE_FAST", 126: "DELETE_FAST", 127: "LOAD_FAST_CHECK", 128: "POP_JUMP_IF_NOT_NONE",
+	129: "POP_JUMP_IF_NONE", 130: "RAISE_VARARGS", 131: "GET_AWAITABLE", 132: "MAKE_FUNCTION", 133: "BUILD_SLICE",
+	134: "JUMP_BACKWARD_NO_INTERRUPT", 135: "MAKE_CELL", 136: "LOAD_CLOSURE", 137: "LOAD_DEREF", 138: "STORE_DEREF",
+	139: "DELETE_DEREF", 140: "JUMP_BACKWARD", 141: "LOAD_SUPER_ATTR", 142: "CALL_FUNCTION_EX",
+	143: "LOAD_FAST_AND_CLEAR", 144: "EXTENDED_ARG", 145: "LIST_APPEND", 146: "SET_ADD", 147: "MAP_ADD",
+	149: "COPY_FREE_VARS", 150: "YIELD_VALUE", 151: "RESUME", 152: "MATCH_CLASS", 155: "FORMAT_VALUE",
+	156: "BUILD_CONST_KEY_MAP", 157: "BUILD_STRING", 162: "LIST_EXTEND", 163: "SET_UPDATE", 164: "DICT_MERGE",
+	165: "DICT_UPDATE", 171: "CALL", 172: "KW_NAMES", 173: "CALL_INTRINSIC_1", 174: "CALL_INTRINSIC_2",
+	175: "LOAD_FROM_DICT_OR_GLOBALS", 176: "LOAD_FROM_DICT_OR_DEREF",
+}
+
+// Python 3.13 のオペコード（3.13 で番号が振り直された）
+var pyOpcodes313 = map[int]string{
+	0: "CACHE", 1: "BEFORE_ASYNC_WITH", 2: "BEFORE_WITH", 4: "BINARY_SLICE", 5: "BINARY_SUBSCR",
+	6: "CHECK_EG_MATCH", 7: "CHECK_EXC_MATCH", 8: "CLEANUP_THROW", 9: "DELETE_SUBSCR", 10: "END_ASYNC_FOR",
+	11: "END_FOR", 12: "END_SEND", 13: "EXIT_INIT_CHECK", 14: "FORMAT_SIMPLE", 15: "FORMAT_WITH_SPEC",
+	16: "GET_AITER", 17: "RESERVED", 18: "GET_ANEXT", 19: "GET_ITER", 20: "GET_LEN", 21: "GET_YIELD_FROM_ITER",
+	22: "INTERPRETER_EXIT", 23: "LOAD_ASSERTION_ERROR", 24: "LOAD_BUILD_CLASS", 25: "LOAD_LOCALS",
+	26: "MAKE_FUNCTION", 27: "MATCH_KEYS", 28: "MATCH_MAPPING", 29: "MATCH_SEQUENCE", 30: "NOP", 31: "POP_EXCEPT",
+	32: "POP_TOP", 33: "PUSH_EXC_INFO", 34: "PUSH_NULL", 35: "RETURN_GENERATOR", 36: "RETURN_VALUE",
+	37: "SETUP_ANNOTATIONS", 38: "STORE_SLICE", 39: "STORE_SUBSCR", 40: "TO_BOOL", 41: "UNARY_INVERT",
+	42: "UNARY_NEGATIVE", 43: "UNARY_NOT", 44: "WITH_EXCEPT_START", 45: "BINARY_OP", 46: "BUILD_CONST_KEY_MAP",
+	47: "BUILD_LIST", 48: "BUILD_MAP", 49: "BUILD_SET", 50: "BUILD_SLICE", 51: "BUILD_STRING", 52: "BUILD_TUPLE",
+	53: "CALL", 54: "CALL_FUNCTION_EX", 55: "CALL_INTRINSIC_1", 56: "CALL_INTRINSIC_2", 57: "CALL_KW",
+	58: "COMPARE_OP", 59: "CONTAINS_OP", 60: "CONVERT_VALUE", 61: "COPY", 62: "COPY_FREE_VARS", 63: "DELETE_ATTR",
+	64: "DELETE_DEREF", 65: "DELETE_FAST", 66: "DELETE_GLOBAL", 67: "DELETE_NAME", 68: "DICT_MERGE",
+	69: "DICT_UPDATE", 70: "ENTER_EXECUTOR", 71: "EXTENDED_ARG", 72: "FOR_ITER", 73: "GET_AWAITABLE",
+	74: "IMPORT_FROM", 75: "IMPORT_NAME", 76: "IS_OP", 77: "JUMP_BACKWARD", 78: "JUMP_BACKWARD_NO_INTERRUPT",
+	79: "JUMP_FORWARD", 80: "LIST_APPEND", 81: "LIST_EXTEND", 82: "LOAD_ATTR", 83: "LOAD_CONST", 84: "LOAD_DEREF",
+	85: "LOAD_FAST", 86: "LOAD_FAST_AND_CLEAR", 87: "LOAD_FAST_CHECK", 88: "LOAD_FAST_LOAD_FAST",
+	89: "LOAD_FROM_DICT_OR_DEREF", 90: "LOAD_FROM_DICT_OR_GLOBALS", 91: "LOAD_GLOBAL", 92: "LOAD_NAME",
+	93: "LOAD_SUPER_ATTR", 94: "MAKE_CELL", 95: "MAP_ADD", 96: "MATCH_CLASS", 97: "POP_JUMP_IF_FALSE",
+	98: "POP_JUMP_IF_NONE", 99: "POP_JUMP_IF_NOT_NONE", 100: "POP_JUMP_IF_TRUE", 101: "RAISE_VARARGS",
+	102: "RERAISE", 103: "RETURN_CONST", 104: "SEND", 105: "SET_ADD", 106: "SET_FUNCTION_ATTRIBUTE",
+	107: "SET_UPDATE", 108: "STORE_ATTR", 109: "STORE_DEREF", 110: "STORE_FAST", 111: "STORE_FAST_LOAD_FAST",
+	112: "STORE_FAST_STORE_FAST", 113: "STORE_GLOBAL", 114: "STORE_NAME", 115: "SWAP", 116: "UNPACK_EX",
+	117: "UNPACK_SEQUENCE", 118: "YIELD_VALUE", 149: "RESUME",
+}
+
+var pyCompareOps = []string{"<", "<=", "==", "!=", ">", ">=", "in", "not in", "is", "is not", "exception match", "BAD"}
+
+var pyBinaryOps = []string{"+", "&", "//", "<<", "@", "*", "%", "|", "**", ">>", "-", "/", "^",
+	"+=", "&=", "//=", "<<=", "@=", "*=", "%=", "|=", "**=", ">>=", "-=", "/=", "^="}
+
+// 引数の意味（名前表・定数表など）をオペコード名で分類する
+var (
+	pyConstOps = map[string]bool{"LOAD_CONST": true, "RETURN_CONST": true, "KW_NAMES": true}
+	pyNameOps  = map[string]bool{
+		"STORE_NAME": true, "DELETE_NAME": true, "STORE_ATTR": true, "DELETE_ATTR": true, "STORE_GLOBAL": true,
+		"DELETE_GLOBAL": true, "LOAD_NAME": true, "LOAD_ATTR": true, "IMPORT_NAME": true, "IMPORT_FROM": true,
+		"LOAD_GLOBAL": true, "LOAD_METHOD": true, "LOAD_SUPER_ATTR": true, "LOAD_FROM_DICT_OR_GLOBALS": true,
+	}
+	pyLocalOps = map[string]bool{
+		"LOAD_FAST": true, "STORE_FAST": true, "DELETE_FAST": true, "LOAD_FAST_CHECK": true, "LOAD_FAST_AND_CLEAR": true,
+	}
+	pyFreeOps = map[string]bool{
+		"LOAD_CLOSURE": true, "LOAD_DEREF": true, "STORE_DEREF": true, "DELETE_DEREF": true,
+		"LOAD_CLASSDEREF": true, "MAKE_CELL": true, "LOAD_FROM_DICT_OR_DEREF": true,
+	}
+	pyRelJumpOps = map[string]bool{
+		"FOR_ITER": true, "JUMP_FORWARD": true, "SETUP_LOOP": true, "SETUP_EXCEPT": true, "SETUP_FINALLY": true,
+		"SETUP_WITH": true, "SETUP_ASYNC_WITH": true, "CALL_FINALLY": true, "SEND": true,
+		"POP_JUMP_FORWARD_IF_FALSE": true, "POP_JUMP_FORWARD_IF_TRUE": true, "POP_JUMP_FORWARD_IF_NONE": true,
+		"POP_JUMP_FORWARD_IF_NOT_NONE": true,
+	}
+	pyBackJumpOps = map[string]bool{
+		"JUMP_BACKWARD": true, "JUMP_BACKWARD_NO_INTERRUPT": true, "POP_JUMP_BACKWARD_IF_FALSE": true,
+		"POP_JUMP_BACKWARD_IF_TRUE": true, "POP_JUMP_BACKWARD_IF_NONE": true, "POP_JUMP_BACKWARD_IF_NOT_NONE": true,
+	}
+	pyAbsJumpOps = map[string]bool{
+		"JUMP_ABSOLUTE": true, "POP_JUMP_IF_FALSE": true, "POP_JUMP_IF_TRUE": true, "JUMP_IF_FALSE_OR_POP": true,
+		"JUMP_IF_TRUE_OR_POP": true, "CONTINUE_LOOP": true, "JUMP_IF_NOT_EXC_MATCH": true,
+	}
+)
+
+// pyOpcodeTable バージョンに応じたオペコード表を返す
+func pyOpcodeTable(major, minor int) map[int]string {
+	if major == 2 {
+		return pyOpcodes27
+	}
+	switch {
+	case minor >= 14:
+		return nil
+	case minor == 13:
+		return pyOpcodes313
+	case minor == 12:
+		return pyOpcodes312
+	case minor == 11:
+		return pyOpcodes311
+	}
+
+	table := make(map[int]string, len(pyOpcodes36))
+	for k, v := range pyOpcodes36 {
+		table[k] = v
+	}
+	if minor <= 5 {
+		for k, v := range map[int]string{
+			54: "STORE_MAP", 81: "WITH_CLEANUP", 82: "", 85: "", 127: "", 134: "MAKE_CLOSURE",
+			140: "CALL_FUNCTION_VAR", 142: "CALL_FUNCTION_VAR_KW", 155: "", 156: "", 157: "", 158: "",
+		} {
+			setPyOpcode(table, k, v)
+		}
+		if minor <= 4 {
+			for _, k := range []int{16, 17, 50, 51, 52, 73, 149, 150, 151, 152, 153, 154} {
+				delete(table, k)
+			}
+		}
+		if minor <= 2 {
+			setPyOpcode(table, 99, "DUP_TOPX")
+			setPyOpcode(table, 5, "ROT_FOUR")
+		}
+	}
+	if minor >= 7 {
+		setPyOpcode(table, 127, "")
+		setPyOpcode(table, 160, "LOAD_METHOD")
+		setPyOpcode(table, 161, "CALL_METHOD")
+	}
+	if minor >= 8 {
+		for k, v := range map[int]string{
+			6: "ROT_FOUR", 53: "BEGIN_FINALLY", 54: "END_ASYNC_FOR", 80: "", 119: "", 120: "", 121: "",
+			162: "CALL_FINALLY", 163: "POP_FINALLY",
+		} {
+			setPyOpcode(table, k, v)
+		}
+	}
+	if minor >= 9 {
+		for k, v := range map[int]string{
+			48: "RERAISE", 49: "WITH_EXCEPT_START", 53: "", 74: "LOAD_ASSERTION_ERROR", 81: "", 82: "LIST_TO_TUPLE",
+			88: "", 117: "IS_OP", 118: "CONTAINS_OP", 121: "JUMP_IF_NOT_EXC_MATCH", 149: "", 150: "", 151: "",
+			152: "", 153: "", 158: "", 162: "LIST_EXTEND", 163: "SET_UPDATE", 164: "DICT_MERGE", 165: "DICT_UPDATE",
+		} {
+			setPyOpcode(table, k, v)
+		}
+	}
+	if minor >= 10 {
+		for k, v := range map[int]string{
+			30: "GET_LEN", 31: "MATCH_MAPPING", 32: "MATCH_SEQUENCE", 33: "MATCH_KEYS",
+			34: "COPY_DICT_WITHOUT_KEYS", 48: "", 99: "ROT_N", 119: "RERAISE", 129: "GEN_START", 152: "MATCH_CLASS",
+		} {
+			setPyOpcode(table, k, v)
+		}
+	}
+	return table
+}
+
+func setPyOpcode(table map[int]string, op int, name string) {
+	if name == "" {
+		delete(table, op)
+		return
+	}
+	table[op] = name
+}
+
+// Disassemble code オブジェクトの命令列を逆アセンブルする
+func (c *PyCode) Disassemble(major, minor int) []PyInstruction {
+	table := pyOpcodeTable(major, minor)
+	wordcode := major == 3 && minor >= 6
+	haveArgument := 90
+	if major == 3 && minor >= 13 {
+		haveArgument = 44
+	}
+	lines := c.LineNumbers(major, minor)
+
+	var instrs []PyInstruction
+	extended := 0
+	for offset := 0; offset < len(c.Code); {
+		op := int(c.Code[offset])
+		start := offset
+		arg, hasArg := 0, false
+
+		if wordcode {
+			if offset+1 < len(c.Code) {
+				arg = int(c.Code[offset+1]) | extended
+			}
+			hasArg = op >= haveArgument
+			offset += 2
+		} else {
+			offset++
+			if op >= haveArgument && offset+1 < len(c.Code) {
+				arg = (int(c.Code[offset]) | int(c.Code[offset+1])<<8) | extended
+				hasArg = true
+				offset += 2
+			}
+		}
+
+		name, ok := table[op]
+		if !ok {
+			name = fmt.Sprintf("<%d>", op)
+		}
+		if name == "CACHE" {
+			continue
+		}
+		if name == "EXTENDED_ARG" {
+			// CPython と同じく引数は32ビットに収める（EXTENDED_ARG を並べて負の添字にさせない）
+			if wordcode {
+				extended = int(uint32(arg) << 8)
+			} else {
+				extended = int(uint32(arg) << 16)
+			}
+			continue
+		}
+		extended = 0
+
+		// 3.11+ の CACHE を飛ばした位置がジャンプの基準になる
+		next := offset
+		for wordcode && next+1 < len(c.Code) && c.Code[next] == 0 && table[0] == "CACHE" {
+			next += 2
+		}
+
+		instr := PyInstruction{Offset: start, Opname: name, Arg: arg, HasArg: hasArg, Line: lines[start]}
+		if hasArg {
+			instr.ArgRepr, instr.JumpTo = c.describeArg(name, arg, next, major, minor)
+		}
+		instrs = append(instrs, instr)
+	}
+
+	targets := make(map[int]bool)
+	for _, in := range instrs {
+		if in.JumpTo > 0 {
+			targets[in.JumpTo] = true
+		}
+	}
+	for i := range instrs {
+		instrs[i].IsTarget = targets[instrs[i].Offset]
+	}
+	return instrs
+}
+
+// describeArg 命令引数を人が読める形に変換する（ジャンプ命令は飛び先も返す）
+func (c *PyCode) describeArg(name string, arg, next, major, minor int) (string, int) {
+	jumpScale := 1
+	if major == 3 && minor >= 10 {
+		jumpScale = 2
+	}
+	v311 := major == 3 && minor >= 11
+	v312 := major == 3 && minor >= 12
+
+	switch {
+	case pyConstOps[name]:
+		if arg < len(c.Consts) {
+			return FormatPyObject(c.Consts[arg]), 0
+		}
+	case pyNameOps[name]:
+		idx := arg
+		switch {
+		case name == "LOAD_GLOBAL" && v311:
+			idx = arg >> 1
+		case name == "LOAD_ATTR" && v312:
+			idx = arg >> 1
+		case name == "LOAD_SUPER_ATTR":
+			idx = arg >> 2
+		}
+		if idx < len(c.Names) {
+			return c.Names[idx], 0
+		}
+	case pyLocalOps[name]:
+		if v311 && arg < len(c.LocalsPlusNames) {
+			return c.LocalsPlusNames[arg], 0
+		}
+		if arg < len(c.VarNames) {
+			return c.VarNames[arg], 0
+		}
+	case pyFreeOps[name]:
+		if v311 {
+			if arg < len(c.LocalsPlusNames) {
+				return c.LocalsPlusNames[arg], 0
+			}
+			break
+		}
+		cells := append(append([]string{}, c.CellVars...), c.FreeVars...)
+		if arg < len(cells) {
+			return cells[arg], 0
+		}
+	case name == "COMPARE_OP":
+		idx := arg
+		if major == 3 && minor >= 13 {
+			idx = arg >> 5
+		} else if v312 {
+			idx = arg >> 4
+		}
+		if idx < len(pyCompareOps) {
+			return pyCompareOps[idx], 0
+		}
+	case name == "BINARY_OP":
+		if arg < len(pyBinaryOps) {
+			return pyBinaryOps[arg], 0
+		}
+	case pyBackJumpOps[name]:
+		target := next - arg*2
+		return fmt.Sprintf("to %d", target), target
+	case pyRelJumpOps[name] || (v312 && strings.HasPrefix(name, "POP_JUMP_IF_")) ||
+		(v311 && (name == "JUMP_IF_FALSE_OR_POP" || name == "JUMP_IF_TRUE_OR_POP")):
+		target := next + arg*jumpScale
+		return fmt.Sprintf("to %d", target), target
+	case pyAbsJumpOps[name]:
+		target := arg * jumpScale
+		return fmt.Sprintf("to %d", target), target
+	}
+	return "", 0
+}
+
+// LineNumbers 命令オフセットから行番号への対応表を作る
+func (c *PyCode) LineNumbers(major, minor int) map[int]int {
+	lines := make(map[int]int)
+	table := c.LineTable
+	line := c.FirstLineNo
+
+	switch {
+	case major == 3 && minor >= 11:
+		// 位置情報テーブル（Objects/locations.md）
+		offset := 0
+		for i := 0; i < len(table); {
+			first := table[i]
+			i++
+			code := (first >> 3) & 0x0f
+			length := int(first&0x07) + 1
+			lineDelta := 0
+			hasLine := true
+			switch {
+			case code == 15:
+				hasLine = false
+			case code == 14:
+				lineDelta, i = readPySvarint(table, i)
+				_, i = readPyVarint(table, i)
+				_, i = readPyVarint(table, i)
+				_, i = readPyVarint(table, i)
+			case code == 13:
+				lineDelta, i = readPySvarint(table, i)
+			case code >= 10:
+				lineDelta = int(code) - 10
+				i += 2
+			default:
+				i++
+			}
+			line += lineDelta
+			for k := 0; k < length; k++ {
+				if hasLine {
+					lines[offset] = line
+				}
+				offset += 2
+			}
+		}
+	case major == 3 && minor == 10:
+		// (バイト数, 行の増分) の組。行の増分 -128 は「行番号なし」
+		offset := 0
+		for i := 0; i+1 < len(table); i += 2 {
+			sdelta := int(table[i])
+			ldelta := int(int8(table[i+1]))
+			if ldelta != -128 {
+				line += ldelta
+			}
+			for k := offset; k < offset+sdelta; k += 2 {
+				if ldelta != -128 {
+					lines[k] = line
+				}
+			}
+			offset += sdelta
+		}
+	default:
+		// lnotab: (バイト増分, 行増分) の組。3.6+ では行増分は符号付き
+		offset := 0
+		signed := major == 3 && minor >= 6
+		var addrs []int
+		var linesAt []int
+		addrs = append(addrs, 0)
+		linesAt = append(linesAt, line)
+		for i := 0; i+1 < len(table); i += 2 {
+			offset += int(table[i])
+			delta := int(table[i+1])
+			if signed {
+				delta = int(int8(table[i+1]))
+			}
+			line += delta
+			addrs = append(addrs, offset)
+			linesAt = append(linesAt, line)
+		}
+		k := 0
+		for off := 0; off < len(c.Code); off++ {
+			for k+1 < len(addrs) && addrs[k+1] <= off {
+				k++
+			}
+			lines[off] = linesAt[k]
+		}
+	}
+	return lines
+}
+
+func readPyVarint(b []byte, i int) (int, int) {
+	v, shift := 0, 0
+	for i < len(b) {
+		c := b[i]
+		i++
+		v |= int(c&0x3f) << shift
+		shift += 6
+		if c&0x40 == 0 {
+			break
+		}
+	}
+	return v, i
+}
+
+func readPySvarint(b []byte, i int) (int, int) {
+	v, i := readPyVarint(b, i)
+	if v&1 != 0 {
+		return -(v >> 1), i
+	}
+	return v >> 1, i
+}
+
+// FormatDisassembly dis モジュールに近い形式の逆アセンブル結果を出力する
+func FormatDisassembly(code *PyCode, major, minor int) string {
+	var sb strings.Builder
+	// 参照（'r'）で同じ code オブジェクトが何度も現れても一度だけ出力する
+	seen := make(map[*PyCode]bool)
+	var walk func(c *PyCode)
+	walk = func(c *PyCode) {
+		if seen[c] {
+			return
+		}
+		seen[c] = true
+		fmt.Fprintf(&sb, "Disassembly of <code object %s, file %q, line %d>:\n", c.QualName, c.Filename, c.FirstLineNo)
+		lastLine := -1
+		for _, in := range c.Disassemble(major, minor) {
+			lineCol := "     "
+			if in.Line != lastLine && in.Line > 0 {
+				lineCol = fmt.Sprintf("%5d", in.Line)
+				lastLine = in.Line
+			}
+			marker := "  "
+			if in.IsTarget {
+				marker = ">>"
+			}
+			fmt.Fprintf(&sb, "%s %s %6d %-28s", lineCol, marker, in.Offset, in.Opname)
+			if in.HasArg {
+				fmt.Fprintf(&sb, " %d", in.Arg)
+				if in.ArgRepr != "" {
+					fmt.Fprintf(&sb, " (%s)", in.ArgRepr)
+				}
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\n")
+		for _, cst := range c.Consts {
+			if child, ok := cst.(*PyCode); ok {
+				walk(child)
+			}
+		}
+	}
+	walk(code)
+	return sb.String()
+}
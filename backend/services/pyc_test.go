@@ -0,0 +1,239 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// テスト用に Python 3.8 の marshal 形式を組み立てる
+func marshalInt(v int32) []byte {
+	b := []byte{'i', 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(b[1:], uint32(v))
+	return b
+}
+
+func marshalRaw32(v int32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(v))
+	return b
+}
+
+func marshalStr(s string) []byte {
+	return append(append([]byte{'u'}, marshalRaw32(int32(len(s)))...), s...)
+}
+
+func marshalBytes(b []byte) []byte {
+	return append(append([]byte{'s'}, marshalRaw32(int32(len(b)))...), b...)
+}
+
+func marshalTuple(items ...[]byte) []byte {
+	out := append([]byte{'('}, marshalRaw32(int32(len(items)))...)
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func marshalStrTuple(names ...string) []byte {
+	items := make([][]byte, len(names))
+	for i, name := range names {
+		items[i] = marshalStr(name)
+	}
+	return marshalTuple(items...)
+}
+
+type testPyCode struct {
+	argCount, kwOnlyArgCount int32
+	flags                    int32
+	code                     []byte
+	consts                   [][]byte
+	names, varNames          []string
+	name                     string
+	firstLine                int32
+	lnotab                   []byte
+}
+
+func (c testPyCode) marshal() []byte {
+	var b bytes.Buffer
+	b.WriteByte('c')
+	for _, v := range []int32{c.argCount, 0, c.kwOnlyArgCount, int32(len(c.varNames)), 4, c.flags} {
+		b.Write(marshalRaw32(v))
+	}
+	b.Write(marshalBytes(c.code))
+	b.Write(marshalTuple(c.consts...))
+	b.Write(marshalStrTuple(c.names...))
+	b.Write(marshalStrTuple(c.varNames...))
+	b.Write(marshalStrTuple())
+	b.Write(marshalStrTuple())
+	b.Write(marshalStr("test.py"))
+	b.Write(marshalStr(c.name))
+	b.Write(marshalRaw32(c.firstLine))
+	b.Write(marshalBytes(c.lnotab))
+	return b.Bytes()
+}
+
+// pyc38 Python 3.8 の .pyc（ヘッダー16バイト、マジックナンバー 3413）
+func pyc38(code []byte) []byte {
+	header := []byte{0x55, 0x0d, '\r', '\n', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(header[8:], 1600000000)
+	binary.LittleEndian.PutUint32(header[12:], 42)
+	return append(header, code...)
+}
+
+// samplePyc38 次のソースに相当するモジュール
+//
+//	import os
+//	from .pkg import a
+//	def f(x, *args): pass
+func samplePyc38() []byte {
+	fn := testPyCode{
+		argCount: 1, flags: 0x04, code: []byte{100, 0, 83, 0},
+		consts: [][]byte{{'N'}}, varNames: []string{"x", "args"}, name: "f", firstLine: 3,
+	}
+	module := testPyCode{
+		code: []byte{
+			100, 0, 100, 1, 108, 0, 90, 0, // import os
+			100, 2, 100, 3, 108, 1, 109, 2, 90, 2, 1, 0, // from .pkg import a
+			100, 4, 100, 5, 132, 0, 90, 3, // def f
+			100, 1, 83, 0,
+		},
+		consts: [][]byte{
+			marshalInt(0), {'N'}, marshalInt(1), marshalTuple(marshalStr("a")), fn.marshal(), marshalStr("f"),
+		},
+		names:     []string{"os", "pkg", "a", "f"},
+		name:      "<module>",
+		firstLine: 1,
+		lnotab:    []byte{8, 1, 12, 1},
+	}
+	return pyc38(module.marshal())
+}
+
+func TestParsePyc(t *testing.T) {
+	data := samplePyc38()
+	if !IsPycFile(data) {
+		t.Fatal("IsPycFile() = false")
+	}
+	pyc, err := ParsePyc(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pyc.Header.Version != "3.8" || pyc.Header.HeaderSize != 16 || pyc.Header.HashBased || pyc.Header.SourceSize != 42 {
+		t.Errorf("header = %+v", pyc.Header)
+	}
+	if pyc.Header.SourceTime == nil || pyc.Header.SourceTime.Unix() != 1600000000 {
+		t.Errorf("source time = %v", pyc.Header.SourceTime)
+	}
+	if pyc.Code.Name != "<module>" || len(pyc.Code.Consts) != 6 {
+		t.Fatalf("code = %+v", pyc.Code)
+	}
+
+	s := RecoverPycStructure(pyc.Code, 3, 8)
+	wantImports := []PyImport{{Module: "os"}, {Module: "pkg", Names: []string{"a"}, Level: 1}}
+	if !reflect.DeepEqual(s.Imports, wantImports) {
+		t.Errorf("imports = %+v, want %+v", s.Imports, wantImports)
+	}
+	wantFunctions := []PyFunctionInfo{{QualName: "f", Args: []string{"x", "args"}, FirstLine: 3}}
+	if !reflect.DeepEqual(s.Functions, wantFunctions) {
+		t.Errorf("functions = %+v, want %+v", s.Functions, wantFunctions)
+	}
+	if want := []string{"a", "f", "os", "pkg"}; !reflect.DeepEqual(s.Names, want) {
+		t.Errorf("names = %v, want %v", s.Names, want)
+	}
+	if want := []string{"0", "1", "'f'"}; !reflect.DeepEqual(s.Constants, want) {
+		t.Errorf("constants = %v, want %v", s.Constants, want)
+	}
+
+	listing := FormatDisassembly(pyc.Code, 3, 8)
+	for _, want := range []string{
+		"    1         0 LOAD_CONST                   0 (0)",
+		"IMPORT_NAME                  1 (pkg)",
+		"    3        20 LOAD_CONST                   4 (<code object f, line 3>)",
+		"Disassembly of <code object f, file \"test.py\", line 3>:",
+	} {
+		if !strings.Contains(listing, want) {
+			t.Errorf("disassembly does not contain %q:\n%s", want, listing)
+		}
+	}
+}
+
+func TestParsePycInvalid(t *testing.T) {
+	valid := samplePyc38()
+	negativeArgs := testPyCode{argCount: -5, code: []byte{83, 0}, name: "f"}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not pyc", []byte("print('hello')\n")},
+		{"unknown magic", append([]byte{0xff, 0xff, '\r', '\n'}, make([]byte, 12)...)},
+		{"truncated header", valid[:10]},
+		{"not a code object", pyc38(marshalInt(1))},
+		{"negative argument count", pyc38(negativeArgs.marshal())},
+		{"negative size", pyc38(append([]byte{'u'}, marshalRaw32(-1)...))},
+		{"size beyond data", pyc38([]byte{'(', 0xff, 0xff, 0xff, 0x7f})},
+		{"bad reference", pyc38([]byte{'r', 5, 0, 0, 0})},
+		{"unknown type", pyc38([]byte{'?'})},
+		{"deep nesting", pyc38(bytes.Repeat([]byte{'(', 1, 0, 0, 0}, 1000))},
+		{"truncated code object", valid[:len(valid)/2]},
+		{"missing last byte", valid[:len(valid)-1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParsePyc(tt.data); err == nil {
+				t.Error("ParsePyc() error = nil")
+			}
+		})
+	}
+}
+
+func TestPyCodeArgNames(t *testing.T) {
+	tests := []struct {
+		name string
+		code PyCode
+		want []string
+	}{
+		{"positional", PyCode{ArgCount: 2, VarNames: []string{"a", "b", "tmp"}}, []string{"a", "b"}},
+		{"varargs and kwargs", PyCode{ArgCount: 1, KwOnlyArgCount: 1, Flags: 0x0c, VarNames: []string{"a", "k", "args", "kw", "tmp"}}, []string{"a", "k", "args", "kw"}},
+		{"more than varnames", PyCode{ArgCount: 5, VarNames: []string{"a"}}, []string{"a"}},
+		{"negative", PyCode{ArgCount: -3, VarNames: []string{"a"}}, []string{}},
+	}
+	for _, tt := range tests {
+		if got := tt.code.argNames(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: argNames() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPyCodeDisassembleExtendedArg(t *testing.T) {
+	// EXTENDED_ARG を並べても引数が負にならず、範囲外の定数を読まない
+	code := &PyCode{
+		Code:   append(bytes.Repeat([]byte{144, 0xff}, 12), 100, 0xff),
+		Consts: []PyObject{int64(1)},
+	}
+	instrs := code.Disassemble(3, 8)
+	if len(instrs) != 1 || instrs[0].Opname != "LOAD_CONST" || instrs[0].Arg < 0 || instrs[0].ArgRepr != "" {
+		t.Errorf("instructions = %+v", instrs)
+	}
+}
+
+func TestRecoverPycStructureSharedCode(t *testing.T) {
+	// 参照で共有された code オブジェクトは一度だけたどる
+	leaf := &PyCode{Name: "leaf", QualName: "leaf"}
+	code := &PyCode{Name: "<module>"}
+	for i := 0; i < 40; i++ {
+		code = &PyCode{Name: "n", QualName: "n", Consts: []PyObject{code, code}}
+	}
+	code.Consts = append(code.Consts, leaf, leaf)
+
+	s := RecoverPycStructure(code, 3, 8)
+	if len(s.Functions) != 41 {
+		t.Errorf("got %d functions, want 41", len(s.Functions))
+	}
+	if listing := FormatDisassembly(code, 3, 8); strings.Count(listing, "Disassembly of") != 42 {
+		t.Errorf("disassembly lists %d code objects, want 42", strings.Count(listing, "Disassembly of"))
+	}
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"reverse-engineering-backend/models"
+)
+
+// RuleSetStatus rule_scan で読み込んだルールセット
+type RuleSetStatus struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Rules int    `json:"rules"`
+	Error string `json:"error,omitempty"`
+}
+
+// RuleScanFileResult ファイルごとのマッチ結果
+type RuleScanFileResult struct {
+	FileID  uint            `json:"file_id"`
+	Name    string          `json:"name"`
+	Matches []YaraRuleMatch `json:"matches"`
+}
+
+// runRuleScan 有効なルールセットをプロジェクト内のすべてのファイル（派生ファイルを含む）に適用する
+func (w *AnalysisWorker) runRuleScan(files []models.File) (string, error) {
+	var ruleSets []models.RuleSet
+	if err := w.db.Where("enabled = ?", true).Order("id").Find(&ruleSets).Error; err != nil {
+		return "", fmt.Errorf("failed to fetch rule sets: %w", err)
+	}
+
+	type compiled struct {
+		name  string
+		rules []*YaraRule
+	}
+	var sets []compiled
+	statuses := []RuleSetStatus{}
+	for _, rs := range ruleSets {
+		status := RuleSetStatus{ID: rs.ID, Name: rs.Name}
+		rules, err := ParseYaraRules(rs.Source)
+		if err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Rules = len(rules)
+			sets = append(sets, compiled{name: rs.Name, rules: rules})
+		}
+		statuses = append(statuses, status)
+	}
+	if len(sets) == 0 {
+		return "", fmt.Errorf("no enabled rule sets")
+	}
+
+	results := []RuleScanFileResult{}
+	ruleCounts := make(map[string]int)
+	scanned := 0
+	for _, file := range files {
+		data := []byte(file.Content)
+		if file.Content == "" {
+			var err error
+			if data, err = os.ReadFile(file.Path); err != nil {
+				continue
+			}
+		}
+		scanned++
+
+		var matches []YaraRuleMatch
+		for _, set := range sets {
+			matches = append(matches, ScanYaraRules(set.name, set.rules, data)...)
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		for _, m := range matches {
+			ruleCounts[m.Namespace+":"+m.Rule]++
+		}
+		results = append(results, RuleScanFileResult{FileID: file.ID, Name: file.Name, Matches: matches})
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"rule_sets": statuses,
+		"files":     results,
+		"summary": map[string]interface{}{
+			"files_scanned": scanned,
+			"files_matched": len(results),
+			"rule_hits":     ruleCounts,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
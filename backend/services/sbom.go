@@ -0,0 +1,367 @@
+package services
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// SBOMComponent マニフェスト・ロックファイル・バイナリから見つけたコンポーネント
+// Ref は Package URL（バージョンが分からないものはバージョンなし）で、CycloneDX の bom-ref にも使う
+type SBOMComponent struct {
+	Ref         string            `json:"ref"`
+	Type        string            `json:"type"` // library, application（マニフェスト自身やバイナリのメインモジュール）
+	Ecosystem   string            `json:"ecosystem"`
+	Group       string            `json:"group,omitempty"` // Maven の groupId
+	Name        string            `json:"name"`
+	Version     string            `json:"version,omitempty"`
+	Requirement string            `json:"requirement,omitempty"` // バージョンが確定しないときの宣言された範囲（^1.2.0、>=2 など）
+	PURL        string            `json:"purl"`
+	Scope       string            `json:"scope"` // required, optional, excluded（開発・テスト専用）
+	Direct      bool              `json:"direct"`
+	License     string            `json:"license,omitempty"`
+	Download    string            `json:"download,omitempty"`
+	Hashes      []SBOMHash        `json:"hashes,omitempty"`
+	Properties  map[string]string `json:"properties,omitempty"`
+	DependsOn   []string          `json:"depends_on,omitempty"`
+	Sources     []SBOMSource      `json:"sources"`
+}
+
+// SBOMHash CycloneDX の表記のハッシュ（alg は SHA-256 など、content は16進）
+type SBOMHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+// SBOMSource コンポーネントを見つけたファイル
+type SBOMSource struct {
+	FileID uint   `json:"file_id"`
+	File   string `json:"file"`
+}
+
+// SBOMManifest 読み込んだマニフェストごとの結果
+type SBOMManifest struct {
+	FileID     uint   `json:"file_id"`
+	File       string `json:"file"`
+	Type       string `json:"type"` // go.mod, package-lock.json, go-binary など
+	Components int    `json:"components"`
+	Error      string `json:"error,omitempty"`
+}
+
+// SBOM プロジェクトのコンポーネント一覧（マニフェスト自身やバイナリのメインモジュールは application として含める）
+type SBOM struct {
+	Components []*SBOMComponent `json:"components"`
+	Manifests  []SBOMManifest   `json:"manifests"`
+}
+
+// scopeRank 同じコンポーネントを複数の場所で見つけたときは強い方のスコープを採る
+var scopeRank = map[string]int{"excluded": 0, "optional": 1, "required": 2}
+
+// sbomBuilder Ref ごとにコンポーネントをまとめる
+type sbomBuilder struct {
+	components map[string]*SBOMComponent
+	manifests  []SBOMManifest
+}
+
+func newSBOMBuilder() *sbomBuilder {
+	return &sbomBuilder{components: make(map[string]*SBOMComponent)}
+}
+
+// add コンポーネントを登録する。既にあれば出どころ・ハッシュ・依存先を合わせ、登録済みの方を返す
+func (b *sbomBuilder) add(c *SBOMComponent, file models.File) *SBOMComponent {
+	if c.PURL == "" {
+		c.PURL = PackageURL(c.Ecosystem, c.Group, c.Name, c.Version)
+	}
+	if c.Ref == "" {
+		c.Ref = c.PURL
+	}
+	if c.Type == "" {
+		c.Type = "library"
+	}
+	if c.Scope == "" {
+		c.Scope = "required"
+	}
+
+	existing, ok := b.components[c.Ref]
+	if !ok {
+		c.Sources = nil
+		c.addSource(file)
+		b.components[c.Ref] = c
+		return c
+	}
+	existing.addSource(file)
+	if scopeRank[c.Scope] > scopeRank[existing.Scope] {
+		existing.Scope = c.Scope
+	}
+	if c.Type == "application" {
+		existing.Type = "application"
+	}
+	existing.Direct = existing.Direct || c.Direct
+	if existing.License == "" {
+		existing.License = c.License
+	}
+	if existing.Download == "" {
+		existing.Download = c.Download
+	}
+	if existing.Requirement == "" {
+		existing.Requirement = c.Requirement
+	}
+	for _, h := range c.Hashes {
+		existing.addHash(h.Alg, h.Content)
+	}
+	for k, v := range c.Properties {
+		existing.setProperty(k, v)
+	}
+	for _, ref := range c.DependsOn {
+		existing.dependOn(ref)
+	}
+	return existing
+}
+
+// manifest マニフェストを読んだ結果を記録する
+func (b *sbomBuilder) manifest(file models.File, kind string, components int, err error) {
+	m := SBOMManifest{FileID: file.ID, File: file.Name, Type: kind, Components: components}
+	if err != nil {
+		m.Error = err.Error()
+	}
+	b.manifests = append(b.manifests, m)
+}
+
+// build アプリケーションを先に、あとは名前順に並べる
+func (b *sbomBuilder) build() *SBOM {
+	components := make([]*SBOMComponent, 0, len(b.components))
+	for _, c := range b.components {
+		sort.Strings(c.DependsOn)
+		sort.Slice(c.Hashes, func(i, j int) bool { return c.Hashes[i].Alg < c.Hashes[j].Alg })
+		components = append(components, c)
+	}
+	sort.Slice(components, func(i, j int) bool {
+		a, c := components[i], components[j]
+		if (a.Type == "application") != (c.Type == "application") {
+			return a.Type == "application"
+		}
+		if a.Ecosystem != c.Ecosystem {
+			return a.Ecosystem < c.Ecosystem
+		}
+		if a.Group+a.Name != c.Group+c.Name {
+			return a.Group+"/"+a.Name < c.Group+"/"+c.Name
+		}
+		return a.Version < c.Version
+	})
+	if b.manifests == nil {
+		b.manifests = []SBOMManifest{}
+	}
+	return &SBOM{Components: components, Manifests: b.manifests}
+}
+
+func (c *SBOMComponent) addHash(alg, content string) {
+	if content == "" {
+		return
+	}
+	for _, h := range c.Hashes {
+		if h.Alg == alg {
+			return
+		}
+	}
+	c.Hashes = append(c.Hashes, SBOMHash{Alg: alg, Content: content})
+}
+
+func (c *SBOMComponent) setProperty(name, value string) {
+	if value == "" {
+		return
+	}
+	if c.Properties == nil {
+		c.Properties = make(map[string]string)
+	}
+	c.Properties[name] = value
+}
+
+func (c *SBOMComponent) dependOn(ref string) {
+	if ref == "" || ref == c.Ref {
+		return
+	}
+	for _, r := range c.DependsOn {
+		if r == ref {
+			return
+		}
+	}
+	c.DependsOn = append(c.DependsOn, ref)
+}
+
+func (c *SBOMComponent) addSource(file models.File) {
+	source := SBOMSource{FileID: file.ID, File: file.Name}
+	for _, existing := range c.Sources {
+		if existing == source {
+			return
+		}
+	}
+	c.Sources = append(c.Sources, source)
+}
+
+// PackageURL Package URL（pkg:type/namespace/name@version）を組み立てる
+// ecosystem は golang, npm, pypi, maven, cargo のいずれかで、そのまま type になる。Go のモジュールパスと npm のスコープは名前の中の / で namespace に分ける
+func PackageURL(ecosystem, group, name, version string) string {
+	var segments []string
+	switch ecosystem {
+	case "maven":
+		segments = []string{group, name}
+	case "pypi":
+		segments = []string{normalizePythonName(name)}
+	default:
+		segments = strings.Split(name, "/")
+	}
+
+	var b strings.Builder
+	b.WriteString("pkg:")
+	b.WriteString(ecosystem)
+	for _, s := range segments {
+		if s == "" {
+			continue
+		}
+		b.WriteString("/")
+		b.WriteString(purlEscape(s))
+	}
+	if version != "" {
+		b.WriteString("@")
+		b.WriteString(purlEscape(version))
+	}
+	return b.String()
+}
+
+// purlEscape Package URL の各部分をパーセントエンコードする（英数字と .-_~ 以外）
+func purlEscape(s string) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || strings.IndexByte(".-_~", ch) >= 0 {
+			b.WriteByte(ch)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[ch>>4])
+		b.WriteByte(hexDigits[ch&15])
+	}
+	return b.String()
+}
+
+// normalizePythonName PEP 503 の正規化（小文字にし、-_. の連なりを - にする）
+func normalizePythonName(name string) string {
+	var b strings.Builder
+	sep := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if r == '-' || r == '_' || r == '.' {
+			sep = true
+			continue
+		}
+		if sep && b.Len() > 0 {
+			b.WriteByte('-')
+		}
+		sep = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// sbomFileKind ファイル名からマニフェストの種類を判定する（対象外は空文字）
+func sbomFileKind(name string) string {
+	base := strings.ToLower(path.Base(strings.ReplaceAll(name, "\\", "/")))
+	switch {
+	case base == "go.mod", base == "go.sum", base == "package.json", base == "package-lock.json",
+		base == "npm-shrinkwrap.json", base == "poetry.lock", base == "pom.xml", base == "cargo.lock":
+		return base
+	case strings.HasPrefix(base, "requirements") && strings.HasSuffix(base, ".txt"):
+		return "requirements.txt"
+	}
+	return ""
+}
+
+// lockTable ロックファイル（Cargo.lock・poetry.lock）の TOML のテーブル。値は解釈前の文字列のまま持つ
+type lockTable struct {
+	Name   string
+	Values map[string]string
+	Keys   []string
+}
+
+// parseLockTables ロックファイルに出てくる範囲の TOML（テーブル・テーブルの配列・複数行の配列）を読む
+func parseLockTables(content string) []*lockTable {
+	var tables []*lockTable
+	current := &lockTable{Values: make(map[string]string)}
+	tables = append(tables, current)
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			name := strings.TrimSpace(strings.Trim(line, "[]"))
+			current = &lockTable{Name: name, Values: make(map[string]string)}
+			tables = append(tables, current)
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		// 括弧が閉じるまで次の行をつなげる
+		for depth := tomlBracketDepth(value); depth > 0 && i+1 < len(lines); depth = tomlBracketDepth(value) {
+			i++
+			value += " " + strings.TrimSpace(lines[i])
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"'`)
+		current.Values[key] = value
+		current.Keys = append(current.Keys, key)
+	}
+	return tables
+}
+
+// tomlBracketDepth 文字列の外にある [ { と ] } の差
+func tomlBracketDepth(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && quote == '"' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '#':
+			return depth
+		case ch == '[' || ch == '{':
+			depth++
+		case ch == ']' || ch == '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+// tomlStringPattern 値の中の基本文字列
+var tomlStringPattern = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"|'([^']*)'`)
+
+// tomlString 値が文字列ならその中身を返す
+func (t *lockTable) tomlString(key string) string {
+	if m := tomlStringPattern.FindStringSubmatch(t.Values[key]); m != nil {
+		return m[1] + m[2]
+	}
+	return ""
+}
+
+// tomlStrings 値（配列）に含まれる文字列をすべて返す
+func (t *lockTable) tomlStrings(key string) []string {
+	var values []string
+	for _, m := range tomlStringPattern.FindAllStringSubmatch(t.Values[key], -1) {
+		values = append(values, m[1]+m[2])
+	}
+	return values
+}
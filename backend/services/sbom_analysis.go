@@ -0,0 +1,116 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"reverse-engineering-backend/models"
+)
+
+// CollectSBOM プロジェクト内のマニフェスト・ロックファイル・Go のバイナリからコンポーネントを集める
+// 同じディレクトリにロックファイルがあれば package.json の宣言より解決済みのバージョンを採り、go.sum は go.mod のハッシュに使う
+func CollectSBOM(files []models.File) *SBOM {
+	sorted := make([]models.File, len(files))
+	copy(sorted, files)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	byDir := make(map[string]map[string]*models.File)
+	for i := range sorted {
+		kind := sbomFileKind(sorted[i].Name)
+		if kind == "" || sorted[i].Content == "" {
+			continue
+		}
+		dir := path.Dir(strings.ReplaceAll(sorted[i].Name, "\\", "/"))
+		if byDir[dir] == nil {
+			byDir[dir] = make(map[string]*models.File)
+		}
+		byDir[dir][kind] = &sorted[i]
+	}
+
+	b := newSBOMBuilder()
+	for _, file := range sorted {
+		if file.Content == "" {
+			if count, ok := b.addGoBinary(file); ok {
+				b.manifest(file, "go-binary", count, nil)
+			}
+			continue
+		}
+		kind := sbomFileKind(file.Name)
+		siblings := byDir[path.Dir(strings.ReplaceAll(file.Name, "\\", "/"))]
+		var count int
+		var err error
+		switch kind {
+		case "go.mod":
+			count, err = b.addGoMod(file, siblings["go.sum"])
+		case "package.json":
+			if siblings["package-lock.json"] != nil || siblings["npm-shrinkwrap.json"] != nil {
+				continue
+			}
+			count, err = b.addPackageJSON(file)
+		case "package-lock.json", "npm-shrinkwrap.json":
+			count, err = b.addPackageLock(file)
+		case "requirements.txt":
+			count, err = b.addRequirements(file)
+		case "poetry.lock":
+			count, err = b.addPoetryLock(file)
+		case "pom.xml":
+			count, err = b.addPom(file)
+		case "cargo.lock":
+			count, err = b.addCargoLock(file)
+		default:
+			continue
+		}
+		b.manifest(file, kind, count, err)
+	}
+	return b.build()
+}
+
+// runSBOM SBOM を作り、CycloneDX 1.5 と SPDX 2.3 の文書を結果に含める
+func (w *AnalysisWorker) runSBOM(analysis *models.Analysis, files []models.File) (string, error) {
+	sbom := CollectSBOM(files)
+	if len(sbom.Manifests) == 0 {
+		return "", fmt.Errorf("no supported manifests, lockfiles or Go binaries found in project")
+	}
+
+	name := fmt.Sprintf("Project %d", analysis.ProjectID)
+	var project models.Project
+	if err := w.db.First(&project, analysis.ProjectID).Error; err == nil && project.Name != "" {
+		name = project.Name
+	}
+	seed := fmt.Sprintf("sbom:%d:%d", analysis.ProjectID, analysis.ID)
+	created := time.Now()
+
+	ecosystems := make(map[string]int)
+	scopes := make(map[string]int)
+	direct := 0
+	for _, c := range sbom.Components {
+		if c.Type != "library" {
+			continue
+		}
+		ecosystems[c.Ecosystem]++
+		scopes[c.Scope]++
+		if c.Direct {
+			direct++
+		}
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"components": sbom.Components,
+		"manifests":  sbom.Manifests,
+		"cyclonedx":  sbom.CycloneDX(name, seed, created),
+		"spdx":       sbom.SPDX(name, seed, created),
+		"summary": map[string]interface{}{
+			"components": len(sbom.Components),
+			"direct":     direct,
+			"ecosystems": ecosystems,
+			"scopes":     scopes,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// cratesIORegistries crates.io を指す source（git・ローカルのレジストリはダウンロード先を推測しない）
+var cratesIORegistries = map[string]bool{
+	"registry+https://github.com/rust-lang/crates.io-index": true,
+	"sparse+https://index.crates.io/":                       true,
+}
+
+// addCargoLock Cargo.lock の [[package]] を登録する
+// source の無いパッケージはワークスペースのメンバーなので application とし、その依存先を直接の依存にする
+func (b *sbomBuilder) addCargoLock(file models.File) (int, error) {
+	type lockedPackage struct {
+		component *SBOMComponent
+		deps      []string
+		member    bool
+	}
+	var packages []*lockedPackage
+	oldChecksums := make(map[string]string)
+	for _, t := range parseLockTables(file.Content) {
+		switch t.Name {
+		case "package":
+			name, version, source := t.tomlString("name"), t.tomlString("version"), t.tomlString("source")
+			if name == "" {
+				continue
+			}
+			p := &lockedPackage{
+				component: &SBOMComponent{Ecosystem: "cargo", Name: name, Version: version},
+				deps:      t.tomlStrings("dependencies"),
+				member:    source == "",
+			}
+			if p.member {
+				p.component.Type = "application"
+			} else {
+				p.component.setProperty("cargo:source", source)
+				if cratesIORegistries[source] {
+					p.component.Download = fmt.Sprintf("https://crates.io/api/v1/crates/%s/%s/download", name, version)
+				}
+			}
+			p.component.addHash("SHA-256", t.tomlString("checksum"))
+			packages = append(packages, p)
+		case "metadata":
+			// 古い形式は "checksum 名前 バージョン (source)" = "..." で持つ
+			for _, key := range t.Keys {
+				if fields := strings.Fields(key); len(fields) >= 3 && fields[0] == "checksum" {
+					oldChecksums[fields[1]+" "+fields[2]] = t.tomlString(key)
+				}
+			}
+		}
+	}
+	if len(packages) == 0 {
+		return 0, fmt.Errorf("no [[package]] entries found")
+	}
+
+	// 依存先は "名前" か、同名が複数あるときの "名前 バージョン (source)"
+	byName := make(map[string][]*SBOMComponent)
+	for _, p := range packages {
+		p.component.addHash("SHA-256", oldChecksums[p.component.Name+" "+p.component.Version])
+		p.component = b.add(p.component, file)
+		byName[p.component.Name] = append(byName[p.component.Name], p.component)
+	}
+	for _, p := range packages {
+		for _, dep := range p.deps {
+			fields := strings.Fields(dep)
+			if len(fields) == 0 {
+				continue
+			}
+			candidates := byName[fields[0]]
+			for _, c := range candidates {
+				if len(candidates) == 1 || len(fields) > 1 && c.Version == fields[1] {
+					p.component.dependOn(c.Ref)
+					if p.member && c.Type != "application" {
+						c.Direct = true
+					}
+					break
+				}
+			}
+		}
+	}
+	return len(packages), nil
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sbomToolName SBOM を作ったツールとして記録する名前
+const sbomToolName = "reverse-engineering-backend"
+
+// spdxChecksumAlgorithms CycloneDX のハッシュ名と SPDX の checksum の algorithm
+var spdxChecksumAlgorithms = map[string]string{"SHA-1": "SHA1", "SHA-256": "SHA256", "SHA-384": "SHA384", "SHA-512": "SHA512"}
+
+// sbomDocumentID 同じ解析からは同じ文書IDを作る（UUID の形にそろえた SHA-1）
+func sbomDocumentID(seed string) string {
+	sum := sha1.Sum([]byte(seed))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	h := hex.EncodeToString(sum[:16])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// CycloneDX CycloneDX 1.5 の JSON 文書を作る
+// プロジェクト自身を metadata.component とし、マニフェストごとの application をその依存先にする
+func (s *SBOM) CycloneDX(projectName, seed string, created time.Time) map[string]interface{} {
+	projectRef := "project:" + sbomDocumentID(seed)
+	components := []map[string]interface{}{}
+	dependencies := []map[string]interface{}{}
+	var applications []string
+	for _, c := range s.Components {
+		component := map[string]interface{}{
+			"type":    c.Type,
+			"bom-ref": c.Ref,
+			"name":    c.Name,
+			"purl":    c.PURL,
+			"scope":   c.Scope,
+		}
+		if c.Group != "" {
+			component["group"] = c.Group
+		}
+		if c.Version != "" {
+			component["version"] = c.Version
+		}
+		if c.License != "" {
+			component["licenses"] = cycloneDXLicenses(c.License)
+		}
+		if len(c.Hashes) > 0 {
+			hashes := make([]map[string]string, 0, len(c.Hashes))
+			for _, h := range c.Hashes {
+				hashes = append(hashes, map[string]string{"alg": h.Alg, "content": h.Content})
+			}
+			component["hashes"] = hashes
+		}
+		if c.Download != "" && (strings.HasPrefix(c.Download, "http://") || strings.HasPrefix(c.Download, "https://")) {
+			component["externalReferences"] = []map[string]string{{"type": "distribution", "url": c.Download}}
+		}
+		var properties []map[string]string
+		for _, key := range sortedKeys(c.Properties) {
+			properties = append(properties, map[string]string{"name": key, "value": c.Properties[key]})
+		}
+		if c.Requirement != "" {
+			properties = append(properties, map[string]string{"name": "requirement", "value": c.Requirement})
+		}
+		properties = append(properties, map[string]string{"name": "direct", "value": fmt.Sprint(c.Direct)})
+		for _, src := range c.Sources {
+			properties = append(properties, map[string]string{"name": "source", "value": src.File})
+		}
+		component["properties"] = properties
+		components = append(components, component)
+
+		dependsOn := c.DependsOn
+		if dependsOn == nil {
+			dependsOn = []string{}
+		}
+		dependencies = append(dependencies, map[string]interface{}{"ref": c.Ref, "dependsOn": dependsOn})
+		if c.Type == "application" {
+			applications = append(applications, c.Ref)
+		}
+	}
+	if applications == nil {
+		applications = []string{}
+	}
+	dependencies = append([]map[string]interface{}{{"ref": projectRef, "dependsOn": applications}}, dependencies...)
+
+	return map[string]interface{}{
+		"bomFormat":    "CycloneDX",
+		"specVersion":  "1.5",
+		"serialNumber": "urn:uuid:" + sbomDocumentID(seed),
+		"version":      1,
+		"metadata": map[string]interface{}{
+			"timestamp": created.UTC().Format(time.RFC3339),
+			"tools": map[string]interface{}{
+				"components": []map[string]string{{"type": "application", "name": sbomToolName}},
+			},
+			"component": map[string]string{"type": "application", "bom-ref": projectRef, "name": projectName},
+		},
+		"components":   components,
+		"dependencies": dependencies,
+	}
+}
+
+// cycloneDXLicenses SPDX の式らしければ expression、そうでなければ名前として入れる
+func cycloneDXLicenses(license string) []map[string]interface{} {
+	if strings.ContainsAny(license, " ()") && !strings.Contains(license, ",") {
+		return []map[string]interface{}{{"expression": license}}
+	}
+	var licenses []map[string]interface{}
+	for _, name := range strings.Split(license, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			licenses = append(licenses, map[string]interface{}{"license": map[string]string{"name": name}})
+		}
+	}
+	return licenses
+}
+
+// SPDX SPDX 2.3 の JSON 文書を作る
+// マニフェストごとの application を DESCRIBES でつなぎ、開発用の依存先は DEV_DEPENDENCY_OF で表す
+func (s *SBOM) SPDX(projectName, seed string, created time.Time) map[string]interface{} {
+	ids := make(map[string]string, len(s.Components))
+	byRef := make(map[string]*SBOMComponent, len(s.Components))
+	for i, c := range s.Components {
+		ids[c.Ref] = fmt.Sprintf("SPDXRef-Package-%d", i+1)
+		byRef[c.Ref] = c
+	}
+
+	packages := []map[string]interface{}{}
+	relationships := []map[string]string{}
+	for _, c := range s.Components {
+		pkg := map[string]interface{}{
+			"SPDXID":           ids[c.Ref],
+			"name":             c.Name,
+			"downloadLocation": "NOASSERTION",
+			"filesAnalyzed":    false,
+			"licenseConcluded": "NOASSERTION",
+			"licenseDeclared":  "NOASSERTION",
+			"copyrightText":    "NOASSERTION",
+			"externalRefs": []map[string]string{{
+				"referenceCategory": "PACKAGE-MANAGER",
+				"referenceType":     "purl",
+				"referenceLocator":  c.PURL,
+			}},
+			"primaryPackagePurpose": strings.ToUpper(c.Type),
+		}
+		if c.Group != "" {
+			pkg["name"] = c.Group + ":" + c.Name
+		}
+		if c.Version != "" {
+			pkg["versionInfo"] = c.Version
+		}
+		if c.Download != "" && (strings.HasPrefix(c.Download, "http://") || strings.HasPrefix(c.Download, "https://")) {
+			pkg["downloadLocation"] = c.Download
+		}
+		if c.License != "" {
+			pkg["licenseComments"] = "Declared by the package manager: " + c.License
+		}
+		var checksums []map[string]string
+		for _, h := range c.Hashes {
+			if alg, ok := spdxChecksumAlgorithms[h.Alg]; ok {
+				checksums = append(checksums, map[string]string{"algorithm": alg, "checksumValue": h.Content})
+			}
+		}
+		if checksums != nil {
+			pkg["checksums"] = checksums
+		}
+		packages = append(packages, pkg)
+
+		if c.Type == "application" {
+			relationships = append(relationships, map[string]string{
+				"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": ids[c.Ref],
+			})
+		}
+	}
+	for _, c := range s.Components {
+		for _, ref := range c.DependsOn {
+			dep, ok := ids[ref]
+			if !ok {
+				continue
+			}
+			rel := map[string]string{"spdxElementId": ids[c.Ref], "relationshipType": "DEPENDS_ON", "relatedSpdxElement": dep}
+			if byRef[ref].Scope == "excluded" {
+				rel = map[string]string{"spdxElementId": dep, "relationshipType": "DEV_DEPENDENCY_OF", "relatedSpdxElement": ids[c.Ref]}
+			}
+			relationships = append(relationships, rel)
+		}
+	}
+
+	name := projectName + " SBOM"
+	return map[string]interface{}{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              name,
+		"documentNamespace": "https://spdx.org/spdxdocs/" + purlEscape(projectName) + "-" + sbomDocumentID(seed),
+		"creationInfo": map[string]interface{}{
+			"created":  created.UTC().Format(time.RFC3339),
+			"creators": []string{"Tool: " + sbomToolName},
+		},
+		"packages":      packages,
+		"relationships": relationships,
+	}
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"debug/buildinfo"
+	"fmt"
+	"os"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// goModRequire go.mod の require 行
+type goModRequire struct {
+	Path     string
+	Version  string
+	Indirect bool
+}
+
+// goModReplace go.mod の replace 行（Version が空なら全バージョンが対象。NewVersion が空ならローカルのディレクトリ）
+type goModReplace struct {
+	Version    string
+	NewPath    string
+	NewVersion string
+}
+
+// goModFile go.mod から SBOM に必要な部分だけを読んだもの
+type goModFile struct {
+	Module    string
+	GoVersion string
+	Requires  []goModRequire
+	Replaces  map[string]goModReplace
+}
+
+// parseGoMod go.mod の module・go・require・replace を読む（ブロック形式と1行形式の両方）
+func parseGoMod(content string) (*goModFile, error) {
+	mod := &goModFile{Replaces: make(map[string]goModReplace)}
+	block := ""
+	for i, line := range strings.Split(content, "\n") {
+		comment := ""
+		if idx := strings.Index(line, "//"); idx >= 0 {
+			comment = line[idx+2:]
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			fields = append([]string{block}, fields...)
+		} else if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+
+		switch fields[0] {
+		case "module":
+			if len(fields) >= 2 {
+				mod.Module = strings.Trim(fields[1], `"`)
+			}
+		case "go":
+			if len(fields) >= 2 {
+				mod.GoVersion = fields[1]
+			}
+		case "require":
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("line %d: malformed require", i+1)
+			}
+			mod.Requires = append(mod.Requires, goModRequire{
+				Path:     strings.Trim(fields[1], `"`),
+				Version:  fields[2],
+				Indirect: strings.TrimSpace(comment) == "indirect" || strings.HasPrefix(strings.TrimSpace(comment), "indirect;"),
+			})
+		case "replace":
+			arrow := -1
+			for j, f := range fields {
+				if f == "=>" {
+					arrow = j
+				}
+			}
+			if arrow < 2 || arrow+1 >= len(fields) {
+				return nil, fmt.Errorf("line %d: malformed replace", i+1)
+			}
+			rep := goModReplace{NewPath: fields[arrow+1]}
+			if arrow == 3 {
+				rep.Version = fields[2]
+			}
+			if arrow+2 < len(fields) {
+				rep.NewVersion = fields[arrow+2]
+			}
+			mod.Replaces[strings.Trim(fields[1], `"`)] = rep
+		}
+	}
+	if mod.Module == "" {
+		return nil, fmt.Errorf("module directive not found")
+	}
+	return mod, nil
+}
+
+// parseGoSum go.sum からモジュールのハッシュ（h1:）を path@version ごとに読む（/go.mod の行は除く）
+func parseGoSum(content string) map[string]string {
+	sums := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || strings.HasSuffix(fields[1], "/go.mod") {
+			continue
+		}
+		sums[fields[0]+"@"+fields[1]] = fields[2]
+	}
+	return sums
+}
+
+// addGoMod go.mod のモジュールを application、require を依存先として登録する（sum は同じディレクトリの go.sum）
+func (b *sbomBuilder) addGoMod(file models.File, sum *models.File) (int, error) {
+	mod, err := parseGoMod(file.Content)
+	if err != nil {
+		return 0, err
+	}
+	sums := map[string]string{}
+	if sum != nil {
+		sums = parseGoSum(sum.Content)
+	}
+
+	root := &SBOMComponent{Type: "application", Ecosystem: "golang", Name: mod.Module}
+	root.setProperty("go:version", mod.GoVersion)
+	for _, req := range mod.Requires {
+		c := &SBOMComponent{Ecosystem: "golang", Name: req.Path, Version: req.Version, Direct: !req.Indirect}
+		if rep, ok := mod.Replaces[req.Path]; ok && (rep.Version == "" || rep.Version == req.Version) {
+			if rep.NewVersion == "" {
+				// ローカルのディレクトリへの置き換えはバージョンが決まらない
+				c.Version = ""
+				c.setProperty("go:replace", rep.NewPath)
+			} else {
+				c.Name, c.Version = rep.NewPath, rep.NewVersion
+				c.setProperty("go:replaces", req.Path+"@"+req.Version)
+			}
+		}
+		h1 := sums[c.Name+"@"+c.Version]
+		c.setProperty("go:h1", h1)
+		c = b.add(c, file)
+		if h1 != "" {
+			c.addSource(*sum)
+		}
+		root.dependOn(c.Ref)
+	}
+	b.add(root, file)
+	return len(mod.Requires), nil
+}
+
+// addGoBinary Go でビルドされた実行ファイルに埋め込まれたビルド情報からモジュールを登録する
+// Go のバイナリでなければ ok = false を返す
+func (b *sbomBuilder) addGoBinary(file models.File) (count int, ok bool) {
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	header := make([]byte, 8)
+	if n, _ := f.ReadAt(header, 0); !IsExecutableBinary(header[:n]) {
+		return 0, false
+	}
+	info, err := buildinfo.Read(f)
+	if err != nil {
+		return 0, false
+	}
+
+	name := info.Main.Path
+	if name == "" {
+		name = info.Path
+	}
+	if name == "" {
+		name = file.Name
+	}
+	version := info.Main.Version
+	if version == "(devel)" {
+		version = ""
+	}
+	root := &SBOMComponent{Type: "application", Ecosystem: "golang", Name: name, Version: version}
+	root.setProperty("go:version", info.GoVersion)
+	root.setProperty("go:package", info.Path)
+	for _, dep := range info.Deps {
+		mod := dep
+		if dep.Replace != nil {
+			mod = dep.Replace
+		}
+		c := &SBOMComponent{Ecosystem: "golang", Name: mod.Path, Version: mod.Version}
+		if mod.Version == "" || mod.Version == "(devel)" {
+			c.Version = ""
+		}
+		c.setProperty("go:h1", mod.Sum)
+		if dep.Replace != nil {
+			c.setProperty("go:replaces", dep.Path+"@"+dep.Version)
+		}
+		c = b.add(c, file)
+		root.dependOn(c.Ref)
+	}
+	b.add(root, file)
+	return len(info.Deps), true
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// pomDependency pom.xml の <dependency>
+type pomDependency struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+	Version    string `xml:"version"`
+	Scope      string `xml:"scope"`
+	Optional   string `xml:"optional"`
+}
+
+// pomProject pom.xml のうち SBOM に使う部分
+type pomProject struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+	Version    string `xml:"version"`
+	Parent     struct {
+		GroupID    string `xml:"groupId"`
+		ArtifactID string `xml:"artifactId"`
+		Version    string `xml:"version"`
+	} `xml:"parent"`
+	Properties struct {
+		Entries []struct {
+			XMLName xml.Name
+			Value   string `xml:",chardata"`
+		} `xml:",any"`
+	} `xml:"properties"`
+	Licenses            []string        `xml:"licenses>license>name"`
+	ManagedDependencies []pomDependency `xml:"dependencyManagement>dependencies>dependency"`
+	Dependencies        []pomDependency `xml:"dependencies>dependency"`
+	ProfileDependencies []pomDependency `xml:"profiles>profile>dependencies>dependency"`
+}
+
+// pomPropertyRef ${name} の参照
+var pomPropertyRef = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// addPom pom.xml のプロジェクトを application、<dependencies>（プロファイル内を含む）を依存先として登録する
+// バージョンはプロパティと <dependencyManagement> から補い、範囲指定や解決できない参照は requirement に残す
+func (b *sbomBuilder) addPom(file models.File) (int, error) {
+	var pom pomProject
+	if err := xml.Unmarshal([]byte(file.Content), &pom); err != nil {
+		return 0, fmt.Errorf("invalid pom.xml: %w", err)
+	}
+	if pom.GroupID == "" {
+		pom.GroupID = pom.Parent.GroupID
+	}
+	if pom.Version == "" {
+		pom.Version = pom.Parent.Version
+	}
+
+	props := map[string]string{
+		"project.groupId": pom.GroupID, "project.artifactId": pom.ArtifactID, "project.version": pom.Version,
+		"pom.groupId": pom.GroupID, "pom.version": pom.Version, "version": pom.Version,
+		"project.parent.groupId": pom.Parent.GroupID, "project.parent.version": pom.Parent.Version,
+	}
+	for _, p := range pom.Properties.Entries {
+		props[p.XMLName.Local] = strings.TrimSpace(p.Value)
+	}
+	expand := func(s string) string {
+		s = strings.TrimSpace(s)
+		for i := 0; i < 5 && strings.Contains(s, "${"); i++ {
+			s = pomPropertyRef.ReplaceAllStringFunc(s, func(ref string) string {
+				if v, ok := props[ref[2:len(ref)-1]]; ok {
+					return v
+				}
+				return ref
+			})
+		}
+		return s
+	}
+
+	managed := make(map[string]string)
+	for _, d := range pom.ManagedDependencies {
+		managed[expand(d.GroupID)+":"+expand(d.ArtifactID)] = expand(d.Version)
+	}
+
+	root := &SBOMComponent{
+		Type: "application", Ecosystem: "maven",
+		Group: expand(pom.GroupID), Name: expand(pom.ArtifactID), Version: expand(pom.Version),
+		License: strings.Join(pom.Licenses, ", "),
+	}
+	if strings.Contains(root.Version, "${") {
+		root.Version = ""
+	}
+	count := 0
+	for _, d := range append(pom.Dependencies, pom.ProfileDependencies...) {
+		group, artifact := expand(d.GroupID), expand(d.ArtifactID)
+		if group == "" || artifact == "" {
+			continue
+		}
+		c := &SBOMComponent{Ecosystem: "maven", Group: group, Name: artifact, Direct: true}
+		version := expand(d.Version)
+		if version == "" {
+			version = managed[group+":"+artifact]
+		}
+		if version == "" || strings.Contains(version, "${") || strings.ContainsAny(version, "[(,") {
+			c.Requirement = version
+		} else {
+			c.Version = version
+		}
+		switch strings.TrimSpace(d.Scope) {
+		case "test":
+			c.Scope = "excluded"
+		case "provided", "system":
+			c.Scope = "optional"
+		}
+		if strings.TrimSpace(d.Optional) == "true" && c.Scope == "" {
+			c.Scope = "optional"
+		}
+		c.setProperty("maven:scope", strings.TrimSpace(d.Scope))
+		c = b.add(c, file)
+		root.dependOn(c.Ref)
+		count++
+	}
+	b.add(root, file)
+	return count, nil
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// npmPackageJSON package.json のうち SBOM に使う部分
+type npmPackageJSON struct {
+	Name                 string            `json:"name"`
+	Version              string            `json:"version"`
+	License              json.RawMessage   `json:"license"`
+	Dependencies         map[string]string `json:"dependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+}
+
+// npmLockPackage package-lock.json（lockfileVersion 2・3）の packages の要素
+type npmLockPackage struct {
+	Name                 string            `json:"name"`
+	Version              string            `json:"version"`
+	Resolved             string            `json:"resolved"`
+	Integrity            string            `json:"integrity"`
+	License              json.RawMessage   `json:"license"`
+	Dev                  bool              `json:"dev"`
+	Optional             bool              `json:"optional"`
+	DevOptional          bool              `json:"devOptional"`
+	Link                 bool              `json:"link"`
+	Dependencies         map[string]string `json:"dependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+}
+
+// npmLockV1Dependency package-lock.json（lockfileVersion 1）の dependencies の要素
+type npmLockV1Dependency struct {
+	Version      string                         `json:"version"`
+	Resolved     string                         `json:"resolved"`
+	Integrity    string                         `json:"integrity"`
+	Dev          bool                           `json:"dev"`
+	Optional     bool                           `json:"optional"`
+	Requires     map[string]string              `json:"requires"`
+	Dependencies map[string]npmLockV1Dependency `json:"dependencies"`
+}
+
+type npmLockFile struct {
+	Name            string                         `json:"name"`
+	Version         string                         `json:"version"`
+	LockfileVersion int                            `json:"lockfileVersion"`
+	Packages        map[string]npmLockPackage      `json:"packages"`
+	Dependencies    map[string]npmLockV1Dependency `json:"dependencies"`
+}
+
+// npmExactVersion 範囲ではなく1つのバージョンを指す指定
+var npmExactVersion = regexp.MustCompile(`^=?v?(\d+\.\d+\.\d+(?:-[0-9A-Za-z.-]+)?(?:\+[0-9A-Za-z.-]+)?)$`)
+
+// integrityAlgorithms Subresource Integrity のアルゴリズム名と CycloneDX の表記
+var integrityAlgorithms = map[string]string{"sha1": "SHA-1", "sha256": "SHA-256", "sha384": "SHA-384", "sha512": "SHA-512"}
+
+// addPackageJSON ロックファイルが無いときに package.json の宣言だけから依存先を登録する
+func (b *sbomBuilder) addPackageJSON(file models.File) (int, error) {
+	var pkg npmPackageJSON
+	if err := json.Unmarshal([]byte(file.Content), &pkg); err != nil {
+		return 0, fmt.Errorf("invalid package.json: %w", err)
+	}
+
+	root := &SBOMComponent{Type: "application", Ecosystem: "npm", Name: pkg.Name, Version: pkg.Version, License: npmLicense(pkg.License)}
+	if root.Name == "" {
+		root.Name = file.Name
+	}
+	count := 0
+	for _, group := range []struct {
+		deps  map[string]string
+		scope string
+	}{{pkg.Dependencies, "required"}, {pkg.OptionalDependencies, "optional"}, {pkg.DevDependencies, "excluded"}} {
+		for _, name := range sortedKeys(group.deps) {
+			c := &SBOMComponent{Ecosystem: "npm", Name: name, Scope: group.scope, Direct: true}
+			if m := npmExactVersion.FindStringSubmatch(group.deps[name]); m != nil {
+				c.Version = m[1]
+			} else {
+				c.Requirement = group.deps[name]
+			}
+			c = b.add(c, file)
+			root.dependOn(c.Ref)
+			count++
+		}
+	}
+	b.add(root, file)
+	return count, nil
+}
+
+// addPackageLock package-lock.json（npm-shrinkwrap.json）の解決済みのバージョンを登録する
+func (b *sbomBuilder) addPackageLock(file models.File) (int, error) {
+	var lock npmLockFile
+	if err := json.Unmarshal([]byte(file.Content), &lock); err != nil {
+		return 0, fmt.Errorf("invalid package-lock.json: %w", err)
+	}
+	if lock.Packages != nil {
+		return b.addPackageLockV2(file, lock), nil
+	}
+	return b.addPackageLockV1(file, lock), nil
+}
+
+// addPackageLockV2 packages のキー（node_modules/a/node_modules/b）から Node.js と同じ規則で依存先を解決する
+func (b *sbomBuilder) addPackageLockV2(file models.File, lock npmLockFile) int {
+	rootPkg := lock.Packages[""]
+	root := &SBOMComponent{Type: "application", Ecosystem: "npm", Name: rootPkg.Name, Version: rootPkg.Version, License: npmLicense(rootPkg.License)}
+	if root.Name == "" {
+		root.Name = lock.Name
+	}
+	if root.Name == "" {
+		root.Name = file.Name
+	}
+
+	refs := make(map[string]string)
+	keys := sortedKeys(lock.Packages)
+	for _, key := range keys {
+		pkg := lock.Packages[key]
+		idx := strings.LastIndex(key, "node_modules/")
+		if idx < 0 || pkg.Link {
+			continue // ワークスペース内のパッケージとシンボリックリンク
+		}
+		name := pkg.Name
+		if name == "" {
+			name = key[idx+len("node_modules/"):]
+		}
+		c := &SBOMComponent{Ecosystem: "npm", Name: name, Version: pkg.Version, License: npmLicense(pkg.License), Download: pkg.Resolved}
+		switch {
+		case pkg.Dev || pkg.DevOptional:
+			c.Scope = "excluded"
+		case pkg.Optional:
+			c.Scope = "optional"
+		}
+		c.Direct = idx == 0 && npmDeclares(rootPkg, name)
+		addIntegrity(c, pkg.Integrity)
+		refs[key] = b.add(c, file).Ref
+	}
+
+	// 依存先はネストした node_modules から親へ向かって探す
+	resolve := func(from, name string) string {
+		dir := from
+		for {
+			prefix := dir
+			if prefix != "" {
+				prefix += "/"
+			}
+			if ref, ok := refs[prefix+"node_modules/"+name]; ok {
+				return ref
+			}
+			if dir == "" {
+				return ""
+			}
+			if idx := strings.LastIndex(dir, "/node_modules/"); idx >= 0 {
+				dir = dir[:idx]
+			} else {
+				dir = ""
+			}
+		}
+	}
+	for _, key := range keys {
+		pkg := lock.Packages[key]
+		var target *SBOMComponent
+		if key == "" {
+			target = root
+		} else if ref, ok := refs[key]; ok {
+			target = b.components[ref]
+		} else {
+			continue
+		}
+		for _, deps := range []map[string]string{pkg.Dependencies, pkg.OptionalDependencies, pkg.DevDependencies} {
+			for name := range deps {
+				target.dependOn(resolve(key, name))
+			}
+		}
+	}
+	b.add(root, file)
+	return len(refs)
+}
+
+// addPackageLockV1 入れ子の dependencies をたどる（requires は内側のスコープから順に探す）
+func (b *sbomBuilder) addPackageLockV1(file models.File, lock npmLockFile) int {
+	root := &SBOMComponent{Type: "application", Ecosystem: "npm", Name: lock.Name, Version: lock.Version}
+	if root.Name == "" {
+		root.Name = file.Name
+	}
+
+	count := 0
+	var walk func(deps map[string]npmLockV1Dependency, scopes []map[string]string)
+	walk = func(deps map[string]npmLockV1Dependency, scopes []map[string]string) {
+		level := make(map[string]string, len(deps))
+		scopes = append(scopes[:len(scopes):len(scopes)], level)
+		names := sortedKeys(deps)
+		for _, name := range names {
+			dep := deps[name]
+			c := &SBOMComponent{Ecosystem: "npm", Name: name, Version: dep.Version, Download: dep.Resolved, Direct: len(scopes) == 1}
+			switch {
+			case dep.Dev:
+				c.Scope = "excluded"
+			case dep.Optional:
+				c.Scope = "optional"
+			}
+			addIntegrity(c, dep.Integrity)
+			level[name] = b.add(c, file).Ref
+			if c.Direct {
+				root.dependOn(level[name])
+			}
+			count++
+		}
+		for _, name := range names {
+			dep := deps[name]
+			c := b.components[level[name]]
+			// requires は自分の下の dependencies から外側へ向かって探す
+			for req := range dep.Requires {
+				if nested, ok := dep.Dependencies[req]; ok {
+					c.dependOn(PackageURL("npm", "", req, nested.Version))
+					continue
+				}
+				for i := len(scopes) - 1; i >= 0; i-- {
+					if ref, ok := scopes[i][req]; ok {
+						c.dependOn(ref)
+						break
+					}
+				}
+			}
+			walk(dep.Dependencies, scopes)
+		}
+	}
+	walk(lock.Dependencies, nil)
+	b.add(root, file)
+	return count
+}
+
+// npmDeclares ルートの package.json に宣言された依存先か
+func npmDeclares(root npmLockPackage, name string) bool {
+	_, a := root.Dependencies[name]
+	_, b := root.DevDependencies[name]
+	_, c := root.OptionalDependencies[name]
+	return a || b || c
+}
+
+// npmLicense license は文字列か {type: ...}（古い形式）のどちらか
+func npmLicense(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var obj struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(raw, &obj) == nil {
+		return obj.Type
+	}
+	return ""
+}
+
+// addIntegrity Subresource Integrity（sha512-<base64>、空白区切りで複数可）を16進のハッシュにする
+func addIntegrity(c *SBOMComponent, integrity string) {
+	for _, item := range strings.Fields(integrity) {
+		alg, value, ok := strings.Cut(item, "-")
+		if !ok || integrityAlgorithms[alg] == "" {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		c.addHash(integrityAlgorithms[alg], hex.EncodeToString(raw))
+	}
+}
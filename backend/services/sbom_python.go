@@ -0,0 +1,147 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// requirementLine requirements.txt の1行（名前・extras・残り）
+var requirementLine = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)\s*(\[[^\]]*\])?\s*(.*)$`)
+
+// requirementHash --hash=sha256:... の指定
+var requirementHash = regexp.MustCompile(`--hash[= ](sha256|sha384|sha512):([0-9a-fA-F]+)`)
+
+// pythonHashAlgorithms pip・poetry のハッシュ名と CycloneDX の表記
+var pythonHashAlgorithms = map[string]string{"sha256": "SHA-256", "sha384": "SHA-384", "sha512": "SHA-512"}
+
+// addRequirements requirements.txt の依存先を登録する（== で固定されたものだけバージョンを確定させる）
+// -r・-e などのオプション行と URL だけの行は読み飛ばす
+func (b *sbomBuilder) addRequirements(file models.File) (int, error) {
+	count := 0
+	for _, line := range joinContinuationLines(file.Content) {
+		if idx := strings.Index(line, " #"); idx >= 0 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "-") {
+			continue
+		}
+		hashes := requirementHash.FindAllStringSubmatch(line, -1)
+		if idx := strings.Index(line, " --"); idx >= 0 {
+			line = line[:idx]
+		}
+		spec, marker, _ := strings.Cut(line, ";")
+		m := requirementLine.FindStringSubmatch(strings.TrimSpace(spec))
+		if m == nil {
+			continue
+		}
+
+		c := &SBOMComponent{Ecosystem: "pypi", Name: normalizePythonName(m[1]), Direct: true}
+		constraint := strings.TrimSpace(m[3])
+		switch {
+		case strings.HasPrefix(constraint, "@"):
+			c.Download = strings.TrimSpace(constraint[1:])
+		case strings.HasPrefix(constraint, "===") && !strings.Contains(constraint, ","):
+			c.Version = strings.TrimSpace(constraint[3:])
+		case strings.HasPrefix(constraint, "==") && !strings.ContainsAny(constraint, ",*"):
+			c.Version = strings.TrimSpace(constraint[2:])
+		default:
+			c.Requirement = constraint
+		}
+		if marker = strings.TrimSpace(marker); marker != "" {
+			c.setProperty("python:marker", marker)
+			c.Scope = "optional"
+		}
+		for _, h := range hashes {
+			c.addHash(pythonHashAlgorithms[h[1]], strings.ToLower(h[2]))
+		}
+		b.add(c, file)
+		count++
+	}
+	return count, nil
+}
+
+// joinContinuationLines 行末の \ でつながれた行を1行にする
+func joinContinuationLines(content string) []string {
+	var lines []string
+	current := ""
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasSuffix(line, "\\") {
+			current += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		lines = append(lines, current+line)
+		current = ""
+	}
+	if current != "" {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// poetryHash poetry.lock の files に並ぶハッシュ
+var poetryHash = regexp.MustCompile(`(sha256|sha384|sha512):([0-9a-f]+)`)
+
+// addPoetryLock poetry.lock の [[package]] を登録し、[package.dependencies] から依存関係をつなぐ
+// 古い形式の [metadata.files] にあるハッシュも拾う
+func (b *sbomBuilder) addPoetryLock(file models.File) (int, error) {
+	type lockedPackage struct {
+		component *SBOMComponent
+		deps      []string
+	}
+	var packages []*lockedPackage
+	var current *lockedPackage
+	oldHashes := make(map[string]string)
+	for _, t := range parseLockTables(file.Content) {
+		switch t.Name {
+		case "package":
+			c := &SBOMComponent{Ecosystem: "pypi", Name: normalizePythonName(t.tomlString("name")), Version: t.tomlString("version")}
+			if c.Name == "" {
+				current = nil
+				continue
+			}
+			groups := t.tomlStrings("groups")
+			switch {
+			case t.tomlString("category") == "dev", len(groups) > 0 && !containsString(groups, "main"):
+				c.Scope = "excluded"
+			case strings.TrimSpace(t.Values["optional"]) == "true":
+				c.Scope = "optional"
+			}
+			for _, h := range poetryHash.FindAllStringSubmatch(t.Values["files"], -1) {
+				c.addHash(pythonHashAlgorithms[h[1]], h[2])
+			}
+			current = &lockedPackage{component: c}
+			packages = append(packages, current)
+		case "package.dependencies":
+			if current != nil {
+				current.deps = append(current.deps, t.Keys...)
+			}
+		case "metadata.files":
+			for _, key := range t.Keys {
+				oldHashes[normalizePythonName(key)] = t.Values[key]
+			}
+		default:
+			if !strings.HasPrefix(t.Name, "package.") {
+				current = nil
+			}
+		}
+	}
+
+	refs := make(map[string]string, len(packages))
+	for _, p := range packages {
+		for _, h := range poetryHash.FindAllStringSubmatch(oldHashes[p.component.Name], -1) {
+			p.component.addHash(pythonHashAlgorithms[h[1]], h[2])
+		}
+		p.component = b.add(p.component, file)
+		refs[p.component.Name] = p.component.Ref
+	}
+	for _, p := range packages {
+		for _, dep := range p.deps {
+			p.component.dependOn(refs[normalizePythonName(dep)])
+		}
+	}
+	return len(packages), nil
+}
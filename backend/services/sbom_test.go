@@ -0,0 +1,593 @@
+package services
+
+import (
+	"debug/buildinfo"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"reverse-engineering-backend/models"
+)
+
+const testGoMod = `module example.com/app
+
+go 1.22
+
+require (
+	github.com/gin-gonic/gin v1.9.1
+	golang.org/x/text v0.14.0 // indirect
+	example.com/old v1.0.0
+	example.com/local v0.1.0
+)
+
+require github.com/pkg/errors v0.9.1
+
+replace example.com/old v1.0.0 => example.com/new v1.2.0
+
+replace example.com/local => ../local
+`
+
+const testGoSum = `github.com/gin-gonic/gin v1.9.1 h1:ginhash=
+github.com/gin-gonic/gin v1.9.1/go.mod h1:modhash=
+`
+
+const testPackageLockV3 = `{
+  "name": "web",
+  "version": "1.0.0",
+  "lockfileVersion": 3,
+  "packages": {
+    "": {
+      "name": "web",
+      "version": "1.0.0",
+      "license": "MIT",
+      "dependencies": {"@scope/ui": "^2.0.0", "lodash": "^4.17.0"},
+      "devDependencies": {"jest": "^29.0.0"}
+    },
+    "node_modules/@scope/ui": {
+      "version": "2.1.0",
+      "resolved": "https://registry.npmjs.org/@scope/ui/-/ui-2.1.0.tgz",
+      "integrity": "sha512-AAEC",
+      "dependencies": {"lodash": "^3.0.0"}
+    },
+    "node_modules/@scope/ui/node_modules/lodash": {"version": "3.10.1"},
+    "node_modules/lodash": {"version": "4.17.21", "license": {"type": "MIT"}},
+    "node_modules/jest": {"version": "29.7.0", "dev": true},
+    "packages/shared": {"version": "0.0.1"}
+  }
+}`
+
+const testPackageLockV1 = `{
+  "name": "legacy",
+  "version": "0.1.0",
+  "lockfileVersion": 1,
+  "dependencies": {
+    "express": {
+      "version": "4.18.2",
+      "integrity": "sha1-AAEC",
+      "requires": {"debug": "2.6.9"},
+      "dependencies": {"debug": {"version": "2.6.9"}}
+    },
+    "mocha": {"version": "10.2.0", "dev": true}
+  }
+}`
+
+const testPackageJSON = `{
+  "name": "declared",
+  "dependencies": {"react": "18.2.0", "axios": "^1.6.0"},
+  "optionalDependencies": {"fsevents": "~2.3.0"},
+  "devDependencies": {"typescript": "5.3.3"}
+}`
+
+const testRequirements = `# 固定したもの・範囲・マーカー・ハッシュ
+Django==4.2.7
+requests>=2.31,<3
+Flask_Cors===4.0.0  # comment
+pywin32==306 ; sys_platform == "win32"
+numpy==1.26.2 \
+    --hash=sha256:ABCDEF
+-r other.txt
+-e git+https://example.com/repo.git#egg=editable
+mylib @ https://example.com/mylib-1.0.tar.gz
+`
+
+const testPoetryLock = `[[package]]
+name = "Requests"
+version = "2.31.0"
+optional = false
+files = [
+    {file = "requests-2.31.0.tar.gz", hash = "sha256:aaaa"},
+]
+
+[package.dependencies]
+urllib3 = ">=1.21.1,<3"
+
+[[package]]
+name = "urllib3"
+version = "2.1.0"
+
+[[package]]
+name = "pytest"
+version = "7.4.3"
+groups = ["dev"]
+
+[[package]]
+name = "ujson"
+version = "5.9.0"
+optional = true
+
+[metadata]
+lock-version = "2.0"
+
+[metadata.files]
+urllib3 = [
+    {file = "urllib3-2.1.0.tar.gz", hash = "sha256:bbbb"},
+]
+`
+
+const testPom = `<project>
+  <parent><groupId>org.example</groupId><version>3.0.0</version></parent>
+  <artifactId>service</artifactId>
+  <properties><jackson.version>2.16.0</jackson.version></properties>
+  <licenses><license><name>Apache-2.0</name></license></licenses>
+  <dependencyManagement><dependencies>
+    <dependency><groupId>org.slf4j</groupId><artifactId>slf4j-api</artifactId><version>2.0.9</version></dependency>
+  </dependencies></dependencyManagement>
+  <dependencies>
+    <dependency><groupId>com.fasterxml.jackson.core</groupId><artifactId>jackson-databind</artifactId><version>${jackson.version}</version></dependency>
+    <dependency><groupId>org.slf4j</groupId><artifactId>slf4j-api</artifactId></dependency>
+    <dependency><groupId>junit</groupId><artifactId>junit</artifactId><version>4.13.2</version><scope>test</scope></dependency>
+    <dependency><groupId>javax.servlet</groupId><artifactId>servlet-api</artifactId><version>[2.5,3.0)</version><scope>provided</scope></dependency>
+  </dependencies>
+</project>`
+
+const testCargoLock = `version = 3
+
+[[package]]
+name = "app"
+version = "0.1.0"
+dependencies = [
+ "serde",
+ "rand 0.8.5",
+]
+
+[[package]]
+name = "serde"
+version = "1.0.193"
+source = "registry+https://github.com/rust-lang/crates.io-index"
+checksum = "cccc"
+
+[[package]]
+name = "rand"
+version = "0.7.3"
+source = "registry+https://github.com/rust-lang/crates.io-index"
+
+[[package]]
+name = "rand"
+version = "0.8.5"
+source = "registry+https://github.com/rust-lang/crates.io-index"
+`
+
+// sbomSummary テストで比べるコンポーネントの要約（purl・スコープ・直接の依存か）
+func sbomSummary(sbom *SBOM) []string {
+	var got []string
+	for _, c := range sbom.Components {
+		direct := ""
+		if c.Direct {
+			direct = " direct"
+		}
+		got = append(got, c.Type+" "+c.PURL+" "+c.Scope+direct)
+	}
+	return got
+}
+
+func TestCollectSBOMManifests(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []models.File
+		want  []string
+		count int
+	}{
+		{
+			name:  "go.mod",
+			files: []models.File{{ID: 1, Name: "go.mod", Content: testGoMod}, {ID: 2, Name: "go.sum", Content: testGoSum}},
+			want: []string{
+				"application pkg:golang/example.com/app required",
+				"library pkg:golang/example.com/local required direct",
+				"library pkg:golang/example.com/new@v1.2.0 required direct",
+				"library pkg:golang/github.com/gin-gonic/gin@v1.9.1 required direct",
+				"library pkg:golang/github.com/pkg/errors@v0.9.1 required direct",
+				"library pkg:golang/golang.org/x/text@v0.14.0 required",
+			},
+			count: 5,
+		},
+		{
+			name:  "package-lock.json v3",
+			files: []models.File{{Name: "web/package-lock.json", Content: testPackageLockV3}, {Name: "web/package.json", Content: testPackageJSON}},
+			want: []string{
+				"application pkg:npm/web@1.0.0 required",
+				"library pkg:npm/%40scope/ui@2.1.0 required direct",
+				"library pkg:npm/jest@29.7.0 excluded direct",
+				"library pkg:npm/lodash@3.10.1 required",
+				"library pkg:npm/lodash@4.17.21 required direct",
+			},
+			count: 4,
+		},
+		{
+			name:  "package-lock.json v1",
+			files: []models.File{{Name: "package-lock.json", Content: testPackageLockV1}},
+			want: []string{
+				"application pkg:npm/legacy@0.1.0 required",
+				"library pkg:npm/debug@2.6.9 required",
+				"library pkg:npm/express@4.18.2 required direct",
+				"library pkg:npm/mocha@10.2.0 excluded direct",
+			},
+			count: 3,
+		},
+		{
+			name:  "package.json",
+			files: []models.File{{Name: "package.json", Content: testPackageJSON}},
+			want: []string{
+				"application pkg:npm/declared required",
+				"library pkg:npm/axios required direct",
+				"library pkg:npm/fsevents optional direct",
+				"library pkg:npm/react@18.2.0 required direct",
+				"library pkg:npm/typescript@5.3.3 excluded direct",
+			},
+			count: 4,
+		},
+		{
+			name:  "requirements.txt",
+			files: []models.File{{Name: "requirements-dev.txt", Content: testRequirements}},
+			want: []string{
+				"library pkg:pypi/django@4.2.7 required direct",
+				"library pkg:pypi/flask-cors@4.0.0 required direct",
+				"library pkg:pypi/mylib required direct",
+				"library pkg:pypi/numpy@1.26.2 required direct",
+				"library pkg:pypi/pywin32@306 optional direct",
+				"library pkg:pypi/requests required direct",
+			},
+			count: 6,
+		},
+		{
+			name:  "poetry.lock",
+			files: []models.File{{Name: "poetry.lock", Content: testPoetryLock}},
+			want: []string{
+				"library pkg:pypi/pytest@7.4.3 excluded",
+				"library pkg:pypi/requests@2.31.0 required",
+				"library pkg:pypi/ujson@5.9.0 optional",
+				"library pkg:pypi/urllib3@2.1.0 required",
+			},
+			count: 4,
+		},
+		{
+			name:  "pom.xml",
+			files: []models.File{{Name: "pom.xml", Content: testPom}},
+			want: []string{
+				"application pkg:maven/org.example/service@3.0.0 required",
+				"library pkg:maven/com.fasterxml.jackson.core/jackson-databind@2.16.0 required direct",
+				"library pkg:maven/javax.servlet/servlet-api optional direct",
+				"library pkg:maven/junit/junit@4.13.2 excluded direct",
+				"library pkg:maven/org.slf4j/slf4j-api@2.0.9 required direct",
+			},
+			count: 4,
+		},
+		{
+			name:  "Cargo.lock",
+			files: []models.File{{Name: "Cargo.lock", Content: testCargoLock}},
+			want: []string{
+				"application pkg:cargo/app@0.1.0 required",
+				"library pkg:cargo/rand@0.7.3 required",
+				"library pkg:cargo/rand@0.8.5 required direct",
+				"library pkg:cargo/serde@1.0.193 required direct",
+			},
+			count: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sbom := CollectSBOM(tt.files)
+			if got := sbomSummary(sbom); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("components = %q, want %q", got, tt.want)
+			}
+			if len(sbom.Manifests) != 1 || sbom.Manifests[0].Components != tt.count || sbom.Manifests[0].Error != "" {
+				t.Errorf("manifests = %+v, want one with %d components", sbom.Manifests, tt.count)
+			}
+		})
+	}
+}
+
+// sbomComponent purl でコンポーネントを探す
+func sbomComponent(t *testing.T, sbom *SBOM, purl string) *SBOMComponent {
+	t.Helper()
+	for _, c := range sbom.Components {
+		if c.PURL == purl {
+			return c
+		}
+	}
+	t.Fatalf("component %s not found", purl)
+	return nil
+}
+
+func TestCollectSBOMDetails(t *testing.T) {
+	sbom := CollectSBOM([]models.File{
+		{ID: 1, Name: "go.mod", Content: testGoMod},
+		{ID: 2, Name: "go.sum", Content: testGoSum},
+		{ID: 3, Name: "web/package-lock.json", Content: testPackageLockV3},
+		{ID: 4, Name: "legacy/package-lock.json", Content: testPackageLockV1},
+		{ID: 5, Name: "requirements.txt", Content: testRequirements},
+		{ID: 6, Name: "py/poetry.lock", Content: testPoetryLock},
+		{ID: 7, Name: "pom.xml", Content: testPom},
+		{ID: 8, Name: "Cargo.lock", Content: testCargoLock},
+	})
+
+	// go.mod: go.sum のハッシュ、replace の置き換え先
+	gin := sbomComponent(t, sbom, "pkg:golang/github.com/gin-gonic/gin@v1.9.1")
+	if gin.Properties["go:h1"] != "h1:ginhash=" || len(gin.Sources) != 2 {
+		t.Errorf("gin = %+v", gin)
+	}
+	if c := sbomComponent(t, sbom, "pkg:golang/example.com/new@v1.2.0"); c.Properties["go:replaces"] != "example.com/old@v1.0.0" {
+		t.Errorf("replaced module = %+v", c)
+	}
+	if c := sbomComponent(t, sbom, "pkg:golang/example.com/local"); c.Properties["go:replace"] != "../local" {
+		t.Errorf("local replacement = %+v", c)
+	}
+	if c := sbomComponent(t, sbom, "pkg:golang/example.com/app"); len(c.DependsOn) != 5 || c.Properties["go:version"] != "1.22" {
+		t.Errorf("go module = %+v", c)
+	}
+
+	// package-lock.json: 入れ子の node_modules を先に探し、integrity を16進にする
+	ui := sbomComponent(t, sbom, "pkg:npm/%40scope/ui@2.1.0")
+	if !reflect.DeepEqual(ui.DependsOn, []string{"pkg:npm/lodash@3.10.1"}) || !reflect.DeepEqual(ui.Hashes, []SBOMHash{{"SHA-512", "000102"}}) {
+		t.Errorf("@scope/ui = %+v", ui)
+	}
+	if ui.Download != "https://registry.npmjs.org/@scope/ui/-/ui-2.1.0.tgz" {
+		t.Errorf("download = %q", ui.Download)
+	}
+	if c := sbomComponent(t, sbom, "pkg:npm/lodash@4.17.21"); c.License != "MIT" {
+		t.Errorf("license = %q", c.License)
+	}
+	express := sbomComponent(t, sbom, "pkg:npm/express@4.18.2")
+	if !reflect.DeepEqual(express.DependsOn, []string{"pkg:npm/debug@2.6.9"}) || !reflect.DeepEqual(express.Hashes, []SBOMHash{{"SHA-1", "000102"}}) {
+		t.Errorf("express = %+v", express)
+	}
+
+	// requirements.txt: 範囲・マーカー・ハッシュ・URL
+	if c := sbomComponent(t, sbom, "pkg:pypi/requests"); c.Requirement != ">=2.31,<3" {
+		t.Errorf("requests = %+v", c)
+	}
+	if c := sbomComponent(t, sbom, "pkg:pypi/pywin32@306"); c.Properties["python:marker"] != `sys_platform == "win32"` {
+		t.Errorf("pywin32 = %+v", c)
+	}
+	if c := sbomComponent(t, sbom, "pkg:pypi/numpy@1.26.2"); !reflect.DeepEqual(c.Hashes, []SBOMHash{{"SHA-256", "abcdef"}}) {
+		t.Errorf("numpy = %+v", c)
+	}
+	if c := sbomComponent(t, sbom, "pkg:pypi/mylib"); c.Download != "https://example.com/mylib-1.0.tar.gz" {
+		t.Errorf("mylib = %+v", c)
+	}
+
+	// poetry.lock: 依存関係と、古い形式の [metadata.files] のハッシュ
+	requests := sbomComponent(t, sbom, "pkg:pypi/requests@2.31.0")
+	if !reflect.DeepEqual(requests.DependsOn, []string{"pkg:pypi/urllib3@2.1.0"}) || !reflect.DeepEqual(requests.Hashes, []SBOMHash{{"SHA-256", "aaaa"}}) {
+		t.Errorf("requests = %+v", requests)
+	}
+	if c := sbomComponent(t, sbom, "pkg:pypi/urllib3@2.1.0"); !reflect.DeepEqual(c.Hashes, []SBOMHash{{"SHA-256", "bbbb"}}) {
+		t.Errorf("urllib3 = %+v", c)
+	}
+
+	// pom.xml: 範囲指定は requirement に残す
+	if c := sbomComponent(t, sbom, "pkg:maven/javax.servlet/servlet-api"); c.Requirement != "[2.5,3.0)" || c.Properties["maven:scope"] != "provided" {
+		t.Errorf("servlet-api = %+v", c)
+	}
+	if c := sbomComponent(t, sbom, "pkg:maven/org.example/service@3.0.0"); c.License != "Apache-2.0" || len(c.DependsOn) != 4 {
+		t.Errorf("maven project = %+v", c)
+	}
+
+	// Cargo.lock: 同名のクレートはバージョンで区別する
+	if c := sbomComponent(t, sbom, "pkg:cargo/app@0.1.0"); !reflect.DeepEqual(c.DependsOn, []string{"pkg:cargo/rand@0.8.5", "pkg:cargo/serde@1.0.193"}) {
+		t.Errorf("app = %+v", c)
+	}
+	serde := sbomComponent(t, sbom, "pkg:cargo/serde@1.0.193")
+	if serde.Download != "https://crates.io/api/v1/crates/serde/1.0.193/download" || !reflect.DeepEqual(serde.Hashes, []SBOMHash{{"SHA-256", "cccc"}}) {
+		t.Errorf("serde = %+v", serde)
+	}
+
+	// go.sum は go.mod のハッシュに使うだけでマニフェストには数えない
+	if len(sbom.Manifests) != 7 {
+		t.Errorf("manifests = %+v", sbom.Manifests)
+	}
+}
+
+func TestCollectSBOMInvalid(t *testing.T) {
+	sbom := CollectSBOM([]models.File{
+		{Name: "go.mod", Content: "go 1.22\n"},
+		{Name: "package.json", Content: "{"},
+		{Name: "pom.xml", Content: "<project>"},
+		{Name: "Cargo.lock", Content: "version = 3\n"},
+	})
+	if len(sbom.Components) != 0 || len(sbom.Manifests) != 4 {
+		t.Fatalf("sbom = %+v", sbom)
+	}
+	for _, m := range sbom.Manifests {
+		if m.Error == "" {
+			t.Errorf("%s: no error", m.File)
+		}
+	}
+}
+
+func TestCollectSBOMGoBinary(t *testing.T) {
+	// テストのバイナリ自身が Go のビルド情報を持つ
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	info, err := buildinfo.ReadFile(exe)
+	if err != nil {
+		t.Skip(err)
+	}
+	text := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(text, []byte("not a binary"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sbom := CollectSBOM([]models.File{
+		{ID: 1, Name: "bin/app", Path: exe},
+		{ID: 2, Name: "notes.txt", Path: text},
+		{ID: 3, Name: "missing", Path: filepath.Join(t.TempDir(), "missing")},
+	})
+	if len(sbom.Manifests) != 1 || sbom.Manifests[0].Type != "go-binary" || sbom.Manifests[0].Components != len(info.Deps) {
+		t.Fatalf("manifests = %+v, want one go-binary with %d modules", sbom.Manifests, len(info.Deps))
+	}
+	app := sbom.Components[0]
+	if app.Type != "application" || app.Name != info.Main.Path || app.Properties["go:version"] != info.GoVersion {
+		t.Errorf("application = %+v", app)
+	}
+	if len(app.DependsOn) != len(info.Deps) {
+		t.Errorf("application depends on %d modules, want %d", len(app.DependsOn), len(info.Deps))
+	}
+	for _, dep := range info.Deps {
+		mod := dep
+		if dep.Replace != nil {
+			mod = dep.Replace
+		}
+		c := sbomComponent(t, sbom, PackageURL("golang", "", mod.Path, mod.Version))
+		if c.Properties["go:h1"] != mod.Sum {
+			t.Errorf("%s: go:h1 = %q, want %q", c.PURL, c.Properties["go:h1"], mod.Sum)
+		}
+	}
+}
+
+// sbomJSON 文書を JSON にしてから読み直す（出力される形で確かめる）
+func sbomJSON(t *testing.T, doc map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestSBOMCycloneDX(t *testing.T) {
+	sbom := CollectSBOM([]models.File{
+		{Name: "go.mod", Content: testGoMod},
+		{Name: "web/package-lock.json", Content: testPackageLockV3},
+	})
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	doc := sbomJSON(t, sbom.CycloneDX("demo", "sbom:1:2", created))
+
+	if doc["bomFormat"] != "CycloneDX" || doc["specVersion"] != "1.5" || doc["version"] != float64(1) {
+		t.Errorf("header = %v %v %v", doc["bomFormat"], doc["specVersion"], doc["version"])
+	}
+	serial, _ := doc["serialNumber"].(string)
+	if !strings.HasPrefix(serial, "urn:uuid:") || len(serial) != len("urn:uuid:")+36 {
+		t.Errorf("serialNumber = %q", serial)
+	}
+	// 同じ解析からは同じ文書になる
+	if again := sbomJSON(t, sbom.CycloneDX("demo", "sbom:1:2", created)); !reflect.DeepEqual(doc, again) {
+		t.Error("CycloneDX() is not deterministic")
+	}
+	metadata := doc["metadata"].(map[string]interface{})
+	project := metadata["component"].(map[string]interface{})
+	if metadata["timestamp"] != "2024-01-02T03:04:05Z" || project["name"] != "demo" || project["type"] != "application" {
+		t.Errorf("metadata = %v", metadata)
+	}
+
+	components := doc["components"].([]interface{})
+	if len(components) != len(sbom.Components) {
+		t.Fatalf("got %d components, want %d", len(components), len(sbom.Components))
+	}
+	scopes := make(map[string]string)
+	for _, raw := range components {
+		c := raw.(map[string]interface{})
+		purl, _ := c["purl"].(string)
+		if !strings.HasPrefix(purl, "pkg:") || c["bom-ref"] != purl || c["name"] == "" {
+			t.Errorf("component = %v", c)
+		}
+		scopes[purl], _ = c["scope"].(string)
+	}
+	if scopes["pkg:npm/jest@29.7.0"] != "excluded" || scopes["pkg:golang/github.com/gin-gonic/gin@v1.9.1"] != "required" {
+		t.Errorf("scopes = %v", scopes)
+	}
+
+	// 依存関係の先頭はプロジェクトで、マニフェストごとの application につなぐ
+	dependencies := doc["dependencies"].([]interface{})
+	first := dependencies[0].(map[string]interface{})
+	if len(dependencies) != len(components)+1 || first["ref"] != project["bom-ref"] {
+		t.Fatalf("dependencies = %v", dependencies)
+	}
+	if want := []interface{}{"pkg:golang/example.com/app", "pkg:npm/web@1.0.0"}; !reflect.DeepEqual(first["dependsOn"], want) {
+		t.Errorf("project depends on %v, want %v", first["dependsOn"], want)
+	}
+}
+
+func TestSBOMSPDX(t *testing.T) {
+	sbom := CollectSBOM([]models.File{
+		{Name: "go.mod", Content: testGoMod},
+		{Name: "web/package-lock.json", Content: testPackageLockV3},
+	})
+	doc := sbomJSON(t, sbom.SPDX("demo app", "sbom:1:2", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+
+	for key, want := range map[string]string{
+		"spdxVersion": "SPDX-2.3",
+		"dataLicense": "CC0-1.0",
+		"SPDXID":      "SPDXRef-DOCUMENT",
+		"name":        "demo app SBOM",
+	} {
+		if doc[key] != want {
+			t.Errorf("%s = %v, want %q", key, doc[key], want)
+		}
+	}
+	if ns, _ := doc["documentNamespace"].(string); !strings.HasPrefix(ns, "https://spdx.org/spdxdocs/demo%20app-") {
+		t.Errorf("documentNamespace = %q", ns)
+	}
+	creation := doc["creationInfo"].(map[string]interface{})
+	if creation["created"] != "2024-01-02T03:04:05Z" || len(creation["creators"].([]interface{})) != 1 {
+		t.Errorf("creationInfo = %v", creation)
+	}
+
+	packages := doc["packages"].([]interface{})
+	if len(packages) != len(sbom.Components) {
+		t.Fatalf("got %d packages, want %d", len(packages), len(sbom.Components))
+	}
+	ids := make(map[string]string)
+	for _, raw := range packages {
+		pkg := raw.(map[string]interface{})
+		for _, field := range []string{"SPDXID", "name", "downloadLocation", "licenseConcluded", "copyrightText"} {
+			if s, _ := pkg[field].(string); s == "" {
+				t.Errorf("package %v has no %s", pkg["name"], field)
+			}
+		}
+		ref := pkg["externalRefs"].([]interface{})[0].(map[string]interface{})
+		if ref["referenceType"] != "purl" {
+			t.Errorf("externalRefs = %v", ref)
+		}
+		ids[ref["referenceLocator"].(string)] = pkg["SPDXID"].(string)
+		if pkg["name"] == "@scope/ui" {
+			checksums := pkg["checksums"].([]interface{})
+			if c := checksums[0].(map[string]interface{}); c["algorithm"] != "SHA512" || c["checksumValue"] != "000102" {
+				t.Errorf("checksums = %v", checksums)
+			}
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, raw := range doc["relationships"].([]interface{}) {
+		rel := raw.(map[string]interface{})
+		counts[rel["relationshipType"].(string)]++
+		if rel["relationshipType"] == "DEV_DEPENDENCY_OF" &&
+			(rel["spdxElementId"] != ids["pkg:npm/jest@29.7.0"] || rel["relatedSpdxElement"] != ids["pkg:npm/web@1.0.0"]) {
+			t.Errorf("dev dependency = %v", rel)
+		}
+	}
+	// go.mod の5つ、ルートの lodash と @scope/ui、@scope/ui の入れ子の lodash
+	if want := map[string]int{"DESCRIBES": 2, "DEPENDS_ON": 8, "DEV_DEPENDENCY_OF": 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("relationships = %v, want %v", counts, want)
+	}
+}
@@ -0,0 +1,773 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// SchemaColumn テーブルの列
+type SchemaColumn struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`               // 正規化した型（integer, bigint, varchar(255), text, boolean, timestamp など）
+	RawType    string `json:"raw_type,omitempty"` // 定義に書かれていた型
+	Nullable   bool   `json:"nullable"`
+	PrimaryKey bool   `json:"primary_key,omitempty"`
+	Unique     bool   `json:"unique,omitempty"`
+	Default    string `json:"default,omitempty"`
+}
+
+// SchemaEntity テーブル（エンティティ）
+type SchemaEntity struct {
+	Name       string         `json:"name"`
+	Columns    []SchemaColumn `json:"columns"`
+	PrimaryKey []string       `json:"primary_key,omitempty"`
+	Sources    []string       `json:"sources"` // 定義が見つかった ファイル:行
+	Origins    []string       `json:"origins"` // sql, migration, gorm, django, jpa, rails, alembic
+}
+
+// SchemaRelationship 外部キーによる関係
+type SchemaRelationship struct {
+	FromTable   string   `json:"from_table"`
+	FromColumns []string `json:"from_columns"`
+	ToTable     string   `json:"to_table"`
+	ToColumns   []string `json:"to_columns"`
+	Cardinality string   `json:"cardinality"` // many_to_one, one_to_one
+	Source      string   `json:"source,omitempty"`
+	Reason      string   `json:"reason,omitempty"`     // 推定した根拠（推定の場合のみ）
+	Confidence  string   `json:"confidence,omitempty"` // high, medium（推定の場合のみ）
+}
+
+// SchemaModel 復元したスキーマ
+type SchemaModel struct {
+	Entities            []SchemaEntity       `json:"entities"`
+	Relationships       []SchemaRelationship `json:"relationships"`         // 定義された外部キー
+	InferredForeignKeys []SchemaRelationship `json:"inferred_foreign_keys"` // 列名から推定した、定義されていない外部キー
+	Warnings            []string             `json:"warnings,omitempty"`
+}
+
+// schemaBuilder 複数の定義元から集めたテーブルと外部キーをまとめる（テーブル名・列名は大文字小文字を区別しない）
+type schemaBuilder struct {
+	entities map[string]*SchemaEntity
+	order    []string
+	fks      []SchemaRelationship
+	warnings []string
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{entities: make(map[string]*SchemaEntity)}
+}
+
+func schemaKey(name string) string {
+	return strings.ToLower(name)
+}
+
+// entity テーブルを取得する（なければ作る）
+func (s *schemaBuilder) entity(name, origin, source string) *SchemaEntity {
+	key := schemaKey(name)
+	e, ok := s.entities[key]
+	if !ok {
+		e = &SchemaEntity{Name: name, Columns: []SchemaColumn{}, Sources: []string{}, Origins: []string{}}
+		s.entities[key] = e
+		s.order = append(s.order, key)
+	}
+	if source != "" && !containsString(e.Sources, source) {
+		e.Sources = append(e.Sources, source)
+	}
+	if origin != "" && !containsString(e.Origins, origin) {
+		e.Origins = append(e.Origins, origin)
+	}
+	return e
+}
+
+// lookup 既存のテーブルを返す
+func (s *schemaBuilder) lookup(name string) *SchemaEntity {
+	return s.entities[schemaKey(name)]
+}
+
+// dropEntity テーブルを削除する（マイグレーションの DROP TABLE）
+func (s *schemaBuilder) dropEntity(name string) {
+	key := schemaKey(name)
+	if _, ok := s.entities[key]; !ok {
+		return
+	}
+	delete(s.entities, key)
+	for i, k := range s.order {
+		if k == key {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	fks := s.fks[:0]
+	for _, fk := range s.fks {
+		if schemaKey(fk.FromTable) != key {
+			fks = append(fks, fk)
+		}
+	}
+	s.fks = fks
+}
+
+// renameEntity テーブル名を変更する（ALTER TABLE ... RENAME TO）
+func (s *schemaBuilder) renameEntity(from, to string) {
+	e := s.lookup(from)
+	if e == nil {
+		return
+	}
+	oldKey, newKey := schemaKey(from), schemaKey(to)
+	delete(s.entities, oldKey)
+	e.Name = to
+	s.entities[newKey] = e
+	for i, k := range s.order {
+		if k == oldKey {
+			s.order[i] = newKey
+		}
+	}
+	for i := range s.fks {
+		if schemaKey(s.fks[i].FromTable) == oldKey {
+			s.fks[i].FromTable = to
+		}
+		if schemaKey(s.fks[i].ToTable) == oldKey {
+			s.fks[i].ToTable = to
+		}
+	}
+}
+
+// setColumn 列を追加する。同名の列が既にあれば、空でない情報で上書きする
+func (e *SchemaEntity) setColumn(col SchemaColumn) *SchemaColumn {
+	if col.Type == "" {
+		col.Type = normalizeColumnType(col.RawType)
+	}
+	for i := range e.Columns {
+		existing := &e.Columns[i]
+		if !strings.EqualFold(existing.Name, col.Name) {
+			continue
+		}
+		if col.RawType != "" {
+			existing.Type, existing.RawType = col.Type, col.RawType
+		}
+		existing.Nullable = existing.Nullable && col.Nullable
+		existing.PrimaryKey = existing.PrimaryKey || col.PrimaryKey
+		existing.Unique = existing.Unique || col.Unique
+		if col.Default != "" {
+			existing.Default = col.Default
+		}
+		if col.PrimaryKey {
+			e.addPrimaryKey(existing.Name)
+		}
+		return existing
+	}
+	e.Columns = append(e.Columns, col)
+	if col.PrimaryKey {
+		e.addPrimaryKey(col.Name)
+	}
+	return &e.Columns[len(e.Columns)-1]
+}
+
+func (e *SchemaEntity) column(name string) *SchemaColumn {
+	for i := range e.Columns {
+		if strings.EqualFold(e.Columns[i].Name, name) {
+			return &e.Columns[i]
+		}
+	}
+	return nil
+}
+
+func (e *SchemaEntity) dropColumn(name string) {
+	for i := range e.Columns {
+		if strings.EqualFold(e.Columns[i].Name, name) {
+			e.Columns = append(e.Columns[:i], e.Columns[i+1:]...)
+			break
+		}
+	}
+	for i, pk := range e.PrimaryKey {
+		if strings.EqualFold(pk, name) {
+			e.PrimaryKey = append(e.PrimaryKey[:i], e.PrimaryKey[i+1:]...)
+			break
+		}
+	}
+}
+
+// renameColumn 列名を変更し、主キーと外部キーの列名も書き換える
+func (s *schemaBuilder) renameColumn(e *SchemaEntity, from, to string) {
+	col := e.column(from)
+	if col == nil || to == "" {
+		return
+	}
+	col.Name = to
+	for i, pk := range e.PrimaryKey {
+		if strings.EqualFold(pk, from) {
+			e.PrimaryKey[i] = to
+		}
+	}
+	for i := range s.fks {
+		fk := &s.fks[i]
+		for j, c := range fk.FromColumns {
+			if schemaKey(fk.FromTable) == schemaKey(e.Name) && strings.EqualFold(c, from) {
+				fk.FromColumns[j] = to
+			}
+		}
+		for j, c := range fk.ToColumns {
+			if schemaKey(fk.ToTable) == schemaKey(e.Name) && strings.EqualFold(c, from) {
+				fk.ToColumns[j] = to
+			}
+		}
+	}
+}
+
+func (e *SchemaEntity) addPrimaryKey(columns ...string) {
+	for _, name := range columns {
+		found := false
+		for _, pk := range e.PrimaryKey {
+			if strings.EqualFold(pk, name) {
+				found = true
+			}
+		}
+		if !found {
+			e.PrimaryKey = append(e.PrimaryKey, name)
+		}
+		if col := e.column(name); col != nil {
+			col.PrimaryKey, col.Nullable = true, false
+		}
+	}
+}
+
+// addForeignKey 定義された外部キーを追加する（同じ列の組み合わせは1つにまとめる）
+func (s *schemaBuilder) addForeignKey(fk SchemaRelationship) {
+	for _, existing := range s.fks {
+		if schemaKey(existing.FromTable) == schemaKey(fk.FromTable) && schemaKey(existing.ToTable) == schemaKey(fk.ToTable) &&
+			strings.EqualFold(strings.Join(existing.FromColumns, ","), strings.Join(fk.FromColumns, ",")) {
+			return
+		}
+	}
+	s.fks = append(s.fks, fk)
+}
+
+// build 参照先の列を補い、カーディナリティを決め、定義されていない外部キーを推定する
+func (s *schemaBuilder) build() *SchemaModel {
+	model := &SchemaModel{Entities: []SchemaEntity{}, Relationships: []SchemaRelationship{}, InferredForeignKeys: []SchemaRelationship{}, Warnings: s.warnings}
+	for _, key := range s.order {
+		model.Entities = append(model.Entities, *s.entities[key])
+	}
+	sort.SliceStable(model.Entities, func(i, j int) bool { return schemaKey(model.Entities[i].Name) < schemaKey(model.Entities[j].Name) })
+
+	declared := make(map[string]bool)
+	for _, fk := range s.fks {
+		from, to := s.lookup(fk.FromTable), s.lookup(fk.ToTable)
+		if from == nil {
+			continue
+		}
+		if to == nil {
+			model.Warnings = append(model.Warnings, fmt.Sprintf("foreign key %s(%s) references unknown table %s", fk.FromTable, strings.Join(fk.FromColumns, ", "), fk.ToTable))
+		} else {
+			fk.ToTable = to.Name
+			if len(fk.ToColumns) == 0 {
+				fk.ToColumns = append([]string(nil), to.PrimaryKey...)
+			}
+		}
+		fk.FromTable = from.Name
+		fk.Cardinality = "many_to_one"
+		if len(fk.FromColumns) == 1 {
+			if col := from.column(fk.FromColumns[0]); col != nil && (col.Unique || (col.PrimaryKey && len(from.PrimaryKey) == 1)) {
+				fk.Cardinality = "one_to_one"
+			}
+		}
+		for _, col := range fk.FromColumns {
+			declared[schemaKey(from.Name)+"."+strings.ToLower(col)] = true
+		}
+		model.Relationships = append(model.Relationships, fk)
+	}
+	model.InferredForeignKeys = inferForeignKeys(s, declared)
+	return model
+}
+
+var (
+	// user_id, userId, UserID などの末尾の id
+	idSuffixRe = regexp.MustCompile(`^(.+?)(?:_id|Id|ID|_ID)$`)
+	// 型の正規化に使う（varchar(255) → 名前 varchar、引数 255）
+	columnTypeRe = regexp.MustCompile(`^\s*([A-Za-z][\w ]*?)\s*(?:\(\s*([^)]*)\))?\s*(\[\])?\s*$`)
+)
+
+// inferForeignKeys 列名が 他のテーブル名_id になっていて外部キーとして定義されていない列を探す
+// 参照先の主キーが1列で、型が同じ系統なら high、異なれば medium
+func inferForeignKeys(s *schemaBuilder, declared map[string]bool) []SchemaRelationship {
+	// テーブル名の単数形・複数形・区切りなしの形から引けるようにする
+	byName := make(map[string]*SchemaEntity)
+	for _, key := range s.order {
+		e := s.entities[key]
+		for _, name := range schemaNameVariants(e.Name) {
+			if _, ok := byName[name]; !ok {
+				byName[name] = e
+			}
+		}
+	}
+
+	inferred := []SchemaRelationship{}
+	for _, key := range s.order {
+		e := s.entities[key]
+		for _, col := range e.Columns {
+			if declared[key+"."+strings.ToLower(col.Name)] || (col.PrimaryKey && len(e.PrimaryKey) == 1) {
+				continue
+			}
+			m := idSuffixRe.FindStringSubmatch(col.Name)
+			if m == nil {
+				continue
+			}
+			target := byName[compactSchemaName(m[1])]
+			if target == nil || len(target.PrimaryKey) != 1 {
+				continue
+			}
+			pk := target.column(target.PrimaryKey[0])
+			if pk == nil {
+				continue
+			}
+			confidence := "high"
+			if columnTypeFamily(pk.Type) != columnTypeFamily(col.Type) {
+				confidence = "medium"
+			}
+			cardinality := "many_to_one"
+			if col.Unique {
+				cardinality = "one_to_one"
+			}
+			inferred = append(inferred, SchemaRelationship{
+				FromTable:   e.Name,
+				FromColumns: []string{col.Name},
+				ToTable:     target.Name,
+				ToColumns:   []string{pk.Name},
+				Cardinality: cardinality,
+				Source:      strings.Join(e.Sources, ", "),
+				Reason:      fmt.Sprintf("column %s.%s matches primary key %s.%s by name", e.Name, col.Name, target.Name, pk.Name),
+				Confidence:  confidence,
+			})
+		}
+	}
+	return inferred
+}
+
+// compactSchemaName 比較用に区切りと大文字小文字を取り除く（order_items → orderitems）
+func compactSchemaName(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "", " ", "").Replace(name))
+}
+
+// schemaNameVariants テーブル名から、列名の接頭辞として現れうる形（単数形など）を返す
+func schemaNameVariants(table string) []string {
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		table = table[i+1:]
+	}
+	name := compactSchemaName(table)
+	variants := []string{name}
+	if singular := compactSchemaName(singularizeTableName(table)); singular != name {
+		variants = append(variants, singular)
+	}
+	// Django の app_model 形式のテーブルはモデル名でも引く
+	if i := strings.Index(table, "_"); i >= 0 {
+		variants = append(variants, compactSchemaName(table[i+1:]))
+	}
+	return variants
+}
+
+// pluralizeTableName 英語の複数形（GORM・Rails の既定のテーブル名）
+func pluralizeTableName(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, "y") && len(lower) > 1 && !strings.ContainsAny(lower[len(lower)-2:len(lower)-1], "aeiou"):
+		return name[:len(name)-1] + "ies"
+	case strings.HasSuffix(lower, "sis"):
+		return name[:len(name)-2] + "es"
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"),
+		strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return name + "es"
+	}
+	return name + "s"
+}
+
+// singularizeTableName テーブル名の単数形（Rails の外部キー列名 user_id などに使う）
+func singularizeTableName(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, "ies") && len(lower) > 3:
+		return name[:len(name)-3] + "y"
+	case strings.HasSuffix(lower, "sses"), strings.HasSuffix(lower, "xes"), strings.HasSuffix(lower, "ches"), strings.HasSuffix(lower, "shes"):
+		return name[:len(name)-2]
+	case strings.HasSuffix(lower, "s") && !strings.HasSuffix(lower, "ss"):
+		return name[:len(name)-1]
+	}
+	return name
+}
+
+// snakeCase GORM の列名の規則（UserID → user_id、HTTPServer → http_server）
+func snakeCase(name string) string {
+	var sb strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		upper := r >= 'A' && r <= 'Z'
+		if upper && i > 0 {
+			prevLower := runes[i-1] >= 'a' && runes[i-1] <= 'z' || runes[i-1] >= '0' && runes[i-1] <= '9'
+			nextLower := i+1 < len(runes) && runes[i+1] >= 'a' && runes[i+1] <= 'z'
+			if prevLower || (nextLower && runes[i-1] >= 'A' && runes[i-1] <= 'Z') {
+				sb.WriteByte('_')
+			}
+		}
+		if upper {
+			r += 'a' - 'A'
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// 型名の正規化（SQL の方言や ORM の型を共通の名前にそろえる）
+var columnTypeNames = map[string]string{
+	"int": "integer", "integer": "integer", "int4": "integer", "mediumint": "integer", "serial": "integer",
+	"smallint": "smallint", "int2": "smallint", "tinyint": "smallint", "smallserial": "smallint",
+	"bigint": "bigint", "int8": "bigint", "bigserial": "bigint",
+	"varchar": "varchar", "character varying": "varchar", "nvarchar": "varchar", "varchar2": "varchar", "nvarchar2": "varchar",
+	"char": "char", "character": "char", "nchar": "char", "bpchar": "char",
+	"text": "text", "tinytext": "text", "mediumtext": "text", "longtext": "text", "clob": "text", "ntext": "text", "citext": "text",
+	"bool": "boolean", "boolean": "boolean", "bit": "boolean",
+	"date": "date", "time": "time", "datetime": "timestamp", "datetime2": "timestamp", "timestamp": "timestamp",
+	"timestamptz": "timestamp", "timestamp with time zone": "timestamp", "timestamp without time zone": "timestamp", "smalldatetime": "timestamp",
+	"decimal": "decimal", "numeric": "decimal", "number": "decimal", "money": "decimal",
+	"float": "float", "float4": "float", "float8": "double", "real": "float", "double": "double", "double precision": "double",
+	"json": "json", "jsonb": "json",
+	"blob": "binary", "bytea": "binary", "binary": "binary", "varbinary": "binary", "longblob": "binary", "mediumblob": "binary", "image": "binary",
+	"uuid": "uuid", "uniqueidentifier": "uuid",
+	"enum": "enum", "interval": "interval", "inet": "inet",
+}
+
+// normalizeColumnType 型を正規化する（varchar(255) → varchar(255)、INT UNSIGNED → integer、character varying(20) → varchar(20)）
+func normalizeColumnType(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	lower := strings.ToLower(raw)
+	for _, suffix := range []string{" unsigned", " signed", " zerofill", " auto_increment", " identity"} {
+		lower = strings.ReplaceAll(lower, suffix, "")
+	}
+	m := columnTypeRe.FindStringSubmatch(lower)
+	if m == nil {
+		return lower
+	}
+	name, ok := columnTypeNames[strings.TrimSpace(m[1])]
+	if !ok {
+		return lower
+	}
+	switch name {
+	case "varchar", "char", "decimal":
+		if m[2] != "" {
+			name += "(" + strings.ReplaceAll(m[2], " ", "") + ")"
+		}
+	}
+	return name + m[3]
+}
+
+// columnTypeFamily 外部キーの推定で型を比べるための系統
+func columnTypeFamily(t string) string {
+	base := t
+	if i := strings.IndexByte(base, '('); i >= 0 {
+		base = base[:i]
+	}
+	switch base {
+	case "integer", "smallint", "bigint":
+		return "integer"
+	case "varchar", "char", "text":
+		return "string"
+	}
+	return base
+}
+
+// Diagram ER 図（エンティティを列付きのノード、外部キーを辺）として返す。推定した外部キーは inferred の辺になる
+func (m *SchemaModel) Diagram() *Diagram {
+	b := newDiagramBuilder("er")
+	for _, e := range m.Entities {
+		fkColumns := make(map[string]bool)
+		for _, fk := range m.Relationships {
+			if fk.FromTable == e.Name {
+				for _, col := range fk.FromColumns {
+					fkColumns[strings.ToLower(col)] = true
+				}
+			}
+		}
+		attrs := make([]DiagramAttribute, 0, len(e.Columns))
+		for _, col := range e.Columns {
+			var keys []string
+			if col.PrimaryKey {
+				keys = append(keys, "PK")
+			}
+			if fkColumns[strings.ToLower(col.Name)] {
+				keys = append(keys, "FK")
+			}
+			if col.Unique && !col.PrimaryKey {
+				keys = append(keys, "UK")
+			}
+			attrs = append(attrs, DiagramAttribute{Name: col.Name, Type: col.Type, Keys: keys})
+		}
+		file := ""
+		if len(e.Sources) > 0 {
+			file = e.Sources[0]
+		}
+		b.addNode(DiagramNode{ID: e.Name, Label: e.Name, Kind: "entity", Attributes: attrs, File: file})
+	}
+	add := func(fk SchemaRelationship, kind string) {
+		if b.node(fk.ToTable) == nil {
+			b.addNode(DiagramNode{ID: fk.ToTable, Label: fk.ToTable, Kind: "entity", External: true})
+		}
+		b.addLabeledEdge(fk.FromTable, fk.ToTable, kind, strings.Join(fk.FromColumns, ", "), fk.Cardinality)
+	}
+	for _, fk := range m.Relationships {
+		add(fk, "references")
+	}
+	for _, fk := range m.InferredForeignKeys {
+		add(fk, "inferred")
+	}
+	return b.build()
+}
+
+// ormReference ORM の関連から作る外部キー。参照先（と has-many では外部キーを持つ側）はクラス名で持ち、
+// 全ファイルのモデルを読んでからテーブル名と主キーに解決する
+type ormReference struct {
+	table    string // 外部キーを持つテーブル（空なら owner のテーブル）
+	owner    string // 外部キーを持つクラス
+	column   string
+	target   string // 参照先のクラス
+	toColumn string // 空なら参照先の主キー
+	unique   bool
+	joinKey  bool // 多対多の中間テーブルの列（主キーの一部）
+	source   string
+}
+
+// resolveORMReferences クラス名をテーブルに解決して外部キー列と外部キーを追加する
+// 外部キー列の型は参照先の主キーの型に合わせる
+func resolveORMReferences(s *schemaBuilder, refs []ormReference, tables map[string]string, origin string) {
+	for _, ref := range refs {
+		table := ref.table
+		if table == "" {
+			table = tables[ref.owner]
+		}
+		if table == "" || tables[ref.target] == "" {
+			continue
+		}
+		// 参照先がプロジェクトにない場合も外部キーとして残す（build で警告になる）
+		toTable, toColumn, colType := tables[ref.target], ref.toColumn, ""
+		if target := s.lookup(toTable); target != nil {
+			if toColumn == "" && len(target.PrimaryKey) == 1 {
+				toColumn = target.PrimaryKey[0]
+			}
+			if pk := target.column(toColumn); pk != nil {
+				colType = pk.Type
+			}
+			toTable = target.Name
+		}
+		e := s.lookup(table)
+		if e == nil {
+			e = s.entity(table, origin, ref.source)
+		}
+		col := e.setColumn(SchemaColumn{Name: ref.column, Type: colType, Nullable: !ref.joinKey, Unique: ref.unique})
+		if col.Type == "" {
+			col.Type = colType
+		}
+		if ref.joinKey {
+			e.addPrimaryKey(col.Name)
+		}
+		fk := SchemaRelationship{FromTable: e.Name, FromColumns: []string{col.Name}, ToTable: toTable, Source: ref.source}
+		if toColumn != "" {
+			fk.ToColumns = []string{toColumn}
+		}
+		s.addForeignKey(fk)
+	}
+}
+
+// callArguments s[open] の括弧に対応する閉じ括弧までの中身と、閉じ括弧の次の位置を返す（引用符の中の括弧は数えない）
+func callArguments(s string, open int) (string, int) {
+	closing := map[byte]byte{'(': ')', '[': ']', '{': '}'}[s[open]]
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\'':
+			i = scanQuoted(s, i, c, false, true) - 1
+		case c == s[open]:
+			depth++
+		case c == closing:
+			if depth--; depth == 0 {
+				return s[open+1 : i], i + 1
+			}
+		}
+	}
+	return s[open+1:], len(s)
+}
+
+// splitCallArgs 括弧と引用符の外にある , で区切る（空の要素は除く）
+func splitCallArgs(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	add := func(part string) {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\'':
+			i = scanQuoted(s, i, c, false, true) - 1
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				add(s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	add(s[start:])
+	return parts
+}
+
+// keywordArgRe name=value 形式の引数（== は除く）
+var keywordArgRe = regexp.MustCompile(`^(\w+)\s*=\s*([^=][\s\S]*)$`)
+
+// parseCallArgs 引数を位置引数とキーワード引数（name=value）に分ける
+func parseCallArgs(s string) ([]string, map[string]string) {
+	var positional []string
+	keywords := make(map[string]string)
+	for _, arg := range splitCallArgs(s) {
+		if m := keywordArgRe.FindStringSubmatch(arg); m != nil {
+			keywords[m[1]] = strings.TrimSpace(m[2])
+		} else {
+			positional = append(positional, arg)
+		}
+	}
+	return positional, keywords
+}
+
+// unquoteLiteral 引用符で囲まれた文字列リテラルならその中身を返す（Python の r・b 接頭辞、Ruby のシンボルも外す）
+func unquoteLiteral(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > 2 && strings.IndexByte("rbuRBU", s[0]) >= 0 && (s[1] == '"' || s[1] == '\'') {
+		s = s[1:]
+	}
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return strings.TrimPrefix(s, ":")
+}
+
+// lineAt ソースの位置の行番号
+func lineAt(content string, offset int) int {
+	return strings.Count(content[:offset], "\n") + 1
+}
+
+// schemaSource 定義元のファイル:行
+func schemaSource(file *models.File, line int) string {
+	if line <= 0 {
+		return file.Name
+	}
+	return fmt.Sprintf("%s:%d", file.Name, line)
+}
+
+// runSchemaRecovery SQL の DDL・マイグレーション・ORM のモデル定義からスキーマを復元する
+func (w *AnalysisWorker) runSchemaRecovery(files []models.File) (string, error) {
+	model := RecoverSchema(files)
+	if len(model.Entities) == 0 {
+		return "", fmt.Errorf("no table definitions found in project")
+	}
+	origins := make(map[string]int)
+	for _, e := range model.Entities {
+		for _, origin := range e.Origins {
+			origins[origin]++
+		}
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"schema": model,
+		"summary": map[string]interface{}{
+			"entities":              len(model.Entities),
+			"relationships":         len(model.Relationships),
+			"inferred_foreign_keys": len(model.InferredForeignKeys),
+			"origins":               origins,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// RecoverSchema プロジェクトのファイルからスキーマを復元する
+// マイグレーションはファイル名の順に適用し、その後に ORM のモデル定義と単独の DDL を重ねる
+func RecoverSchema(files []models.File) *SchemaModel {
+	s := newSchemaBuilder()
+	var migrations, others []*models.File
+	for i := range files {
+		file := &files[i]
+		if file.Content == "" {
+			continue
+		}
+		if isMigrationFile(file.Name) {
+			migrations = append(migrations, file)
+		} else {
+			others = append(others, file)
+		}
+	}
+	sort.SliceStable(migrations, func(i, j int) bool { return migrations[i].Name < migrations[j].Name })
+
+	for _, file := range migrations {
+		switch {
+		case file.Language == "sql":
+			if !isDownMigration(file.Name) {
+				parseSQLSchema(s, file, "migration")
+			}
+		case file.Language == "ruby":
+			parseRailsMigration(s, file)
+		case file.Language == "python" && strings.Contains(file.Content, "migrations."):
+			parseDjangoMigration(s, file)
+		case file.Language == "python" && strings.Contains(file.Content, "op."):
+			parseAlembicMigration(s, file)
+		}
+	}
+
+	// ORM のモデルは別ファイルのクラスを参照するので、言語ごとにまとめて読む
+	var goFiles, pythonFiles, jvmFiles []*models.File
+	for _, file := range others {
+		switch file.Language {
+		case "sql":
+			parseSQLSchema(s, file, "sql")
+		case "ruby":
+			// Rails の db/schema.rb はマイグレーションと同じ書き方
+			if strings.HasSuffix(file.Name, "schema.rb") {
+				parseRailsMigration(s, file)
+			}
+		case "go":
+			goFiles = append(goFiles, file)
+		case "python":
+			pythonFiles = append(pythonFiles, file)
+		case "java", "kotlin":
+			jvmFiles = append(jvmFiles, file)
+		}
+	}
+	parseGormModels(s, goFiles)
+	parseDjangoModels(s, pythonFiles)
+	parseJPAEntities(s, jvmFiles)
+	return s.build()
+}
+
+// isMigrationFile マイグレーションのフォルダ（migrations/、db/migrate/、alembic/versions/ など）にあるファイル
+func isMigrationFile(name string) bool {
+	lower := "/" + strings.ToLower(name)
+	for _, dir := range []string{"/migrations/", "/migration/", "/migrate/", "/versions/", "/flyway/", "/changelog/"} {
+		if strings.Contains(lower, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDownMigration 取り消し用のマイグレーション（001_x.down.sql、U001__x.sql など）
+func isDownMigration(name string) bool {
+	lower := strings.ToLower(name[strings.LastIndex(name, "/")+1:])
+	return strings.Contains(lower, ".down.") || strings.HasSuffix(lower, "_down.sql") || strings.HasPrefix(lower, "u") && strings.Contains(lower, "__")
+}
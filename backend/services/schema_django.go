@@ -0,0 +1,470 @@
+package services
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// djangoFieldTypes Django のフィールドの列の型（CharField・DecimalField は引数から長さを付ける）
+var djangoFieldTypes = map[string]string{
+	"AutoField": "integer", "BigAutoField": "bigint", "SmallAutoField": "smallint",
+	"IntegerField": "integer", "BigIntegerField": "bigint", "SmallIntegerField": "smallint",
+	"PositiveIntegerField": "integer", "PositiveBigIntegerField": "bigint", "PositiveSmallIntegerField": "smallint",
+	"BooleanField": "boolean", "NullBooleanField": "boolean",
+	"CharField": "varchar", "SlugField": "varchar(50)", "EmailField": "varchar(254)", "URLField": "varchar(200)",
+	"FileField": "varchar(100)", "ImageField": "varchar(100)", "FilePathField": "varchar(100)",
+	"TextField": "text", "DateTimeField": "timestamp", "DateField": "date", "TimeField": "time", "DurationField": "interval",
+	"DecimalField": "decimal", "FloatField": "double", "UUIDField": "uuid", "JSONField": "json", "BinaryField": "binary",
+	"GenericIPAddressField": "inet", "IPAddressField": "inet",
+}
+
+var (
+	djangoClassRe   = regexp.MustCompile(`(?m)^([ \t]*)class[ \t]+(\w+)[ \t]*\(([^)]*)\)[ \t]*:`)
+	djangoFieldRe   = regexp.MustCompile(`(?m)^[ \t]+(\w+)[ \t]*=[ \t]*(?:[\w.]+\.)?(\w+(?:Field|Key))[ \t]*\(`)
+	djangoCallRe    = regexp.MustCompile(`^\s*(?:[\w.]+\.)?(\w+)\s*\(`)
+	djangoMetaRe    = regexp.MustCompile(`(?m)^([ \t]+)class[ \t]+Meta\b[^:]*:`)
+	djangoOptionRe  = regexp.MustCompile(`(?m)^[ \t]+(db_table|app_label|abstract)[ \t]*=[ \t]*([^\n]+)`)
+	djangoOpRe      = regexp.MustCompile(`migrations\.(CreateModel|AddField|AlterField|RemoveField|DeleteModel|RenameModel|RenameField|AlterModelTable)\s*\(`)
+	djangoDictKeyRe = regexp.MustCompile(`['"](db_table|abstract)['"]\s*:\s*([^,}]+)`)
+)
+
+// djangoClass モデルのクラス定義
+type djangoClass struct {
+	name     string
+	bases    []string
+	app      string
+	body     string
+	offset   int // body のファイル内の位置
+	file     *models.File
+	text     string
+	line     int
+	table    string
+	abstract bool
+	model    bool
+}
+
+// djangoColumn フィールドの定義から列を作る。関連フィールドでは参照先（'app.Model'、Model など）も返す
+func djangoColumn(name, call string) (SchemaColumn, string, string, map[string]string) {
+	m := djangoCallRe.FindStringSubmatchIndex(call)
+	if m == nil {
+		return SchemaColumn{}, "", "", nil
+	}
+	kind := call[m[2]:m[3]]
+	inner, _ := callArguments(call, m[1]-1)
+	args, kwargs := parseCallArgs(inner)
+
+	col := SchemaColumn{
+		Name:       name,
+		RawType:    kind,
+		Nullable:   kwargs["null"] == "True",
+		PrimaryKey: kwargs["primary_key"] == "True",
+		Unique:     kwargs["unique"] == "True",
+	}
+	if def, ok := kwargs["default"]; ok {
+		col.Default = unquoteLiteral(def)
+	}
+	target := ""
+	switch kind {
+	case "ForeignKey", "OneToOneField", "ManyToManyField":
+		target = kwargs["to"]
+		if target == "" && len(args) > 0 {
+			target = args[0]
+		}
+		if target == "settings.AUTH_USER_MODEL" {
+			target = "auth.User"
+		}
+		target = unquoteLiteral(target)
+		if kind != "ManyToManyField" {
+			col.Name = name + "_id"
+			col.Unique = col.Unique || kind == "OneToOneField"
+		}
+	default:
+		col.Type = djangoFieldTypes[kind]
+		if col.Type == "" {
+			col.Type = strings.ToLower(strings.TrimSuffix(kind, "Field"))
+		}
+		switch kind {
+		case "CharField":
+			if length := kwargs["max_length"]; length != "" {
+				col.Type += "(" + length + ")"
+			}
+		case "DecimalField":
+			if kwargs["max_digits"] != "" && kwargs["decimal_places"] != "" {
+				col.Type += "(" + kwargs["max_digits"] + "," + kwargs["decimal_places"] + ")"
+			}
+		}
+	}
+	if column := unquoteLiteral(kwargs["db_column"]); column != "" {
+		col.Name = column
+	}
+	if col.PrimaryKey {
+		col.Nullable = false
+	}
+	return col, kind, target, kwargs
+}
+
+// djangoAppLabel ファイルの場所からアプリ名を決める（shop/models.py、shop/models/order.py、shop/migrations/0001_x.py → shop）
+func djangoAppLabel(name string) string {
+	dir := path.Dir(strings.ReplaceAll(name, `\`, "/"))
+	for _, sub := range []string{"models", "migrations"} {
+		if path.Base(dir) == sub {
+			dir = path.Dir(dir)
+		}
+	}
+	return strings.ToLower(path.Base(dir))
+}
+
+// djangoTableName app_label の小文字 + _ + モデル名の小文字（Django の既定のテーブル名）
+func djangoTableName(app, model string) string {
+	if i := strings.IndexByte(model, '.'); i >= 0 {
+		app, model = model[:i], model[i+1:]
+	}
+	if app == "" || app == "." {
+		return strings.ToLower(model)
+	}
+	return strings.ToLower(app) + "_" + strings.ToLower(model)
+}
+
+// parseDjangoModels Django のモデル（models.Model を継承したクラス）を読む
+// 抽象モデルのフィールドは子に引き継ぎ、抽象でない親を持つモデルには <親>_ptr_id を主キーとして付ける
+func parseDjangoModels(s *schemaBuilder, files []*models.File) {
+	classes := make(map[string]*djangoClass)
+	var order []*djangoClass
+	for _, file := range files {
+		if !strings.Contains(file.Content, "models") {
+			continue
+		}
+		text := StripComments("python", file.Content)
+		django := strings.Contains(text, "django")
+		matches := djangoClassRe.FindAllStringSubmatchIndex(text, -1)
+		for _, m := range matches {
+			indent := len(text[m[2]:m[3]])
+			start := m[1]
+			end := len(text)
+			// クラスの本体はインデントがクラス行より深い行まで
+			for pos := start; pos < len(text); {
+				next := strings.IndexByte(text[pos:], '\n')
+				if next < 0 {
+					break
+				}
+				pos += next + 1
+				line := text[pos:]
+				if nl := strings.IndexByte(line, '\n'); nl >= 0 {
+					line = line[:nl]
+				}
+				if strings.TrimSpace(line) != "" && len(line)-len(strings.TrimLeft(line, " \t")) <= indent {
+					end = pos
+					break
+				}
+			}
+			c := &djangoClass{
+				name:   text[m[4]:m[5]],
+				app:    djangoAppLabel(file.Name),
+				body:   text[start:end],
+				offset: start,
+				file:   file,
+				text:   text,
+				line:   lineAt(text, m[0]),
+			}
+			for _, base := range strings.Split(text[m[6]:m[7]], ",") {
+				base = strings.TrimSpace(base)
+				c.bases = append(c.bases, base)
+				if django && (base == "models.Model" || base == "Model") {
+					c.model = true
+				}
+			}
+			if meta := djangoMetaRe.FindStringIndex(c.body); meta != nil {
+				for _, opt := range djangoOptionRe.FindAllStringSubmatch(c.body[meta[1]:], -1) {
+					value := strings.TrimSpace(opt[2])
+					switch opt[1] {
+					case "db_table":
+						c.table = unquoteLiteral(value)
+					case "app_label":
+						c.app = unquoteLiteral(value)
+					case "abstract":
+						c.abstract = value == "True"
+					}
+				}
+				c.body = c.body[:meta[0]] + strings.Repeat(" ", len(c.body)-meta[0])
+			}
+			if _, exists := classes[c.name]; !exists {
+				classes[c.name] = c
+				order = append(order, c)
+			}
+		}
+	}
+
+	// プロジェクト内のモデルを継承したクラスもモデル
+	for changed := true; changed; {
+		changed = false
+		for _, c := range order {
+			for _, base := range c.bases {
+				if parent := classes[lastPathElement(base)]; parent != nil && parent.model && !c.model {
+					c.model, changed = true, true
+				}
+			}
+		}
+	}
+
+	tables := make(map[string]string)
+	for _, c := range order {
+		if c.model && !c.abstract {
+			if c.table == "" {
+				c.table = djangoTableName(c.app, c.name)
+			}
+			tables[c.name] = c.table
+			tables[c.app+"."+c.name] = c.table
+		}
+	}
+
+	var refs []ormReference
+	for _, c := range order {
+		if !c.model || c.abstract {
+			continue
+		}
+		e := s.entity(c.table, "django", schemaSource(c.file, c.line))
+		var parentPtr *djangoClass
+		var chain []*djangoClass
+		var collect func(c *djangoClass, depth int)
+		collect = func(k *djangoClass, depth int) {
+			for _, base := range k.bases {
+				parent := classes[lastPathElement(base)]
+				if parent == nil || !parent.model || depth > 8 {
+					continue
+				}
+				if parent.abstract {
+					collect(parent, depth+1)
+					chain = append(chain, parent)
+				} else if parentPtr == nil && k == c {
+					parentPtr = parent
+				}
+			}
+		}
+		collect(c, 0)
+		chain = append(chain, c)
+
+		hasPK := false
+		for _, k := range chain {
+			for _, m := range djangoFieldRe.FindAllStringSubmatchIndex(k.body, -1) {
+				call := k.body[m[4]:]
+				if col, _, _, _ := djangoColumn(k.body[m[2]:m[3]], call); col.PrimaryKey {
+					hasPK = true
+				}
+			}
+		}
+		if parentPtr != nil {
+			column := strings.ToLower(parentPtr.name) + "_ptr_id"
+			e.setColumn(SchemaColumn{Name: column, PrimaryKey: true, Unique: true})
+			refs = append(refs, ormReference{table: c.table, column: column, target: parentPtr.name, unique: true, source: schemaSource(c.file, c.line)})
+		} else if !hasPK {
+			e.setColumn(SchemaColumn{Name: "id", Type: "bigint", RawType: "BigAutoField", PrimaryKey: true})
+		}
+
+		for _, k := range chain {
+			for _, m := range djangoFieldRe.FindAllStringSubmatchIndex(k.body, -1) {
+				name := k.body[m[2]:m[3]]
+				col, kind, target, kwargs := djangoColumn(name, k.body[m[4]:])
+				source := schemaSource(k.file, lineAt(k.text, k.offset+m[0]))
+				if target == "self" {
+					target = c.name
+				}
+				if target != "" && !strings.Contains(target, ".") {
+					if _, ok := tables[target]; !ok && target == "User" {
+						// django.contrib.auth の User
+						target = "auth.User"
+						tables[target] = "auth_user"
+					}
+				} else if target != "" {
+					// 'app.Model' はプロジェクト内のクラスがあればそのテーブル、なければ既定の名前
+					if _, ok := tables[target]; !ok {
+						if cls := classes[lastPathElement(target)]; cls != nil && cls.table != "" {
+							target = cls.name
+						} else {
+							tables[target] = djangoTableName("", target)
+						}
+					}
+				}
+				switch kind {
+				case "ManyToManyField":
+					if kwargs["through"] != "" {
+						continue
+					}
+					join := unquoteLiteral(kwargs["db_table"])
+					if join == "" {
+						join = c.table + "_" + name
+					}
+					left := strings.ToLower(c.name) + "_id"
+					right := strings.ToLower(lastPathElement(target)) + "_id"
+					if left == right {
+						left, right = "from_"+left, "to_"+right
+					}
+					s.entity(join, "django", source)
+					refs = append(refs,
+						ormReference{table: join, column: left, target: c.name, joinKey: true, source: source},
+						ormReference{table: join, column: right, target: target, joinKey: true, source: source})
+				case "ForeignKey", "OneToOneField":
+					// 列の型は参照先の主キーに合わせるので、ここでは決めない
+					col.RawType = ""
+					e.setColumn(col).RawType = kind
+					refs = append(refs, ormReference{table: c.table, column: col.Name, target: target, unique: col.Unique, source: source})
+				default:
+					e.setColumn(col)
+				}
+			}
+		}
+	}
+	resolveORMReferences(s, refs, tables, "django")
+	fillUnresolvedKeyTypes(s, "django", "bigint")
+}
+
+// fillUnresolvedKeyTypes 参照先が見つからず型が決まらなかった外部キー列に既定の型を入れる
+func fillUnresolvedKeyTypes(s *schemaBuilder, origin, typ string) {
+	for _, key := range s.order {
+		e := s.entities[key]
+		if !containsString(e.Origins, origin) {
+			continue
+		}
+		for i := range e.Columns {
+			if e.Columns[i].Type == "" {
+				e.Columns[i].Type = typ
+			}
+		}
+	}
+}
+
+// djangoPrimaryKey マイグレーションで参照するテーブルの主キーと型（まだ作られていなければ Django の既定の id bigint）
+func djangoPrimaryKey(s *schemaBuilder, table string) (string, string) {
+	name, typ := "id", "bigint"
+	if t := s.lookup(table); t != nil && len(t.PrimaryKey) == 1 {
+		name = t.PrimaryKey[0]
+		if pk := t.column(name); pk != nil && pk.Type != "" {
+			typ = pk.Type
+		}
+	}
+	return name, typ
+}
+
+// parseDjangoMigration Django のマイグレーション（CreateModel・AddField・RemoveField など）を適用する
+func parseDjangoMigration(s *schemaBuilder, file *models.File) {
+	text := StripComments("python", file.Content)
+	app := djangoAppLabel(file.Name)
+	table := func(model string) string {
+		model = unquoteLiteral(model)
+		if e := s.lookup(djangoTableName(app, model)); e != nil {
+			return e.Name
+		}
+		return djangoTableName(app, model)
+	}
+	// 関連フィールドの列と外部キーを追加する（参照先は 'app.model' の形）
+	addField := func(e *SchemaEntity, name, call, source string) {
+		col, kind, target, kwargs := djangoColumn(name, call)
+		if kind == "" {
+			return
+		}
+		if target != "" {
+			if !strings.Contains(target, ".") {
+				target = app + "." + target
+			}
+			if strings.EqualFold(lastPathElement(target), "self") {
+				target = e.Name
+			} else {
+				target = djangoTableName("", target)
+			}
+		}
+		targetPK, targetType := djangoPrimaryKey(s, target)
+		switch kind {
+		case "ManyToManyField":
+			if kwargs["through"] != "" {
+				return
+			}
+			model := e.Name[strings.IndexByte(e.Name, '_')+1:]
+			join := s.entity(e.Name+"_"+name, "migration", source)
+			left, right := model+"_id", target[strings.IndexByte(target, '_')+1:]+"_id"
+			if left == right {
+				left, right = "from_"+left, "to_"+right
+			}
+			for _, ref := range [][2]string{{left, e.Name}, {right, target}} {
+				_, typ := djangoPrimaryKey(s, ref[1])
+				join.setColumn(SchemaColumn{Name: ref[0], Type: typ})
+				join.addPrimaryKey(ref[0])
+				s.addForeignKey(SchemaRelationship{FromTable: join.Name, FromColumns: []string{ref[0]}, ToTable: ref[1], Source: source})
+			}
+		case "ForeignKey", "OneToOneField":
+			col.Type = targetType
+			e.setColumn(col)
+			s.addForeignKey(SchemaRelationship{FromTable: e.Name, FromColumns: []string{col.Name}, ToTable: target, ToColumns: []string{targetPK}, Source: source})
+		default:
+			e.setColumn(col)
+		}
+	}
+
+	for _, m := range djangoOpRe.FindAllStringSubmatchIndex(text, -1) {
+		inner, _ := callArguments(text, m[1]-1)
+		_, kwargs := parseCallArgs(inner)
+		source := schemaSource(file, lineAt(text, m[0]))
+		switch text[m[2]:m[3]] {
+		case "CreateModel":
+			name := table(kwargs["name"])
+			if options := kwargs["options"]; options != "" {
+				for _, opt := range djangoDictKeyRe.FindAllStringSubmatch(options, -1) {
+					if opt[1] == "db_table" {
+						name = unquoteLiteral(opt[2])
+					} else if strings.TrimSpace(opt[2]) == "True" {
+						name = ""
+					}
+				}
+			}
+			if name == "" {
+				continue
+			}
+			e := s.entity(name, "migration", source)
+			fields := strings.TrimSpace(kwargs["fields"])
+			if fields == "" || (fields[0] != '[' && fields[0] != '(') {
+				continue
+			}
+			list, _ := callArguments(fields, 0)
+			for _, tuple := range splitCallArgs(list) {
+				if tuple[0] != '(' {
+					continue
+				}
+				pair, _ := callArguments(tuple, 0)
+				if parts := splitCallArgs(pair); len(parts) == 2 {
+					addField(e, unquoteLiteral(parts[0]), parts[1], source)
+				}
+			}
+		case "AddField", "AlterField":
+			e := s.lookup(table(kwargs["model_name"]))
+			if e == nil {
+				e = s.entity(table(kwargs["model_name"]), "migration", source)
+			}
+			addField(e, unquoteLiteral(kwargs["name"]), kwargs["field"], source)
+		case "RemoveField":
+			if e := s.lookup(table(kwargs["model_name"])); e != nil {
+				name := unquoteLiteral(kwargs["name"])
+				if e.column(name) == nil {
+					name += "_id"
+				}
+				e.dropColumn(name)
+			}
+		case "DeleteModel":
+			s.dropEntity(table(kwargs["name"]))
+		case "RenameModel":
+			s.renameEntity(table(kwargs["old_name"]), djangoTableName(app, unquoteLiteral(kwargs["new_name"])))
+		case "RenameField":
+			if e := s.lookup(table(kwargs["model_name"])); e != nil {
+				from, to := unquoteLiteral(kwargs["old_name"]), unquoteLiteral(kwargs["new_name"])
+				if e.column(from) == nil {
+					from, to = from+"_id", to+"_id"
+				}
+				s.renameColumn(e, from, to)
+			}
+		case "AlterModelTable":
+			if to := unquoteLiteral(kwargs["table"]); to != "" && to != "None" {
+				s.renameEntity(table(kwargs["name"]), to)
+			}
+		}
+	}
+}
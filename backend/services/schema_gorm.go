@@ -0,0 +1,410 @@
+package services
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// goColumnTypes GORM が Go の型に割り当てる列の型（PostgreSQL の場合）
+var goColumnTypes = map[string]string{
+	"int": "bigint", "int64": "bigint", "uint": "bigint", "uint64": "bigint",
+	"int32": "integer", "uint32": "integer", "rune": "integer",
+	"int16": "smallint", "uint16": "smallint", "int8": "smallint", "uint8": "smallint", "byte": "smallint",
+	"string": "text", "bool": "boolean", "float32": "float", "float64": "double", "[]byte": "binary",
+	"time.Time": "timestamp", "gorm.DeletedAt": "timestamp", "sql.NullTime": "timestamp",
+	"sql.NullString": "text", "sql.NullInt64": "bigint", "sql.NullInt32": "integer", "sql.NullInt16": "smallint",
+	"sql.NullBool": "boolean", "sql.NullFloat64": "double",
+	"datatypes.JSON": "json", "datatypes.Date": "date", "datatypes.Time": "time", "json.RawMessage": "json",
+	"uuid.UUID": "uuid", "decimal.Decimal": "decimal", "pq.StringArray": "text[]", "pq.Int64Array": "bigint[]",
+}
+
+// gormStruct プロジェクト内の構造体の定義
+type gormStruct struct {
+	name   string
+	file   *models.File
+	line   int
+	fields []*ast.Field
+	table  string
+	model  bool
+	gorm   string // gorm パッケージの参照名
+}
+
+// gormParser GORM のモデルを全ファイル分まとめて読む
+type gormParser struct {
+	fset    *token.FileSet
+	structs map[string]*gormStruct
+	order   []*gormStruct
+	basics  map[string]string            // type Status string のような基本型の別名
+	columns map[string]map[string]string // 構造体 → フィールド名 → 列名
+}
+
+// parseGormModels GORM のモデル（gorm タグ・gorm.Model の埋め込み・AutoMigrate・TableName のいずれかがある構造体）を読む
+func parseGormModels(s *schemaBuilder, files []*models.File) {
+	g := &gormParser{
+		fset:    token.NewFileSet(),
+		structs: make(map[string]*gormStruct),
+		basics:  make(map[string]string),
+		columns: make(map[string]map[string]string),
+	}
+	migrated := make(map[string]bool)
+	tableNames := make(map[string]string)
+	for _, file := range files {
+		if !strings.Contains(file.Content, "gorm") {
+			continue
+		}
+		f, err := parser.ParseFile(g.fset, file.Name, file.Content, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		g.collect(file, f, migrated, tableNames)
+	}
+
+	for _, st := range g.order {
+		if name, ok := tableNames[st.name]; ok {
+			st.table = name
+		}
+		st.model = st.model || migrated[st.name] || tableNames[st.name] != ""
+	}
+	// モデルから関連として参照され、ID を持つ構造体もモデルとして扱う
+	for changed := true; changed; {
+		changed = false
+		for _, st := range g.order {
+			if !st.model {
+				continue
+			}
+			for _, field := range st.fields {
+				name, _ := gormFieldType(field.Type)
+				if target := g.structs[lastPathElement(name)]; target != nil && !target.model && target.hasField("ID") {
+					target.model, changed = true, true
+				}
+			}
+		}
+	}
+
+	tables := make(map[string]string)
+	var refs []ormReference
+	for _, st := range g.order {
+		if !st.model {
+			continue
+		}
+		if st.table == "" {
+			st.table = pluralizeTableName(snakeCase(st.name))
+		}
+		tables[st.name] = st.table
+		e := s.entity(st.table, "gorm", schemaSource(st.file, st.line))
+		g.columns[st.name] = make(map[string]string)
+		g.addColumns(e, st, st, "", 0)
+		if len(e.PrimaryKey) == 0 && e.column("id") != nil {
+			e.addPrimaryKey("id")
+		}
+	}
+	for _, st := range g.order {
+		if st.model {
+			refs = append(refs, g.references(st)...)
+		}
+	}
+	resolveORMReferences(s, refs, tables, "gorm")
+}
+
+// collect 構造体・基本型の別名・TableName メソッド・AutoMigrate の引数を集める
+func (g *gormParser) collect(file *models.File, f *ast.File, migrated map[string]bool, tableNames map[string]string) {
+	alias := ""
+	for _, imp := range f.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		if path == "gorm.io/gorm" || path == "github.com/jinzhu/gorm" {
+			alias = "gorm"
+			if imp.Name != nil {
+				alias = imp.Name.Name
+			}
+		}
+	}
+
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				ts := spec.(*ast.TypeSpec)
+				switch t := ts.Type.(type) {
+				case *ast.StructType:
+					if _, exists := g.structs[ts.Name.Name]; exists {
+						continue
+					}
+					st := &gormStruct{name: ts.Name.Name, file: file, line: g.fset.Position(ts.Pos()).Line, fields: t.Fields.List, gorm: alias}
+					for _, field := range t.Fields.List {
+						if field.Tag != nil && strings.Contains(field.Tag.Value, "gorm:") {
+							st.model = true
+						}
+						if len(field.Names) == 0 && alias != "" && types.ExprString(field.Type) == alias+".Model" {
+							st.model = true
+						}
+					}
+					g.structs[st.name] = st
+					g.order = append(g.order, st)
+				case *ast.Ident:
+					if typ, ok := goColumnTypes[t.Name]; ok {
+						g.basics[ts.Name.Name] = typ
+					}
+				}
+			}
+		case *ast.FuncDecl:
+			if d.Name.Name != "TableName" || d.Recv == nil || len(d.Recv.List) != 1 || d.Body == nil || len(d.Body.List) != 1 {
+				continue
+			}
+			recv, _ := gormFieldType(d.Recv.List[0].Type)
+			if ret, ok := d.Body.List[0].(*ast.ReturnStmt); ok && len(ret.Results) == 1 {
+				if lit, ok := ret.Results[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					if name, err := strconv.Unquote(lit.Value); err == nil {
+						tableNames[recv] = name
+					}
+				}
+			}
+		}
+	}
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "AutoMigrate" {
+			return true
+		}
+		for _, arg := range call.Args {
+			if u, ok := arg.(*ast.UnaryExpr); ok {
+				arg = u.X
+			}
+			switch a := arg.(type) {
+			case *ast.CompositeLit:
+				name, _ := gormFieldType(a.Type)
+				migrated[lastPathElement(name)] = true
+			case *ast.CallExpr:
+				if fn, ok := a.Fun.(*ast.Ident); ok && fn.Name == "new" && len(a.Args) == 1 {
+					name, _ := gormFieldType(a.Args[0])
+					migrated[lastPathElement(name)] = true
+				}
+			}
+		}
+		return true
+	})
+}
+
+func (st *gormStruct) hasField(name string) bool {
+	for _, field := range st.fields {
+		for _, ident := range field.Names {
+			if ident.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// gormFieldType フィールドの型名（ポインタを外した名前）とスライスかどうか
+func gormFieldType(expr ast.Expr) (string, bool) {
+	slice := false
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.ArrayType:
+			if t.Len == nil {
+				if elt := types.ExprString(t.Elt); elt == "byte" || elt == "uint8" {
+					return "[]byte", false
+				}
+				slice = true
+			}
+			expr = t.Elt
+		default:
+			return types.ExprString(expr), slice
+		}
+	}
+}
+
+// gormTagSettings gorm タグを GORM と同じ規則（; 区切り、キーは大文字）で読む
+func gormTagSettings(field *ast.Field) map[string]string {
+	settings := make(map[string]string)
+	if field.Tag == nil {
+		return settings
+	}
+	raw, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return settings
+	}
+	for _, part := range strings.Split(reflect.StructTag(raw).Get("gorm"), ";") {
+		key, value, _ := strings.Cut(part, ":")
+		key = strings.ToUpper(strings.TrimSpace(key))
+		if key != "" {
+			settings[key] = strings.TrimSpace(value)
+		}
+	}
+	return settings
+}
+
+// addColumns 構造体のフィールドを列として追加する。埋め込み（gorm.Model・embedded タグ）は展開する
+func (g *gormParser) addColumns(e *SchemaEntity, owner, st *gormStruct, prefix string, depth int) {
+	if depth > 4 {
+		return
+	}
+	uniqueIndexes := make(map[string]int)
+	for _, field := range st.fields {
+		if name := gormTagSettings(field)["UNIQUEINDEX"]; name != "" {
+			uniqueIndexes[name]++
+		}
+	}
+
+	for _, field := range st.fields {
+		settings := gormTagSettings(field)
+		if _, ignored := settings["-"]; ignored {
+			continue
+		}
+		typeName, slice := gormFieldType(field.Type)
+		if _, embedded := settings["EMBEDDED"]; len(field.Names) == 0 || embedded {
+			if st.gorm != "" && typeName == st.gorm+".Model" {
+				e.setColumn(SchemaColumn{Name: prefix + "id", Type: "bigint", RawType: "uint"})
+				e.addPrimaryKey(prefix + "id")
+				e.setColumn(SchemaColumn{Name: prefix + "created_at", Type: "timestamp", RawType: "time.Time", Nullable: true})
+				e.setColumn(SchemaColumn{Name: prefix + "updated_at", Type: "timestamp", RawType: "time.Time", Nullable: true})
+				e.setColumn(SchemaColumn{Name: prefix + "deleted_at", Type: "timestamp", RawType: "gorm.DeletedAt", Nullable: true})
+				for _, name := range []string{"ID", "CreatedAt", "UpdatedAt", "DeletedAt"} {
+					g.columns[owner.name][name] = prefix + snakeCase(name)
+				}
+			} else if embedded := g.structs[lastPathElement(typeName)]; embedded != nil && !slice {
+				g.addColumns(e, owner, embedded, prefix+settings["EMBEDDEDPREFIX"], depth+1)
+			}
+			continue
+		}
+
+		colType := goColumnTypes[typeName]
+		if colType == "" {
+			colType = g.basics[typeName]
+		}
+		if settings["TYPE"] == "" && (colType == "" || slice) {
+			// 関連・対応する型のないフィールドは列にならない
+			continue
+		}
+		raw := typeName
+		if slice {
+			raw = "[]" + typeName
+		}
+		if settings["TYPE"] != "" {
+			raw, colType = settings["TYPE"], normalizeColumnType(settings["TYPE"])
+		} else if size := settings["SIZE"]; size != "" && colType == "text" {
+			colType = "varchar(" + size + ")"
+		}
+
+		pk := hasSetting(settings, "PRIMARYKEY") || hasSetting(settings, "PRIMARY_KEY")
+		unique := hasSetting(settings, "UNIQUE")
+		if _, ok := settings["UNIQUEINDEX"]; ok && uniqueIndexes[settings["UNIQUEINDEX"]] <= 1 {
+			unique = true
+		}
+		nullable := !pk && !hasSetting(settings, "NOT NULL")
+		if strings.HasPrefix(typeName, "sql.Null") || typeName == "gorm.DeletedAt" {
+			nullable = true
+		}
+
+		for _, ident := range field.Names {
+			if !ident.IsExported() {
+				continue
+			}
+			name := settings["COLUMN"]
+			if name == "" {
+				name = snakeCase(ident.Name)
+			}
+			name = prefix + name
+			g.columns[owner.name][ident.Name] = name
+			e.setColumn(SchemaColumn{Name: name, Type: colType, RawType: raw, Nullable: nullable, PrimaryKey: pk, Unique: unique, Default: settings["DEFAULT"]})
+		}
+	}
+}
+
+// hasSetting 値のない設定（primaryKey、not null など）があるか
+func hasSetting(settings map[string]string, key string) bool {
+	value, ok := settings[key]
+	return ok && (value == "" || strings.EqualFold(value, "true"))
+}
+
+// columnOf 構造体のフィールドの列名（読んでいなければ GORM の命名規則で決める）
+func (g *gormParser) columnOf(structName, field string) string {
+	if name, ok := g.columns[structName][field]; ok {
+		return name
+	}
+	return snakeCase(field)
+}
+
+// references 関連のフィールドから外部キーを作る
+// belongs-to（自分が外部キーを持つ）、has-one・has-many（相手が持つ）、many2many（中間テーブル）を区別する
+func (g *gormParser) references(st *gormStruct) []ormReference {
+	var refs []ormReference
+	for _, field := range st.fields {
+		if len(field.Names) == 0 {
+			continue
+		}
+		settings := gormTagSettings(field)
+		if _, ignored := settings["-"]; ignored || settings["POLYMORPHIC"] != "" {
+			continue
+		}
+		typeName, slice := gormFieldType(field.Type)
+		target := g.structs[lastPathElement(typeName)]
+		if target == nil || !target.model || goColumnTypes[typeName] != "" {
+			continue
+		}
+		fieldName := field.Names[0].Name
+		source := schemaSource(st.file, g.fset.Position(field.Pos()).Line)
+		toColumn := func(structName string) string {
+			if ref := settings["REFERENCES"]; ref != "" {
+				return g.columnOf(structName, ref)
+			}
+			return ""
+		}
+
+		switch {
+		case slice && settings["MANY2MANY"] != "":
+			join := settings["MANY2MANY"]
+			left := snakeCase(st.name) + "_id"
+			if fk := settings["JOINFOREIGNKEY"]; fk != "" {
+				left = snakeCase(fk)
+			}
+			right := snakeCase(target.name) + "_id"
+			if ref := settings["JOINREFERENCES"]; ref != "" {
+				right = snakeCase(ref)
+			} else if right == left {
+				right = snakeCase(strings.TrimSuffix(fieldName, "s")) + "_id"
+			}
+			refs = append(refs,
+				ormReference{table: join, column: left, target: st.name, joinKey: true, source: source},
+				ormReference{table: join, column: right, target: target.name, joinKey: true, source: source})
+		case slice:
+			fk := settings["FOREIGNKEY"]
+			if fk == "" {
+				fk = st.name + "ID"
+			}
+			refs = append(refs, ormReference{owner: target.name, column: g.columnOf(target.name, fk), target: st.name, toColumn: toColumn(st.name), source: source})
+		default:
+			fk := settings["FOREIGNKEY"]
+			candidate := fk
+			if candidate == "" {
+				candidate = fieldName + "ID"
+			}
+			if column, ok := g.columns[st.name][candidate]; ok {
+				refs = append(refs, ormReference{owner: st.name, column: column, target: target.name, toColumn: toColumn(target.name), source: source})
+				continue
+			}
+			if fk == "" {
+				fk = st.name + "ID"
+			}
+			refs = append(refs, ormReference{owner: target.name, column: g.columnOf(target.name, fk), target: st.name, toColumn: toColumn(st.name), source: source})
+		}
+	}
+	return refs
+}
@@ -0,0 +1,576 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// jpaColumnTypes Java・Kotlin の型の列の型（Hibernate の既定）
+var jpaColumnTypes = map[string]string{
+	"Long": "bigint", "long": "bigint", "Integer": "integer", "int": "integer", "Int": "integer",
+	"Short": "smallint", "short": "smallint", "Byte": "smallint", "byte": "smallint",
+	"String": "varchar", "Boolean": "boolean", "boolean": "boolean", "Char": "char(1)", "char": "char(1)", "Character": "char(1)",
+	"BigDecimal": "decimal(19,2)", "BigInteger": "decimal(19,0)", "Double": "double", "double": "double", "Float": "float", "float": "float",
+	"LocalDateTime": "timestamp", "Instant": "timestamp", "Date": "timestamp", "Timestamp": "timestamp", "OffsetDateTime": "timestamp",
+	"ZonedDateTime": "timestamp", "Calendar": "timestamp", "LocalDate": "date", "LocalTime": "time", "Duration": "interval",
+	"UUID": "uuid", "byte[]": "binary", "ByteArray": "binary", "Byte[]": "binary",
+}
+
+// null を持てない型（Java のプリミティブ、Kotlin の ? なしの数値・真偽値はプリミティブになる）
+var (
+	javaPrimitiveTypes   = map[string]bool{"long": true, "int": true, "short": true, "byte": true, "boolean": true, "double": true, "float": true, "char": true}
+	kotlinPrimitiveTypes = map[string]bool{"Long": true, "Int": true, "Short": true, "Byte": true, "Boolean": true, "Double": true, "Float": true, "Char": true}
+)
+
+var (
+	jpaAnnotationRe    = regexp.MustCompile(`^@(?:(?:field|get|set|param|property):)?([\w.]+)`)
+	jpaClassRe         = regexp.MustCompile(`\b(class|interface|enum|record)\s+(\w+)`)
+	jpaExtendsRe       = regexp.MustCompile(`\bextends\s+([\w.]+)`)
+	jpaKotlinBaseRe    = regexp.MustCompile(`^\s*:\s*([\w.]+)`)
+	jpaKotlinPropRe    = regexp.MustCompile(`(?:^|\s)(?:val|var)\s+(\w+)\s*:\s*([^=]+?)\s*(?:=[\s\S]*)?$`)
+	jpaModifierRe      = regexp.MustCompile(`\b(?:public|protected|private|final|volatile|abstract|synchronized|native)\s+`)
+	jpaEnumRe          = regexp.MustCompile(`\benum\s+(?:class\s+)?(\w+)`)
+	jpaNameArgRe       = regexp.MustCompile(`\bname\s*=\s*"([^"]*)"`)
+	jpaGenericElemRe   = regexp.MustCompile(`<\s*(?:out\s+)?([\w.]+)\??\s*>`)
+	jpaKotlinExprFunRe = regexp.MustCompile(`\bfun\b[\s\S]*\)\s*(?::[^=]+)?=[^=]\s*\S`)
+)
+
+// jpaDecl クラス本体などを ; と { } で区切った宣言
+type jpaDecl struct {
+	annotations map[string]string // アノテーション名（パッケージなし）→ 引数
+	text        string            // アノテーションを除いた宣言
+	body        string
+	bodyOffset  int
+	offset      int
+}
+
+// jpaMember エンティティのフィールド（Kotlin ではプロパティ・コンストラクタ引数）
+type jpaMember struct {
+	annotations map[string]string
+	name        string
+	typ         string
+	line        int
+	static      bool
+	primitive   bool
+}
+
+// jpaClass エンティティ・@MappedSuperclass・@Embeddable のクラス
+type jpaClass struct {
+	name        string
+	base        string
+	annotations map[string]string
+	members     []jpaMember
+	file        *models.File
+	line        int
+}
+
+// jpaParser JPA のエンティティを全ファイル分まとめて読む
+type jpaParser struct {
+	classes map[string]*jpaClass
+	order   []*jpaClass
+	enums   map[string]bool
+	tables  map[string]string
+	refs    []ormReference
+}
+
+// jpaAnnotation text[i] から始まるアノテーションの名前・引数・終わりの位置
+func jpaAnnotation(text string, i int) (string, string, int, bool) {
+	m := jpaAnnotationRe.FindStringSubmatchIndex(text[i:])
+	if m == nil || text[i+m[2]:i+m[3]] == "interface" {
+		return "", "", i, false
+	}
+	name := lastPathElement(text[i+m[2] : i+m[3]])
+	end := i + m[1]
+	j := end
+	for j < len(text) && (text[j] == ' ' || text[j] == '\t') {
+		j++
+	}
+	args := ""
+	if j < len(text) && text[j] == '(' {
+		args, end = callArguments(text, j)
+	}
+	return name, args, end, true
+}
+
+// jpaScan text[start:end] を宣言に区切る。Kotlin では package・import・val・var の宣言は行末で区切る
+func jpaScan(text string, start, end int, kotlin bool) []jpaDecl {
+	var decls []jpaDecl
+	var sb strings.Builder
+	cur := jpaDecl{annotations: map[string]string{}, offset: -1}
+	emit := func() {
+		cur.text = strings.Join(strings.Fields(sb.String()), " ")
+		if cur.text != "" || cur.body != "" {
+			decls = append(decls, cur)
+		}
+		sb.Reset()
+		cur = jpaDecl{annotations: map[string]string{}, offset: -1}
+	}
+	mark := func(i int) {
+		if cur.offset < 0 {
+			cur.offset = i
+		}
+	}
+	for i := start; i < end; {
+		c := text[i]
+		switch {
+		case c == '@':
+			if name, args, j, ok := jpaAnnotation(text[:end], i); ok {
+				mark(i)
+				cur.annotations[name] = args
+				i = j
+				continue
+			}
+			sb.WriteByte(c)
+			i++
+		case c == '"' || c == '\'':
+			j := scanQuoted(text[:end], i, c, false, true)
+			sb.WriteString(text[i:j])
+			i = j
+		case c == '(' || c == '[':
+			_, j := callArguments(text[:end], i)
+			sb.WriteString(text[i:j])
+			i = j
+		case c == '{':
+			mark(i)
+			body, j := callArguments(text[:end], i)
+			cur.body, cur.bodyOffset = body, i+1
+			emit()
+			i = j
+		case c == ';':
+			emit()
+			i++
+		case c == '\n' && kotlin && jpaKotlinLineEnd(sb.String(), text[i:end]):
+			emit()
+			i++
+		default:
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				mark(i)
+			}
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	emit()
+	return decls
+}
+
+// jpaKotlinLineEnd Kotlin で行末が宣言の終わりになるか（package・import・val・var・式本体の fun・本体のない class）
+func jpaKotlinLineEnd(buffered, rest string) bool {
+	line := strings.TrimSpace(buffered)
+	if strings.HasPrefix(line, "package ") || strings.HasPrefix(line, "import ") {
+		return true
+	}
+	if jpaKotlinExprFunRe.MatchString(line) {
+		return true
+	}
+	if jpaClassRe.MatchString(line) && strings.HasSuffix(line, ")") {
+		// 次の行が基底クラス・本体で続かなければ data class Foo(...) はここで終わる
+		next := strings.TrimSpace(rest)
+		return next != "" && !strings.HasPrefix(next, ":") && !strings.HasPrefix(next, "{") && !strings.HasPrefix(next, "where ")
+	}
+	return jpaKotlinPropRe.MatchString(line) && !jpaClassRe.MatchString(line)
+}
+
+// parseJPAEntities JPA（javax.persistence・jakarta.persistence）のエンティティを読む
+// 名前は Spring Boot の既定の命名（クラス名・フィールド名の snake_case）で決める
+func parseJPAEntities(s *schemaBuilder, files []*models.File) {
+	p := &jpaParser{classes: make(map[string]*jpaClass), enums: make(map[string]bool), tables: make(map[string]string)}
+	for _, file := range files {
+		text := StripComments(file.Language, file.Content)
+		for _, m := range jpaEnumRe.FindAllStringSubmatch(text, -1) {
+			p.enums[m[1]] = true
+		}
+		if !strings.Contains(text, "@Entity") && !strings.Contains(text, "@MappedSuperclass") && !strings.Contains(text, "@Embeddable") {
+			continue
+		}
+		p.collect(file, text, 0, len(text))
+	}
+
+	for _, cls := range p.order {
+		if _, ok := cls.annotations["Entity"]; ok {
+			p.tables[cls.name] = p.tableOf(cls)
+		}
+	}
+	for _, cls := range p.order {
+		if _, ok := cls.annotations["Entity"]; !ok {
+			continue
+		}
+		table := p.tables[cls.name]
+		e := s.entity(table, "jpa", schemaSource(cls.file, cls.line))
+		parent := p.entityParent(cls)
+		switch strategy := p.inheritance(cls); {
+		case parent == nil:
+			p.addMembers(e, cls, cls, false, false, 0)
+		case strategy == "JOINED":
+			// 子のテーブルは親の主キーと同じ列を主キー兼外部キーとして持つ
+			column := p.idColumn(parent)
+			if args, ok := cls.annotations["PrimaryKeyJoinColumn"]; ok {
+				if m := jpaNameArgRe.FindStringSubmatch(args); m != nil {
+					column = m[1]
+				}
+			}
+			e.setColumn(SchemaColumn{Name: column, PrimaryKey: true})
+			p.refs = append(p.refs, ormReference{table: table, column: column, target: parent.name, joinKey: true, source: schemaSource(cls.file, cls.line)})
+			p.addMembers(e, cls, cls, false, false, 0)
+		case strategy == "TABLE_PER_CLASS":
+			for _, k := range p.chain(cls) {
+				p.addMembers(e, cls, k, false, false, 0)
+			}
+		default:
+			// SINGLE_TABLE: 子の列は親のテーブルに null 可で入り、種類を区別する列が付く
+			p.addMembers(e, cls, cls, false, true, 0)
+			root := p.chain(cls)[0]
+			column := "dtype"
+			if args, ok := root.annotations["DiscriminatorColumn"]; ok {
+				if m := jpaNameArgRe.FindStringSubmatch(args); m != nil {
+					column = m[1]
+				}
+			}
+			e.setColumn(SchemaColumn{Name: column, Type: "varchar(31)", RawType: "DiscriminatorColumn"})
+		}
+		if len(e.PrimaryKey) == 0 && parent == nil {
+			if col := e.column("id"); col != nil {
+				e.addPrimaryKey(col.Name)
+			}
+		}
+	}
+	resolveORMReferences(s, p.refs, p.tables, "jpa")
+	fillUnresolvedKeyTypes(s, "jpa", "bigint")
+}
+
+// collect クラスの宣言を集める（入れ子のクラスも含む）
+func (p *jpaParser) collect(file *models.File, text string, start, end int) {
+	kotlin := file.Language == "kotlin"
+	for _, decl := range jpaScan(text, start, end, kotlin) {
+		m := jpaClassRe.FindStringSubmatchIndex(decl.text)
+		if m == nil || decl.text[m[2]:m[3]] != "class" || strings.Contains(decl.text[:m[0]], "enum") {
+			continue
+		}
+		cls := &jpaClass{name: decl.text[m[4]:m[5]], annotations: decl.annotations, file: file, line: lineAt(text, max(decl.offset, 0))}
+		rest := decl.text[m[1]:]
+		if kotlin {
+			rest = skipBalanced(strings.TrimSpace(rest), '<', '>')
+			params := ""
+			if strings.HasPrefix(rest, "(") {
+				params, _ = callArguments(rest, 0)
+				rest = skipBalanced(rest, '(', ')')
+			}
+			if bm := jpaKotlinBaseRe.FindStringSubmatch(rest); bm != nil {
+				cls.base = lastPathElement(bm[1])
+			}
+			for _, param := range splitCallArgs(params) {
+				if member, ok := jpaParseMember(param, cls.line, true); ok {
+					cls.members = append(cls.members, member)
+				}
+			}
+		} else if bm := jpaExtendsRe.FindStringSubmatch(rest); bm != nil {
+			cls.base = lastPathElement(bm[1])
+		}
+		if decl.body != "" {
+			for _, member := range jpaScan(text, decl.bodyOffset, decl.bodyOffset+len(decl.body), kotlin) {
+				if member.body != "" {
+					continue
+				}
+				line := lineAt(text, max(member.offset, 0))
+				if mem, ok := jpaMemberFromDecl(member, line, kotlin); ok {
+					cls.members = append(cls.members, mem)
+				}
+			}
+			p.collect(file, text, decl.bodyOffset, decl.bodyOffset+len(decl.body))
+		}
+		if _, exists := p.classes[cls.name]; !exists {
+			p.classes[cls.name] = cls
+			p.order = append(p.order, cls)
+		}
+	}
+}
+
+// jpaParseMember Kotlin のコンストラクタ引数（@Id val id: Long? = null など）をメンバーにする
+func jpaParseMember(param string, line int, kotlin bool) (jpaMember, bool) {
+	decl := jpaDecl{annotations: map[string]string{}}
+	var sb strings.Builder
+	for i := 0; i < len(param); {
+		if param[i] == '@' {
+			if name, args, j, ok := jpaAnnotation(param, i); ok {
+				decl.annotations[name] = args
+				i = j
+				continue
+			}
+		}
+		sb.WriteByte(param[i])
+		i++
+	}
+	decl.text = strings.Join(strings.Fields(sb.String()), " ")
+	return jpaMemberFromDecl(decl, line, kotlin)
+}
+
+// jpaMemberFromDecl 宣言がフィールドならメンバーにする（メソッド・static 定数は除く）
+func jpaMemberFromDecl(decl jpaDecl, line int, kotlin bool) (jpaMember, bool) {
+	member := jpaMember{annotations: decl.annotations, line: line}
+	text := decl.text
+	if kotlin {
+		m := jpaKotlinPropRe.FindStringSubmatch(text)
+		if m == nil || strings.Contains(text[:strings.Index(text, m[1])], "fun ") {
+			return member, false
+		}
+		member.name, member.typ = m[1], strings.TrimSpace(m[2])
+		member.primitive = kotlinPrimitiveTypes[member.typ]
+		return member, true
+	}
+	if parts := splitTopLevelAssign(text); parts != "" {
+		text = parts
+	}
+	if strings.ContainsAny(text, "()") || jpaClassRe.MatchString(text) {
+		return member, false
+	}
+	member.static = strings.Contains(" "+text+" ", " static ") || strings.Contains(" "+text+" ", " transient ")
+	text = jpaModifierRe.ReplaceAllString(strings.ReplaceAll(strings.ReplaceAll(text, "static ", ""), "transient ", ""), "")
+	fields := strings.Fields(text)
+	if len(fields) < 2 {
+		return member, false
+	}
+	member.name = fields[len(fields)-1]
+	member.typ = strings.Join(fields[:len(fields)-1], "")
+	member.primitive = javaPrimitiveTypes[member.typ]
+	return member, true
+}
+
+// splitTopLevelAssign 初期化式（= の後ろ）を除いた宣言
+func splitTopLevelAssign(text string) string {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '(', '<', '[', '{':
+			depth++
+		case ')', '>', ']', '}':
+			depth--
+		case '=':
+			if depth == 0 {
+				return strings.TrimSpace(text[:i])
+			}
+		}
+	}
+	return ""
+}
+
+// tableOf エンティティのテーブル名（SINGLE_TABLE の子は親のテーブル）
+func (p *jpaParser) tableOf(cls *jpaClass) string {
+	if parent := p.entityParent(cls); parent != nil && p.inheritance(cls) == "SINGLE_TABLE" {
+		return p.tableOf(parent)
+	}
+	if args, ok := cls.annotations["Table"]; ok {
+		if m := jpaNameArgRe.FindStringSubmatch(args); m != nil {
+			return m[1]
+		}
+	}
+	return snakeCase(cls.name)
+}
+
+// entityParent 継承元のエンティティ（@MappedSuperclass は除く）
+func (p *jpaParser) entityParent(cls *jpaClass) *jpaClass {
+	for k, depth := p.classes[cls.base], 0; k != nil && depth < 8; k, depth = p.classes[k.base], depth+1 {
+		if _, ok := k.annotations["Entity"]; ok {
+			return k
+		}
+	}
+	return nil
+}
+
+// chain 継承の根から cls までのクラス（@MappedSuperclass を含む）
+func (p *jpaParser) chain(cls *jpaClass) []*jpaClass {
+	chain := []*jpaClass{cls}
+	for k := p.classes[cls.base]; k != nil && len(chain) < 8; k = p.classes[k.base] {
+		chain = append([]*jpaClass{k}, chain...)
+	}
+	return chain
+}
+
+// inheritance 継承の根の @Inheritance の strategy（既定は SINGLE_TABLE）
+func (p *jpaParser) inheritance(cls *jpaClass) string {
+	for _, k := range p.chain(cls) {
+		if args, ok := k.annotations["Inheritance"]; ok {
+			for _, strategy := range []string{"JOINED", "TABLE_PER_CLASS"} {
+				if strings.Contains(args, strategy) {
+					return strategy
+				}
+			}
+			return "SINGLE_TABLE"
+		}
+	}
+	return "SINGLE_TABLE"
+}
+
+// idColumn @Id のフィールドの列名
+func (p *jpaParser) idColumn(cls *jpaClass) string {
+	for _, k := range p.chain(cls) {
+		for _, member := range k.members {
+			if _, ok := member.annotations["Id"]; ok {
+				return jpaColumnName(member)
+			}
+		}
+	}
+	return "id"
+}
+
+func jpaColumnName(member jpaMember) string {
+	if m := jpaNameArgRe.FindStringSubmatch(member.annotations["Column"]); m != nil {
+		return m[1]
+	}
+	return snakeCase(member.name)
+}
+
+// jpaArg アノテーションの引数 name = value の値
+func jpaArg(args, name string) string {
+	_, kwargs := parseCallArgs(args)
+	return unquoteLiteral(kwargs[name])
+}
+
+// addMembers クラスのフィールドを列と関連にする。@MappedSuperclass の親は先に読む
+// owner はテーブルを持つエンティティ、nullable は SINGLE_TABLE の子の列
+func (p *jpaParser) addMembers(e *SchemaEntity, owner, cls *jpaClass, forcePK, nullable bool, depth int) {
+	if depth > 8 {
+		return
+	}
+	if base := p.classes[cls.base]; base != nil && !hasAnnotation(base.annotations, "Entity") {
+		p.addMembers(e, owner, base, forcePK, nullable, depth+1)
+	}
+	table := e.Name
+	for _, member := range cls.members {
+		a := member.annotations
+		if _, ok := a["Transient"]; ok || member.static {
+			continue
+		}
+		typ := strings.TrimSuffix(member.typ, "?")
+		source := schemaSource(cls.file, member.line)
+		if _, ok := a["Embedded"]; ok {
+			if embedded := p.classes[lastPathElement(typ)]; embedded != nil {
+				p.addMembers(e, owner, embedded, forcePK, nullable, depth+1)
+			}
+			continue
+		}
+		if _, ok := a["EmbeddedId"]; ok {
+			if embedded := p.classes[lastPathElement(typ)]; embedded != nil {
+				p.addMembers(e, owner, embedded, true, false, depth+1)
+			}
+			continue
+		}
+		elem := lastPathElement(typ)
+		if m := jpaGenericElemRe.FindStringSubmatch(typ); m != nil {
+			elem = lastPathElement(m[1])
+		}
+		_, manyToOne := a["ManyToOne"]
+		oneToOne, isOneToOne := a["OneToOne"]
+		oneToMany, isOneToMany := a["OneToMany"]
+		manyToMany, isManyToMany := a["ManyToMany"]
+		switch {
+		case manyToOne || isOneToOne:
+			if jpaArg(oneToOne, "mappedBy") != "" {
+				continue
+			}
+			join := a["JoinColumn"]
+			column := jpaArg(join, "name")
+			if column == "" {
+				column = snakeCase(member.name) + "_id"
+			}
+			optional := jpaArg(a["ManyToOne"]+oneToOne, "optional") != "false"
+			col := e.setColumn(SchemaColumn{
+				Name:       column,
+				Nullable:   nullable || (optional && jpaArg(join, "nullable") != "false"),
+				Unique:     isOneToOne || jpaArg(join, "unique") == "true",
+				PrimaryKey: forcePK || hasAnnotation(a, "Id") || hasAnnotation(a, "MapsId"),
+			})
+			p.refs = append(p.refs, ormReference{table: table, column: col.Name, target: elem, toColumn: jpaArg(join, "referencedColumnName"), unique: col.Unique, source: source})
+		case isOneToMany:
+			if jpaArg(oneToMany, "mappedBy") != "" {
+				continue
+			}
+			if join, ok := a["JoinColumn"]; ok {
+				column := jpaArg(join, "name")
+				if column == "" {
+					column = snakeCase(member.name) + "_id"
+				}
+				p.refs = append(p.refs, ormReference{owner: elem, column: column, target: owner.name, source: source})
+				continue
+			}
+			p.addJoinTable(table, owner, member, elem, source)
+		case isManyToMany:
+			if jpaArg(manyToMany, "mappedBy") != "" {
+				continue
+			}
+			p.addJoinTable(table, owner, member, elem, source)
+		case hasAnnotation(a, "ElementCollection"):
+			continue
+		default:
+			col := a["Column"]
+			colType := jpaColumnTypes[typ]
+			if p.enums[elem] || hasAnnotation(a, "Enumerated") {
+				colType = "integer"
+				if strings.Contains(a["Enumerated"], "STRING") {
+					colType = "varchar"
+				}
+			}
+			if hasAnnotation(a, "Lob") && colType != "binary" {
+				colType = "text"
+			}
+			raw := member.typ
+			if def := jpaArg(col, "columnDefinition"); def != "" {
+				raw, colType = def, normalizeColumnType(def)
+			}
+			if colType == "" {
+				continue
+			}
+			if colType == "varchar" {
+				length := jpaArg(col, "length")
+				if length == "" {
+					length = "255"
+				}
+				colType += "(" + length + ")"
+			} else if strings.HasPrefix(colType, "decimal") && jpaArg(col, "precision") != "" {
+				scale := jpaArg(col, "scale")
+				if scale == "" {
+					scale = "0"
+				}
+				colType = "decimal(" + jpaArg(col, "precision") + "," + scale + ")"
+			}
+			pk := forcePK || hasAnnotation(a, "Id")
+			notNull := jpaArg(col, "nullable") == "false" || hasAnnotation(a, "NotNull") || hasAnnotation(a, "NonNull") ||
+				hasAnnotation(a, "NotBlank") || hasAnnotation(a, "NotEmpty") || member.primitive
+			e.setColumn(SchemaColumn{
+				Name:       jpaColumnName(member),
+				Type:       colType,
+				RawType:    raw,
+				Nullable:   !pk && (nullable || !notNull),
+				PrimaryKey: pk,
+				Unique:     jpaArg(col, "unique") == "true",
+			})
+		}
+	}
+}
+
+// addJoinTable @ManyToMany・@OneToMany（@JoinColumn なし）の中間テーブル
+func (p *jpaParser) addJoinTable(table string, owner *jpaClass, member jpaMember, elem, source string) {
+	args := member.annotations["JoinTable"]
+	_, kwargs := parseCallArgs(args)
+	name := unquoteLiteral(kwargs["name"])
+	if name == "" {
+		name = table + "_" + snakeCase(member.name)
+	}
+	left := snakeCase(owner.name) + "_id"
+	if m := jpaNameArgRe.FindStringSubmatch(kwargs["joinColumns"]); m != nil {
+		left = m[1]
+	}
+	right := snakeCase(member.name) + "_id"
+	if m := jpaNameArgRe.FindStringSubmatch(kwargs["inverseJoinColumns"]); m != nil {
+		right = m[1]
+	}
+	p.refs = append(p.refs,
+		ormReference{table: name, column: left, target: owner.name, joinKey: true, source: source},
+		ormReference{table: name, column: right, target: elem, joinKey: true, source: source})
+}
+
+func hasAnnotation(annotations map[string]string, name string) bool {
+	_, ok := annotations[name]
+	return ok
+}
@@ -0,0 +1,510 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// railsColumnTypes Rails のマイグレーションの型
+var railsColumnTypes = map[string]string{
+	"string": "varchar", "text": "text", "integer": "integer", "bigint": "bigint", "float": "float", "decimal": "decimal",
+	"numeric": "decimal", "datetime": "timestamp", "timestamp": "timestamp", "timestamptz": "timestamp", "time": "time",
+	"date": "date", "binary": "binary", "boolean": "boolean", "json": "json", "jsonb": "json", "uuid": "uuid",
+	"citext": "text", "inet": "inet", "interval": "interval", "money": "decimal",
+}
+
+// sqlAlchemyTypes SQLAlchemy（Alembic）の型
+var sqlAlchemyTypes = map[string]string{
+	"Integer": "integer", "BigInteger": "bigint", "SmallInteger": "smallint", "String": "varchar", "Unicode": "varchar",
+	"Text": "text", "UnicodeText": "text", "Boolean": "boolean", "DateTime": "timestamp", "TIMESTAMP": "timestamp",
+	"Date": "date", "Time": "time", "Numeric": "decimal", "DECIMAL": "decimal", "Float": "float", "JSON": "json",
+	"JSONB": "json", "UUID": "uuid", "Uuid": "uuid", "LargeBinary": "binary", "Enum": "enum", "Interval": "interval",
+	"INTEGER": "integer", "BIGINT": "bigint", "VARCHAR": "varchar", "TEXT": "text", "BOOLEAN": "boolean",
+}
+
+var (
+	railsStatementRe  = regexp.MustCompile(`(?m)^[ \t]*(create_table|add_column|remove_column|rename_column|change_column|change_column_null|add_reference|add_belongs_to|remove_reference|add_foreign_key|drop_table|rename_table|add_index|add_timestamps)\b[ \t(]*([^\n]*)`)
+	railsTableBlockRe = regexp.MustCompile(`\bdo\s*\|(\w+)\|\s*$`)
+	railsDownRe       = regexp.MustCompile(`(?m)^[ \t]*def[ \t]+(?:self\.)?down\b`)
+	railsDefRe        = regexp.MustCompile(`(?m)^[ \t]*def[ \t]+`)
+	railsToTableRe    = regexp.MustCompile(`to_table:\s*:?["']?(\w+)`)
+	railsHashRe       = regexp.MustCompile(`^["':]?(\w+)["']?\s*(?::|=>)\s*([\s\S]+)$`)
+	alembicOpRe       = regexp.MustCompile(`\b(\w+)\.(create_table|add_column|drop_column|drop_table|rename_table|alter_column|create_foreign_key|create_unique_constraint|batch_alter_table)\s*\(`)
+	alembicTypeRe     = regexp.MustCompile(`^(?:[\w]+\.)*(\w+)\s*(?:\(([^)]*)\))?$`)
+)
+
+// rubyArgs Ruby のメソッド呼び出しの引数を、位置引数とハッシュ（key: value、"key" => value）に分ける
+func rubyArgs(s string) ([]string, map[string]string) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(strings.TrimSpace(railsTableBlockRe.ReplaceAllString(s, "")), ")")
+	var positional []string
+	options := make(map[string]string)
+	for _, arg := range splitCallArgs(s) {
+		if m := railsHashRe.FindStringSubmatch(arg); m != nil {
+			options[m[1]] = strings.TrimSpace(m[2])
+			continue
+		}
+		positional = append(positional, unquoteLiteral(arg))
+	}
+	for key, value := range options {
+		if !strings.HasPrefix(value, "{") {
+			options[key] = unquoteLiteral(value)
+		}
+	}
+	return positional, options
+}
+
+// railsColumn Rails の型とオプション（limit・precision・null・default）から列を作る
+func railsColumn(name, typ string, options map[string]string) SchemaColumn {
+	col := SchemaColumn{Name: name, RawType: typ, Nullable: options["null"] != "false", Default: options["default"]}
+	col.Type = railsColumnTypes[typ]
+	if col.Type == "" {
+		col.Type = normalizeColumnType(typ)
+	}
+	switch {
+	case typ == "integer" && options["limit"] == "8":
+		col.Type = "bigint"
+	case typ == "integer" && (options["limit"] == "2" || options["limit"] == "1"):
+		col.Type = "smallint"
+	case col.Type == "varchar" && options["limit"] != "":
+		col.Type += "(" + options["limit"] + ")"
+	case col.Type == "decimal" && options["precision"] != "":
+		scale := options["scale"]
+		if scale == "" {
+			scale = "0"
+		}
+		col.Type += "(" + options["precision"] + "," + scale + ")"
+	}
+	if options["primary_key"] == "true" {
+		col.PrimaryKey, col.Nullable = true, false
+	}
+	return col
+}
+
+// parseRailsMigration Rails のマイグレーション・db/schema.rb を適用する（def down の中は読まない）
+func parseRailsMigration(s *schemaBuilder, file *models.File) {
+	text := StripComments("ruby", file.Content)
+	if loc := railsDownRe.FindStringIndex(text); loc != nil {
+		end := len(text)
+		if next := railsDefRe.FindStringIndex(text[loc[1]:]); next != nil {
+			end = loc[1] + next[0]
+		}
+		text = text[:loc[0]] + strings.Repeat("\n", strings.Count(text[loc[0]:end], "\n")) + text[end:]
+	}
+	origin := "migration"
+	if strings.HasSuffix(file.Name, "schema.rb") {
+		origin = "rails"
+	}
+
+	lines := strings.Split(text, "\n")
+	for ln := 0; ln < len(lines); ln++ {
+		m := railsStatementRe.FindStringSubmatch(lines[ln])
+		if m == nil {
+			continue
+		}
+		source := schemaSource(file, ln+1)
+		args, options := rubyArgs(m[2])
+		if len(args) == 0 {
+			continue
+		}
+		table := args[0]
+		switch m[1] {
+		case "create_table":
+			e := s.entity(table, origin, source)
+			pk := options["primary_key"]
+			if pk == "" {
+				pk = "id"
+			}
+			if options["id"] != "false" {
+				typ := "bigint"
+				if id := options["id"]; id != "" && id != "true" {
+					typ = railsColumnTypes[id]
+				}
+				e.setColumn(SchemaColumn{Name: pk, Type: typ, RawType: "primary_key", PrimaryKey: true})
+			}
+			bm := railsTableBlockRe.FindStringSubmatch(m[2])
+			if bm == nil {
+				continue
+			}
+			// ブロックの中の t.string :name などを end まで読む
+			prefix := bm[1] + "."
+			for ln++; ln < len(lines); ln++ {
+				line := strings.TrimSpace(lines[ln])
+				if line == "end" || strings.HasPrefix(line, "end ") {
+					break
+				}
+				if !strings.HasPrefix(line, prefix) {
+					continue
+				}
+				method, rest, _ := strings.Cut(line[len(prefix):], " ")
+				method = strings.TrimSuffix(method, "(")
+				cargs, copts := rubyArgs(rest)
+				railsTableMethod(s, e, method, cargs, copts, schemaSource(file, ln+1))
+			}
+		case "add_column", "change_column":
+			if e := s.entity(table, origin, ""); len(args) >= 3 {
+				e.setColumn(railsColumn(args[1], args[2], options))
+			}
+		case "remove_column":
+			if e := s.lookup(table); e != nil && len(args) >= 2 {
+				for _, col := range args[1:] {
+					e.dropColumn(col)
+				}
+			}
+		case "rename_column":
+			if e := s.lookup(table); e != nil && len(args) >= 3 {
+				s.renameColumn(e, args[1], args[2])
+			}
+		case "change_column_null":
+			if e := s.lookup(table); e != nil && len(args) >= 3 {
+				if col := e.column(args[1]); col != nil {
+					col.Nullable = args[2] != "false"
+				}
+			}
+		case "add_reference", "add_belongs_to":
+			if len(args) >= 2 {
+				railsTableMethod(s, s.entity(table, origin, ""), "references", args[1:], options, source)
+			}
+		case "remove_reference":
+			if e := s.lookup(table); e != nil && len(args) >= 2 {
+				e.dropColumn(args[1] + "_id")
+			}
+		case "add_foreign_key":
+			if len(args) >= 2 {
+				column := options["column"]
+				if column == "" {
+					column = singularizeTableName(args[1]) + "_id"
+				}
+				fk := SchemaRelationship{FromTable: table, FromColumns: []string{column}, ToTable: args[1], Source: source}
+				if pk := options["primary_key"]; pk != "" {
+					fk.ToColumns = []string{pk}
+				}
+				s.addForeignKey(fk)
+			}
+		case "drop_table":
+			s.dropEntity(table)
+		case "rename_table":
+			if len(args) >= 2 {
+				s.renameEntity(table, args[1])
+			}
+		case "add_index":
+			if e := s.lookup(table); e != nil && len(args) >= 2 && options["unique"] == "true" {
+				if col := e.column(args[1]); col != nil {
+					col.Unique = true
+				}
+			}
+		case "add_timestamps":
+			railsTableMethod(s, s.entity(table, origin, ""), "timestamps", nil, options, source)
+		}
+	}
+}
+
+// railsTableMethod create_table のブロック内の t.<型>・t.references・t.timestamps・t.index
+func railsTableMethod(s *schemaBuilder, e *SchemaEntity, method string, args []string, options map[string]string, source string) {
+	switch method {
+	case "timestamps":
+		nullable := options["null"] == "true"
+		e.setColumn(SchemaColumn{Name: "created_at", Type: "timestamp", RawType: "datetime", Nullable: nullable})
+		e.setColumn(SchemaColumn{Name: "updated_at", Type: "timestamp", RawType: "datetime", Nullable: nullable})
+	case "references", "belongs_to":
+		for _, ref := range args {
+			typ := "bigint"
+			if options["type"] != "" {
+				typ = railsColumnTypes[options["type"]]
+			}
+			col := e.setColumn(SchemaColumn{Name: ref + "_id", Type: typ, RawType: "references", Nullable: options["null"] != "false"})
+			if options["polymorphic"] == "true" {
+				e.setColumn(SchemaColumn{Name: ref + "_type", Type: "varchar", RawType: "string", Nullable: col.Nullable})
+				continue
+			}
+			if strings.Contains(options["index"], "unique: true") {
+				col.Unique = true
+			}
+			fk := options["foreign_key"]
+			if fk == "" || fk == "false" {
+				continue
+			}
+			target := pluralizeTableName(ref)
+			if m := railsToTableRe.FindStringSubmatch(fk); m != nil {
+				target = m[1]
+			}
+			s.addForeignKey(SchemaRelationship{FromTable: e.Name, FromColumns: []string{col.Name}, ToTable: target, Source: source})
+		}
+	case "index":
+		if len(args) == 1 && options["unique"] == "true" {
+			if col := e.column(args[0]); col != nil {
+				col.Unique = true
+			}
+		}
+	case "column":
+		if len(args) >= 2 {
+			e.setColumn(railsColumn(args[0], args[1], options))
+		}
+	default:
+		if _, ok := railsColumnTypes[method]; !ok && method != "primary_key" {
+			return
+		}
+		for _, name := range args {
+			col := railsColumn(name, method, options)
+			if method == "primary_key" {
+				col = SchemaColumn{Name: name, Type: "bigint", RawType: "primary_key", PrimaryKey: true}
+			}
+			e.setColumn(col)
+		}
+	}
+}
+
+// alembicColumn sa.Column('name', sa.String(50), sa.ForeignKey('users.id'), nullable=False) を列と外部キーの参照先にする
+func alembicColumn(call string) (SchemaColumn, string, bool) {
+	open := strings.IndexByte(call, '(')
+	if open < 0 {
+		return SchemaColumn{}, "", false
+	}
+	inner, _ := callArguments(call, open)
+	args, kwargs := parseCallArgs(inner)
+	if len(args) == 0 {
+		return SchemaColumn{}, "", false
+	}
+	col := SchemaColumn{Name: unquoteLiteral(args[0])}
+	reference := ""
+	for _, arg := range args[1:] {
+		if strings.Contains(arg, "ForeignKey(") {
+			fkArgs, _ := callArguments(arg, strings.Index(arg, "ForeignKey(")+len("ForeignKey"))
+			if parts := splitCallArgs(fkArgs); len(parts) > 0 {
+				reference = unquoteLiteral(parts[0])
+			}
+			continue
+		}
+		if col.RawType == "" {
+			col.RawType = arg
+			col.Type = sqlAlchemyType(arg)
+		}
+	}
+	col.PrimaryKey = kwargs["primary_key"] == "True"
+	col.Nullable = kwargs["nullable"] != "False" && !col.PrimaryKey
+	col.Unique = kwargs["unique"] == "True"
+	if def := kwargs["server_default"]; def != "" {
+		col.Default = strings.Trim(unquoteLiteral(strings.TrimSuffix(strings.TrimPrefix(def, "sa.text("), ")")), `'"`)
+	}
+	return col, reference, true
+}
+
+// sqlAlchemyType sa.String(length=50) → varchar(50) のように型を正規化する
+func sqlAlchemyType(expr string) string {
+	m := alembicTypeRe.FindStringSubmatch(strings.TrimSpace(expr))
+	if m == nil {
+		return normalizeColumnType(expr)
+	}
+	typ, ok := sqlAlchemyTypes[m[1]]
+	if !ok {
+		return normalizeColumnType(m[1])
+	}
+	args, kwargs := parseCallArgs(m[2])
+	switch typ {
+	case "varchar":
+		length := kwargs["length"]
+		if length == "" && len(args) > 0 {
+			length = args[0]
+		}
+		if length != "" {
+			typ += "(" + length + ")"
+		}
+	case "decimal":
+		precision, scale := kwargs["precision"], kwargs["scale"]
+		if precision == "" && len(args) > 0 {
+			precision = args[0]
+		}
+		if scale == "" && len(args) > 1 {
+			scale = args[1]
+		}
+		if precision != "" {
+			if scale == "" {
+				scale = "0"
+			}
+			typ += "(" + precision + "," + scale + ")"
+		}
+	}
+	return typ
+}
+
+// alembicReference 'users.id' を表と列に分ける
+func alembicReference(ref string) (string, string) {
+	if i := strings.LastIndexByte(ref, '.'); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// alembicNames ['a', 'b'] のような名前のリスト
+func alembicNames(list string) []string {
+	list = strings.TrimSpace(list)
+	if strings.HasPrefix(list, "[") || strings.HasPrefix(list, "(") {
+		list, _ = callArguments(list, 0)
+	}
+	var names []string
+	for _, part := range splitCallArgs(list) {
+		names = append(names, unquoteLiteral(part))
+	}
+	return names
+}
+
+// parseAlembicMigration Alembic のマイグレーションの upgrade() を適用する
+func parseAlembicMigration(s *schemaBuilder, file *models.File) {
+	text := StripComments("python", file.Content)
+	start := strings.Index(text, "def upgrade")
+	if start < 0 {
+		return
+	}
+	end := len(text)
+	if i := strings.Index(text[start:], "def downgrade"); i >= 0 {
+		end = start + i
+	}
+	batchTable := ""
+	for _, m := range alembicOpRe.FindAllStringSubmatchIndex(text[:end], -1) {
+		if m[0] < start {
+			continue
+		}
+		inner, _ := callArguments(text[:end], m[1]-1)
+		args, kwargs := parseCallArgs(inner)
+		source := schemaSource(file, lineAt(text, m[0]))
+		target, op := text[m[2]:m[3]], text[m[4]:m[5]]
+		// batch_op.add_column(...) などは with op.batch_alter_table('t') のテーブルに対する操作
+		if target != "op" && op != "batch_alter_table" {
+			args = append([]string{"'" + batchTable + "'"}, args...)
+		}
+		if len(args) == 0 {
+			continue
+		}
+		table := unquoteLiteral(args[0])
+		switch op {
+		case "batch_alter_table":
+			batchTable = table
+		case "create_table":
+			e := s.entity(table, "alembic", source)
+			for _, arg := range args[1:] {
+				name := arg
+				if i := strings.IndexByte(arg, '('); i >= 0 {
+					name = lastPathElement(arg[:i])
+				}
+				argInner := ""
+				if i := strings.IndexByte(arg, '('); i >= 0 {
+					argInner, _ = callArguments(arg, i)
+				}
+				switch name {
+				case "Column":
+					col, ref, ok := alembicColumn(arg)
+					if !ok {
+						continue
+					}
+					c := e.setColumn(col)
+					if ref != "" {
+						toTable, toColumn := alembicReference(ref)
+						fk := SchemaRelationship{FromTable: e.Name, FromColumns: []string{c.Name}, ToTable: toTable, Source: source}
+						if toColumn != "" {
+							fk.ToColumns = []string{toColumn}
+						}
+						s.addForeignKey(fk)
+					}
+				case "PrimaryKeyConstraint":
+					positional, _ := parseCallArgs(argInner)
+					for _, col := range positional {
+						e.addPrimaryKey(unquoteLiteral(col))
+					}
+				case "UniqueConstraint":
+					if positional, _ := parseCallArgs(argInner); len(positional) == 1 {
+						if col := e.column(unquoteLiteral(positional[0])); col != nil {
+							col.Unique = true
+						}
+					}
+				case "ForeignKeyConstraint":
+					positional, _ := parseCallArgs(argInner)
+					if len(positional) < 2 {
+						continue
+					}
+					local, remote := alembicNames(positional[0]), alembicNames(positional[1])
+					if len(remote) == 0 {
+						continue
+					}
+					toTable, _ := alembicReference(remote[0])
+					fk := SchemaRelationship{FromTable: e.Name, FromColumns: local, ToTable: toTable, Source: source}
+					for _, r := range remote {
+						if _, col := alembicReference(r); col != "" {
+							fk.ToColumns = append(fk.ToColumns, col)
+						}
+					}
+					s.addForeignKey(fk)
+				}
+			}
+		case "add_column":
+			if len(args) < 2 {
+				continue
+			}
+			e := s.entity(table, "alembic", "")
+			if col, ref, ok := alembicColumn(args[1]); ok {
+				c := e.setColumn(col)
+				if ref != "" {
+					toTable, toColumn := alembicReference(ref)
+					fk := SchemaRelationship{FromTable: e.Name, FromColumns: []string{c.Name}, ToTable: toTable, Source: source}
+					if toColumn != "" {
+						fk.ToColumns = []string{toColumn}
+					}
+					s.addForeignKey(fk)
+				}
+			}
+		case "drop_column":
+			if e := s.lookup(table); e != nil && len(args) >= 2 {
+				e.dropColumn(unquoteLiteral(args[1]))
+			}
+		case "drop_table":
+			s.dropEntity(table)
+		case "rename_table":
+			if len(args) >= 2 {
+				s.renameEntity(table, unquoteLiteral(args[1]))
+			}
+		case "alter_column":
+			e := s.lookup(table)
+			if e == nil || len(args) < 2 {
+				continue
+			}
+			name := unquoteLiteral(args[1])
+			col := e.column(name)
+			if col == nil {
+				continue
+			}
+			if nullable := kwargs["nullable"]; nullable != "" {
+				col.Nullable = nullable == "True"
+			}
+			if typ := kwargs["type_"]; typ != "" {
+				col.RawType, col.Type = typ, sqlAlchemyType(typ)
+			}
+			if to := unquoteLiteral(kwargs["new_column_name"]); to != "" {
+				s.renameColumn(e, name, to)
+			}
+		case "create_foreign_key":
+			// create_foreign_key(name, source, referent, local_cols, remote_cols)
+			if target == "op" && len(args) >= 5 {
+				s.addForeignKey(SchemaRelationship{FromTable: unquoteLiteral(args[1]), FromColumns: alembicNames(args[3]), ToTable: unquoteLiteral(args[2]), ToColumns: alembicNames(args[4]), Source: source})
+			} else if target != "op" && len(args) >= 5 {
+				// batch_op.create_foreign_key(name, referent, local_cols, remote_cols)
+				s.addForeignKey(SchemaRelationship{FromTable: table, FromColumns: alembicNames(args[3]), ToTable: unquoteLiteral(args[2]), ToColumns: alembicNames(args[4]), Source: source})
+			}
+		case "create_unique_constraint":
+			// create_unique_constraint(name, table, columns)
+			tableArg, colsArg := 1, 2
+			if target != "op" {
+				tableArg, colsArg = 0, 2
+			}
+			if len(args) > colsArg {
+				if e := s.lookup(unquoteLiteral(args[tableArg])); e != nil {
+					if cols := alembicNames(args[colsArg]); len(cols) == 1 {
+						if col := e.column(cols[0]); col != nil {
+							col.Unique = true
+						}
+					}
+				}
+			}
+		}
+	}
+}
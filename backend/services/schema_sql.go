@@ -0,0 +1,517 @@
+package services
+
+import (
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+type sqlTokenKind int
+
+const (
+	sqlWord   sqlTokenKind = iota
+	sqlIdent               // "name"、`name`、[name]
+	sqlString              // 'text'
+	sqlNumber
+	sqlPunct
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	text string // 識別子は引用符を外した名前
+	line int
+}
+
+// is キーワード（大文字小文字を区別しない）か記号と一致するか
+func (t sqlToken) is(word string) bool {
+	return (t.kind == sqlWord || t.kind == sqlPunct) && strings.EqualFold(t.text, word)
+}
+
+// tokenizeSQL SQL を字句に分ける（コメントは読み飛ばす）
+func tokenizeSQL(src string) []sqlToken {
+	var tokens []sqlToken
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '-' && i+1 < len(src) && src[i+1] == '-', c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 2
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case c == '\'' || c == '"' || c == '`' || c == '[' && i+1 < len(src) && (isSQLWordByte(src[i+1]) || src[i+1] == ' '):
+			// [name] は SQL Server の識別子（int[] のような配列型の [ は記号）
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			start := line
+			var sb strings.Builder
+			j := i + 1
+			for j < len(src) {
+				if src[j] == closing {
+					// '' のように重ねた引用符は1文字
+					if j+1 < len(src) && src[j+1] == closing && closing != ']' {
+						sb.WriteByte(closing)
+						j += 2
+						continue
+					}
+					break
+				}
+				if src[j] == '\n' {
+					line++
+				}
+				sb.WriteByte(src[j])
+				j++
+			}
+			kind := sqlIdent
+			if c == '\'' {
+				kind = sqlString
+			}
+			tokens = append(tokens, sqlToken{kind: kind, text: sb.String(), line: start})
+			i = j + 1
+		case isSQLWordByte(c):
+			j := i
+			for j < len(src) && (isSQLWordByte(src[j]) || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlWord, text: src[i:j], line: line})
+			i = j
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlNumber, text: src[i:j], line: line})
+			i = j
+		default:
+			tokens = append(tokens, sqlToken{kind: sqlPunct, text: string(c), line: line})
+			i++
+		}
+	}
+	return tokens
+}
+
+func isSQLWordByte(c byte) bool {
+	return c == '_' || c == '$' || c == '@' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+// splitSQLStatements ; と行頭の GO（SQL Server のバッチ区切り）で文に分ける
+func splitSQLStatements(tokens []sqlToken) [][]sqlToken {
+	var statements [][]sqlToken
+	start := 0
+	for i, t := range tokens {
+		batch := t.is("go") && (i == 0 || tokens[i-1].line < t.line) && (i+1 == len(tokens) || tokens[i+1].line > t.line)
+		if t.is(";") || batch {
+			if i > start {
+				statements = append(statements, tokens[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(tokens) {
+		statements = append(statements, tokens[start:])
+	}
+	return statements
+}
+
+// splitSQLTopLevel 括弧の外の , で分ける
+func splitSQLTopLevel(tokens []sqlToken) [][]sqlToken {
+	var parts [][]sqlToken
+	depth, start := 0, 0
+	for i, t := range tokens {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case t.is(",") && depth == 0:
+			parts = append(parts, tokens[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(tokens) {
+		parts = append(parts, tokens[start:])
+	}
+	return parts
+}
+
+// sqlParser 1文分の字句を先頭から読む
+type sqlParser struct {
+	tokens []sqlToken
+	pos    int
+}
+
+func (p *sqlParser) peek() sqlToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return sqlToken{kind: sqlPunct}
+}
+
+func (p *sqlParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+// accept 続くキーワードがすべて一致すれば読み進めて true
+func (p *sqlParser) accept(words ...string) bool {
+	for i, word := range words {
+		if p.pos+i >= len(p.tokens) || !p.tokens[p.pos+i].is(word) {
+			return false
+		}
+	}
+	p.pos += len(words)
+	return true
+}
+
+// name schema.table のような名前を読み、最後の要素を返す
+func (p *sqlParser) name() string {
+	t := p.peek()
+	if t.kind != sqlWord && t.kind != sqlIdent {
+		return ""
+	}
+	p.pos++
+	name := t.text
+	for p.peek().is(".") && p.pos+1 < len(p.tokens) {
+		p.pos++
+		name = p.peek().text
+		p.pos++
+	}
+	return name
+}
+
+// group 括弧で囲まれた部分の中身を読む（括弧がなければ nil）
+func (p *sqlParser) group() []sqlToken {
+	if !p.peek().is("(") {
+		return nil
+	}
+	depth := 0
+	for i := p.pos; i < len(p.tokens); i++ {
+		switch {
+		case p.tokens[i].is("("):
+			depth++
+		case p.tokens[i].is(")"):
+			if depth--; depth == 0 {
+				inner := p.tokens[p.pos+1 : i]
+				p.pos = i + 1
+				return inner
+			}
+		}
+	}
+	inner := p.tokens[p.pos+1:]
+	p.pos = len(p.tokens)
+	return inner
+}
+
+// nameList (a, b) の列名の一覧を読む
+func (p *sqlParser) nameList() []string {
+	var names []string
+	for _, part := range splitSQLTopLevel(p.group()) {
+		if len(part) > 0 && (part[0].kind == sqlWord || part[0].kind == sqlIdent) {
+			names = append(names, part[0].text)
+		}
+	}
+	return names
+}
+
+// sqlText 字句を元の SQL に近い形でつなげる
+func sqlText(tokens []sqlToken) string {
+	var sb strings.Builder
+	for i, t := range tokens {
+		text := t.text
+		switch t.kind {
+		case sqlString:
+			text = "'" + text + "'"
+		case sqlIdent:
+			text = `"` + text + `"`
+		}
+		prev := sqlToken{}
+		if i > 0 {
+			prev = tokens[i-1]
+		}
+		if i > 0 && !t.is("(") && !t.is(")") && !t.is(",") && !t.is(".") && !t.is("[") && !t.is("]") &&
+			!prev.is("(") && !prev.is(".") && !prev.is("[") {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(text)
+	}
+	return sb.String()
+}
+
+// 列の型の後ろで制約が始まるキーワード
+var sqlColumnConstraintWords = map[string]bool{
+	"not": true, "null": true, "primary": true, "unique": true, "default": true, "references": true, "check": true,
+	"constraint": true, "auto_increment": true, "autoincrement": true, "collate": true, "generated": true,
+	"identity": true, "comment": true, "on": true, "as": true, "encode": true, "distkey": true, "sortkey": true,
+}
+
+// parseSQLSchema DDL（CREATE TABLE・ALTER TABLE・DROP TABLE・CREATE UNIQUE INDEX）を順に適用する
+func parseSQLSchema(s *schemaBuilder, file *models.File, origin string) {
+	for _, stmt := range splitSQLStatements(tokenizeSQL(file.Content)) {
+		p := &sqlParser{tokens: stmt}
+		source := schemaSource(file, stmt[0].line)
+		switch {
+		case p.accept("create"):
+			p.accept("or", "replace")
+			for p.accept("global") || p.accept("local") || p.accept("temporary") || p.accept("temp") ||
+				p.accept("unlogged") || p.accept("virtual") || p.accept("external") {
+			}
+			switch {
+			case p.accept("table"):
+				parseSQLCreateTable(s, p, origin, source)
+			case p.accept("unique"):
+				p.accept("clustered")
+				p.accept("nonclustered")
+				if p.accept("index") {
+					parseSQLUniqueIndex(s, p)
+				}
+			}
+		case p.accept("alter", "table"):
+			parseSQLAlterTable(s, p, origin, source)
+		case p.accept("drop", "table"):
+			p.accept("if", "exists")
+			for _, part := range splitSQLTopLevel(p.tokens[p.pos:]) {
+				if name := (&sqlParser{tokens: part}).name(); name != "" {
+					s.dropEntity(name)
+				}
+			}
+		case p.accept("rename", "table"):
+			// MySQL の RENAME TABLE a TO b, c TO d
+			for _, part := range splitSQLTopLevel(p.tokens[p.pos:]) {
+				rp := &sqlParser{tokens: part}
+				from := rp.name()
+				if rp.accept("to") {
+					s.renameEntity(from, rp.name())
+				}
+			}
+		}
+	}
+}
+
+// parseSQLCreateTable CREATE TABLE name ( 列と制約 )
+func parseSQLCreateTable(s *schemaBuilder, p *sqlParser, origin, source string) {
+	p.accept("if", "not", "exists")
+	name := p.name()
+	if name == "" {
+		return
+	}
+	// CREATE TABLE a AS SELECT ... や CREATE TABLE a LIKE b は列が分からないので表だけ登録する
+	e := s.entity(name, origin, source)
+	body := p.group()
+	for _, element := range splitSQLTopLevel(body) {
+		parseSQLTableElement(s, e, element, source)
+	}
+}
+
+// parseSQLTableElement CREATE TABLE の括弧内の1要素（列定義または表制約）
+func parseSQLTableElement(s *schemaBuilder, e *SchemaEntity, element []sqlToken, source string) {
+	if len(element) == 0 {
+		return
+	}
+	p := &sqlParser{tokens: element}
+	if p.accept("constraint") {
+		p.name()
+	}
+	switch {
+	case p.accept("primary", "key"):
+		p.accept("clustered")
+		p.accept("nonclustered")
+		e.addPrimaryKey(p.nameList()...)
+	case p.accept("unique"):
+		p.accept("key")
+		p.accept("index")
+		if !p.peek().is("(") {
+			p.name()
+		}
+		if cols := p.nameList(); len(cols) == 1 {
+			if col := e.column(cols[0]); col != nil {
+				col.Unique = true
+			}
+		}
+	case p.accept("foreign", "key"):
+		if !p.peek().is("(") {
+			p.name()
+		}
+		cols := p.nameList()
+		if p.accept("references") {
+			ref := p.name()
+			s.addForeignKey(SchemaRelationship{FromTable: e.Name, FromColumns: cols, ToTable: ref, ToColumns: p.nameList(), Source: source})
+		}
+	case p.peek().is("key") || p.peek().is("index") || p.peek().is("check") || p.peek().is("fulltext") ||
+		p.peek().is("spatial") || p.peek().is("exclude") || p.peek().is("like") || p.peek().is("period"):
+		// MySQL のインデックス定義や CHECK 制約は扱わない
+	default:
+		parseSQLColumn(s, e, p, source)
+	}
+}
+
+// parseSQLColumn 列定義（名前 型 [制約...]）
+func parseSQLColumn(s *schemaBuilder, e *SchemaEntity, p *sqlParser, source string) *SchemaColumn {
+	t := p.peek()
+	if t.kind != sqlWord && t.kind != sqlIdent {
+		return nil
+	}
+	p.pos++
+	col := SchemaColumn{Name: t.text, Nullable: true}
+
+	typeStart := p.pos
+	for !p.done() {
+		next := p.peek()
+		if next.kind == sqlWord && sqlColumnConstraintWords[strings.ToLower(next.text)] {
+			break
+		}
+		// CHARACTER SET utf8 は型の一部ではない（character varying は型）
+		if next.is("character") && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].is("set") || next.is("charset") {
+			break
+		}
+		if next.is("(") {
+			p.group()
+			continue
+		}
+		p.pos++
+	}
+	col.RawType = sqlText(p.tokens[typeStart:p.pos])
+
+	var ref *SchemaRelationship
+	for !p.done() {
+		switch {
+		case p.accept("not", "null"):
+			col.Nullable = false
+		case p.accept("null"):
+			col.Nullable = true
+		case p.accept("primary", "key"):
+			col.PrimaryKey, col.Nullable = true, false
+			p.accept("asc")
+			p.accept("desc")
+		case p.accept("unique"):
+			col.Unique = true
+			p.accept("key")
+		case p.accept("default"):
+			start := p.pos
+			p.accept("-")
+			if p.group() == nil {
+				p.pos++
+				// now() のような関数呼び出し
+				p.group()
+			}
+			if col.Default = sqlText(p.tokens[start:p.pos]); strings.EqualFold(col.Default, "null") {
+				col.Default = ""
+			}
+		case p.accept("references"):
+			to := p.name()
+			ref = &SchemaRelationship{FromTable: e.Name, FromColumns: []string{col.Name}, ToTable: to, ToColumns: p.nameList(), Source: source}
+		case p.accept("check"):
+			p.group()
+		default:
+			p.pos++
+		}
+	}
+	stored := e.setColumn(col)
+	if ref != nil {
+		s.addForeignKey(*ref)
+	}
+	return stored
+}
+
+// parseSQLAlterTable ALTER TABLE name 操作, 操作, ...
+func parseSQLAlterTable(s *schemaBuilder, p *sqlParser, origin, source string) {
+	p.accept("if", "exists")
+	p.accept("only")
+	name := p.name()
+	if name == "" {
+		return
+	}
+	e := s.lookup(name)
+	if e == nil {
+		e = s.entity(name, origin, source)
+	}
+	for _, action := range splitSQLTopLevel(p.tokens[p.pos:]) {
+		ap := &sqlParser{tokens: action}
+		switch {
+		case ap.accept("add"):
+			ap.accept("column")
+			ap.accept("if", "not", "exists")
+			parseSQLTableElement(s, e, ap.tokens[ap.pos:], source)
+		case ap.accept("drop"):
+			if ap.accept("constraint") || ap.accept("index") || ap.accept("primary") || ap.accept("foreign") {
+				continue
+			}
+			ap.accept("column")
+			ap.accept("if", "exists")
+			if col := ap.name(); col != "" {
+				e.dropColumn(col)
+			}
+		case ap.accept("rename", "to"), ap.accept("rename", "as"):
+			to := ap.name()
+			s.renameEntity(e.Name, to)
+			e = s.lookup(to)
+		case ap.accept("rename"):
+			ap.accept("column")
+			from := ap.name()
+			if ap.accept("to") {
+				s.renameColumn(e, from, ap.name())
+			}
+		case ap.accept("alter"):
+			ap.accept("column")
+			col := e.column(ap.name())
+			if col == nil {
+				continue
+			}
+			switch {
+			case ap.accept("set", "not", "null"):
+				col.Nullable = false
+			case ap.accept("drop", "not", "null"):
+				col.Nullable = true
+			case ap.accept("set", "data", "type"), ap.accept("type"):
+				col.RawType = sqlText(ap.tokens[ap.pos:])
+				col.Type = normalizeColumnType(col.RawType)
+			}
+		case ap.accept("modify"):
+			ap.accept("column")
+			parseSQLColumn(s, e, ap, source)
+		case ap.accept("change"):
+			// MySQL の CHANGE old new 定義
+			ap.accept("column")
+			old := ap.name()
+			if c := parseSQLColumn(s, e, ap, source); c != nil && !strings.EqualFold(old, c.Name) {
+				e.dropColumn(old)
+			}
+		}
+	}
+}
+
+// parseSQLUniqueIndex CREATE UNIQUE INDEX name ON table (col) の1列の一意制約を列に反映する
+func parseSQLUniqueIndex(s *schemaBuilder, p *sqlParser) {
+	p.accept("concurrently")
+	p.accept("if", "not", "exists")
+	if !p.peek().is("on") {
+		p.name()
+	}
+	if !p.accept("on") {
+		return
+	}
+	p.accept("only")
+	e := s.lookup(p.name())
+	if e == nil {
+		return
+	}
+	if p.accept("using") {
+		p.pos++
+	}
+	if cols := p.nameList(); len(cols) == 1 {
+		if col := e.column(cols[0]); col != nil {
+			col.Unique = true
+		}
+	}
+}
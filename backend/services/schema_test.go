@@ -0,0 +1,277 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"reverse-engineering-backend/models"
+)
+
+// schemaTables テーブルごとに列を "名前 型" の形で並べる（主キーに PK、一意に UQ、NULL 可に NULL を付ける）
+func schemaTables(m *SchemaModel) map[string][]string {
+	tables := make(map[string][]string)
+	for _, e := range m.Entities {
+		cols := []string{}
+		for _, c := range e.Columns {
+			s := c.Name + " " + c.Type
+			if c.PrimaryKey {
+				s += " PK"
+			}
+			if c.Unique {
+				s += " UQ"
+			}
+			if c.Nullable {
+				s += " NULL"
+			}
+			cols = append(cols, s)
+		}
+		tables[e.Name] = cols
+	}
+	return tables
+}
+
+// schemaRelations 外部キーを "表(列) -> 表(列) 多重度" の形で並べる
+func schemaRelations(rels []SchemaRelationship) []string {
+	var got []string
+	for _, r := range rels {
+		s := r.FromTable + "(" + strings.Join(r.FromColumns, ",") + ") -> " + r.ToTable + "(" + strings.Join(r.ToColumns, ",") + ") " + r.Cardinality
+		if r.Confidence != "" {
+			s += " " + r.Confidence
+		}
+		got = append(got, s)
+	}
+	return got
+}
+
+func TestRecoverSchemaSQL(t *testing.T) {
+	files := []models.File{
+		{Name: "db/migrations/001_init.up.sql", Language: "sql", Content: `
+CREATE TABLE users (
+  id SERIAL PRIMARY KEY,
+  email VARCHAR(255) NOT NULL UNIQUE,
+  name character varying(50)
+);
+CREATE TABLE "posts" (
+  id BIGINT NOT NULL,
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  body TEXT, -- 本文
+  PRIMARY KEY (id)
+);`},
+		// 取り消し用のマイグレーションは適用しない
+		{Name: "db/migrations/001_init.down.sql", Language: "sql", Content: "DROP TABLE posts; DROP TABLE users;"},
+		{Name: "db/migrations/002_comments.up.sql", Language: "sql", Content: `
+CREATE TABLE comments (id BIGINT PRIMARY KEY, post_id BIGINT, author_id INT);
+ALTER TABLE comments ADD CONSTRAINT fk_post FOREIGN KEY (post_id) REFERENCES posts (id);
+ALTER TABLE users ADD COLUMN created_at TIMESTAMP WITH TIME ZONE DEFAULT now();
+ALTER TABLE users DROP COLUMN name;
+CREATE TABLE profiles (id INT PRIMARY KEY, user_id INT UNIQUE, owner_ID bigint);`},
+	}
+	m := RecoverSchema(files)
+
+	want := map[string][]string{
+		"comments": {"id bigint PK", "post_id bigint NULL", "author_id integer NULL"},
+		"posts":    {"id bigint PK", "user_id integer", "body text NULL"},
+		"profiles": {"id integer PK", "user_id integer UQ NULL", "owner_ID bigint NULL"},
+		"users":    {"id integer PK", "email varchar(255) UQ", "created_at timestamp NULL"},
+	}
+	if got := schemaTables(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("tables = %q, want %q", got, want)
+	}
+	if got, want := schemaRelations(m.Relationships), []string{
+		"posts(user_id) -> users(id) many_to_one",
+		"comments(post_id) -> posts(id) many_to_one",
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("relationships = %q, want %q", got, want)
+	}
+	// 型が同じ系統なら high、author のようなテーブルが無い列は推定しない
+	if got, want := schemaRelations(m.InferredForeignKeys), []string{
+		"profiles(user_id) -> users(id) one_to_one high",
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("inferred = %q, want %q", got, want)
+	}
+	if e := m.Entities[3]; !reflect.DeepEqual(e.Origins, []string{"migration"}) || !reflect.DeepEqual(e.Sources, []string{"db/migrations/001_init.up.sql:2"}) {
+		t.Errorf("users origins = %v, sources = %v", e.Origins, e.Sources)
+	}
+}
+
+func TestRecoverSchemaORM(t *testing.T) {
+	files := []models.File{
+		{Name: "models/user.go", Language: "go", Content: `package models
+
+import "gorm.io/gorm"
+
+type Team struct {
+	gorm.Model
+	Name string ` + "`gorm:\"size:100;uniqueIndex\"`" + `
+}
+
+type Member struct {
+	ID     uint ` + "`gorm:\"primaryKey\"`" + `
+	TeamID uint
+	Team   Team
+	Nick   *string
+}
+
+func (Member) TableName() string { return "team_members" }
+`},
+		{Name: "shop/models.py", Language: "python", Content: `from django.db import models
+
+class Category(models.Model):
+    title = models.CharField(max_length=80)
+
+class Product(models.Model):
+    category = models.ForeignKey(Category, on_delete=models.CASCADE)
+    price = models.DecimalField(max_digits=8, decimal_places=2, null=True)
+
+    class Meta:
+        db_table = "products"
+`},
+		{Name: "src/Order.java", Language: "java", Content: `package shop;
+
+@Entity
+@Table(name = "orders")
+public class Order {
+    @Id
+    @GeneratedValue
+    private Long id;
+
+    @Column(name = "total_amount", nullable = false)
+    private BigDecimal total;
+
+    @ManyToOne
+    @JoinColumn(name = "product_id")
+    private Product product;
+}
+`},
+	}
+	m := RecoverSchema(files)
+
+	tables := schemaTables(m)
+	for table, want := range map[string][]string{
+		"teams":         {"id bigint PK", "created_at timestamp NULL", "updated_at timestamp NULL", "deleted_at timestamp NULL", "name varchar(100) UQ NULL"},
+		"team_members":  {"id bigint PK", "team_id bigint NULL", "nick text NULL"},
+		"shop_category": {"id bigint PK", "title varchar(80)"},
+		"products":      {"id bigint PK", "category_id bigint", "price decimal(8,2) NULL"},
+		"orders":        {"id bigint PK", "total_amount decimal(19,2)", "product_id bigint NULL"},
+	} {
+		if got := tables[table]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %q, want %q", table, got, want)
+		}
+	}
+	if got, want := schemaRelations(m.Relationships), []string{
+		"team_members(team_id) -> teams(id) many_to_one",
+		"products(category_id) -> shop_category(id) many_to_one",
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("relationships = %q, want %q", got, want)
+	}
+	// Java のエンティティから Django のモデルへの参照は列名から推定する
+	if got, want := schemaRelations(m.InferredForeignKeys), []string{"orders(product_id) -> products(id) many_to_one high"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("inferred = %q, want %q", got, want)
+	}
+}
+
+func TestRecoverSchemaMigrations(t *testing.T) {
+	files := []models.File{
+		{Name: "db/migrate/20240101_create_accounts.rb", Language: "ruby", Content: `class CreateAccounts < ActiveRecord::Migration[7.1]
+  def change
+    create_table :accounts do |t|
+      t.string :login, null: false, limit: 40
+      t.references :owner, foreign_key: { to_table: :users }
+      t.timestamps
+    end
+    create_table :users
+  end
+end
+`},
+		{Name: "db/migrate/20240102_rename.rb", Language: "ruby", Content: `class Rename < ActiveRecord::Migration[7.1]
+  def up
+    rename_column :accounts, :login, :username
+    add_index :accounts, :username, unique: true
+  end
+
+  def down
+    drop_table :accounts
+  end
+end
+`},
+		{Name: "alembic/versions/0001_items.py", Language: "python", Content: `from alembic import op
+import sqlalchemy as sa
+
+def upgrade():
+    op.create_table(
+        "items",
+        sa.Column("id", sa.Integer(), primary_key=True),
+        sa.Column("sku", sa.String(32), nullable=False),
+        sa.Column("account_id", sa.BigInteger(), sa.ForeignKey("accounts.id")),
+    )
+    op.add_column("items", sa.Column("note", sa.Text()))
+
+def downgrade():
+    op.drop_table("items")
+`},
+	}
+	m := RecoverSchema(files)
+
+	want := map[string][]string{
+		"accounts": {"id bigint PK", "username varchar(40) UQ", "owner_id bigint NULL", "created_at timestamp", "updated_at timestamp"},
+		"items":    {"id integer PK", "sku varchar(32)", "account_id bigint NULL", "note text NULL"},
+		"users":    {"id bigint PK"},
+	}
+	if got := schemaTables(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("tables = %q, want %q", got, want)
+	}
+	if got, want := schemaRelations(m.Relationships), []string{
+		"items(account_id) -> accounts(id) many_to_one",
+		"accounts(owner_id) -> users(id) many_to_one",
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("relationships = %q, want %q", got, want)
+	}
+}
+
+func TestSchemaDiagram(t *testing.T) {
+	m := RecoverSchema([]models.File{{Name: "schema.sql", Language: "sql", Content: `
+CREATE TABLE users (id INT PRIMARY KEY);
+CREATE TABLE posts (id INT PRIMARY KEY, user_id INT REFERENCES users, editor_id INT);
+CREATE TABLE editors (id INT PRIMARY KEY);`}})
+	d := m.Diagram()
+	if d.Type != "er" || len(d.Nodes) != 3 {
+		t.Fatalf("diagram = %+v", d)
+	}
+	// 定義された外部キーは references、推定したものは inferred
+	if got, want := diagramEdges(d), []string{"posts -> users (references)", "posts -> editors (inferred)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("edges = %q, want %q", got, want)
+	}
+	if got := d.Nodes[1].Attributes; !reflect.DeepEqual(got[1], DiagramAttribute{Name: "user_id", Type: "integer", Keys: []string{"FK"}}) {
+		t.Errorf("posts attributes = %+v", got)
+	}
+}
+
+func TestNormalizeColumnType(t *testing.T) {
+	tests := []struct {
+		raw, want string
+	}{
+		{"INT UNSIGNED", "integer"},
+		{"character varying(20)", "varchar(20)"},
+		{"NUMERIC(10, 2)", "decimal(10,2)"},
+		{"timestamp with time zone", "timestamp"},
+		{"text[]", "text[]"},
+		{"geometry(Point)", "geometry(point)"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeColumnType(tt.raw); got != tt.want {
+			t.Errorf("normalizeColumnType(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+	for name, want := range map[string]string{"UserID": "user_id", "HTTPServer": "http_server", "ID": "id", "Order2Item": "order2_item"} {
+		if got := snakeCase(name); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", name, got, want)
+		}
+	}
+	for name, want := range map[string]string{"category": "categories", "address": "addresses", "day": "days", "analysis": "analyses"} {
+		if got := pluralizeTableName(name); got != want {
+			t.Errorf("pluralizeTableName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+
+	"reverse-engineering-backend/models"
+)
+
+// SecretScanFileResult ファイルごとの検出結果
+type SecretScanFileResult struct {
+	FileID   uint            `json:"file_id"`
+	Name     string          `json:"name"`
+	Findings []SecretFinding `json:"findings"`
+}
+
+// runSecretScan プロジェクト内のすべてのファイル（派生ファイルを含む）から秘密情報を探す
+// バイナリファイルは保存先から読み込み、行と列の代わりにオフセットで位置を示す
+func (w *AnalysisWorker) runSecretScan(files []models.File) (string, error) {
+	results := []SecretScanFileResult{}
+	ruleCounts := make(map[string]int)
+	severityCounts := make(map[string]int)
+	fingerprints := make(map[string]bool)
+	scanned, total := 0, 0
+	for _, file := range files {
+		content, text := file.Content, true
+		if content == "" {
+			data, err := os.ReadFile(file.Path)
+			if err != nil {
+				continue
+			}
+			content, text = string(data), false
+		}
+		scanned++
+
+		findings := ScanSecrets(file.Name, content, text)
+		if len(findings) == 0 {
+			continue
+		}
+		for _, f := range findings {
+			ruleCounts[f.Rule]++
+			severityCounts[f.Severity]++
+			fingerprints[f.Fingerprint] = true
+		}
+		total += len(findings)
+		results = append(results, SecretScanFileResult{FileID: file.ID, Name: file.Name, Findings: findings})
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"files": results,
+		"summary": map[string]interface{}{
+			"files_scanned":      scanned,
+			"files_with_secrets": len(results),
+			"findings":           total,
+			"unique_secrets":     len(fingerprints),
+			"rule_hits":          ruleCounts,
+			"severity":           severityCounts,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SecretRule 秘密情報の検出ルール
+// Group は秘密そのものにあたるサブマッチの番号（0 ならマッチ全体）。MinEntropy が 0 より大きいルールは
+// その値のシャノンエントロピー（1文字あたりのビット数）が下回るものとプレースホルダらしい値を除く
+type SecretRule struct {
+	ID          string
+	Description string
+	Severity    string // high, medium, low
+	Pattern     *regexp.Regexp
+	Group       int
+	MinEntropy  float64
+}
+
+// SecretFinding 検出した秘密情報（値そのものは持たず、伏せ字とフィンガープリントだけを返す）
+type SecretFinding struct {
+	Rule        string  `json:"rule"`
+	Description string  `json:"description"`
+	Severity    string  `json:"severity"`
+	Line        int     `json:"line,omitempty"`
+	Column      int     `json:"column,omitempty"`
+	Offset      int     `json:"offset"`
+	Length      int     `json:"length"`
+	Preview     string  `json:"preview"`
+	Fingerprint string  `json:"fingerprint"`
+	Entropy     float64 `json:"entropy"`
+}
+
+// secretAssignmentKeys 代入先の名前から秘密情報らしいと判断するキーワード
+const secretAssignmentKeys = `(?:password|passwd|pwd|secret|token|api_?key|apikey|access_?key|private_?key|client_?secret|auth_?key|credentials?)`
+
+// secretRules 検出ルール（具体的なルールを先に置く。範囲が重なるときは先のルールを採る）
+var secretRules = []SecretRule{
+	{
+		ID: "private_key", Description: "Private key block", Severity: "high",
+		Pattern: regexp.MustCompile(`(?s)-----BEGIN (?:RSA |EC |DSA |OPENSSH |ENCRYPTED |PGP )?PRIVATE KEY(?: BLOCK)?-----.*?-----END (?:RSA |EC |DSA |OPENSSH |ENCRYPTED |PGP )?PRIVATE KEY(?: BLOCK)?-----`),
+	},
+	{
+		ID: "aws_access_key_id", Description: "AWS access key ID", Severity: "high",
+		Pattern: regexp.MustCompile(`\b((?:AKIA|ASIA|ABIA|ACCA)[A-Z0-9]{16})\b`), Group: 1,
+	},
+	{
+		ID: "aws_secret_access_key", Description: "AWS secret access key", Severity: "high",
+		Pattern: regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key['"]?\s*(?::=|=>|[:=])\s*['"]?([A-Za-z0-9/+]{40})(?:[^A-Za-z0-9/+=]|$)`), Group: 1,
+		MinEntropy: 3.5,
+	},
+	{
+		ID: "gcp_api_key", Description: "Google Cloud API key", Severity: "high",
+		Pattern: regexp.MustCompile(`\b(AIza[0-9A-Za-z_\-]{35})`), Group: 1,
+	},
+	{
+		ID: "azure_storage_key", Description: "Azure storage account key", Severity: "high",
+		Pattern: regexp.MustCompile(`(?i)AccountKey=([A-Za-z0-9+/]{86}==)`), Group: 1,
+	},
+	{
+		ID: "github_token", Description: "GitHub token", Severity: "high",
+		Pattern: regexp.MustCompile(`\b((?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{82})\b`), Group: 1,
+	},
+	{
+		ID: "slack_token", Description: "Slack token", Severity: "high",
+		Pattern: regexp.MustCompile(`\b(xox[abposr]-[A-Za-z0-9-]{10,})`), Group: 1,
+	},
+	{
+		ID: "stripe_key", Description: "Stripe live secret key", Severity: "high",
+		Pattern: regexp.MustCompile(`\b((?:sk|rk)_live_[A-Za-z0-9]{24,})`), Group: 1,
+	},
+	{
+		ID: "openai_api_key", Description: "OpenAI API key", Severity: "high",
+		Pattern: regexp.MustCompile(`\b(sk-(?:proj|svcacct|admin)-[A-Za-z0-9_\-]{40,}|sk-[A-Za-z0-9]{20}T3BlbkFJ[A-Za-z0-9]{20})`), Group: 1,
+	},
+	{
+		ID: "jwt", Description: "JSON Web Token", Severity: "medium",
+		Pattern: regexp.MustCompile(`\b(eyJ[A-Za-z0-9_\-]{10,}\.eyJ[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,})`), Group: 1,
+	},
+	{
+		ID: "connection_string", Description: "Credentials in connection URI", Severity: "high",
+		Pattern: regexp.MustCompile(`(?i)\b(?:postgres(?:ql)?|mysql|mariadb|mongodb(?:\+srv)?|rediss?|amqps?|mssql|sqlserver|ftp|smtp|ldaps?)://[^\s:/@'"]+:([^\s@'"/]+)@[^\s'"]+`), Group: 1,
+		MinEntropy: 1.5,
+	},
+	{
+		ID: "connection_string", Description: "Password in connection string", Severity: "high",
+		Pattern: regexp.MustCompile(`(?i)(?:\bjdbc:[a-z0-9]+:[^\s'"]*?[;?&]|(?:Server|Data Source|Host)=[^'"\n]*?;\s*)(?:password|pwd)=([^;&'"\s]+)`), Group: 1,
+		MinEntropy: 1.5,
+	},
+	{
+		ID: "password_assignment", Description: "Hard-coded credential", Severity: "medium",
+		Pattern: regexp.MustCompile(`(?i)\b[\w.-]*` + secretAssignmentKeys + `[\w.-]*['"]?\s*(?::=|=>|[:=])\s*['"]([^'"\s]{8,})['"]`), Group: 1,
+		MinEntropy: 3.0,
+	},
+	{
+		ID: "password_assignment", Description: "Hard-coded credential", Severity: "medium",
+		Pattern: regexp.MustCompile(`(?im)^\s*(?:export\s+)?[\w.-]*` + secretAssignmentKeys + `[\w.-]*\s*[:=]\s*([^\s'"#,;{}()\[\]<>$]{8,})\s*$`), Group: 1,
+		MinEntropy: 3.5,
+	},
+	{
+		ID: "high_entropy_string", Description: "High-entropy string literal", Severity: "low",
+		Pattern: regexp.MustCompile(`['"` + "`" + `]([A-Za-z0-9+/_\-]{32,}={0,2})['"` + "`" + `]`), Group: 1,
+		MinEntropy: 4.5,
+	},
+}
+
+// secretPlaceholders ダミー値に使われる語（エントロピーで判定するルールだけに適用する）
+var secretPlaceholders = []string{"example", "changeme", "change_me", "placeholder", "dummy", "your", "xxxx", "****", "redacted", "sample", "<", "${", "{{", "%("}
+
+// secretIdentifierChain 変数やプロパティの参照（config.db.password など）は値ではない
+var secretIdentifierChain = regexp.MustCompile(`^[A-Za-z_$][\w$]*(?:\.[A-Za-z_$][\w$]*)+$`)
+
+// entropyExemptFiles ハッシュ値を大量に含むロックファイル（high_entropy_string を適用しない）
+var entropyExemptFiles = map[string]bool{
+	"go.sum": true, "package-lock.json": true, "yarn.lock": true, "pnpm-lock.yaml": true,
+	"composer.lock": true, "cargo.lock": true, "poetry.lock": true, "gemfile.lock": true, "pipfile.lock": true,
+}
+
+// ScanSecrets 内容から秘密情報を探す（name はロックファイルの判定に使う。text でなければ行と列を付けない）
+func ScanSecrets(name, content string, text bool) []SecretFinding {
+	spans := findSecretSpans(name, content)
+	if len(spans) == 0 {
+		return nil
+	}
+
+	var lineStarts []int
+	if text {
+		lineStarts = []int{0}
+		for i := 0; i < len(content); i++ {
+			if content[i] == '\n' {
+				lineStarts = append(lineStarts, i+1)
+			}
+		}
+	}
+
+	findings := make([]SecretFinding, 0, len(spans))
+	for _, s := range spans {
+		value := content[s.start:s.end]
+		sum := sha256.Sum256([]byte(value))
+		f := SecretFinding{
+			Rule:        s.rule.ID,
+			Description: s.rule.Description,
+			Severity:    s.rule.Severity,
+			Offset:      s.start,
+			Length:      s.end - s.start,
+			Preview:     maskSecret(value),
+			Fingerprint: hex.EncodeToString(sum[:6]),
+			Entropy:     roundMetric(shannonEntropy(value)),
+		}
+		if text {
+			line := sort.Search(len(lineStarts), func(i int) bool { return lineStarts[i] > s.start })
+			f.Line = line
+			f.Column = s.start - lineStarts[line-1] + 1
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// RedactSecrets 検出した秘密情報を [REDACTED:ルール] に置き換え、置き換えた数を返す
+// 複数行にわたる秘密（秘密鍵など）は改行を残して行番号がずれないようにする
+func RedactSecrets(content string) (string, int) {
+	spans := findSecretSpans("", content)
+	if len(spans) == 0 {
+		return content, 0
+	}
+	var b strings.Builder
+	b.Grow(len(content))
+	last := 0
+	for _, s := range spans {
+		b.WriteString(content[last:s.start])
+		b.WriteString("[REDACTED:" + s.rule.ID + "]")
+		b.WriteString(strings.Repeat("\n", strings.Count(content[s.start:s.end], "\n")))
+		last = s.end
+	}
+	b.WriteString(content[last:])
+	return b.String(), len(spans)
+}
+
+type secretSpan struct {
+	start, end int
+	rule       *SecretRule
+}
+
+// findSecretSpans すべてのルールを適用し、重ならない秘密の範囲を先頭から順に返す
+func findSecretSpans(name, content string) []secretSpan {
+	exempt := entropyExemptFiles[strings.ToLower(path.Base(strings.ReplaceAll(name, "\\", "/")))]
+	var candidates []secretSpan
+	for i := range secretRules {
+		rule := &secretRules[i]
+		if exempt && rule.ID == "high_entropy_string" {
+			continue
+		}
+		for _, m := range rule.Pattern.FindAllStringSubmatchIndex(content, -1) {
+			start, end := m[2*rule.Group], m[2*rule.Group+1]
+			if start < 0 || !plausibleSecret(rule, content[start:end]) {
+				continue
+			}
+			candidates = append(candidates, secretSpan{start: start, end: end, rule: rule})
+		}
+	}
+
+	// 先のルールを優先して、既に採った範囲と重なる候補を捨てる
+	var accepted []secretSpan
+	for _, c := range candidates {
+		overlaps := false
+		for _, a := range accepted {
+			if c.start < a.end && a.start < c.end {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			accepted = append(accepted, c)
+		}
+	}
+	sort.Slice(accepted, func(i, j int) bool { return accepted[i].start < accepted[j].start })
+	return accepted
+}
+
+// plausibleSecret エントロピーで判定するルールの値からダミー値や参照式を除く
+func plausibleSecret(rule *SecretRule, value string) bool {
+	if rule.MinEntropy <= 0 {
+		return true
+	}
+	if shannonEntropy(value) < rule.MinEntropy || secretIdentifierChain.MatchString(value) {
+		return false
+	}
+	lower := strings.ToLower(value)
+	for _, p := range secretPlaceholders {
+		if strings.Contains(lower, p) {
+			return false
+		}
+	}
+	if rule.ID == "high_entropy_string" {
+		// SRI のハッシュ（sha512-...）や区切りのない識別子は除く
+		if strings.HasPrefix(lower, "sha1-") || strings.HasPrefix(lower, "sha256-") || strings.HasPrefix(lower, "sha384-") || strings.HasPrefix(lower, "sha512-") {
+			return false
+		}
+		// 文字表（ABCDEFG...）のように連続した文字が並ぶものは鍵ではない
+		sequential := 0
+		for i := 1; i < len(value); i++ {
+			if value[i] == value[i-1]+1 {
+				sequential++
+			}
+		}
+		if sequential*2 > len(value) {
+			return false
+		}
+		var upper, lowerCase, digit bool
+		for _, r := range value {
+			switch {
+			case r >= 'A' && r <= 'Z':
+				upper = true
+			case r >= 'a' && r <= 'z':
+				lowerCase = true
+			case r >= '0' && r <= '9':
+				digit = true
+			}
+		}
+		return upper && lowerCase && digit
+	}
+	return true
+}
+
+// shannonEntropy 1文字あたりのシャノンエントロピー（ビット）
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[byte]int)
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	entropy := 0.0
+	n := float64(len(s))
+	for _, c := range counts {
+		p := float64(c) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// maskSecret 先頭の数文字だけを残して伏せ字にする
+func maskSecret(value string) string {
+	keep := 4
+	if len(value) < 12 {
+		keep = len(value) / 4
+	}
+	return value[:keep] + strings.Repeat("*", min(len(value)-keep, 8))
+}
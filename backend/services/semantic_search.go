@@ -0,0 +1,384 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"reverse-engineering-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// コード片の分け方
+const (
+	chunkLines    = 40   // 1つのコード片の行数
+	chunkOverlap  = 10   // 前のコード片と重ねる行数（境目にまたがる処理も見つかるように）
+	chunkMaxBytes = 6000 // 埋め込みモデルの入力の上限を超えないように、これより長い行は切り詰める
+)
+
+// vectorStoreEnabled pgvector 拡張が使えるか（InitVectorStore で決まる）
+var vectorStoreEnabled bool
+
+// InitVectorStore pgvector 拡張を有効にし、code_chunks に vector 型の列を足す
+// 拡張が入っていないデータベースでは、検索時に埋め込みを読み込んでプロセス内で類似度を求める
+func InitVectorStore(db *gorm.DB) bool {
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS vector").Error; err != nil {
+		log.Println("pgvector is not available, semantic search falls back to the in-process index:", err)
+		vectorStoreEnabled = false
+		return false
+	}
+	// モデルによって次元数が違うので列の次元は固定せず、次元ごとに固定長へキャストした式で索引を作る
+	if err := db.Exec("ALTER TABLE code_chunks ADD COLUMN IF NOT EXISTS embedding_vector vector").Error; err != nil {
+		log.Println("Failed to add the vector column, semantic search falls back to the in-process index:", err)
+		vectorStoreEnabled = false
+		return false
+	}
+	// 拡張を入れる前に索引したコード片を補う
+	if err := db.Exec("UPDATE code_chunks SET embedding_vector = embedding::vector WHERE embedding_vector IS NULL").Error; err != nil {
+		log.Println("Failed to fill the vector column, semantic search falls back to the in-process index:", err)
+		vectorStoreEnabled = false
+		return false
+	}
+	vectorStoreEnabled = true
+
+	var dimensions []int
+	if err := db.Model(&models.CodeChunk{}).Distinct("dimensions").Pluck("dimensions", &dimensions).Error; err != nil {
+		log.Println("Failed to list embedding dimensions:", err)
+	}
+	for _, n := range dimensions {
+		ensureVectorIndex(db, n)
+	}
+	return true
+}
+
+// maxIndexedDimensions pgvector の HNSW 索引が扱える vector の次元数の上限
+const maxIndexedDimensions = 2000
+
+// vectorIndexes 索引を作成済みの次元数
+var vectorIndexes sync.Map
+
+// ensureVectorIndex 次元数 n のコード片に、vector(n) にキャストした式の HNSW 索引を作る
+// SearchCode は同じ式で並べ替えるので、この索引を使って近いものから読む
+func ensureVectorIndex(db *gorm.DB, n int) {
+	if !vectorStoreEnabled || n <= 0 || n > maxIndexedDimensions {
+		return
+	}
+	if _, done := vectorIndexes.Load(n); done {
+		return
+	}
+	err := db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_code_chunks_embedding_%d ON code_chunks USING hnsw ((embedding_vector::vector(%d)) vector_cosine_ops) WHERE dimensions = %d", n, n, n)).Error
+	if err != nil {
+		log.Printf("Failed to create the vector index for %d dimensions: %v", n, err)
+		return
+	}
+	vectorIndexes.Store(n, true)
+}
+
+// CodeSearchResult 意味検索で見つかったコード片
+type CodeSearchResult struct {
+	FileID    uint    `json:"file_id"`
+	FileName  string  `json:"file_name"`
+	Language  string  `json:"language"`
+	StartLine int     `json:"start_line"`
+	EndLine   int     `json:"end_line"`
+	Snippet   string  `json:"snippet"`
+	Score     float64 `json:"score"` // コサイン類似度
+}
+
+// codeChunkText 埋め込みを計算する前のコード片
+type codeChunkText struct {
+	startLine, endLine int
+	content            string
+}
+
+// chunkCode 内容を重なりのある行の窓に分ける（空白だけの窓は除く）
+func chunkCode(content string) []codeChunkText {
+	lines := strings.Split(strings.TrimRight(content, "\r\n"), "\n")
+	var chunks []codeChunkText
+	for start := 0; start < len(lines); start += chunkLines - chunkOverlap {
+		end := min(start+chunkLines, len(lines))
+		text := strings.Join(lines[start:end], "\n")
+		if len(text) > chunkMaxBytes {
+			text = strings.ToValidUTF8(text[:chunkMaxBytes], "")
+		}
+		if strings.TrimSpace(text) != "" {
+			chunks = append(chunks, codeChunkText{startLine: start + 1, endLine: end, content: text})
+		}
+		if end == len(lines) {
+			break
+		}
+	}
+	return chunks
+}
+
+// RemoveFileChunks ファイルのコード片を意味検索のインデックスから削除する
+func RemoveFileChunks(db *gorm.DB, fileID uint) error {
+	return db.Where("file_id = ?", fileID).Delete(&models.CodeChunk{}).Error
+}
+
+// pendingChunkFiles 使っているモデルの埋め込みがまだ無いファイル
+func pendingChunkFiles(db *gorm.DB, embeddings *EmbeddingService) *gorm.DB {
+	return db.Model(&models.File{}).
+		Where("content <> ''").
+		Where("id NOT IN (?)", db.Model(&models.CodeChunk{}).Select("file_id").Where("model = ?", embeddings.Model()))
+}
+
+// PendingChunkFiles プロジェクトのうち、まだ索引していないファイルの数（検索結果に含まれないファイル）
+func PendingChunkFiles(db *gorm.DB, embeddings *EmbeddingService, projectID uint) (int64, error) {
+	var count int64
+	err := pendingChunkFiles(db, embeddings).Where("project_id = ?", projectID).Count(&count).Error
+	return count, err
+}
+
+// IndexProjectChunks 使っているモデルの埋め込みがまだ無いファイルをコード片に分けて索引する
+// 埋め込みの計算には外部の API を使うことがあるため、リクエストの中ではなく ChunkIndexer から呼び出す
+func IndexProjectChunks(ctx context.Context, db *gorm.DB, embeddings *EmbeddingService, projectID uint) error {
+	var files []models.File
+	err := pendingChunkFiles(db, embeddings).Select("id, project_id, name, content").
+		Where("project_id = ?", projectID).
+		Find(&files).Error
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		chunks := chunkCode(file.Content)
+		if len(chunks) == 0 {
+			continue
+		}
+		// ファイル名も手がかりになるので、埋め込みの入力の先頭に付ける
+		inputs := make([]string, len(chunks))
+		for i, chunk := range chunks {
+			inputs[i] = file.Name + "\n" + chunk.content
+		}
+		vectors, err := embeddings.Embed(ctx, inputs)
+		if err != nil {
+			return err
+		}
+
+		records := make([]models.CodeChunk, len(chunks))
+		for i, chunk := range chunks {
+			records[i] = models.CodeChunk{
+				ProjectID:  projectID,
+				FileID:     file.ID,
+				StartLine:  chunk.startLine,
+				EndLine:    chunk.endLine,
+				Content:    chunk.content,
+				Model:      embeddings.Model(),
+				Dimensions: len(vectors[i]),
+				Embedding:  formatVector(vectors[i]),
+			}
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// 前のモデルで計算した埋め込みは入れ替える
+			if err := RemoveFileChunks(tx, file.ID); err != nil {
+				return err
+			}
+			if err := tx.CreateInBatches(records, 200).Error; err != nil {
+				return err
+			}
+			if vectorStoreEnabled {
+				return tx.Exec("UPDATE code_chunks SET embedding_vector = embedding::vector WHERE file_id = ?", file.ID).Error
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		ensureVectorIndex(db, len(vectors[0]))
+	}
+	return nil
+}
+
+// chunkIndexInterval アップロードの通知が無くても、索引していないファイルを探し直す間隔
+const chunkIndexInterval = time.Minute
+
+// chunkIndexWake 索引すべきファイルが増えたことを ChunkIndexer に知らせる
+var chunkIndexWake = make(chan struct{}, 1)
+
+// ScheduleChunkIndexing ファイルの追加後に呼び出し、ChunkIndexer に索引を始めさせる（待たずに戻る）
+func ScheduleChunkIndexing() {
+	select {
+	case chunkIndexWake <- struct{}{}:
+	default:
+	}
+}
+
+// ChunkIndexer 埋め込みがまだ無いファイルをバックグラウンドで順に索引する
+// 1つのゴルーチンで処理するので、同じファイルを同時に2回埋め込むことはない
+type ChunkIndexer struct {
+	db         *gorm.DB
+	embeddings *EmbeddingService
+}
+
+func NewChunkIndexer(db *gorm.DB) *ChunkIndexer {
+	return &ChunkIndexer{
+		db:         db,
+		embeddings: NewEmbeddingService(),
+	}
+}
+
+// Run 起動時に既存のファイルを索引し、その後は通知か一定時間ごとに新しいファイルを索引する（ctxがキャンセルされるまで戻らない）
+func (ix *ChunkIndexer) Run(ctx context.Context) {
+	for {
+		if err := ix.indexPending(ctx); err != nil && ctx.Err() == nil {
+			log.Println("Failed to index code chunks:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-chunkIndexWake:
+		case <-time.After(chunkIndexInterval):
+		}
+	}
+}
+
+// indexPending 索引していないファイルを持つプロジェクトを順に索引する
+// 1つのプロジェクトで失敗しても（埋め込み API のエラーなど）他のプロジェクトは続ける
+func (ix *ChunkIndexer) indexPending(ctx context.Context) error {
+	var projectIDs []uint
+	if err := pendingChunkFiles(ix.db, ix.embeddings).Distinct("project_id").Pluck("project_id", &projectIDs).Error; err != nil {
+		return err
+	}
+	for _, projectID := range projectIDs {
+		if err := IndexProjectChunks(ctx, ix.db, ix.embeddings, projectID); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			log.Printf("Failed to index code chunks of project %d: %v", projectID, err)
+		}
+	}
+	return nil
+}
+
+// SearchCode 検索語の埋め込みに近い順にコード片を返す（language が空でなければその言語のファイルだけ）
+func SearchCode(ctx context.Context, db *gorm.DB, embeddings *EmbeddingService, projectID uint, query, language string, limit int) ([]CodeSearchResult, error) {
+	vectors, err := embeddings.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	queryVector := vectors[0]
+	// 語を1つも含まない検索語（記号やキーワードだけ）は長さ0のベクトルになり、類似度が定まらない
+	if dotProduct(queryVector, queryVector) == 0 {
+		return []CodeSearchResult{}, nil
+	}
+
+	scope := db.Model(&models.CodeChunk{}).
+		Joins("JOIN files ON files.id = code_chunks.file_id AND files.deleted_at IS NULL").
+		Where("code_chunks.project_id = ? AND code_chunks.model = ? AND code_chunks.dimensions = ?", projectID, embeddings.Model(), len(queryVector))
+	if language != "" {
+		scope = scope.Where("files.language = ?", language)
+	}
+
+	type row struct {
+		FileID    uint
+		FileName  string
+		Language  string
+		StartLine int
+		EndLine   int
+		Content   string
+		Embedding string
+		Distance  float64
+		Score     float64
+	}
+	var rows []row
+	if vectorStoreEnabled {
+		// <=> はコサイン距離。ensureVectorIndex の索引と同じ式で距離の小さい順に並べる
+		// 部分索引の条件と一致させるため、次元数は定数として書く
+		n := len(queryVector)
+		err = scope.Where(fmt.Sprintf("code_chunks.dimensions = %d AND code_chunks.embedding_vector IS NOT NULL", n)).
+			Select(fmt.Sprintf("code_chunks.file_id, files.name AS file_name, files.language, code_chunks.start_line, code_chunks.end_line, code_chunks.content, code_chunks.embedding_vector::vector(%d) <=> ?::vector(%d) AS distance", n, n), formatVector(queryVector)).
+			Order("distance").Limit(limit).Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for i := range rows {
+			rows[i].Score = 1 - rows[i].Distance
+		}
+	} else {
+		err = scope.Select("code_chunks.file_id, files.name AS file_name, files.language, code_chunks.start_line, code_chunks.end_line, code_chunks.content, code_chunks.embedding").
+			Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for i := range rows {
+			vector, err := parseVector(rows[i].Embedding)
+			if err != nil {
+				return nil, err
+			}
+			rows[i].Score = dotProduct(queryVector, vector)
+		}
+		sort.SliceStable(rows, func(i, j int) bool { return rows[i].Score > rows[j].Score })
+		if len(rows) > limit {
+			rows = rows[:limit]
+		}
+	}
+
+	results := make([]CodeSearchResult, 0, len(rows))
+	for _, r := range rows {
+		results = append(results, CodeSearchResult{
+			FileID:    r.FileID,
+			FileName:  r.FileName,
+			Language:  r.Language,
+			StartLine: r.StartLine,
+			EndLine:   r.EndLine,
+			Snippet:   r.Content,
+			Score:     roundScore(r.Score),
+		})
+	}
+	return results, nil
+}
+
+// formatVector pgvector の入力形式にする
+func formatVector(v []float32) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, x := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(x), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// parseVector formatVector の逆
+func parseVector(s string) ([]float32, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("invalid vector: %.20q", s)
+	}
+	s = s[1 : len(s)-1]
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	v := make([]float32, len(parts))
+	for i, part := range parts {
+		x, err := strconv.ParseFloat(strings.TrimSpace(part), 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vector element %q: %w", part, err)
+		}
+		v[i] = float32(x)
+	}
+	return v, nil
+}
+
+// dotProduct 長さ1に正規化したベクトルどうしならコサイン類似度になる
+func dotProduct(a, b []float32) float64 {
+	var sum float64
+	for i := range min(len(a), len(b)) {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
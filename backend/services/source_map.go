@@ -0,0 +1,414 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// SourceMap Source Map v3（インデックスマップを含む）
+type SourceMap struct {
+	Version        int                `json:"version"`
+	File           string             `json:"file"`
+	SourceRoot     string             `json:"sourceRoot"`
+	Sources        []string           `json:"sources"`
+	SourcesContent []*string          `json:"sourcesContent"`
+	Names          []string           `json:"names"`
+	Mappings       string             `json:"mappings"`
+	Sections       []SourceMapSection `json:"sections,omitempty"`
+}
+
+// SourceMapSection インデックスマップのセクション
+type SourceMapSection struct {
+	Offset struct {
+		Line   int `json:"line"`
+		Column int `json:"column"`
+	} `json:"offset"`
+	Map *SourceMap `json:"map"`
+}
+
+// SourceMapSegment mappings の1セグメント（すべて0始まり）
+type SourceMapSegment struct {
+	GeneratedLine   int
+	GeneratedColumn int
+	Source          int // -1 は対応する元ソース無し
+	SourceLine      int
+	SourceColumn    int
+}
+
+// ReconstructedSource ソースマップから復元したファイル
+type ReconstructedSource struct {
+	Path string `json:"path"`
+	// FromMappings sourcesContent が無く、mappings と生成コードから近似的に復元した場合 true
+	FromMappings bool   `json:"from_mappings"`
+	Content      string `json:"-"`
+}
+
+var sourceMappingURLPattern = regexp.MustCompile(`(?m)^[ \t]*//[#@][ \t]*sourceMappingURL=(\S+)[ \t]*$`)
+
+// ParseSourceMap JSONをパースし、インデックスマップは単一のマップに平坦化する
+func ParseSourceMap(data []byte) (*SourceMap, error) {
+	// XSSI対策のプレフィックス ")]}'" を除去
+	text := strings.TrimPrefix(strings.TrimSpace(string(data)), ")]}'")
+
+	var sm SourceMap
+	if err := json.Unmarshal([]byte(text), &sm); err != nil {
+		return nil, fmt.Errorf("invalid source map: %w", err)
+	}
+	if sm.Version != 3 {
+		return nil, fmt.Errorf("unsupported source map version: %d", sm.Version)
+	}
+	if len(sm.Sections) > 0 {
+		return flattenSourceMapSections(&sm)
+	}
+	if len(sm.Sources) == 0 {
+		return nil, errors.New("source map has no sources")
+	}
+	return &sm, nil
+}
+
+func flattenSourceMapSections(index *SourceMap) (*SourceMap, error) {
+	flat := &SourceMap{Version: 3, File: index.File}
+	var segments []SourceMapSegment
+
+	for _, section := range index.Sections {
+		if section.Map == nil {
+			continue
+		}
+		child := section.Map
+		if len(child.Sections) > 0 {
+			var err error
+			if child, err = flattenSourceMapSections(child); err != nil {
+				return nil, err
+			}
+		}
+		childSegments, err := child.DecodeMappings()
+		if err != nil {
+			return nil, err
+		}
+
+		base := len(flat.Sources)
+		for i, src := range child.Sources {
+			flat.Sources = append(flat.Sources, joinSourceRoot(child.SourceRoot, src))
+			if i < len(child.SourcesContent) {
+				flat.SourcesContent = append(flat.SourcesContent, child.SourcesContent[i])
+			} else {
+				flat.SourcesContent = append(flat.SourcesContent, nil)
+			}
+		}
+		for _, seg := range childSegments {
+			if seg.GeneratedLine == 0 {
+				seg.GeneratedColumn += section.Offset.Column
+			}
+			seg.GeneratedLine += section.Offset.Line
+			if seg.Source >= 0 {
+				seg.Source += base
+			}
+			segments = append(segments, seg)
+		}
+	}
+
+	flat.Mappings = encodeSourceMapMappings(segments)
+	return flat, nil
+}
+
+// DecodeMappings VLQ形式の mappings をセグメントに展開する
+func (sm *SourceMap) DecodeMappings() ([]SourceMapSegment, error) {
+	var segments []SourceMapSegment
+	source, srcLine, srcCol := 0, 0, 0
+
+	for genLine, line := range strings.Split(sm.Mappings, ";") {
+		genCol := 0
+		for _, field := range strings.Split(line, ",") {
+			if field == "" {
+				continue
+			}
+			values, err := decodeVLQ(field)
+			if err != nil {
+				return nil, err
+			}
+			genCol += values[0]
+			seg := SourceMapSegment{GeneratedLine: genLine, GeneratedColumn: genCol, Source: -1}
+			if len(values) >= 4 {
+				source += values[1]
+				srcLine += values[2]
+				srcCol += values[3]
+				seg.Source, seg.SourceLine, seg.SourceColumn = source, srcLine, srcCol
+			}
+			segments = append(segments, seg)
+		}
+	}
+	return segments, nil
+}
+
+const vlqAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+func decodeVLQ(field string) ([]int, error) {
+	var values []int
+	value, shift := 0, 0
+	for i := 0; i < len(field); i++ {
+		digit := strings.IndexByte(vlqAlphabet, field[i])
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid VLQ character %q", field[i])
+		}
+		value += (digit & 31) << shift
+		if digit&32 != 0 {
+			shift += 5
+			continue
+		}
+		if value&1 == 1 {
+			values = append(values, -(value >> 1))
+		} else {
+			values = append(values, value>>1)
+		}
+		value, shift = 0, 0
+	}
+	if shift != 0 || len(values) == 0 {
+		return nil, fmt.Errorf("truncated VLQ field %q", field)
+	}
+	return values, nil
+}
+
+func encodeVLQ(sb *strings.Builder, v int) {
+	if v < 0 {
+		v = (-v << 1) | 1
+	} else {
+		v <<= 1
+	}
+	for {
+		digit := v & 31
+		v >>= 5
+		if v > 0 {
+			digit |= 32
+		}
+		sb.WriteByte(vlqAlphabet[digit])
+		if v == 0 {
+			return
+		}
+	}
+}
+
+func encodeSourceMapMappings(segments []SourceMapSegment) string {
+	sort.SliceStable(segments, func(i, j int) bool {
+		if segments[i].GeneratedLine != segments[j].GeneratedLine {
+			return segments[i].GeneratedLine < segments[j].GeneratedLine
+		}
+		return segments[i].GeneratedColumn < segments[j].GeneratedColumn
+	})
+
+	var sb strings.Builder
+	line, source, srcLine, srcCol := 0, 0, 0, 0
+	genCol := 0
+	first := true
+	for _, seg := range segments {
+		for line < seg.GeneratedLine {
+			sb.WriteByte(';')
+			line++
+			genCol = 0
+			first = true
+		}
+		if !first {
+			sb.WriteByte(',')
+		}
+		first = false
+		encodeVLQ(&sb, seg.GeneratedColumn-genCol)
+		genCol = seg.GeneratedColumn
+		if seg.Source >= 0 {
+			encodeVLQ(&sb, seg.Source-source)
+			encodeVLQ(&sb, seg.SourceLine-srcLine)
+			encodeVLQ(&sb, seg.SourceColumn-srcCol)
+			source, srcLine, srcCol = seg.Source, seg.SourceLine, seg.SourceColumn
+		}
+	}
+	return sb.String()
+}
+
+// ReconstructSources 元ソースを復元する
+// sourcesContent があればそれを使い、無ければ生成コードの対応区間を元の行・列に並べ直して近似する
+func ReconstructSources(sm *SourceMap, generated string) ([]ReconstructedSource, error) {
+	var results []ReconstructedSource
+	missing := make(map[int]bool)
+
+	for i, src := range sm.Sources {
+		p := NormalizeSourcePath(src, sm.SourceRoot)
+		if p == "" {
+			continue
+		}
+		if i < len(sm.SourcesContent) && sm.SourcesContent[i] != nil {
+			results = append(results, ReconstructedSource{Path: p, Content: *sm.SourcesContent[i]})
+		} else {
+			missing[i] = true
+		}
+	}
+
+	if len(missing) == 0 || generated == "" {
+		return results, nil
+	}
+
+	segments, err := sm.DecodeMappings()
+	if err != nil {
+		return results, err
+	}
+
+	type fragment struct {
+		line, column int
+		text         string
+	}
+	fragments := make(map[int][]fragment)
+	genLines := strings.Split(generated, "\n")
+
+	for k, seg := range segments {
+		if seg.Source < 0 || !missing[seg.Source] || seg.GeneratedLine >= len(genLines) {
+			continue
+		}
+		line := genLines[seg.GeneratedLine]
+		end := -1
+		if k+1 < len(segments) && segments[k+1].GeneratedLine == seg.GeneratedLine {
+			end = segments[k+1].GeneratedColumn
+		}
+		text := sliceUTF16Columns(line, seg.GeneratedColumn, end)
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		fragments[seg.Source] = append(fragments[seg.Source], fragment{line: seg.SourceLine, column: seg.SourceColumn, text: text})
+	}
+
+	for i, src := range sm.Sources {
+		frags := fragments[i]
+		if !missing[i] || len(frags) == 0 {
+			continue
+		}
+		sort.SliceStable(frags, func(a, b int) bool {
+			if frags[a].line != frags[b].line {
+				return frags[a].line < frags[b].line
+			}
+			return frags[a].column < frags[b].column
+		})
+
+		var sb strings.Builder
+		currentLine, currentCol := 0, 0
+		for _, f := range frags {
+			for currentLine < f.line {
+				sb.WriteByte('\n')
+				currentLine++
+				currentCol = 0
+			}
+			if f.column > currentCol {
+				sb.WriteString(strings.Repeat(" ", f.column-currentCol))
+				currentCol = f.column
+			} else if currentCol > 0 {
+				sb.WriteByte(' ')
+				currentCol++
+			}
+			sb.WriteString(f.text)
+			currentCol += utf8.RuneCountInString(f.text)
+		}
+		sb.WriteByte('\n')
+
+		results = append(results, ReconstructedSource{
+			Path:         NormalizeSourcePath(src, sm.SourceRoot),
+			FromMappings: true,
+			Content:      sb.String(),
+		})
+	}
+	return results, nil
+}
+
+// sliceUTF16Columns ソースマップの列（UTF-16コード単位）で行を切り出す。end < 0 は行末まで
+func sliceUTF16Columns(line string, start, end int) string {
+	units := utf16.Encode([]rune(line))
+	// 壊れた mappings では列が負になることがある
+	if start < 0 || start >= len(units) {
+		return ""
+	}
+	if end < 0 || end > len(units) {
+		end = len(units)
+	}
+	if end <= start {
+		return ""
+	}
+	return string(utf16.Decode(units[start:end]))
+}
+
+// ExtractSourceMappingURL 生成コード末尾の sourceMappingURL コメントを取り出す
+func ExtractSourceMappingURL(js string) string {
+	matches := sourceMappingURLPattern.FindAllStringSubmatch(js, -1)
+	if len(matches) == 0 {
+		return ""
+	}
+	return matches[len(matches)-1][1]
+}
+
+// DecodeInlineSourceMap data: URL で埋め込まれたソースマップをデコードする
+func DecodeInlineSourceMap(ref string) ([]byte, bool) {
+	if !strings.HasPrefix(ref, "data:") {
+		return nil, false
+	}
+	comma := strings.IndexByte(ref, ',')
+	if comma < 0 {
+		return nil, false
+	}
+	meta, payload := ref[5:comma], ref[comma+1:]
+	if strings.HasSuffix(meta, ";base64") {
+		data, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			if data, err = base64.RawStdEncoding.DecodeString(payload); err != nil {
+				return nil, false
+			}
+		}
+		return data, true
+	}
+	decoded, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, false
+	}
+	return []byte(decoded), true
+}
+
+func joinSourceRoot(root, src string) string {
+	if root == "" || strings.Contains(src, "://") || strings.HasPrefix(src, "/") {
+		return src
+	}
+	return strings.TrimSuffix(root, "/") + "/" + src
+}
+
+// NormalizeSourcePath webpack:// などのスキームや ../ を取り除き、保存可能な相対パスにする
+func NormalizeSourcePath(src, root string) string {
+	src = joinSourceRoot(root, src)
+	if i := strings.IndexAny(src, "?#"); i >= 0 {
+		src = src[:i]
+	}
+	if i := strings.Index(src, "://"); i >= 0 {
+		scheme := src[:i]
+		src = src[i+3:]
+		// webpack://app-name/./src/a.js のようにホスト部分にパッケージ名が入る形式
+		if scheme == "webpack" || scheme == "webpack-internal" {
+			if slash := strings.IndexByte(src, '/'); slash > 0 && !strings.HasPrefix(src, ".") {
+				if rest := src[slash+1:]; strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, "/") {
+					src = rest
+				}
+			}
+		} else if slash := strings.IndexByte(src, '/'); scheme != "file" && slash >= 0 {
+			// http(s)://host/path はパス部分のみを使う
+			src = src[slash+1:]
+		}
+	}
+	src = strings.ReplaceAll(src, "\\", "/")
+
+	var parts []string
+	for _, part := range strings.Split(path.Clean("/"+src), "/") {
+		if part == "" || part == "." || part == ".." {
+			continue
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "/")
+}
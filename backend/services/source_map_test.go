@@ -0,0 +1,160 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeVLQ(t *testing.T) {
+	tests := []struct {
+		field   string
+		want    []int
+		wantErr bool
+	}{
+		{"A", []int{0}, false},
+		{"C", []int{1}, false},
+		{"D", []int{-1}, false},
+		{"gB", []int{16}, false},
+		{"AAgBC", []int{0, 0, 16, 1}, false},
+		{"g", nil, true},  // 継続ビットで終わる
+		{"A!", nil, true}, // アルファベット外
+	}
+	for _, tt := range tests {
+		got, err := decodeVLQ(tt.field)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("decodeVLQ(%q) error = %v, wantErr %v", tt.field, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decodeVLQ(%q) = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+
+	for _, v := range []int{0, 1, -1, 15, 16, -16, 1000, -123456} {
+		var sb strings.Builder
+		encodeVLQ(&sb, v)
+		if got, err := decodeVLQ(sb.String()); err != nil || len(got) != 1 || got[0] != v {
+			t.Errorf("round trip of %d via %q = %v, %v", v, sb.String(), got, err)
+		}
+	}
+}
+
+func TestParseSourceMap(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantErr     bool
+		wantSources []string
+	}{
+		{
+			name:        "plain",
+			data:        `{"version":3,"sources":["a.js"],"mappings":"AAAA"}`,
+			wantSources: []string{"a.js"},
+		},
+		{
+			name:        "xssi prefix",
+			data:        `)]}'` + "\n" + `{"version":3,"sources":["a.js"],"mappings":""}`,
+			wantSources: []string{"a.js"},
+		},
+		{
+			name: "index map",
+			data: `{"version":3,"sections":[
+				{"offset":{"line":0,"column":0},"map":{"version":3,"sources":["a.js"],"mappings":"AAAA"}},
+				{"offset":{"line":1,"column":0},"map":{"version":3,"sourceRoot":"lib","sources":["b.js"],"mappings":"AAAA"}},
+				{"offset":{"line":2,"column":0}}]}`,
+			wantSources: []string{"a.js", "lib/b.js"},
+		},
+		{name: "version 2", data: `{"version":2,"sources":["a.js"]}`, wantErr: true},
+		{name: "no sources", data: `{"version":3,"mappings":"AAAA"}`, wantErr: true},
+		{name: "not json", data: `{"version":3`, wantErr: true},
+		{
+			name:    "broken section mappings",
+			data:    `{"version":3,"sections":[{"offset":{"line":0,"column":0},"map":{"version":3,"sources":["a.js"],"mappings":"g"}}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm, err := ParseSourceMap([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSourceMap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(sm.Sources, tt.wantSources) {
+				t.Errorf("sources = %v, want %v", sm.Sources, tt.wantSources)
+			}
+		})
+	}
+}
+
+func TestReconstructSources(t *testing.T) {
+	// a.js の内容は sourcesContent から、b.js は mappings と生成コードから戻す
+	content := "const a = 1;\n"
+	sm := &SourceMap{
+		Version:        3,
+		Sources:        []string{"webpack://app/./src/a.js", "../b.js"},
+		SourcesContent: []*string{&content, nil},
+		Mappings:       "ACAA,MAAM;AACN",
+	}
+	got, err := ReconstructSources(sm, "foo();bar();\nbaz();")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %+v, want 2 sources", got)
+	}
+	if got[0].Path != "src/a.js" || got[0].Content != content || got[0].FromMappings {
+		t.Errorf("first source = %+v", got[0])
+	}
+	if got[1].Path != "b.js" || !got[1].FromMappings || got[1].Content != "foo(); bar();\nbaz();\n" {
+		t.Errorf("second source = %+v", got[1])
+	}
+
+	// 壊れた mappings（負の列）でも panic しない
+	sm.Mappings = "DCAA"
+	if _, err := ReconstructSources(sm, "foo();"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNormalizeSourcePath(t *testing.T) {
+	tests := []struct {
+		src, root, want string
+	}{
+		{"src/a.js", "", "src/a.js"},
+		{"a.js", "lib/", "lib/a.js"},
+		{"webpack:///./src/a.js", "", "src/a.js"},
+		{"webpack://my-app/./src/a.js?abcd", "", "src/a.js"},
+		{"https://example.com/static/a.js", "", "static/a.js"},
+		{"../../../etc/passwd", "", "etc/passwd"},
+		{`..\..\win.ini`, "", "win.ini"},
+		{"/abs/a.js", "root", "abs/a.js"},
+		{"..", "", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeSourcePath(tt.src, tt.root); got != tt.want {
+			t.Errorf("NormalizeSourcePath(%q, %q) = %q, want %q", tt.src, tt.root, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeInlineSourceMap(t *testing.T) {
+	tests := []struct {
+		ref    string
+		want   string
+		wantOK bool
+	}{
+		{"data:application/json;base64,eyJ2ZXJzaW9uIjozfQ==", `{"version":3}`, true},
+		{"data:application/json;base64,eyJ2ZXJzaW9uIjozfQ", `{"version":3}`, true},
+		{"data:application/json,%7B%7D", "{}", true},
+		{"data:application/json;base64,!!!", "", false},
+		{"data:application/json", "", false},
+		{"a.js.map", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := DecodeInlineSourceMap(tt.ref)
+		if ok != tt.wantOK || string(got) != tt.want {
+			t.Errorf("DecodeInlineSourceMap(%q) = %q, %v, want %q, %v", tt.ref, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
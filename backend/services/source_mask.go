@@ -0,0 +1,227 @@
+package services
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// commentSyntax 言語ごとのコメント・文字列リテラルの書き方
+type commentSyntax struct {
+	line      []string    // 行コメントの開始
+	block     [][2]string // ブロックコメントの開始と終了
+	quotes    string      // 改行をまたがない文字列の引用符
+	multiline string      // 改行をまたげる文字列の引用符（Go の raw 文字列、JS のテンプレートなど）
+	raw       bool        // 改行をまたげる文字列ではエスケープが効かない
+	triple    bool        // """ ''' による複数行文字列
+	char      bool        // ' は短い文字リテラルとしてだけ扱う（Rust のライフタイムなどと区別するため）
+	hashWord  bool        // # は語の先頭でだけコメントになる（シェルの $# などと区別するため）
+}
+
+var (
+	cStyleComments = [][2]string{{"/*", "*/"}}
+
+	commentSyntaxes = map[string]commentSyntax{
+		"go":         {line: []string{"//"}, block: cStyleComments, quotes: `"`, multiline: "`", raw: true, char: true},
+		"javascript": {line: []string{"//"}, block: cStyleComments, quotes: `"'`, multiline: "`"},
+		"typescript": {line: []string{"//"}, block: cStyleComments, quotes: `"'`, multiline: "`"},
+		"java":       {line: []string{"//"}, block: cStyleComments, quotes: `"`, triple: true, char: true},
+		"c":          {line: []string{"//"}, block: cStyleComments, quotes: `"`, char: true},
+		"cpp":        {line: []string{"//"}, block: cStyleComments, quotes: `"`, char: true},
+		"csharp":     {line: []string{"//"}, block: cStyleComments, quotes: `"`, char: true},
+		"rust":       {line: []string{"//"}, block: cStyleComments, quotes: `"`, char: true},
+		"swift":      {line: []string{"//"}, block: cStyleComments, quotes: `"`, triple: true},
+		"kotlin":     {line: []string{"//"}, block: cStyleComments, quotes: `"`, triple: true, char: true},
+		"scala":      {line: []string{"//"}, block: cStyleComments, quotes: `"`, triple: true, char: true},
+		"protobuf":   {line: []string{"//"}, block: cStyleComments, quotes: `"'`},
+		"php":        {line: []string{"//", "#"}, block: cStyleComments, quotes: `"'`},
+		"python":     {line: []string{"#"}, quotes: `"'`, triple: true},
+		"ruby":       {line: []string{"#"}, quotes: `"'`},
+		"r":          {line: []string{"#"}, quotes: `"'`},
+		"shell":      {line: []string{"#"}, quotes: `"'`, hashWord: true},
+		"powershell": {line: []string{"#"}, block: [][2]string{{"<#", "#>"}}, quotes: `"'`},
+		"sql":        {line: []string{"--"}, block: cStyleComments, quotes: `'`},
+	}
+)
+
+// MaskSource コメントと文字列リテラルの中身を空白に置き換える
+// 改行と各文字の位置はそのまま残すので、結果の行番号・桁位置は元のソースと一致する
+// 未知の言語はそのまま返す
+func MaskSource(language, src string) string {
+	syntax, ok := commentSyntaxes[language]
+	if !ok {
+		return src
+	}
+	out := []byte(src)
+	blank := func(from, to int) {
+		if to > len(out) {
+			to = len(out)
+		}
+		for k := from; k < to; k++ {
+			if out[k] != '\n' {
+				out[k] = ' '
+			}
+		}
+	}
+
+	n := len(src)
+	for i := 0; i < n; {
+		c := src[i]
+
+		if end, ok := matchComment(syntax, src, i); ok {
+			blank(i, end)
+			i = end
+			continue
+		}
+
+		if syntax.triple && (c == '"' || c == '\'') && strings.HasPrefix(src[i:], strings.Repeat(string(c), 3)) {
+			delim := src[i : i+3]
+			end := strings.Index(src[i+3:], delim)
+			if end < 0 {
+				end = n
+			} else {
+				end = i + 3 + end + 3
+			}
+			blank(i, end)
+			i = end
+			continue
+		}
+
+		if strings.IndexByte(syntax.multiline, c) >= 0 {
+			end := scanQuoted(src, i, c, true, !syntax.raw)
+			blank(i, end)
+			i = end
+			continue
+		}
+
+		if c == '\'' && syntax.char {
+			// 1文字（またはエスケープ）を囲んでいない ' はライフタイムなどとして読み飛ばす
+			end := scanQuoted(src, i, c, false, true)
+			if !isCharLiteral(src[i:end]) {
+				i++
+				continue
+			}
+			blank(i, end)
+			i = end
+			continue
+		}
+
+		if strings.IndexByte(syntax.quotes, c) >= 0 {
+			end := scanQuoted(src, i, c, false, true)
+			blank(i, end)
+			i = end
+			continue
+		}
+		i++
+	}
+	return string(out)
+}
+
+// matchComment i からコメントが始まっていれば、その終端を返す
+func matchComment(syntax commentSyntax, src string, i int) (int, bool) {
+	for _, b := range syntax.block {
+		if strings.HasPrefix(src[i:], b[0]) {
+			end := strings.Index(src[i+len(b[0]):], b[1])
+			if end < 0 {
+				return len(src), true
+			}
+			return i + len(b[0]) + end + len(b[1]), true
+		}
+	}
+	for _, l := range syntax.line {
+		if !strings.HasPrefix(src[i:], l) {
+			continue
+		}
+		if l == "#" && syntax.hashWord && i > 0 && !isShellWordBreak(src[i-1]) {
+			continue
+		}
+		end := strings.IndexByte(src[i:], '\n')
+		if end < 0 {
+			return len(src), true
+		}
+		return i + end, true
+	}
+	return 0, false
+}
+
+// scanQuoted 引用符 quote で始まる文字列の終端（閉じ引用符の直後）を返す
+// multiline でなければ改行で打ち切る
+func scanQuoted(src string, i int, quote byte, multiline, escapes bool) int {
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			if escapes {
+				j++
+			}
+		case '\n':
+			if !multiline {
+				return j
+			}
+		case quote:
+			return j + 1
+		}
+	}
+	return len(src)
+}
+
+func isShellWordBreak(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ';' || c == '(' || c == '{'
+}
+
+// isCharLiteral 'x'、'\n'、'\u{1F600}' のような文字リテラルかどうか
+func isCharLiteral(lit string) bool {
+	if len(lit) < 3 || len(lit) > 12 || lit[len(lit)-1] != '\'' {
+		return false
+	}
+	if lit[1] == '\\' {
+		return true
+	}
+	_, size := utf8.DecodeRuneInString(lit[1:])
+	return size == len(lit)-2
+}
+
+// StripComments コメントだけを空白に置き換え、文字列リテラルは残す（位置は元のソースと一致する）
+// 未知の言語はそのまま返す
+func StripComments(language, src string) string {
+	syntax, ok := commentSyntaxes[language]
+	if !ok {
+		return src
+	}
+	out := []byte(src)
+	n := len(src)
+	for i := 0; i < n; {
+		c := src[i]
+		if end, ok := matchComment(syntax, src, i); ok {
+			if end > n {
+				end = n
+			}
+			for k := i; k < end; k++ {
+				if out[k] != '\n' {
+					out[k] = ' '
+				}
+			}
+			i = end
+			continue
+		}
+		switch {
+		case syntax.triple && (c == '"' || c == '\'') && strings.HasPrefix(src[i:], strings.Repeat(string(c), 3)):
+			end := strings.Index(src[i+3:], src[i:i+3])
+			if end < 0 {
+				return string(out)
+			}
+			i += 3 + end + 3
+		case strings.IndexByte(syntax.multiline, c) >= 0:
+			i = scanQuoted(src, i, c, true, !syntax.raw)
+		case c == '\'' && syntax.char:
+			end := scanQuoted(src, i, c, false, true)
+			if !isCharLiteral(src[i:end]) {
+				end = i + 1
+			}
+			i = end
+		case strings.IndexByte(syntax.quotes, c) >= 0:
+			i = scanQuoted(src, i, c, false, true)
+		default:
+			i++
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,419 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+)
+
+// FirmwareEntry ファイルシステムイメージから取り出したエントリ
+type FirmwareEntry struct {
+	Path   string `json:"path"`
+	Type   string `json:"type"` // file, dir, symlink, device, fifo, socket
+	Mode   uint32 `json:"mode"`
+	Size   int64  `json:"size"`
+	Target string `json:"target,omitempty"` // シンボリックリンクの参照先
+	Data   []byte `json:"-"`
+}
+
+// squashfs 4.0 のスーパーブロック（リトルエンディアン）
+type squashfsSuperblock struct {
+	Magic        uint32
+	InodeCount   uint32
+	ModTime      uint32
+	BlockSize    uint32
+	FragCount    uint32
+	Compressor   uint16
+	BlockLog     uint16
+	Flags        uint16
+	IDCount      uint16
+	VersionMajor uint16
+	VersionMinor uint16
+	RootInode    uint64
+	BytesUsed    uint64
+	IDTable      uint64
+	XattrTable   uint64
+	InodeTable   uint64
+	DirTable     uint64
+	FragTable    uint64
+	ExportTable  uint64
+}
+
+const (
+	squashfsMagic        = 0x73717368 // "hsqs"
+	squashfsMetaSize     = 8192
+	squashfsUncompressed = 1 << 24
+	squashfsNoFragment   = 0xFFFFFFFF
+)
+
+var squashfsCompressors = map[uint16]string{1: "gzip", 2: "lzma", 3: "lzo", 4: "xz", 5: "lz4", 6: "zstd"}
+
+type squashfsReader struct {
+	data       []byte
+	sb         squashfsSuperblock
+	decompress func([]byte) ([]byte, error)
+	metaCache  map[uint64][]byte
+	metaNext   map[uint64]uint64
+	fragments  map[uint32][]byte
+	entries    []FirmwareEntry
+	totalBytes int64
+}
+
+// ReadSquashfs squashfs 4.0 イメージ内のエントリを取り出し、イメージのサイズ（bytes_used）を返す
+func ReadSquashfs(data []byte) ([]FirmwareEntry, int, error) {
+	r := &squashfsReader{data: data, metaCache: make(map[uint64][]byte), metaNext: make(map[uint64]uint64), fragments: make(map[uint32][]byte)}
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &r.sb); err != nil {
+		return nil, 0, errors.New("squashfs: truncated superblock")
+	}
+	sb := &r.sb
+	if sb.Magic != squashfsMagic {
+		return nil, 0, errors.New("squashfs: invalid magic (big-endian or pre-4.0 images are not supported)")
+	}
+	if sb.VersionMajor != 4 {
+		return nil, 0, fmt.Errorf("squashfs: unsupported version %d.%d", sb.VersionMajor, sb.VersionMinor)
+	}
+	if sb.BlockSize == 0 || sb.BlockSize > 1<<20 || sb.BytesUsed > uint64(len(data)) || sb.InodeTable >= sb.BytesUsed || sb.DirTable >= sb.BytesUsed {
+		return nil, 0, errors.New("squashfs: invalid superblock")
+	}
+	size := int(sb.BytesUsed)
+
+	switch sb.Compressor {
+	case 1:
+		r.decompress = func(b []byte) ([]byte, error) {
+			zr, err := zlib.NewReader(bytes.NewReader(b))
+			if err != nil {
+				return nil, err
+			}
+			defer zr.Close()
+			return io.ReadAll(io.LimitReader(zr, maxDecompressedSize))
+		}
+	case 2:
+		r.decompress = func(b []byte) ([]byte, error) {
+			out, _, err := DecompressLZMA(b)
+			return out, err
+		}
+	case 4:
+		r.decompress = func(b []byte) ([]byte, error) {
+			out, _, err := DecompressXZ(b)
+			return out, err
+		}
+	default:
+		name := squashfsCompressors[sb.Compressor]
+		if name == "" {
+			name = fmt.Sprintf("%d", sb.Compressor)
+		}
+		return nil, size, fmt.Errorf("squashfs: unsupported compressor %s", name)
+	}
+
+	if err := r.walk(sb.RootInode, ""); err != nil {
+		return r.entries, size, err
+	}
+	return r.entries, size, nil
+}
+
+// readMetaBlock pos にあるメタデータブロックを展開し、次のブロックの位置と合わせて返す
+func (r *squashfsReader) readMetaBlock(pos uint64) ([]byte, uint64, error) {
+	if block, ok := r.metaCache[pos]; ok {
+		return block, r.metaNext[pos], nil
+	}
+	if !r.inRange(pos, 2) {
+		return nil, 0, errors.New("squashfs: metadata block out of range")
+	}
+	header := binary.LittleEndian.Uint16(r.data[pos:])
+	size := uint64(header & 0x7FFF)
+	if size == 0 || !r.inRange(pos+2, size) {
+		return nil, 0, errors.New("squashfs: invalid metadata block")
+	}
+	raw := r.data[pos+2 : pos+2+size]
+	block := raw
+	if header&0x8000 == 0 {
+		var err error
+		if block, err = r.decompress(raw); err != nil {
+			return nil, 0, fmt.Errorf("squashfs: metadata: %w", err)
+		}
+	}
+	if len(block) > squashfsMetaSize {
+		return nil, 0, errors.New("squashfs: oversized metadata block")
+	}
+	r.metaCache[pos] = block
+	r.metaNext[pos] = pos + 2 + size
+	return block, pos + 2 + size, nil
+}
+
+// inRange [pos, pos+size) がイメージに収まるか。位置はイメージ内の値をそのまま使うため、加算のあふれも考慮する
+func (r *squashfsReader) inRange(pos, size uint64) bool {
+	return pos <= uint64(len(r.data)) && size <= uint64(len(r.data))-pos
+}
+
+// readMeta テーブル先頭 table から (block, offset) の位置にある length バイトを読む（ブロックをまたいでもよい）
+func (r *squashfsReader) readMeta(table, block uint64, offset int, length int) ([]byte, uint64, int, error) {
+	pos := table + block
+	out := make([]byte, 0, length)
+	for len(out) < length {
+		data, next, err := r.readMetaBlock(pos)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if offset > len(data) {
+			return nil, 0, 0, errors.New("squashfs: metadata offset out of range")
+		}
+		n := length - len(out)
+		if n > len(data)-offset {
+			n = len(data) - offset
+		}
+		out = append(out, data[offset:offset+n]...)
+		offset += n
+		if offset == len(data) && len(out) < length {
+			pos, offset = next, 0
+		}
+	}
+	return out, pos - table, offset, nil
+}
+
+// metaCursor メタデータを順に読み進めるためのカーソル
+type metaCursor struct {
+	r      *squashfsReader
+	table  uint64
+	block  uint64
+	offset int
+	err    error
+}
+
+func (c *metaCursor) read(n int) []byte {
+	if c.err != nil {
+		return make([]byte, n)
+	}
+	b, block, offset, err := c.r.readMeta(c.table, c.block, c.offset, n)
+	if err != nil {
+		c.err = err
+		return make([]byte, n)
+	}
+	c.block, c.offset = block, offset
+	return b
+}
+
+func (c *metaCursor) u16() uint16 { return binary.LittleEndian.Uint16(c.read(2)) }
+func (c *metaCursor) u32() uint32 { return binary.LittleEndian.Uint32(c.read(4)) }
+func (c *metaCursor) u64() uint64 { return binary.LittleEndian.Uint64(c.read(8)) }
+
+// walk inode を読み、ディレクトリなら再帰的にたどる
+func (r *squashfsReader) walk(ref uint64, name string) error {
+	if len(r.entries) >= maxFirmwareEntries {
+		return fmt.Errorf("squashfs: more than %d entries", maxFirmwareEntries)
+	}
+	c := &metaCursor{r: r, table: r.sb.InodeTable, block: ref >> 16, offset: int(ref & 0xFFFF)}
+	inodeType := c.u16()
+	mode := uint32(c.u16())
+	c.read(12) // uid, gid, mtime, inode number
+	if c.err != nil {
+		return c.err
+	}
+
+	entry := FirmwareEntry{Path: name, Mode: mode}
+	switch inodeType {
+	case 1, 8:
+		var startBlock, fileSize uint32
+		var dirOffset uint16
+		if inodeType == 1 {
+			startBlock = c.u32()
+			c.u32() // nlink
+			fileSize = uint32(c.u16())
+			dirOffset = c.u16()
+		} else {
+			c.u32() // nlink
+			fileSize = c.u32()
+			startBlock = c.u32()
+			c.u32() // parent
+			c.u16() // index count
+			dirOffset = c.u16()
+		}
+		if c.err != nil {
+			return c.err
+		}
+		if name != "" {
+			entry.Type = "dir"
+			r.entries = append(r.entries, entry)
+		}
+		return r.walkDir(uint64(startBlock), int(dirOffset), int(fileSize), name)
+	case 2, 9:
+		var blocksStart, fileSize uint64
+		var fragment, fragOffset uint32
+		if inodeType == 2 {
+			blocksStart = uint64(c.u32())
+			fragment = c.u32()
+			fragOffset = c.u32()
+			fileSize = uint64(c.u32())
+		} else {
+			blocksStart = c.u64()
+			fileSize = c.u64()
+			c.u64() // sparse
+			c.u32() // nlink
+			fragment = c.u32()
+			fragOffset = c.u32()
+			c.u32() // xattr
+		}
+		if c.err != nil {
+			return c.err
+		}
+		entry.Type, entry.Size = "file", int64(fileSize)
+		data, err := r.readFile(c, blocksStart, fileSize, fragment, fragOffset)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		entry.Data = data
+	case 3, 10:
+		c.u32() // nlink
+		size := c.u32()
+		if size > 4096 {
+			return errors.New("squashfs: invalid symlink")
+		}
+		entry.Type, entry.Target = "symlink", string(c.read(int(size)))
+	case 4, 5, 11, 12:
+		entry.Type = "device"
+	case 6, 13:
+		entry.Type = "fifo"
+	case 7, 14:
+		entry.Type = "socket"
+	default:
+		return fmt.Errorf("squashfs: unknown inode type %d", inodeType)
+	}
+	if c.err != nil {
+		return c.err
+	}
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func (r *squashfsReader) walkDir(block uint64, offset, size int, dir string) error {
+	// file_size には "." と ".." の分として 3 が加算されている
+	remaining := size - 3
+	c := &metaCursor{r: r, table: r.sb.DirTable, block: block, offset: offset}
+	for remaining > 0 {
+		count := int(c.u32()) + 1
+		startBlock := c.u32()
+		c.u32() // 基準の inode 番号
+		remaining -= 12
+		if c.err != nil {
+			return c.err
+		}
+		if count > 256 {
+			return errors.New("squashfs: invalid directory header")
+		}
+		for i := 0; i < count && remaining > 0; i++ {
+			inodeOffset := c.u16()
+			c.u16() // inode 番号の差分
+			c.u16() // 種別
+			nameSize := int(c.u16()) + 1
+			name := string(c.read(nameSize))
+			remaining -= 8 + nameSize
+			if c.err != nil {
+				return c.err
+			}
+			if name == "." || name == ".." || path.Base(name) != name {
+				continue
+			}
+			if err := r.walk(uint64(startBlock)<<16|uint64(inodeOffset), path.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readFile データブロックと末尾のフラグメントからファイル内容を組み立てる
+func (r *squashfsReader) readFile(c *metaCursor, blocksStart, fileSize uint64, fragment, fragOffset uint32) ([]byte, error) {
+	if fileSize > maxDecompressedSize || r.totalBytes+int64(fileSize) > maxFirmwareBytes {
+		return nil, errors.New("file too large")
+	}
+	r.totalBytes += int64(fileSize)
+	blockSize := uint64(r.sb.BlockSize)
+	numBlocks := fileSize / blockSize
+	if fragment == squashfsNoFragment && fileSize%blockSize != 0 {
+		numBlocks++
+	}
+
+	out := make([]byte, 0, fileSize)
+	pos := blocksStart
+	for i := uint64(0); i < numBlocks; i++ {
+		entry := c.u32()
+		if c.err != nil {
+			return nil, c.err
+		}
+		size := uint64(entry &^ squashfsUncompressed)
+		want := blockSize
+		if rest := fileSize - uint64(len(out)); rest < want {
+			want = rest
+		}
+		if size == 0 {
+			// スパースブロック
+			out = append(out, make([]byte, want)...)
+			continue
+		}
+		if !r.inRange(pos, size) {
+			return nil, errors.New("data block out of range")
+		}
+		raw := r.data[pos : pos+size]
+		pos += size
+		block := raw
+		if entry&squashfsUncompressed == 0 {
+			var err error
+			if block, err = r.decompress(raw); err != nil {
+				return nil, err
+			}
+		}
+		if uint64(len(block)) > want {
+			block = block[:want]
+		}
+		out = append(out, block...)
+	}
+
+	if fragment != squashfsNoFragment {
+		frag, err := r.readFragment(fragment)
+		if err != nil {
+			return nil, err
+		}
+		rest := fileSize - uint64(len(out))
+		if uint64(fragOffset)+rest > uint64(len(frag)) {
+			return nil, errors.New("fragment out of range")
+		}
+		out = append(out, frag[fragOffset:uint64(fragOffset)+rest]...)
+	}
+	return out, nil
+}
+
+func (r *squashfsReader) readFragment(index uint32) ([]byte, error) {
+	if frag, ok := r.fragments[index]; ok {
+		return frag, nil
+	}
+	if index >= r.sb.FragCount {
+		return nil, errors.New("fragment index out of range")
+	}
+	// フラグメントテーブルはメタデータブロックへのポインタ（u64）の配列で、1ブロックに16バイトのエントリが512個入る
+	ptrPos := r.sb.FragTable + uint64(index/512)*8
+	if !r.inRange(ptrPos, 8) {
+		return nil, errors.New("fragment table out of range")
+	}
+	blockPos := binary.LittleEndian.Uint64(r.data[ptrPos:])
+	entry, _, _, err := r.readMeta(blockPos, 0, int(index%512)*16, 16)
+	if err != nil {
+		return nil, err
+	}
+	start := binary.LittleEndian.Uint64(entry[0:])
+	sizeField := binary.LittleEndian.Uint32(entry[8:])
+	size := uint64(sizeField &^ squashfsUncompressed)
+	if !r.inRange(start, size) {
+		return nil, errors.New("fragment block out of range")
+	}
+	frag := r.data[start : start+size]
+	if sizeField&squashfsUncompressed == 0 {
+		if frag, err = r.decompress(frag); err != nil {
+			return nil, err
+		}
+	}
+	r.fragments[index] = frag
+	return frag, nil
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// squashfs のテスト用イメージを組み立てる（メタデータ・データブロックとも無圧縮）
+type testSquashfs struct {
+	data   []byte // スーパーブロックの直後に置くデータブロック
+	inodes []byte
+	dir    []byte
+	root   uint16 // ルートディレクトリ inode のオフセット
+	tweak  func(sb *squashfsSuperblock)
+}
+
+func (s testSquashfs) build() []byte {
+	meta := func(b []byte) []byte {
+		return append(binary.LittleEndian.AppendUint16(nil, 0x8000|uint16(len(b))), b...)
+	}
+	inodeTable := 96 + len(s.data)
+	dirTable := inodeTable + 2 + len(s.inodes)
+	sb := squashfsSuperblock{
+		Magic: squashfsMagic, InodeCount: 3, BlockSize: 4096, BlockLog: 12, Compressor: 1,
+		Flags: 0x03, VersionMajor: 4, RootInode: uint64(s.root),
+		BytesUsed:   uint64(dirTable + 2 + len(s.dir)),
+		IDTable:     ^uint64(0),
+		XattrTable:  ^uint64(0),
+		InodeTable:  uint64(inodeTable),
+		DirTable:    uint64(dirTable),
+		FragTable:   ^uint64(0),
+		ExportTable: ^uint64(0),
+	}
+	if s.tweak != nil {
+		s.tweak(&sb)
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, sb)
+	buf.Write(s.data)
+	buf.Write(meta(s.inodes))
+	buf.Write(meta(s.dir))
+	return buf.Bytes()
+}
+
+// squashfsInodeHeader 種別・モードと uid, gid, mtime, inode 番号
+func squashfsInodeHeader(typ, mode uint16) []byte {
+	b := binary.LittleEndian.AppendUint16(nil, typ)
+	b = binary.LittleEndian.AppendUint16(b, mode)
+	return append(b, make([]byte, 12)...)
+}
+
+func appendUint32s(b []byte, vs ...uint32) []byte {
+	for _, v := range vs {
+		b = binary.LittleEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+// squashfsDirEntry ディレクトリの1エントリ（inode オフセット・差分・種別・名前の長さ - 1・名前）
+func squashfsDirEntry(inodeOffset uint16, typ uint16, name string) []byte {
+	b := binary.LittleEndian.AppendUint16(nil, inodeOffset)
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	b = binary.LittleEndian.AppendUint16(b, typ)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(name)-1))
+	return append(b, name...)
+}
+
+// sampleSquashfs ルートに hello.txt・link（→ hello.txt）・../evil を持つイメージ
+func sampleSquashfs() testSquashfs {
+	content := []byte("hello squashfs\n")
+	// 基本ファイル inode（オフセット 0）：データブロック1つ、フラグメントなし
+	file := appendUint32s(squashfsInodeHeader(2, 0644), 96, squashfsNoFragment, 0, uint32(len(content)), uint32(len(content))|squashfsUncompressed)
+	// シンボリックリンク inode
+	link := appendUint32s(squashfsInodeHeader(3, 0777), 1, 9)
+	link = append(link, "hello.txt"...)
+
+	entries := [][]byte{
+		squashfsDirEntry(0, 2, "hello.txt"),
+		squashfsDirEntry(uint16(len(file)), 3, "link"),
+		squashfsDirEntry(0, 2, "../evil"),
+	}
+	dir := appendUint32s(nil, uint32(len(entries)-1), 0, 1)
+	for _, e := range entries {
+		dir = append(dir, e...)
+	}
+
+	root := uint16(len(file) + len(link))
+	// ディレクトリ inode：start_block, nlink, file_size（"." と ".." の分の 3 を含む）, offset, parent
+	rootInode := appendUint32s(squashfsInodeHeader(1, 0755), 0, 2)
+	rootInode = binary.LittleEndian.AppendUint16(rootInode, uint16(len(dir)+3))
+	rootInode = binary.LittleEndian.AppendUint16(rootInode, 0)
+	rootInode = appendUint32s(rootInode, 1)
+
+	return testSquashfs{
+		data:   content,
+		inodes: bytes.Join([][]byte{file, link, rootInode}, nil),
+		dir:    dir,
+		root:   root,
+	}
+}
+
+func TestReadSquashfs(t *testing.T) {
+	image := sampleSquashfs().build()
+	entries, size, err := ReadSquashfs(append(append([]byte{}, image...), "trailing"...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != len(image) {
+		t.Errorf("size = %d, want %d", size, len(image))
+	}
+	want := []FirmwareEntry{
+		{Path: "hello.txt", Type: "file", Mode: 0644, Size: 15, Data: []byte("hello squashfs\n")},
+		{Path: "link", Type: "symlink", Mode: 0777, Target: "hello.txt"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries = %+v, want %+v", entries, want)
+	}
+}
+
+func TestReadSquashfsInvalid(t *testing.T) {
+	valid := sampleSquashfs()
+	image := valid.build()
+
+	// 拡張ファイル inode：blocks_start が末尾付近を指し、位置の計算があふれる
+	overflowBlocks := valid
+	overflowBlocks.inodes = append(squashfsInodeHeader(9, 0644), binary.LittleEndian.AppendUint64(nil, ^uint64(0)-4)...)
+	overflowBlocks.inodes = append(overflowBlocks.inodes, binary.LittleEndian.AppendUint64(nil, 15)...)
+	overflowBlocks.inodes = append(overflowBlocks.inodes, make([]byte, 8)...)
+	overflowBlocks.inodes = appendUint32s(overflowBlocks.inodes, 1, squashfsNoFragment, 0, 0, 15|squashfsUncompressed)
+	overflowBlocks.inodes = append(overflowBlocks.inodes, valid.inodes[36+33:]...)
+	overflowBlocks.root = uint16(len(overflowBlocks.inodes) - (len(valid.inodes) - 36 - 33))
+
+	// フラグメントテーブルの位置があふれる
+	overflowFragTable := valid
+	overflowFragTable.inodes = append(appendUint32s(squashfsInodeHeader(2, 0644), 96, 0, 0, 15), valid.inodes[36:]...)
+	overflowFragTable.root -= 4
+	overflowFragTable.tweak = func(sb *squashfsSuperblock) { sb.FragCount, sb.FragTable = 1, ^uint64(0)-3 }
+
+	tests := []struct {
+		name  string
+		image []byte
+	}{
+		{"empty", nil},
+		{"bad magic", []byte("sqsh" + string(make([]byte, 92)))},
+		{"version 3", testSquashfs{tweak: func(sb *squashfsSuperblock) { sb.VersionMajor = 3 }}.build()},
+		{"bytes used beyond data", testSquashfs{tweak: func(sb *squashfsSuperblock) { sb.BytesUsed = 1 << 40 }}.build()},
+		{"unsupported compressor", testSquashfs{tweak: func(sb *squashfsSuperblock) { sb.Compressor = 6 }}.build()},
+		{"root out of range", testSquashfs{tweak: func(sb *squashfsSuperblock) { sb.RootInode = 0xffff }}.build()},
+		{"data block position overflows", overflowBlocks.build()},
+		{"fragment table position overflows", overflowFragTable.build()},
+		{"truncated superblock", image[:50]},
+		{"truncated tables", image[:len(image)-1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ReadSquashfs(tt.image); err == nil {
+				t.Error("ReadSquashfs() error = nil")
+			}
+		})
+	}
+}
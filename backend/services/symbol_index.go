@@ -0,0 +1,79 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"reverse-engineering-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// IndexFileSymbols ファイルのシンボルを抽出し、インデックスを作り直す
+// シンボルが無いファイルも抽出済みとして印を付ける
+func IndexFileSymbols(db *gorm.DB, file *models.File) error {
+	if err := RemoveFileSymbols(db, file.ID); err != nil {
+		return err
+	}
+	var defs []SymbolDef
+	if file.Content != "" {
+		defs = ExtractSymbols(file.Language, file.Content)
+	}
+	if len(defs) == 0 {
+		return markSymbolsIndexed(db, file)
+	}
+	symbols := make([]models.Symbol, 0, len(defs))
+	for _, def := range defs {
+		symbols = append(symbols, models.Symbol{
+			ProjectID: file.ProjectID,
+			FileID:    file.ID,
+			Name:      def.Name,
+			Kind:      def.Kind,
+			Container: def.Container,
+			Language:  file.Language,
+			Line:      def.Line,
+			Column:    def.Column,
+			Signature: def.Signature,
+		})
+	}
+	if err := db.CreateInBatches(symbols, 500).Error; err != nil {
+		return err
+	}
+	return markSymbolsIndexed(db, file)
+}
+
+// markSymbolsIndexed ファイルを抽出済みにする（updated_at は変えない）
+func markSymbolsIndexed(db *gorm.DB, file *models.File) error {
+	file.SymbolsIndexed = true
+	return db.Model(&models.File{}).Where("id = ?", file.ID).UpdateColumn("symbols_indexed", true).Error
+}
+
+// RemoveFileSymbols ファイルのシンボルをインデックスから削除する
+func RemoveFileSymbols(db *gorm.DB, fileID uint) error {
+	return db.Where("file_id = ?", fileID).Delete(&models.Symbol{}).Error
+}
+
+// BackfillSymbolIndex 起動時に一度だけ呼び出し、シンボルを抽出していない既存のファイルを索引する
+// インデックス導入前にアップロードされたファイルのためのもの。新しいファイルはアップロード時に索引する
+func BackfillSymbolIndex(db *gorm.DB) {
+	started := time.Now()
+	var files []models.File
+	indexed := 0
+	err := db.Where("symbols_indexed = ? AND created_at < ?", false, started).
+		FindInBatches(&files, 100, func(tx *gorm.DB, batch int) error {
+			for i := range files {
+				if err := IndexFileSymbols(db, &files[i]); err != nil {
+					return err
+				}
+			}
+			indexed += len(files)
+			return nil
+		}).Error
+	if err != nil {
+		log.Println("Failed to backfill the symbol index:", err)
+		return
+	}
+	if indexed > 0 {
+		log.Printf("Indexed symbols of %d files in %v", indexed, time.Since(started).Round(time.Millisecond))
+	}
+}
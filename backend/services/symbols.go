@@ -0,0 +1,543 @@
+package services
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// 1ファイルから取り出すシンボル数の上限（圧縮されたコードなどで膨れ上がるのを防ぐ）
+const maxSymbolsPerFile = 5000
+
+// SymbolDef ソースコード中の定義
+type SymbolDef struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`                // function, method, class, struct, interface, enum, type, constant, variable, property, module, macro など
+	Container string `json:"container,omitempty"` // メソッドのレシーバー型・所属クラス
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// SymbolRef 識別子が出現した位置
+type SymbolRef struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Context string `json:"context"` // 出現した行
+}
+
+type ruleScope int
+
+const (
+	ruleAny    ruleScope = iota
+	ruleTop              // クラスなどの中では使わない
+	ruleMember           // クラスなどの直下でだけ使う
+)
+
+// symbolRule 1行に対する定義のパターン
+// 正規表現の name グループが名前、container グループが所属（C++ の Foo::bar など）、kind グループがあればそれが種別になる
+type symbolRule struct {
+	re        *regexp.Regexp
+	kind      string
+	where     ruleScope
+	block     bool // 続くブロックをスコープにする
+	container bool // スコープの中の関数をメソッドとして扱う（クラス・impl など）
+	scopeOnly bool // スコープだけ作り、シンボルとしては登録しない（Rust の impl、Swift の extension など）
+	body      bool // ; より先に { が来る場合だけ定義とみなす（C のプロトタイプ宣言を除くため）
+}
+
+// 種別として捕まえたキーワードの読み替え
+var symbolKindNames = map[string]string{
+	"trait":         "interface",
+	"protocol":      "interface",
+	"@interface":    "annotation",
+	"record":        "class",
+	"record class":  "class",
+	"record struct": "struct",
+	"object":        "class",
+	"actor":         "class",
+	"union":         "struct",
+	"const":         "constant",
+	"let":           "variable",
+	"var":           "variable",
+	"static":        "variable",
+}
+
+// 名前として拾ってはいけない語（制御構文の ( や、型名を関数名と取り違えるのを防ぐ）
+var symbolKeywords = map[string]bool{
+	"if": true, "for": true, "while": true, "switch": true, "catch": true, "return": true, "else": true,
+	"do": true, "sizeof": true, "throw": true, "case": true, "using": true,
+	"lock": true, "foreach": true, "function": true, "typeof": true, "await": true, "yield": true,
+	"elif": true, "when": true, "with": true, "try": true, "func": true, "var": true, "let": true,
+	"int": true, "void": true, "char": true, "long": true, "short": true, "unsigned": true, "signed": true,
+	"float": true, "double": true, "bool": true, "const": true, "static": true, "struct": true,
+	"enum": true, "union": true, "typedef": true, "template": true, "super": true, "this": true,
+	"defined": true, "decltype": true, "alignof": true, "static_assert": true, "__attribute__": true,
+}
+
+const jsIdent = `[A-Za-z_$][\w$]*`
+
+var (
+	jsSymbolRules = []symbolRule{
+		{re: regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:declare\s+)?(?:async\s+)?function\b\s*\*?\s*(?P<name>` + jsIdent + `)`), kind: "function"},
+		{re: regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:declare\s+)?(?:abstract\s+)?(?:const\s+)?(?P<kind>class|interface|enum)\s+(?P<name>` + jsIdent + `)`), block: true, container: true},
+		{re: regexp.MustCompile(`^\s*(?:export\s+)?(?:declare\s+)?(?:namespace|module)\s+(?P<name>[\w$.]+)\s*\{`), kind: "module", block: true},
+		{re: regexp.MustCompile(`^\s*(?:export\s+)?(?:declare\s+)?type\s+(?P<name>` + jsIdent + `)\s*(?:<[^=]*>)?\s*=`), kind: "type", where: ruleTop},
+		{re: regexp.MustCompile(`^\s*(?:export\s+)?(?:declare\s+)?(?:const|let|var)\s+(?P<name>` + jsIdent + `)\s*(?::[^=]+)?=\s*(?:async\s+)?(?:function\b|(?:\([^()]*\)|` + jsIdent + `)\s*(?::[^=]+?)?=>)`), kind: "function", where: ruleTop},
+		{re: regexp.MustCompile(`^\s*(?P<container>` + jsIdent + `)\.prototype\.(?P<name>` + jsIdent + `)\s*=\s*(?:async\s+)?function\b`), kind: "method", where: ruleTop},
+		{re: regexp.MustCompile(`^\s*(?:module\.)?exports\.(?P<name>` + jsIdent + `)\s*=\s*(?:async\s+)?(?:function\b|\([^()]*\)\s*=>|` + jsIdent + `\s*=>)`), kind: "function", where: ruleTop},
+		{re: regexp.MustCompile(`^\s*(?:export\s+)?(?:declare\s+)?(?P<kind>const|let|var)\s+(?P<name>` + jsIdent + `)\s*(?::[^=]+)?=`), where: ruleTop},
+		{re: regexp.MustCompile(`^\s*(?:(?:public|private|protected|static|readonly|abstract|async|override|declare|get|set)\s+)*\*?\s*(?P<name>#?` + jsIdent + `)\s*\??\s*(?:<[^>]*>)?\s*\(`), kind: "method", where: ruleMember},
+		{re: regexp.MustCompile(`^\s*(?:(?:public|private|protected|static|readonly|abstract|override|declare)\s+)*(?P<name>#?` + jsIdent + `)\s*[?!]?\s*(?::|=[^=>])`), kind: "property", where: ruleMember},
+	}
+
+	pythonSymbolRules = []symbolRule{
+		{re: regexp.MustCompile(`^\s*(?:async\s+)?def\s+(?P<name>\w+)\s*\(`), kind: "function", block: true},
+		{re: regexp.MustCompile(`^\s*class\s+(?P<name>\w+)`), kind: "class", block: true, container: true},
+		{re: regexp.MustCompile(`^(?P<name>[A-Z][A-Z0-9_]*)\s*(?::[^=]+)?=[^=]`), kind: "constant"},
+	}
+
+	rubySymbolRules = []symbolRule{
+		{re: regexp.MustCompile(`^\s*def\s+(?:self\.|(?P<container>\w+)\.)?(?P<name>\w+[?!=]?)`), kind: "function", block: true},
+		{re: regexp.MustCompile(`^\s*(?P<kind>class|module)\s+(?:\w+::)*(?P<name>[A-Z]\w*)`), block: true, container: true},
+		{re: regexp.MustCompile(`^\s*(?P<name>[A-Z][A-Z0-9_]*)\s*=[^=~]`), kind: "constant"},
+	}
+
+	javaMethodRule = symbolRule{
+		re: regexp.MustCompile(`^\s*(?:@\w+(?:\([^)]*\))?\s+)*(?:\[[^\]]*\]\s*)*(?:(?:public|private|protected|internal|static|final|abstract|synchronized|native|virtual|override|async|sealed|extern|unsafe|new|default|partial|readonly|strictfp)\s+)*` +
+			`(?:<[^>]*>\s+)?(?:[\w.?]+(?:<[^()=]*>)?(?:\[\])*\??\s+)?(?P<name>\w+)\s*(?:<[^()=]*>)?\s*\(`),
+		kind:  "method",
+		where: ruleMember,
+	}
+
+	javaSymbolRules = []symbolRule{
+		{re: regexp.MustCompile(`^\s*(?:@\w+(?:\([^)]*\))?\s+)*(?:(?:public|private|protected|static|final|abstract|sealed|non-sealed|strictfp)\s+)*(?P<kind>class|interface|enum|record|@interface)\s+(?P<name>\w+)`), block: true, container: true},
+		{re: regexp.MustCompile(`^\s*(?:(?:public|private|protected)\s+)?(?:static\s+final|final\s+static)\s+[\w.<>\[\], ?]+?\s+(?P<name>[A-Z_][A-Z0-9_]*)\s*=`), kind: "constant", where: ruleMember},
+		javaMethodRule,
+	}
+
+	csharpSymbolRules = []symbolRule{
+		{re: regexp.MustCompile(`^\s*namespace\s+(?P<name>[\w.]+)`), kind: "module", block: true},
+		{re: regexp.MustCompile(`^\s*(?:\[[^\]]*\]\s*)*(?:(?:public|private|protected|internal|static|abstract|sealed|partial|readonly|unsafe|new|file|ref)\s+)*(?P<kind>class|interface|enum|struct|record(?:\s+struct|\s+class)?)\s+(?P<name>\w+)`), block: true, container: true},
+		{re: regexp.MustCompile(`^\s*(?:(?:public|private|protected|internal|static|new)\s+)*const\s+[\w.<>\[\]?]+\s+(?P<name>\w+)\s*=`), kind: "constant", where: ruleMember},
+		javaMethodRule,
+		{re: regexp.MustCompile(`^\s*(?:\[[^\]]*\]\s*)*(?:(?:public|private|protected|internal|static|virtual|override|abstract|sealed|new|readonly|required)\s+)*[\w.<>\[\],?]+\s+(?P<name>\w+)\s*(?:\{|=>)`), kind: "property", where: ruleMember},
+	}
+
+	kotlinSymbolRules = []symbolRule{
+		{re: regexp.MustCompile(`^\s*(?:@\w+(?:\([^)]*\))?\s+)*(?:(?:public|private|protected|internal|open|abstract|sealed|data|enum|annotation|inner|value|inline|final|expect|actual|fun)\s+)*(?P<kind>class|interface|object)\s+(?P<name>\w+)`), block: true, container: true},
+		{re: regexp.MustCompile(`^\s*(?:\w+\s+)*companion\s+object\b`), block: true, container: true, scopeOnly: true},
+		{re: regexp.MustCompile(`^\s*(?:@\w+(?:\([^)]*\))?\s+)*(?:(?:public|private|protected|internal|open|abstract|override|final|inline|suspend|operator|infix|tailrec|external|expect|actual)\s+)*fun\s+(?:<[^>]*>\s*)?(?:(?P<container>[\w.]+(?:<[^>]*>)?)\.)?(?P<name>\w+)\s*\(`), kind: "function"},
+		{re: regexp.MustCompile(`^\s*(?:(?:public|private|internal)\s+)?typealias\s+(?P<name>\w+)`), kind: "type"},
+		{re: regexp.MustCompile(`^\s*(?:(?:public|private|protected|internal)\s+)?const\s+val\s+(?P<name>\w+)`), kind: "constant"},
+	}
+
+	swiftSymbolRules = []symbolRule{
+		{re: regexp.MustCompile(`^\s*(?:@\w+(?:\([^)]*\))?\s+)*(?:(?:public|private|fileprivate|internal|open|final|indirect)\s+)*(?P<kind>class|struct|enum|protocol|actor)\s+(?P<name>\w+)`), block: true, container: true},
+		{re: regexp.MustCompile(`^\s*(?:(?:public|private|fileprivate|internal)\s+)?extension\s+(?P<name>[\w.]+)`), block: true, container: true, scopeOnly: true},
+		{re: regexp.MustCompile(`^\s*(?:@\w+(?:\([^)]*\))?\s+)*(?:(?:public|private|fileprivate|internal|open|final|static|class|override|mutating|nonmutating|convenience|required|dynamic)\s+)*func\s+(?P<name>\w+)`), kind: "function"},
+		{re: regexp.MustCompile(`^\s*(?:(?:public|private|fileprivate|internal)\s+)?typealias\s+(?P<name>\w+)`), kind: "type"},
+	}
+
+	scalaSymbolRules = []symbolRule{
+		{re: regexp.MustCompile(`^\s*(?:(?:private|protected|final|sealed|abstract|implicit|case|lazy|override)\s+)*(?P<kind>class|trait|object)\s+(?P<name>\w+)`), block: true, container: true},
+		{re: regexp.MustCompile(`^\s*(?:(?:private|protected|final|override|implicit|inline|lazy)(?:\[[^\]]*\])?\s+)*def\s+(?P<name>\w+)`), kind: "function"},
+		{re: regexp.MustCompile(`^\s*type\s+(?P<name>\w+)`), kind: "type"},
+	}
+
+	rustSymbolRules = []symbolRule{
+		{re: regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:default\s+)?(?:const\s+)?(?:async\s+)?(?:unsafe\s+)?(?:extern\s+)?fn\s+(?P<name>\w+)`), kind: "function"},
+		{re: regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:unsafe\s+)?(?P<kind>struct|enum|union|trait)\s+(?P<name>\w+)`), block: true, container: true},
+		{re: regexp.MustCompile(`^\s*(?:unsafe\s+)?impl\b(?:\s*<[^{]*?>)?\s+(?:[\w:<>, &']+?\s+for\s+)?&?(?:\w+::)*(?P<name>\w+)`), block: true, container: true, scopeOnly: true},
+		{re: regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?mod\s+(?P<name>\w+)`), kind: "module", block: true},
+		{re: regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?type\s+(?P<name>\w+)`), kind: "type"},
+		{re: regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?P<kind>const|static)\s+(?:mut\s+)?(?P<name>\w+)\s*:`)},
+		{re: regexp.MustCompile(`^\s*macro_rules!\s*(?P<name>\w+)`), kind: "macro"},
+	}
+
+	cSymbolRules = []symbolRule{
+		{re: regexp.MustCompile(`^\s*#\s*define\s+(?P<name>\w+)`), kind: "macro"},
+		{re: regexp.MustCompile(`^\s*(?:inline\s+)?namespace\s+(?P<name>[\w:]+)`), kind: "module", block: true},
+		{re: regexp.MustCompile(`^\s*(?:typedef\s+)?(?:template\s*<[^>]*>\s*)?(?P<kind>struct|union|enum|class)\s+(?:class\s+|struct\s+)?(?:\w+\s+)*?(?P<name>\w+)\s*(?:final\s*)?(?::[^;{]*)?(?:\{|$)`), block: true, container: true},
+		{re: regexp.MustCompile(`^\s*typedef\s+[^;{]*\(\s*\*\s*(?P<name>\w+)\s*\)`), kind: "type"},
+		{re: regexp.MustCompile(`^\s*typedef\s+[^;{]*?\b(?P<name>\w+)\s*(?:\[[^\]]*\])?\s*;`), kind: "type"},
+		{re: regexp.MustCompile(`^\s*\}\s*(?P<name>\w+)\s*[;,]`), kind: "type", where: ruleTop},
+		{re: regexp.MustCompile(`^\s*using\s+(?P<name>\w+)\s*=`), kind: "type"},
+		{re: regexp.MustCompile(`^\s*(?:template\s*<[^>]*>\s*)?(?:[A-Za-z_][\w:<>,\*&\s]*?[\s\*&]+)?(?P<container>(?:\w+(?:<[^<>]*>)?::)*)(?P<name>~?\w+)\s*\(`), kind: "function", where: ruleTop, body: true},
+		{re: regexp.MustCompile(`^\s*(?:template\s*<[^>]*>\s*)?(?:[A-Za-z_][\w:<>,\*&\s]*?[\s\*&]+)?(?P<name>~?\w+)\s*\(`), kind: "method", where: ruleMember},
+	}
+
+	phpSymbolRules = []symbolRule{
+		{re: regexp.MustCompile(`^\s*(?:(?:abstract|final|readonly)\s+)*(?P<kind>class|interface|trait|enum)\s+(?P<name>\w+)`), block: true, container: true},
+		{re: regexp.MustCompile(`^\s*(?:(?:public|private|protected|static|abstract|final)\s+)*function\s+&?(?P<name>\w+)\s*\(`), kind: "function"},
+		{re: regexp.MustCompile(`^\s*(?:(?:public|private|protected|final)\s+)*const\s+(?:\w+\s+)?(?P<name>\w+)\s*=`), kind: "constant"},
+	}
+
+	protobufSymbolRules = []symbolRule{
+		{re: regexp.MustCompile(`^\s*(?P<kind>message|enum|service)\s+(?P<name>\w+)`), block: true, container: true},
+		{re: regexp.MustCompile(`^\s*rpc\s+(?P<name>\w+)`), kind: "method", where: ruleMember},
+	}
+
+	shellSymbolRules = []symbolRule{
+		{re: regexp.MustCompile(`^\s*function\s+(?P<name>[\w.:-]+)`), kind: "function"},
+		{re: regexp.MustCompile(`^\s*(?P<name>[\w.:-]+)\s*\(\s*\)`), kind: "function"},
+	}
+
+	powershellSymbolRules = []symbolRule{
+		{re: regexp.MustCompile(`(?i)^\s*function\s+(?P<name>[\w-]+)`), kind: "function"},
+		{re: regexp.MustCompile(`(?i)^\s*class\s+(?P<name>\w+)`), kind: "class", block: true, container: true},
+		{re: regexp.MustCompile(`(?i)^\s*(?:(?:static|hidden)\s+)*(?:\[[^\]]+\]\s*)?(?P<name>\w+)\s*\(`), kind: "method", where: ruleMember},
+	}
+
+	sqlSymbolRules = []symbolRule{
+		{re: regexp.MustCompile("(?i)^\\s*create\\s+(?:or\\s+replace\\s+)?(?:(?:temp|temporary|unique|materialized|global|local)\\s+)*(?P<kind>table|view|function|procedure|trigger|type|sequence|index|schema)\\s+(?:if\\s+not\\s+exists\\s+)?(?:[\\w\"`\\[\\]]+\\.)?[\"`\\[]?(?P<name>\\w+)")},
+	}
+
+	rSymbolRules = []symbolRule{
+		{re: regexp.MustCompile(`^\s*(?P<name>[\w.]+)\s*(?:<-|=)\s*function\b`), kind: "function"},
+	}
+
+	// 言語（utils.DetectLanguage の値）ごとの規則。Go は go/ast で別に処理する
+	symbolRules = map[string][]symbolRule{
+		"javascript": jsSymbolRules,
+		"typescript": jsSymbolRules,
+		"python":     pythonSymbolRules,
+		"ruby":       rubySymbolRules,
+		"java":       javaSymbolRules,
+		"csharp":     csharpSymbolRules,
+		"kotlin":     kotlinSymbolRules,
+		"swift":      swiftSymbolRules,
+		"scala":      scalaSymbolRules,
+		"rust":       rustSymbolRules,
+		"c":          cSymbolRules,
+		"cpp":        cSymbolRules,
+		"php":        phpSymbolRules,
+		"protobuf":   protobufSymbolRules,
+		"shell":      shellSymbolRules,
+		"powershell": powershellSymbolRules,
+		"sql":        sqlSymbolRules,
+		"r":          rSymbolRules,
+	}
+
+	// ブロックを {} ではなくインデントで判断する言語
+	indentLanguages = map[string]bool{"python": true, "ruby": true}
+)
+
+// SymbolLanguages シンボルを抽出できる言語の一覧
+func SymbolLanguages() []string {
+	languages := []string{"go"}
+	for language := range symbolRules {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// ExtractSymbols ソースから関数・型・メソッド・定数などの定義を取り出す
+// Go は go/ast で、その他の言語はコメントと文字列を除いた行に対する簡易パターンで解析する
+func ExtractSymbols(language, content string) []SymbolDef {
+	var defs []SymbolDef
+	switch {
+	case language == "go":
+		defs = extractGoSymbols(content)
+	case indentLanguages[language]:
+		defs = extractIndentSymbols(language, content, symbolRules[language])
+	case symbolRules[language] != nil:
+		defs = extractBraceSymbols(language, content, symbolRules[language])
+	}
+	if len(defs) > maxSymbolsPerFile {
+		defs = defs[:maxSymbolsPerFile]
+	}
+	return defs
+}
+
+// symbolMatch 規則に当てはまった行
+type symbolMatch struct {
+	rule      *symbolRule
+	name      string
+	kind      string
+	container string
+	column    int
+	end       int // マッチの終端（行内のバイト位置）
+}
+
+// matchSymbolRules 最初に当てはまった規則を返す。名前が予約語の場合は次の規則を試す
+func matchSymbolRules(rules []symbolRule, line string, inContainer bool) (symbolMatch, bool) {
+	for i := range rules {
+		rule := &rules[i]
+		if (rule.where == ruleTop && inContainer) || (rule.where == ruleMember && !inContainer) {
+			continue
+		}
+		m := rule.re.FindStringSubmatchIndex(line)
+		if m == nil {
+			continue
+		}
+		match := symbolMatch{rule: rule, kind: rule.kind, end: m[1]}
+		for g, groupName := range rule.re.SubexpNames() {
+			if m[2*g] < 0 {
+				continue
+			}
+			text := line[m[2*g]:m[2*g+1]]
+			switch groupName {
+			case "name":
+				match.name, match.column = text, m[2*g]+1
+			case "kind":
+				kind := strings.ToLower(strings.Join(strings.Fields(text), " "))
+				if alias, ok := symbolKindNames[kind]; ok {
+					kind = alias
+				}
+				match.kind = kind
+			case "container":
+				match.container = cleanSymbolContainer(text)
+			}
+		}
+		if symbolKeywords[match.name] || (match.name == "" && !rule.scopeOnly) {
+			continue
+		}
+		return match, true
+	}
+	return symbolMatch{}, false
+}
+
+// cleanSymbolContainer Foo<T>:: や List<T>. から型名だけを残す
+func cleanSymbolContainer(text string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range text {
+		switch {
+		case r == '<':
+			depth++
+		case r == '>':
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return strings.TrimRight(b.String(), ":.")
+}
+
+type symbolScope struct {
+	name      string
+	container bool
+	depth     int // スコープ直下の括弧の深さ
+}
+
+// extractBraceSymbols {} でブロックを作る言語の定義を取り出す
+// 関数の本体の中（スコープ直下より深い位置）はローカルな定義とみなして読まない
+func extractBraceSymbols(language, content string, rules []symbolRule) []SymbolDef {
+	lines := strings.Split(MaskSource(language, content), "\n")
+	original := strings.Split(content, "\n")
+	var defs []SymbolDef
+	var scopes []symbolScope
+	var pending *symbolScope
+	pendingLines := 0
+	depth := 0
+
+	closeBrace := func() {
+		if depth > 0 {
+			depth--
+		}
+		for len(scopes) > 0 && scopes[len(scopes)-1].depth > depth {
+			scopes = scopes[:len(scopes)-1]
+		}
+	}
+
+	for ln, line := range lines {
+		// 行頭の } は先に閉じておく（typedef struct { ... } name; の name をスコープの外として扱うため）
+		start := 0
+		for start < len(line) && (line[start] == ' ' || line[start] == '\t' || line[start] == '}') {
+			if line[start] == '}' {
+				closeBrace()
+			}
+			start++
+		}
+
+		var current *symbolScope
+		scopeDepth := 0
+		if len(scopes) > 0 {
+			current = &scopes[len(scopes)-1]
+			scopeDepth = current.depth
+		}
+		if depth == scopeDepth && strings.TrimSpace(line) != "" {
+			inContainer := current != nil && current.container
+			if match, ok := matchSymbolRules(rules, line, inContainer); ok && (!match.rule.body || hasBodyAhead(lines, ln, match.end)) {
+				pending = nil
+				if match.container == "" && inContainer {
+					match.container = current.name
+				}
+				if match.rule.block {
+					name := match.name
+					if name == "" && current != nil {
+						name = current.name
+					}
+					pending = &symbolScope{name: name, container: match.rule.container}
+					pendingLines = 0
+				}
+				if !match.rule.scopeOnly {
+					kind := match.kind
+					if kind == "function" && match.container != "" {
+						kind = "method"
+					}
+					defs = append(defs, SymbolDef{
+						Name:      match.name,
+						Kind:      kind,
+						Container: match.container,
+						Line:      ln + 1,
+						Column:    match.column,
+						Signature: symbolSignature(original[ln], line),
+					})
+				}
+			}
+		}
+
+		for i := start; i < len(line); i++ {
+			switch line[i] {
+			case '{':
+				depth++
+				if pending != nil {
+					pending.depth = depth
+					scopes = append(scopes, *pending)
+					pending = nil
+				}
+			case '}':
+				closeBrace()
+			case ';':
+				// class Foo; のような前方宣言
+				pending = nil
+			}
+		}
+		if pending != nil {
+			if pendingLines++; pendingLines > 5 {
+				pending = nil
+			}
+		}
+	}
+	return defs
+}
+
+// hasBodyAhead 位置 (ln, col) 以降で ; より先に { が現れるか
+func hasBodyAhead(lines []string, ln, col int) bool {
+	for i := ln; i < len(lines) && i < ln+10; i++ {
+		line := lines[i]
+		if i == ln {
+			line = line[col:]
+		}
+		if j := strings.IndexAny(line, "{;}"); j >= 0 {
+			return line[j] == '{'
+		}
+	}
+	return false
+}
+
+type indentFrame struct {
+	name      string
+	indent    int
+	container bool
+}
+
+// extractIndentSymbols インデントでブロックを表す言語（Python、Ruby）の定義を取り出す
+func extractIndentSymbols(language, content string, rules []symbolRule) []SymbolDef {
+	lines := strings.Split(MaskSource(language, content), "\n")
+	original := strings.Split(content, "\n")
+	var defs []SymbolDef
+	var stack []indentFrame
+
+	for ln, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+		if strings.TrimSpace(trimmed) == "" {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		var current *indentFrame
+		if len(stack) > 0 {
+			current = &stack[len(stack)-1]
+		}
+		inContainer := current != nil && current.container
+		match, ok := matchSymbolRules(rules, line, inContainer)
+		if !ok {
+			continue
+		}
+		if match.rule.block {
+			stack = append(stack, indentFrame{name: match.name, indent: indent, container: match.rule.container})
+		}
+		// 関数の中のローカルな定義は登録しない
+		if current != nil && !current.container {
+			continue
+		}
+		kind := match.kind
+		if match.container == "" && inContainer {
+			match.container = current.name
+		}
+		if kind == "function" && match.container != "" {
+			kind = "method"
+		}
+		defs = append(defs, SymbolDef{
+			Name:      match.name,
+			Kind:      kind,
+			Container: match.container,
+			Line:      ln + 1,
+			Column:    match.column,
+			Signature: symbolSignature(original[ln], line),
+		})
+	}
+	return defs
+}
+
+// symbolSignature 定義行をブロックの開始より前で切り、一覧表示用に整える
+func symbolSignature(original, masked string) string {
+	if i := strings.IndexByte(masked, '{'); i >= 0 && i <= len(original) {
+		original = original[:i]
+	}
+	return truncateSymbolText(strings.TrimSpace(original), 200)
+}
+
+// truncateSymbolText 長すぎる行を文字の途中で切らないように詰める
+func truncateSymbolText(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max] + "..."
+}
+
+// FindSymbolReferences content 中で name が識別子として現れる位置を返す（コメント・文字列の中は除く）
+// 型の解決はしないため、同名の別の識別子も含まれる
+func FindSymbolReferences(language, content, name string) []SymbolRef {
+	if name == "" {
+		return nil
+	}
+	if language == "go" {
+		if refs, ok := findGoReferences(content, name); ok {
+			return refs
+		}
+	}
+
+	dollar := language == "javascript" || language == "typescript" || language == "php" || language == "shell"
+	isIdent := func(c byte) bool {
+		return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80 || (dollar && c == '$')
+	}
+
+	original := strings.Split(content, "\n")
+	var refs []SymbolRef
+	for ln, line := range strings.Split(MaskSource(language, content), "\n") {
+		for off := 0; ; {
+			i := strings.Index(line[off:], name)
+			if i < 0 {
+				break
+			}
+			pos := off + i
+			off = pos + len(name)
+			if (pos > 0 && isIdent(line[pos-1])) || (off < len(line) && isIdent(line[off])) {
+				continue
+			}
+			refs = append(refs, SymbolRef{Line: ln + 1, Column: pos + 1, Context: truncateSymbolText(strings.TrimSpace(original[ln]), 200)})
+		}
+	}
+	return refs
+}
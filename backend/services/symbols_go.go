@@ -0,0 +1,144 @@
+package services
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// extractGoSymbols go/ast で Go ソースのトップレベルの定義とインターフェースのメソッドを取り出す
+// 構文エラーがあっても解析できた部分までは返す
+func extractGoSymbols(content string) []SymbolDef {
+	fset := token.NewFileSet()
+	file, _ := parser.ParseFile(fset, "", content, parser.SkipObjectResolution)
+	if file == nil {
+		return nil
+	}
+	lines := strings.Split(content, "\n")
+	lineText := func(pos token.Pos) string {
+		line := fset.Position(pos).Line
+		if line < 1 || line > len(lines) {
+			return ""
+		}
+		return lines[line-1]
+	}
+
+	var defs []SymbolDef
+	add := func(id *ast.Ident, kind, container, signature string) {
+		if id == nil || id.Name == "_" {
+			return
+		}
+		pos := fset.Position(id.Pos())
+		defs = append(defs, SymbolDef{
+			Name:      id.Name,
+			Kind:      kind,
+			Container: container,
+			Line:      pos.Line,
+			Column:    pos.Column,
+			Signature: signature,
+		})
+	}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			kind, container := "function", ""
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				kind, container = "method", goReceiverName(d.Recv.List[0].Type)
+			}
+			// シグネチャは本体の { の手前まで（複数行にわたる引数は1行にまとめる）
+			end := d.End()
+			if d.Body != nil {
+				end = d.Body.Lbrace
+			}
+			start, stop := fset.Position(d.Pos()).Offset, fset.Position(end).Offset
+			signature := ""
+			if start >= 0 && stop <= len(content) && start < stop {
+				signature = strings.Join(strings.Fields(content[start:stop]), " ")
+				signature = strings.NewReplacer("( ", "(", ", )", ")", " )", ")").Replace(signature)
+				signature = truncateSymbolText(signature, 200)
+			}
+			add(d.Name, kind, container, signature)
+
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					kind := "type"
+					switch s.Type.(type) {
+					case *ast.StructType:
+						kind = "struct"
+					case *ast.InterfaceType:
+						kind = "interface"
+					}
+					add(s.Name, kind, "", symbolSignature(lineText(s.Name.Pos()), lineText(s.Name.Pos())))
+					if iface, ok := s.Type.(*ast.InterfaceType); ok {
+						for _, method := range iface.Methods.List {
+							if _, ok := method.Type.(*ast.FuncType); !ok {
+								continue
+							}
+							for _, name := range method.Names {
+								add(name, "method", s.Name.Name, symbolSignature(lineText(name.Pos()), ""))
+							}
+						}
+					}
+				case *ast.ValueSpec:
+					kind := "variable"
+					if d.Tok == token.CONST {
+						kind = "constant"
+					}
+					for _, name := range s.Names {
+						add(name, kind, "", symbolSignature(lineText(name.Pos()), ""))
+					}
+				}
+			}
+		}
+	}
+	return defs
+}
+
+// goReceiverName レシーバーの型名（*T、T[K] などから T）を返す
+func goReceiverName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// findGoReferences go/ast で識別子の出現位置を探す。構文エラーがある場合は ok = false
+func findGoReferences(content, name string) ([]SymbolRef, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, false
+	}
+	lines := strings.Split(content, "\n")
+	var refs []SymbolRef
+	ast.Inspect(file, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok || id.Name != name {
+			return true
+		}
+		pos := fset.Position(id.Pos())
+		context := ""
+		if pos.Line >= 1 && pos.Line <= len(lines) {
+			context = truncateSymbolText(strings.TrimSpace(lines[pos.Line-1]), 200)
+		}
+		refs = append(refs, SymbolRef{Line: pos.Line, Column: pos.Column, Context: context})
+		return true
+	})
+	return refs, true
+}
@@ -0,0 +1,954 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"reverse-engineering-backend/models"
+)
+
+const (
+	minTrafficVariants     = 4    // 同じ位置にこれだけ値があれば経路パラメータとみなす
+	manyTrafficVariants    = 12   // 値の見た目によらず経路パラメータとみなす数
+	maxSchemaSamples       = 50   // スキーマの推定に使う配列の要素数
+	maxTrafficExchanges    = 1000 // 結果に載せる通信の一覧の上限
+	maxSequenceExchanges   = 100  // シーケンス図に描く往復の上限
+	maxSequenceLabelLength = 60
+)
+
+var (
+	trafficUUIDRe    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	trafficHexRe     = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+	trafficIntegerRe = regexp.MustCompile(`^-?[0-9]+$`)
+	trafficNumberRe  = regexp.MustCompile(`^-?[0-9]*\.[0-9]+(?:[eE][-+]?[0-9]+)?$`)
+	trafficDateRe    = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	trafficTimeRe    = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(?::\d{2}(?:\.\d+)?)?(?:Z|[+-]\d{2}:?\d{2})?$`)
+	trafficEmailRe   = regexp.MustCompile(`^[^@\s/]+@[^@\s/]+\.[A-Za-z]{2,}$`)
+	trafficTokenRe   = regexp.MustCompile(`^[A-Za-z0-9_-]{20,}$`)
+	trafficDigitRe   = regexp.MustCompile(`[0-9]`)
+)
+
+// trafficStaticExtensions API ではない静的ファイルの拡張子
+var trafficStaticExtensions = map[string]bool{
+	".js": true, ".mjs": true, ".css": true, ".map": true, ".png": true, ".jpg": true, ".jpeg": true, ".gif": true,
+	".svg": true, ".ico": true, ".webp": true, ".avif": true, ".woff": true, ".woff2": true, ".ttf": true, ".otf": true,
+	".eot": true, ".mp4": true, ".webm": true, ".mp3": true, ".wav": true,
+}
+
+// trafficIgnoredHeaders パラメータとして載せないリクエストヘッダー（X- で始まるもの以外は載せない）
+var trafficIgnoredHeaders = map[string]bool{
+	"X-Requested-With": true, "X-Forwarded-For": true, "X-Forwarded-Proto": true, "X-Forwarded-Host": true,
+	"X-Forwarded-Port": true, "X-Real-Ip": true, "X-Amzn-Trace-Id": true, "X-Client-Data": true,
+}
+
+// TrafficExchange 結果に載せる通信の一覧の1行
+type TrafficExchange struct {
+	Time       time.Time `json:"time"`
+	DurationMs float64   `json:"duration_ms"`
+	Client     string    `json:"client"`
+	Server     string    `json:"server"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	Status     int       `json:"status,omitempty"`
+	Endpoint   string    `json:"endpoint,omitempty"` // 対応するテンプレート（GET /users/{user_id}）
+	Source     string    `json:"source"`
+}
+
+// TrafficLink 通信から推定したエンドポイントとソースから見つけたルートの対応
+type TrafficLink struct {
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	CodeMethod string `json:"code_method"`
+	CodePath   string `json:"code_path"`
+	Handler    string `json:"handler,omitempty"`
+	Framework  string `json:"framework"`
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+}
+
+// TrafficReport traffic_analysis 解析の結果
+type TrafficReport struct {
+	Exchanges  []TrafficExchange `json:"exchanges"`
+	Endpoints  []*APIEndpoint    `json:"endpoints"`
+	Sequence   *Diagram          `json:"sequence"`
+	Links      []TrafficLink     `json:"links"`
+	Unobserved []string          `json:"unobserved"` // ソースにあって通信に現れなかったルート
+	security   map[*APIEndpoint][]string
+	servers    []string
+}
+
+// trafficRequest テンプレートにまとめる前の1リクエスト
+type trafficRequest struct {
+	ex       *HTTPExchange
+	segments []string
+	query    url.Values
+}
+
+// trafficTemplate メソッドとパスのテンプレートごとのリクエスト
+type trafficTemplate struct {
+	method   string
+	path     string
+	params   []string // 経路パラメータの名前（テンプレートの {} の順）
+	values   [][]string
+	requests []*trafficRequest
+}
+
+// InferTrafficAPI 通信をエンドポイントのテンプレートにまとめ、パラメータとボディのスキーマを推定する
+func InferTrafficAPI(exchanges []HTTPExchange) (*TrafficReport, int) {
+	var requests []*trafficRequest
+	skipped := 0
+	for i := range exchanges {
+		ex := &exchanges[i]
+		u, err := url.ParseRequestURI(ex.URL)
+		if err != nil || isStaticExchange(ex, u.Path) {
+			skipped++
+			continue
+		}
+		var segments []string
+		for _, seg := range strings.Split(strings.Trim(u.Path, "/"), "/") {
+			if seg != "" {
+				if unescaped, err := url.PathUnescape(seg); err == nil {
+					seg = unescaped
+				}
+				segments = append(segments, seg)
+			}
+		}
+		if strings.HasSuffix(u.Path, "/") && len(segments) > 0 {
+			segments = append(segments, "")
+		}
+		requests = append(requests, &trafficRequest{ex: ex, segments: segments, query: u.Query()})
+	}
+
+	patterns := trafficPatterns(requests)
+	byKey := make(map[string]*trafficTemplate)
+	var templates []*trafficTemplate
+	for i, req := range requests {
+		key := req.ex.Method + " " + strings.Join(patterns[i], "/")
+		t := byKey[key]
+		if t == nil {
+			t = &trafficTemplate{method: req.ex.Method}
+			t.path, t.params = trafficTemplatePath(patterns[i])
+			t.values = make([][]string, len(t.params))
+			byKey[key] = t
+			templates = append(templates, t)
+		}
+		n := 0
+		for j, seg := range patterns[i] {
+			if seg == "" || seg[0] != 0 {
+				continue
+			}
+			t.values[n] = append(t.values[n], req.segments[j])
+			n++
+		}
+		t.requests = append(t.requests, req)
+	}
+
+	report := &TrafficReport{security: make(map[*APIEndpoint][]string)}
+	servers := make(map[string]bool)
+	endpointOf := make(map[*HTTPExchange]string)
+	for _, t := range templates {
+		ep := t.endpoint(report)
+		report.Endpoints = append(report.Endpoints, ep)
+		for _, req := range t.requests {
+			endpointOf[req.ex] = strings.ToUpper(ep.Method) + " " + ep.Path
+			scheme := req.ex.Scheme
+			if scheme == "" {
+				scheme = "http"
+			}
+			servers[scheme+"://"+req.ex.Server] = true
+		}
+	}
+	sort.SliceStable(report.Endpoints, func(i, j int) bool {
+		a, b := report.Endpoints[i], report.Endpoints[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Method < b.Method
+	})
+	report.servers = sortedKeys(servers)
+
+	report.Exchanges = []TrafficExchange{}
+	for i := range exchanges {
+		if len(report.Exchanges) >= maxTrafficExchanges {
+			break
+		}
+		ex := &exchanges[i]
+		report.Exchanges = append(report.Exchanges, TrafficExchange{
+			Time:       ex.Time,
+			DurationMs: float64(ex.Duration) / float64(time.Millisecond),
+			Client:     ex.Client,
+			Server:     ex.Server,
+			Method:     ex.Method,
+			URL:        ex.URL,
+			Status:     ex.Status,
+			Endpoint:   endpointOf[ex],
+			Source:     ex.Source,
+		})
+	}
+	report.Sequence = TrafficSequenceDiagram(exchanges, endpointOf)
+	return report, skipped
+}
+
+// isStaticExchange 画像・スクリプト・フォントなどの静的ファイルと CORS のプリフライトは API の推定から外す
+func isStaticExchange(ex *HTTPExchange, p string) bool {
+	if ex.Method == http.MethodOptions && ex.RequestHeaders.Get("Access-Control-Request-Method") != "" {
+		return true
+	}
+	if trafficStaticExtensions[strings.ToLower(path.Ext(p))] {
+		return true
+	}
+	media := mediaType(ex.ResponseHeaders.Get("Content-Type"))
+	for _, prefix := range []string{"image/", "font/", "video/", "audio/", "text/css", "text/javascript", "application/javascript"} {
+		if strings.HasPrefix(media, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func mediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	if media, _, err := mime.ParseMediaType(contentType); err == nil {
+		return media
+	}
+	return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+}
+
+// isTrafficValue 値の見た目から経路パラメータ（ID・UUID・日付・トークンなど）と判断できるか
+func isTrafficValue(seg string) bool {
+	switch {
+	case trafficIntegerRe.MatchString(seg), trafficUUIDRe.MatchString(seg), trafficDateRe.MatchString(seg),
+		trafficHexRe.MatchString(seg), trafficEmailRe.MatchString(seg):
+		return true
+	}
+	return trafficTokenRe.MatchString(seg) && trafficDigitRe.MatchString(seg)
+}
+
+// trafficPatterns リクエストごとのパスのパターン。経路パラメータの位置は "\x00" にする
+// 値の見た目で決まらない位置は、前後が同じで値だけが違うリクエストの数で決める
+func trafficPatterns(requests []*trafficRequest) [][]string {
+	patterns := make([][]string, len(requests))
+	for i, req := range requests {
+		pattern := make([]string, len(req.segments))
+		for j, seg := range req.segments {
+			if isTrafficValue(seg) {
+				pattern[j] = "\x00"
+			} else {
+				pattern[j] = seg
+			}
+		}
+		patterns[i] = pattern
+	}
+
+	maxLen := 0
+	for _, p := range patterns {
+		maxLen = max(maxLen, len(p))
+	}
+	for pos := 0; pos < maxLen; pos++ {
+		groups := make(map[string][]int)
+		for i, p := range patterns {
+			if pos >= len(p) || p[pos] == "" || p[pos][0] == 0 {
+				continue
+			}
+			key := strconv.Itoa(len(p)) + "\x01" + strings.Join(p[:pos], "/") + "\x01" + strings.Join(p[pos+1:], "/")
+			groups[key] = append(groups[key], i)
+		}
+		for _, members := range groups {
+			values := make(map[string]bool)
+			valueLike := 0
+			for _, i := range members {
+				v := patterns[i][pos]
+				if !values[v] {
+					values[v] = true
+					if trafficDigitRe.MatchString(v) || strings.ContainsAny(v, "-_.@~") {
+						valueLike++
+					}
+				}
+			}
+			if len(values) < minTrafficVariants || (valueLike*4 < len(values)*3 && len(values) < manyTrafficVariants) {
+				continue
+			}
+			for _, i := range members {
+				patterns[i][pos] = "\x00"
+			}
+		}
+	}
+	return patterns
+}
+
+// trafficTemplatePath パターンから OpenAPI のパスを作る。パラメータ名は直前のセグメントの単数形 + _id
+func trafficTemplatePath(pattern []string) (string, []string) {
+	var parts, params []string
+	used := make(map[string]int)
+	for i, seg := range pattern {
+		if seg == "" || seg[0] != 0 {
+			parts = append(parts, seg)
+			continue
+		}
+		name := "param"
+		if i > 0 && pattern[i-1] != "" && pattern[i-1][0] != 0 {
+			name = strings.ReplaceAll(singularizeTableName(strings.ToLower(pattern[i-1])), "-", "_") + "_id"
+		}
+		used[name]++
+		if used[name] > 1 {
+			name = fmt.Sprintf("%s%d", name, used[name])
+		}
+		params = append(params, name)
+		parts = append(parts, "{"+name+"}")
+	}
+	return "/" + strings.Join(parts, "/"), params
+}
+
+// endpoint テンプレートに集まったリクエストからパラメータ・ボディ・レスポンスを推定する
+func (t *trafficTemplate) endpoint(report *TrafficReport) *APIEndpoint {
+	first := t.requests[0].ex
+	ep := &APIEndpoint{
+		Method:    strings.ToLower(t.method),
+		Path:      t.path,
+		RawPath:   strings.SplitN(first.URL, "?", 2)[0],
+		Framework: "traffic",
+		Tag:       first.Server,
+		File:      first.Source,
+		Samples:   len(t.requests),
+	}
+	for i, name := range t.params {
+		ep.param(name, "path", true, scalarSchemaOf(t.values[i]))
+	}
+
+	// クエリとヘッダーはすべてのリクエストにあれば必須とする
+	queryValues := make(map[string][]string)
+	headerValues := make(map[string][]string)
+	security := make(map[string]bool)
+	for _, req := range t.requests {
+		for name, values := range req.query {
+			queryValues[name] = append(queryValues[name], values...)
+		}
+		for name, values := range req.ex.RequestHeaders {
+			canonical := http.CanonicalHeaderKey(name)
+			switch {
+			case canonical == "Authorization":
+				scheme := strings.ToLower(strings.SplitN(strings.TrimSpace(values[0]), " ", 2)[0])
+				if scheme == "bearer" || scheme == "basic" {
+					security[scheme+"Auth"] = true
+				}
+			case canonical == "X-Api-Key" || canonical == "Api-Key":
+				security["apiKeyAuth"] = true
+			case strings.HasPrefix(canonical, "X-") && !trafficIgnoredHeaders[canonical]:
+				headerValues[canonical] = append(headerValues[canonical], values...)
+			}
+		}
+	}
+	for _, name := range sortedMapKeys(queryValues) {
+		ep.param(name, "query", len(t.requests) > 1 && countRequestsWith(t.requests, func(r *trafficRequest) bool { return r.query.Has(name) }) == len(t.requests), scalarSchemaOf(queryValues[name]))
+	}
+	for _, name := range sortedMapKeys(headerValues) {
+		ep.param(name, "header", len(t.requests) > 1 && countRequestsWith(t.requests, func(r *trafficRequest) bool { return r.ex.RequestHeaders.Get(name) != "" }) == len(t.requests), scalarSchemaOf(headerValues[name]))
+	}
+	if len(security) > 0 {
+		report.security[ep] = sortedKeys(security)
+	}
+
+	// ボディは Content-Type ごとに推定し、最も多い形式を使う
+	bodies := make(map[string]*APISchema)
+	counts := make(map[string]int)
+	for _, req := range t.requests {
+		if len(req.ex.RequestBody) == 0 {
+			continue
+		}
+		contentType := req.ex.RequestHeaders.Get("Content-Type")
+		media := mediaType(contentType)
+		if media == "" {
+			media = "application/octet-stream"
+		}
+		bodies[media] = mergeObservedSchemas(bodies[media], inferBodySchema(contentType, req.ex.RequestBody))
+		counts[media]++
+	}
+	if media := mostCommon(counts); media != "" {
+		ep.RequestBody = &APIRequestBody{ContentType: media, Schema: bodies[media]}
+	}
+
+	type observed struct {
+		contentType string
+		schema      *APISchema
+	}
+	responses := make(map[int]*observed)
+	for _, req := range t.requests {
+		ex := req.ex
+		if ex.Status == 0 {
+			continue
+		}
+		r := responses[ex.Status]
+		if r == nil {
+			r = &observed{}
+			responses[ex.Status] = r
+		}
+		if len(ex.ResponseBody) == 0 || ex.Status == http.StatusNoContent || ex.Status == http.StatusNotModified || ex.Method == http.MethodHead {
+			continue
+		}
+		contentType := ex.ResponseHeaders.Get("Content-Type")
+		if r.contentType == "" {
+			r.contentType = mediaType(contentType)
+			if r.contentType == "" {
+				r.contentType = "application/octet-stream"
+			}
+		}
+		r.schema = mergeObservedSchemas(r.schema, inferBodySchema(contentType, ex.ResponseBody))
+	}
+	statuses := make([]int, 0, len(responses))
+	for status := range responses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	for _, status := range statuses {
+		r := responses[status]
+		ep.respond(strconv.Itoa(status), r.contentType, r.schema)
+	}
+	return ep
+}
+
+func countRequestsWith(requests []*trafficRequest, pred func(*trafficRequest) bool) int {
+	n := 0
+	for _, r := range requests {
+		if pred(r) {
+			n++
+		}
+	}
+	return n
+}
+
+func sortedMapKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func mostCommon(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	best, bestCount := "", 0
+	for _, key := range keys {
+		if counts[key] > bestCount {
+			best, bestCount = key, counts[key]
+		}
+	}
+	return best
+}
+
+// scalarSchemaOf 文字列で観測した値（パス・クエリ・ヘッダー・フォーム）から型を推定する
+func scalarSchemaOf(values []string) *APISchema {
+	if len(values) == 0 {
+		return &APISchema{Type: "string"}
+	}
+	all := func(pred func(string) bool) bool {
+		for _, v := range values {
+			if !pred(v) {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case all(trafficIntegerRe.MatchString):
+		return &APISchema{Type: "integer"}
+	case all(func(v string) bool { return trafficIntegerRe.MatchString(v) || trafficNumberRe.MatchString(v) }):
+		return &APISchema{Type: "number"}
+	case all(func(v string) bool { return v == "true" || v == "false" }):
+		return &APISchema{Type: "boolean"}
+	}
+	schema := &APISchema{Type: "string"}
+	for i, v := range values {
+		format := stringFormat(v)
+		if i == 0 {
+			schema.Format = format
+		} else if schema.Format != format {
+			schema.Format = ""
+			break
+		}
+	}
+	return schema
+}
+
+// stringFormat JSON Schema の format に当たる文字列の形式
+func stringFormat(v string) string {
+	switch {
+	case trafficUUIDRe.MatchString(v):
+		return "uuid"
+	case trafficTimeRe.MatchString(v):
+		return "date-time"
+	case trafficDateRe.MatchString(v):
+		return "date"
+	case trafficEmailRe.MatchString(v):
+		return "email"
+	case strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://"):
+		return "uri"
+	}
+	return ""
+}
+
+// inferBodySchema ボディの Content-Type に応じてスキーマを推定する（JSON・フォーム・multipart・テキスト）
+func inferBodySchema(contentType string, body []byte) *APISchema {
+	media, params, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.Contains(media, "json") || media == "" && json.Valid(body):
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return &APISchema{Type: "string"}
+		}
+		return inferJSONSchema(v)
+	case media == "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return &APISchema{Type: "object"}
+		}
+		schema := &APISchema{Type: "object", Properties: make(map[string]*APISchema)}
+		for _, name := range sortedMapKeys(form) {
+			schema.Properties[name] = scalarSchemaOf(form[name])
+			schema.Required = append(schema.Required, name)
+		}
+		return schema
+	case media == "multipart/form-data":
+		schema := &APISchema{Type: "object", Properties: make(map[string]*APISchema)}
+		r := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := r.NextPart()
+			if err != nil {
+				break
+			}
+			name := part.FormName()
+			if name == "" {
+				continue
+			}
+			if part.FileName() != "" {
+				schema.Properties[name] = &APISchema{Type: "string", Format: "binary"}
+			} else {
+				value, _ := io.ReadAll(io.LimitReader(part, 4096))
+				schema.Properties[name] = scalarSchemaOf([]string{string(value)})
+			}
+			if !containsString(schema.Required, name) {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+		return schema
+	case strings.HasPrefix(media, "text/") || strings.HasSuffix(media, "xml"):
+		return &APISchema{Type: "string"}
+	}
+	return &APISchema{Type: "string", Format: "binary"}
+}
+
+// inferJSONSchema JSON の値1つからスキーマを作る（オブジェクトのキーはすべて必須として始め、他の標本と共通部分を取る）
+func inferJSONSchema(v interface{}) *APISchema {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		schema := &APISchema{Type: "object", Properties: make(map[string]*APISchema, len(v))}
+		// キーが ID の辞書（{"123": {...}, "456": {...}}）は additionalProperties にする
+		idKeys := len(v) >= 2
+		for key := range v {
+			if !isTrafficValue(key) {
+				idKeys = false
+				break
+			}
+		}
+		if idKeys {
+			var values *APISchema
+			for _, item := range v {
+				values = mergeObservedSchemas(values, inferJSONSchema(item))
+			}
+			return &APISchema{Type: "object", AdditionalProperties: values}
+		}
+		for key, item := range v {
+			schema.Properties[key] = inferJSONSchema(item)
+			schema.Required = append(schema.Required, key)
+		}
+		sort.Strings(schema.Required)
+		if len(schema.Properties) == 0 {
+			schema.Properties = nil
+		}
+		return schema
+	case []interface{}:
+		var items *APISchema
+		for i, item := range v {
+			if i >= maxSchemaSamples {
+				break
+			}
+			items = mergeObservedSchemas(items, inferJSONSchema(item))
+		}
+		if items == nil {
+			items = &APISchema{}
+		}
+		return &APISchema{Type: "array", Items: items}
+	case json.Number:
+		if trafficIntegerRe.MatchString(v.String()) {
+			return &APISchema{Type: "integer"}
+		}
+		return &APISchema{Type: "number"}
+	case string:
+		return &APISchema{Type: "string", Format: stringFormat(v)}
+	case bool:
+		return &APISchema{Type: "boolean"}
+	}
+	return &APISchema{Type: "null"}
+}
+
+// mergeObservedSchemas 同じ場所で観測した2つのスキーマをまとめる
+// オブジェクトのプロパティは和、必須は両方にあるものだけ。integer と number は number にする
+// null を観測した値は oneOf に type: null を加えて表す
+func mergeObservedSchemas(a, b *APISchema) *APISchema {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case isEmptyAPISchema(a):
+		return b
+	case isEmptyAPISchema(b):
+		return a
+	}
+	if len(a.OneOf) == 0 && len(b.OneOf) == 0 {
+		switch {
+		case a.Type == "object" && b.Type == "object" && (a.AdditionalProperties != nil) == (b.AdditionalProperties != nil):
+			if a.AdditionalProperties != nil {
+				return &APISchema{Type: "object", AdditionalProperties: mergeObservedSchemas(a.AdditionalProperties, b.AdditionalProperties)}
+			}
+			merged := &APISchema{Type: "object", Properties: make(map[string]*APISchema)}
+			for name, prop := range a.Properties {
+				merged.Properties[name] = prop
+			}
+			for name, prop := range b.Properties {
+				merged.Properties[name] = mergeObservedSchemas(merged.Properties[name], prop)
+			}
+			for _, name := range a.Required {
+				if containsString(b.Required, name) {
+					merged.Required = append(merged.Required, name)
+				}
+			}
+			if len(merged.Properties) == 0 {
+				merged.Properties = nil
+			}
+			return merged
+		case a.Type == "array" && b.Type == "array":
+			return &APISchema{Type: "array", Items: mergeObservedSchemas(a.Items, b.Items)}
+		case a.Type == b.Type:
+			merged := *a
+			if a.Format != b.Format {
+				merged.Format = ""
+			}
+			return &merged
+		case (a.Type == "integer" || a.Type == "number") && (b.Type == "integer" || b.Type == "number"):
+			return &APISchema{Type: "number"}
+		}
+	}
+	// 型が違う場合は oneOf にし、同じ型の候補があればそこにまとめる
+	merged := &APISchema{}
+	variants := append(append([]*APISchema{}, a.OneOf...), b.OneOf...)
+	if len(a.OneOf) == 0 {
+		variants = append(variants, a)
+	}
+	if len(b.OneOf) == 0 {
+		variants = append(variants, b)
+	}
+	for _, v := range variants {
+		placed := false
+		for i, existing := range merged.OneOf {
+			if existing.Type == v.Type {
+				merged.OneOf[i] = mergeObservedSchemas(existing, v)
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			merged.OneOf = append(merged.OneOf, v)
+		}
+	}
+	return merged
+}
+
+// LinkTrafficEndpoints 通信から推定したエンドポイントとソースのルートを、メソッドとパスの形で対応付ける
+// パラメータの位置はどちらの側でも任意のセグメントに一致する。ソースの any はすべてのメソッドに一致する
+func LinkTrafficEndpoints(observed, code []*APIEndpoint) ([]TrafficLink, []string) {
+	links := []TrafficLink{}
+	matched := make(map[*APIEndpoint]bool)
+	for _, ep := range observed {
+		var best *APIEndpoint
+		bestScore := -1
+		for _, route := range code {
+			if route.Method != ep.Method && route.Method != "any" {
+				continue
+			}
+			if score, ok := matchAPIPaths(ep.Path, route.Path); ok && score > bestScore {
+				best, bestScore = route, score
+			}
+		}
+		if best == nil {
+			continue
+		}
+		matched[best] = true
+		links = append(links, TrafficLink{
+			Method: ep.Method, Path: ep.Path, CodeMethod: best.Method, CodePath: best.Path,
+			Handler: best.Handler, Framework: best.Framework, File: best.File, Line: best.Line,
+		})
+	}
+	unobserved := []string{}
+	for _, route := range code {
+		if !matched[route] {
+			unobserved = append(unobserved, strings.ToUpper(route.Method)+" "+route.Path)
+		}
+	}
+	return links, unobserved
+}
+
+// matchAPIPaths 2つのパスのテンプレートが同じ形か。一致したリテラルのセグメントの数を返す
+func matchAPIPaths(a, b string) (int, bool) {
+	as := strings.Split(strings.Trim(a, "/"), "/")
+	bs := strings.Split(strings.Trim(b, "/"), "/")
+	if len(as) != len(bs) {
+		return 0, false
+	}
+	score := 0
+	for i := range as {
+		aParam := strings.HasPrefix(as[i], "{")
+		bParam := strings.HasPrefix(bs[i], "{")
+		switch {
+		case aParam || bParam:
+		case as[i] == bs[i]:
+			score++
+		default:
+			return 0, false
+		}
+	}
+	return score, true
+}
+
+// TrafficSequenceDiagram 通信を時刻順に並べたシーケンス図（クライアント・サーバーが参加者、往復が矢印）
+func TrafficSequenceDiagram(exchanges []HTTPExchange, endpointOf map[*HTTPExchange]string) *Diagram {
+	d := &Diagram{Type: "sequence", Nodes: []DiagramNode{}, Edges: []DiagramEdge{}}
+	seen := make(map[string]bool)
+	participant := func(id, kind string) {
+		if !seen[id] {
+			seen[id] = true
+			d.Nodes = append(d.Nodes, DiagramNode{ID: id, Label: id, Kind: kind})
+		}
+	}
+	for i := range exchanges {
+		if i >= maxSequenceExchanges {
+			break
+		}
+		ex := &exchanges[i]
+		participant(ex.Client, "client")
+		participant(ex.Server, "server")
+		label := strings.SplitN(ex.URL, "?", 2)[0]
+		if template := endpointOf[ex]; template != "" {
+			label = template[strings.IndexByte(template, ' ')+1:]
+		}
+		if len(label) > maxSequenceLabelLength {
+			label = label[:maxSequenceLabelLength-3] + "..."
+		}
+		d.Edges = append(d.Edges, DiagramEdge{From: ex.Client, To: ex.Server, Kind: "request", Label: ex.Method + " " + label})
+		if ex.Status != 0 {
+			response := strconv.Itoa(ex.Status)
+			if media := mediaType(ex.ResponseHeaders.Get("Content-Type")); media != "" {
+				response += " " + media
+			}
+			d.Edges = append(d.Edges, DiagramEdge{From: ex.Server, To: ex.Client, Kind: "response", Label: response})
+		}
+	}
+	return d
+}
+
+// OpenAPI 推定したエンドポイントから OpenAPI の草案を作る（サーバー・認証方式・ソースのハンドラーへの対応を含む）
+func (r *TrafficReport) OpenAPI(title string) map[string]interface{} {
+	doc := (&APIDiscovery{Endpoints: r.Endpoints}).OpenAPI(title)
+	doc["info"].(map[string]interface{})["description"] = "Drafted from observed HTTP traffic"
+	if len(r.servers) > 0 {
+		var servers []map[string]string
+		for _, s := range r.servers {
+			servers = append(servers, map[string]string{"url": s})
+		}
+		doc["servers"] = servers
+	}
+
+	paths := doc["paths"].(map[string]map[string]interface{})
+	operation := func(method, p string) map[string]interface{} {
+		op, _ := paths[p][method].(map[string]interface{})
+		return op
+	}
+	schemes := make(map[string]bool)
+	for ep, names := range r.security {
+		op := operation(ep.Method, ep.Path)
+		if op == nil {
+			continue
+		}
+		var requirements []map[string][]string
+		for _, name := range names {
+			requirements = append(requirements, map[string][]string{name: {}})
+			schemes[name] = true
+		}
+		op["security"] = requirements
+	}
+	if len(schemes) > 0 {
+		definitions := map[string]interface{}{}
+		for name := range schemes {
+			switch name {
+			case "bearerAuth":
+				definitions[name] = map[string]string{"type": "http", "scheme": "bearer"}
+			case "basicAuth":
+				definitions[name] = map[string]string{"type": "http", "scheme": "basic"}
+			case "apiKeyAuth":
+				definitions[name] = map[string]string{"type": "apiKey", "in": "header", "name": "X-API-Key"}
+			}
+		}
+		components, _ := doc["components"].(map[string]interface{})
+		if components == nil {
+			components = map[string]interface{}{}
+			doc["components"] = components
+		}
+		components["securitySchemes"] = definitions
+	}
+	for _, link := range r.Links {
+		if op := operation(link.Method, link.Path); op != nil {
+			op["x-implemented-by"] = map[string]interface{}{
+				"handler": link.Handler, "framework": link.Framework, "source": fmt.Sprintf("%s:%d", link.File, link.Line), "path": link.CodePath,
+			}
+		}
+	}
+	return doc
+}
+
+// loadCapture ファイルが HAR・pcapng・pcap なら通信を取り出す（対象外のファイルは nil を返す）
+func loadCapture(file *models.File) ([]HTTPExchange, error) {
+	switch file.Language {
+	case "har":
+		data := []byte(file.Content)
+		if len(data) == 0 {
+			var err error
+			if data, err = os.ReadFile(file.Path); err != nil {
+				return nil, err
+			}
+		}
+		return ParseHAR(data, file.Name)
+	case "pcapng", "pcap", "unknown", "":
+		// 拡張子のないキャプチャも先頭の印で見分ける
+		if file.Content != "" || !hasCaptureHeader(file.Path) {
+			return nil, nil
+		}
+		data, err := os.ReadFile(file.Path)
+		if err != nil {
+			return nil, err
+		}
+		packets, err := ReadPacketCapture(data)
+		if err != nil {
+			return nil, err
+		}
+		return ExtractHTTPExchanges(packets, file.Name), nil
+	}
+	return nil, nil
+}
+
+func hasCaptureHeader(name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+	return IsPacketCapture(header)
+}
+
+// runTrafficAnalysis HAR・pcapng の通信から API のエンドポイントを推定し、OpenAPI の草案とシーケンス図を作る
+// 同じプロジェクトの api_discovery 解析（なければソースから抽出したルート）と対応付ける
+func (w *AnalysisWorker) runTrafficAnalysis(analysis *models.Analysis, files []models.File) (string, error) {
+	var exchanges []HTTPExchange
+	captures := 0
+	var errors []map[string]string
+	for i := range files {
+		found, err := loadCapture(&files[i])
+		if err != nil {
+			errors = append(errors, map[string]string{"file": files[i].Name, "error": err.Error()})
+			continue
+		}
+		if found != nil {
+			captures++
+		}
+		exchanges = append(exchanges, found...)
+	}
+	if len(exchanges) == 0 {
+		return "", fmt.Errorf("no HTTP exchanges found in HAR or packet capture files")
+	}
+	sort.SliceStable(exchanges, func(i, j int) bool { return exchanges[i].Time.Before(exchanges[j].Time) })
+
+	report, skipped := InferTrafficAPI(exchanges)
+
+	// ソースのルートは完了済みの api_discovery 解析を優先し、なければその場で抽出する
+	var codeAnalysisID uint
+	var code struct {
+		Endpoints []*APIEndpoint `json:"endpoints"`
+	}
+	var discovered models.Analysis
+	if err := w.db.Where("project_id = ? AND type = ? AND status = ?", analysis.ProjectID, "api_discovery", "completed").
+		Order("updated_at DESC").First(&discovered).Error; err == nil && json.Unmarshal([]byte(discovered.Result), &code) == nil {
+		codeAnalysisID = discovered.ID
+	} else {
+		code.Endpoints = DiscoverAPI(files).Endpoints
+	}
+	report.Links, report.Unobserved = LinkTrafficEndpoints(report.Endpoints, code.Endpoints)
+
+	title := fmt.Sprintf("Project %d", analysis.ProjectID)
+	var project models.Project
+	if err := w.db.First(&project, analysis.ProjectID).Error; err == nil && project.Name != "" {
+		title = project.Name
+	}
+
+	summary := map[string]interface{}{
+		"captures":         captures,
+		"exchanges":        len(exchanges),
+		"skipped_static":   skipped,
+		"endpoints":        len(report.Endpoints),
+		"linked_endpoints": len(report.Links),
+		"servers":          report.servers,
+	}
+	if codeAnalysisID != 0 {
+		summary["api_discovery_analysis_id"] = codeAnalysisID
+	}
+	result := map[string]interface{}{
+		"exchanges":  report.Exchanges,
+		"endpoints":  report.Endpoints,
+		"openapi":    report.OpenAPI(title),
+		"sequence":   report.Sequence,
+		"links":      report.Links,
+		"unobserved": report.Unobserved,
+		"summary":    summary,
+	}
+	if len(errors) > 0 {
+		result["errors"] = errors
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
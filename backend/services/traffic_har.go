@@ -0,0 +1,117 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// harLog HAR 1.2 の必要な部分
+type harLog struct {
+	Log struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	StartedDateTime string  `json:"startedDateTime"`
+	Time            float64 `json:"time"` // ミリ秒
+	ServerIPAddress string  `json:"serverIPAddress"`
+	Request         struct {
+		Method   string         `json:"method"`
+		URL      string         `json:"url"`
+		Headers  []harNameValue `json:"headers"`
+		PostData *struct {
+			MimeType string         `json:"mimeType"`
+			Text     string         `json:"text"`
+			Params   []harNameValue `json:"params"`
+		} `json:"postData"`
+	} `json:"request"`
+	Response struct {
+		Status  int            `json:"status"`
+		Headers []harNameValue `json:"headers"`
+		Content struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+			Encoding string `json:"encoding"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ParseHAR ブラウザなどが書き出した HAR から HTTP のリクエストとレスポンスの組を取り出す
+func ParseHAR(data []byte, source string) ([]HTTPExchange, error) {
+	var har harLog
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("invalid HAR: %w", err)
+	}
+	var exchanges []HTTPExchange
+	for _, entry := range har.Log.Entries {
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil || u.Host == "" || entry.Request.Method == "" {
+			continue
+		}
+		ex := HTTPExchange{
+			Duration:        time.Duration(entry.Time * float64(time.Millisecond)),
+			Client:          "client",
+			Server:          u.Host,
+			Scheme:          u.Scheme,
+			Method:          strings.ToUpper(entry.Request.Method),
+			URL:             u.RequestURI(),
+			RequestHeaders:  harHeaders(entry.Request.Headers),
+			Status:          entry.Response.Status,
+			ResponseHeaders: harHeaders(entry.Response.Headers),
+			Source:          source,
+		}
+		if t, err := time.Parse(time.RFC3339Nano, entry.StartedDateTime); err == nil {
+			ex.Time = t
+		}
+		if post := entry.Request.PostData; post != nil {
+			if ex.RequestHeaders.Get("Content-Type") == "" && post.MimeType != "" {
+				ex.RequestHeaders.Set("Content-Type", post.MimeType)
+			}
+			ex.RequestBody = []byte(post.Text)
+			if post.Text == "" && len(post.Params) > 0 {
+				form := url.Values{}
+				for _, p := range post.Params {
+					form.Add(p.Name, p.Value)
+				}
+				ex.RequestBody = []byte(form.Encode())
+			}
+		}
+		content := entry.Response.Content
+		if ex.ResponseHeaders.Get("Content-Type") == "" && content.MimeType != "" {
+			ex.ResponseHeaders.Set("Content-Type", content.MimeType)
+		}
+		ex.ResponseBody = []byte(content.Text)
+		if content.Encoding == "base64" {
+			if decoded, err := base64.StdEncoding.DecodeString(content.Text); err == nil {
+				ex.ResponseBody = decoded
+			}
+		}
+		// HAR の本文は展開済みなので Content-Encoding は外す
+		ex.ResponseHeaders.Del("Content-Encoding")
+		exchanges = append(exchanges, ex)
+	}
+	return exchanges, nil
+}
+
+func harHeaders(values []harNameValue) http.Header {
+	header := make(http.Header)
+	for _, h := range values {
+		// HTTP/2 の疑似ヘッダー（:authority など）は除く
+		if strings.HasPrefix(h.Name, ":") {
+			continue
+		}
+		header.Add(h.Name, h.Value)
+	}
+	return header
+}
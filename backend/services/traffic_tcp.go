@@ -0,0 +1,511 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	maxTCPStreamBytes    = 64 << 20 // 1方向あたりに組み立てる上限
+	maxHTTPBodyBytes     = 1 << 20  // スキーマの推定に使うボディの上限
+	tcpFlagFIN           = 0x01
+	tcpFlagSYN           = 0x02
+	tcpFlagRST           = 0x04
+	tcpFlagACK           = 0x10
+	etherTypeIPv4        = 0x0800
+	etherTypeIPv6        = 0x86DD
+	etherTypeVLAN        = 0x8100
+	etherTypeQinQ        = 0x88A8
+	linkTypeNull         = 0
+	linkTypeEthernet     = 1
+	linkTypeRaw          = 101
+	linkTypeLoop         = 108
+	linkTypeLinuxSLL     = 113
+	linkTypeIPv4         = 228
+	linkTypeIPv6         = 229
+	linkTypeLinuxSLL2    = 276
+	ipProtocolTCP        = 6
+	ipv6HeaderHopByHop   = 0
+	ipv6HeaderRouting    = 43
+	ipv6HeaderDestOption = 60
+)
+
+// httpRequestLineRe 欠落したセグメントの後で次のリクエストの先頭を探す
+var httpRequestLineRe = regexp.MustCompile(`(?m)^(?:GET|POST|PUT|DELETE|PATCH|HEAD|OPTIONS|TRACE|CONNECT) \S+ HTTP/1\.[01]\r?\n`)
+
+// HTTPExchange キャプチャから取り出した1往復の HTTP 通信
+type HTTPExchange struct {
+	Time            time.Time
+	Duration        time.Duration
+	Client          string // 送信元（IP、HAR ではブラウザ）
+	Server          string // 接続先（Host ヘッダー、なければ IP:ポート）
+	Scheme          string
+	Method          string
+	URL             string // パスとクエリ
+	RequestHeaders  http.Header
+	RequestBody     []byte
+	Status          int
+	ResponseHeaders http.Header
+	ResponseBody    []byte
+	Source          string // 取り出したファイル
+}
+
+// tcpSegment 片方向のストリームのセグメント
+type tcpSegment struct {
+	seq  uint32
+	data []byte
+	ts   time.Time
+}
+
+// tcpStream TCP 接続の片方向
+type tcpStream struct {
+	isn      uint32 // SYN の次のシーケンス番号
+	hasISN   bool
+	segments []tcpSegment
+	bytes    int
+}
+
+// tcpConnection 4つ組ごとの TCP 接続
+type tcpConnection struct {
+	client, server string // SYN を送った側がクライアント（途中から始まったキャプチャでは最初に送った側）
+	start          time.Time
+	streams        map[string]*tcpStream
+	closed         bool
+}
+
+// tcpAssembler パケットを接続ごとに振り分ける
+type tcpAssembler struct {
+	connections []*tcpConnection
+	active      map[string]*tcpConnection
+}
+
+// tcpPacket IP・TCP ヘッダーから取り出した値
+type tcpPacket struct {
+	src, dst string
+	seq      uint32
+	flags    byte
+	payload  []byte
+}
+
+// ExtractHTTPExchanges キャプチャしたパケットから TCP を組み立て、HTTP/1.x のリクエストとレスポンスの組を取り出す
+func ExtractHTTPExchanges(packets []CapturedPacket, source string) []HTTPExchange {
+	a := &tcpAssembler{active: make(map[string]*tcpConnection)}
+	for _, pkt := range packets {
+		if tcp, ok := decodeTCPPacket(pkt); ok {
+			a.add(tcp, pkt.Timestamp)
+		}
+	}
+	var exchanges []HTTPExchange
+	for _, conn := range a.connections {
+		exchanges = append(exchanges, conn.exchanges(source)...)
+	}
+	sort.SliceStable(exchanges, func(i, j int) bool { return exchanges[i].Time.Before(exchanges[j].Time) })
+	return exchanges
+}
+
+// decodeTCPPacket リンク層・IP 層を外して TCP のヘッダーとペイロードを取り出す（IP の断片は扱わない）
+func decodeTCPPacket(pkt CapturedPacket) (tcpPacket, bool) {
+	data := pkt.Data
+	var etherType uint16
+	switch pkt.LinkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return tcpPacket{}, false
+		}
+		etherType, data = binary.BigEndian.Uint16(data[12:]), data[14:]
+		for (etherType == etherTypeVLAN || etherType == etherTypeQinQ) && len(data) >= 4 {
+			etherType, data = binary.BigEndian.Uint16(data[2:]), data[4:]
+		}
+	case linkTypeNull, linkTypeLoop:
+		if len(data) < 4 {
+			return tcpPacket{}, false
+		}
+		// アドレスファミリーはキャプチャしたホストのバイトオーダーなのでどちらでも読めるようにする
+		family := binary.LittleEndian.Uint32(data)
+		if pkt.LinkType == linkTypeLoop || family > 0xFFFF {
+			family = binary.BigEndian.Uint32(data)
+		}
+		data = data[4:]
+		switch family {
+		case 2:
+			etherType = etherTypeIPv4
+		case 10, 24, 28, 30:
+			etherType = etherTypeIPv6
+		}
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return tcpPacket{}, false
+		}
+		etherType, data = binary.BigEndian.Uint16(data[14:]), data[16:]
+	case linkTypeLinuxSLL2:
+		if len(data) < 20 {
+			return tcpPacket{}, false
+		}
+		etherType, data = binary.BigEndian.Uint16(data), data[20:]
+	case linkTypeRaw, linkTypeIPv4, linkTypeIPv6:
+		if len(data) == 0 {
+			return tcpPacket{}, false
+		}
+		switch data[0] >> 4 {
+		case 4:
+			etherType = etherTypeIPv4
+		case 6:
+			etherType = etherTypeIPv6
+		}
+	default:
+		return tcpPacket{}, false
+	}
+
+	var srcIP, dstIP net.IP
+	var segment []byte
+	switch etherType {
+	case etherTypeIPv4:
+		if len(data) < 20 || data[0]>>4 != 4 {
+			return tcpPacket{}, false
+		}
+		ihl := int(data[0]&0x0F) * 4
+		total := int(binary.BigEndian.Uint16(data[2:]))
+		if ihl < 20 || total < ihl || len(data) < ihl || data[9] != ipProtocolTCP {
+			return tcpPacket{}, false
+		}
+		if binary.BigEndian.Uint16(data[6:])&0x3FFF != 0 {
+			return tcpPacket{}, false
+		}
+		if total > len(data) || total == 0 {
+			// TSO などで全長が 0・実際より大きい場合はキャプチャした長さを使う
+			total = len(data)
+		}
+		srcIP, dstIP, segment = net.IP(data[12:16]), net.IP(data[16:20]), data[ihl:total]
+	case etherTypeIPv6:
+		if len(data) < 40 || data[0]>>4 != 6 {
+			return tcpPacket{}, false
+		}
+		next := data[6]
+		end := 40 + int(binary.BigEndian.Uint16(data[4:]))
+		if end > len(data) || end == 40 {
+			end = len(data)
+		}
+		srcIP, dstIP = net.IP(data[8:24]), net.IP(data[24:40])
+		rest := data[40:end]
+		for next == ipv6HeaderHopByHop || next == ipv6HeaderRouting || next == ipv6HeaderDestOption {
+			if len(rest) < 8 {
+				return tcpPacket{}, false
+			}
+			length := (int(rest[1]) + 1) * 8
+			if length > len(rest) {
+				return tcpPacket{}, false
+			}
+			next, rest = rest[0], rest[length:]
+		}
+		if next != ipProtocolTCP {
+			return tcpPacket{}, false
+		}
+		segment = rest
+	default:
+		return tcpPacket{}, false
+	}
+
+	if len(segment) < 20 {
+		return tcpPacket{}, false
+	}
+	offset := int(segment[12]>>4) * 4
+	if offset < 20 || offset > len(segment) {
+		return tcpPacket{}, false
+	}
+	srcPort, dstPort := binary.BigEndian.Uint16(segment), binary.BigEndian.Uint16(segment[2:])
+	return tcpPacket{
+		src:     net.JoinHostPort(srcIP.String(), fmt.Sprint(srcPort)),
+		dst:     net.JoinHostPort(dstIP.String(), fmt.Sprint(dstPort)),
+		seq:     binary.BigEndian.Uint32(segment[4:]),
+		flags:   segment[13],
+		payload: segment[offset:],
+	}, true
+}
+
+// add パケットを接続に振り分ける。閉じた接続と同じ4つ組の SYN は新しい接続として扱う
+func (a *tcpAssembler) add(pkt tcpPacket, ts time.Time) {
+	key := pkt.src + ">" + pkt.dst
+	if pkt.dst < pkt.src {
+		key = pkt.dst + ">" + pkt.src
+	}
+	syn := pkt.flags&tcpFlagSYN != 0 && pkt.flags&tcpFlagACK == 0
+	conn := a.active[key]
+	if conn == nil || syn && (conn.closed || conn.streams[pkt.src] != nil && conn.streams[pkt.src].bytes > 0) {
+		conn = &tcpConnection{client: pkt.src, server: pkt.dst, start: ts, streams: make(map[string]*tcpStream)}
+		a.active[key] = conn
+		a.connections = append(a.connections, conn)
+	}
+	if syn {
+		conn.client, conn.server = pkt.src, pkt.dst
+	}
+	stream := conn.streams[pkt.src]
+	if stream == nil {
+		stream = &tcpStream{}
+		conn.streams[pkt.src] = stream
+	}
+	if pkt.flags&tcpFlagSYN != 0 {
+		stream.isn, stream.hasISN = pkt.seq+1, true
+	}
+	if pkt.flags&(tcpFlagFIN|tcpFlagRST) != 0 {
+		conn.closed = true
+	}
+	if len(pkt.payload) > 0 && stream.bytes < maxTCPStreamBytes {
+		data := make([]byte, len(pkt.payload))
+		copy(data, pkt.payload)
+		stream.segments = append(stream.segments, tcpSegment{seq: pkt.seq, data: data, ts: ts})
+		stream.bytes += len(data)
+	}
+}
+
+// tcpMark ストリーム上の位置とそのバイトを受け取った時刻
+type tcpMark struct {
+	offset int
+	ts     time.Time
+}
+
+// assemble シーケンス番号の順に並べ、再送を除いて連結する。欠落はそのまま詰める
+func (s *tcpStream) assemble() ([]byte, []tcpMark, int) {
+	if s == nil || len(s.segments) == 0 {
+		return nil, nil, 0
+	}
+	base := s.isn
+	if !s.hasISN {
+		// SYN を見ていない場合は最初のセグメントを基準にし、それより前のものは捨てる
+		base = s.segments[0].seq
+		for _, seg := range s.segments[1:] {
+			if int32(seg.seq-base) < 0 && int32(seg.seq-base) > -1<<20 {
+				base = seg.seq
+			}
+		}
+	}
+	segments := make([]tcpSegment, len(s.segments))
+	copy(segments, s.segments)
+	rel := func(seq uint32) int64 { return int64(int32(seq - base)) }
+	sort.SliceStable(segments, func(i, j int) bool { return rel(segments[i].seq) < rel(segments[j].seq) })
+
+	var buf bytes.Buffer
+	var marks []tcpMark
+	gaps := 0
+	var next int64
+	for _, seg := range segments {
+		start := rel(seg.seq)
+		end := start + int64(len(seg.data))
+		if end <= next || start < 0 {
+			continue
+		}
+		data := seg.data
+		if start < next {
+			data = data[next-start:]
+		} else if start > next {
+			gaps++
+		}
+		marks = append(marks, tcpMark{offset: buf.Len(), ts: seg.ts})
+		buf.Write(data)
+		next = end
+	}
+	return buf.Bytes(), marks, gaps
+}
+
+// markTime ストリーム上の位置のバイトを受け取った時刻
+func markTime(marks []tcpMark, offset int) time.Time {
+	i := sort.Search(len(marks), func(i int) bool { return marks[i].offset > offset })
+	if i == 0 {
+		if len(marks) > 0 {
+			return marks[0].ts
+		}
+		return time.Time{}
+	}
+	return marks[i-1].ts
+}
+
+// exchanges 接続の両方向を HTTP として読み、リクエストとレスポンスを順に組にする
+func (c *tcpConnection) exchanges(source string) []HTTPExchange {
+	client, server := c.client, c.server
+	up, upMarks, _ := c.streams[client].assemble()
+	down, downMarks, _ := c.streams[server].assemble()
+	if !httpRequestLineRe.Match(firstLine(up)) && httpRequestLineRe.Match(firstLine(down)) {
+		// SYN を取りこぼした接続で向きを取り違えていた場合
+		client, server = server, client
+		up, down = down, up
+		upMarks, downMarks = downMarks, upMarks
+	}
+	requests := readHTTPRequests(up, upMarks)
+	if len(requests) == 0 {
+		return nil
+	}
+	responses := readHTTPResponses(down, downMarks, requests)
+
+	var exchanges []HTTPExchange
+	for i, req := range requests {
+		ex := HTTPExchange{
+			Time:           req.ts,
+			Client:         hostOnly(client),
+			Server:         server,
+			Scheme:         "http",
+			Method:         req.method,
+			URL:            req.url,
+			RequestHeaders: req.headers,
+			RequestBody:    req.body,
+			Source:         source,
+		}
+		if host := req.headers.Get("Host"); host != "" {
+			ex.Server = host
+		}
+		if i < len(responses) {
+			res := responses[i]
+			ex.Status, ex.ResponseHeaders, ex.ResponseBody = res.status, res.headers, res.body
+			if !res.ts.IsZero() && res.ts.After(req.ts) {
+				ex.Duration = res.ts.Sub(req.ts)
+			}
+		}
+		exchanges = append(exchanges, ex)
+	}
+	return exchanges
+}
+
+func firstLine(b []byte) []byte {
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		return b[:i+1]
+	}
+	return b
+}
+
+func hostOnly(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return hostport
+}
+
+// httpMessage ストリームから読んだリクエスト・レスポンス
+type httpMessage struct {
+	ts      time.Time
+	method  string
+	url     string
+	status  int
+	headers http.Header
+	body    []byte
+}
+
+// readHTTPRequests クライアント側のストリームからリクエストを順に読む。壊れた所は次のリクエスト行まで読み飛ばす
+func readHTTPRequests(data []byte, marks []tcpMark) []httpMessage {
+	var messages []httpMessage
+	for pos := 0; pos < len(data); {
+		src := bytes.NewReader(data[pos:])
+		r := bufio.NewReader(src)
+		req, err := http.ReadRequest(r)
+		if err == nil {
+			var body []byte
+			body, err = readHTTPBody(req.Body, req.Header)
+			if err == nil {
+				// http.ReadRequest は Host ヘッダーを req.Host に移すので、ヘッダーに戻しておく
+				if req.Host != "" {
+					req.Header.Set("Host", req.Host)
+				}
+				messages = append(messages, httpMessage{ts: markTime(marks, pos), method: req.Method, url: req.RequestURI, headers: req.Header, body: body})
+				consumed := len(data) - pos - src.Len() - r.Buffered()
+				if consumed <= 0 {
+					break
+				}
+				pos += consumed
+				if req.Method == http.MethodConnect {
+					// CONNECT の後はトンネル（TLS など）なので読まない
+					break
+				}
+				continue
+			}
+		}
+		loc := httpRequestLineRe.FindIndex(data[pos+1:])
+		if loc == nil {
+			break
+		}
+		pos += 1 + loc[0]
+	}
+	return messages
+}
+
+// readHTTPResponses サーバー側のストリームからレスポンスを読む（HEAD への応答にはボディがない）
+func readHTTPResponses(data []byte, marks []tcpMark, requests []httpMessage) []httpMessage {
+	var messages []httpMessage
+	for pos := 0; pos < len(data) && len(messages) < len(requests); {
+		src := bytes.NewReader(data[pos:])
+		r := bufio.NewReader(src)
+		req := &http.Request{Method: requests[len(messages)].method}
+		res, err := http.ReadResponse(r, req)
+		if err != nil {
+			break
+		}
+		body, err := readHTTPBody(res.Body, res.Header)
+		consumed := len(data) - pos - src.Len() - r.Buffered()
+		if consumed <= 0 {
+			break
+		}
+		ts := markTime(marks, pos)
+		pos += consumed
+		if res.StatusCode >= 100 && res.StatusCode < 200 {
+			if res.StatusCode == http.StatusSwitchingProtocols {
+				// WebSocket などに切り替わった後は HTTP ではない
+				messages = append(messages, httpMessage{ts: ts, status: res.StatusCode, headers: res.Header})
+				break
+			}
+			continue
+		}
+		messages = append(messages, httpMessage{ts: ts, status: res.StatusCode, headers: res.Header, body: body})
+		if err != nil {
+			break
+		}
+	}
+	return messages
+}
+
+// readHTTPBody ボディを最後まで読み（次のメッセージの位置を求めるため）、先頭だけを Content-Encoding を解いて返す
+func readHTTPBody(body io.ReadCloser, header http.Header) ([]byte, error) {
+	defer body.Close()
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, io.LimitReader(body, maxHTTPBodyBytes)); err != nil && err != io.ErrUnexpectedEOF {
+		return buf.Bytes(), err
+	}
+	if _, err := io.Copy(io.Discard, body); err != nil && err != io.ErrUnexpectedEOF {
+		return buf.Bytes(), err
+	}
+	return decodeContentEncoding(buf.Bytes(), header.Get("Content-Encoding")), nil
+}
+
+// decodeContentEncoding gzip・deflate を展開する（br などの解けない形式はそのまま返す）
+func decodeContentEncoding(data []byte, encoding string) []byte {
+	var r io.Reader
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return data
+		}
+		r = gz
+	case "deflate":
+		// deflate は zlib 形式のことも生の deflate のこともある
+		if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+			r = zr
+		} else {
+			r = flate.NewReader(bytes.NewReader(data))
+		}
+	default:
+		return data
+	}
+	decoded, err := io.ReadAll(io.LimitReader(r, maxHTTPBodyBytes))
+	if err != nil && len(decoded) == 0 {
+		return data
+	}
+	return decoded
+}
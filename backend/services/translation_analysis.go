@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"reverse-engineering-backend/models"
+)
+
+// translatableFields 解析の種類ごとの、AI が書いた文章がある場所（"files.*.result" は files の各要素の result。空なら結果全体）
+// ここに無い種類の結果は静的解析の値だけなので翻訳しない
+var translatableFields = map[string][]string{
+	"code_analysis":     {"files.*.result"},
+	"documentation":     {"files.*.result"},
+	"pattern_detection": {"files.*.result"},
+	"dependency_map":    {""},
+	"binary_diff":       {"explanation", "pairs.*.explanation"},
+	"investigation":     {"answer"},
+}
+
+// CanTranslateAnalysis 解析の結果に翻訳する文章があるか
+func CanTranslateAnalysis(analysisType string) bool {
+	_, ok := translatableFields[analysisType]
+	return ok
+}
+
+// runTranslation 翻訳元の解析の結果のうち AI が書いた文章だけを出力言語に翻訳し、元と同じ形の結果を返す
+func (w *AnalysisWorker) runTranslation(ctx context.Context, analysis *models.Analysis) (string, error) {
+	if analysis.SourceID == nil {
+		return "", fmt.Errorf("translation requires a source analysis")
+	}
+	var source models.Analysis
+	if err := w.db.First(&source, *analysis.SourceID).Error; err != nil {
+		return "", fmt.Errorf("source analysis %d not found: %w", *analysis.SourceID, err)
+	}
+	if source.Status != "completed" {
+		return "", fmt.Errorf("source analysis %d is not completed", source.ID)
+	}
+	paths, ok := translatableFields[source.Type]
+	if !ok {
+		return "", fmt.Errorf("%s results have no text to translate", source.Type)
+	}
+
+	// 出力言語を記録する前の解析は日本語のプロンプトで作られている
+	from := source.OutputLanguage
+	if from == "" {
+		from = "ja"
+	}
+	ai := w.aiFor(analysis)
+	to := ai.outputLanguage()
+	if from == to {
+		return "", fmt.Errorf("source analysis %d is already in %s", source.ID, to)
+	}
+	translate := func(text string) (string, error) {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		translated, err := ai.TranslateText(ctx, text, from, to)
+		if err != nil {
+			return "", err
+		}
+		// 原文に無い ``` で囲んで返されることがある
+		if !strings.HasPrefix(strings.TrimSpace(text), "```") {
+			translated = trimCodeFence(translated)
+		}
+		return translated, nil
+	}
+
+	if len(paths) == 1 && paths[0] == "" {
+		return translateWholeResult(source.Result, translate)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(source.Result))
+	decoder.UseNumber()
+	var result interface{}
+	if err := decoder.Decode(&result); err != nil {
+		return "", fmt.Errorf("source analysis %d has no JSON result: %w", source.ID, err)
+	}
+	for _, path := range paths {
+		var err error
+		if result, err = translateAt(result, strings.Split(path, "."), translate); err != nil {
+			return "", err
+		}
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// translateAt path の場所にある文字列を翻訳する（"*" は配列の各要素。場所が無ければ何もしない）
+func translateAt(value interface{}, path []string, translate func(string) (string, error)) (interface{}, error) {
+	if len(path) == 0 {
+		text, ok := value.(string)
+		if !ok || strings.TrimSpace(text) == "" {
+			return value, nil
+		}
+		return translate(text)
+	}
+	if path[0] == "*" {
+		items, ok := value.([]interface{})
+		if !ok {
+			return value, nil
+		}
+		for i := range items {
+			translated, err := translateAt(items[i], path[1:], translate)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = translated
+		}
+		return items, nil
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return value, nil
+	}
+	if child, exists := object[path[0]]; exists {
+		translated, err := translateAt(child, path[1:], translate)
+		if err != nil {
+			return nil, err
+		}
+		object[path[0]] = translated
+	}
+	return object, nil
+}
+
+// translateWholeResult 結果全体を翻訳する（dependency_map のように AI の回答がそのまま結果になっている場合）
+// バイトコードから復元した構造（bytecode）は識別子だけなので翻訳に渡さず、そのまま戻す
+func translateWholeResult(result string, translate func(string) (string, error)) (string, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(result), &object); err != nil {
+		return translate(result)
+	}
+	bytecode, hasBytecode := object["bytecode"]
+	delete(object, "bytecode")
+
+	text, err := json.MarshalIndent(object, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	translated, err := translate(string(text))
+	if err != nil {
+		return "", err
+	}
+	var merged map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(translated), &merged); err != nil {
+		return "", fmt.Errorf("translated result is not a JSON object: %w", err)
+	}
+	if hasBytecode {
+		merged["bytecode"] = bytecode
+	}
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// trimCodeFence 回答全体を囲んだ ``` を外す（```json のような言語名の行も外す）
+func trimCodeFence(text string) string {
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "```") || !strings.HasSuffix(trimmed, "```") || len(trimmed) < 6 {
+		return text
+	}
+	body := trimmed[3 : len(trimmed)-3]
+	if i := strings.IndexByte(body, '\n'); i >= 0 {
+		body = body[i+1:]
+	}
+	return strings.TrimSpace(body)
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"reverse-engineering-backend/models"
+)
+
+// runVulnerabilityScan SBOM と同じ方法でコンポーネントを集め、取り込み済みの OSV データベースと照合する
+// 外部には問い合わせず、データベースに無い脆弱性は報告されない
+func (w *AnalysisWorker) runVulnerabilityScan(files []models.File) (string, error) {
+	var total int64
+	if err := w.db.Model(&models.Vulnerability{}).Count(&total).Error; err != nil {
+		return "", fmt.Errorf("failed to read vulnerability database: %w", err)
+	}
+	if total == 0 {
+		return "", fmt.Errorf("no vulnerability database imported")
+	}
+
+	sbom := CollectSBOM(files)
+	if len(sbom.Manifests) == 0 {
+		return "", fmt.Errorf("no supported manifests, lockfiles or Go binaries found in project")
+	}
+	components, unresolved, err := MatchVulnerabilities(w.db, sbom.Components)
+	if err != nil {
+		return "", fmt.Errorf("failed to match vulnerabilities: %w", err)
+	}
+
+	scanned := 0
+	for _, c := range sbom.Components {
+		if c.Type == "library" {
+			scanned++
+		}
+	}
+	severity := make(map[string]int)
+	unique := make(map[string]bool)
+	findings := 0
+	fixable := 0
+	for _, c := range components {
+		for _, v := range c.Vulnerabilities {
+			findings++
+			if v.Recommended != "" {
+				fixable++
+			}
+			if !unique[v.ID] {
+				unique[v.ID] = true
+				level := v.Severity
+				if level == "" {
+					level = "unknown"
+				}
+				severity[level]++
+			}
+		}
+	}
+
+	var latest models.VulnerabilityImport
+	database := map[string]interface{}{"vulnerabilities": total}
+	if err := w.db.Order("id DESC").First(&latest).Error; err == nil {
+		database["imported_at"] = latest.CreatedAt
+		database["file_name"] = latest.FileName
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"components": components,
+		"manifests":  sbom.Manifests,
+		"summary": map[string]interface{}{
+			"components_scanned":    scanned,
+			"unresolved_versions":   unresolved,
+			"vulnerable_components": len(components),
+			"findings":              findings,
+			"fixable":               fixable,
+			"vulnerabilities":       len(unique),
+			"severity":              severity,
+			"database":              database,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
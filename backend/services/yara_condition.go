@@ -0,0 +1,443 @@
+package services
+
+import (
+	"encoding/binary"
+	"path"
+	"strings"
+)
+
+// yaraExpr condition の構文木
+type yaraExpr struct {
+	op    string // int, string, count, offset, length, at, in, of, filesize, read, rule, not, and, or, neg, 二項演算子
+	num   int64
+	name  string // 文字列識別子、ルール名、read の関数名
+	args  []*yaraExpr
+	set   []string // of の対象（識別子または $a* 形式）
+	quant string   // of の数量: all, any, none, または空（args[0] の値）
+}
+
+// yaraBinaryLevels 優先順位の低い順に並べた二項演算子
+var yaraBinaryLevels = [][]string{
+	{"|"},
+	{"^"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "\\", "%"},
+}
+
+var yaraReadFuncs = map[string]bool{
+	"uint8": true, "uint16": true, "uint32": true, "uint16be": true, "uint32be": true,
+	"int8": true, "int16": true, "int32": true, "int16be": true, "int32be": true,
+}
+
+func (p *yaraParser) parseExpr(defined map[string]bool) *yaraExpr {
+	left := p.parseAnd(defined)
+	for p.is("or") {
+		p.advance()
+		left = &yaraExpr{op: "or", args: []*yaraExpr{left, p.parseAnd(defined)}}
+	}
+	return left
+}
+
+func (p *yaraParser) parseAnd(defined map[string]bool) *yaraExpr {
+	left := p.parseNot(defined)
+	for p.is("and") {
+		p.advance()
+		left = &yaraExpr{op: "and", args: []*yaraExpr{left, p.parseNot(defined)}}
+	}
+	return left
+}
+
+func (p *yaraParser) parseNot(defined map[string]bool) *yaraExpr {
+	if !p.enter() {
+		return nil
+	}
+	defer p.leave()
+	if p.is("not") {
+		p.advance()
+		return &yaraExpr{op: "not", args: []*yaraExpr{p.parseNot(defined)}}
+	}
+	left := p.parseBinary(defined, 0)
+	for _, op := range []string{"==", "!=", "<", "<=", ">", ">="} {
+		if p.tok.kind == tokPunct && p.tok.text == op {
+			p.advance()
+			return &yaraExpr{op: op, args: []*yaraExpr{left, p.parseBinary(defined, 0)}}
+		}
+	}
+	return left
+}
+
+func (p *yaraParser) parseBinary(defined map[string]bool, level int) *yaraExpr {
+	if level == len(yaraBinaryLevels) {
+		return p.parseUnary(defined)
+	}
+	left := p.parseBinary(defined, level+1)
+	for {
+		matched := ""
+		for _, op := range yaraBinaryLevels[level] {
+			if p.tok.kind == tokPunct && p.tok.text == op {
+				matched = op
+			}
+		}
+		if matched == "" {
+			return left
+		}
+		p.advance()
+		left = &yaraExpr{op: matched, args: []*yaraExpr{left, p.parseBinary(defined, level+1)}}
+	}
+}
+
+func (p *yaraParser) parseUnary(defined map[string]bool) *yaraExpr {
+	if !p.enter() {
+		return nil
+	}
+	defer p.leave()
+	if p.tok.kind == tokPunct && (p.tok.text == "-" || p.tok.text == "~") {
+		op := map[string]string{"-": "neg", "~": "inv"}[p.tok.text]
+		p.advance()
+		return &yaraExpr{op: op, args: []*yaraExpr{p.parseUnary(defined)}}
+	}
+	return p.parsePrimary(defined)
+}
+
+func (p *yaraParser) parsePrimary(defined map[string]bool) *yaraExpr {
+	tok := p.tok
+	switch tok.kind {
+	case tokInt:
+		p.advance()
+		lit := &yaraExpr{op: "int", num: tok.num}
+		if p.is("of") {
+			return p.parseOf(defined, "", lit)
+		}
+		return lit
+	case tokStringID:
+		p.advance()
+		if tok.text == "$" || strings.HasSuffix(tok.text, "*") {
+			p.fail("%s can only be used in an of expression", tok.text)
+			return nil
+		}
+		p.checkStringID(tok.text)
+		switch {
+		case p.is("at"):
+			p.advance()
+			return &yaraExpr{op: "at", name: tok.text, args: []*yaraExpr{p.parseBinary(defined, 0)}}
+		case p.is("in"):
+			p.advance()
+			p.expect("(")
+			lo := p.parseBinary(defined, 0)
+			p.expect("..")
+			hi := p.parseBinary(defined, 0)
+			p.expect(")")
+			return &yaraExpr{op: "in", name: tok.text, args: []*yaraExpr{lo, hi}}
+		}
+		return &yaraExpr{op: "string", name: tok.text}
+	case tokCountID:
+		p.advance()
+		id := "$" + tok.text[1:]
+		p.checkStringID(id)
+		return &yaraExpr{op: "count", name: id}
+	case tokOffsetID, tokLengthID:
+		p.advance()
+		id := "$" + tok.text[1:]
+		p.checkStringID(id)
+		index := &yaraExpr{op: "int", num: 1}
+		if p.is("[") {
+			p.advance()
+			index = p.parseExpr(defined)
+			p.expect("]")
+		}
+		op := map[yaraTokenKind]string{tokOffsetID: "offset", tokLengthID: "length"}[tok.kind]
+		return &yaraExpr{op: op, name: id, args: []*yaraExpr{index}}
+	case tokIdent:
+		p.advance()
+		switch {
+		case tok.text == "true" || tok.text == "false":
+			return &yaraExpr{op: "int", num: map[string]int64{"true": 1, "false": 0}[tok.text]}
+		case tok.text == "filesize":
+			return &yaraExpr{op: "filesize"}
+		case tok.text == "all" || tok.text == "any" || tok.text == "none":
+			return p.parseOf(defined, tok.text, nil)
+		case yaraReadFuncs[tok.text]:
+			p.expect("(")
+			arg := p.parseExpr(defined)
+			p.expect(")")
+			return &yaraExpr{op: "read", name: tok.text, args: []*yaraExpr{arg}}
+		case tok.text == "for" || tok.text == "entrypoint":
+			p.fail("%s is not supported", tok.text)
+			return nil
+		case defined[tok.text]:
+			return &yaraExpr{op: "rule", name: tok.text}
+		}
+		p.fail("undefined identifier %q", tok.text)
+		return nil
+	case tokPunct:
+		if tok.text == "(" {
+			p.advance()
+			expr := p.parseExpr(defined)
+			p.expect(")")
+			return expr
+		}
+	}
+	p.fail("unexpected %q in condition", tok.text)
+	return nil
+}
+
+// parseOf 「any of them」「2 of ($a, $b*)」を解析する
+func (p *yaraParser) parseOf(defined map[string]bool, quant string, count *yaraExpr) *yaraExpr {
+	p.expect("of")
+	expr := &yaraExpr{op: "of", quant: quant}
+	if count != nil {
+		expr.args = []*yaraExpr{count}
+	}
+	if p.is("them") {
+		p.advance()
+		for _, s := range p.rule.Strings {
+			expr.set = append(expr.set, s.ID)
+		}
+		if len(expr.set) == 0 {
+			p.fail("rule %s has no strings for \"them\"", p.rule.Name)
+		}
+		return expr
+	}
+	p.expect("(")
+	for p.tok.kind == tokStringID {
+		pattern := p.tok.text
+		p.advance()
+		matched := false
+		for _, s := range p.rule.Strings {
+			if ok, _ := path.Match(pattern, s.ID); ok {
+				matched = true
+			}
+		}
+		if !matched {
+			p.fail("undefined string %s", pattern)
+			return nil
+		}
+		expr.set = append(expr.set, pattern)
+		if !p.is(",") {
+			break
+		}
+		p.advance()
+	}
+	p.expect(")")
+	return expr
+}
+
+// enter 括弧や not の入れ子を1段深くする。深すぎる場合はエラーにして false を返す
+func (p *yaraParser) enter() bool {
+	if p.depth >= maxYaraNestingDepth {
+		p.fail("condition nested too deeply")
+		return false
+	}
+	p.depth++
+	return true
+}
+
+func (p *yaraParser) leave() { p.depth-- }
+
+func (p *yaraParser) checkStringID(id string) {
+	for _, s := range p.rule.Strings {
+		if s.ID == id {
+			return
+		}
+	}
+	p.fail("undefined string %s", id)
+}
+
+// ---- 評価 ----
+
+// yaraScanContext 1ファイル・1ルールの評価に使う状態
+type yaraScanContext struct {
+	data    []byte
+	matches map[string][]yaraMatch
+	rules   map[string]bool
+}
+
+// eval 式の値を返す。ok が false の場合は未定義（範囲外の読み出しなど）で、真偽としては偽になる
+func (e *yaraExpr) eval(ctx *yaraScanContext) (int64, bool) {
+	switch e.op {
+	case "int":
+		return e.num, true
+	case "filesize":
+		return int64(len(ctx.data)), true
+	case "rule":
+		return yaraBool(ctx.rules[e.name]), true
+	case "string":
+		return yaraBool(len(ctx.matches[e.name]) > 0), true
+	case "count":
+		return int64(len(ctx.matches[e.name])), true
+	case "offset", "length":
+		i, ok := e.args[0].eval(ctx)
+		ms := ctx.matches[e.name]
+		if !ok || i < 1 || i > int64(len(ms)) {
+			return 0, false
+		}
+		if e.op == "offset" {
+			return int64(ms[i-1].Offset), true
+		}
+		return int64(ms[i-1].Length), true
+	case "at":
+		at, ok := e.args[0].eval(ctx)
+		if !ok {
+			return 0, false
+		}
+		for _, m := range ctx.matches[e.name] {
+			if int64(m.Offset) == at {
+				return 1, true
+			}
+		}
+		return 0, true
+	case "in":
+		lo, ok1 := e.args[0].eval(ctx)
+		hi, ok2 := e.args[1].eval(ctx)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		for _, m := range ctx.matches[e.name] {
+			if int64(m.Offset) >= lo && int64(m.Offset) <= hi {
+				return 1, true
+			}
+		}
+		return 0, true
+	case "of":
+		total, found := 0, 0
+		for _, pattern := range e.set {
+			for id, ms := range ctx.matches {
+				if ok, _ := path.Match(pattern, id); ok {
+					total++
+					if len(ms) > 0 {
+						found++
+					}
+				}
+			}
+		}
+		switch e.quant {
+		case "all":
+			return yaraBool(found == total), true
+		case "any":
+			return yaraBool(found > 0), true
+		case "none":
+			return yaraBool(found == 0), true
+		}
+		n, ok := e.args[0].eval(ctx)
+		return yaraBool(ok && int64(found) >= n), true
+	case "read":
+		return e.readInt(ctx)
+	case "not":
+		v, ok := e.args[0].eval(ctx)
+		if !ok {
+			return 0, false
+		}
+		return yaraBool(v == 0), true
+	case "neg":
+		v, ok := e.args[0].eval(ctx)
+		return -v, ok
+	case "inv":
+		v, ok := e.args[0].eval(ctx)
+		return ^v, ok
+	case "and":
+		if v, ok := e.args[0].eval(ctx); !ok || v == 0 {
+			return 0, true
+		}
+		v, ok := e.args[1].eval(ctx)
+		return yaraBool(ok && v != 0), true
+	case "or":
+		if v, ok := e.args[0].eval(ctx); ok && v != 0 {
+			return 1, true
+		}
+		v, ok := e.args[1].eval(ctx)
+		return yaraBool(ok && v != 0), true
+	}
+
+	a, ok1 := e.args[0].eval(ctx)
+	b, ok2 := e.args[1].eval(ctx)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	switch e.op {
+	case "==":
+		return yaraBool(a == b), true
+	case "!=":
+		return yaraBool(a != b), true
+	case "<":
+		return yaraBool(a < b), true
+	case "<=":
+		return yaraBool(a <= b), true
+	case ">":
+		return yaraBool(a > b), true
+	case ">=":
+		return yaraBool(a >= b), true
+	case "+":
+		return a + b, true
+	case "-":
+		return a - b, true
+	case "*":
+		return a * b, true
+	case "\\", "%":
+		if b == 0 {
+			return 0, false
+		}
+		if e.op == "%" {
+			return a % b, true
+		}
+		return a / b, true
+	case "&":
+		return a & b, true
+	case "|":
+		return a | b, true
+	case "^":
+		return a ^ b, true
+	case "<<", ">>":
+		if b < 0 || b > 63 {
+			return 0, false
+		}
+		if e.op == "<<" {
+			return a << uint(b), true
+		}
+		return a >> uint(b), true
+	}
+	return 0, false
+}
+
+func (e *yaraExpr) readInt(ctx *yaraScanContext) (int64, bool) {
+	off, ok := e.args[0].eval(ctx)
+	size := map[string]int64{"8": 1, "16": 2, "32": 4}[strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(e.name, "u"), "int"), "be")]
+	if !ok || off < 0 || off > int64(len(ctx.data))-size {
+		return 0, false
+	}
+	b := ctx.data[off : off+size]
+	bigEndian := strings.HasSuffix(e.name, "be")
+	signed := !strings.HasPrefix(e.name, "uint")
+
+	var v uint32
+	switch {
+	case size == 1:
+		v = uint32(b[0])
+	case size == 2 && bigEndian:
+		v = uint32(binary.BigEndian.Uint16(b))
+	case size == 2:
+		v = uint32(binary.LittleEndian.Uint16(b))
+	case bigEndian:
+		v = binary.BigEndian.Uint32(b)
+	default:
+		v = binary.LittleEndian.Uint32(b)
+	}
+	if !signed {
+		return int64(v), true
+	}
+	switch size {
+	case 1:
+		return int64(int8(v)), true
+	case 2:
+		return int64(int16(v)), true
+	}
+	return int64(int32(v)), true
+}
+
+func yaraBool(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"sort"
+	"strconv"
+)
+
+// 1つの文字列について記録するマッチ数と、結果に載せるマッチ数の上限
+const (
+	yaraMaxMatches         = 10000
+	yaraMaxReportedMatches = 20
+	yaraMaxMatchPreview    = 64
+	yaraMaxUnboundedJump   = 1 << 20
+)
+
+type yaraMatch struct {
+	Offset int
+	Length int
+}
+
+// YaraRuleMatch ファイルにマッチしたルール
+type YaraRuleMatch struct {
+	Namespace string                 `json:"namespace"`
+	Rule      string                 `json:"rule"`
+	Tags      []string               `json:"tags,omitempty"`
+	Meta      map[string]interface{} `json:"meta,omitempty"`
+	Strings   []YaraStringMatch      `json:"strings"`
+}
+
+// YaraStringMatch ルール内の文字列がマッチした位置
+type YaraStringMatch struct {
+	Identifier string `json:"identifier"`
+	Offset     int    `json:"offset"`
+	Length     int    `json:"length"`
+	Data       string `json:"data"` // 表示可能なら文字列、そうでなければ16進
+}
+
+// ScanYaraRules ルールを順に評価し、マッチした（private でない）ルールを返す
+// global ルールが1つでも偽になった場合は何もマッチしないものとして扱う
+func ScanYaraRules(namespace string, rules []*YaraRule, data []byte) []YaraRuleMatch {
+	var lower []byte
+	results := make(map[string]bool)
+	var matched []YaraRuleMatch
+
+	for _, rule := range rules {
+		ctx := &yaraScanContext{data: data, matches: make(map[string][]yaraMatch), rules: results}
+		for _, s := range rule.Strings {
+			if s.NoCase && s.Kind == "text" && lower == nil {
+				lower = yaraASCIILower(data)
+			}
+			ctx.matches[s.ID] = s.find(data, lower)
+		}
+
+		v, ok := rule.Condition.eval(ctx)
+		results[rule.Name] = ok && v != 0
+		if !results[rule.Name] || rule.Private {
+			continue
+		}
+
+		m := YaraRuleMatch{Namespace: namespace, Rule: rule.Name, Tags: rule.Tags, Strings: []YaraStringMatch{}}
+		if len(rule.Meta) > 0 {
+			m.Meta = make(map[string]interface{}, len(rule.Meta))
+			for _, meta := range rule.Meta {
+				m.Meta[meta.Key] = meta.Value
+			}
+		}
+		for _, s := range rule.Strings {
+			if s.Private {
+				continue
+			}
+			for i, sm := range ctx.matches[s.ID] {
+				if i >= yaraMaxReportedMatches {
+					break
+				}
+				m.Strings = append(m.Strings, YaraStringMatch{
+					Identifier: s.ID,
+					Offset:     sm.Offset,
+					Length:     sm.Length,
+					Data:       yaraPreview(data[sm.Offset : sm.Offset+sm.Length]),
+				})
+			}
+		}
+		matched = append(matched, m)
+	}
+
+	// global ルールはそれより前に定義されたルールにも効くため、最後に確認する
+	for _, rule := range rules {
+		if rule.Global && !results[rule.Name] {
+			return nil
+		}
+	}
+	return matched
+}
+
+func yaraPreview(b []byte) string {
+	if len(b) > yaraMaxMatchPreview {
+		b = b[:yaraMaxMatchPreview]
+	}
+	for _, c := range b {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' || c >= 0x7f {
+			return hex.EncodeToString(b)
+		}
+	}
+	return strconv.Quote(string(b))
+}
+
+// find 文字列のすべてのマッチ位置を求める（lower は nocase 用に小文字化したデータ）
+func (s *YaraString) find(data, lower []byte) []yaraMatch {
+	switch s.Kind {
+	case "hex":
+		return findHexPattern(data, s.Hex)
+	case "regex":
+		var matches []yaraMatch
+		for _, loc := range s.Regex.FindAllIndex(data, yaraMaxMatches) {
+			if loc[1] > loc[0] {
+				matches = append(matches, yaraMatch{Offset: loc[0], Length: loc[1] - loc[0]})
+			}
+		}
+		return matches
+	}
+
+	haystack := data
+	pattern := s.Text
+	if s.NoCase {
+		haystack = lower
+		pattern = yaraASCIILower(pattern)
+	}
+	var variants [][]byte
+	if s.ASCII || !s.Wide {
+		variants = append(variants, pattern)
+	}
+	if s.Wide {
+		wide := make([]byte, 0, len(pattern)*2)
+		for _, c := range pattern {
+			wide = append(wide, c, 0)
+		}
+		variants = append(variants, wide)
+	}
+
+	var matches []yaraMatch
+	for vi, needle := range variants {
+		step := 1
+		if s.Wide && (vi == 1 || !s.ASCII) {
+			step = 2
+		}
+		for pos := 0; pos <= len(haystack)-len(needle) && len(matches) < yaraMaxMatches; {
+			i := bytes.Index(haystack[pos:], needle)
+			if i < 0 {
+				break
+			}
+			off := pos + i
+			if !s.FullWord || yaraIsFullWord(data, off, len(needle), step) {
+				matches = append(matches, yaraMatch{Offset: off, Length: len(needle)})
+			}
+			pos = off + 1
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Offset < matches[j].Offset })
+	return matches
+}
+
+// yaraASCIILower ASCII の英字だけを小文字にする（bytes.ToLower は不正な UTF-8 を置き換えて長さが変わるため使わない）
+func yaraASCIILower(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		out[i] = c
+	}
+	return out
+}
+
+// yaraIsFullWord マッチの前後が英数字でないか（wide の場合は1文字=2バイトで判定）
+func yaraIsFullWord(data []byte, off, length, step int) bool {
+	isAlnum := func(c byte) bool {
+		return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	}
+	if off-step >= 0 && isAlnum(data[off-step]) {
+		return false
+	}
+	if end := off + length; end < len(data) && isAlnum(data[end]) {
+		return false
+	}
+	return true
+}
+
+// findHexPattern 16進文字列をバックトラックで照合する
+func findHexPattern(data []byte, tokens []hexToken) []yaraMatch {
+	var matches []yaraMatch
+	first := tokens[0]
+	for off := 0; off < len(data) && len(matches) < yaraMaxMatches; off++ {
+		// 先頭が固定バイトなら次の候補位置まで読み飛ばす
+		if first.alts == nil && first.mask == 0xFF {
+			i := bytes.IndexByte(data[off:], first.value)
+			if i < 0 {
+				break
+			}
+			off += i
+		}
+		if end := matchHexTokens(data, off, tokens); end >= 0 {
+			matches = append(matches, yaraMatch{Offset: off, Length: end - off})
+		}
+	}
+	return matches
+}
+
+// matchHexTokens pos からトークン列が一致すれば終端位置を、一致しなければ -1 を返す
+func matchHexTokens(data []byte, pos int, tokens []hexToken) int {
+	for i, tok := range tokens {
+		switch {
+		case tok.isJump:
+			max := tok.jumpMax
+			if max < 0 {
+				max = tok.jumpMin + yaraMaxUnboundedJump
+			}
+			for n := tok.jumpMin; n <= max && n <= len(data)-pos; n++ {
+				if end := matchHexTokens(data, pos+n, tokens[i+1:]); end >= 0 {
+					return end
+				}
+			}
+			return -1
+		case tok.alts != nil:
+			for _, alt := range tok.alts {
+				if next := matchHexTokens(data, pos, alt); next >= 0 {
+					if end := matchHexTokens(data, next, tokens[i+1:]); end >= 0 {
+						return end
+					}
+				}
+			}
+			return -1
+		default:
+			if pos >= len(data) || data[pos]&tok.mask != tok.value {
+				return -1
+			}
+			pos++
+		}
+	}
+	return pos
+}
@@ -0,0 +1,677 @@
+package services
+
+// YARA 互換ルールのサブセット
+//
+// 対応している構文:
+//   - rule / private rule / global rule、タグ（rule name : tag1 tag2）
+//   - meta: 文字列・整数・true/false
+//   - strings:
+//       テキスト "..."（\n \t \r \\ \" \xNN）と修飾子 ascii, wide, nocase, fullword, private
+//       16進 { 4D 5A ?? ?0 [2-4] ( 01 02 | 03 ) }
+//       正規表現 /.../is（Go の RE2 構文。バイト列に対して ASCII 前提で照合する）
+//   - condition:
+//       and / or / not / ( )、true / false、他のルール名の参照
+//       $a、#a、@a[i]、!a[i]、$a at N、$a in (N..M)
+//       any / all / none / N of them、N of ($a, $b*)
+//       filesize（KB・MB 接尾辞）、uint8/16/32・int8/16/32（be 付きも可）
+//       整数演算 + - * \ % & | ^ << >> と比較 == != < <= > >=
+//
+// import（pe, elf などのモジュール）、include、for 式、xor / base64 修飾子には対応していない。
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// YaraRule コンパイル済みのルール
+type YaraRule struct {
+	Name      string
+	Tags      []string
+	Meta      []YaraMeta
+	Strings   []*YaraString
+	Condition *yaraExpr
+	Private   bool
+	Global    bool
+}
+
+// YaraMeta meta セクションの値（string, int64, bool のいずれか）
+type YaraMeta struct {
+	Key   string
+	Value interface{}
+}
+
+// YaraString strings セクションで定義したパターン
+type YaraString struct {
+	ID       string // $ を含む識別子
+	Kind     string // text, hex, regex
+	Text     []byte
+	Hex      []hexToken
+	Regex    *regexp.Regexp
+	NoCase   bool
+	ASCII    bool
+	Wide     bool
+	FullWord bool
+	Private  bool
+}
+
+// ParseYaraRules ルールのソースを解析してコンパイルする
+func ParseYaraRules(source string) ([]*YaraRule, error) {
+	p := &yaraParser{lex: &yaraLexer{src: source, line: 1}}
+	p.advance()
+
+	var rules []*YaraRule
+	defined := make(map[string]bool)
+	for p.tok.kind != tokEOF {
+		if p.err != nil {
+			return nil, p.err
+		}
+		rule := p.parseRule(defined)
+		if p.err != nil {
+			return nil, p.err
+		}
+		if defined[rule.Name] {
+			return nil, fmt.Errorf("line %d: duplicate rule %q", p.tok.line, rule.Name)
+		}
+		defined[rule.Name] = true
+		rules = append(rules, rule)
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no rules defined")
+	}
+	return rules, nil
+}
+
+// 条件式・16進文字列の選択肢の入れ子の上限（深い再帰でスタックを使い果たさないため）
+const maxYaraNestingDepth = 200
+
+// ---- 字句解析 ----
+
+type yaraTokenKind int
+
+const (
+	tokEOF yaraTokenKind = iota
+	tokIdent
+	tokStringID // $a, $a*, $
+	tokCountID  // #a
+	tokOffsetID // @a
+	tokLengthID // !a
+	tokInt
+	tokText
+	tokPunct
+)
+
+type yaraToken struct {
+	kind yaraTokenKind
+	text string
+	num  int64
+	line int
+}
+
+type yaraLexer struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (l *yaraLexer) skipSpace() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "//"):
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				return fmt.Errorf("line %d: unterminated comment", l.line)
+			}
+			l.line += strings.Count(l.src[l.pos:l.pos+2+end], "\n")
+			l.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (l *yaraLexer) next() (yaraToken, error) {
+	if err := l.skipSpace(); err != nil {
+		return yaraToken{}, err
+	}
+	if l.pos >= len(l.src) {
+		return yaraToken{kind: tokEOF, line: l.line}, nil
+	}
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case c == '$' || c == '#' || c == '@' || c == '!' && l.pos+1 < len(l.src) && isIdentByte(l.src[l.pos+1]):
+		l.pos++
+		for l.pos < len(l.src) && isIdentByte(l.src[l.pos]) {
+			l.pos++
+		}
+		kind := map[byte]yaraTokenKind{'$': tokStringID, '#': tokCountID, '@': tokOffsetID, '!': tokLengthID}[c]
+		if kind == tokStringID && l.pos < len(l.src) && l.src[l.pos] == '*' {
+			l.pos++
+		}
+		return yaraToken{kind: kind, text: l.src[start:l.pos], line: l.line}, nil
+	case c >= '0' && c <= '9':
+		for l.pos < len(l.src) && (isIdentByte(l.src[l.pos])) {
+			l.pos++
+		}
+		text := l.src[start:l.pos]
+		multiplier := int64(1)
+		switch {
+		case strings.HasSuffix(text, "KB"):
+			text, multiplier = strings.TrimSuffix(text, "KB"), 1024
+		case strings.HasSuffix(text, "MB"):
+			text, multiplier = strings.TrimSuffix(text, "MB"), 1024*1024
+		}
+		n, err := strconv.ParseInt(text, 0, 64)
+		if err != nil {
+			return yaraToken{}, fmt.Errorf("line %d: invalid number %q", l.line, l.src[start:l.pos])
+		}
+		return yaraToken{kind: tokInt, text: l.src[start:l.pos], num: n * multiplier, line: l.line}, nil
+	case isIdentByte(c):
+		for l.pos < len(l.src) && isIdentByte(l.src[l.pos]) {
+			l.pos++
+		}
+		return yaraToken{kind: tokIdent, text: l.src[start:l.pos], line: l.line}, nil
+	case c == '"':
+		s, err := l.scanQuoted()
+		if err != nil {
+			return yaraToken{}, err
+		}
+		return yaraToken{kind: tokText, text: s, line: l.line}, nil
+	}
+	for _, op := range []string{"..", "==", "!=", "<=", ">=", "<<", ">>"} {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return yaraToken{kind: tokPunct, text: op, line: l.line}, nil
+		}
+	}
+	l.pos++
+	return yaraToken{kind: tokPunct, text: string(c), line: l.line}, nil
+}
+
+// scanQuoted "..." をエスケープを解釈して読み取る
+func (l *yaraLexer) scanQuoted() (string, error) {
+	l.pos++ // "
+	var sb strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			return sb.String(), nil
+		case '\n':
+			return "", fmt.Errorf("line %d: unterminated string", l.line)
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				return "", fmt.Errorf("line %d: unterminated string", l.line)
+			}
+			e := l.src[l.pos+1]
+			l.pos += 2
+			switch e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case '\\', '"':
+				sb.WriteByte(e)
+			case 'x':
+				if l.pos+2 > len(l.src) {
+					return "", fmt.Errorf("line %d: invalid \\x escape", l.line)
+				}
+				v, err := strconv.ParseUint(l.src[l.pos:l.pos+2], 16, 8)
+				if err != nil {
+					return "", fmt.Errorf("line %d: invalid \\x escape", l.line)
+				}
+				sb.WriteByte(byte(v))
+				l.pos += 2
+			default:
+				return "", fmt.Errorf("line %d: unknown escape \\%c", l.line, e)
+			}
+		default:
+			sb.WriteByte(c)
+			l.pos++
+		}
+	}
+	return "", fmt.Errorf("line %d: unterminated string", l.line)
+}
+
+// scanDelimited 16進文字列 {...} と正規表現 /.../flags の本体をそのまま読み取る
+func (l *yaraLexer) scanDelimited() (kind, body, flags string, err error) {
+	if err := l.skipSpace(); err != nil {
+		return "", "", "", err
+	}
+	if l.pos >= len(l.src) {
+		return "", "", "", fmt.Errorf("line %d: missing string value", l.line)
+	}
+	switch l.src[l.pos] {
+	case '{':
+		end := strings.IndexByte(l.src[l.pos:], '}')
+		if end < 0 {
+			return "", "", "", fmt.Errorf("line %d: unterminated hex string", l.line)
+		}
+		body = l.src[l.pos+1 : l.pos+end]
+		l.line += strings.Count(body, "\n")
+		l.pos += end + 1
+		return "hex", body, "", nil
+	case '/':
+		i := l.pos + 1
+		for ; i < len(l.src) && l.src[i] != '/'; i++ {
+			if l.src[i] == '\\' {
+				i++
+			} else if l.src[i] == '\n' {
+				break
+			}
+		}
+		if i >= len(l.src) || l.src[i] != '/' {
+			return "", "", "", fmt.Errorf("line %d: unterminated regular expression", l.line)
+		}
+		body = l.src[l.pos+1 : i]
+		l.pos = i + 1
+		for l.pos < len(l.src) && (l.src[l.pos] == 'i' || l.src[l.pos] == 's') {
+			flags += string(l.src[l.pos])
+			l.pos++
+		}
+		return "regex", body, flags, nil
+	}
+	return "", "", "", fmt.Errorf("line %d: expected string value", l.line)
+}
+
+// ---- 構文解析 ----
+
+type yaraParser struct {
+	lex *yaraLexer
+	tok yaraToken
+	err error
+
+	rule  *YaraRule
+	depth int
+}
+
+func (p *yaraParser) advance() {
+	if p.err != nil {
+		return
+	}
+	tok, err := p.lex.next()
+	if err != nil {
+		p.err = err
+		p.tok = yaraToken{kind: tokEOF}
+		return
+	}
+	p.tok = tok
+}
+
+func (p *yaraParser) fail(format string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf("line %d: %s", p.tok.line, fmt.Sprintf(format, args...))
+	}
+	p.tok = yaraToken{kind: tokEOF}
+}
+
+func (p *yaraParser) is(text string) bool {
+	return (p.tok.kind == tokPunct || p.tok.kind == tokIdent) && p.tok.text == text
+}
+
+func (p *yaraParser) expect(text string) {
+	if !p.is(text) {
+		p.fail("expected %q, found %q", text, p.tok.text)
+		return
+	}
+	p.advance()
+}
+
+func (p *yaraParser) parseRule(defined map[string]bool) *YaraRule {
+	rule := &YaraRule{}
+	p.rule = rule
+	for p.is("private") || p.is("global") {
+		if p.tok.text == "private" {
+			rule.Private = true
+		} else {
+			rule.Global = true
+		}
+		p.advance()
+	}
+	if p.is("import") || p.is("include") {
+		p.fail("%s is not supported", p.tok.text)
+		return rule
+	}
+	p.expect("rule")
+	if p.tok.kind != tokIdent {
+		p.fail("expected rule name")
+		return rule
+	}
+	rule.Name = p.tok.text
+	p.advance()
+	if p.is(":") {
+		p.advance()
+		for p.tok.kind == tokIdent {
+			rule.Tags = append(rule.Tags, p.tok.text)
+			p.advance()
+		}
+	}
+	p.expect("{")
+
+	if p.is("meta") {
+		p.advance()
+		p.expect(":")
+		for p.tok.kind == tokIdent && !p.is("strings") && !p.is("condition") {
+			key := p.tok.text
+			p.advance()
+			p.expect("=")
+			var value interface{}
+			switch {
+			case p.tok.kind == tokText:
+				value = p.tok.text
+			case p.tok.kind == tokInt:
+				value = p.tok.num
+			case p.is("-"):
+				p.advance()
+				value = -p.tok.num
+			case p.is("true"), p.is("false"):
+				value = p.tok.text == "true"
+			default:
+				p.fail("invalid meta value for %s", key)
+				return rule
+			}
+			p.advance()
+			rule.Meta = append(rule.Meta, YaraMeta{Key: key, Value: value})
+		}
+	}
+
+	if p.is("strings") {
+		p.advance()
+		p.expect(":")
+		for p.tok.kind == tokStringID {
+			p.parseStringDef(rule)
+			if p.err != nil {
+				return rule
+			}
+		}
+	}
+
+	p.expect("condition")
+	p.expect(":")
+	rule.Condition = p.parseExpr(defined)
+	p.expect("}")
+	return rule
+}
+
+func (p *yaraParser) parseStringDef(rule *YaraRule) {
+	id := p.tok.text
+	if id == "$" || strings.HasSuffix(id, "*") {
+		p.fail("invalid string identifier %s", id)
+		return
+	}
+	for _, s := range rule.Strings {
+		if s.ID == id {
+			p.fail("duplicate string identifier %s", id)
+			return
+		}
+	}
+	// 値は種類によって字句規則が異なるため、= の直後を直接読む
+	if p.lex.skipSpace() != nil || p.lex.pos >= len(p.lex.src) || p.lex.src[p.lex.pos] != '=' {
+		p.fail("expected = after %s", id)
+		return
+	}
+	p.lex.pos++
+	if err := p.lex.skipSpace(); err != nil {
+		p.err = err
+		return
+	}
+
+	def := &YaraString{ID: id}
+	if p.lex.pos < len(p.lex.src) && p.lex.src[p.lex.pos] == '"' {
+		text, err := p.lex.scanQuoted()
+		if err != nil {
+			p.err = err
+			return
+		}
+		if text == "" {
+			p.fail("empty string %s", id)
+			return
+		}
+		def.Kind, def.Text = "text", []byte(text)
+	} else {
+		kind, body, flags, err := p.lex.scanDelimited()
+		if err != nil {
+			p.err = err
+			return
+		}
+		if kind == "hex" {
+			tokens, err := parseHexString(body)
+			if err != nil {
+				p.err = fmt.Errorf("line %d: %s: %v", p.lex.line, id, err)
+				return
+			}
+			def.Kind, def.Hex = "hex", tokens
+		} else {
+			prefix := ""
+			if flags != "" {
+				prefix = "(?" + flags + ")"
+			}
+			re, err := regexp.Compile(prefix + body)
+			if err != nil {
+				p.err = fmt.Errorf("line %d: %s: %v", p.lex.line, id, err)
+				return
+			}
+			def.Kind, def.Regex = "regex", re
+		}
+	}
+
+	p.advance()
+modifiers:
+	for p.tok.kind == tokIdent {
+		switch p.tok.text {
+		case "nocase":
+			def.NoCase = true
+		case "ascii":
+			def.ASCII = true
+		case "wide":
+			def.Wide = true
+		case "fullword":
+			def.FullWord = true
+		case "private":
+			def.Private = true
+		case "xor", "base64", "base64wide":
+			p.fail("string modifier %s is not supported", p.tok.text)
+			return
+		default:
+			// 次のルール要素（condition など）の開始
+			break modifiers
+		}
+		if def.Kind == "hex" && p.tok.text != "private" {
+			p.fail("modifier %s cannot be used with hex string %s", p.tok.text, id)
+			return
+		}
+		p.advance()
+	}
+	if def.Kind == "regex" && def.NoCase {
+		def.Regex = regexp.MustCompile("(?i)" + def.Regex.String())
+	}
+	rule.Strings = append(rule.Strings, def)
+}
+
+// ---- 16進文字列 ----
+
+// hexToken 16進文字列の要素（マスク付きバイト、可変長ジャンプ、選択肢のいずれか）
+type hexToken struct {
+	value, mask byte
+	jumpMin     int
+	jumpMax     int // -1 は上限なし
+	isJump      bool
+	alts        [][]hexToken
+}
+
+func parseHexString(body string) ([]hexToken, error) {
+	var fields []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			fields = append(fields, cur.String())
+			cur.Reset()
+		}
+	}
+	inJump := false
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '[':
+			flush()
+			inJump = true
+			cur.WriteByte(c)
+		case c == ']':
+			cur.WriteByte(c)
+			inJump = false
+			flush()
+		case inJump:
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				cur.WriteByte(c)
+			}
+		case c == '(' || c == ')' || c == '|':
+			flush()
+			fields = append(fields, string(c))
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			flush()
+		default:
+			cur.WriteByte(c)
+			if cur.Len() == 2 {
+				flush()
+			}
+		}
+	}
+	flush()
+
+	pos := 0
+	tokens, err := parseHexSequence(fields, &pos, 0)
+	if err != nil {
+		return nil, err
+	}
+	if pos != len(fields) {
+		return nil, fmt.Errorf("unexpected %q in hex string", fields[pos])
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty hex string")
+	}
+	if tokens[0].isJump || tokens[len(tokens)-1].isJump {
+		return nil, fmt.Errorf("hex string cannot start or end with a jump")
+	}
+	return tokens, nil
+}
+
+func parseHexSequence(fields []string, pos *int, depth int) ([]hexToken, error) {
+	var tokens []hexToken
+	for *pos < len(fields) {
+		f := fields[*pos]
+		switch {
+		case f == ")" || f == "|":
+			if depth == 0 {
+				return nil, fmt.Errorf("unexpected %q in hex string", f)
+			}
+			return tokens, nil
+		case f == "(":
+			if depth >= maxYaraNestingDepth {
+				return nil, fmt.Errorf("hex string nested too deeply")
+			}
+			*pos++
+			var alt hexToken
+			for {
+				seq, err := parseHexSequence(fields, pos, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				if len(seq) == 0 {
+					return nil, fmt.Errorf("empty alternative in hex string")
+				}
+				alt.alts = append(alt.alts, seq)
+				if *pos >= len(fields) {
+					return nil, fmt.Errorf("unterminated alternative in hex string")
+				}
+				sep := fields[*pos]
+				*pos++
+				if sep == ")" {
+					break
+				}
+			}
+			tokens = append(tokens, alt)
+			continue
+		case strings.HasPrefix(f, "["):
+			jump, err := parseHexJump(f)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, jump)
+		default:
+			b, err := parseHexByte(f)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, b)
+		}
+		*pos++
+	}
+	return tokens, nil
+}
+
+func parseHexJump(f string) (hexToken, error) {
+	inner := strings.TrimSuffix(strings.TrimPrefix(f, "["), "]")
+	tok := hexToken{isJump: true}
+	lo, hi, isRange := strings.Cut(inner, "-")
+	var err error
+	if lo == "" {
+		tok.jumpMin = 0
+	} else if tok.jumpMin, err = strconv.Atoi(lo); err != nil {
+		return tok, fmt.Errorf("invalid jump %s", f)
+	}
+	switch {
+	case !isRange:
+		tok.jumpMax = tok.jumpMin
+	case hi == "":
+		tok.jumpMax = -1
+	default:
+		if tok.jumpMax, err = strconv.Atoi(hi); err != nil || tok.jumpMax < tok.jumpMin {
+			return tok, fmt.Errorf("invalid jump %s", f)
+		}
+	}
+	return tok, nil
+}
+
+func parseHexByte(f string) (hexToken, error) {
+	if len(f) != 2 {
+		return hexToken{}, fmt.Errorf("invalid hex byte %q", f)
+	}
+	var tok hexToken
+	for i := 0; i < 2; i++ {
+		shift := uint(4 * (1 - i))
+		c := f[i]
+		if c == '?' {
+			continue
+		}
+		v, err := strconv.ParseUint(string(c), 16, 8)
+		if err != nil {
+			return tok, fmt.Errorf("invalid hex byte %q", f)
+		}
+		tok.value |= byte(v) << shift
+		tok.mask |= 0xF << shift
+	}
+	return tok, nil
+}
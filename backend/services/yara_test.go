@@ -0,0 +1,216 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testYaraSource = `
+/* テスト用のルール */
+private rule is_mz { condition: uint16(0) == 0x5A4D }
+
+rule packed : packer upx {
+  meta:
+    author = "test"
+    score = -5
+    enabled = true
+  strings:
+    $name = "UPX!" ascii wide
+    $hex = { 55 50 ?8 ( 21 | 30 ) [0-2] 00 }
+    $re = /upx[0-9]\.[0-9]+/i
+    $hidden = "secret" nocase private
+  condition:
+    is_mz and ($name or $hex) and #re >= 1 and @name[1] < filesize // 末尾のコメント
+}
+`
+
+func TestParseYaraRules(t *testing.T) {
+	rules, err := ParseYaraRules(testYaraSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || !rules[0].Private || rules[1].Name != "packed" {
+		t.Fatalf("rules = %+v", rules)
+	}
+	r := rules[1]
+	if !reflect.DeepEqual(r.Tags, []string{"packer", "upx"}) {
+		t.Errorf("tags = %v", r.Tags)
+	}
+	wantMeta := []YaraMeta{{"author", "test"}, {"score", int64(-5)}, {"enabled", true}}
+	if !reflect.DeepEqual(r.Meta, wantMeta) {
+		t.Errorf("meta = %+v, want %+v", r.Meta, wantMeta)
+	}
+	var kinds []string
+	for _, s := range r.Strings {
+		kinds = append(kinds, s.ID+":"+s.Kind)
+	}
+	if want := []string{"$name:text", "$hex:hex", "$re:regex", "$hidden:text"}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("strings = %v, want %v", kinds, want)
+	}
+	if s := r.Strings[0]; !s.ASCII || !s.Wide || s.NoCase {
+		t.Errorf("$name modifiers = %+v", s)
+	}
+	if s := r.Strings[3]; !s.NoCase || !s.Private {
+		t.Errorf("$hidden modifiers = %+v", s)
+	}
+}
+
+func TestParseYaraRulesInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"empty", ""},
+		{"only comments", "// nothing\n/* here */"},
+		{"unterminated comment", "/* rule a"},
+		{"missing condition", "rule a { strings: $a = \"x\" }"},
+		{"missing brace", "rule a { condition: true"},
+		{"duplicate rule", "rule a { condition: true } rule a { condition: false }"},
+		{"duplicate string", `rule a { strings: $a = "x" $a = "y" condition: $a }`},
+		{"undefined string", `rule a { strings: $a = "x" condition: $b }`},
+		{"undefined rule", "rule a { condition: b }"},
+		{"them without strings", "rule a { condition: any of them }"},
+		{"import", `import "pe" rule a { condition: true }`},
+		{"for expression", `rule a { strings: $a = "x" condition: for any i in (1..#a): (@a[i] > 0) }`},
+		{"unsupported modifier", `rule a { strings: $a = "x" xor condition: $a }`},
+		{"hex with modifier", `rule a { strings: $a = { 01 } nocase condition: $a }`},
+		{"empty text", `rule a { strings: $a = "" condition: $a }`},
+		{"bad escape", `rule a { strings: $a = "\q" condition: $a }`},
+		{"truncated escape", `rule a { strings: $a = "\x4`},
+		{"truncated source", testYaraSource[:len(testYaraSource)-3]},
+		{"unterminated string", "rule a { strings: $a = \"x\n\" condition: $a }"},
+		{"unterminated regex", `rule a { strings: $a = /abc condition: $a }`},
+		{"invalid regex", `rule a { strings: $a = /a(/ condition: $a }`},
+		{"empty hex", `rule a { strings: $a = { } condition: $a }`},
+		{"hex starts with jump", `rule a { strings: $a = { [2] 01 } condition: $a }`},
+		{"hex odd digit", `rule a { strings: $a = { 0 } condition: $a }`},
+		{"hex bad digit", `rule a { strings: $a = { 0G } condition: $a }`},
+		{"hex empty alternative", `rule a { strings: $a = { 01 ( | 02 ) } condition: $a }`},
+		{"hex unterminated alternative", `rule a { strings: $a = { 01 ( 02 } condition: $a }`},
+		{"hex stray paren", `rule a { strings: $a = { 01 ) } condition: $a }`},
+		{"hex reversed jump", `rule a { strings: $a = { 01 [4-2] 02 } condition: $a }`},
+		{"invalid number", "rule a { condition: filesize > 12XB }"},
+		{"wildcard outside of", `rule a { strings: $a = "x" condition: $a* }`},
+		// 深い入れ子は再帰の前にエラーにする
+		{"deeply nested condition", "rule a { condition: " + strings.Repeat("(", 100000) + "true" + strings.Repeat(")", 100000) + " }"},
+		{"long not chain", "rule a { condition: " + strings.Repeat("not ", 100000) + "true }"},
+		{"long negation chain", "rule a { condition: " + strings.Repeat("-", 100000) + "1 }"},
+		{"deeply nested hex", `rule a { strings: $a = { 01 ` + strings.Repeat("( ", 100000) + "02" + strings.Repeat(" )", 100000) + ` } condition: $a }`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseYaraRules(tt.source); err == nil {
+				t.Error("ParseYaraRules() error = nil")
+			}
+		})
+	}
+}
+
+func TestScanYaraRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition string
+		data      string
+		want      bool
+	}{
+		{"text", `$t`, "xx Hello xx", true},
+		{"text missing", `$t`, "xx hello xx", false},
+		{"nocase", `$i`, "HELLO", true},
+		{"wide", `$w`, "h\x00i\x00", true},
+		{"fullword", `$f`, "a cat.", true},
+		{"fullword inside word", `$f`, "concatenate", false},
+		{"hex wildcard and alternative", `$h`, "\x00\x4d\x5a\x93\x02\x00\x00\x03", true},
+		{"hex jump too long", `$h`, "\x4d\x5a\x03\x02\x00\x00\x00\x03", false},
+		{"regex", `$r`, "version 1.25", true},
+		{"count", `#t == 2`, "Hello Hello", true},
+		{"offset", `@t[2] == 6`, "Hello Hello", true},
+		{"offset out of range", `@t[3] == 0`, "Hello Hello", false},
+		{"length", `!r[1] == 4`, "v 1.23", true},
+		{"at", `$t at 1`, " Hello", true},
+		{"in", `$t in (2..4)`, "  Hello", true},
+		{"of them", `2 of them`, "Hello cat", true},
+		{"of set", `all of ($t, $i)`, "Hello", true},
+		{"none of wildcard", `none of ($h*)`, "", true},
+		{"filesize", `filesize == 2KB`, strings.Repeat("x", 2048), true},
+		{"read little endian", `uint32(0) == 0x04030201`, "\x01\x02\x03\x04", true},
+		{"read big endian signed", `int16be(0) == -2`, "\xff\xfe", true},
+		{"read out of range", `uint32(2) == 0`, "\x00\x00\x00", false},
+		{"not of undefined", `not uint8(10) == 0`, "", false},
+		{"arithmetic", `(1 + 2 * 3) \ 2 == 3 and 7 % 4 == 3 and 1 << 4 == 16 and (6 & 3 | 8 ^ 1) == 11 and ~0 == -1`, "", true},
+		{"division by zero", `1 \ 0 == 0`, "", false},
+		{"shift out of range", `1 << 64 == 0`, "", false},
+		{"rule reference", `base`, "", true},
+		// オフセットに大きな値を足してもあふれない
+		{"read at huge offset", `uint32(0x7fffffffffffffff) == 0`, "\x00\x00\x00\x00", false},
+		{"read at negative offset", `uint8(-1) == 0`, "\x00", false},
+	}
+	const strs = `strings:
+    $t = "Hello"
+    $i = "hello" nocase
+    $w = "hi" wide
+    $f = "cat" fullword
+    $h = { 4D 5A ?3 ( 01 | 02 ) [1-2] 03 }
+    $r = /[0-9]\.[0-9]+/`
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := "rule base { condition: true }\nrule test { " + strs + "\n  condition: " + tt.condition + " }"
+			rules, err := ParseYaraRules(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := false
+			for _, m := range ScanYaraRules("ns", rules, []byte(tt.data)) {
+				if m.Rule == "test" {
+					got = true
+				}
+			}
+			if got != tt.want {
+				t.Errorf("%s matched = %v, want %v", tt.condition, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanYaraRulesResult(t *testing.T) {
+	rules, err := ParseYaraRules(testYaraSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("MZ\x90\x00U\x00P\x00X\x00!\x00 UPX0\x00 upx3.96 SECRET")
+	got := ScanYaraRules("packers", rules, data)
+	want := []YaraRuleMatch{{
+		Namespace: "packers",
+		Rule:      "packed",
+		Tags:      []string{"packer", "upx"},
+		Meta:      map[string]interface{}{"author": "test", "score": int64(-5), "enabled": true},
+		Strings: []YaraStringMatch{
+			{Identifier: "$name", Offset: 4, Length: 8, Data: "5500500058002100"},
+			{Identifier: "$hex", Offset: 13, Length: 5, Data: "5550583000"},
+			{Identifier: "$re", Offset: 19, Length: 7, Data: `"upx3.96"`},
+		},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ScanYaraRules() = %+v, want %+v", got, want)
+	}
+
+	// global ルールが偽なら何もマッチしない
+	global, err := ParseYaraRules("global rule small { condition: filesize < 10 }\n" + testYaraSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ScanYaraRules("packers", global, data); got != nil {
+		t.Errorf("with false global rule = %+v, want nil", got)
+	}
+}
+
+func TestScanYaraHexJumpOverflow(t *testing.T) {
+	// ジャンプ幅が大きくても位置の計算があふれて範囲外を読まない
+	rules, err := ParseYaraRules(`rule a { strings: $a = { 01 [9223372036854775807] 02 } $b = { 01 [9223372036854775000-] 02 } condition: any of them }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ScanYaraRules("ns", rules, []byte{1, 2, 1, 0, 2}); len(got) != 0 {
+		t.Errorf("matches = %+v", got)
+	}
+}
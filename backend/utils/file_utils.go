@@ -1,11 +1,22 @@
 package utils
 
 import (
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 )
 
+// ProjectUploadPath プロジェクトのアップロード先ディレクトリを返す
+func ProjectUploadPath(projectID uint) string {
+	uploadPath := os.Getenv("UPLOAD_PATH")
+	if uploadPath == "" {
+		uploadPath = "./uploads"
+	}
+	return filepath.Join(uploadPath, strconv.FormatUint(uint64(projectID), 10))
+}
+
 // DetectLanguage ファイル名から言語を推測
 func DetectLanguage(filename string) string {
 	ext := strings.ToLower(filepath.Ext(filename))
@@ -13,10 +24,15 @@ func DetectLanguage(filename string) string {
 	languageMap := map[string]string{
 		".go":         "go",
 		".js":         "javascript",
+		".mjs":        "javascript",
+		".cjs":        "javascript",
 		".ts":         "typescript",
 		".jsx":        "javascript",
 		".tsx":        "typescript",
 		".py":         "python",
+		".pyc":        "python-bytecode",
+		".pyo":        "python-bytecode",
+		".proto":      "protobuf",
 		".java":       "java",
 		".c":          "c",
 		".cpp":        "cpp",
@@ -43,6 +59,11 @@ func DetectLanguage(filename string) string {
 		".scss":       "scss",
 		".sass":       "sass",
 		".json":       "json",
+		".map":        "sourcemap",
+		".har":        "har",
+		".pcapng":     "pcapng",
+		".pcap":       "pcap",
+		".cap":        "pcap",
 		".xml":        "xml",
 		".yaml":       "yaml",
 		".yml":        "yaml",
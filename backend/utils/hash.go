@@ -0,0 +1,304 @@
+package utils
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FileHashes ファイル内容の暗号学的ハッシュとファジーハッシュ
+type FileHashes struct {
+	MD5       string
+	SHA1      string
+	SHA256    string
+	Ssdeep    string
+	BlockSize int64 // ssdeep のブロックサイズ（類似ファイルの候補を索引で絞り込むのに使う）
+}
+
+// ComputeFileHashes MD5・SHA-1・SHA-256・ssdeep をまとめて計算する
+func ComputeFileHashes(data []byte) FileHashes {
+	md5Sum := md5.Sum(data)
+	sha1Sum := sha1.Sum(data)
+	sha256Sum := sha256.Sum256(data)
+	ssdeep := SsdeepHash(data)
+	blockSize, _ := SsdeepBlockSize(ssdeep)
+	return FileHashes{
+		MD5:       hex.EncodeToString(md5Sum[:]),
+		SHA1:      hex.EncodeToString(sha1Sum[:]),
+		SHA256:    hex.EncodeToString(sha256Sum[:]),
+		Ssdeep:    ssdeep,
+		BlockSize: int64(blockSize),
+	}
+}
+
+// HashFile ディスク上のファイルのハッシュを計算する
+func HashFile(filePath string) (FileHashes, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return FileHashes{}, err
+	}
+	return ComputeFileHashes(data), nil
+}
+
+// ssdeep（Context Triggered Piecewise Hashing）のパラメータ。ssdeep 2.x と同じ値を使う
+const (
+	ssdeepRollingWindow = 7
+	ssdeepMinBlockSize  = 3
+	ssdeepLength        = 64
+	ssdeepHashInit      = 0x28021967
+	ssdeepHashPrime     = 0x01000193
+	ssdeepNumBlockHash  = 31
+	ssdeepBase64        = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+type ssdeepRoll struct {
+	window     [ssdeepRollingWindow]byte
+	h1, h2, h3 uint32
+	n          uint32
+}
+
+func (r *ssdeepRoll) hash(c byte) {
+	r.h2 -= r.h1
+	r.h2 += ssdeepRollingWindow * uint32(c)
+	r.h1 += uint32(c)
+	r.h1 -= uint32(r.window[r.n%ssdeepRollingWindow])
+	r.window[r.n%ssdeepRollingWindow] = c
+	r.n++
+	r.h3 <<= 5
+	r.h3 ^= uint32(c)
+}
+
+func (r *ssdeepRoll) sum() uint32 {
+	return r.h1 + r.h2 + r.h3
+}
+
+// ssdeepBlockHash ブロックサイズごとの途中状態（half は後半32文字分のみを切り詰めて出力するためのもの）
+type ssdeepBlockHash struct {
+	h, halfH   uint32
+	digest     [ssdeepLength]byte
+	halfDigest byte
+	dlen       int
+}
+
+func ssdeepBlockSize(i int) uint32 {
+	return ssdeepMinBlockSize << uint(i)
+}
+
+// SsdeepHash ssdeep 互換のファジーハッシュ（"blocksize:hash1:hash2"）を計算する
+func SsdeepHash(data []byte) string {
+	var roll ssdeepRoll
+	bh := make([]ssdeepBlockHash, 1, ssdeepNumBlockHash)
+	bh[0].h, bh[0].halfH = ssdeepHashInit, ssdeepHashInit
+
+	for _, c := range data {
+		roll.hash(c)
+		for i := range bh {
+			bh[i].h = bh[i].h*ssdeepHashPrime ^ uint32(c)
+			bh[i].halfH = bh[i].halfH*ssdeepHashPrime ^ uint32(c)
+		}
+
+		h := roll.sum()
+		for i := 0; i < len(bh); i++ {
+			bs := ssdeepBlockSize(i)
+			if h%bs != bs-1 {
+				break
+			}
+			// 最初のトリガーで次のブロックサイズの計算を開始する（状態はここまでのものを引き継ぐ）
+			if bh[i].dlen == 0 && i == len(bh)-1 && len(bh) < ssdeepNumBlockHash {
+				bh = append(bh, ssdeepBlockHash{h: bh[i].h, halfH: bh[i].halfH})
+			}
+			b := &bh[i]
+			b.digest[b.dlen] = ssdeepBase64[b.h%64]
+			b.halfDigest = ssdeepBase64[b.halfH%64]
+			if b.dlen < ssdeepLength-1 {
+				b.dlen++
+				b.h = ssdeepHashInit
+				if b.dlen < ssdeepLength/2 {
+					b.halfH = ssdeepHashInit
+					b.halfDigest = 0
+				}
+			}
+		}
+	}
+
+	// 入力長に見合うブロックサイズを選び、ハッシュが短すぎる場合は小さいブロックサイズに戻す
+	bi := 0
+	for uint64(ssdeepBlockSize(bi))*ssdeepLength < uint64(len(data)) && bi < ssdeepNumBlockHash-1 {
+		bi++
+	}
+	for bi >= len(bh) {
+		bi--
+	}
+	for bi > 0 && bh[bi].dlen < ssdeepLength/2 {
+		bi--
+	}
+
+	h := roll.sum()
+	var sb strings.Builder
+	sb.WriteString(strconv.FormatUint(uint64(ssdeepBlockSize(bi)), 10))
+	sb.WriteByte(':')
+	b := &bh[bi]
+	sb.Write(b.digest[:b.dlen])
+	if h != 0 {
+		sb.WriteByte(ssdeepBase64[b.h%64])
+	} else if b.digest[b.dlen] != 0 {
+		sb.WriteByte(b.digest[b.dlen])
+	}
+	sb.WriteByte(':')
+	if bi < len(bh)-1 {
+		b = &bh[bi+1]
+		n := b.dlen
+		if n > ssdeepLength/2-1 {
+			n = ssdeepLength/2 - 1
+		}
+		sb.Write(b.digest[:n])
+		if h != 0 {
+			sb.WriteByte(ssdeepBase64[b.halfH%64])
+		} else if b.halfDigest != 0 {
+			sb.WriteByte(b.halfDigest)
+		}
+	} else if h != 0 {
+		sb.WriteByte(ssdeepBase64[b.h%64])
+	}
+	return sb.String()
+}
+
+// SsdeepBlockSize ssdeep ハッシュのブロックサイズを返す（比較対象の候補を絞り込むのに使う）
+func SsdeepBlockSize(hash string) (uint64, bool) {
+	parts := strings.SplitN(hash, ":", 3)
+	if len(parts) != 3 {
+		return 0, false
+	}
+	bs, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil || bs == 0 {
+		return 0, false
+	}
+	return bs, true
+}
+
+// SsdeepCompare 2つの ssdeep ハッシュの一致度を 0〜100 で返す（ブロックサイズが同じか2倍違いの場合のみ比較できる）
+func SsdeepCompare(a, b string) int {
+	pa := strings.SplitN(a, ":", 3)
+	pb := strings.SplitN(b, ":", 3)
+	if len(pa) != 3 || len(pb) != 3 {
+		return 0
+	}
+	bs1, err1 := strconv.ParseUint(pa[0], 10, 32)
+	bs2, err2 := strconv.ParseUint(pb[0], 10, 32)
+	if err1 != nil || err2 != nil {
+		return 0
+	}
+	if bs1 != bs2 && bs1 != bs2*2 && bs2 != bs1*2 {
+		return 0
+	}
+
+	s1a, s1b := ssdeepEliminateSequences(pa[1]), ssdeepEliminateSequences(pa[2])
+	s2a, s2b := ssdeepEliminateSequences(pb[1]), ssdeepEliminateSequences(pb[2])
+	if bs1 == bs2 && s1a == s2a && s1b == s2b {
+		return 100
+	}
+
+	switch {
+	case bs1 == bs2:
+		score1 := ssdeepScoreStrings(s1a, s2a, bs1)
+		score2 := ssdeepScoreStrings(s1b, s2b, bs1*2)
+		if score1 > score2 {
+			return score1
+		}
+		return score2
+	case bs1 == bs2*2:
+		return ssdeepScoreStrings(s1a, s2b, bs1)
+	default:
+		return ssdeepScoreStrings(s1b, s2a, bs2)
+	}
+}
+
+// ssdeepEliminateSequences 同じ文字が4つ以上続く部分を3つに縮める（単調なデータによる誤一致を防ぐ）
+func ssdeepEliminateSequences(s string) string {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if i >= 3 && s[i] == s[i-1] && s[i] == s[i-2] && s[i] == s[i-3] {
+			continue
+		}
+		out = append(out, s[i])
+	}
+	return string(out)
+}
+
+func ssdeepScoreStrings(s1, s2 string, blockSize uint64) int {
+	if len(s1) > ssdeepLength || len(s2) > ssdeepLength {
+		return 0
+	}
+	if !ssdeepHasCommonSubstring(s1, s2) {
+		return 0
+	}
+
+	score := uint64(ssdeepEditDistance(s1, s2))
+	score = score * ssdeepLength / uint64(len(s1)+len(s2))
+	score = 100 * score / ssdeepLength
+	if score >= 100 {
+		return 0
+	}
+	score = 100 - score
+
+	// ブロックサイズが小さい場合は、短いハッシュ同士の一致を過大評価しないよう上限を設ける
+	if blockSize >= (99+ssdeepRollingWindow)/ssdeepRollingWindow*ssdeepMinBlockSize {
+		return int(score)
+	}
+	minLen := len(s1)
+	if len(s2) < minLen {
+		minLen = len(s2)
+	}
+	if limit := blockSize / ssdeepMinBlockSize * uint64(minLen); score > limit {
+		score = limit
+	}
+	return int(score)
+}
+
+// ssdeepHasCommonSubstring ローリングウィンドウ長（7文字）以上の共通部分文字列があるか
+func ssdeepHasCommonSubstring(s1, s2 string) bool {
+	if len(s1) < ssdeepRollingWindow || len(s2) < ssdeepRollingWindow {
+		return false
+	}
+	windows := make(map[string]bool, len(s1))
+	for i := 0; i+ssdeepRollingWindow <= len(s1); i++ {
+		windows[s1[i:i+ssdeepRollingWindow]] = true
+	}
+	for i := 0; i+ssdeepRollingWindow <= len(s2); i++ {
+		if windows[s2[i:i+ssdeepRollingWindow]] {
+			return true
+		}
+	}
+	return false
+}
+
+// ssdeepEditDistance 挿入・削除を1、置換を2とする編集距離
+func ssdeepEditDistance(s1, s2 string) int {
+	prev := make([]int, len(s2)+1)
+	cur := make([]int, len(s2)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s1); i++ {
+		cur[0] = i
+		for j := 1; j <= len(s2); j++ {
+			cost := prev[j-1]
+			if s1[i-1] != s2[j-1] {
+				cost += 2
+			}
+			if v := prev[j] + 1; v < cost {
+				cost = v
+			}
+			if v := cur[j-1] + 1; v < cost {
+				cost = v
+			}
+			cur[j] = cost
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(s2)]
+}
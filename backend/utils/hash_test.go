@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// ssdeepTestText 同じ行を少しずつ変えて並べたテキスト
+func ssdeepTestText() []byte {
+	var b strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&b, "line %d: the quick brown fox jumps over the lazy dog\n", i)
+	}
+	return []byte(b.String())
+}
+
+// ssdeepTestRandom 線形合同法で作った再現できる擬似乱数のバイト列
+func ssdeepTestRandom() []byte {
+	data := make([]byte, 20000)
+	x := uint32(1)
+	for i := range data {
+		x = (x*1103515245 + 12345) & 0x7fffffff
+		data[i] = byte(x >> 16)
+	}
+	return data
+}
+
+func TestSsdeepHash(t *testing.T) {
+	random := ssdeepTestRandom()
+	edited := append(append(append([]byte{}, random[:5000]...), "PATCHED!"...), random[5008:]...)
+	// 期待値は spamsum の参照実装で計算したもの
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "3::"},
+		{"short", []byte("hello world"), "3:iKFSMPn:rJPn"},
+		{"text", ssdeepTestText(), "24:FC9oJsU2mum8FuoNHe9jzXShl0Rq6x2dxX6cDJukSccyVGLg3JtIUb6UrNUSWojw:FkasU5ugoYX0lxXtPScnMMnIyhU/"},
+		{"random", random, "384:xD/5kIQXbCQ7d2AxNL73U3WhNnB6/+mSObyiT7hevd/o9GPpjBrfqegZx9ceI:x1k3XbCQOWPnBsbZhe1+0hBriFHK"},
+		{"random with 8 bytes replaced", edited, "384:xD/5kIQXbCQ7d2AxNv73U3WhNnB6/+mSObyiT7hevd/o9GPpjBrfqegZx9ceI:x1k3XbCQmWPnBsbZhe1+0hBriFHK"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SsdeepHash(tt.data); got != tt.want {
+				t.Errorf("SsdeepHash() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSsdeepBlockSize(t *testing.T) {
+	tests := []struct {
+		hash   string
+		want   uint64
+		wantOK bool
+	}{
+		{"3::", 3, true},
+		{"384:xD/5kIQ:x1k3", 384, true},
+		{"12288:abc:de", 12288, true},
+		{"", 0, false},
+		{"abc", 0, false},
+		{"x:abc:de", 0, false},
+		{"0:abc:de", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := SsdeepBlockSize(tt.hash)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("SsdeepBlockSize(%q) = %d, %v, want %d, %v", tt.hash, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	// ComputeFileHashes は同じブロックサイズを返す
+	if hashes := ComputeFileHashes(ssdeepTestRandom()); hashes.BlockSize != 384 {
+		t.Errorf("ComputeFileHashes().BlockSize = %d, want 384", hashes.BlockSize)
+	}
+}
+
+func TestSsdeepCompare(t *testing.T) {
+	random := ssdeepTestRandom()
+	edited := append(append(append([]byte{}, random[:5000]...), "PATCHED!"...), random[5008:]...)
+	tests := []struct {
+		name string
+		a, b string
+		want int
+	}{
+		{"identical", "48:ABCDEFGHIJ:", "48:ABCDEFGHIJ:", 100},
+		{"one substitution", "48:ABCDEFGHIJ:", "48:ABCDEFGHIK:", 91},
+		// 小さいブロックサイズでは短いハッシュの一致度を抑える
+		{"capped at small block size", "3:ABCDEFGHIJ:", "3:ABCDEFGHIK:", 10},
+		// ブロックサイズが2倍違えば片方の2つ目の部分と比べる
+		{"double block size", "96:ABCDEFGHIJKL:x", "48:zzz:ABCDEFGHIJKL", 100},
+		// 4文字以上続く同じ文字は3文字に縮めてから比べる
+		{"repeated characters", "48:AAAAAAABCDEFGH:", "48:AAABCDEFGH:", 100},
+		{"no common substring", "48:ABCDEFGHIJ:", "48:KLMNOPQRST:", 0},
+		{"incompatible block sizes", "3:ABCDEFGHIJ:", "12:ABCDEFGHIJ:", 0},
+		{"malformed", "48:ABCDEFGHIJ", "48:ABCDEFGHIJ:", 0},
+		{"edited file", SsdeepHash(random), SsdeepHash(edited), 99},
+		{"unrelated files", SsdeepHash(ssdeepTestText()), SsdeepHash(random), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SsdeepCompare(tt.a, tt.b); got != tt.want {
+				t.Errorf("SsdeepCompare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+			if got := SsdeepCompare(tt.b, tt.a); got != tt.want {
+				t.Errorf("SsdeepCompare(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+}